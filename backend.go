@@ -0,0 +1,355 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"sync"
+)
+
+var (
+	// ErrBackendReadOnly is returned when a read-only backend is written, or is used by a db
+	// not opened with ReadOnly.
+	ErrBackendReadOnly = errors.New("the backend is read-only")
+
+	// ErrBackendNotSupported is returned by the operations which need the data files on the
+	// file system, e.g. the backups and the snapshots, when the db uses another Backend.
+	ErrBackendNotSupported = errors.New("the operation is not supported by the backend")
+)
+
+// Backend represents the storage of the data files (segments) of a db. The data files are
+// identified by their paths in the Dir, the other files of the db, e.g. the index files of
+// HintBPTSparseIdxMode, the overflow files and the checkpoints, stay in the Dir.
+type Backend interface {
+	// Open opens the data file at given path, it is created with the capacity if it is missing.
+	Open(path string, capacity int64) (RWManager, error)
+
+	// Size returns the size of the data file at given path, or an error satisfying os.IsNotExist
+	// if it is missing.
+	Size(path string) (int64, error)
+
+	// Remove removes the data file at given path.
+	Remove(path string) error
+
+	// List returns the names of the data files in the dir.
+	List(dir string) ([]string, error)
+}
+
+// fileBackend is the Backend of the data files on the file system, used when Options.Backend is nil.
+type fileBackend struct {
+	rwMode RWMode
+}
+
+// NewFileBackend returns the Backend of the data files on the file system, read and written with rwMode.
+func NewFileBackend(rwMode RWMode) Backend {
+	return fileBackend{rwMode: rwMode}
+}
+
+func (b fileBackend) Open(path string, capacity int64) (RWManager, error) {
+	if b.rwMode == MMap {
+		return NewMMapRWManager(path, capacity)
+	}
+
+	return NewFileIORWManager(path, capacity)
+}
+
+func (b fileBackend) Size(path string) (int64, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+
+	return fi.Size(), nil
+}
+
+func (b fileBackend) Remove(path string) error {
+	return os.Remove(path)
+}
+
+func (b fileBackend) List(dir string) ([]string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, f := range files {
+		if !f.IsDir() && path.Ext(f.Name()) == DataSuffix {
+			names = append(names, f.Name())
+		}
+	}
+
+	return names, nil
+}
+
+// MemoryBackend represents the Backend of the data files kept in memory, e.g. for the tests.
+// The data files live as long as the backend, a db opened again with it reads them.
+type MemoryBackend struct {
+	mu    sync.Mutex
+	files map[string]*memoryFile
+}
+
+// memoryFile is a data file of a MemoryBackend.
+type memoryFile struct {
+	mu   sync.RWMutex
+	data []byte
+}
+
+// NewMemoryBackend returns a newly initialized MemoryBackend object.
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{files: make(map[string]*memoryFile)}
+}
+
+// Open opens the data file at given path, it is created with the capacity if it is missing.
+func (b *MemoryBackend) Open(path string, capacity int64) (RWManager, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	f, ok := b.files[path]
+	if !ok {
+		f = &memoryFile{}
+		b.files[path] = f
+	}
+
+	f.mu.Lock()
+	if int64(len(f.data)) < capacity {
+		f.data = append(f.data, make([]byte, capacity-int64(len(f.data)))...)
+	}
+	f.mu.Unlock()
+
+	return &memoryRWManager{f: f}, nil
+}
+
+// Size returns the size of the data file at given path.
+func (b *MemoryBackend) Size(path string) (int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	f, ok := b.files[path]
+	if !ok {
+		return 0, &os.PathError{Op: "stat", Path: path, Err: os.ErrNotExist}
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return int64(len(f.data)), nil
+}
+
+// Remove removes the data file at given path.
+func (b *MemoryBackend) Remove(path string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.files[path]; !ok {
+		return &os.PathError{Op: "remove", Path: path, Err: os.ErrNotExist}
+	}
+	delete(b.files, path)
+
+	return nil
+}
+
+// List returns the names of the data files in the dir.
+func (b *MemoryBackend) List(dir string) ([]string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var names []string
+	for p := range b.files {
+		if path.Dir(p) == path.Clean(dir) {
+			names = append(names, path.Base(p))
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// memoryRWManager represents the RWManager of a data file of a MemoryBackend.
+type memoryRWManager struct {
+	f *memoryFile
+}
+
+func (m *memoryRWManager) WriteAt(b []byte, off int64) (n int, err error) {
+	m.f.mu.Lock()
+	defer m.f.mu.Unlock()
+
+	if off < 0 || off >= int64(len(m.f.data)) {
+		return 0, ErrIndexOutOfBound
+	}
+
+	n = copy(m.f.data[off:], b)
+	if n < len(b) {
+		return n, io.ErrShortWrite
+	}
+
+	return n, nil
+}
+
+func (m *memoryRWManager) ReadAt(b []byte, off int64) (n int, err error) {
+	m.f.mu.RLock()
+	defer m.f.mu.RUnlock()
+
+	return readAtBytes(m.f.data, b, off)
+}
+
+func (m *memoryRWManager) Sync() error {
+	return nil
+}
+
+func (m *memoryRWManager) Close() error {
+	return nil
+}
+
+// readAtBytes reads b from data at given off, like ReadAt of io.ReaderAt.
+func readAtBytes(data, b []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, ErrIndexOutOfBound
+	}
+	if off >= int64(len(data)) {
+		return 0, io.EOF
+	}
+
+	n = copy(b, data[off:])
+	if n < len(b) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+// ObjectStore represents a store of the objects read by ranges, e.g. an S3 bucket, holding the
+// data files of a db by their names.
+type ObjectStore interface {
+	// ReadAt reads len(b) bytes of the object at given name from off, like ReadAt of io.ReaderAt.
+	ReadAt(name string, b []byte, off int64) (n int, err error)
+
+	// Size returns the size of the object at given name, or an error satisfying os.IsNotExist
+	// if it is missing.
+	Size(name string) (int64, error)
+
+	// List returns the names of the objects.
+	List() ([]string, error)
+}
+
+// ObjectBackend represents the read-only Backend of the data files archived in an ObjectStore,
+// the names of the objects are the names of the data files. A db with an ObjectBackend must be
+// opened with ReadOnly, the Dir holds its lock file.
+type ObjectBackend struct {
+	store ObjectStore
+}
+
+// NewObjectBackend returns a newly initialized ObjectBackend object reading the store.
+func NewObjectBackend(store ObjectStore) *ObjectBackend {
+	return &ObjectBackend{store: store}
+}
+
+// Open opens the data file at given path, it must be in the store.
+func (b *ObjectBackend) Open(path string, capacity int64) (RWManager, error) {
+	name := objectName(path)
+	if _, err := b.store.Size(name); err != nil {
+		return nil, err
+	}
+
+	return &objectRWManager{store: b.store, name: name}, nil
+}
+
+// Size returns the size of the data file at given path.
+func (b *ObjectBackend) Size(path string) (int64, error) {
+	return b.store.Size(objectName(path))
+}
+
+// Remove returns ErrBackendReadOnly.
+func (b *ObjectBackend) Remove(path string) error {
+	return ErrBackendReadOnly
+}
+
+// List returns the names of the data files in the store.
+func (b *ObjectBackend) List(dir string) ([]string, error) {
+	names, err := b.store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var dataNames []string
+	for _, name := range names {
+		if path.Ext(name) == DataSuffix {
+			dataNames = append(dataNames, name)
+		}
+	}
+
+	return dataNames, nil
+}
+
+// objectName returns the name of the object of the data file at given path.
+func objectName(p string) string {
+	return path.Base(p)
+}
+
+// objectRWManager represents the RWManager of a data file of an ObjectBackend.
+type objectRWManager struct {
+	store ObjectStore
+	name  string
+}
+
+func (m *objectRWManager) WriteAt(b []byte, off int64) (n int, err error) {
+	return 0, ErrBackendReadOnly
+}
+
+func (m *objectRWManager) ReadAt(b []byte, off int64) (n int, err error) {
+	return m.store.ReadAt(m.name, b, off)
+}
+
+func (m *objectRWManager) Sync() error {
+	return nil
+}
+
+func (m *objectRWManager) Close() error {
+	return nil
+}
+
+// backend returns the Backend of the data files of the db.
+func (db *DB) backend() Backend {
+	if db.opt.Backend != nil {
+		return db.opt.Backend
+	}
+
+	return fileBackend{rwMode: db.opt.RWMode}
+}
+
+// dataFileExists returns if the data file at given path exists.
+func (db *DB) dataFileExists(path string) bool {
+	_, err := db.backend().Size(path)
+	return err == nil
+}
+
+// removeDataFile removes the data file at given path.
+func (db *DB) removeDataFile(path string) error {
+	return db.backend().Remove(path)
+}
+
+// checkFileBackend returns ErrBackendNotSupported if the data files of the db are not on the file system.
+func (db *DB) checkFileBackend() error {
+	if db.opt.Backend != nil {
+		return ErrBackendNotSupported
+	}
+
+	return nil
+}
@@ -0,0 +1,178 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+// dirObjectStore is the ObjectStore of the files of a dir.
+type dirObjectStore string
+
+func (s dirObjectStore) ReadAt(name string, b []byte, off int64) (int, error) {
+	f, err := os.Open(string(s) + "/" + name)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	return f.ReadAt(b, off)
+}
+
+func (s dirObjectStore) Size(name string) (int64, error) {
+	fi, err := os.Stat(string(s) + "/" + name)
+	if err != nil {
+		return 0, err
+	}
+
+	return fi.Size(), nil
+}
+
+func (s dirObjectStore) List() ([]string, error) {
+	files, err := ioutil.ReadDir(string(s))
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(files))
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+
+	return names, nil
+}
+
+func putBackendKeys(t *testing.T, db *DB, n int) {
+	t.Helper()
+
+	for i := 0; i < n; i++ {
+		if err := db.Update(func(tx *Tx) error {
+			return tx.Put("bucket", []byte(fmt.Sprintf("key_%03d", i)), []byte(fmt.Sprintf("val_%03d", i)), Persistent)
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func checkBackendKeys(t *testing.T, db *DB, n int) {
+	t.Helper()
+
+	if err := db.View(func(tx *Tx) error {
+		for i := 0; i < n; i++ {
+			e, err := tx.Get("bucket", []byte(fmt.Sprintf("key_%03d", i)))
+			if err != nil {
+				return err
+			}
+			if want := fmt.Sprintf("val_%03d", i); string(e.Value) != want {
+				t.Errorf("err Get, got %s want %s", e.Value, want)
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDB_MemoryBackend(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestbackend", true)
+	opt.SegmentSize = 1024
+	opt.Backend = NewMemoryBackend()
+	db, err := Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	putBackendKeys(t, db, 50)
+	putBackendKeys(t, db, 50)
+	checkBackendKeys(t, db, 50)
+
+	names, err := opt.Backend.List(opt.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) < 2 {
+		t.Fatalf("err List, got %d data files want at least 2", len(names))
+	}
+
+	// the data files are not on the file system.
+	files, _ := ioutil.ReadDir(opt.Dir)
+	for _, f := range files {
+		if path.Ext(f.Name()) == DataSuffix {
+			t.Errorf("err data file %s in the dir", f.Name())
+		}
+	}
+
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	checkBackendKeys(t, db, 50)
+
+	if err := db.Backup("/tmp/nutsdbtestbackend_backup"); err != ErrBackendNotSupported {
+		t.Errorf("err Backup, got %v want %v", err, ErrBackendNotSupported)
+	}
+
+	// the db opened again with the backend reads its data files.
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	checkBackendKeys(t, db, 50)
+}
+
+func TestDB_ObjectBackend(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestbackend", true)
+	opt.SegmentSize = 1024
+	db, err := Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	putBackendKeys(t, db, 50)
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the data files are served by the store, the dir of the db holds the lock file.
+	dir := "/tmp/nutsdbtestbackend_object"
+	os.RemoveAll(dir)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	objectOpt := opt
+	objectOpt.Dir = dir
+	objectOpt.Backend = NewObjectBackend(dirObjectStore(opt.Dir))
+	if _, err := Open(objectOpt); err != ErrBackendReadOnly {
+		t.Errorf("err Open, got %v want %v", err, ErrBackendReadOnly)
+	}
+
+	objectOpt.ReadOnly = true
+	db, err = Open(objectOpt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	checkBackendKeys(t, db, 50)
+}
@@ -0,0 +1,81 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// ErrWriteStalled is returned when a commit would exceed MaxPendingCommitBytes with BackpressureReject.
+var ErrWriteStalled = errors.New("the commit is rejected, the pending commits exceed the max bytes")
+
+// BackpressureMode represents what a commit does when the pending commits exceed MaxPendingCommitBytes.
+type BackpressureMode int
+
+const (
+	// BackpressureBlock syncs the pending commits before the commit is written,
+	// the writers wait for the disk instead of filling the memory.
+	BackpressureBlock BackpressureMode = iota
+
+	// BackpressureReject fails the commit with ErrWriteStalled, nothing is written,
+	// so that the application can shed the load.
+	BackpressureReject
+)
+
+// StallInfo records a commit stalled by MaxPendingCommitBytes.
+type StallInfo struct {
+	// PendingBytes represents the size in bytes of the commits not synced yet.
+	PendingBytes int64
+
+	// CommitBytes represents the size in bytes of the entries of the stalled commit.
+	CommitBytes int64
+
+	// Rejected represents whether the commit is rejected with ErrWriteStalled,
+	// else it waits for the pending commits to be synced.
+	Rejected bool
+}
+
+// checkBackpressure stalls the commit of the tx if its entries would exceed MaxPendingCommitBytes,
+// with the db locked. The txs of the merge and of the expiration are not stalled.
+func (tx *Tx) checkBackpressure() error {
+	db := tx.db
+	limit := db.opt.MaxPendingCommitBytes
+
+	if limit <= 0 || tx.isMerging || tx.isExpiring || db.syncEachWrite() {
+		return nil
+	}
+
+	if db.unsyncedBytes == 0 || db.unsyncedBytes+tx.pendingBytes <= limit {
+		return nil
+	}
+
+	info := StallInfo{
+		PendingBytes: db.unsyncedBytes,
+		CommitBytes:  tx.pendingBytes,
+		Rejected:     db.opt.Backpressure == BackpressureReject,
+	}
+
+	atomic.AddUint64(&db.metrics.stalledCommits, 1)
+	if db.opt.OnStall != nil {
+		db.opt.OnStall(info)
+	}
+
+	if info.Rejected {
+		return ErrWriteStalled
+	}
+
+	return db.syncActiveFile()
+}
@@ -0,0 +1,83 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestDB_Backpressure(t *testing.T) {
+	// the entries of "bucket" with a 5-byte key and a 3-byte value.
+	size := int64(DataEntryHeaderSize + len("bucket") + 5 + 3)
+
+	for _, mode := range []BackpressureMode{BackpressureBlock, BackpressureReject} {
+		InitOpt("/tmp/nutsdbtestbackpressure", true)
+		opt.SyncPolicy = SyncNever
+		opt.MaxPendingCommitBytes = 2 * size
+		opt.Backpressure = mode
+
+		var stalls []StallInfo
+		opt.OnStall = func(info StallInfo) {
+			stalls = append(stalls, info)
+		}
+
+		db, err = Open(opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		m := &syncCountingRWManager{RWManager: db.ActiveFile.rwManager}
+		db.ActiveFile.rwManager = m
+
+		var rejected int
+		for i := 0; i < 3; i++ {
+			err := db.Update(func(tx *Tx) error {
+				return tx.Put("bucket", []byte(fmt.Sprintf("key_%d", i)), []byte("val"), Persistent)
+			})
+			if err == ErrWriteStalled {
+				rejected++
+			} else if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		want := StallInfo{PendingBytes: 2 * size, CommitBytes: size, Rejected: mode == BackpressureReject}
+		if len(stalls) != 1 || stalls[0] != want {
+			t.Errorf("err OnStall, got %v want %v", stalls, want)
+		}
+
+		wantSyncs, wantRejected := 1, 0
+		if mode == BackpressureReject {
+			wantSyncs, wantRejected = 0, 1
+		}
+		if m.syncs != wantSyncs || rejected != wantRejected {
+			t.Errorf("err stalled commit, got %d syncs %d rejected want %d syncs %d rejected",
+				m.syncs, rejected, wantSyncs, wantRejected)
+		}
+
+		stats, err := db.Stats()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.StalledCommits != 1 {
+			t.Errorf("err StalledCommits, got %d want %d", stats.StalledCommits, 1)
+		}
+
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
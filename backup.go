@@ -0,0 +1,276 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrDirNotEmpty is returned when restoring a backup to a dir which is not empty.
+	ErrDirNotEmpty = errors.New("dir is not empty")
+
+	// ErrInvalidBackupFile is returned when a file in the backup has an invalid path.
+	ErrInvalidBackupFile = errors.New("invalid file in backup")
+)
+
+// backupFile records a file of the database taken by a backup snapshot.
+type backupFile struct {
+	name    string // the path relative to the database dir
+	mode    os.FileMode
+	modTime time.Time
+	size    int64
+	f       *os.File
+	data    []byte // the content of the files rewritten in place, such as bucket meta files
+	link    bool   // the file is a sealed data file or an overflow file, the data written to it never changes
+}
+
+// reader returns the reader of the file content at the time of the snapshot.
+func (bf *backupFile) reader() io.Reader {
+	if bf.f == nil {
+		return bytes.NewReader(bf.data)
+	}
+
+	return io.NewSectionReader(bf.f, 0, bf.size)
+}
+
+// Backup copies the database to file directory at the given dir.
+// It performs a hot backup, the writes are only blocked while taking the snapshot.
+// The backup can be opened directly by setting Options.Dir to the dir.
+func (db *DB) Backup(dir string) error {
+	files, err := db.snapshotFiles()
+	if err != nil {
+		return err
+	}
+	defer closeBackupFiles(files)
+
+	for _, bf := range files {
+		if err := writeBackupFile(dir, bf.name, bf.mode, bf.reader()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// BackupTarGZ writes the database to w as a tar.gz archive.
+// It performs a hot backup like Backup, use RestoreTarGZ to restore it.
+func (db *DB) BackupTarGZ(w io.Writer) error {
+	files, err := db.snapshotFiles()
+	if err != nil {
+		return err
+	}
+	defer closeBackupFiles(files)
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	for _, bf := range files {
+		hdr := &tar.Header{
+			Name:     bf.name,
+			Mode:     int64(bf.mode),
+			Size:     bf.size,
+			ModTime:  bf.modTime,
+			Typeflag: tar.TypeReg,
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if _, err := io.Copy(tw, bf.reader()); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	return gw.Close()
+}
+
+// RestoreTarGZ restores the backup written by BackupTarGZ from r to the dir.
+// The dir must not exist or be empty, open the database at the dir when it is done.
+func RestoreTarGZ(r io.Reader, dir string) error {
+	if files, err := ioutil.ReadDir(dir); err == nil && len(files) > 0 {
+		return ErrDirNotEmpty
+	}
+
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gr.Close()
+
+	tr := tar.NewReader(gr)
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := path.Clean(hdr.Name)
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return ErrInvalidBackupFile
+		}
+
+		if err := writeBackupFile(dir, name, os.FileMode(hdr.Mode).Perm(), tr); err != nil {
+			return err
+		}
+	}
+}
+
+// snapshotFiles takes a consistent snapshot of the database files.
+// It holds the read lock only to open the files: the data files are append-only
+// and the merged ones stay readable through the opened files after being removed,
+// the active data file is taken up to its write offset.
+func (db *DB) snapshotFiles() (files []*backupFile, err error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, ErrDBClosed
+	}
+
+	if err := db.checkFileBackend(); err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err != nil {
+			closeBackupFiles(files)
+		}
+	}()
+
+	activeDataPath := db.getDataPath(db.MaxFileID)
+
+	err = walkFiles(db.opt.Dir, func(filePath string, info os.FileInfo) error {
+		// the recycled files hold no entry, and the snapshots and the lock of the readers are not part of the database.
+		if path.Ext(filePath) == RecycleSuffix || strings.HasPrefix(filePath, db.getSnapshotsPath()+"/") ||
+			filePath == db.getReadersLockPath() || filePath == db.getDirLockPath() {
+			return nil
+		}
+
+		bf := &backupFile{
+			name:    strings.TrimPrefix(strings.TrimPrefix(filePath, db.opt.Dir), "/"),
+			mode:    info.Mode().Perm(),
+			modTime: info.ModTime(),
+			size:    info.Size(),
+		}
+
+		if path.Ext(filePath) == BucketMetaSuffix {
+			if bf.data, err = ioutil.ReadFile(filePath); err != nil {
+				return err
+			}
+			bf.size = int64(len(bf.data))
+			files = append(files, bf)
+			return nil
+		}
+
+		if filePath == activeDataPath {
+			bf.size = db.ActiveFile.writeOff
+		} else if ext := path.Ext(filePath); ext == DataSuffix || ext == OverflowSuffix {
+			bf.link = true
+		}
+
+		if bf.f, err = os.Open(filePath); err != nil {
+			return err
+		}
+		files = append(files, bf)
+
+		return nil
+	})
+
+	return
+}
+
+// walkFiles calls fn for each regular file in the dir and its sub dirs.
+func walkFiles(dir string, fn func(filePath string, info os.FileInfo) error) error {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, info := range infos {
+		filePath := dir + "/" + info.Name()
+
+		if info.IsDir() {
+			if err := walkFiles(filePath, fn); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if info.Mode().IsRegular() {
+			if err := fn(filePath, info); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// writeBackupFile writes the content read from r to the file at given name in the dir.
+func writeBackupFile(dir, name string, mode os.FileMode, r io.Reader) error {
+	filePath := dir + "/" + name
+	if err := os.MkdirAll(path.Dir(filePath), os.ModePerm); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// closeBackupFiles closes the files opened by the backup snapshot.
+func closeBackupFiles(files []*backupFile) {
+	for _, bf := range files {
+		if bf.f != nil {
+			_ = bf.f.Close()
+		}
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/xujiajun/utils/strconv2"
+)
+
+func putKeysForBackup(t *testing.T, bucket string, start, end int) {
+	for i := start; i < end; i++ {
+		if err := db.Update(func(tx *Tx) error {
+			return tx.Put(bucket, []byte("key_"+strconv2.IntToStr(i)), []byte("val_"+strconv2.IntToStr(i)), Persistent)
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func checkKeysForBackup(t *testing.T, backupDB *DB, bucket string, end, notExisted int) {
+	if err := backupDB.View(func(tx *Tx) error {
+		for i := 0; i < end; i++ {
+			e, err := tx.Get(bucket, []byte("key_"+strconv2.IntToStr(i)))
+			if err != nil {
+				return err
+			}
+			if string(e.Value) != "val_"+strconv2.IntToStr(i) {
+				t.Errorf("err backup, got %s want %s", e.Value, "val_"+strconv2.IntToStr(i))
+			}
+		}
+		if _, err := tx.Get(bucket, []byte("key_"+strconv2.IntToStr(notExisted))); err == nil {
+			t.Error("err backup, get the key written after the backup")
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDB_BackupAndOpen(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestforbackup", true)
+	opt.SegmentSize = 1024
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	bucket := "bucket_for_backup"
+	putKeysForBackup(t, bucket, 0, 30)
+
+	dir := "/tmp/nutsdbtestforbackup_dir"
+	os.RemoveAll(dir)
+	if err := db.Backup(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	putKeysForBackup(t, bucket, 30, 31)
+
+	backupOpt := opt
+	backupOpt.Dir = dir
+	backupDB, err := Open(backupOpt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backupDB.Close()
+
+	checkKeysForBackup(t, backupDB, bucket, 30, 30)
+}
+
+func TestDB_BackupTarGZ(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestforbackup", true)
+	opt.SegmentSize = 1024
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	bucket := "bucket_for_backup"
+	putKeysForBackup(t, bucket, 0, 30)
+
+	var buf bytes.Buffer
+	if err := db.BackupTarGZ(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	putKeysForBackup(t, bucket, 30, 31)
+
+	dir := "/tmp/nutsdbtestforbackup_targz"
+	os.RemoveAll(dir)
+	if err := RestoreTarGZ(bytes.NewReader(buf.Bytes()), dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RestoreTarGZ(bytes.NewReader(buf.Bytes()), dir); err != ErrDirNotEmpty {
+		t.Errorf("err restore, got %v want %v", err, ErrDirNotEmpty)
+	}
+
+	backupOpt := opt
+	backupOpt.Dir = dir
+	backupDB, err := Open(backupOpt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backupDB.Close()
+
+	checkKeysForBackup(t, backupDB, bucket, 30, 30)
+}
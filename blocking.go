@@ -0,0 +1,73 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrPopTimeout is returned when BLPop or BRPop times out before an item is pushed to the list.
+var ErrPopTimeout = errors.New("timeout waiting for an item of the list")
+
+// BLPop removes and returns the first element of the list stored in the bucket at given bucket and key,
+// like LPop in its own read/write tx. If the list is empty, it waits for an item to be pushed, at most
+// timeout, or without limit if timeout is not positive, then returns ErrPopTimeout.
+// It can not be called in a tx, which would hold the lock needed by the pushes it waits for.
+func (db *DB) BLPop(bucket string, key []byte, timeout time.Duration) ([]byte, error) {
+	return db.blockingPop(bucket, key, timeout, (*Tx).LPop)
+}
+
+// BRPop removes and returns the last element of the list stored in the bucket at given bucket and key,
+// like RPop, waiting for an item like BLPop.
+func (db *DB) BRPop(bucket string, key []byte, timeout time.Duration) ([]byte, error) {
+	return db.blockingPop(bucket, key, timeout, (*Tx).RPop)
+}
+
+func (db *DB) blockingPop(bucket string, key []byte, timeout time.Duration, pop func(tx *Tx, bucket string, key []byte) ([]byte, error)) ([]byte, error) {
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	for {
+		var (
+			item      []byte
+			committed chan struct{}
+		)
+
+		err := db.Update(func(tx *Tx) error {
+			var err error
+			if item, err = pop(tx, bucket, key); errors.Is(err, ErrBucketNotFound) || errors.Is(err, ErrKeyNotFound) {
+				// the commits are notified with the db locked, so none is missed before waiting.
+				committed = db.commitCh
+			}
+			return err
+		})
+		if committed == nil {
+			return item, err
+		}
+
+		select {
+		case <-committed:
+		case <-deadline:
+			return nil, ErrPopTimeout
+		case <-db.closeCh:
+			return nil, ErrDBClosed
+		}
+	}
+}
@@ -86,6 +86,7 @@ type (
 	BPTree struct {
 		root             *Node
 		ValidKeyCount    int // the number of the key that not expired or deleted
+		ttlKeyCount      int // the number of the valid keys with a TTL, they expire without being deleted
 		FirstKey         []byte
 		LastKey          []byte
 		LastAddress      int64
@@ -93,6 +94,7 @@ type (
 		bucketSize       uint32
 		keyPosMap        map[string]int64
 		enabledKeyPosMap bool
+		cmp              func(a, b []byte) int // the order of the keys, bytewise if nil
 	}
 
 	// Records records multi-records as result when is called Range or PrefixScan.
@@ -107,6 +109,7 @@ type (
 		KeysNum  int
 		Next     *Node
 		Address  int64
+		prev     *Node // the previous leaf, only set for the leaf node
 	}
 
 	// BinaryNode represents binary node.
@@ -194,7 +197,7 @@ func (t *BPTree) FindLeaf(key []byte) *Node {
 	for !curr.isLeaf {
 		i = 0
 		for i < curr.KeysNum {
-			if compare(key, curr.Keys[i]) >= 0 {
+			if t.compare(key, curr.Keys[i]) >= 0 {
 				i++
 			} else {
 				break
@@ -404,6 +407,15 @@ func compare(a, b []byte) int {
 	return bytes.Compare(a, b)
 }
 
+// compare compares the keys a and b in the order of the tree.
+func (t *BPTree) compare(a, b []byte) int {
+	if t.cmp != nil {
+		return t.cmp(a, b)
+	}
+
+	return bytes.Compare(a, b)
+}
+
 func (t *BPTree) getAll() (numFound int, keys [][]byte, pointers []interface{}) {
 	var (
 		n    *Node
@@ -443,14 +455,14 @@ func (t *BPTree) findRange(start, end []byte) (numFound int, keys [][]byte, poin
 		return 0, nil, nil
 	}
 
-	for j = 0; j < n.KeysNum && compare(n.Keys[j], start) < 0; {
+	for j = 0; j < n.KeysNum && t.compare(n.Keys[j], start) < 0; {
 		j++
 	}
 
 	scanFlag = true
 	for n != nil && scanFlag {
 		for i = j; i < n.KeysNum; i++ {
-			if compare(n.Keys[i], end) > 0 {
+			if t.compare(n.Keys[i], end) > 0 {
 				scanFlag = false
 				break
 			}
@@ -467,6 +479,85 @@ func (t *BPTree) findRange(start, end []byte) (numFound int, keys [][]byte, poin
 	return
 }
 
+// findRangeReverse returns numFound,keys and pointers at the given start key and end key, in descending order.
+func (t *BPTree) findRangeReverse(start, end []byte) (numFound int, keys [][]byte, pointers []interface{}) {
+	var (
+		n        *Node
+		i, j     int
+		scanFlag bool
+	)
+
+	if n = t.FindLeaf(end); n == nil {
+		return 0, nil, nil
+	}
+
+	for j = n.KeysNum - 1; j >= 0 && t.compare(n.Keys[j], end) > 0; {
+		j--
+	}
+
+	scanFlag = true
+	for n != nil && scanFlag {
+		for i = j; i >= 0; i-- {
+			if t.compare(n.Keys[i], start) < 0 {
+				scanFlag = false
+				break
+			}
+			keys = append(keys, n.Keys[i])
+			pointers = append(pointers, n.pointers[i])
+			numFound++
+		}
+
+		if n = n.prev; n != nil {
+			j = n.KeysNum - 1
+		}
+	}
+
+	return
+}
+
+// findFirstLeaf returns the first leaf of the b+ tree.
+func (t *BPTree) findFirstLeaf() *Node {
+	curr := t.root
+	if curr == nil {
+		return nil
+	}
+
+	for !curr.isLeaf {
+		curr = curr.pointers[0].(*Node)
+	}
+
+	return curr
+}
+
+// findLastLeaf returns the last leaf of the b+ tree.
+func (t *BPTree) findLastLeaf() *Node {
+	curr := t.root
+	if curr == nil {
+		return nil
+	}
+
+	for !curr.isLeaf {
+		curr = curr.pointers[curr.KeysNum].(*Node)
+	}
+
+	return curr
+}
+
+// prefixSuccessor returns the smallest key greater than all the keys with the given prefix,
+// it returns nil if there is no such key.
+func prefixSuccessor(prefix []byte) []byte {
+	for i := len(prefix) - 1; i >= 0; i-- {
+		if prefix[i] != 0xff {
+			succ := make([]byte, i+1)
+			copy(succ, prefix)
+			succ[i]++
+			return succ
+		}
+	}
+
+	return nil
+}
+
 // All returns all records in the b+ tree.
 func (t *BPTree) All() (records Records, err error) {
 	return getRecordWrapper(t.getAll())
@@ -474,7 +565,7 @@ func (t *BPTree) All() (records Records, err error) {
 
 // Range returns records at the given start key and end key.
 func (t *BPTree) Range(start, end []byte) (records Records, err error) {
-	if compare(start, end) > 0 {
+	if t.compare(start, end) > 0 {
 		return nil, ErrStartKey
 	}
 
@@ -512,7 +603,7 @@ func (t *BPTree) PrefixScan(prefix []byte, offsetNum int, limitNum int) (records
 		return nil, off, ErrPrefixScansNoResult
 	}
 
-	for j = 0; j < n.KeysNum && compare(n.Keys[j], prefix) < 0; {
+	for j = 0; j < n.KeysNum && t.compare(n.Keys[j], prefix) < 0; {
 		j++
 	}
 
@@ -554,6 +645,123 @@ func (t *BPTree) PrefixScan(prefix []byte, offsetNum int, limitNum int) (records
 	return esr, off, err
 }
 
+// ascend calls fn with the keys and records from the first key greater than or equal to start,
+// or from the first key if start is nil, in ascending order, until fn returns false.
+func (t *BPTree) ascend(start []byte, fn func(key []byte, r *Record) bool) {
+	var n *Node
+	if start == nil {
+		n = t.findFirstLeaf()
+	} else {
+		n = t.FindLeaf(start)
+	}
+	if n == nil {
+		return
+	}
+
+	j := 0
+	for start != nil && j < n.KeysNum && t.compare(n.Keys[j], start) < 0 {
+		j++
+	}
+
+	for n != nil {
+		for i := j; i < n.KeysNum; i++ {
+			if !fn(n.Keys[i], n.pointers[i].(*Record)) {
+				return
+			}
+		}
+
+		n, _ = n.pointers[order-1].(*Node)
+		j = 0
+	}
+}
+
+// descend calls fn with the keys and records from the last key, in descending order,
+// until fn returns false.
+func (t *BPTree) descend(fn func(key []byte, r *Record) bool) {
+	for n := t.findLastLeaf(); n != nil; n = n.prev {
+		for i := n.KeysNum - 1; i >= 0; i-- {
+			if !fn(n.Keys[i], n.pointers[i].(*Record)) {
+				return
+			}
+		}
+	}
+}
+
+// RangeReverse returns records at the given start key and end key, in descending order.
+func (t *BPTree) RangeReverse(start, end []byte) (records Records, err error) {
+	if t.compare(start, end) > 0 {
+		return nil, ErrStartKey
+	}
+
+	return getRecordWrapper(t.findRangeReverse(start, end))
+}
+
+// PrefixScanReverse returns records at the given prefix and limitNum, in descending order.
+// offsetNum skips the last offsetNum records with the prefix.
+// limitNum: limit the number of the scanned records return.
+func (t *BPTree) PrefixScanReverse(prefix []byte, offsetNum int, limitNum int) (records Records, off int, err error) {
+	var (
+		n              *Node
+		scanFlag       bool
+		keys           [][]byte
+		pointers       []interface{}
+		i, j, numFound int
+	)
+
+	succ := prefixSuccessor(prefix)
+	if succ == nil {
+		n = t.findLastLeaf()
+	} else {
+		n = t.FindLeaf(succ)
+	}
+
+	if n == nil {
+		return nil, off, ErrPrefixScansNoResult
+	}
+
+	for j = n.KeysNum - 1; j >= 0 && succ != nil && t.compare(n.Keys[j], succ) >= 0; {
+		j--
+	}
+
+	scanFlag = true
+	numFound = 0
+
+	coff := 0
+
+	for n != nil && scanFlag {
+		for i = j; i >= 0; i-- {
+
+			if !bytes.HasPrefix(n.Keys[i], prefix) {
+				scanFlag = false
+				break
+			}
+
+			if coff < offsetNum {
+				coff++
+				continue
+			}
+
+			keys = append(keys, n.Keys[i])
+			pointers = append(pointers, n.pointers[i])
+			numFound++
+
+			if limitNum > 0 && numFound == limitNum {
+				scanFlag = false
+				break
+			}
+		}
+
+		if n = n.prev; n != nil {
+			j = n.KeysNum - 1
+		}
+	}
+
+	off = coff
+
+	esr, err := getRecordWrapper(numFound, keys, pointers)
+	return esr, off, err
+}
+
 // PrefixSearchScan returns records at the given prefix, match regular expression and limitNum
 // limitNum: limit the number of the scanned records return.
 func (t *BPTree) PrefixSearchScan(prefix []byte, reg string, offsetNum int, limitNum int) (records Records, off int, err error) {
@@ -576,7 +784,7 @@ func (t *BPTree) PrefixSearchScan(prefix []byte, reg string, offsetNum int, limi
 		return nil, off, ErrPrefixSearchScansNoResult
 	}
 
-	for j = 0; j < n.KeysNum && compare(n.Keys[j], prefix) < 0; {
+	for j = 0; j < n.KeysNum && t.compare(n.Keys[j], prefix) < 0; {
 		j++
 	}
 
@@ -637,7 +845,7 @@ func (t *BPTree) Find(key []byte) (*Record, error) {
 	}
 
 	for i = 0; i < leaf.KeysNum; i++ {
-		if compare(key, leaf.Keys[i]) == 0 {
+		if t.compare(key, leaf.Keys[i]) == 0 {
 			break
 		}
 	}
@@ -663,21 +871,37 @@ func (t *BPTree) checkAndSetFirstKey(key []byte, h *Hint) {
 	if len(t.FirstKey) == 0 {
 		t.FirstKey = key
 	} else {
-		if compare(key, t.FirstKey) < 0 {
+		if t.compare(key, t.FirstKey) < 0 {
 			t.FirstKey = key
 		}
 	}
 }
 
 func (t *BPTree) checkAndSetLastKey(key []byte, h *Hint) {
-	if compare(key, t.LastKey) > 0 {
+	if t.compare(key, t.LastKey) > 0 {
 		t.LastKey = key
 	}
 }
 
+// ttlKeyDelta returns 1 if the record of the meta is a valid key with a TTL, else 0.
+func ttlKeyDelta(meta *MetaData) int {
+	if meta.Flag != DataDeleteFlag && meta.TTL != Persistent {
+		return 1
+	}
+
+	return 0
+}
+
 // Insert inserts record to the b+ tree,
 // and if the key exists, update the record and the counter(if countFlag set true,it will start count).
 func (t *BPTree) Insert(key []byte, e *Entry, h *Hint, countFlag bool) error {
+	_, _, err := t.insert(key, e, h, countFlag)
+	return err
+}
+
+// insert inserts record to the b+ tree like Insert, it returns the record of the key,
+// and a copy of the replaced version if the key exists.
+func (t *BPTree) insert(key []byte, e *Entry, h *Hint, countFlag bool) (r *Record, old *Record, err error) {
 	t.checkAndSetFirstKey(key, h)
 
 	t.checkAndSetLastKey(key, h)
@@ -691,19 +915,28 @@ func (t *BPTree) Insert(key []byte, e *Entry, h *Hint, countFlag bool) error {
 			t.ValidKeyCount++
 		}
 
-		return r.UpdateRecord(h, e)
+		if countFlag {
+			t.ttlKeyCount += ttlKeyDelta(h.meta) - ttlKeyDelta(r.H.meta)
+		}
+
+		old = &Record{H: r.H, E: r.E, version: r.version, prev: r.prev}
+
+		return r, old, r.UpdateRecord(h, e)
 	}
 
 	// Initialize the Record object When key does not exist.
 	pointer := &Record{H: h, E: e}
 
-	// Update the validKeyCount number
-	t.ValidKeyCount++
+	// Update the validKeyCount number, a delete of a missing key adds no valid key.
+	if h.meta.Flag != DataDeleteFlag {
+		t.ValidKeyCount++
+	}
+	t.ttlKeyCount += ttlKeyDelta(h.meta)
 
 	// Check if the root node is nil or not
 	// if nil build a start new tree for insert.
 	if t.root == nil {
-		return t.startNewTree(key, pointer)
+		return pointer, nil, t.startNewTree(key, pointer)
 	}
 
 	// Find the leaf node to insert.
@@ -712,12 +945,12 @@ func (t *BPTree) Insert(key []byte, e *Entry, h *Hint, countFlag bool) error {
 	// Check if the leaf node is full or not
 	// if not full insert into the leaf node.
 	if leaf.KeysNum < order-1 {
-		insertIntoLeaf(leaf, key, pointer)
-		return nil
+		t.insertIntoLeaf(leaf, key, pointer)
+		return pointer, nil, nil
 	}
 
 	// split the leaf node when it is not enough space to insert.
-	return t.splitLeaf(leaf, key, pointer)
+	return pointer, nil, t.splitLeaf(leaf, key, pointer)
 }
 
 // getSplitIndex returns split index at the given length.
@@ -738,7 +971,7 @@ func (t *BPTree) splitLeaf(leaf *Node, key []byte, pointer *Record) error {
 
 	// Find the ready position of the insertion.
 	for i < order-1 {
-		if compare(leaf.Keys[i], key) < 0 {
+		if t.compare(leaf.Keys[i], key) < 0 {
 			i++
 		} else {
 			break
@@ -786,8 +1019,14 @@ func (t *BPTree) splitLeaf(leaf *Node, key []byte, pointer *Record) error {
 	// Set the last pointer of the new leaf node to point the last pointer of the leaf node.
 	if leaf.pointers[order-1] != nil {
 		newLeaf.pointers[order-1] = leaf.pointers[order-1]
+		if next, ok := leaf.pointers[order-1].(*Node); ok {
+			next.prev = newLeaf
+		}
 	}
 
+	// Link the new leaf node after the leaf node for reverse scans.
+	newLeaf.prev = leaf
+
 	// Reset the last pointer of the leaf node.
 	leaf.pointers[order-1] = newLeaf
 	// Set the parent.
@@ -930,10 +1169,10 @@ func (t *BPTree) splitParent(node *Node, leftIndex int, key []byte, right *Node)
 }
 
 // insertIntoLeaf inserts the given node at the given key and pointer.
-func insertIntoLeaf(leaf *Node, key []byte, pointer *Record) {
+func (t *BPTree) insertIntoLeaf(leaf *Node, key []byte, pointer *Record) {
 	i := 0
 	for i < leaf.KeysNum {
-		if compare(key, leaf.Keys[i]) > 0 {
+		if t.compare(key, leaf.Keys[i]) > 0 {
 			i++
 		} else {
 			break
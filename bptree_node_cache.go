@@ -0,0 +1,182 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"container/list"
+	"sync"
+)
+
+// bptNodeID identifies a node of the b+ tree on disk of a data file.
+type bptNodeID struct {
+	fID     int64
+	address int64
+}
+
+// cachedBPTNode records a node read from the b+ tree on disk of a data file.
+type cachedBPTNode struct {
+	id   bptNodeID
+	node *BinaryNode
+	keys [][]byte      // the bucket and key of the entries at the Keys of an interior node, nil until resolved
+	elem *list.Element // the element of a leaf node in the lru
+}
+
+// bptNodeCache caches the nodes of the b+ trees on disk in HintBPTSparseIdxMode, so that the
+// lookups do not read the same nodes, nor the entries their keys point to, again and again.
+// The interior nodes, a small part of the nodes, are kept with their keys once read, and the
+// least recently used leaf nodes are dropped when more than maxLeaves are cached.
+// The b+ tree of a data file is written once when the data file is full, so the nodes never change.
+type bptNodeCache struct {
+	mu        sync.Mutex
+	maxLeaves int
+	items     map[bptNodeID]*cachedBPTNode
+	lru       *list.List // front is the most recently used leaf node
+}
+
+// newBPTNodeCache returns a newly initialized bptNodeCache object.
+func newBPTNodeCache(maxLeaves int) *bptNodeCache {
+	return &bptNodeCache{
+		maxLeaves: maxLeaves,
+		items:     make(map[bptNodeID]*cachedBPTNode),
+		lru:       list.New(),
+	}
+}
+
+// get returns the node at given id, or nil if it is not cached.
+func (c *bptNodeCache) get(id bptNodeID) *cachedBPTNode {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	item, ok := c.items[id]
+	if !ok {
+		return nil
+	}
+
+	if item.elem != nil {
+		c.lru.MoveToFront(item.elem)
+	}
+
+	return item
+}
+
+// add caches the node at given id.
+func (c *bptNodeCache) add(id bptNodeID, node *BinaryNode) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.items[id]; ok {
+		return
+	}
+
+	item := &cachedBPTNode{id: id, node: node}
+	c.items[id] = item
+
+	if node.IsLeaf == 1 {
+		item.elem = c.lru.PushFront(item)
+
+		for c.lru.Len() > c.maxLeaves {
+			oldest := c.lru.Remove(c.lru.Back()).(*cachedBPTNode)
+			delete(c.items, oldest.id)
+		}
+	}
+}
+
+// nodeKeys returns the resolved keys of the interior node at given id, or nil if they are not cached.
+func (c *bptNodeCache) nodeKeys(id bptNodeID) [][]byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if item, ok := c.items[id]; ok {
+		return item.keys
+	}
+
+	return nil
+}
+
+// setNodeKeys caches the resolved keys of the interior node at given id.
+func (c *bptNodeCache) setNodeKeys(id bptNodeID, keys [][]byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if item, ok := c.items[id]; ok {
+		item.keys = keys
+	}
+}
+
+// readBPTNode reads the node of the b+ tree on disk of the data file at given fID and address,
+// through the index cache if it is enabled.
+func (db *DB) readBPTNode(fID, address int64) (*BinaryNode, error) {
+	if db.bptNodeCache == nil {
+		return ReadNode(db.getBPTPath(fID), address)
+	}
+
+	id := bptNodeID{fID: fID, address: address}
+	if item := db.bptNodeCache.get(id); item != nil {
+		return item.node, nil
+	}
+
+	node, err := ReadNode(db.getBPTPath(fID), address)
+	if err != nil {
+		return nil, err
+	}
+
+	db.bptNodeCache.add(id, node)
+
+	return node, nil
+}
+
+// bptChildIndex returns the index of the pointer to follow in the interior node of the b+ tree
+// on disk of the data file at given fID and address to find newKey, the bucket and the key.
+func (db *DB) bptChildIndex(fID, address int64, node *BinaryNode, newKey []byte) (uint16, error) {
+	var i uint16
+
+	if db.bptNodeCache == nil {
+		for i < node.KeysNum {
+			item, err := db.readEntryAt(fID, uint64(node.Keys[i]))
+			if err != nil {
+				return 0, err
+			}
+
+			if compare(newKey, getNewKey(string(item.Meta.bucket), item.Key)) < 0 {
+				break
+			}
+			i++
+		}
+
+		return i, nil
+	}
+
+	id := bptNodeID{fID: fID, address: address}
+	keys := db.bptNodeCache.nodeKeys(id)
+	if keys == nil {
+		keys = make([][]byte, node.KeysNum)
+		for j := range keys {
+			item, err := db.readEntryAt(fID, uint64(node.Keys[j]))
+			if err != nil {
+				return 0, err
+			}
+
+			keys[j] = getNewKey(string(item.Meta.bucket), item.Key)
+		}
+
+		db.bptNodeCache.setNodeKeys(id, keys)
+	}
+
+	for i < node.KeysNum && compare(newKey, keys[i]) >= 0 {
+		i++
+	}
+
+	return i, nil
+}
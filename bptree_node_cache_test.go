@@ -0,0 +1,127 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestBPTNodeCache(t *testing.T) {
+	cache := newBPTNodeCache(2)
+
+	interior := &BinaryNode{IsLeaf: 0}
+	cache.add(bptNodeID{fID: 0, address: 0}, interior)
+	for address := int64(1); address <= 3; address++ {
+		cache.add(bptNodeID{fID: 0, address: address}, &BinaryNode{IsLeaf: 1})
+	}
+
+	// the least recently used leaf node is dropped, the interior node is kept.
+	if cache.get(bptNodeID{fID: 0, address: 1}) != nil {
+		t.Error("err bptNodeCache, the oldest leaf node should be dropped")
+	}
+	if cache.get(bptNodeID{fID: 0, address: 3}) == nil || cache.get(bptNodeID{fID: 0, address: 2}) == nil {
+		t.Error("err bptNodeCache, the newest leaf nodes should be cached")
+	}
+
+	cache.add(bptNodeID{fID: 1, address: 1}, &BinaryNode{IsLeaf: 1})
+	if cache.get(bptNodeID{fID: 0, address: 3}) != nil || cache.get(bptNodeID{fID: 0, address: 2}) == nil {
+		t.Error("err bptNodeCache, the least recently used leaf node should be dropped")
+	}
+
+	keys := [][]byte{[]byte("bucketkey")}
+	cache.setNodeKeys(bptNodeID{fID: 0, address: 0}, keys)
+	if item := cache.get(bptNodeID{fID: 0, address: 0}); item == nil || item.node != interior || len(cache.nodeKeys(item.id)) != 1 {
+		t.Error("err bptNodeCache, the interior node should be kept with its keys")
+	}
+}
+
+func TestDB_IndexCacheSize(t *testing.T) {
+	bucket := "bucket_for_index_cache"
+
+	read := func(cacheSize int) (values []string) {
+		opt.IndexCacheSize = cacheSize
+		db, err = Open(opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		// the second pass is served by the cache.
+		for pass := 0; pass < 2; pass++ {
+			if err := db.View(func(tx *Tx) error {
+				for i := 0; i < 300; i += 7 {
+					e, err := tx.Get(bucket, []byte(fmt.Sprintf("key_%03d", i)))
+					if err != nil {
+						return err
+					}
+					values = append(values, string(e.Value))
+				}
+
+				es, err := tx.RangeScan(bucket, []byte("key_010"), []byte("key_020"))
+				if err != nil {
+					return err
+				}
+				values = append(values, fmt.Sprint(len(es)))
+
+				es, _, err = tx.PrefixScan(bucket, []byte("key_1"), 0, ScanNoLimit)
+				if err != nil {
+					return err
+				}
+				values = append(values, fmt.Sprint(len(es)))
+
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if cacheSize > 0 {
+			if db.bptNodeCache == nil || db.bptNodeCache.lru.Len() == 0 || db.bptNodeCache.lru.Len() > cacheSize {
+				t.Errorf("err IndexCacheSize, the cached leaf nodes should be at most %d", cacheSize)
+			}
+		} else if db.bptNodeCache != nil {
+			t.Error("err IndexCacheSize, the cache should be disabled")
+		}
+
+		return
+	}
+
+	InitOpt("/tmp/nutsdbtestforindexcache", true)
+	opt.EntryIdxMode = HintBPTSparseIdxMode
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the keys are written to several data files.
+	for i := 0; i < 300; i++ {
+		if err := db.Update(func(tx *Tx) error {
+			return tx.Put(bucket, []byte(fmt.Sprintf("key_%03d", i)), []byte(fmt.Sprintf("val_%03d", i)), Persistent)
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := read(0)
+	for _, cacheSize := range []int{4, 1024} {
+		if got := read(cacheSize); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("err IndexCacheSize %d, got %v want %v", cacheSize, got, want)
+		}
+	}
+}
@@ -273,6 +273,90 @@ func TestBPTree_Range(t *testing.T) {
 	}
 }
 
+func TestBPTree_RangeReverse(t *testing.T) {
+	tree = NewTree()
+	_, err := tree.RangeReverse([]byte("key_001"), []byte("key_010"))
+	if err == nil {
+		t.Fatal("err reverse range scan")
+	}
+
+	setup(t, 100)
+
+	rs, err := tree.RangeReverse([]byte("key_010"), []byte("key_089"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rs) != 80 {
+		t.Fatalf("err reverse range scan. got %d records want %d", len(rs), 80)
+	}
+
+	for i, r := range rs {
+		if string(expected[89-i].E.Key) != string(r.E.Key) {
+			t.Errorf("err reverse range scan. got %s want %s", string(r.E.Key), string(expected[89-i].E.Key))
+		}
+	}
+
+	_, err = tree.RangeReverse([]byte("key_101"), []byte("key_110"))
+	if err == nil {
+		t.Error("err reverse range scan")
+	}
+
+	_, err = tree.RangeReverse([]byte("key_101"), []byte("key_100"))
+	if err == nil {
+		t.Error("err reverse range scan")
+	}
+}
+
+func TestBPTree_PrefixScanReverse(t *testing.T) {
+	tree = NewTree()
+	_, _, err := tree.PrefixScanReverse([]byte("key_"), 0, 10)
+	if err == nil {
+		t.Fatal("err reverse prefix scan")
+	}
+
+	setup(t, 100)
+
+	for i := 0; i < 10; i++ {
+		key := []byte("name_" + fmt.Sprintf("%03d", i))
+		err := tree.Insert(key, &Entry{Key: key}, &Hint{key: key, meta: &MetaData{
+			Flag: DataSetFlag,
+		}}, CountFlagEnabled)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rs, off, err := tree.PrefixScanReverse([]byte("key_"), 5, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if off != 5 || len(rs) != 10 {
+		t.Fatalf("err reverse prefix scan. got off %d and %d records", off, len(rs))
+	}
+
+	for i, r := range rs {
+		if string(expected[94-i].E.Key) != string(r.E.Key) {
+			t.Errorf("err reverse prefix scan. got %s want %s", string(r.E.Key), string(expected[94-i].E.Key))
+		}
+	}
+
+	rs, _, err = tree.PrefixScanReverse([]byte("name_"), 0, ScanNoLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rs) != 10 || string(rs[0].E.Key) != "name_009" || string(rs[9].E.Key) != "name_000" {
+		t.Error("err reverse prefix scan")
+	}
+
+	_, _, err = tree.PrefixScanReverse([]byte("key_xx"), 0, 10)
+	if err == nil {
+		t.Error("err reverse prefix scan")
+	}
+}
+
 func TestBPTree_FindLeaf(t *testing.T) {
 	limit := 10
 	setup(t, limit)
@@ -0,0 +1,441 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/xujiajun/nutsdb/ds/bitmap"
+)
+
+// BucketStats records the statistics of a bucket.
+type BucketStats struct {
+	// KeyCount represents the number of live keys in the bucket,
+	// the keys of the sets, lists and bitmaps and the members of the sorted set are counted.
+	KeyCount int
+
+	// ExpiredCount represents the number of the expired keys which are not deleted yet.
+	// It is not counted in HintBPTSparseIdxMode.
+	ExpiredCount int
+
+	// DiskBytes represents the approximate disk bytes of the live and expired entries.
+	DiskBytes int64
+}
+
+// DeleteBucket removes all the keys in the bucket at given bucket, including the
+// keys of the sets, the sorted set, the lists and the bitmaps stored in it.
+func (tx *Tx) DeleteBucket(bucket string) error {
+	if err := tx.checkTxIsClosed(); err != nil {
+		return err
+	}
+
+	if !tx.writable {
+		return ErrTxNotWritable
+	}
+
+	stats, err := tx.bucketStats(bucket)
+	if err != nil {
+		return err
+	}
+
+	if stats.KeyCount == 0 && stats.ExpiredCount == 0 {
+		return ErrBucketNotFound
+	}
+
+	if err := tx.deleteBPTreeBucket(bucket); err != nil {
+		return err
+	}
+
+	if s, ok := tx.db.SetIdx[bucket]; ok {
+		for key, members := range s.M {
+			for member := range members {
+				if err := tx.SRem(bucket, []byte(key), []byte(member)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if ss, ok := tx.db.SortedSetIdx[bucket]; ok {
+		for key := range ss.Dict {
+			if err := tx.ZRem(bucket, key); err != nil {
+				return err
+			}
+		}
+	}
+
+	if l, ok := tx.db.ListIdx[bucket]; ok {
+		for key, items := range l.Items {
+			for _, item := range items {
+				if err := tx.push(bucket, []byte(key), DataLPopFlag, item); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if bs, ok := tx.db.BitmapIdx[bucket]; ok {
+		for key := range bs.M {
+			if err := tx.storeBitmap(bucket, []byte(key), bitmap.New()); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// deleteBPTreeBucket removes all the keys of the b+ tree in the bucket at given bucket.
+func (tx *Tx) deleteBPTreeBucket(bucket string) error {
+	if tx.db.opt.EntryIdxMode == HintBPTSparseIdxMode {
+		if _, ok := tx.db.bucketMetas[bucket]; !ok {
+			return nil
+		}
+
+		entries, err := tx.getAllByHintBPTSparseIdx(bucket)
+		if err != nil && err != ErrRangeScan {
+			return err
+		}
+
+		for _, e := range entries {
+			if err := tx.Delete(bucket, e.Key); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	idx, ok := tx.db.BPTreeIdx[bucket]
+	if !ok {
+		return nil
+	}
+
+	records, err := idx.All()
+	if err != nil {
+		return nil
+	}
+
+	for _, r := range records {
+		if r.H.meta.Flag == DataDeleteFlag {
+			continue
+		}
+
+		// the key is deleted by the tx already.
+		if e, ok := tx.pendingGet(bucket, r.H.key); ok && e == nil {
+			continue
+		}
+
+		if err := tx.Delete(bucket, r.H.key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// bucketStats returns the statistics of the bucket at given bucket.
+func (tx *Tx) bucketStats(bucket string) (*BucketStats, error) {
+	stats := &BucketStats{}
+
+	if tx.db.opt.EntryIdxMode == HintBPTSparseIdxMode {
+		if _, ok := tx.db.bucketMetas[bucket]; ok {
+			entries, err := tx.getAllByHintBPTSparseIdx(bucket)
+			if err != nil && err != ErrRangeScan {
+				return nil, err
+			}
+
+			for _, e := range entries {
+				stats.KeyCount++
+				stats.DiskBytes += e.Size()
+			}
+		}
+	} else if idx, ok := tx.db.BPTreeIdx[bucket]; ok {
+		if records, err := idx.All(); err == nil {
+			for _, r := range records {
+				if r.H.meta.Flag == DataDeleteFlag {
+					continue
+				}
+
+				if r.IsExpired() {
+					stats.ExpiredCount++
+				} else {
+					stats.KeyCount++
+				}
+				stats.DiskBytes += int64(DataEntryHeaderSize + r.H.meta.bucketSize + r.H.meta.keySize + r.H.meta.valueSize)
+			}
+		}
+	}
+
+	if s, ok := tx.db.SetIdx[bucket]; ok {
+		for key, members := range s.M {
+			if len(members) > 0 {
+				stats.KeyCount++
+			}
+			for member := range members {
+				stats.DiskBytes += approximateEntrySize(bucket, key, member)
+			}
+		}
+	}
+
+	if ss, ok := tx.db.SortedSetIdx[bucket]; ok {
+		for key, node := range ss.Dict {
+			stats.KeyCount++
+			stats.DiskBytes += approximateEntrySize(bucket, key, string(node.Value))
+		}
+	}
+
+	if l, ok := tx.db.ListIdx[bucket]; ok {
+		for key, items := range l.Items {
+			if len(items) > 0 {
+				stats.KeyCount++
+			}
+			for _, item := range items {
+				stats.DiskBytes += approximateEntrySize(bucket, key, string(item))
+			}
+		}
+	}
+
+	if bs, ok := tx.db.BitmapIdx[bucket]; ok {
+		for key, b := range bs.M {
+			stats.KeyCount++
+			data, _ := b.MarshalBinary()
+			stats.DiskBytes += approximateEntrySize(bucket, key, string(data))
+		}
+	}
+
+	return stats, nil
+}
+
+// approximateEntrySize returns the approximate disk bytes of an entry at given bucket, key and value.
+func approximateEntrySize(bucket, key, value string) int64 {
+	return int64(DataEntryHeaderSize + len(bucket) + len(key) + len(value))
+}
+
+// bucketNames returns the names of the buckets in the indexes, including the ones without live keys.
+func (tx *Tx) bucketNames() map[string]struct{} {
+	names := make(map[string]struct{})
+	for bucket := range tx.db.BPTreeIdx {
+		names[bucket] = struct{}{}
+	}
+	for bucket := range tx.db.bucketMetas {
+		names[bucket] = struct{}{}
+	}
+	for bucket := range tx.db.SetIdx {
+		names[bucket] = struct{}{}
+	}
+	for bucket := range tx.db.SortedSetIdx {
+		names[bucket] = struct{}{}
+	}
+	for bucket := range tx.db.ListIdx {
+		names[bucket] = struct{}{}
+	}
+	for bucket := range tx.db.BitmapIdx {
+		names[bucket] = struct{}{}
+	}
+
+	return names
+}
+
+// Buckets returns the sorted names of the buckets which have at least one live key.
+func (db *DB) Buckets() (buckets []string, err error) {
+	err = db.View(func(tx *Tx) error {
+		for bucket := range tx.bucketNames() {
+			stats, err := tx.bucketStats(bucket)
+			if err != nil {
+				return err
+			}
+
+			if stats.KeyCount > 0 {
+				buckets = append(buckets, bucket)
+			}
+		}
+
+		return nil
+	})
+
+	sort.Strings(buckets)
+
+	return
+}
+
+// BucketStats returns the statistics of the bucket at given bucket.
+func (db *DB) BucketStats(bucket string) (stats *BucketStats, err error) {
+	err = db.View(func(tx *Tx) error {
+		if stats, err = tx.bucketStats(bucket); err != nil {
+			return err
+		}
+
+		if stats.KeyCount == 0 && stats.ExpiredCount == 0 {
+			return ErrBucketNotFound
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return
+}
+
+// BucketSeparator separates the names of the parent and the child buckets in the name of a nested bucket,
+// so that the buckets named "a", "a:b" and "a:b:c" form a tree. The nested buckets are plain buckets,
+// the tree is only used by Bucket, DeleteBucketTree, SubBuckets and BucketTreeStats.
+const BucketSeparator = ":"
+
+// Bucket represents a bucket within a transaction, that opens its nested buckets.
+type Bucket struct {
+	tx   *Tx
+	name string
+}
+
+// Bucket returns the bucket at given name, which may not exist yet.
+func (tx *Tx) Bucket(name string) *Bucket {
+	return &Bucket{tx: tx, name: name}
+}
+
+// Bucket returns the nested bucket at given name under the bucket.
+func (b *Bucket) Bucket(name string) *Bucket {
+	return &Bucket{tx: b.tx, name: b.name + BucketSeparator + name}
+}
+
+// Name returns the full name of the bucket, with the names of its parents.
+func (b *Bucket) Name() string {
+	return b.name
+}
+
+// Put sets the value for a key in the bucket.
+func (b *Bucket) Put(key, value []byte, ttl uint32) error {
+	return b.tx.Put(b.name, key, value, ttl)
+}
+
+// Get retrieves the value for a key in the bucket.
+func (b *Bucket) Get(key []byte) (*Entry, error) {
+	return b.tx.Get(b.name, key)
+}
+
+// Delete removes a key from the bucket.
+func (b *Bucket) Delete(key []byte) error {
+	return b.tx.Delete(b.name, key)
+}
+
+// bucketTree returns the sorted names of the bucket at given bucket and of its nested buckets,
+// or of all the buckets if bucket is empty.
+func (tx *Tx) bucketTree(bucket string) []string {
+	var names []string
+	for name := range tx.bucketNames() {
+		if bucket == "" || name == bucket || strings.HasPrefix(name, bucket+BucketSeparator) {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// DeleteBucketTree removes all the keys in the bucket at given bucket and in its nested buckets,
+// like DeleteBucket. It returns ErrBucketNotFound if none of them has a key.
+func (tx *Tx) DeleteBucketTree(bucket string) error {
+	deleted := false
+
+	for _, name := range tx.bucketTree(bucket) {
+		if err := tx.DeleteBucket(name); err != nil {
+			if err == ErrBucketNotFound {
+				continue
+			}
+			return err
+		}
+		deleted = true
+	}
+
+	if !deleted {
+		return ErrBucketNotFound
+	}
+
+	return nil
+}
+
+// SubBuckets returns the sorted names of the children of the bucket at given bucket, without the
+// name of the bucket, which have a live key in them or in their nested buckets.
+// It returns the top level buckets if bucket is empty.
+func (db *DB) SubBuckets(bucket string) (children []string, err error) {
+	prefix := ""
+	if bucket != "" {
+		prefix = bucket + BucketSeparator
+	}
+
+	err = db.View(func(tx *Tx) error {
+		seen := make(map[string]bool)
+
+		for _, name := range tx.bucketTree(bucket) {
+			if !strings.HasPrefix(name, prefix) {
+				continue
+			}
+
+			child := strings.SplitN(strings.TrimPrefix(name, prefix), BucketSeparator, 2)[0]
+			if seen[child] {
+				continue
+			}
+
+			stats, err := tx.bucketStats(name)
+			if err != nil {
+				return err
+			}
+
+			if stats.KeyCount > 0 {
+				seen[child] = true
+				children = append(children, child)
+			}
+		}
+
+		return nil
+	})
+
+	return
+}
+
+// BucketTreeStats returns the statistics of the bucket at given bucket and of its nested buckets added up.
+func (db *DB) BucketTreeStats(bucket string) (stats *BucketStats, err error) {
+	stats = &BucketStats{}
+
+	err = db.View(func(tx *Tx) error {
+		for _, name := range tx.bucketTree(bucket) {
+			s, err := tx.bucketStats(name)
+			if err != nil {
+				return err
+			}
+
+			stats.KeyCount += s.KeyCount
+			stats.ExpiredCount += s.ExpiredCount
+			stats.DiskBytes += s.DiskBytes
+		}
+
+		if stats.KeyCount == 0 && stats.ExpiredCount == 0 {
+			return ErrBucketNotFound
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return
+}
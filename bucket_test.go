@@ -0,0 +1,225 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDB_BucketManagement(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestforbucket", true)
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Update(func(tx *Tx) error {
+		if err := tx.Put("bucket_kv", []byte("key_1"), []byte("val_1"), Persistent); err != nil {
+			return err
+		}
+		if err := tx.Put("bucket_kv", []byte("key_2"), []byte("val_2"), Persistent); err != nil {
+			return err
+		}
+		if err := tx.Put("bucket_mixed", []byte("key_1"), []byte("val_1"), Persistent); err != nil {
+			return err
+		}
+		if err := tx.SAdd("bucket_mixed", []byte("set"), []byte("a"), []byte("b")); err != nil {
+			return err
+		}
+		if err := tx.ZAdd("bucket_mixed", []byte("member"), 1, []byte("val")); err != nil {
+			return err
+		}
+		return tx.RPush("bucket_mixed", []byte("list"), []byte("a"), []byte("b"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	buckets, err := db.Buckets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(buckets, []string{"bucket_kv", "bucket_mixed"}) {
+		t.Errorf("err Buckets, got %v", buckets)
+	}
+
+	stats, err := db.BucketStats("bucket_mixed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.KeyCount != 4 || stats.ExpiredCount != 0 || stats.DiskBytes <= 0 {
+		t.Errorf("err BucketStats, got %+v", stats)
+	}
+
+	if err := db.View(func(tx *Tx) error {
+		return tx.DeleteBucket("bucket_mixed")
+	}); err != ErrTxNotWritable {
+		t.Errorf("err DeleteBucket, got %v want %v", err, ErrTxNotWritable)
+	}
+
+	if err := db.Update(func(tx *Tx) error {
+		return tx.DeleteBucket("bucket_mixed")
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Update(func(tx *Tx) error {
+		return tx.DeleteBucket("bucket_mixed")
+	}); err != ErrBucketNotFound {
+		t.Errorf("err DeleteBucket, got %v want %v", err, ErrBucketNotFound)
+	}
+
+	checkDeleted := func() {
+		buckets, err := db.Buckets()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(buckets, []string{"bucket_kv"}) {
+			t.Errorf("err Buckets, got %v", buckets)
+		}
+
+		if _, err := db.BucketStats("bucket_mixed"); err != ErrBucketNotFound {
+			t.Errorf("err BucketStats, got %v want %v", err, ErrBucketNotFound)
+		}
+
+		stats, err := db.BucketStats("bucket_kv")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.KeyCount != 2 {
+			t.Errorf("err BucketStats, got %+v", stats)
+		}
+	}
+
+	checkDeleted()
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	checkDeleted()
+}
+
+func TestDB_NestedBuckets(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestforbucket", true)
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Update(func(tx *Tx) error {
+		users := tx.Bucket("app").Bucket("users")
+		if users.Name() != "app:users" {
+			t.Errorf("err Bucket, got name %s want app:users", users.Name())
+		}
+		if err := users.Put([]byte("user_1"), []byte("val"), Persistent); err != nil {
+			return err
+		}
+		if err := users.Bucket("archived").Put([]byte("user_0"), []byte("val"), Persistent); err != nil {
+			return err
+		}
+		if err := tx.Bucket("app").Bucket("orders").Put([]byte("order_1"), []byte("val"), Persistent); err != nil {
+			return err
+		}
+		if err := tx.SAdd("app:tags", []byte("key"), []byte("a"), []byte("b")); err != nil {
+			return err
+		}
+		// the bucket with the name as prefix is not nested.
+		return tx.Put("apple", []byte("key"), []byte("val"), Persistent)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.View(func(tx *Tx) error {
+		e, err := tx.Get("app:users", []byte("user_1"))
+		if err != nil {
+			return err
+		}
+		if string(e.Value) != "val" {
+			t.Errorf("err Bucket Put, got %s want val", e.Value)
+		}
+		_, err = tx.Bucket("app").Bucket("users").Get([]byte("user_1"))
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		bucket string
+		want   []string
+	}{
+		{"", []string{"app", "apple"}},
+		{"app", []string{"orders", "tags", "users"}},
+		{"app:users", []string{"archived"}},
+		{"app:orders", nil},
+	}
+	for _, tt := range tests {
+		children, err := db.SubBuckets(tt.bucket)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(children, tt.want) {
+			t.Errorf("err SubBuckets %q, got %v want %v", tt.bucket, children, tt.want)
+		}
+	}
+
+	stats, err := db.BucketTreeStats("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.KeyCount != 4 {
+		t.Errorf("err BucketTreeStats, got %+v want 4 keys", stats)
+	}
+
+	if err := db.Update(func(tx *Tx) error {
+		return tx.DeleteBucketTree("app:users")
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if children, _ := db.SubBuckets("app"); !reflect.DeepEqual(children, []string{"orders", "tags"}) {
+		t.Errorf("err DeleteBucketTree, got children %v want [orders tags]", children)
+	}
+
+	if err := db.Update(func(tx *Tx) error {
+		return tx.DeleteBucketTree("app")
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.BucketTreeStats("app"); err != ErrBucketNotFound {
+		t.Errorf("err BucketTreeStats, got %v want %v", err, ErrBucketNotFound)
+	}
+	if err := db.Update(func(tx *Tx) error {
+		return tx.DeleteBucketTree("app")
+	}); err != ErrBucketNotFound {
+		t.Errorf("err DeleteBucketTree, got %v want %v", err, ErrBucketNotFound)
+	}
+
+	buckets, err := db.Buckets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(buckets, []string{"apple"}) {
+		t.Errorf("err DeleteBucketTree, got buckets %v want [apple]", buckets)
+	}
+}
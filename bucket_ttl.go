@@ -0,0 +1,171 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// BucketTTLBucket is the bucket recording the TTLs of the buckets set by SetBucketTTL,
+// the keys are the names of the buckets.
+const BucketTTLBucket = "_nutsdb_bucket_ttl"
+
+// ErrBucketTTLReserved is returned when setting the TTL of BucketTTLBucket itself.
+var ErrBucketTTLReserved = errors.New("the TTL of the bucket of the bucket TTLs can not be set")
+
+// SetBucketTTL sets the default TTL in seconds of the keys of the bucket at given bucket: the keys
+// put with Persistent by Put, PutWithTimestamp and PutBatch get it, a key put with its own TTL keeps it.
+// Persistent removes the TTL of the bucket, the keys already written keep theirs.
+// When the TTL elapses after the last write to the bucket, the expiration worker drops the whole
+// bucket, the sets, the sorted set, the lists and the bitmaps stored in it included.
+func (tx *Tx) SetBucketTTL(bucket string, ttl uint32) error {
+	if err := tx.checkTxIsWritable(); err != nil {
+		return err
+	}
+
+	if bucket == BucketTTLBucket {
+		return ErrBucketTTLReserved
+	}
+
+	current, err := tx.BucketTTL(bucket)
+	if err != nil {
+		return err
+	}
+
+	if ttl == Persistent {
+		if current == Persistent {
+			return nil
+		}
+		return tx.put(BucketTTLBucket, []byte(bucket), nil, Persistent, DataDeleteFlag, uint64(time.Now().Unix()), DataStructureBPTree)
+	}
+
+	value := make([]byte, 4)
+	binary.BigEndian.PutUint32(value, ttl)
+
+	return tx.put(BucketTTLBucket, []byte(bucket), value, Persistent, DataSetFlag, uint64(time.Now().Unix()), DataStructureBPTree)
+}
+
+// BucketTTL returns the TTL in seconds of the bucket at given bucket set by SetBucketTTL,
+// Persistent if it has none.
+func (tx *Tx) BucketTTL(bucket string) (uint32, error) {
+	if err := tx.checkTxIsClosed(); err != nil {
+		return Persistent, err
+	}
+
+	return tx.bucketTTL(bucket), nil
+}
+
+// bucketTTL returns the TTL of the bucket, with the pending SetBucketTTL of the tx applied.
+func (tx *Tx) bucketTTL(bucket string) uint32 {
+	if e, ok := tx.pendingGet(BucketTTLBucket, []byte(bucket)); ok {
+		if e == nil {
+			return Persistent
+		}
+		return decodeBucketTTL(e.Value)
+	}
+
+	if ttl, ok := tx.db.bucketTTLs[bucket]; ok {
+		return ttl
+	}
+
+	return Persistent
+}
+
+// keyTTL returns the TTL of a key put with given ttl in the bucket, the TTL of the bucket
+// if ttl is Persistent.
+func (tx *Tx) keyTTL(bucket string, ttl uint32) uint32 {
+	if ttl != Persistent || tx.db == nil || len(tx.db.bucketTTLs) == 0 && len(tx.pendingKeys[BucketTTLBucket]) == 0 {
+		return ttl
+	}
+
+	return tx.bucketTTL(bucket)
+}
+
+func decodeBucketTTL(value []byte) uint32 {
+	if len(value) != 4 {
+		return Persistent
+	}
+
+	return binary.BigEndian.Uint32(value)
+}
+
+// loadBucketTTLs loads the TTLs of the buckets from BucketTTLBucket when opening the db.
+// The last writes to the buckets are not recorded, they are counted from now.
+func (db *DB) loadBucketTTLs() error {
+	if _, ok := db.bucketMetas[BucketTTLBucket]; db.opt.EntryIdxMode == HintBPTSparseIdxMode && !ok {
+		return nil
+	}
+
+	// the db is not used by others yet, the tx is neither locked nor counted in the stats.
+	tx := &Tx{db: db, ctx: context.Background()}
+
+	entries, err := tx.GetAll(BucketTTLBucket)
+	if err != nil && !isScanNotFound(err) {
+		return err
+	}
+
+	now := uint64(time.Now().Unix())
+	for _, e := range entries {
+		bucket := string(e.Key)
+		db.bucketTTLs[bucket] = decodeBucketTTL(e.Value)
+		db.bucketWrites[bucket] = now
+	}
+
+	return nil
+}
+
+// indexBucketTTL records the committed entry: a change of the TTL of a bucket, or a write
+// to a bucket with a TTL. The deletes of the expiration worker are not writes.
+func (tx *Tx) indexBucketTTL(bucket string, entry *Entry, now uint64) {
+	if bucket == BucketTTLBucket {
+		if entry.Meta.Flag == DataDeleteFlag {
+			delete(tx.db.bucketTTLs, string(entry.Key))
+			delete(tx.db.bucketWrites, string(entry.Key))
+			return
+		}
+
+		tx.db.bucketTTLs[string(entry.Key)] = decodeBucketTTL(entry.Value)
+		tx.db.bucketWrites[string(entry.Key)] = now
+		return
+	}
+
+	if _, ok := tx.db.bucketTTLs[bucket]; ok && !tx.isExpiring {
+		tx.db.bucketWrites[bucket] = now
+	}
+}
+
+// dropExpiredBuckets deletes the buckets whose TTL elapsed after their last write. A dropped
+// bucket is dropped again only after it is written again.
+func (tx *Tx) dropExpiredBuckets() error {
+	now := uint64(time.Now().Unix())
+
+	for bucket, last := range tx.db.bucketWrites {
+		if last+uint64(tx.db.bucketTTLs[bucket]) > now {
+			continue
+		}
+
+		if err := tx.DeleteBucket(bucket); err != nil && !errors.Is(err, ErrBucketNotFound) {
+			return err
+		}
+
+		delete(tx.db.bucketWrites, bucket)
+		tx.db.logger().Info("dropped the expired bucket", "bucket", bucket)
+	}
+
+	return nil
+}
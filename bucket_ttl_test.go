@@ -0,0 +1,186 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"testing"
+	"time"
+)
+
+func checkBucketTTL(t *testing.T, bucket string, want uint32) {
+	t.Helper()
+
+	if err := db.View(func(tx *Tx) error {
+		ttl, err := tx.BucketTTL(bucket)
+		if err != nil {
+			return err
+		}
+		if ttl != want {
+			t.Errorf("err BucketTTL %s, got %d want %d", bucket, ttl, want)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func checkKeyTTL(t *testing.T, bucket, key string, want uint32) {
+	t.Helper()
+
+	if err := db.View(func(tx *Tx) error {
+		e, err := tx.Get(bucket, []byte(key))
+		if err != nil {
+			return err
+		}
+		if e.Meta.TTL != want {
+			t.Errorf("err TTL %s, got %d want %d", key, e.Meta.TTL, want)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTx_SetBucketTTL(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestbucketttl", true)
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bucket := "bucket_ttl"
+	if err := db.Update(func(tx *Tx) error {
+		if err := tx.SetBucketTTL(bucket, 100); err != nil {
+			return err
+		}
+		// the TTL applies within the tx setting it.
+		if err := tx.Put(bucket, []byte("key_1"), []byte("val"), Persistent); err != nil {
+			return err
+		}
+		if err := tx.Put(bucket, []byte("key_2"), []byte("val"), 10); err != nil {
+			return err
+		}
+		_, err := tx.Incr(bucket, []byte("counter"), 1)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	checkBucketTTL(t, bucket, 100)
+	checkBucketTTL(t, "bucket_other", Persistent)
+	checkKeyTTL(t, bucket, "key_1", 100)
+	checkKeyTTL(t, bucket, "key_2", 10)
+	checkKeyTTL(t, bucket, "counter", 100)
+
+	if err := db.Update(func(tx *Tx) error {
+		return tx.SetBucketTTL(BucketTTLBucket, 100)
+	}); err != ErrBucketTTLReserved {
+		t.Errorf("err SetBucketTTL, got %v want %v", err, ErrBucketTTLReserved)
+	}
+
+	// the TTL of the bucket is kept after reopening.
+	db.Close()
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	checkBucketTTL(t, bucket, 100)
+
+	if err := db.Update(func(tx *Tx) error {
+		if err := tx.SetBucketTTL(bucket, Persistent); err != nil {
+			return err
+		}
+		if err := tx.Put(bucket, []byte("key_3"), []byte("val"), Persistent); err != nil {
+			return err
+		}
+		_, err := tx.Incr(bucket, []byte("counter"), 1)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	checkBucketTTL(t, bucket, Persistent)
+	checkKeyTTL(t, bucket, "key_1", 100)
+	checkKeyTTL(t, bucket, "counter", 100)
+	checkKeyTTL(t, bucket, "key_3", Persistent)
+}
+
+func TestDB_DropExpiredBucket(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestbucketttl", true)
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	bucket := "bucket_ttl"
+	if err := db.Update(func(tx *Tx) error {
+		if err := tx.SetBucketTTL(bucket, 1); err != nil {
+			return err
+		}
+		if err := tx.Put(bucket, []byte("key"), []byte("val"), Persistent); err != nil {
+			return err
+		}
+		if err := tx.SAdd(bucket, []byte("set"), []byte("member")); err != nil {
+			return err
+		}
+		return tx.Put("bucket_other", []byte("key"), []byte("val"), Persistent)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.deleteExpired(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.View(func(tx *Tx) error {
+		n, err := tx.SCard(bucket, []byte("set"))
+		if err != nil {
+			return err
+		}
+		if n != 1 {
+			t.Errorf("err SCard before the TTL, got %d want %d", n, 1)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(2 * time.Second)
+
+	if err := db.deleteExpired(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.View(func(tx *Tx) error {
+		if n, _ := tx.SCard(bucket, []byte("set")); n != 0 {
+			t.Errorf("err SCard after the TTL, got %d want %d", n, 0)
+		}
+		if _, err := tx.Get(bucket, []byte("key")); err == nil {
+			t.Error("err Get after the TTL, the key is not expired")
+		}
+		if _, err := tx.Get("bucket_other", []byte("key")); err != nil {
+			t.Errorf("err Get of the other bucket, got %v", err)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the bucket keeps its TTL.
+	checkBucketTTL(t, bucket, 1)
+}
@@ -0,0 +1,137 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import "errors"
+
+// ErrSeqNotFound is returned when reading the changes from a sequence whose entries are not
+// in the data files anymore, e.g. when they are merged. The reader must be seeded again.
+var ErrSeqNotFound = errors.New("sequence not found in the data files")
+
+// errChangesLimit stops the stream of the changes when the limit is reached.
+var errChangesLimit = errors.New("changes limit reached")
+
+// Change represents an entry committed by a tx, read from the data files by ChangesSince.
+type Change struct {
+	// Seq represents the sequence number of the entry, the sequence numbers only increase
+	// in the order the entries are committed, across the restarts.
+	Seq uint64
+
+	// TxID represents the id of the tx which committed the entry.
+	TxID uint64
+
+	Bucket    string
+	Key       []byte
+	Value     []byte
+	Flag      uint16 // the operation, DataSetFlag, DataDeleteFlag, DataLPushFlag...
+	DS        uint16 // the data structure, DataStructureBPTree, DataStructureSet...
+	TTL       uint32
+	Timestamp uint64
+}
+
+// Seq returns the sequence number after the last committed entry, ChangesSince from it
+// returns the entries committed from now on.
+func (db *DB) Seq() (uint64, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return 0, ErrDBClosed
+	}
+
+	return db.posSeq(ReplicationPos{FileID: db.MaxFileID, Offset: db.ActiveFile.writeOff}), nil
+}
+
+// ChangesSince returns the entries committed from the sequence number since, with the sequence
+// number to read the next changes from. since must be 0, or returned by Seq or ChangesSince.
+// The entries of at least limitNum changes are returned if there are, the entries of a tx are
+// never split, all the committed entries are returned if limitNum is ScanNoLimit.
+// The sequence number of an entry is its position in the data files, so the entries rewritten
+// by a merge are not returned again, and the changes from a sequence number in a merged data file
+// return ErrSeqNotFound unless it is at the end of the entries of the data file, until the db
+// is closed.
+func (db *DB) ChangesSince(since uint64, limitNum int) (changes []*Change, next uint64, err error) {
+	// the stream stops at the end of the active file.
+	stop := make(chan struct{})
+	close(stop)
+
+	// the reader is at the end of a merged data file, the changes go on in the next one.
+	pos := db.seqPos(since)
+	db.mu.RLock()
+	if end, ok := db.mergedEnds[pos.FileID]; ok && pos.Offset >= end {
+		pos = ReplicationPos{FileID: pos.FileID + 1}
+	}
+	db.mu.RUnlock()
+
+	next = db.posSeq(pos)
+
+	err = db.streamTxs(pos, stop, func(entries []streamedEntry, pos ReplicationPos) error {
+		for _, se := range entries {
+			c, err := db.changeOf(se)
+			if err != nil {
+				return err
+			}
+			changes = append(changes, c)
+		}
+
+		next = db.posSeq(pos)
+
+		if limitNum >= 0 && len(changes) >= limitNum {
+			return errChangesLimit
+		}
+		return nil
+	})
+
+	switch err {
+	case nil, errChangesLimit:
+		return changes, next, nil
+	case ErrReplicationGap:
+		return nil, since, ErrSeqNotFound
+	default:
+		return nil, since, err
+	}
+}
+
+// changeOf returns the change of the streamed entry.
+func (db *DB) changeOf(se streamedEntry) (*Change, error) {
+	e := se.entry
+	if err := db.decodeEntry(e); err != nil {
+		return nil, err
+	}
+
+	return &Change{
+		Seq:       db.posSeq(se.pos),
+		TxID:      e.Meta.txID,
+		Bucket:    string(e.Meta.bucket),
+		Key:       e.Key,
+		Value:     e.Value,
+		Flag:      e.Meta.Flag,
+		DS:        e.Meta.ds,
+		TTL:       e.Meta.TTL,
+		Timestamp: e.Meta.timestamp,
+	}, nil
+}
+
+// posSeq returns the sequence number of the position in the data files, the data files
+// have the same size which is never changed.
+func (db *DB) posSeq(pos ReplicationPos) uint64 {
+	return uint64(pos.FileID)*uint64(db.opt.SegmentSize) + uint64(pos.Offset)
+}
+
+// seqPos returns the position in the data files of the sequence number.
+func (db *DB) seqPos(seq uint64) ReplicationPos {
+	size := uint64(db.opt.SegmentSize)
+	return ReplicationPos{FileID: int64(seq / size), Offset: int64(seq % size)}
+}
@@ -0,0 +1,125 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"testing"
+
+	"github.com/xujiajun/utils/strconv2"
+)
+
+func checkChanges(t *testing.T, changes []*Change, want ...string) {
+	t.Helper()
+
+	if len(changes) != len(want) {
+		t.Fatalf("err changes, got %d want %d", len(changes), len(want))
+	}
+
+	for i, c := range changes {
+		if got := c.Bucket + "/" + string(c.Key) + "=" + string(c.Value); got != want[i] {
+			t.Errorf("err change %d, got %s want %s", i, got, want[i])
+		}
+		if i > 0 && c.Seq <= changes[i-1].Seq {
+			t.Errorf("err change seq, got %d after %d", c.Seq, changes[i-1].Seq)
+		}
+	}
+}
+
+func TestDB_ChangesSince(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestchangefeed", true)
+	opt.SegmentSize = 256
+
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bucket := "bucket_changes"
+	for i := 0; i < 3; i++ {
+		if err := db.Update(func(tx *Tx) error {
+			key := []byte("key_" + strconv2.IntToStr(i))
+			if err := tx.Put(bucket, key, []byte("a"), Persistent); err != nil {
+				return err
+			}
+			return tx.Put(bucket, key, []byte("b"), Persistent)
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	changes, next, err := db.ChangesSince(0, ScanNoLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkChanges(t, changes,
+		"bucket_changes/key_0=a", "bucket_changes/key_0=b",
+		"bucket_changes/key_1=a", "bucket_changes/key_1=b",
+		"bucket_changes/key_2=a", "bucket_changes/key_2=b")
+
+	if seq, err := db.Seq(); err != nil || seq != next {
+		t.Errorf("err seq, got %d, %v want %d", seq, err, next)
+	}
+
+	// the entries of a tx are not split by the limit.
+	changes, limitNext, err := db.ChangesSince(0, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkChanges(t, changes,
+		"bucket_changes/key_0=a", "bucket_changes/key_0=b",
+		"bucket_changes/key_1=a", "bucket_changes/key_1=b")
+	if changes, _, err = db.ChangesSince(limitNext, ScanNoLimit); err != nil {
+		t.Fatal(err)
+	}
+	checkChanges(t, changes, "bucket_changes/key_2=a", "bucket_changes/key_2=b")
+
+	// the sequence numbers go on after reopening.
+	db.Close()
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Update(func(tx *Tx) error {
+		return tx.Delete(bucket, []byte("key_0"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, next, err = db.ChangesSince(next, ScanNoLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkChanges(t, changes, "bucket_changes/key_0=")
+	if changes[0].Flag != DataDeleteFlag {
+		t.Errorf("err change flag, got %d want %d", changes[0].Flag, DataDeleteFlag)
+	}
+
+	if changes, _, err = db.ChangesSince(next, ScanNoLimit); err != nil || len(changes) != 0 {
+		t.Errorf("err changes, got %d, %v", len(changes), err)
+	}
+
+	// the merged changes are not in the data files anymore.
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := db.ChangesSince(0, ScanNoLimit); err != ErrSeqNotFound {
+		t.Errorf("err changes after merge, got %v want %v", err, ErrSeqNotFound)
+	}
+	if changes, _, err = db.ChangesSince(next, ScanNoLimit); err != nil || len(changes) != 0 {
+		t.Errorf("err changes after merge, got %d, %v", len(changes), err)
+	}
+}
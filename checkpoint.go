@@ -0,0 +1,515 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"io/ioutil"
+	"math"
+	"os"
+	"time"
+
+	"github.com/xujiajun/nutsdb/ds/bitmap"
+	"github.com/xujiajun/nutsdb/ds/list"
+	"github.com/xujiajun/nutsdb/ds/set"
+	"github.com/xujiajun/nutsdb/ds/zset"
+)
+
+var (
+	// ErrCheckpointNotSupported is returned when checkpointing the index in HintBPTSparseIdxMode,
+	// which only parses the last data file when opening, or with the encryption, since the
+	// checkpoint is not encrypted.
+	ErrCheckpointNotSupported = errors.New("index checkpoint not supported with HintBPTSparseIdxMode or encryption")
+
+	// errCheckpoint is returned when the checkpoint can not be loaded, the index is rebuilt from the data files.
+	errCheckpoint = errors.New("invalid index checkpoint")
+)
+
+// CheckpointFile is the name of the file of the index checkpoint in the dir of the db.
+const CheckpointFile = "checkpoint.hint"
+
+// checkpointMagic starts the checkpoint file, the last byte is the version.
+var checkpointMagic = []byte("NUTSHINT\x01")
+
+// the kinds of the records of the checkpoint file.
+const (
+	checkpointEnd byte = iota
+	checkpointRecord
+	checkpointValidKeyCount
+	checkpointSetMember
+	checkpointZSetMember
+	checkpointListItem
+	checkpointBitmap
+	checkpointZSetDeadline
+)
+
+// checkpointWriter writes the checkpoint file and sums it up.
+type checkpointWriter struct {
+	w   *bufio.Writer
+	crc hash.Hash32
+	buf []byte
+	err error
+}
+
+func (cw *checkpointWriter) write(kind byte, fields ...[]byte) {
+	cw.buf = append(cw.buf[:0], kind)
+	for _, f := range fields {
+		cw.buf = appendDumpBytes(cw.buf, f)
+	}
+	cw.writeRaw(cw.buf)
+}
+
+func (cw *checkpointWriter) writeRaw(b []byte) {
+	if cw.err != nil {
+		return
+	}
+
+	cw.crc.Write(b)
+	_, cw.err = cw.w.Write(b)
+}
+
+func (cw *checkpointWriter) writeUvarint(v uint64) {
+	cw.writeRaw(appendUvarint(nil, v))
+}
+
+// Checkpoint writes the index of the db to the checkpoint file, so that the next Open loads
+// it and only parses the data written after it, instead of all the data files.
+// The commits are blocked while it is written. It is written every CheckpointInterval and
+// when the db is closed if the option is set. Merge removes the checkpoint, it is not
+// written while the merged data files are kept for the snapshot txs.
+func (db *DB) Checkpoint() error {
+	if db.opt.EntryIdxMode == HintBPTSparseIdxMode || db.opt.Encryption != nil {
+		return ErrCheckpointNotSupported
+	}
+
+	if db.readOnly {
+		return ErrDBReadOnly
+	}
+
+	db.checkpointMu.Lock()
+	defer db.checkpointMu.Unlock()
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return ErrDBClosed
+	}
+
+	return db.writeCheckpoint()
+}
+
+// writeCheckpoint writes the checkpoint file with the db locked. It is not written while the
+// merged data files are kept for the snapshot txs, the data files after the checkpoint are the
+// only ones parsed by Open and they may not hold the merged file records.
+func (db *DB) writeCheckpoint() error {
+	db.snapMu.Lock()
+	merged := len(db.mergedFiles)
+	db.snapMu.Unlock()
+	if merged > 0 {
+		return nil
+	}
+
+	// the checkpoint must not be ahead of the data files on the disk.
+	if err := db.ActiveFile.rwManager.Sync(); err != nil {
+		return err
+	}
+
+	tmpPath := db.getCheckpointPath() + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	cw := &checkpointWriter{w: bufio.NewWriter(f), crc: crc32.NewIEEE()}
+
+	cw.writeRaw(checkpointMagic)
+	cw.writeUvarint(uint64(db.opt.EntryIdxMode))
+	cw.writeUvarint(uint64(db.ActiveFile.fileID))
+	cw.writeUvarint(uint64(db.ActiveFile.writeOff))
+	cw.writeUvarint(uint64(db.KeyCount))
+
+	db.writeCheckpointRecords(cw)
+
+	cw.writeRaw([]byte{checkpointEnd})
+
+	var crc [4]byte
+	binary.LittleEndian.PutUint32(crc[:], cw.crc.Sum32())
+	if cw.err == nil {
+		_, cw.err = cw.w.Write(crc[:])
+	}
+	if cw.err == nil {
+		cw.err = cw.w.Flush()
+	}
+	if cw.err == nil {
+		cw.err = f.Sync()
+	}
+
+	if err := f.Close(); err != nil && cw.err == nil {
+		cw.err = err
+	}
+
+	if cw.err != nil {
+		_ = os.Remove(tmpPath)
+		return cw.err
+	}
+
+	return os.Rename(tmpPath, db.getCheckpointPath())
+}
+
+// writeCheckpointRecords writes the records of the B+ tree indexes and the contents of the sets,
+// sorted sets, lists and bitmaps.
+func (db *DB) writeCheckpointRecords(cw *checkpointWriter) {
+	var header [DataEntryHeaderSize]byte
+
+	for bucket, idx := range db.BPTreeIdx {
+		records, err := idx.All()
+		if err != nil {
+			continue
+		}
+
+		for _, r := range records {
+			(&Entry{Meta: r.H.meta}).setEntryHeaderBuf(header[:])
+
+			var value []byte
+			if r.E != nil {
+				value = r.E.Value
+			}
+
+			pos := appendUvarint(appendUvarint(nil, uint64(r.H.fileID)), r.H.dataPos)
+
+			cw.write(checkpointRecord, []byte(bucket), r.H.key, header[4:], pos, value)
+		}
+
+		cw.write(checkpointValidKeyCount, []byte(bucket), appendUvarint(nil, uint64(idx.ValidKeyCount)))
+	}
+
+	for bucket, s := range db.SetIdx {
+		for key, members := range s.M {
+			for member := range members {
+				cw.write(checkpointSetMember, []byte(bucket), []byte(key), []byte(member))
+			}
+		}
+	}
+
+	for bucket, ss := range db.SortedSetIdx {
+		for key, node := range ss.Dict {
+			var score [8]byte
+			binary.LittleEndian.PutUint64(score[:], math.Float64bits(float64(node.Score())))
+
+			cw.write(checkpointZSetMember, []byte(bucket), []byte(key), score[:], node.Value)
+		}
+	}
+
+	for bucket, members := range db.zsetDeadlines {
+		for key, deadline := range members {
+			var b [8]byte
+			binary.LittleEndian.PutUint64(b[:], deadline)
+
+			cw.write(checkpointZSetDeadline, []byte(bucket), []byte(key), b[:])
+		}
+	}
+
+	for bucket, l := range db.ListIdx {
+		for key, items := range l.Items {
+			for _, item := range items {
+				cw.write(checkpointListItem, []byte(bucket), []byte(key), item)
+			}
+		}
+	}
+
+	for bucket, bs := range db.BitmapIdx {
+		for key, b := range bs.M {
+			data, _ := b.MarshalBinary()
+			cw.write(checkpointBitmap, []byte(bucket), []byte(key), data)
+		}
+	}
+}
+
+// loadCheckpoint loads the checkpoint file into the index, it returns the data files to parse
+// after it, from the offset in the first one. If there is no valid checkpoint, the index is
+// left empty and all the data files are parsed.
+func (db *DB) loadCheckpoint(dataFileIds []int) ([]int, int64) {
+	if db.opt.EntryIdxMode == HintBPTSparseIdxMode || db.opt.Encryption != nil {
+		return dataFileIds, 0
+	}
+
+	data, err := ioutil.ReadFile(db.getCheckpointPath())
+	if err != nil {
+		return dataFileIds, 0
+	}
+
+	fID, off, err := db.readCheckpoint(data, dataFileIds)
+	if err == nil {
+		for i, id := range dataFileIds {
+			if int64(id) == fID && (fID != db.MaxFileID || off <= db.ActiveFile.writeOff) {
+				db.logger().Debug("loaded the checkpoint", "file", db.getDataPath(fID), "offset", off)
+				return dataFileIds[i:], off
+			}
+		}
+	}
+
+	db.logger().Warn("skipping the invalid checkpoint, parsing all the data files", "err", err)
+	db.resetIndexes()
+
+	return dataFileIds, 0
+}
+
+// readCheckpoint reads the checkpoint into the index, it returns the position of the data
+// files the checkpoint is written at.
+func (db *DB) readCheckpoint(data []byte, dataFileIds []int) (fID, off int64, err error) {
+	if len(data) < len(checkpointMagic)+4 || !bytes.Equal(data[:len(checkpointMagic)], checkpointMagic) {
+		return 0, 0, errCheckpoint
+	}
+
+	end := len(data) - 4
+	if crc32.ChecksumIEEE(data[:end]) != binary.LittleEndian.Uint32(data[end:]) {
+		return 0, 0, errCheckpoint
+	}
+
+	dr := &dumpReader{r: bufio.NewReader(bytes.NewReader(data[len(checkpointMagic):end]))}
+
+	var header [4]uint64
+	for i := range header {
+		if header[i], err = binary.ReadUvarint(dr); err != nil {
+			return 0, 0, errCheckpoint
+		}
+	}
+
+	if EntryIdxMode(header[0]) != db.opt.EntryIdxMode {
+		return 0, 0, errCheckpoint
+	}
+
+	fileIDs := make(map[int64]bool, len(dataFileIds))
+	for _, id := range dataFileIds {
+		fileIDs[int64(id)] = true
+	}
+
+	for {
+		// the bytes of the records are not kept, the whole checkpoint is checked by the crc.
+		dr.buf = dr.buf[:0]
+
+		kind, err := dr.ReadByte()
+		if err != nil {
+			return 0, 0, errCheckpoint
+		}
+
+		if kind == checkpointEnd {
+			break
+		}
+
+		if err := db.readCheckpointRecord(dr, kind, fileIDs); err != nil {
+			return 0, 0, errCheckpoint
+		}
+	}
+
+	db.KeyCount = int(header[3])
+
+	return int64(header[1]), int64(header[2]), nil
+}
+
+// readCheckpointRecord reads a record of the checkpoint into the index.
+func (db *DB) readCheckpointRecord(dr *dumpReader, kind byte, fileIDs map[int64]bool) error {
+	bucket, err := dr.readBytes()
+	if err != nil {
+		return err
+	}
+
+	switch kind {
+	case checkpointRecord:
+		return db.readCheckpointBPTreeRecord(dr, string(bucket), fileIDs)
+	case checkpointValidKeyCount:
+		n, err := dr.readBytes()
+		if err != nil {
+			return err
+		}
+
+		count, c := binary.Uvarint(n)
+		idx, ok := db.BPTreeIdx[string(bucket)]
+		if c <= 0 || !ok {
+			return errCheckpoint
+		}
+
+		idx.ValidKeyCount = int(count)
+
+		return nil
+	}
+
+	key, err := dr.readBytes()
+	if err != nil {
+		return err
+	}
+
+	switch kind {
+	case checkpointSetMember:
+		member, err := dr.readBytes()
+		if err != nil {
+			return err
+		}
+
+		if _, ok := db.SetIdx[string(bucket)]; !ok {
+			db.SetIdx[string(bucket)] = set.New()
+		}
+
+		return db.SetIdx[string(bucket)].SAdd(string(key), member)
+	case checkpointZSetMember:
+		score, err := dr.readBytes()
+		if err != nil {
+			return err
+		}
+
+		value, err := dr.readBytes()
+		if err != nil || len(score) != 8 {
+			return errCheckpoint
+		}
+
+		if _, ok := db.SortedSetIdx[string(bucket)]; !ok {
+			db.SortedSetIdx[string(bucket)] = zset.New()
+		}
+
+		return db.SortedSetIdx[string(bucket)].Put(string(key),
+			zset.SCORE(math.Float64frombits(binary.LittleEndian.Uint64(score))), value)
+	case checkpointZSetDeadline:
+		deadline, err := dr.readBytes()
+		if err != nil || len(deadline) != 8 {
+			return errCheckpoint
+		}
+
+		if db.zsetDeadlines[string(bucket)] == nil {
+			db.zsetDeadlines[string(bucket)] = make(map[string]uint64)
+		}
+		db.zsetDeadlines[string(bucket)][string(key)] = binary.LittleEndian.Uint64(deadline)
+
+		return nil
+	case checkpointListItem:
+		item, err := dr.readBytes()
+		if err != nil {
+			return err
+		}
+
+		if _, ok := db.ListIdx[string(bucket)]; !ok {
+			db.ListIdx[string(bucket)] = list.New()
+		}
+
+		_, err = db.ListIdx[string(bucket)].RPush(string(key), item)
+
+		return err
+	case checkpointBitmap:
+		data, err := dr.readBytes()
+		if err != nil {
+			return err
+		}
+
+		b := bitmap.New()
+		if err := b.UnmarshalBinary(data); err != nil {
+			return err
+		}
+
+		if _, ok := db.BitmapIdx[string(bucket)]; !ok {
+			db.BitmapIdx[string(bucket)] = bitmap.NewBitmaps()
+		}
+
+		db.BitmapIdx[string(bucket)].M[string(key)] = b
+
+		return nil
+	}
+
+	return errCheckpoint
+}
+
+// readCheckpointBPTreeRecord reads a record of the B+ tree index of the bucket.
+func (db *DB) readCheckpointBPTreeRecord(dr *dumpReader, bucket string, fileIDs map[int64]bool) error {
+	var fields [4][]byte
+	for i := range fields {
+		f, err := dr.readBytes()
+		if err != nil {
+			return err
+		}
+		fields[i] = f
+	}
+
+	key, header, pos, value := fields[0], fields[1], fields[2], fields[3]
+	if len(header) != DataEntryHeaderSize-4 {
+		return errCheckpoint
+	}
+
+	fID, n := binary.Uvarint(pos)
+	if n <= 0 || !fileIDs[int64(fID)] {
+		return errCheckpoint
+	}
+
+	dataPos, m := binary.Uvarint(pos[n:])
+	if m <= 0 {
+		return errCheckpoint
+	}
+
+	meta := readMetaData(append(make([]byte, 4), header...))
+	meta.bucket = []byte(bucket)
+
+	r := &Record{
+		H: &Hint{key: key, fileID: int64(fID), meta: meta, dataPos: dataPos},
+	}
+
+	// the values spilled by MaxIndexMemory are not in the checkpoint.
+	if db.opt.EntryIdxMode == HintKeyValAndRAMIdxMode && (len(value) > 0 || meta.valueSize == 0) {
+		r.E = &Entry{Key: key, Value: value, Meta: meta}
+	}
+
+	db.committedTxIds[meta.txID] = struct{}{}
+
+	return db.buildBPTreeIdx(bucket, r)
+}
+
+// resetIndexes empties the index loaded from an invalid checkpoint.
+func (db *DB) resetIndexes() {
+	db.BPTreeIdx = make(BPTreeIdx)
+	db.indexMemory = indexMemory{}
+	db.SetIdx = make(SetIdx)
+	db.SortedSetIdx = make(SortedSetIdx)
+	db.ListIdx = make(ListIdx)
+	db.BitmapIdx = make(BitmapIdx)
+	db.zsetDeadlines = make(map[string]map[string]uint64)
+	db.committedTxIds = make(map[uint64]struct{})
+	db.KeyCount = 0
+}
+
+// getCheckpointPath returns the path of the checkpoint file.
+func (db *DB) getCheckpointPath() string {
+	return db.opt.Dir + "/" + CheckpointFile
+}
+
+// runCheckpointWorker writes the checkpoint every interval of CheckpointInterval, until the db is closed.
+func (db *DB) runCheckpointWorker(interval time.Duration) {
+	defer db.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-db.closeCh:
+			return
+		case <-ticker.C:
+			if err := db.Checkpoint(); err != nil {
+				db.logger().Error("checkpoint worker", "err", err)
+			}
+		}
+	}
+}
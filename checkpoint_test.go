@@ -0,0 +1,176 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func exportForCheckpoint(t *testing.T) []byte {
+	var buf bytes.Buffer
+	if err := db.Export(&buf, ExportJSON); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestDB_Checkpoint(t *testing.T) {
+	for _, mode := range []EntryIdxMode{HintKeyValAndRAMIdxMode, HintKeyAndRAMIdxMode} {
+		InitOpt("/tmp/nutsdbtestcheckpoint", true)
+		opt.EntryIdxMode = mode
+		db, err = Open(opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		put := func(from, to int) {
+			if err := db.Update(func(tx *Tx) error {
+				for i := from; i < to; i++ {
+					key := []byte(fmt.Sprintf("key_%03d", i))
+					if err := tx.Put("bucket", key, []byte(fmt.Sprintf("val_%03d", i)), Persistent); err != nil {
+						return err
+					}
+				}
+				if mode != HintKeyValAndRAMIdxMode {
+					return nil
+				}
+				member := []byte(fmt.Sprintf("member_%03d", from))
+				if err := tx.SAdd("set", []byte("key"), member); err != nil {
+					return err
+				}
+				if err := tx.ZAdd("zset", member, float64(from), []byte("val")); err != nil {
+					return err
+				}
+				if err := tx.SetBit("bitmap", []byte("key"), uint32(from), true); err != nil {
+					return err
+				}
+				return tx.RPush("list", []byte("key"), member)
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		put(0, 200)
+		if err := db.Update(func(tx *Tx) error {
+			return tx.Delete("bucket", []byte("key_010"))
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := db.Checkpoint(); err != nil {
+			t.Fatal(err)
+		}
+
+		// the writes after the checkpoint are parsed from the data files.
+		put(100, 300)
+
+		want := exportForCheckpoint(t)
+		keyCount := db.KeyCount
+		db.Close()
+
+		db, err = Open(opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := exportForCheckpoint(t); !bytes.Equal(got, want) {
+			t.Errorf("mode %d: err Open with the checkpoint, got %s want %s", mode, got, want)
+		}
+		if db.KeyCount != keyCount {
+			t.Errorf("mode %d: err Open with the checkpoint, got KeyCount %d want %d", mode, db.KeyCount, keyCount)
+		}
+		db.Close()
+
+		// an invalid checkpoint is ignored.
+		data, err := ioutil.ReadFile(opt.Dir + "/" + CheckpointFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data[len(data)/2] ^= 0xff
+		if err := ioutil.WriteFile(opt.Dir+"/"+CheckpointFile, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		db, err = Open(opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := exportForCheckpoint(t); !bytes.Equal(got, want) {
+			t.Errorf("mode %d: err Open with an invalid checkpoint, got %s want %s", mode, got, want)
+		}
+
+		// the checkpoint is removed by the merge.
+		if err := db.Merge(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(opt.Dir + "/" + CheckpointFile); !os.IsNotExist(err) {
+			t.Errorf("mode %d: err Merge, the checkpoint is not removed", mode)
+		}
+		db.Close()
+	}
+}
+
+func TestDB_CheckpointInterval(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestcheckpoint", true)
+	opt.CheckpointInterval = time.Hour
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Update(func(tx *Tx) error {
+		return tx.Put("bucket", []byte("key"), []byte("val"), Persistent)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// the checkpoint is written when the db is closed.
+	if _, err := os.Stat(opt.Dir + "/" + CheckpointFile); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.View(func(tx *Tx) error {
+		_, err := tx.Get("bucket", []byte("key"))
+		return err
+	}); err != nil {
+		t.Error(err)
+	}
+
+	InitOpt("/tmp/nutsdbtestcheckpointsparse", true)
+	opt.EntryIdxMode = HintBPTSparseIdxMode
+	sparse, err := Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sparse.Close()
+
+	if err := sparse.Checkpoint(); err != ErrCheckpointNotSupported {
+		t.Errorf("err Checkpoint, got %v want %v", err, ErrCheckpointNotSupported)
+	}
+}
@@ -0,0 +1,320 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package cluster runs a nutsdb database as the replicated state machine of a Raft cluster,
+built on github.com/hashicorp/raft, so that a group of 3 or more nodes keeps the same data
+and survives the loss of a minority of them.
+
+The writes are commands of ops applied by the leader: Apply returns once a quorum of the
+nodes has the command in its log and the leader has applied it, so the writes are
+linearizable. The reads run on the local database of a node:
+
+	View            reads the node as it is, a follower may lag behind the leader
+	ViewAt          waits until the node has applied a log index, e.g. returned by Apply
+	ConsistentView  reads on the leader after all the previous writes are applied
+
+The raft snapshots are tar.gz backups of the database taken by DB.BackupTarGZ, a node far
+behind the leader restores one with nutsdb.RestoreTarGZ. The raft logs are kept in a nutsdb
+database of their own.
+
+The package is a separate module, so that the users of nutsdb do not depend on raft.
+*/
+package cluster
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/xujiajun/nutsdb"
+)
+
+// ErrNotLeader is returned when a write or a consistent read is not run on the leader.
+var ErrNotLeader = raft.ErrNotLeader
+
+// DefaultApplyTimeout is the time a write waits for the cluster when Config.ApplyTimeout is not set.
+const DefaultApplyTimeout = 10 * time.Second
+
+// Peer represents a node of the cluster.
+type Peer struct {
+	ID   string
+	Addr string
+}
+
+// Config represents the configuration of a node.
+type Config struct {
+	// ID represents the unique ID of the node in the cluster.
+	ID string
+
+	// Dir represents the directory of the node: its database in Dir/data,
+	// the raft logs in Dir/raft and the raft snapshots in Dir/snapshots.
+	Dir string
+
+	// Addr represents the address of the raft transport of the node, to bind and to advertise.
+	Addr string
+
+	// Peers represents the nodes of a new cluster, this node included. Each of them is started
+	// with the same Peers, which are ignored when the node has a raft state already.
+	// A node started without Peers waits to be added to a cluster by Join.
+	Peers []Peer
+
+	// Options represents the options of the database, e.g. nutsdb.DefaultOptions,
+	// its Dir is set to Dir/data.
+	Options nutsdb.Options
+
+	// Raft represents the raft configuration, raft.DefaultConfig() if it is nil.
+	// Its LocalID is set to ID.
+	Raft *raft.Config
+
+	// Transport represents the raft transport, a TCP transport on Addr if it is nil.
+	Transport raft.Transport
+
+	// ApplyTimeout represents the time a write waits for the cluster. Default is DefaultApplyTimeout.
+	ApplyTimeout time.Duration
+
+	// LogOutput represents the writer of the logs of raft, os.Stderr if it is nil.
+	LogOutput io.Writer
+}
+
+// Node represents a node of a cluster.
+type Node struct {
+	cfg   Config
+	fsm   *fsm
+	logs  *logStore
+	trans raft.Transport
+	raft  *raft.Raft
+}
+
+// Open starts the node of the cfg.
+func Open(cfg Config) (n *Node, err error) {
+	if cfg.ApplyTimeout <= 0 {
+		cfg.ApplyTimeout = DefaultApplyTimeout
+	}
+	if cfg.LogOutput == nil {
+		cfg.LogOutput = os.Stderr
+	}
+
+	n = &Node{cfg: cfg}
+	defer func() {
+		if err != nil {
+			n.closeStores()
+		}
+	}()
+
+	opt := cfg.Options
+	opt.Dir = path.Join(cfg.Dir, "data")
+	if n.fsm, err = openFSM(opt); err != nil {
+		return nil, err
+	}
+
+	if n.logs, err = openLogStore(path.Join(cfg.Dir, "raft")); err != nil {
+		return nil, err
+	}
+
+	snaps, err := raft.NewFileSnapshotStore(cfg.Dir, 2, cfg.LogOutput)
+	if err != nil {
+		return nil, err
+	}
+
+	if n.trans = cfg.Transport; n.trans == nil {
+		if n.trans, err = raft.NewTCPTransport(cfg.Addr, nil, 3, 10*time.Second, cfg.LogOutput); err != nil {
+			return nil, err
+		}
+	}
+
+	rc := raft.DefaultConfig()
+	if cfg.Raft != nil {
+		c := *cfg.Raft
+		rc = &c
+	}
+	rc.LocalID = raft.ServerID(cfg.ID)
+	if rc.Logger == nil && rc.LogOutput == nil {
+		rc.LogOutput = cfg.LogOutput
+	}
+
+	if len(cfg.Peers) > 0 {
+		exists, err := raft.HasExistingState(n.logs, n.logs, snaps)
+		if err != nil {
+			return nil, err
+		}
+
+		if !exists {
+			var servers []raft.Server
+			for _, p := range cfg.Peers {
+				servers = append(servers, raft.Server{ID: raft.ServerID(p.ID), Address: raft.ServerAddress(p.Addr)})
+			}
+			if err := raft.BootstrapCluster(rc, n.logs, n.logs, snaps, n.trans, raft.Configuration{Servers: servers}); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if n.raft, err = raft.NewRaft(rc, n.fsm, n.logs, n.logs, snaps, n.trans); err != nil {
+		return nil, err
+	}
+
+	return n, nil
+}
+
+// closeStores closes the transport, the logs and the database of the node.
+func (n *Node) closeStores() error {
+	var err error
+	if c, ok := n.trans.(io.Closer); ok && n.cfg.Transport == nil {
+		err = c.Close()
+	}
+
+	if n.logs != nil {
+		if e := n.logs.close(); err == nil {
+			err = e
+		}
+	}
+
+	if n.fsm != nil {
+		if e := n.fsm.close(); err == nil {
+			err = e
+		}
+	}
+
+	return err
+}
+
+// Close stops the node. The cluster goes on without it, use Leave to remove it.
+func (n *Node) Close() error {
+	err := n.raft.Shutdown().Error()
+
+	if e := n.closeStores(); err == nil {
+		err = e
+	}
+
+	return err
+}
+
+// ID returns the ID of the node.
+func (n *Node) ID() string {
+	return n.cfg.ID
+}
+
+// IsLeader returns if the node is the leader.
+func (n *Node) IsLeader() bool {
+	return n.raft.State() == raft.Leader
+}
+
+// Leader returns the leader known by the node, the zero Peer if there is none.
+func (n *Node) Leader() Peer {
+	addr, id := n.raft.LeaderWithID()
+	return Peer{ID: string(id), Addr: string(addr)}
+}
+
+// Peers returns the nodes of the cluster.
+func (n *Node) Peers() ([]Peer, error) {
+	f := n.raft.GetConfiguration()
+	if err := f.Error(); err != nil {
+		return nil, err
+	}
+
+	var peers []Peer
+	for _, s := range f.Configuration().Servers {
+		peers = append(peers, Peer{ID: string(s.ID), Addr: string(s.Address)})
+	}
+
+	return peers, nil
+}
+
+// Join adds the node of given id and addr to the cluster as a voter, it is run on the leader.
+func (n *Node) Join(id, addr string) error {
+	return n.raft.AddVoter(raft.ServerID(id), raft.ServerAddress(addr), 0, n.cfg.ApplyTimeout).Error()
+}
+
+// Leave removes the node of given id from the cluster, it is run on the leader.
+func (n *Node) Leave(id string) error {
+	return n.raft.RemoveServer(raft.ServerID(id), 0, n.cfg.ApplyTimeout).Error()
+}
+
+// Apply writes the ops in a transaction on all the nodes, it is run on the leader.
+// It returns the index of the raft log of the write, see ViewAt, or ErrNotLeader.
+// If the transaction fails, e.g. the key of an op is empty, no op is written and the
+// error is returned.
+func (n *Node) Apply(ops ...Op) (uint64, error) {
+	f := n.raft.Apply(encodeOps(ops), n.cfg.ApplyTimeout)
+	if err := f.Error(); err != nil {
+		return 0, err
+	}
+
+	if err, ok := f.Response().(error); ok {
+		return f.Index(), err
+	}
+
+	return f.Index(), nil
+}
+
+// Put puts the value of the key in the bucket with the ttl, see Apply.
+func (n *Node) Put(bucket string, key, value []byte, ttl uint32) error {
+	_, err := n.Apply(Op{Bucket: bucket, Key: key, Value: value, TTL: ttl})
+	return err
+}
+
+// Delete deletes the key in the bucket, see Apply.
+func (n *Node) Delete(bucket string, key []byte) error {
+	_, err := n.Apply(Op{Delete: true, Bucket: bucket, Key: key})
+	return err
+}
+
+// View runs fn in a read transaction of the database of the node, which may lag behind
+// the leader. The database must not be written but by Apply.
+func (n *Node) View(fn func(tx *nutsdb.Tx) error) error {
+	return n.fsm.view(fn)
+}
+
+// ViewAt runs fn like View once the node has applied the raft log at index,
+// so that it sees the writes of Apply up to the index.
+func (n *Node) ViewAt(ctx context.Context, index uint64, fn func(tx *nutsdb.Tx) error) error {
+	for {
+		ch := n.fsm.waitCh()
+		if atomic.LoadUint64(&n.fsm.applied) >= index {
+			return n.View(fn)
+		}
+
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// ConsistentView runs fn like View on the leader, once all the writes committed
+// before the call are applied. It returns ErrNotLeader on the other nodes.
+func (n *Node) ConsistentView(fn func(tx *nutsdb.Tx) error) error {
+	if err := n.raft.Barrier(n.cfg.ApplyTimeout).Error(); err != nil {
+		return err
+	}
+
+	return n.View(fn)
+}
+
+// AppliedIndex returns the index of the last raft log applied to the database of the node.
+func (n *Node) AppliedIndex() uint64 {
+	return atomic.LoadUint64(&n.fsm.applied)
+}
+
+// Snapshot takes a raft snapshot of the node, so that its raft logs before it are compacted.
+// Raft also takes them by itself, see raft.Config.SnapshotThreshold.
+func (n *Node) Snapshot() error {
+	return n.raft.Snapshot().Error()
+}
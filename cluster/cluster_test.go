@@ -0,0 +1,271 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/xujiajun/nutsdb"
+)
+
+const testDir = "/tmp/nutsdbtestcluster"
+
+func testRaftConfig() *raft.Config {
+	c := raft.DefaultConfig()
+	c.HeartbeatTimeout = 50 * time.Millisecond
+	c.ElectionTimeout = 50 * time.Millisecond
+	c.LeaderLeaseTimeout = 50 * time.Millisecond
+	c.CommitTimeout = 5 * time.Millisecond
+	c.TrailingLogs = 2
+	c.SnapshotThreshold = 1 << 20
+	c.LogOutput = ioutil.Discard
+	return c
+}
+
+// testCluster represents the nodes of a test cluster and their in-memory transports.
+type testCluster struct {
+	t      *testing.T
+	nodes  map[string]*Node
+	trans  map[string]*raft.InmemTransport
+	leader *Node
+}
+
+// open starts the node of given id, connected to the nodes already started.
+func (c *testCluster) open(id string, peers []Peer) *Node {
+	_, trans := raft.NewInmemTransport(raft.ServerAddress(id))
+	for peer, tr := range c.trans {
+		trans.Connect(raft.ServerAddress(peer), tr)
+		tr.Connect(raft.ServerAddress(id), trans)
+	}
+	c.trans[id] = trans
+
+	n, err := Open(Config{
+		ID:        id,
+		Dir:       path.Join(testDir, id),
+		Addr:      id,
+		Peers:     peers,
+		Options:   nutsdb.DefaultOptions,
+		Raft:      testRaftConfig(),
+		Transport: trans,
+		LogOutput: ioutil.Discard,
+	})
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	c.nodes[id] = n
+
+	return n
+}
+
+// waitLeader returns the leader of the cluster once it is elected.
+func (c *testCluster) waitLeader() *Node {
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		for _, n := range c.nodes {
+			if n.IsLeader() {
+				return n
+			}
+		}
+	}
+
+	c.t.Fatal("err cluster, no leader elected")
+	return nil
+}
+
+func checkKeys(t *testing.T, n *Node, index uint64, bucket string, want int) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := n.ViewAt(ctx, index, func(tx *nutsdb.Tx) error {
+		entries, err := tx.GetAll(bucket)
+		if err != nil {
+			return err
+		}
+		if len(entries) != want {
+			t.Errorf("err node %s, got %d keys want %d", n.ID(), len(entries), want)
+		}
+		return nil
+	}); err != nil {
+		t.Errorf("err node %s, %v", n.ID(), err)
+	}
+}
+
+func TestCluster(t *testing.T) {
+	os.RemoveAll(testDir)
+
+	c := &testCluster{t: t, nodes: make(map[string]*Node), trans: make(map[string]*raft.InmemTransport)}
+	defer func() {
+		for _, n := range c.nodes {
+			n.Close()
+		}
+	}()
+
+	peers := []Peer{{ID: "node1", Addr: "node1"}, {ID: "node2", Addr: "node2"}, {ID: "node3", Addr: "node3"}}
+	for _, p := range peers {
+		c.open(p.ID, peers)
+	}
+	leader := c.waitLeader()
+
+	var index uint64
+	for i := 0; i < 10; i++ {
+		var err error
+		if index, err = leader.Apply(Op{Bucket: "bucket", Key: []byte(fmt.Sprintf("key_%d", i)), Value: []byte("val"), TTL: nutsdb.Persistent}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the failed transactions write nothing.
+	if _, err := leader.Apply(Op{Bucket: "bucket", Key: []byte("key_10"), Value: []byte("val")}, Op{Bucket: "bucket"}); err != nutsdb.ErrKeyEmpty {
+		t.Errorf("err Apply, got %v want %v", err, nutsdb.ErrKeyEmpty)
+	}
+
+	for _, n := range c.nodes {
+		checkKeys(t, n, index, "bucket", 10)
+
+		if n == leader {
+			if err := n.ConsistentView(func(tx *nutsdb.Tx) error { return nil }); err != nil {
+				t.Errorf("err ConsistentView, %v", err)
+			}
+			continue
+		}
+
+		if err := n.Put("bucket", []byte("key"), []byte("val"), nutsdb.Persistent); err != ErrNotLeader {
+			t.Errorf("err Put on a follower, got %v want %v", err, ErrNotLeader)
+		}
+		if err := n.ConsistentView(func(tx *nutsdb.Tx) error { return nil }); err != ErrNotLeader {
+			t.Errorf("err ConsistentView on a follower, got %v want %v", err, ErrNotLeader)
+		}
+	}
+
+	// a new node gets the snapshot, its logs are compacted.
+	if err := leader.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+	if err := leader.Delete("bucket", []byte("key_0")); err != nil {
+		t.Fatal(err)
+	}
+	if first, err := leader.logs.FirstIndex(); err != nil || first <= 1 {
+		t.Errorf("err FirstIndex after snapshot, got %d %v", first, err)
+	}
+
+	node4 := c.open("node4", nil)
+	if err := leader.Join("node4", "node4"); err != nil {
+		t.Fatal(err)
+	}
+	checkKeys(t, node4, leader.AppliedIndex(), "bucket", 9)
+
+	if peers, err := leader.Peers(); err != nil || len(peers) != 4 {
+		t.Errorf("err Peers, got %v %v", peers, err)
+	}
+
+	// the node keeps its data when it is restarted.
+	if err := node4.Close(); err != nil {
+		t.Fatal(err)
+	}
+	index, err := leader.Apply(Op{Bucket: "bucket", Key: []byte("key_0"), Value: []byte("val")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	delete(c.trans, "node4")
+	node4 = c.open("node4", nil)
+	checkKeys(t, node4, index, "bucket", 10)
+
+	if err := leader.Leave("node4"); err != nil {
+		t.Fatal(err)
+	}
+	if peers, err := leader.Peers(); err != nil || len(peers) != 3 {
+		t.Errorf("err Peers, got %v %v", peers, err)
+	}
+}
+
+func TestOps(t *testing.T) {
+	ops := []Op{
+		{Bucket: "bucket", Key: []byte("key"), Value: []byte("val"), TTL: 60},
+		{Delete: true, Bucket: "bucket", Key: []byte("key")},
+	}
+
+	got, err := decodeOps(encodeOps(ops))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(got) != fmt.Sprint([]Op{ops[0], {Delete: true, Bucket: "bucket", Key: []byte("key"), Value: []byte{}}}) {
+		t.Errorf("err decodeOps, got %v", got)
+	}
+
+	data := encodeOps(ops)
+	if _, err := decodeOps(data[:len(data)-1]); err != ErrInvalidCommand {
+		t.Errorf("err decodeOps, got %v want %v", err, ErrInvalidCommand)
+	}
+}
+
+func TestLogStore(t *testing.T) {
+	dir := path.Join(testDir, "logstore")
+	os.RemoveAll(dir)
+
+	s, err := openLogStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+
+	if first, err := s.FirstIndex(); err != nil || first != 0 {
+		t.Errorf("err FirstIndex, got %d %v", first, err)
+	}
+
+	var logs []*raft.Log
+	for i := uint64(1); i <= 5; i++ {
+		logs = append(logs, &raft.Log{Index: i, Term: 1, Type: raft.LogCommand, Data: []byte(fmt.Sprintf("data_%d", i)), AppendedAt: time.Unix(0, int64(i))})
+	}
+	if err := s.StoreLogs(logs); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.DeleteRange(1, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	first, _ := s.FirstIndex()
+	last, _ := s.LastIndex()
+	if first != 3 || last != 5 {
+		t.Errorf("err log indexes, got %d %d", first, last)
+	}
+
+	var l raft.Log
+	if err := s.GetLog(4, &l); err != nil || string(l.Data) != "data_4" || l.Term != 1 || !l.AppendedAt.Equal(time.Unix(0, 4)) {
+		t.Errorf("err GetLog, got %+v %v", l, err)
+	}
+	if err := s.GetLog(1, &l); err != raft.ErrLogNotFound {
+		t.Errorf("err GetLog, got %v want %v", err, raft.ErrLogNotFound)
+	}
+
+	if _, err := s.GetUint64([]byte("term")); err == nil || err.Error() != "not found" {
+		t.Errorf("err GetUint64, got %v", err)
+	}
+	if err := s.SetUint64([]byte("term"), 7); err != nil {
+		t.Fatal(err)
+	}
+	if term, err := s.GetUint64([]byte("term")); err != nil || term != 7 {
+		t.Errorf("err GetUint64, got %d %v", term, err)
+	}
+}
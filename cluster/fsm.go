@@ -0,0 +1,317 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/hashicorp/raft"
+	"github.com/xujiajun/nutsdb"
+)
+
+// ErrInvalidCommand is returned when a raft log is not a command written by Apply.
+var ErrInvalidCommand = errors.New("invalid cluster command")
+
+// AppliedBucket is the bucket of the database of a node recording the index of the last raft log
+// applied to it, it is written with each applied command.
+const AppliedBucket = "_nutsdb_cluster"
+
+var appliedKey = []byte("applied")
+
+// Op represents a write of a command: a put of the key, or a delete if Delete is set.
+type Op struct {
+	Delete bool
+	Bucket string
+	Key    []byte
+	Value  []byte
+	TTL    uint32
+}
+
+// encodeOps returns the raft log data of the ops.
+func encodeOps(ops []Op) []byte {
+	var buf []byte
+	buf = binary.AppendUvarint(buf, uint64(len(ops)))
+
+	for _, op := range ops {
+		if op.Delete {
+			buf = append(buf, 1)
+		} else {
+			buf = append(buf, 0)
+		}
+		buf = binary.BigEndian.AppendUint32(buf, op.TTL)
+		for _, b := range [][]byte{[]byte(op.Bucket), op.Key, op.Value} {
+			buf = binary.AppendUvarint(buf, uint64(len(b)))
+			buf = append(buf, b...)
+		}
+	}
+
+	return buf
+}
+
+// decodeOps returns the ops of the raft log data.
+func decodeOps(data []byte) ([]Op, error) {
+	invalid := false
+
+	// next returns the next n bytes of the data.
+	next := func(n uint64) []byte {
+		if invalid || n > uint64(len(data)) {
+			invalid = true
+			return nil
+		}
+		b := data[:n]
+		data = data[n:]
+		return b
+	}
+
+	// uvarint returns the next uvarint of the data.
+	uvarint := func() uint64 {
+		v, l := binary.Uvarint(data)
+		if l <= 0 {
+			invalid = true
+			return 0
+		}
+		data = data[l:]
+		return v
+	}
+
+	count := uvarint()
+	if invalid || count > uint64(len(data)) {
+		return nil, ErrInvalidCommand
+	}
+
+	ops := make([]Op, count)
+	for i := range ops {
+		head := next(5)
+		bucket := next(uvarint())
+		key := next(uvarint())
+		value := next(uvarint())
+		if invalid {
+			return nil, ErrInvalidCommand
+		}
+
+		ops[i] = Op{Delete: head[0] == 1, TTL: binary.BigEndian.Uint32(head[1:]), Bucket: string(bucket), Key: key, Value: value}
+	}
+
+	return ops, nil
+}
+
+// fsm is the raft state machine of the database of a node. The database is replaced by Restore,
+// so the uses of db hold mu.
+type fsm struct {
+	opt nutsdb.Options
+
+	mu sync.RWMutex
+	db *nutsdb.DB
+
+	applied   uint64 // the index of the last applied log, updated atomically
+	appliedMu sync.Mutex
+	appliedCh chan struct{} // closed when a log is applied
+}
+
+func openFSM(opt nutsdb.Options) (*fsm, error) {
+	db, err := nutsdb.Open(opt)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &fsm{opt: opt, db: db, appliedCh: make(chan struct{})}
+
+	applied, err := f.dbApplied()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	f.applied = applied
+
+	return f, nil
+}
+
+// dbApplied returns the index of the last log applied to the database.
+func (f *fsm) dbApplied() (applied uint64, err error) {
+	err = f.db.View(func(tx *nutsdb.Tx) error {
+		e, err := tx.Get(AppliedBucket, appliedKey)
+		if err != nil || len(e.Value) != 8 {
+			return nil
+		}
+		applied = binary.BigEndian.Uint64(e.Value)
+		return nil
+	})
+
+	return
+}
+
+// setApplied records the index of the last applied log and wakes up the waiters.
+func (f *fsm) setApplied(index uint64) {
+	atomic.StoreUint64(&f.applied, index)
+
+	f.appliedMu.Lock()
+	close(f.appliedCh)
+	f.appliedCh = make(chan struct{})
+	f.appliedMu.Unlock()
+}
+
+// waitCh returns the channel closed when the next log is applied.
+func (f *fsm) waitCh() <-chan struct{} {
+	f.appliedMu.Lock()
+	defer f.appliedMu.Unlock()
+
+	return f.appliedCh
+}
+
+// Apply applies the ops of the command in a transaction, with the index of the log.
+// The logs already applied to the database, e.g. replayed after a restart, are skipped.
+// It returns the error of the transaction, which is the response of the log.
+func (f *fsm) Apply(l *raft.Log) interface{} {
+	if l.Type != raft.LogCommand || l.Index <= atomic.LoadUint64(&f.applied) {
+		return nil
+	}
+
+	ops, err := decodeOps(l.Data)
+	if err != nil {
+		return err
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	index := make([]byte, 8)
+	binary.BigEndian.PutUint64(index, l.Index)
+
+	applyErr := f.db.Update(func(tx *nutsdb.Tx) error {
+		for _, op := range ops {
+			var err error
+			if op.Delete {
+				err = tx.Delete(op.Bucket, op.Key)
+			} else {
+				err = tx.Put(op.Bucket, op.Key, op.Value, op.TTL)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Put(AppliedBucket, appliedKey, index, nutsdb.Persistent)
+	})
+	if applyErr != nil {
+		// the log is applied as a failed command.
+		if err := f.db.Update(func(tx *nutsdb.Tx) error {
+			return tx.Put(AppliedBucket, appliedKey, index, nutsdb.Persistent)
+		}); err != nil {
+			return err
+		}
+	}
+
+	f.setApplied(l.Index)
+
+	return applyErr
+}
+
+// Snapshot returns the snapshot of the database, the backup is taken when it is persisted.
+// It may have the logs applied after this call, which are skipped when they are replayed.
+func (f *fsm) Snapshot() (raft.FSMSnapshot, error) {
+	return &fsmSnapshot{f: f}, nil
+}
+
+// Restore replaces the database by the backup of the snapshot, unless the database has
+// already applied the logs of the snapshot.
+func (f *fsm) Restore(rc io.ReadCloser) error {
+	defer rc.Close()
+
+	r := bufio.NewReader(rc)
+	head := make([]byte, 8)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return err
+	}
+
+	if binary.BigEndian.Uint64(head) <= atomic.LoadUint64(&f.applied) {
+		return nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.db.Close(); err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(f.opt.Dir); err != nil {
+		return err
+	}
+
+	if err := nutsdb.RestoreTarGZ(r, f.opt.Dir); err != nil {
+		return err
+	}
+
+	db, err := nutsdb.Open(f.opt)
+	if err != nil {
+		return err
+	}
+	f.db = db
+
+	applied, err := f.dbApplied()
+	if err != nil {
+		return err
+	}
+	f.setApplied(applied)
+
+	return nil
+}
+
+// view runs fn in a read transaction of the database.
+func (f *fsm) view(fn func(tx *nutsdb.Tx) error) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return f.db.View(fn)
+}
+
+func (f *fsm) close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.db.Close()
+}
+
+// fsmSnapshot writes the index of the last applied log, then the tar.gz backup of the database.
+type fsmSnapshot struct {
+	f *fsm
+}
+
+func (s *fsmSnapshot) Persist(sink raft.SnapshotSink) error {
+	s.f.mu.RLock()
+	defer s.f.mu.RUnlock()
+
+	head := make([]byte, 8)
+	binary.BigEndian.PutUint64(head, atomic.LoadUint64(&s.f.applied))
+
+	_, err := sink.Write(head)
+	if err == nil {
+		err = s.f.db.BackupTarGZ(sink)
+	}
+
+	if err != nil {
+		sink.Cancel()
+		return err
+	}
+
+	return sink.Close()
+}
+
+func (s *fsmSnapshot) Release() {}
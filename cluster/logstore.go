@@ -0,0 +1,211 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/xujiajun/nutsdb"
+)
+
+// the buckets of the raft logs and of the stable store.
+const (
+	logsBucket   = "logs"
+	stableBucket = "stable"
+)
+
+// errNotFound is the error of the stable store for a missing key, which raft checks by its message.
+var errNotFound = errors.New("not found")
+
+// logStore is the raft log store and stable store of a node, in a nutsdb database of its own.
+// The logs are keyed by their big-endian index, so the keys are in log order.
+type logStore struct {
+	db *nutsdb.DB
+}
+
+func openLogStore(dir string) (*logStore, error) {
+	opt := nutsdb.DefaultOptions
+	opt.Dir = dir
+
+	db, err := nutsdb.Open(opt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logStore{db: db}, nil
+}
+
+func (s *logStore) close() error {
+	return s.db.Close()
+}
+
+func logKey(index uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, index)
+	return key
+}
+
+// encodeLog returns the value of the log: its term, type and append time, then the
+// uvarint-prefixed data and extensions.
+func encodeLog(l *raft.Log) []byte {
+	buf := make([]byte, 17, 17+len(l.Data)+len(l.Extensions)+2*binary.MaxVarintLen64)
+	binary.BigEndian.PutUint64(buf, l.Term)
+	buf[8] = byte(l.Type)
+	binary.BigEndian.PutUint64(buf[9:], uint64(l.AppendedAt.UnixNano()))
+
+	for _, b := range [][]byte{l.Data, l.Extensions} {
+		buf = binary.AppendUvarint(buf, uint64(len(b)))
+		buf = append(buf, b...)
+	}
+
+	return buf
+}
+
+func decodeLog(index uint64, value []byte, l *raft.Log) error {
+	if len(value) < 17 {
+		return raft.ErrLogNotFound
+	}
+
+	l.Index = index
+	l.Term = binary.BigEndian.Uint64(value)
+	l.Type = raft.LogType(value[8])
+	l.AppendedAt = time.Unix(0, int64(binary.BigEndian.Uint64(value[9:])))
+
+	value = value[17:]
+	for _, b := range []*[]byte{&l.Data, &l.Extensions} {
+		n, k := binary.Uvarint(value)
+		if k <= 0 || n > uint64(len(value)-k) {
+			return raft.ErrLogNotFound
+		}
+		*b = append([]byte(nil), value[k:k+int(n)]...)
+		value = value[k+int(n):]
+	}
+
+	return nil
+}
+
+// edgeIndex returns the first or the last index of the logs, 0 if there is none.
+func (s *logStore) edgeIndex(last bool) (index uint64, err error) {
+	err = s.db.View(func(tx *nutsdb.Tx) error {
+		var (
+			key []byte
+			err error
+		)
+		if last {
+			key, err = tx.LastKey(logsBucket)
+		} else {
+			key, err = tx.FirstKey(logsBucket)
+		}
+		if errors.Is(err, nutsdb.ErrBucketEmpty) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		index = binary.BigEndian.Uint64(key)
+		return nil
+	})
+
+	return
+}
+
+func (s *logStore) FirstIndex() (uint64, error) {
+	return s.edgeIndex(false)
+}
+
+func (s *logStore) LastIndex() (uint64, error) {
+	return s.edgeIndex(true)
+}
+
+func (s *logStore) GetLog(index uint64, l *raft.Log) error {
+	return s.db.View(func(tx *nutsdb.Tx) error {
+		e, err := tx.Get(logsBucket, logKey(index))
+		if err != nil {
+			return raft.ErrLogNotFound
+		}
+		return decodeLog(index, e.Value, l)
+	})
+}
+
+func (s *logStore) StoreLog(l *raft.Log) error {
+	return s.StoreLogs([]*raft.Log{l})
+}
+
+func (s *logStore) StoreLogs(logs []*raft.Log) error {
+	return s.db.Update(func(tx *nutsdb.Tx) error {
+		for _, l := range logs {
+			if err := tx.Put(logsBucket, logKey(l.Index), encodeLog(l), nutsdb.Persistent); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *logStore) DeleteRange(min, max uint64) error {
+	return s.db.Update(func(tx *nutsdb.Tx) error {
+		keys, err := tx.RangeScanKeys(logsBucket, logKey(min), logKey(max))
+		if errors.Is(err, nutsdb.ErrBucketNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if err := tx.Delete(logsBucket, key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *logStore) Set(key, value []byte) error {
+	return s.db.Update(func(tx *nutsdb.Tx) error {
+		return tx.Put(stableBucket, key, value, nutsdb.Persistent)
+	})
+}
+
+func (s *logStore) Get(key []byte) (value []byte, err error) {
+	err = s.db.View(func(tx *nutsdb.Tx) error {
+		e, err := tx.Get(stableBucket, key)
+		if err != nil {
+			return errNotFound
+		}
+		value = append([]byte(nil), e.Value...)
+		return nil
+	})
+
+	return
+}
+
+func (s *logStore) SetUint64(key []byte, value uint64) error {
+	return s.Set(key, logKey(value))
+}
+
+func (s *logStore) GetUint64(key []byte) (uint64, error) {
+	value, err := s.Get(key)
+	if err != nil {
+		return 0, err
+	}
+	if len(value) != 8 {
+		return 0, errNotFound
+	}
+
+	return binary.BigEndian.Uint64(value), nil
+}
@@ -0,0 +1,61 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command nutsdb-server serves a nutsdb database over the Redis protocol.
+//
+//	nutsdb-server -dir /tmp/nutsdb -addr 127.0.0.1:6380
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/xujiajun/nutsdb"
+	"github.com/xujiajun/nutsdb/server"
+)
+
+func main() {
+	dir := flag.String("dir", "/tmp/nutsdb", "the dir of the database")
+	addr := flag.String("addr", "127.0.0.1:6380", "the address to listen on")
+	flag.Parse()
+
+	opt := nutsdb.DefaultOptions
+	opt.Dir = *dir
+
+	db, err := nutsdb.Open(opt)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	srv := server.New(db)
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigCh
+		srv.Close()
+	}()
+
+	log.Printf("nutsdb-server listening on %s", *addr)
+	if err := srv.ListenAndServe(*addr); err != nil && err != server.ErrServerClosed {
+		log.Print(err)
+	}
+
+	if err := db.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,393 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command nutsdb inspects and repairs a nutsdb database.
+//
+//	nutsdb [-dir dir] [-mode ram|key|sparse] [-segment-size bytes] command [args]
+//
+// The commands are:
+//
+//	buckets                         list the buckets with live keys
+//	keys <bucket> [prefix]          list the keys of the bucket, with the prefix
+//	get <bucket> <key>              print the value of the key
+//	set [-ttl seconds] <bucket> <key> <value>
+//	                                set the value of the key
+//	delete <bucket> <key>           delete the key
+//	stats                           print the statistics of the database
+//	segments                        print the entries and bytes of each data file
+//	verify                          check the data files and the index, see db.Verify
+//	merge                           merge the data files
+//	recover                         repair the database, see db.Repair
+//
+// The database must not be opened by another process. The options must be the ones
+// the database is written with. segments, verify and recover open the database with
+// OpenCorrupted and read the data files like the database does. The databases written
+// with Encryption, a Backend or a compressor registered by the application are not
+// supported, verify and recover fail on their entries instead of reporting corruptions.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/xujiajun/nutsdb"
+)
+
+var idxModes = map[string]nutsdb.EntryIdxMode{
+	"ram":    nutsdb.HintKeyValAndRAMIdxMode,
+	"key":    nutsdb.HintKeyAndRAMIdxMode,
+	"sparse": nutsdb.HintBPTSparseIdxMode,
+}
+
+// errUsage is returned by run when the flags or the command are wrong.
+var errUsage = errors.New("usage")
+
+type command struct {
+	usage string
+	run   func(w io.Writer, opt nutsdb.Options, args []string) error
+}
+
+var commands = map[string]command{
+	"buckets":  {"buckets", buckets},
+	"keys":     {"keys <bucket> [prefix]", keys},
+	"get":      {"get <bucket> <key>", get},
+	"set":      {"set [-ttl seconds] <bucket> <key> <value>", set},
+	"delete":   {"delete <bucket> <key>", del},
+	"stats":    {"stats", stats},
+	"segments": {"segments", segments},
+	"verify":   {"verify", verify},
+	"merge":    {"merge", merge},
+	"recover":  {"recover", recoverDB},
+}
+
+func usage(fs *flag.FlagSet) {
+	fmt.Fprintln(os.Stderr, "usage: nutsdb [-dir dir] [-mode ram|key|sparse] [-segment-size bytes] command [args]")
+	fs.PrintDefaults()
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(os.Stderr, "commands:")
+	for _, name := range names {
+		fmt.Fprintln(os.Stderr, "  "+commands[name].usage)
+	}
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		if err == errUsage {
+			os.Exit(2)
+		}
+		fmt.Fprintln(os.Stderr, "nutsdb: "+err.Error())
+		os.Exit(1)
+	}
+}
+
+// run parses the flags and runs the command, its output is written to w.
+func run(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("nutsdb", flag.ContinueOnError)
+	dir := fs.String("dir", "/tmp/nutsdb", "the dir of the database")
+	mode := fs.String("mode", "ram", "the EntryIdxMode of the database: ram, key or sparse")
+	segmentSize := fs.Int64("segment-size", nutsdb.DefaultOptions.SegmentSize, "the SegmentSize of the database")
+	fs.Usage = func() { usage(fs) }
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+
+	idxMode, ok := idxModes[*mode]
+	if !ok || fs.NArg() == 0 {
+		usage(fs)
+		return errUsage
+	}
+
+	cmd, ok := commands[fs.Arg(0)]
+	if !ok {
+		usage(fs)
+		return errUsage
+	}
+
+	opt := nutsdb.DefaultOptions
+	opt.Dir = *dir
+	opt.EntryIdxMode = idxMode
+	opt.SegmentSize = *segmentSize
+
+	return cmd.run(w, opt, fs.Args()[1:])
+}
+
+// withDB opens the database, calls fn and closes it.
+func withDB(opt nutsdb.Options, fn func(db *nutsdb.DB) error) error {
+	// the commands must not create a database by mistake.
+	if _, err := os.Stat(opt.Dir); err != nil {
+		return err
+	}
+
+	db, err := nutsdb.Open(opt)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(db); err != nil {
+		db.Close()
+		return err
+	}
+
+	return db.Close()
+}
+
+func checkArgs(args []string, min, max int) error {
+	if len(args) < min || len(args) > max {
+		return fmt.Errorf("wrong number of arguments")
+	}
+
+	return nil
+}
+
+func buckets(w io.Writer, opt nutsdb.Options, args []string) error {
+	if err := checkArgs(args, 0, 0); err != nil {
+		return err
+	}
+
+	return withDB(opt, func(db *nutsdb.DB) error {
+		buckets, err := db.Buckets()
+		if err != nil {
+			return err
+		}
+
+		for _, bucket := range buckets {
+			fmt.Fprintln(w, bucket)
+		}
+
+		return nil
+	})
+}
+
+func keys(w io.Writer, opt nutsdb.Options, args []string) error {
+	if err := checkArgs(args, 1, 2); err != nil {
+		return err
+	}
+
+	var prefix []byte
+	if len(args) == 2 {
+		prefix = []byte(args[1])
+	}
+
+	return withDB(opt, func(db *nutsdb.DB) error {
+		return db.View(func(tx *nutsdb.Tx) error {
+			keys, _, err := tx.PrefixScanKeys(args[0], prefix, 0, nutsdb.ScanNoLimit)
+			if errors.Is(err, nutsdb.ErrPrefixScan) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			for _, key := range keys {
+				fmt.Fprintln(w, strconv.Quote(string(key)))
+			}
+
+			return nil
+		})
+	})
+}
+
+func get(w io.Writer, opt nutsdb.Options, args []string) error {
+	if err := checkArgs(args, 2, 2); err != nil {
+		return err
+	}
+
+	return withDB(opt, func(db *nutsdb.DB) error {
+		return db.View(func(tx *nutsdb.Tx) error {
+			e, err := tx.Get(args[0], []byte(args[1]))
+			if err != nil {
+				return err
+			}
+
+			_, err = w.Write(append(e.Value, '\n'))
+			return err
+		})
+	})
+}
+
+func set(w io.Writer, opt nutsdb.Options, args []string) error {
+	fs := flag.NewFlagSet("set", flag.ContinueOnError)
+	ttl := fs.Uint("ttl", 0, "the TTL of the key in seconds, 0 means persistent")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	args = fs.Args()
+	if err := checkArgs(args, 3, 3); err != nil {
+		return err
+	}
+
+	return withDB(opt, func(db *nutsdb.DB) error {
+		return db.Update(func(tx *nutsdb.Tx) error {
+			return tx.Put(args[0], []byte(args[1]), []byte(args[2]), uint32(*ttl))
+		})
+	})
+}
+
+func del(w io.Writer, opt nutsdb.Options, args []string) error {
+	if err := checkArgs(args, 2, 2); err != nil {
+		return err
+	}
+
+	return withDB(opt, func(db *nutsdb.DB) error {
+		return db.Update(func(tx *nutsdb.Tx) error {
+			if _, err := tx.Get(args[0], []byte(args[1])); err != nil {
+				return err
+			}
+
+			return tx.Delete(args[0], []byte(args[1]))
+		})
+	})
+}
+
+func stats(w io.Writer, opt nutsdb.Options, args []string) error {
+	if err := checkArgs(args, 0, 0); err != nil {
+		return err
+	}
+
+	return withDB(opt, func(db *nutsdb.DB) error {
+		stats, err := db.Stats()
+		if err != nil {
+			return err
+		}
+
+		out, err := json.MarshalIndent(stats, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(w, string(out))
+
+		return nil
+	})
+}
+
+func merge(w io.Writer, opt nutsdb.Options, args []string) error {
+	if err := checkArgs(args, 0, 0); err != nil {
+		return err
+	}
+
+	return withDB(opt, func(db *nutsdb.DB) error {
+		return db.Merge()
+	})
+}
+
+// withReport opens the database with OpenCorrupted and returns the report of check,
+// db.Verify or db.Repair.
+func withReport(opt nutsdb.Options, check func(db *nutsdb.DB) (*nutsdb.VerifyReport, error)) (report *nutsdb.VerifyReport, err error) {
+	opt.OpenCorrupted = true
+
+	err = withDB(opt, func(db *nutsdb.DB) error {
+		report, err = check(db)
+		return err
+	})
+
+	return report, err
+}
+
+func dataFileName(fID int64) string {
+	return strconv.FormatInt(fID, 10) + nutsdb.DataSuffix
+}
+
+// printReport prints the problems found in the report.
+func printReport(w io.Writer, report *nutsdb.VerifyReport) {
+	fmt.Fprintf(w, "%d data files, %d entries, %d orphaned entries\n", report.DataFiles, report.Entries, report.OrphanedEntries)
+
+	for _, c := range report.Corruptions {
+		fmt.Fprintf(w, "%s: corrupted entry at offset %d: %v\n", dataFileName(c.FileID), c.Offset, c.Err)
+	}
+
+	for _, d := range report.DanglingRecords {
+		fmt.Fprintf(w, "%s %s: dangling record at %s offset %d: %v\n",
+			d.Bucket, strconv.Quote(string(d.Key)), dataFileName(d.FileID), d.Offset, d.Err)
+	}
+
+	for _, path := range report.Quarantined {
+		fmt.Fprintf(w, "%s: quarantined\n", path)
+	}
+}
+
+func segments(w io.Writer, opt nutsdb.Options, args []string) error {
+	if err := checkArgs(args, 0, 0); err != nil {
+		return err
+	}
+
+	report, err := withReport(opt, (*nutsdb.DB).Verify)
+	if err != nil {
+		return err
+	}
+
+	corrupted := make(map[int64]int64, len(report.Corruptions))
+	for _, c := range report.Corruptions {
+		corrupted[c.FileID] = c.Offset
+	}
+
+	fmt.Fprintf(w, "%-16s %10s %12s\n", "FILE", "ENTRIES", "BYTES")
+	for _, f := range report.Files {
+		fmt.Fprintf(w, "%-16s %10d %12d", dataFileName(f.FileID), f.Entries, f.Size)
+		if off, ok := corrupted[f.FileID]; ok {
+			fmt.Fprintf(w, "  corrupted at offset %d", off)
+		}
+		fmt.Fprintln(w)
+	}
+
+	return nil
+}
+
+func verify(w io.Writer, opt nutsdb.Options, args []string) error {
+	if err := checkArgs(args, 0, 0); err != nil {
+		return err
+	}
+
+	report, err := withReport(opt, (*nutsdb.DB).Verify)
+	if err != nil {
+		return err
+	}
+
+	printReport(w, report)
+
+	if !report.Healthy() {
+		return fmt.Errorf("%d corrupted data files and %d dangling records, run recover to repair them",
+			len(report.Corruptions), len(report.DanglingRecords))
+	}
+
+	return nil
+}
+
+func recoverDB(w io.Writer, opt nutsdb.Options, args []string) error {
+	if err := checkArgs(args, 0, 0); err != nil {
+		return err
+	}
+
+	report, err := withReport(opt, (*nutsdb.DB).Repair)
+	if err != nil {
+		return err
+	}
+
+	printReport(w, report)
+
+	return nil
+}
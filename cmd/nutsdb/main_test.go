@@ -0,0 +1,147 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func runCmd(dir string, args ...string) (string, error) {
+	var out bytes.Buffer
+	err := run(append([]string{"-dir", dir, "-segment-size", "512"}, args...), &out)
+	return out.String(), err
+}
+
+func mustRun(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+
+	out, err := runCmd(dir, args...)
+	if err != nil {
+		t.Fatalf("err %v, got %v: %s", args, err, out)
+	}
+
+	return out
+}
+
+func TestCommands(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nutsdbtestcmd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for i := 0; i < 10; i++ {
+		mustRun(t, dir, "set", "bucket1", "key_"+strconv.Itoa(i), "val_"+strconv.Itoa(i))
+	}
+	mustRun(t, dir, "set", "-ttl", "60", "bucket2", "key", "val")
+
+	if out := mustRun(t, dir, "buckets"); out != "bucket1\nbucket2\n" {
+		t.Fatalf("err buckets, got %q", out)
+	}
+	if out := mustRun(t, dir, "keys", "bucket1", "key_1"); out != "\"key_1\"\n" {
+		t.Fatalf("err keys, got %q", out)
+	}
+	if out := mustRun(t, dir, "keys", "bucket1"); strings.Count(out, "\n") != 10 {
+		t.Fatalf("err keys, got %q", out)
+	}
+	if out := mustRun(t, dir, "get", "bucket1", "key_5"); out != "val_5\n" {
+		t.Fatalf("err get, got %q", out)
+	}
+
+	mustRun(t, dir, "delete", "bucket1", "key_5")
+	if _, err := runCmd(dir, "get", "bucket1", "key_5"); err == nil {
+		t.Fatal("err get the deleted key")
+	}
+	if _, err := runCmd(dir, "delete", "bucket1", "key_5"); err == nil {
+		t.Fatal("err delete the deleted key")
+	}
+
+	if out := mustRun(t, dir, "verify"); !strings.Contains(out, "12 entries, 0 orphaned entries") || strings.Contains(out, "corrupted") {
+		t.Fatalf("err verify, got %q", out)
+	}
+	out := mustRun(t, dir, "segments")
+	if lines := strings.Split(strings.TrimSpace(out), "\n"); len(lines) < 3 || !strings.HasPrefix(lines[1], "0.dat") {
+		t.Fatalf("err segments, got %q", out)
+	}
+
+	if _, err := runCmd(dir, "unknown"); err != errUsage {
+		t.Fatalf("err unknown command, got %v", err)
+	}
+	if _, err := runCmd(dir, "get", "bucket1"); err == nil {
+		t.Fatal("err wrong number of arguments")
+	}
+}
+
+func TestCommands_Corrupted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nutsdbtestcmdcorrupted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for i := 0; i < 10; i++ {
+		mustRun(t, dir, "set", "bucket1", "key_"+strconv.Itoa(i), "val_"+strconv.Itoa(i))
+	}
+
+	// flip the first byte of the crc of the first entry of the first data file.
+	f, err := os.OpenFile(dir+"/0.dat", os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 1)
+	if _, err := f.ReadAt(b, 0); err != nil {
+		t.Fatal(err)
+	}
+	b[0] ^= 0xff
+	if _, err := f.WriteAt(b, 0); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	if _, err := runCmd(dir, "buckets"); err == nil {
+		t.Fatal("err open the corrupted database")
+	}
+
+	out, err := runCmd(dir, "verify")
+	if err == nil || !strings.Contains(out, "0.dat: corrupted entry at offset 0") {
+		t.Fatalf("err verify, got %v: %q", err, out)
+	}
+	if out := mustRun(t, dir, "segments"); !strings.Contains(out, "corrupted at offset 0") {
+		t.Fatalf("err segments, got %q", out)
+	}
+
+	out = mustRun(t, dir, "recover")
+	if !strings.Contains(out, "0.dat: quarantined") {
+		t.Fatalf("err recover, got %q", out)
+	}
+	if _, err := os.Stat(dir + "/quarantine/0.dat"); err != nil {
+		t.Fatal(err)
+	}
+
+	if out := mustRun(t, dir, "verify"); strings.Contains(out, "corrupted") {
+		t.Fatalf("err verify after recover, got %q", out)
+	}
+	if out := mustRun(t, dir, "get", "bucket1", "key_9"); out != "val_9\n" {
+		t.Fatalf("err get after recover, got %q", out)
+	}
+	if _, err := runCmd(dir, "get", "bucket1", "key_0"); err == nil {
+		t.Fatal("err get the key of the quarantined data file")
+	}
+}
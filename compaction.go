@@ -0,0 +1,126 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// MergeStats records the counters of the merges since the db is opened.
+type MergeStats struct {
+	// MergedFiles represents the number of the data files merged.
+	MergedFiles uint64
+
+	// ReclaimedBytes represents the size of the entries of the merged data files which are not
+	// rewritten: the dead entries, the tombstones and the expired entries dropped, and the commit records.
+	ReclaimedBytes uint64
+
+	// DroppedTombstones represents the number of the tombstones dropped by the merges: the deletes,
+	// the pops and the removals of the entries.
+	DroppedTombstones uint64
+
+	// DroppedExpired represents the number of the expired entries dropped by the merges.
+	DroppedExpired uint64
+
+	// RetainedTombstones represents the number of the tombstones rewritten by the merges, see TombstoneRetention.
+	RetainedTombstones uint64
+
+	// RetainedExpired represents the number of the expired entries rewritten by the merges, see ExpiredRetention.
+	RetainedExpired uint64
+}
+
+// mergeCounts records the counters of MergeStats for a merged data file.
+type mergeCounts struct {
+	reclaimedBytes     int64
+	droppedTombstones  uint64
+	droppedExpired     uint64
+	retainedTombstones uint64
+	retainedExpired    uint64
+}
+
+// isTombstone checks if the entry records the delete of an entry, the merge drops it.
+func isTombstone(entry *Entry) bool {
+	switch entry.Meta.Flag {
+	case DataDeleteFlag, DataRPopFlag, DataLPopFlag, DataLRemFlag, DataLTrimFlag,
+		DataZRemFlag, DataZRemRangeByRankFlag, DataZPopMaxFlag, DataZPopMinFlag:
+		return true
+	}
+
+	return false
+}
+
+// retainsEntry checks if the merge rewrites the tombstone or the expired entry, the last entry
+// of its key in the B+ tree, as set by TombstoneRetention and ExpiredRetention. The tombstones
+// and the expired entries of the other data structures are always dropped.
+func (db *DB) retainsEntry(entry *Entry, now time.Time, counts *mergeCounts) bool {
+	if entry.Meta.ds != DataStructureBPTree {
+		return false
+	}
+
+	if r, _ := db.getRecordFromKey(entry.Meta.bucket, entry.Key); r == nil {
+		return false
+	}
+
+	committed := time.Unix(int64(entry.Meta.timestamp), 0)
+
+	if isTombstone(entry) {
+		if entry.Meta.Flag == DataDeleteFlag && now.Sub(committed) < db.opt.TombstoneRetention {
+			counts.retainedTombstones++
+			return true
+		}
+		return false
+	}
+
+	expired := committed.Add(time.Duration(entry.Meta.TTL) * time.Second)
+	if entry.Meta.Flag == DataSetFlag && now.Sub(expired) < db.opt.ExpiredRetention {
+		counts.retainedExpired++
+		return true
+	}
+
+	return false
+}
+
+// dropEntry counts the tombstone or the expired entry dropped by the merge.
+func (c *mergeCounts) dropEntry(entry *Entry) {
+	if isTombstone(entry) {
+		c.droppedTombstones++
+	} else {
+		c.droppedExpired++
+	}
+}
+
+func (db *DB) observeMerge(c *mergeCounts) {
+	atomic.AddUint64(&db.metrics.mergedFiles, 1)
+	if c.reclaimedBytes > 0 {
+		atomic.AddUint64(&db.metrics.reclaimedBytes, uint64(c.reclaimedBytes))
+	}
+	atomic.AddUint64(&db.metrics.droppedTombstones, c.droppedTombstones)
+	atomic.AddUint64(&db.metrics.droppedExpired, c.droppedExpired)
+	atomic.AddUint64(&db.metrics.retainedTombstones, c.retainedTombstones)
+	atomic.AddUint64(&db.metrics.retainedExpired, c.retainedExpired)
+}
+
+// mergeStats returns a snapshot of the merge counters.
+func (db *DB) mergeStats() MergeStats {
+	return MergeStats{
+		MergedFiles:        atomic.LoadUint64(&db.metrics.mergedFiles),
+		ReclaimedBytes:     atomic.LoadUint64(&db.metrics.reclaimedBytes),
+		DroppedTombstones:  atomic.LoadUint64(&db.metrics.droppedTombstones),
+		DroppedExpired:     atomic.LoadUint64(&db.metrics.droppedExpired),
+		RetainedTombstones: atomic.LoadUint64(&db.metrics.retainedTombstones),
+		RetainedExpired:    atomic.LoadUint64(&db.metrics.retainedExpired),
+	}
+}
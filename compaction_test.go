@@ -0,0 +1,171 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"testing"
+	"time"
+)
+
+// mergeRetentionKeys writes the tombstones and the expired keys of the merge retention tests,
+// committed an hour or two ago, then seals the active file so that they are merged.
+func mergeRetentionKeys(t *testing.T, bucket string) {
+	t.Helper()
+
+	hourAgo := uint64(time.Now().Add(-time.Hour).Unix())
+	twoHoursAgo := uint64(time.Now().Add(-2 * time.Hour).Unix())
+
+	if err := db.Update(func(tx *Tx) error {
+		for _, key := range []string{"live", "deleted", "old_deleted", "expired", "old_expired"} {
+			if err := tx.Put(bucket, []byte(key), []byte("val"), Persistent); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Update(func(tx *Tx) error {
+		if err := tx.put(bucket, []byte("deleted"), nil, Persistent, DataDeleteFlag, hourAgo, DataStructureBPTree); err != nil {
+			return err
+		}
+		if err := tx.put(bucket, []byte("old_deleted"), nil, Persistent, DataDeleteFlag, twoHoursAgo, DataStructureBPTree); err != nil {
+			return err
+		}
+		if err := tx.put(bucket, []byte("expired"), []byte("val"), 1, DataSetFlag, hourAgo, DataStructureBPTree); err != nil {
+			return err
+		}
+		return tx.put(bucket, []byte("old_expired"), []byte("val"), 1, DataSetFlag, twoHoursAgo, DataStructureBPTree)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	db.mu.Lock()
+	err := db.sealActiveFile()
+	db.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// dataFileKeys returns the flags of the entries of the keys in the data files.
+func dataFileKeys(t *testing.T) map[string][]uint16 {
+	t.Helper()
+
+	keys := make(map[string][]uint16)
+	_, fIDs := db.getMaxFileIDAndFileIDs()
+	for _, fID := range fIDs {
+		f, err := NewDataFile(db.getDataPath(int64(fID)), db.opt.SegmentSize, FileIO)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for off := int64(0); ; {
+			e, err := f.ReadAt(int(off))
+			if err != nil || e == nil {
+				break
+			}
+			if !isTxCommitEntry(e) && !isMergedFileEntry(e) {
+				keys[string(e.Key)] = append(keys[string(e.Key)], e.Meta.Flag)
+			}
+			off += e.Size()
+		}
+		f.rwManager.Close()
+	}
+
+	return keys
+}
+
+func TestDB_MergeDropsTombstones(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestmergeretention", true)
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mergeRetentionKeys(t, "bucket")
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := dataFileKeys(t)
+	if len(keys) != 1 || len(keys["live"]) != 1 {
+		t.Errorf("err keys after merge, got %v", keys)
+	}
+
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.MergedFiles != 2 || stats.DroppedTombstones != 2 || stats.DroppedExpired != 2 ||
+		stats.RetainedTombstones != 0 || stats.RetainedExpired != 0 {
+		t.Errorf("err merge stats, got %+v", stats.MergeStats)
+	}
+	if stats.ReclaimedBytes == 0 {
+		t.Error("err ReclaimedBytes, got 0")
+	}
+}
+
+func TestDB_MergeRetention(t *testing.T) {
+	bucket := "bucket"
+
+	InitOpt("/tmp/nutsdbtestmergeretention", true)
+	opt.TombstoneRetention = 90 * time.Minute
+	opt.ExpiredRetention = 90 * time.Minute
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mergeRetentionKeys(t, bucket)
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := dataFileKeys(t)
+	if len(keys) != 3 || len(keys["live"]) != 1 || len(keys["expired"]) != 1 ||
+		len(keys["deleted"]) != 1 || keys["deleted"][0] != DataDeleteFlag {
+		t.Errorf("err keys after merge, got %v", keys)
+	}
+
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.DroppedTombstones != 1 || stats.DroppedExpired != 1 ||
+		stats.RetainedTombstones != 1 || stats.RetainedExpired != 1 {
+		t.Errorf("err merge stats, got %+v", stats.MergeStats)
+	}
+
+	// the retained entries are still deleted and expired after reopening.
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for key, want := range map[string]error{"live": nil, "deleted": ErrNotFoundKey, "expired": ErrNotFoundKey} {
+		if err := db.View(func(tx *Tx) error {
+			_, err := tx.Get(bucket, []byte(key))
+			return err
+		}); err != want {
+			t.Errorf("err get %s, got %v want %v", key, err, want)
+		}
+	}
+}
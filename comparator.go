@@ -0,0 +1,157 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// ComparatorBucket is the bucket recording the names of the comparators of the buckets
+// of Options.Comparators, the keys are the names of the buckets.
+const ComparatorBucket = "_nutsdb_comparator"
+
+var (
+	// ErrComparatorMismatch is returned by Open when the comparator of a bucket is not the
+	// one recorded with the bucket by a previous Open.
+	ErrComparatorMismatch = errors.New("the comparator of the bucket is not the one recorded with it")
+
+	// ErrComparatorSparseIdxMode is returned by Open when Options.Comparators is set in
+	// HintBPTSparseIdxMode, its indexes on disk are in bytewise order.
+	ErrComparatorSparseIdxMode = errors.New("comparators are not supported in HintBPTSparseIdxMode")
+)
+
+// Comparator represents an order of the keys of a bucket.
+type Comparator struct {
+	// Name identifies the order. It is recorded with the bucket, so that the bucket
+	// is not opened later with another order by mistake.
+	Name string
+
+	// Compare returns -1, 0 or +1 if the key a is before, equal to or after the key b.
+	Compare func(a, b []byte) int
+}
+
+var (
+	// BytewiseComparator orders the keys bytewise, the order of the buckets without a comparator.
+	BytewiseComparator = Comparator{Name: "nutsdb.bytewise", Compare: bytes.Compare}
+
+	// Uint64LEComparator orders the 8-byte keys as little-endian uint64 numbers,
+	// the keys of the other sizes come after them in bytewise order.
+	Uint64LEComparator = Comparator{Name: "nutsdb.uint64le", Compare: compareUint64LE}
+)
+
+func compareUint64LE(a, b []byte) int {
+	switch {
+	case len(a) == 8 && len(b) == 8:
+		x, y := binary.LittleEndian.Uint64(a), binary.LittleEndian.Uint64(b)
+		if x < y {
+			return -1
+		}
+		if x > y {
+			return 1
+		}
+		return 0
+	case len(a) == 8:
+		return -1
+	case len(b) == 8:
+		return 1
+	}
+
+	return bytes.Compare(a, b)
+}
+
+// comparator returns the comparator of the bucket.
+func (db *DB) comparator(bucket string) Comparator {
+	if c, ok := db.opt.Comparators[bucket]; ok && c.Compare != nil {
+		return c
+	}
+
+	return BytewiseComparator
+}
+
+// keyCompare returns the function comparing the keys of the bucket.
+func (db *DB) keyCompare(bucket string) func(a, b []byte) int {
+	return db.comparator(bucket).Compare
+}
+
+// keyCompare returns the function comparing the keys of the bucket, bytewise once the tx is closed.
+func (tx *Tx) keyCompare(bucket string) func(a, b []byte) int {
+	if tx.db == nil {
+		return compare
+	}
+
+	return tx.db.keyCompare(bucket)
+}
+
+// newBucketTree returns a new B+ tree of the keys of the bucket, in the order of its comparator.
+func (db *DB) newBucketTree(bucket string) *BPTree {
+	t := NewTree()
+	if c, ok := db.opt.Comparators[bucket]; ok && c.Compare != nil {
+		t.cmp = c.Compare
+	}
+
+	return t
+}
+
+// loadComparators checks the comparators of the buckets against the ones recorded with them,
+// and records the comparators of the buckets without one.
+func (db *DB) loadComparators() error {
+	if db.opt.EntryIdxMode == HintBPTSparseIdxMode {
+		if len(db.opt.Comparators) > 0 {
+			return ErrComparatorSparseIdxMode
+		}
+		return nil
+	}
+
+	// the db is not used by others yet, the tx is neither locked nor counted in the stats.
+	tx := &Tx{db: db, ctx: context.Background()}
+
+	entries, err := tx.GetAll(ComparatorBucket)
+	if err != nil && !isScanNotFound(err) {
+		return err
+	}
+
+	recorded := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		bucket := string(e.Key)
+		if name := db.comparator(bucket).Name; name != string(e.Value) {
+			return fmt.Errorf("%w: bucket %s, recorded %s, got %s", ErrComparatorMismatch, bucket, e.Value, name)
+		}
+		recorded[bucket] = true
+	}
+
+	var unrecorded []string
+	for bucket := range db.opt.Comparators {
+		if !recorded[bucket] {
+			unrecorded = append(unrecorded, bucket)
+		}
+	}
+
+	if len(unrecorded) == 0 || db.readOnly {
+		return nil
+	}
+
+	return db.Update(func(tx *Tx) error {
+		for _, bucket := range unrecorded {
+			if err := tx.Put(ComparatorBucket, []byte(bucket), []byte(db.comparator(bucket).Name), Persistent); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,155 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func uint64LEKey(n uint64) []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, n)
+	return b
+}
+
+func uint64LEKeys(es Entries) []uint64 {
+	var ns []uint64
+	for _, e := range es {
+		ns = append(ns, binary.LittleEndian.Uint64(e.Key))
+	}
+	return ns
+}
+
+func TestDB_Comparators(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestcomparator", true)
+	opt.Comparators = map[string]Comparator{"bucket": Uint64LEComparator}
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Update(func(tx *Tx) error {
+		for _, n := range []uint64{256, 1, 65536, 2} {
+			if err := tx.Put("bucket", uint64LEKey(n), []byte("val"), Persistent); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(want string) {
+		t.Helper()
+
+		if err := db.View(func(tx *Tx) error {
+			es, err := tx.RangeScan("bucket", uint64LEKey(1), uint64LEKey(65536))
+			if err != nil {
+				return err
+			}
+			if got := fmt.Sprint(uint64LEKeys(es)); got != want {
+				t.Errorf("err RangeScan, got %s want %s", got, want)
+			}
+
+			first, err := tx.FirstKey("bucket")
+			if err != nil {
+				return err
+			}
+			last, err := tx.LastKey("bucket")
+			if err != nil {
+				return err
+			}
+			if binary.LittleEndian.Uint64(first) != 1 || binary.LittleEndian.Uint64(last) != 65536 {
+				t.Errorf("err FirstKey and LastKey, got %x and %x", first, last)
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check("[1 2 256 65536]")
+
+	// the pending writes of the tx are in the order of the bucket.
+	if err := db.Update(func(tx *Tx) error {
+		if err := tx.Put("bucket", uint64LEKey(3), []byte("val"), Persistent); err != nil {
+			return err
+		}
+		if err := tx.Delete("bucket", uint64LEKey(256)); err != nil {
+			return err
+		}
+
+		es, err := tx.RangeScan("bucket", uint64LEKey(2), uint64LEKey(300))
+		if err != nil {
+			return err
+		}
+		if got := fmt.Sprint(uint64LEKeys(es)); got != "[2 3]" {
+			t.Errorf("err RangeScan with pending writes, got %s want %s", got, "[2 3]")
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the index is rebuilt in the order of the bucket.
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("[1 2 3 65536]")
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the bucket is not opened with another comparator.
+	opt.Comparators = nil
+	if _, err := Open(opt); !errors.Is(err, ErrComparatorMismatch) {
+		t.Errorf("err Open without the comparator, got %v want %v", err, ErrComparatorMismatch)
+	}
+}
+
+func TestDB_Comparators_HintBPTSparseIdxMode(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestcomparator", true)
+	opt.EntryIdxMode = HintBPTSparseIdxMode
+	opt.Comparators = map[string]Comparator{"bucket": Uint64LEComparator}
+
+	if _, err := Open(opt); err != ErrComparatorSparseIdxMode {
+		t.Errorf("err Open, got %v want %v", err, ErrComparatorSparseIdxMode)
+	}
+}
+
+func TestUint64LEComparator(t *testing.T) {
+	tests := []struct {
+		a, b []byte
+		want int
+	}{
+		{uint64LEKey(1), uint64LEKey(256), -1},
+		{uint64LEKey(256), uint64LEKey(256), 0},
+		{uint64LEKey(1 << 40), uint64LEKey(2), 1},
+		{uint64LEKey(1 << 40), []byte("a"), -1},
+		{[]byte("b"), []byte("a"), 1},
+	}
+
+	for _, tt := range tests {
+		if got := Uint64LEComparator.Compare(tt.a, tt.b); got != tt.want {
+			t.Errorf("err Compare(%x, %x), got %d want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+)
+
+// ErrCompressorNotRegistered is returned when a value is written or read with a codec
+// which has no registered Compressor.
+var ErrCompressorNotRegistered = errors.New("compressor not registered")
+
+// Compression represents the codec used to compress the entry values,
+// it is recorded in the entry metadata so that reading does not depend on the options.
+type Compression uint16
+
+const (
+	// NoCompression represents the values are stored as is.
+	NoCompression Compression = iota
+
+	// DeflateCompression represents the values are compressed with compress/flate.
+	DeflateCompression
+
+	// SnappyCompression represents the values are compressed with snappy,
+	// its Compressor must be registered by RegisterCompressor.
+	SnappyCompression
+
+	// ZstdCompression represents the values are compressed with zstd,
+	// its Compressor must be registered by RegisterCompressor.
+	ZstdCompression
+)
+
+// maxCompression is the largest codec which fits in the entry metadata.
+const maxCompression = 0x1f
+
+// Compressor compresses and decompresses the entry values of a codec.
+type Compressor interface {
+	Compress(src []byte) ([]byte, error)
+	Decompress(src []byte) ([]byte, error)
+}
+
+var (
+	compressorsMu sync.RWMutex
+	compressors   = map[Compression]Compressor{
+		DeflateCompression: deflateCompressor{},
+	}
+)
+
+// RegisterCompressor registers the Compressor of the codec c, it replaces the registered one.
+// It must be called before opening a database using the codec.
+func RegisterCompressor(c Compression, compressor Compressor) {
+	if c == NoCompression || c > maxCompression {
+		panic(fmt.Sprintf("nutsdb: invalid compression %d", c))
+	}
+
+	compressorsMu.Lock()
+	defer compressorsMu.Unlock()
+
+	compressors[c] = compressor
+}
+
+// getCompressor returns the registered Compressor of the codec c.
+func getCompressor(c Compression) (Compressor, error) {
+	compressorsMu.RLock()
+	defer compressorsMu.RUnlock()
+
+	compressor, ok := compressors[c]
+	if !ok {
+		return nil, ErrCompressorNotRegistered
+	}
+
+	return compressor, nil
+}
+
+// deflateCompressor is the Compressor of DeflateCompression.
+type deflateCompressor struct{}
+
+// Compress implements Compressor.
+func (deflateCompressor) Compress(src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	w, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Decompress implements Compressor.
+func (deflateCompressor) Decompress(src []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(src))
+	defer r.Close()
+
+	return ioutil.ReadAll(r)
+}
+
+// compressionOf returns the codec of the bucket, the per-bucket override takes precedence.
+func (opt *Options) compressionOf(bucket string) Compression {
+	if c, ok := opt.BucketCompression[bucket]; ok {
+		return c
+	}
+
+	return opt.Compression
+}
+
+// checkCompression checks that all the configured codecs have a registered Compressor.
+func (opt *Options) checkCompression() error {
+	cs := []Compression{opt.Compression}
+	for _, c := range opt.BucketCompression {
+		cs = append(cs, c)
+	}
+
+	for _, c := range cs {
+		if c == NoCompression {
+			continue
+		}
+		if _, err := getCompressor(c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// compressValue compresses the value with the codec of the bucket, it returns
+// the value as is with NoCompression when compressing does not make it smaller.
+func (opt *Options) compressValue(bucket string, value []byte) ([]byte, Compression, error) {
+	c := opt.compressionOf(bucket)
+	if c == NoCompression || len(value) == 0 {
+		return value, NoCompression, nil
+	}
+
+	compressor, err := getCompressor(c)
+	if err != nil {
+		return nil, NoCompression, err
+	}
+
+	compressed, err := compressor.Compress(value)
+	if err != nil {
+		return nil, NoCompression, err
+	}
+	if len(compressed) >= len(value) {
+		return value, NoCompression, nil
+	}
+
+	return compressed, c, nil
+}
+
+// decompressValue decompresses the value stored with the codec c.
+func decompressValue(c Compression, value []byte) ([]byte, error) {
+	if c == NoCompression {
+		return value, nil
+	}
+
+	compressor, err := getCompressor(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return compressor.Decompress(value)
+}
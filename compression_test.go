@@ -0,0 +1,89 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDB_Compression(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestforcompression", true)
+	opt.Compression = DeflateCompression
+	opt.BucketCompression = map[string]Compression{"bucket_plain": NoCompression}
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	val := bytes.Repeat([]byte("compressible value "), 100)
+	if err := db.Update(func(tx *Tx) error {
+		if err := tx.Put("bucket_compressed", []byte("key"), val, Persistent); err != nil {
+			return err
+		}
+		if err := tx.SAdd("bucket_compressed", []byte("set"), val); err != nil {
+			return err
+		}
+		return tx.Put("bucket_plain", []byte("key"), val, Persistent)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if e, err := db.readEntryAt(0, 0); err != nil || e.Meta.codec != uint16(DeflateCompression) ||
+		int(e.Meta.valueSize) >= len(val) || !bytes.Equal(e.Value, val) {
+		t.Errorf("err compression, the value is not compressed on disk: %v", err)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the codec is read from the entries, not from the options.
+	InitOpt("/tmp/nutsdbtestforcompression", false)
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.View(func(tx *Tx) error {
+		for _, bucket := range []string{"bucket_compressed", "bucket_plain"} {
+			e, err := tx.Get(bucket, []byte("key"))
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(e.Value, val) {
+				t.Errorf("err compression, got a wrong value in %s", bucket)
+			}
+		}
+		if ok, _ := tx.SIsMember("bucket_compressed", []byte("set"), val); !ok {
+			t.Error("err compression, got a wrong set member")
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDB_CompressionNotRegistered(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestforcompression", true)
+	opt.BucketCompression = map[string]Compression{"bucket": ZstdCompression}
+	if _, err := Open(opt); err != ErrCompressorNotRegistered {
+		t.Errorf("err Open, got %v want %v", err, ErrCompressorNotRegistered)
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import "context"
+
+// ctxCheckInterval is the number of records scanned in memory between two checks of the context.
+const ctxCheckInterval = 1024
+
+// BeginCtx opens a new transaction like Begin, bound to ctx: it returns ctx.Err() if ctx is done
+// before the lock of the database is acquired, the scans of the transaction return ctx.Err()
+// once ctx is done, and Commit returns it before writing anything.
+func (db *DB) BeginCtx(ctx context.Context, writable bool) (tx *Tx, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if writable && db.readOnly {
+		return nil, ErrDBReadOnly
+	}
+
+	tx, err = newTx(db, writable)
+	if err != nil {
+		return nil, err
+	}
+	tx.ctx = ctx
+
+	if ctx.Done() == nil {
+		tx.lock()
+	} else {
+		locked := make(chan struct{})
+		go func(tx *Tx) {
+			tx.lock()
+			close(locked)
+		}(tx)
+
+		select {
+		case <-locked:
+		case <-ctx.Done():
+			// the lock is released as soon as it is acquired.
+			go func(tx *Tx) {
+				<-locked
+				tx.unlock()
+			}(tx)
+			return nil, ctx.Err()
+		}
+	}
+
+	if db.closed {
+		tx.unlock()
+		return nil, ErrDBClosed
+	}
+
+	return
+}
+
+// UpdateCtx executes a function within a managed read/write transaction bound to ctx,
+// see BeginCtx.
+func (db *DB) UpdateCtx(ctx context.Context, fn func(tx *Tx) error) error {
+	if fn == nil {
+		return ErrFn
+	}
+
+	return db.managed(ctx, true, fn)
+}
+
+// ViewCtx executes a function within a managed read-only transaction bound to ctx,
+// see BeginCtx.
+func (db *DB) ViewCtx(ctx context.Context, fn func(tx *Tx) error) error {
+	if fn == nil {
+		return ErrFn
+	}
+
+	return db.managed(ctx, false, fn)
+}
+
+// Context returns the context the transaction is bound to, context.Background() if none.
+func (tx *Tx) Context() context.Context {
+	return tx.ctx
+}
+
+// ctxErr returns the error of the context of the tx if it is done.
+func (tx *Tx) ctxErr() error {
+	return tx.ctx.Err()
+}
+
+// ctxErrOr returns the error of the context of the tx if it is done, or err.
+func (tx *Tx) ctxErrOr(err error) error {
+	if ctxErr := tx.ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+
+	return err
+}
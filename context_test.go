@@ -0,0 +1,130 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDB_ViewCtx(t *testing.T) {
+	for _, mode := range []EntryIdxMode{HintKeyValAndRAMIdxMode, HintKeyAndRAMIdxMode, HintBPTSparseIdxMode} {
+		InitOpt("/tmp/nutsdbtestctx", true)
+		opt.EntryIdxMode = mode
+		db, err = Open(opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := db.Update(func(tx *Tx) error {
+			for i := 0; i < 100; i++ {
+				if err := tx.Put("bucket", []byte(fmt.Sprintf("key_%03d", i)), []byte("val"), Persistent); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		if err := db.ViewCtx(ctx, func(tx *Tx) error {
+			if _, err := tx.RangeScan("bucket", []byte("key_000"), []byte("key_099")); err != nil {
+				return err
+			}
+
+			cancel()
+
+			if _, err := tx.RangeScan("bucket", []byte("key_000"), []byte("key_099")); err != context.Canceled {
+				t.Errorf("mode %d: err RangeScan, got %v want %v", mode, err, context.Canceled)
+			}
+			if _, _, err := tx.PrefixScan("bucket", []byte("key_"), 0, ScanNoLimit); err != context.Canceled {
+				t.Errorf("mode %d: err PrefixScan, got %v want %v", mode, err, context.Canceled)
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := db.ViewCtx(ctx, func(tx *Tx) error {
+			t.Errorf("mode %d: err ViewCtx, the tx is begun with a done context", mode)
+			return nil
+		}); err != context.Canceled {
+			t.Errorf("mode %d: err ViewCtx, got %v want %v", mode, err, context.Canceled)
+		}
+
+		db.Close()
+	}
+}
+
+func TestDB_UpdateCtx(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestctx", true)
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// the commit writes nothing once the context is done.
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := db.UpdateCtx(ctx, func(tx *Tx) error {
+		if err := tx.Put("bucket", []byte("key"), []byte("val"), Persistent); err != nil {
+			return err
+		}
+		cancel()
+		return nil
+	}); err != context.Canceled {
+		t.Errorf("err UpdateCtx, got %v want %v", err, context.Canceled)
+	}
+
+	if err := db.View(func(tx *Tx) error {
+		_, err := tx.Get("bucket", []byte("key"))
+		return err
+	}); err == nil {
+		t.Error("err UpdateCtx, the canceled tx is committed")
+	}
+
+	// waiting for the lock stops at the deadline.
+	tx, err := db.Begin(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if err := db.UpdateCtx(ctx, func(tx *Tx) error {
+		return nil
+	}); err != context.DeadlineExceeded {
+		t.Errorf("err UpdateCtx, got %v want %v", err, context.DeadlineExceeded)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("err UpdateCtx, returned after %v", d)
+	}
+
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the lock acquired after the deadline is released.
+	if err := db.Update(func(tx *Tx) error {
+		return tx.Put("bucket", []byte("key"), []byte("val"), Persistent)
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
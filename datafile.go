@@ -28,6 +28,10 @@ var (
 
 	// ErrCapacity is returned when capacity is error.
 	ErrCapacity = errors.New("capacity error")
+
+	// ErrEntryOutOfBound is returned when the entry header points beyond the data file,
+	// it means the header is corrupted.
+	ErrEntryOutOfBound = errors.New("entry out of data file bound")
 )
 
 const (
@@ -44,6 +48,7 @@ type DataFile struct {
 	fileID     int64
 	writeOff   int64
 	ActualSize int64
+	capacity   int64
 	rwManager  RWManager
 }
 
@@ -73,6 +78,7 @@ func NewDataFile(path string, capacity int64, rwMode RWMode) (df *DataFile, err
 		path:       path,
 		writeOff:   0,
 		ActualSize: 0,
+		capacity:   capacity,
 		rwManager:  rwManager,
 	}, nil
 }
@@ -96,6 +102,10 @@ func (df *DataFile) ReadAt(off int) (e *Entry, err error) {
 		return nil, nil
 	}
 
+	if int64(off)+e.Size() > df.capacity {
+		return nil, ErrEntryOutOfBound
+	}
+
 	// read bucket
 	off += DataEntryHeaderSize
 	bucketBuf := make([]byte, meta.bucketSize)
@@ -133,12 +143,47 @@ func (df *DataFile) ReadAt(off int) (e *Entry, err error) {
 	return
 }
 
+// readEntrySize returns the size of the entry at the given off from its header, without reading
+// nor checking the entry, or 0 at the end of the entries.
+func (df *DataFile) readEntrySize(off int64) (int64, error) {
+	buf := make([]byte, DataEntryHeaderSize)
+
+	if _, err := df.rwManager.ReadAt(buf, off); err != nil {
+		return 0, err
+	}
+
+	e := &Entry{crc: binary.LittleEndian.Uint32(buf[0:4]), Meta: readMetaData(buf)}
+	if e.IsZero() {
+		return 0, nil
+	}
+
+	if off+e.Size() > df.capacity {
+		return 0, ErrEntryOutOfBound
+	}
+
+	return e.Size(), nil
+}
+
 // WriteAt copies data to mapped region from the b slice starting at
 // given off and returns number of bytes copied to the mapped region.
 func (df *DataFile) WriteAt(b []byte, off int64) (n int, err error) {
 	return df.rwManager.WriteAt(b, off)
 }
 
+// truncateAt discards the data from given off to the end of the data file,
+// it zeroes the bytes so that reading at off returns no entry.
+func (df *DataFile) truncateAt(off int64) (err error) {
+	if off >= df.capacity {
+		return nil
+	}
+
+	if _, err = df.rwManager.WriteAt(make([]byte, df.capacity-off), off); err != nil {
+		return err
+	}
+
+	return df.rwManager.Sync()
+}
+
 // Sync commits the current contents of the file to stable storage.
 // Typically, this means flushing the file system's in-memory copy
 // of recently written data to disk.
@@ -164,8 +209,12 @@ func readMetaData(buf []byte) *MetaData {
 		Flag:       binary.LittleEndian.Uint16(buf[20:22]),
 		TTL:        binary.LittleEndian.Uint32(buf[22:26]),
 		bucketSize: binary.LittleEndian.Uint32(buf[26:30]),
-		status:     binary.LittleEndian.Uint16(buf[30:32]),
-		ds:         binary.LittleEndian.Uint16(buf[32:34]),
+		status:     binary.LittleEndian.Uint16(buf[30:32]) & 0xff,
+		codec:      binary.LittleEndian.Uint16(buf[30:32]) >> 8 & 0x1f,
+		merged:     binary.LittleEndian.Uint16(buf[30:32]) >> 13 & 1,
+		encryption: binary.LittleEndian.Uint16(buf[30:32]) >> 14,
+		ds:         binary.LittleEndian.Uint16(buf[32:34]) & 0x7fff,
+		overflow:   binary.LittleEndian.Uint16(buf[32:34]) >> 15,
 		txID:       binary.LittleEndian.Uint64(buf[34:42]),
 	}
 }
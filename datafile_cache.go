@@ -0,0 +1,132 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"container/list"
+	"sync"
+)
+
+// cachedDataFile records a data file opened for reading and its reference count.
+type cachedDataFile struct {
+	fID  int64
+	df   *DataFile
+	refs int
+	elem *list.Element
+}
+
+// dataFileCache caches the data files opened for reading, so that the read
+// paths do not open and close (or map and unmap) a data file on every read.
+// The least recently used data files are closed when more than maxSize
+// files are open, a data file in use is closed once it is released.
+type dataFileCache struct {
+	mu      sync.Mutex
+	maxSize int
+	open    func(fID int64) (*DataFile, error)
+	items   map[int64]*cachedDataFile
+	lru     *list.List // front is the most recently used
+}
+
+// newDataFileCache returns a newly initialized dataFileCache object.
+func newDataFileCache(maxSize int, open func(fID int64) (*DataFile, error)) *dataFileCache {
+	return &dataFileCache{
+		maxSize: maxSize,
+		open:    open,
+		items:   make(map[int64]*cachedDataFile),
+		lru:     list.New(),
+	}
+}
+
+// acquire returns the data file at given fID, opening it if needed.
+// Every acquire must be paired with a release.
+func (c *dataFileCache) acquire(fID int64) (*DataFile, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if item, ok := c.items[fID]; ok {
+		item.refs++
+		c.lru.MoveToFront(item.elem)
+		return item.df, nil
+	}
+
+	df, err := c.open(fID)
+	if err != nil {
+		return nil, err
+	}
+
+	item := &cachedDataFile{fID: fID, df: df, refs: 1}
+	item.elem = c.lru.PushFront(item)
+	c.items[fID] = item
+
+	c.evict()
+
+	return df, nil
+}
+
+// release releases the data file at given fID acquired before.
+func (c *dataFileCache) release(fID int64, df *DataFile) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if item, ok := c.items[fID]; ok && item.df == df {
+		item.refs--
+		c.evict()
+		return
+	}
+
+	// the data file was evicted while in use.
+	_ = df.rwManager.Close()
+}
+
+// remove closes and forgets the data file at given fID, it is called when the data file is removed.
+func (c *dataFileCache) remove(fID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if item, ok := c.items[fID]; ok {
+		c.drop(item)
+	}
+}
+
+// close closes all the data files in the cache.
+func (c *dataFileCache) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, item := range c.items {
+		c.drop(item)
+	}
+}
+
+// evict drops the least recently used data files until the cache is not over the maxSize.
+func (c *dataFileCache) evict() {
+	for e := c.lru.Back(); e != nil && c.lru.Len() > c.maxSize; {
+		prev := e.Prev()
+		if item := e.Value.(*cachedDataFile); item.refs <= 0 {
+			c.drop(item)
+		}
+		e = prev
+	}
+}
+
+// drop removes the item from the cache, the data file is closed by the last release if it is in use.
+func (c *dataFileCache) drop(item *cachedDataFile) {
+	c.lru.Remove(item.elem)
+	delete(c.items, item.fID)
+
+	if item.refs <= 0 {
+		_ = item.df.rwManager.Close()
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"os"
+	"testing"
+
+	"github.com/xujiajun/utils/strconv2"
+)
+
+func TestDataFileCache(t *testing.T) {
+	dir := "/tmp/nutsdbtestdatafilecache"
+	os.RemoveAll(dir)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	opened := 0
+	cache := newDataFileCache(2, func(fID int64) (*DataFile, error) {
+		opened++
+		return NewDataFile(dir+"/"+strconv2.Int64ToStr(fID)+DataSuffix, 1024, FileIO)
+	})
+
+	df0, err := cache.acquire(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	df0Again, err := cache.acquire(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if df0 != df0Again || opened != 1 {
+		t.Errorf("err acquire, the cached data file should be reused, opened %d", opened)
+	}
+
+	cache.release(0, df0)
+	cache.release(0, df0Again)
+
+	for fID := int64(1); fID <= 2; fID++ {
+		df, err := cache.acquire(fID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cache.release(fID, df)
+	}
+
+	if _, ok := cache.items[0]; ok {
+		t.Error("err evict, the least recently used data file should be closed")
+	}
+
+	if cache.lru.Len() != 2 {
+		t.Errorf("err evict, got %d open files want %d", cache.lru.Len(), 2)
+	}
+
+	df1, err := cache.acquire(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache.remove(1)
+
+	if _, err := df1.ReadAt(0); err != nil {
+		t.Error("err remove, the data file in use should not be closed", err)
+	}
+
+	cache.release(1, df1)
+
+	if _, err := df1.ReadAt(0); err == nil {
+		t.Error("err release, the removed data file should be closed")
+	}
+
+	cache.close()
+
+	if cache.lru.Len() != 0 {
+		t.Errorf("err close, got %d open files want %d", cache.lru.Len(), 0)
+	}
+}
@@ -15,6 +15,8 @@
 package nutsdb
 
 import (
+	"context"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
@@ -24,7 +26,10 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/bwmarrin/snowflake"
+	"github.com/xujiajun/nutsdb/ds/bitmap"
 	"github.com/xujiajun/nutsdb/ds/list"
 	"github.com/xujiajun/nutsdb/ds/set"
 	"github.com/xujiajun/nutsdb/ds/zset"
@@ -36,8 +41,11 @@ var (
 	// ErrDBClosed is returned when db is closed.
 	ErrDBClosed = errors.New("db is closed")
 
-	// ErrBucket is returned when bucket is not in the HintIdx.
-	ErrBucket = errors.New("err bucket")
+	// ErrDBReadOnly is returned when writing to a db opened read-only.
+	ErrDBReadOnly = errors.New("db is read-only")
+
+	// ErrBucket is returned when bucket is not in the HintIdx, it wraps ErrBucketNotFound.
+	ErrBucket = fmt.Errorf("err bucket: %w", ErrBucketNotFound)
 
 	// ErrEntryIdxModeOpt is returned when set db EntryIdxMode option is wrong.
 	ErrEntryIdxModeOpt = errors.New("err EntryIdxMode option set")
@@ -47,6 +55,12 @@ var (
 
 	// ErrBucketNotFound is returned when looking for bucket that does not exist
 	ErrBucketNotFound = errors.New("bucket not found")
+
+	// ErrIsMerging is returned when merge is called while another merge is in progress.
+	ErrIsMerging = errors.New("merge is in progress")
+
+	// ErrNotEnoughFilesToMerge is returned when the number of files waiting to be merged is less than 2.
+	ErrNotEnoughFilesToMerge = errors.New("the number of files waiting to be merged is at least 2")
 )
 
 const (
@@ -91,6 +105,18 @@ const (
 
 	// DataZPopMinFlag represents the data aZPopMin flag
 	DataZPopMinFlag
+
+	// DataLInsertFlag represents the data LInsertBefore and LInsertAfter flag
+	DataLInsertFlag
+
+	// DataSetBitFlag represents the data SetBit flag of a set bit
+	DataSetBitFlag
+
+	// DataClearBitFlag represents the data SetBit flag of a cleared bit
+	DataClearBitFlag
+
+	// DataBitmapStoreFlag represents the data flag of a whole bitmap, written by BitOp and Merge
+	DataBitmapStoreFlag
 )
 
 const (
@@ -119,6 +145,17 @@ const (
 
 	// DataStructureList represents the data structure list flag
 	DataStructureList
+
+	// DataStructureTxCommit represents the commit record of a tx, it is not a data structure
+	// and it is not indexed.
+	DataStructureTxCommit
+
+	// DataStructureBitmap represents the data structure bitmap flag
+	DataStructureBitmap
+
+	// DataStructureMergedFile represents the record of a data file merged by a tx, it is not
+	// a data structure and it is not indexed.
+	DataStructureMergedFile
 )
 
 type (
@@ -132,6 +169,7 @@ type (
 		SetIdx                  SetIdx
 		SortedSetIdx            SortedSetIdx
 		ListIdx                 ListIdx
+		BitmapIdx               BitmapIdx
 		ActiveFile              *DataFile
 		ActiveBPTreeIdx         *BPTree
 		ActiveCommittedTxIdsIdx *BPTree
@@ -141,6 +179,46 @@ type (
 		KeyCount                int // total key number ,include expired, deleted, repeated.
 		closed                  bool
 		isMerging               bool
+		fileCache               *dataFileCache // data files opened for reading
+		overflowCache           *dataFileCache // overflow files opened for reading
+		bptNodeCache            *bptNodeCache  // nodes of the b+ trees on disk, nil if disabled
+		entryCache              *entryCache    // entries read from the data files, nil if disabled
+		indexMemory             indexMemory    // estimated memory of the B+ tree indexes
+		closeCh                 chan struct{}  // closed when the db is closed, to stop the background workers
+		wg                      sync.WaitGroup
+		onExpire                ExpireFunc
+		hooks                   txHooks
+		watchMu                 sync.Mutex
+		watchers                map[*Watcher]struct{}
+		commitSeq               uint64 // the sequence of the committed read/write txs
+		syncedSeq               uint64 // the commit sequence synced to the disk by the last sync
+		groupSync               *groupSync
+		snapMu                  sync.Mutex
+		snapshotSeqs            map[uint64]int                        // the commit sequences of the open snapshot txs
+		mergedFiles             []mergedFile                          // the merged data files kept for the open snapshot txs
+		cipher                  *entryCipher                          // nil if the encryption is disabled
+		secondaryIdxes          map[string]map[string]*secondaryIndex // bucket -> index name -> index
+		txIDNode                *snowflake.Node                       // generates the tx ids, unique within the node
+		metrics                 *txMetrics
+		unsyncedCommits         int              // the commits not synced yet with SyncEveryN or SyncInterval
+		unsyncedBytes           int64            // the bytes of the commits not synced yet, see MaxPendingCommitBytes
+		checkpointMu            sync.Mutex       // serializes the writes of the checkpoint file
+		commitCh                chan struct{}    // closed when a tx commits, to wake up the replication streams and the blocking pops
+		eviction                *evictionTracker // nil if no bucket has an eviction policy
+		tenants                 *tenantTracker   // nil if no tenant has a quota
+		recycleMu               sync.Mutex
+		recycledFiles           []string          // the dead data files kept for reuse, see RecycleSegments
+		readOnly                bool              // opened with ReadOnly or by OpenSnapshot, the writes are rejected
+		activeCorrupted         bool              // the active file is corrupted and opened with OpenCorrupted, it is sealed
+		readersLock             *os.File          // the shared lock of the readers held when readOnly
+		dirLock                 *os.File          // the exclusive lock of the writer held unless readOnly
+		mergedEnds              map[int64]int64   // the end of the entries of the merged data files, see ChangesSince
+		overflowFile            *overflowFile     // the overflow file of the active data file, nil until a value overflows
+		bucketTTLs              map[string]uint32 // the TTLs of the buckets, see SetBucketTTL
+		bucketWrites            map[string]uint64 // the unix time of the last writes to the buckets with a TTL
+
+		// bucket -> member -> the unix time the member of the sorted set expires at, see ZAddWithTTL
+		zsetDeadlines map[string]map[string]uint64
 	}
 
 	// BPTreeIdx represents the B+ tree index
@@ -155,7 +233,10 @@ type (
 	// ListIdx represents the list index
 	ListIdx map[string]*list.List
 
-	// Entries represents entries
+	// BitmapIdx represents the bitmap index
+	BitmapIdx map[string]*bitmap.Bitmaps
+
+	// Entries represents entries, in the order of the keys of the scan returning them
 	Entries []*Entry
 
 	// BucketMetasIdx represents the index of the bucket's meta-information
@@ -164,11 +245,38 @@ type (
 
 // Open returns a newly initialized DB object.
 func Open(opt Options) (*DB, error) {
+	// the db opened read-only writes nothing, it only reads the data files of the writer.
+	if opt.ReadOnly {
+		opt.MergeInterval = 0
+		opt.ExpireInterval = 0
+		opt.CheckpointInterval = 0
+		opt.TruncateOnCorruption = false
+		opt.StartFileLoadingMode = FileIO
+	}
+
+	// the db in memory has no file, its data files are kept by a MemoryBackend.
+	if opt.InMemory {
+		if opt.EntryIdxMode == HintBPTSparseIdxMode {
+			return nil, ErrInMemorySparseIdxMode
+		}
+		if opt.Dir == "" {
+			opt.Dir = inMemoryDir
+		}
+		opt.Backend = NewMemoryBackend()
+		opt.ReadOnly = false
+		opt.CheckpointInterval = 0
+	}
+
+	if opt.EntryIdxMode == HintBPTSparseIdxMode && len(opt.BucketEviction) > 0 {
+		return nil, ErrEvictionSparseIdxMode
+	}
+
 	db := &DB{
 		BPTreeIdx:               make(BPTreeIdx),
 		SetIdx:                  make(SetIdx),
 		SortedSetIdx:            make(SortedSetIdx),
 		ListIdx:                 make(ListIdx),
+		BitmapIdx:               make(BitmapIdx),
 		ActiveBPTreeIdx:         NewTree(),
 		MaxFileID:               0,
 		opt:                     opt,
@@ -178,73 +286,219 @@ func Open(opt Options) (*DB, error) {
 		BPTreeKeyEntryPosMap:    make(map[string]int64),
 		bucketMetas:             make(map[string]*BucketMeta),
 		ActiveCommittedTxIdsIdx: NewTree(),
+		closeCh:                 make(chan struct{}),
+		commitCh:                make(chan struct{}),
+		watchers:                make(map[*Watcher]struct{}),
+		snapshotSeqs:            make(map[uint64]int),
+		secondaryIdxes:          make(map[string]map[string]*secondaryIndex),
+		metrics:                 &txMetrics{},
+		groupSync:               newGroupSync(),
+		readOnly:                opt.ReadOnly,
+		bucketTTLs:              make(map[string]uint32),
+		bucketWrites:            make(map[string]uint64),
+		zsetDeadlines:           make(map[string]map[string]uint64),
+	}
+
+	db.cipher = newEntryCipher(opt.Encryption)
+
+	db.fileCache = newDataFileCache(opt.MaxOpenFiles, func(fID int64) (*DataFile, error) {
+		return db.openDataFile(db.getDataPath(fID), db.opt.RWMode)
+	})
+	db.overflowCache = newDataFileCache(opt.MaxOpenFiles, db.openOverflowFile)
+
+	if opt.EntryIdxMode == HintBPTSparseIdxMode && opt.IndexCacheSize > 0 {
+		db.bptNodeCache = newBPTNodeCache(opt.IndexCacheSize)
+	}
+
+	if opt.EntryIdxMode != HintKeyValAndRAMIdxMode && opt.EntryCacheSize > 0 {
+		db.entryCache = newEntryCache(opt.EntryCacheSize)
+	}
+
+	if _, ok := opt.Backend.(*ObjectBackend); ok && !opt.ReadOnly {
+		return nil, ErrBackendReadOnly
+	}
+
+	if err := db.lock(); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+
+	if err := db.load(); err != nil {
+		db.unlock()
+		db.logger().Error("opening the database", "dir", opt.Dir, "err", err)
+		return nil, err
+	}
+
+	if err := db.checkRecovery(); err != nil {
+		db.unlock()
+		db.logger().Error("checking the database", "dir", opt.Dir, "err", err)
+		return nil, err
+	}
+
+	if err := db.loadBucketTTLs(); err != nil {
+		db.unlock()
+		return nil, err
+	}
+
+	db.eviction = db.newEvictionTracker()
+	db.tenants = db.newTenantTracker()
+
+	if err := db.loadComparators(); err != nil {
+		db.unlock()
+		return nil, err
+	}
+
+	db.startWorkers()
+
+	db.logger().Info("database opened", "dir", opt.Dir, "maxFileID", db.MaxFileID, "entries", db.KeyCount, "took", time.Since(start))
+
+	return db, nil
+}
+
+// lock takes the lock of the dir, none in memory, the shared lock of the readers if the db is opened read-only,
+// else the exclusive lock of the writer, after creating the dir if it is missing.
+func (db *DB) lock() error {
+	if db.opt.InMemory {
+		return nil
+	}
+
+	if db.readOnly {
+		return db.lockReaders()
 	}
 
 	if ok := filesystem.PathIsExist(db.opt.Dir); !ok {
 		if err := os.MkdirAll(db.opt.Dir, os.ModePerm); err != nil {
-			return nil, err
+			return err
+		}
+	}
+
+	return db.lockDir()
+}
+
+// unlock releases the lock of the dir taken by lock.
+func (db *DB) unlock() {
+	db.unlockReaders()
+	db.unlockDir()
+}
+
+// load checks the options against the files of the dir and builds the indexes from the files.
+func (db *DB) load() error {
+	opt := db.opt
+
+	// the data files of the other backends are removed, not recycled.
+	if !db.readOnly && db.opt.Backend == nil {
+		if err := db.loadRecycledFiles(); err != nil {
+			return err
 		}
 	}
 
+	if err := db.opt.checkCompression(); err != nil {
+		return err
+	}
+
+	// the tx ids are generated by one node so that two txs never get the same id.
+	node, err := snowflake.NewNode(opt.NodeNum)
+	if err != nil {
+		return err
+	}
+	db.txIDNode = node
+
+	if opt.Encryption != nil && opt.Encryption.KeyProvider == nil {
+		return ErrEncryptionKeyNotFound
+	}
+
 	if err := db.checkEntryIdxMode(); err != nil {
-		return nil, err
+		return err
 	}
 
-	if opt.EntryIdxMode == HintBPTSparseIdxMode {
+	if opt.EntryIdxMode == HintBPTSparseIdxMode && !db.readOnly {
 		bptRootIdxDir := db.opt.Dir + "/" + bptDir + "/root"
 		if ok := filesystem.PathIsExist(bptRootIdxDir); !ok {
 			if err := os.MkdirAll(bptRootIdxDir, os.ModePerm); err != nil {
-				return nil, err
+				return err
 			}
 		}
 
 		bptTxIDIdxDir := db.opt.Dir + "/" + bptDir + "/txid"
 		if ok := filesystem.PathIsExist(bptTxIDIdxDir); !ok {
 			if err := os.MkdirAll(bptTxIDIdxDir, os.ModePerm); err != nil {
-				return nil, err
+				return err
 			}
 		}
 
 		bucketMetaDir := db.opt.Dir + "/meta/bucket"
 		if ok := filesystem.PathIsExist(bucketMetaDir); !ok {
 			if err := os.MkdirAll(bucketMetaDir, os.ModePerm); err != nil {
-				return nil, err
+				return err
 			}
 		}
 	}
 
 	if err := db.buildIndexes(); err != nil {
-		return nil, fmt.Errorf("db.buildIndexes error: %s", err)
+		return fmt.Errorf("db.buildIndexes error: %s", err)
 	}
 
-	return db, nil
+	if db.isPersistent() {
+		return db.loadPersisted()
+	}
+
+	return nil
+}
+
+// startWorkers starts the background workers enabled by the options.
+func (db *DB) startWorkers() {
+	if db.opt.MergeInterval > 0 && db.opt.EntryIdxMode != HintBPTSparseIdxMode {
+		db.wg.Add(1)
+		go db.runMergeWorker()
+	}
+
+	if db.opt.ExpireInterval > 0 && db.opt.EntryIdxMode != HintBPTSparseIdxMode {
+		db.wg.Add(1)
+		go db.runExpireWorker()
+	}
+
+	if policy := db.opt.syncPolicy(); policy.mode == syncInterval {
+		db.wg.Add(1)
+		go db.runSyncWorker(policy.interval)
+	}
+
+	if db.opt.CheckpointInterval > 0 && db.opt.EntryIdxMode != HintBPTSparseIdxMode && db.opt.Encryption == nil {
+		db.wg.Add(1)
+		go db.runCheckpointWorker(db.opt.CheckpointInterval)
+	}
+
+	if db.opt.PersistInterval > 0 && db.isPersistent() {
+		db.wg.Add(1)
+		go db.runPersistWorker(db.opt.PersistInterval)
+	}
 }
 
 func (db *DB) checkEntryIdxMode() error {
 	hasDataFlag := false
 	hasBptDirFlag := false
 
+	if db.opt.InMemory {
+		return nil
+	}
+
 	files, err := ioutil.ReadDir(db.opt.Dir)
 	if err != nil {
 		return err
 	}
 
 	for _, f := range files {
-		id := f.Name()
-
-		fileSuffix := path.Ext(path.Base(id))
-		if fileSuffix == DataSuffix {
-			hasDataFlag = true
-			if hasBptDirFlag {
-				break
-			}
-		}
-
-		if id == bptDir {
+		if f.Name() == bptDir {
 			hasBptDirFlag = true
 		}
 	}
 
+	names, err := db.backend().List(db.opt.Dir)
+	if err != nil {
+		return err
+	}
+	hasDataFlag = len(names) > 0
+
 	if db.opt.EntryIdxMode != HintBPTSparseIdxMode && hasDataFlag && hasBptDirFlag {
 		return errors.New("not support HintBPTSparseIdxMode switch to the other EntryIdxMode")
 	}
@@ -262,178 +516,450 @@ func (db *DB) Update(fn func(tx *Tx) error) error {
 		return ErrFn
 	}
 
-	return db.managed(true, fn)
+	return db.managed(context.Background(), true, fn)
+}
+
+// Batch puts the entries within one managed read/write transaction,
+// so they are committed with one log append and one sync.
+func (db *DB) Batch(entries []BatchEntry) error {
+	return db.Update(func(tx *Tx) error {
+		return tx.PutBatch(entries)
+	})
 }
 
 // View executes a function within a managed read-only transaction.
+// Read-only transactions only hold the read lock of the database, so many of
+// them can run concurrently, while a read/write transaction waits for them.
 func (db *DB) View(fn func(tx *Tx) error) error {
 	if fn == nil {
 		return ErrFn
 	}
 
-	return db.managed(false, fn)
+	return db.managed(context.Background(), false, fn)
 }
 
 // Merge removes dirty data and reduce data redundancy,following these steps:
 //
-// 1. Filter delete or expired entry.
+// 1. Seal the active file, so that new writes go to a fresh data file.
+//
+// 2. Filter delete or expired entry.
 //
-// 2. Write entry to activeFile if the key not exist，if exist miss this write operation.
+// 3. Write entry to activeFile if the key not exist，if exist miss this write operation.
 //
-// 3. Filter the entry which is committed.
+// 4. Filter the entry which is committed.
 //
-// 4. At last remove the merged files.
+// 5. At last remove the merged files.
+//
+// Each merged file is rewritten and removed inside one read/write transaction,
+// so the indexes never point at a removed file.
 //
 // Caveat: Merge is Called means starting multiple write transactions, and it
 // will effect the other write request. so execute it at the appropriate time.
 func (db *DB) Merge() error {
-	var (
-		off                 int64
-		pendingMergeFIds    []int
-		pendingMergeEntries []*Entry
-	)
+	var pendingMergeFIds []int
 
 	if db.opt.EntryIdxMode == HintBPTSparseIdxMode {
 		return errors.New("not support mode `HintBPTSparseIdxMode`")
 	}
 
-	db.isMerging = true
+	db.mu.Lock()
+
+	if db.closed {
+		db.mu.Unlock()
+		return ErrDBClosed
+	}
+
+	if db.readOnly {
+		db.mu.Unlock()
+		return ErrDBReadOnly
+	}
+
+	if db.isMerging {
+		db.mu.Unlock()
+		return ErrIsMerging
+	}
+
+	mergeLock, err := db.lockMerge()
+	if err != nil {
+		db.mu.Unlock()
+		return err
+	}
+	defer unlockMerge(mergeLock)
 
-	_, pendingMergeFIds = db.getMaxFileIDAndFileIDs()
+	_, fileIDs := db.getMaxFileIDAndFileIDs()
+	for _, fID := range fileIDs {
+		// skip the merged data files kept for the snapshot txs.
+		if !db.isMergedFile(int64(fID)) {
+			pendingMergeFIds = append(pendingMergeFIds, fID)
+		}
+	}
 
 	if len(pendingMergeFIds) < 2 {
-		db.isMerging = false
-		return errors.New("the number of files waiting to be merged is at least 2")
+		db.mu.Unlock()
+		return ErrNotEnoughFilesToMerge
+	}
+
+	if err := db.sealActiveFile(); err != nil {
+		db.mu.Unlock()
+		return err
 	}
 
+	db.isMerging = true
+
+	// the checkpoint points at the data files to merge, the next one is written after the merge.
+	_ = os.Remove(db.getCheckpointPath())
+
+	db.mu.Unlock()
+
+	defer func() {
+		db.mu.Lock()
+		db.isMerging = false
+		db.mu.Unlock()
+	}()
+
+	db.logger().Info("merge started", "files", len(pendingMergeFIds))
+	start := time.Now()
+
 	for _, pendingMergeFId := range pendingMergeFIds {
-		off = 0
-		f, err := NewDataFile(db.getDataPath(int64(pendingMergeFId)), db.opt.SegmentSize, db.opt.RWMode)
-		if err != nil {
-			db.isMerging = false
+		if err := db.mergeDataFile(int64(pendingMergeFId)); err != nil {
+			db.logger().Error("merge failed", "file", db.getDataPath(int64(pendingMergeFId)), "err", err)
 			return err
 		}
+	}
 
-		pendingMergeEntries = []*Entry{}
+	db.logger().Info("merge finished", "files", len(pendingMergeFIds), "took", time.Since(start))
 
-		for {
-			if entry, err := f.ReadAt(int(off)); err == nil {
-				if entry == nil {
-					break
-				}
+	return nil
+}
 
-				var skipEntry bool
+// sealActiveFile closes the active file and opens a new one.
+// The caller must hold the write lock.
+func (db *DB) sealActiveFile() error {
+	if err := db.ActiveFile.rwManager.Sync(); err != nil {
+		return err
+	}
 
-				if db.isFilterEntry(entry) {
-					skipEntry = true
-				}
+	if err := db.ActiveFile.rwManager.Close(); err != nil {
+		return err
+	}
 
-				// check if we have a new entry with same key and bucket
-				if r, _ := db.getRecordFromKey(entry.Meta.bucket, entry.Key); r != nil && !skipEntry {
-					if r.H.fileID > int64(pendingMergeFId) {
-						skipEntry = true
-					} else if r.H.fileID == int64(pendingMergeFId) && r.H.dataPos > uint64(off) {
-						skipEntry = true
-					}
-				}
+	db.MaxFileID++
 
-				if skipEntry {
-					off += entry.Size()
-					if off >= db.opt.SegmentSize {
-						break
-					}
-					continue
-				}
+	return db.setActiveFile()
+}
 
-				pendingMergeEntries = db.getPendingMergeEntries(entry, pendingMergeEntries)
+// mergeDataFile rewrites the live entries of the data file at given fID
+// to the active file and removes it, within a read/write transaction.
+func (db *DB) mergeDataFile(fID int64) error {
+	var (
+		off                 int64
+		entryNum            int
+		pendingMergeEntries []*Entry
+		bitmapKeys          []bitmapKey
+		seenBitmapKeys      = make(map[bitmapKey]struct{})
+		counts              mergeCounts
+		now                 = time.Now()
+	)
 
-				off += entry.Size()
-				if off >= db.opt.SegmentSize {
-					break
-				}
+	tx, err := db.Begin(true)
+	if err != nil {
+		return err
+	}
+	tx.isMerging = true
 
-			} else {
-				if err == io.EOF {
-					break
-				}
-				f.rwManager.Close()
-				return fmt.Errorf("when merge operation build hintIndex readAt err: %s", err)
+	f, err := db.openDataFile(db.getDataPath(fID), db.opt.RWMode)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for {
+		entry, err := f.ReadAt(int(off))
+		if err != nil {
+			if err == io.EOF {
+				break
 			}
+			f.rwManager.Close()
+			tx.Rollback()
+			return fmt.Errorf("when merge operation build hintIndex readAt err: %s", err)
+		}
+
+		if entry == nil {
+			break
 		}
 
-		if err := db.reWriteData(pendingMergeEntries); err != nil {
+		if err := db.decodeEntry(entry); err != nil {
 			f.rwManager.Close()
+			tx.Rollback()
 			return err
 		}
 
-		if err := os.Remove(db.getDataPath(int64(pendingMergeFId))); err != nil {
-			db.isMerging = false
-			f.rwManager.Close()
-			return fmt.Errorf("when merge err: %s", err)
+		// the commit records are not rewritten, the merge tx has its own. The merged file
+		// records are rewritten only while their data file is kept for the snapshot txs.
+		if isMergedFileEntry(entry) {
+			if mergedFID, ok := mergedFileID(entry.Key); ok && db.isMergedFile(mergedFID) {
+				pendingMergeEntries = append(pendingMergeEntries, entry)
+			}
+		} else if !isTxCommitEntry(entry) {
+			entryNum++
+
+			if entry.Meta.ds == DataStructureBitmap {
+				// the bitmaps are rewritten whole, once for each key.
+				k := bitmapKey{bucket: string(entry.Meta.bucket), key: string(entry.Key)}
+				if _, ok := seenBitmapKeys[k]; !ok {
+					seenBitmapKeys[k] = struct{}{}
+					bitmapKeys = append(bitmapKeys, k)
+				}
+			} else if !db.isFilterEntry(entry) {
+				if !db.hasNewerRecord(entry, fID, off) {
+					pendingMergeEntries = db.getPendingMergeEntries(entry, pendingMergeEntries)
+				}
+			} else if !db.hasNewerRecord(entry, fID, off) && db.retainsEntry(entry, now, &counts) {
+				pendingMergeEntries = append(pendingMergeEntries, entry)
+			} else {
+				counts.dropEntry(entry)
+			}
 		}
 
-		f.rwManager.Close()
+		off += entry.Size()
+		if off >= db.opt.SegmentSize {
+			break
+		}
 	}
 
+	f.rwManager.Close()
+
+	for _, k := range bitmapKeys {
+		if e := db.getBitmapMergeEntry(k); e != nil {
+			pendingMergeEntries = append(pendingMergeEntries, e)
+		}
+	}
+
+	counts.reclaimedBytes = off
+	replayable := true
+	for _, e := range pendingMergeEntries {
+		counts.reclaimedBytes -= e.Size()
+		err := tx.put(string(e.Meta.bucket), e.Key, e.Value, e.Meta.TTL, e.Meta.Flag, e.Meta.timestamp, e.Meta.ds)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		replayable = replayable && e.Meta.ds == DataStructureBPTree
+	}
+
+	// if the data file is not removed, the rewritten B+ tree entries are still newer than its
+	// ones, but the other entries, as the list items, must not be indexed twice.
+	if !replayable {
+		if err := tx.putMergedFile(fID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// The live entries point at the new data file now, so the old one can be removed.
+	if err := db.removeMergedFile(fID); err != nil {
+		return fmt.Errorf("when merge err: %s", err)
+	}
+
+	db.mu.Lock()
+	db.KeyCount -= entryNum
+	if db.mergedEnds == nil {
+		db.mergedEnds = make(map[int64]int64)
+	}
+	db.mergedEnds[fID] = off
+	db.mu.Unlock()
+
+	db.observeMerge(&counts)
+
+	db.logger().Debug("merged the data file", "file", db.getDataPath(fID), "reclaimedBytes", counts.reclaimedBytes,
+		"droppedTombstones", counts.droppedTombstones, "droppedExpired", counts.droppedExpired)
+
 	return nil
 }
 
-// Backup copies the database to file directory at the given dir.
-func (db *DB) Backup(dir string) error {
-	err := db.View(func(tx *Tx) error {
-		return filesystem.CopyDir(db.opt.Dir, dir)
-	})
-	if err != nil {
-		return err
+// hasNewerRecord checks if there is a newer entry with same key and bucket in the index.
+func (db *DB) hasNewerRecord(entry *Entry, fID, off int64) bool {
+	if entry.Meta.ds != DataStructureBPTree {
+		return false
+	}
+
+	r, _ := db.getRecordFromKey(entry.Meta.bucket, entry.Key)
+	if r == nil {
+		return false
+	}
+
+	return r.H.fileID > fID || r.H.fileID == fID && r.H.dataPos > uint64(off)
+}
+
+// getDirtyRatio returns the approximate ratio of dirty entries (deleted,
+// expired or overwritten) to all the entries in the data files.
+func (db *DB) getDirtyRatio() float64 {
+	if db.KeyCount <= 0 {
+		return 0
+	}
+
+	validNum := 0
+
+	for _, idx := range db.BPTreeIdx {
+		validNum += idx.ValidKeyCount
+	}
+
+	for _, s := range db.SetIdx {
+		for key := range s.M {
+			validNum += s.SCard(key)
+		}
+	}
+
+	for _, ss := range db.SortedSetIdx {
+		validNum += ss.Size()
+	}
+
+	for _, l := range db.ListIdx {
+		for key := range l.Items {
+			size, _ := l.Size(key)
+			validNum += size
+		}
+	}
+
+	// the merge rewrites one entry for each bitmap.
+	for _, bs := range db.BitmapIdx {
+		validNum += len(bs.M)
+	}
+
+	if validNum >= db.KeyCount {
+		return 0
+	}
+
+	return float64(db.KeyCount-validNum) / float64(db.KeyCount)
+}
+
+// runMergeWorker merges the data files periodically when the dirty ratio
+// reaches the MergeDirtyRatio option, until the db is closed.
+func (db *DB) runMergeWorker() {
+	defer db.wg.Done()
+
+	ticker := time.NewTicker(db.opt.MergeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-db.closeCh:
+			return
+		case <-ticker.C:
+			db.mu.RLock()
+			ratio := db.getDirtyRatio()
+			db.mu.RUnlock()
+
+			if ratio < db.opt.MergeDirtyRatio {
+				continue
+			}
+
+			if err := db.Merge(); err != nil && err != ErrNotEnoughFilesToMerge && err != ErrIsMerging {
+				db.logger().Error("merge worker", "err", err)
+			}
+		}
 	}
-
-	return nil
 }
 
 // Close releases all db resources.
 func (db *DB) Close() error {
+	// the data of the db in memory is persisted before the txs are rejected.
+	var persistErr error
+	if db.isPersistent() {
+		persistErr = db.Persist()
+	}
+
 	db.mu.Lock()
-	defer db.mu.Unlock()
 
 	if db.closed {
+		db.mu.Unlock()
 		return ErrDBClosed
 	}
 
 	db.closed = true
+	close(db.closeCh)
+	db.mu.Unlock()
+
+	// wait for the background workers without holding the lock, they may need it to finish.
+	db.wg.Wait()
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.unsyncedCommits > 0 {
+		if err := db.syncActiveFile(); err != nil {
+			db.logger().Error("syncing the active file on close", "err", err)
+		}
+	}
+
+	// the snapshot txs can not read after the db is closed, the checkpoint is
+	// not written while there are merged data files.
+	db.snapMu.Lock()
+	for _, f := range db.mergedFiles {
+		_ = db.removeDataFile(db.getDataPath(f.fID))
+	}
+	db.mergedFiles = nil
+	db.snapMu.Unlock()
+
+	if db.opt.CheckpointInterval > 0 && db.opt.EntryIdxMode != HintBPTSparseIdxMode && db.opt.Encryption == nil {
+		if err := db.writeCheckpoint(); err != nil {
+			db.logger().Warn("writing the checkpoint on close", "err", err)
+		}
+	}
 
-	db.ActiveFile.rwManager.Close()
+	if err := db.ActiveFile.rwManager.Close(); err != nil {
+		db.logger().Warn("closing the active file", "err", err)
+	}
 
 	db.ActiveFile = nil
 
+	_ = db.closeOverflowFile()
+
+	db.unlock()
+
+	db.fileCache.close()
+	db.overflowCache.close()
+
+	db.closeWatchers()
+
 	db.BPTreeIdx = nil
 
-	return nil
+	return persistErr
 }
 
 // setActiveFile sets the ActiveFile (DataFile object).
 func (db *DB) setActiveFile() (err error) {
 	filepath := db.getDataPath(db.MaxFileID)
-	db.ActiveFile, err = NewDataFile(filepath, db.opt.SegmentSize, db.opt.RWMode)
+	isNew := !db.dataFileExists(filepath)
+	db.ActiveFile, err = db.openDataFile(filepath, db.opt.RWMode)
 	if err != nil {
 		return
 	}
 
 	db.ActiveFile.fileID = db.MaxFileID
 
+	if isNew {
+		return db.preallocateDataFile(filepath)
+	}
+
 	return nil
 }
 
 // getMaxFileIDAndFileIds returns max fileId and fileIds.
 func (db *DB) getMaxFileIDAndFileIDs() (maxFileID int64, dataFileIds []int) {
-	files, _ := ioutil.ReadDir(db.opt.Dir)
+	files, _ := db.backend().List(db.opt.Dir)
 	if len(files) == 0 {
 		return 0, nil
 	}
 
 	maxFileID = 0
 
-	for _, f := range files {
-		id := f.Name()
+	for _, id := range files {
 		fileSuffix := path.Ext(path.Base(id))
 		if fileSuffix != DataSuffix {
 			continue
@@ -458,12 +984,12 @@ func (db *DB) getMaxFileIDAndFileIDs() (maxFileID int64, dataFileIds []int) {
 func (db *DB) getActiveFileWriteOff() (off int64, err error) {
 	off = 0
 	for {
-		if item, err := db.ActiveFile.ReadAt(int(off)); err == nil {
-			if item == nil {
+		if size, err := db.activeEntrySize(off); err == nil {
+			if size == 0 {
 				break
 			}
 
-			off += item.Size()
+			off += size
 			//set ActiveFileActualSize
 			db.ActiveFile.ActualSize = off
 
@@ -472,6 +998,25 @@ func (db *DB) getActiveFileWriteOff() (off int64, err error) {
 				break
 			}
 
+			// the end of the active file of the writer may be being written.
+			if db.readOnly {
+				break
+			}
+
+			if db.opt.TruncateOnCorruption {
+				db.logger().Warn("truncating the corrupted data file", "file", db.getDataPath(db.MaxFileID), "offset", off, "err", err)
+				if err := db.ActiveFile.truncateAt(off); err != nil {
+					return -1, err
+				}
+				break
+			}
+
+			if db.opt.OpenCorrupted {
+				db.logger().Warn("opening the corrupted data file", "file", db.getDataPath(db.MaxFileID), "offset", off, "err", err)
+				db.activeCorrupted = true
+				break
+			}
+
 			return -1, fmt.Errorf("when build activeDataIndex readAt err: %s", err)
 		}
 	}
@@ -479,80 +1024,243 @@ func (db *DB) getActiveFileWriteOff() (off int64, err error) {
 	return
 }
 
-func (db *DB) parseDataFiles(dataFileIds []int) (unconfirmedRecords []*Record, committedTxIds map[uint64]struct{}, err error) {
-	var (
-		off int64
-		e   *Entry
-	)
+// activeEntrySize returns the size of the entry of the active file at off, or 0 at the end of its entries.
+// With RecoveryFast only the header is read, the entries after the checkpoint are checked when parsed.
+func (db *DB) activeEntrySize(off int64) (int64, error) {
+	if db.opt.RecoveryMode == RecoveryFast {
+		return db.ActiveFile.readEntrySize(off)
+	}
+
+	item, err := db.ActiveFile.ReadAt(int(off))
+	if err != nil || item == nil {
+		return 0, err
+	}
+
+	return item.Size(), nil
+}
+
+// parsedDataFile represents the records parsed from a data file and the txs committed in it.
+type parsedDataFile struct {
+	records   []*Record
+	txIDs     []uint64          // the txs committed in the data file, in the order of their commits
+	keyPos    map[string]int64  // the offsets of the keys in HintBPTSparseIdxMode
+	txEntries map[uint64]int    // the entries of each tx in the data file
+	spans     map[uint64]txSpan // the txs committed in the data file which started in a previous one
+}
+
+// txSpan represents the entry count of a tx written to several data files and the data file of its first entry.
+type txSpan struct {
+	total    int
+	firstFID int64
+}
 
+// parseDataFiles parses the data files, from the offset startOff in the first one.
+// The data files are parsed concurrently by RebuildWorkers workers, their records
+// are then merged in the order of the data files.
+func (db *DB) parseDataFiles(dataFileIds []int, startOff int64) (unconfirmedRecords []*Record, committedTxIds map[uint64]struct{}, err error) {
 	committedTxIds = make(map[uint64]struct{})
 
 	if db.opt.EntryIdxMode == HintBPTSparseIdxMode {
 		dataFileIds = dataFileIds[len(dataFileIds)-1:]
 	}
 
-	for _, dataID := range dataFileIds {
-		off = 0
-		fID := int64(dataID)
-		f, err := NewDataFile(db.getDataPath(fID), db.opt.SegmentSize, db.opt.StartFileLoadingMode)
-		if err != nil {
-			return nil, nil, err
+	parsed := make([]*parsedDataFile, len(dataFileIds))
+	errs := make([]error, len(dataFileIds))
+
+	workers := db.opt.rebuildWorkers()
+	if workers > len(dataFileIds) {
+		workers = len(dataFileIds)
+	}
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				var off int64
+				if i == 0 {
+					off = startOff
+				}
+				parsed[i], errs[i] = db.parseDataFile(int64(dataFileIds[i]), off)
+			}
+		}()
+	}
+
+	for i := range dataFileIds {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	fileIdx := make(map[int64]int, len(dataFileIds))
+	for i, fID := range dataFileIds {
+		fileIdx[int64(fID)] = i
+	}
+
+	for i, p := range parsed {
+		if errs[i] != nil {
+			return nil, nil, errs[i]
 		}
 
-		for {
-			if entry, err := f.ReadAt(int(off)); err == nil {
-				if entry == nil {
-					break
+		for _, txID := range p.txIDs {
+			if span, ok := p.spans[txID]; ok && !db.spanComplete(parsed, fileIdx, startOff, txID, span, int64(dataFileIds[i])) {
+				continue
+			}
+			db.commitTxID(committedTxIds, txID)
+		}
+
+		for key, off := range p.keyPos {
+			db.BPTreeKeyEntryPosMap[key] = off
+		}
+
+		unconfirmedRecords = append(unconfirmedRecords, p.records...)
+	}
+
+	return
+}
+
+// spanComplete checks if the entries of the tx, committed in the data file at fID and started in a
+// previous one, are all found in the parsed data files. The tx is trusted when a data file it spans
+// is not parsed from its start, it is merged or before the checkpoint.
+func (db *DB) spanComplete(parsed []*parsedDataFile, fileIdx map[int64]int, startOff int64, txID uint64, span txSpan, fID int64) bool {
+	n := 0
+	for f := span.firstFID; f <= fID; f++ {
+		i, ok := fileIdx[f]
+		if !ok || i == 0 && startOff > 0 {
+			return true
+		}
+		n += parsed[i].txEntries[txID]
+	}
+
+	return n == span.total
+}
+
+// parseDataFile parses the data file at given fID from the offset off.
+func (db *DB) parseDataFile(fID int64, off int64) (*parsedDataFile, error) {
+	var e *Entry
+
+	f, err := db.openDataFile(db.getDataPath(fID), db.opt.StartFileLoadingMode)
+	if err != nil {
+		return nil, err
+	}
+	defer f.rwManager.Close()
+
+	p := &parsedDataFile{txEntries: make(map[uint64]int)}
+	if db.opt.EntryIdxMode == HintBPTSparseIdxMode {
+		p.keyPos = make(map[string]int64)
+	}
+
+	// the commit records sum up the entries of their tx in the same data file.
+	commits := make(map[uint64]*txCommit)
+
+	// the values are only kept in HintKeyValAndRAMIdxMode.
+	decode := db.decodeEntryKey
+	if db.opt.EntryIdxMode == HintKeyValAndRAMIdxMode {
+		decode = db.decodeEntry
+	}
+
+	for {
+		if entry, err := f.ReadAt(int(off)); err == nil {
+			if entry == nil {
+				break
+			}
+
+			if err := decode(entry); err != nil {
+				return nil, err
+			}
+
+			e = nil
+			if db.opt.EntryIdxMode == HintKeyValAndRAMIdxMode {
+				e = &Entry{
+					Key:   entry.Key,
+					Value: entry.Value,
+					Meta:  entry.Meta,
 				}
+			}
 
-				e = nil
-				if db.opt.EntryIdxMode == HintKeyValAndRAMIdxMode {
-					e = &Entry{
-						Key:   entry.Key,
-						Value: entry.Value,
-						Meta:  entry.Meta,
+			if isTxCommitEntry(entry) {
+				if c, ok := commits[entry.Meta.txID]; ok && c.matches(entry) {
+					p.txIDs = append(p.txIDs, entry.Meta.txID)
+
+					if total, firstFID := txCommitSpan(entry); firstFID < fID {
+						if p.spans == nil {
+							p.spans = make(map[uint64]txSpan)
+						}
+						p.spans[entry.Meta.txID] = txSpan{total: int(total), firstFID: firstFID}
 					}
 				}
+				off += entry.Size()
+				continue
+			}
 
-				if entry.Meta.status == Committed {
-					committedTxIds[entry.Meta.txID] = struct{}{}
-					db.ActiveCommittedTxIdsIdx.Insert([]byte(strconv2.Int64ToStr(int64(entry.Meta.txID))), nil,
-						&Hint{meta: &MetaData{Flag: DataSetFlag}}, CountFlagEnabled)
-				}
+			p.txEntries[entry.Meta.txID]++
 
-				unconfirmedRecords = append(unconfirmedRecords, &Record{
-					H: &Hint{
-						key:     entry.Key,
-						fileID:  fID,
-						meta:    entry.Meta,
-						dataPos: uint64(off),
-					},
-					E: e,
-				})
+			if _, ok := commits[entry.Meta.txID]; !ok {
+				commits[entry.Meta.txID] = &txCommit{}
+			}
+			commits[entry.Meta.txID].addEntry(entry)
 
-				if db.opt.EntryIdxMode == HintBPTSparseIdxMode {
-					db.BPTreeKeyEntryPosMap[string(entry.Meta.bucket)+string(entry.Key)] = off
-				}
+			// the entries written before the commit records mark their tx committed on its last entry.
+			if entry.Meta.status == Committed {
+				p.txIDs = append(p.txIDs, entry.Meta.txID)
+			}
 
-				off += entry.Size()
+			p.records = append(p.records, &Record{
+				H: &Hint{
+					key:     entry.Key,
+					fileID:  fID,
+					meta:    entry.Meta,
+					dataPos: uint64(off),
+				},
+				E: e,
+			})
+
+			if db.opt.EntryIdxMode == HintBPTSparseIdxMode {
+				p.keyPos[string(entry.Meta.bucket)+string(entry.Key)] = off
+			}
 
-			} else {
-				if err == io.EOF {
-					break
-				}
+			off += entry.Size()
 
-				if off >= db.opt.SegmentSize {
-					break
+		} else {
+			if err == io.EOF {
+				break
+			}
+
+			if off >= db.opt.SegmentSize {
+				break
+			}
+
+			// the end of the active file of the writer may be being written.
+			if db.readOnly && fID == db.MaxFileID {
+				break
+			}
+
+			if db.opt.TruncateOnCorruption {
+				db.logger().Warn("truncating the corrupted data file", "file", db.getDataPath(fID), "offset", off, "err", err)
+				if err := f.truncateAt(off); err != nil {
+					return nil, err
 				}
-				f.rwManager.Close()
-				return nil, nil, fmt.Errorf("when build hintIndex readAt err: %s", err)
+				break
+			}
+
+			if db.opt.OpenCorrupted {
+				break
 			}
-		}
 
-		f.rwManager.Close()
+			return nil, fmt.Errorf("when build hintIndex readAt err: %s", err)
+		}
 	}
 
-	return
+	return p, nil
+}
+
+// commitTxID records the tx as committed when parsing the data files.
+func (db *DB) commitTxID(committedTxIds map[uint64]struct{}, txID uint64) {
+	committedTxIds[txID] = struct{}{}
+	db.ActiveCommittedTxIdsIdx.Insert([]byte(strconv2.Int64ToStr(int64(txID))), nil,
+		&Hint{meta: &MetaData{Flag: DataSetFlag}}, CountFlagEnabled)
 }
 
 func (db *DB) buildBPTreeRootIdxes(dataFileIds []int) error {
@@ -598,13 +1306,18 @@ func (db *DB) buildBPTreeRootIdxes(dataFileIds []int) error {
 
 func (db *DB) buildBPTreeIdx(bucket string, r *Record) error {
 	if _, ok := db.BPTreeIdx[bucket]; !ok {
-		db.BPTreeIdx[bucket] = NewTree()
+		db.BPTreeIdx[bucket] = db.newBucketTree(bucket)
 	}
 
-	if err := db.BPTreeIdx[bucket].Insert(r.H.key, r.E, r.H, CountFlagEnabled); err != nil {
+	db.spillRecord(r)
+
+	inserted, old, err := db.BPTreeIdx[bucket].insert(r.H.key, r.E, r.H, CountFlagEnabled)
+	if err != nil {
 		return fmt.Errorf("when build BPTreeIdx insert index err: %s", err)
 	}
 
+	db.accountRecord(inserted, old)
+
 	return nil
 }
 
@@ -668,23 +1381,36 @@ func (db *DB) buildOtherIdxes(bucket string, r *Record) error {
 		}
 	}
 
+	if r.H.meta.ds == DataStructureBitmap {
+		if err := db.buildBitmapIdx(bucket, r); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-// buildHintIdx builds the Hint Indexes.
+// buildHintIdx builds the Hint Indexes, from the checkpoint if there is one.
 func (db *DB) buildHintIdx(dataFileIds []int) error {
-	unconfirmedRecords, committedTxIds, err := db.parseDataFiles(dataFileIds)
-	db.committedTxIds = committedTxIds
+	parseFileIds, startOff := db.loadCheckpoint(dataFileIds)
+
+	unconfirmedRecords, committedTxIds, err := db.parseDataFiles(parseFileIds, startOff)
+	for txID := range committedTxIds {
+		db.committedTxIds[txID] = struct{}{}
+	}
 
 	if err != nil {
 		return err
 	}
 
-	if len(unconfirmedRecords) == 0 {
-		return nil
-	}
+	// the entries of the data files merged but not removed are rewritten in the next ones.
+	mergedFIDs := db.mergedFileIDs(unconfirmedRecords)
 
 	for _, r := range unconfirmedRecords {
+		if _, ok := mergedFIDs[r.H.fileID]; ok || r.H.meta.ds == DataStructureMergedFile {
+			continue
+		}
+
 		if _, ok := db.committedTxIds[r.H.meta.txID]; ok {
 			bucket := string(r.H.meta.bucket)
 
@@ -710,6 +1436,17 @@ func (db *DB) buildHintIdx(dataFileIds []int) error {
 		}
 	}
 
+	if !db.readOnly {
+		for fID := range mergedFIDs {
+			if !db.dataFileExists(db.getDataPath(fID)) {
+				continue
+			}
+			if err = db.removeDataFiles([]int64{fID}); err != nil {
+				return err
+			}
+		}
+	}
+
 	if HintBPTSparseIdxMode == db.opt.EntryIdxMode {
 		if err = db.buildBPTreeRootIdxes(dataFileIds); err != nil {
 			return err
@@ -759,10 +1496,12 @@ func (db *DB) buildSortedSetIdx(bucket string, r *Record) error {
 				return ErrEntryIdxModeOpt
 			}
 			_ = db.SortedSetIdx[bucket].Put(key, zset.SCORE(score), r.E.Value)
+			db.setZSetDeadline(bucket, key, r.H.meta.TTL, r.H.meta.timestamp)
 		}
 	}
 	if r.H.meta.Flag == DataZRemFlag {
 		_ = db.SortedSetIdx[bucket].Remove(string(r.E.Key))
+		db.setZSetDeadline(bucket, string(r.E.Key), Persistent, 0)
 	}
 	if r.H.meta.Flag == DataZRemRangeByRankFlag {
 		start, _ := strconv2.StrToInt(string(r.E.Key))
@@ -825,6 +1564,40 @@ func (db *DB) buildListIdx(bucket string, r *Record) error {
 		if err := db.ListIdx[bucket].Ltrim(newKey, start, end); err != nil {
 			return ErrWhenBuildListIdx(err)
 		}
+	case DataLInsertFlag:
+		keyAndIndex := strings.Split(string(r.E.Key), SeparatorForListKey)
+		newKey := keyAndIndex[0]
+		index, _ := strconv2.StrToInt(keyAndIndex[1])
+		if err := db.ListIdx[bucket].LInsert(newKey, index, r.E.Value); err != nil {
+			return ErrWhenBuildListIdx(err)
+		}
+	}
+
+	return nil
+}
+
+// buildBitmapIdx builds bitmap index when opening the DB.
+func (db *DB) buildBitmapIdx(bucket string, r *Record) error {
+	if _, ok := db.BitmapIdx[bucket]; !ok {
+		db.BitmapIdx[bucket] = bitmap.NewBitmaps()
+	}
+
+	if r.E == nil {
+		return ErrEntryIdxModeOpt
+	}
+
+	switch r.H.meta.Flag {
+	case DataSetBitFlag, DataClearBitFlag:
+		if len(r.E.Value) != 4 {
+			return fmt.Errorf("when build BitmapIdx SetBit index err: invalid offset %v", r.E.Value)
+		}
+		db.BitmapIdx[bucket].SetBit(string(r.E.Key), binary.BigEndian.Uint32(r.E.Value), r.H.meta.Flag == DataSetBitFlag)
+	case DataBitmapStoreFlag:
+		b := bitmap.New()
+		if err := b.UnmarshalBinary(r.E.Value); err != nil {
+			return fmt.Errorf("when build BitmapIdx store index err: %s", err)
+		}
+		db.BitmapIdx[bucket].Store(string(r.E.Key), b)
 	}
 
 	return nil
@@ -865,14 +1638,27 @@ func (db *DB) buildIndexes() (err error) {
 	}
 
 	// build hint index
-	return db.buildHintIdx(dataFileIds)
+	if err = db.buildHintIdx(dataFileIds); err != nil {
+		return
+	}
+
+	// the writes must not overwrite the corrupted entries kept for db.Repair.
+	if db.activeCorrupted {
+		if err = db.sealActiveFile(); err != nil {
+			return
+		}
+	}
+
+	db.fitIndexMemory()
+
+	return nil
 }
 
 // managed calls a block of code that is fully contained in a transaction.
-func (db *DB) managed(writable bool, fn func(tx *Tx) error) error {
+func (db *DB) managed(ctx context.Context, writable bool, fn func(tx *Tx) error) error {
 	var tx *Tx
 
-	tx, err := db.Begin(writable)
+	tx, err := db.BeginCtx(ctx, writable)
 	if err != nil {
 		return err
 	}
@@ -896,6 +1682,107 @@ func (db *DB) managed(writable bool, fn func(tx *Tx) error) error {
 
 const bptDir = "bpt"
 
+// readEntryAt reads the entry in the data file at given fID and off, through the data file cache.
+func (db *DB) readEntryAt(fID int64, off uint64) (*Entry, error) {
+	if db.entryCache != nil {
+		if e := db.entryCache.get(entryPos{fID: fID, off: off}); e != nil {
+			return e, nil
+		}
+	}
+
+	df, err := db.fileCache.acquire(fID)
+	if err != nil {
+		return nil, err
+	}
+	defer db.fileCache.release(fID, df)
+
+	e, err := df.ReadAt(int(off))
+	if err != nil || e == nil {
+		return e, err
+	}
+
+	if err := db.decodeEntry(e); err != nil {
+		return nil, err
+	}
+
+	if db.entryCache != nil {
+		db.entryCache.add(entryPos{fID: fID, off: off}, e)
+	}
+
+	return e, nil
+}
+
+// readEntriesAt reads the entries in the data file at given fID and offs, acquiring it once.
+func (db *DB) readEntriesAt(fID int64, offs []uint64) ([]*Entry, error) {
+	df, err := db.fileCache.acquire(fID)
+	if err != nil {
+		return nil, err
+	}
+	defer db.fileCache.release(fID, df)
+
+	entries := make([]*Entry, len(offs))
+	for i, off := range offs {
+		if db.entryCache != nil {
+			if entries[i] = db.entryCache.get(entryPos{fID: fID, off: off}); entries[i] != nil {
+				continue
+			}
+		}
+
+		e, err := df.ReadAt(int(off))
+		if err != nil {
+			return nil, fmt.Errorf("read err. fid %d, pos %d, err %s", fID, off, err)
+		}
+		if e == nil {
+			continue
+		}
+
+		if err := db.decodeEntry(e); err != nil {
+			return nil, err
+		}
+
+		if db.entryCache != nil {
+			db.entryCache.add(entryPos{fID: fID, off: off}, e)
+		}
+
+		entries[i] = e
+	}
+
+	return entries, nil
+}
+
+// decodeEntry decrypts and decompresses the key and value of the entry read from a data file.
+// The metadata keeps the stored sizes, so the entry size is unchanged.
+func (db *DB) decodeEntry(e *Entry) (err error) {
+	if err = db.decodeEntryKey(e); err != nil {
+		return err
+	}
+
+	if e.Meta.overflow == 1 {
+		if e.Value, err = db.readOverflow(e.Value); err != nil {
+			return err
+		}
+	}
+
+	if e.Meta.encryption&encryptedValue != 0 {
+		if e.Value, err = db.cipher.decrypt(e.Value); err != nil {
+			return err
+		}
+	}
+
+	e.Value, err = decompressValue(Compression(e.Meta.codec), e.Value)
+
+	return err
+}
+
+// decodeEntryKey decrypts the key of the entry read from a data file, the value is left as stored.
+func (db *DB) decodeEntryKey(e *Entry) (err error) {
+	if e.Meta.encryption&encryptedKey != 0 {
+		e.Key, err = db.cipher.decrypt(e.Key)
+	}
+
+	return err
+}
+
 // getDataPath returns the data path at given fid.
 func (db *DB) getDataPath(fID int64) string {
 	return db.opt.Dir + "/" + strconv2.Int64ToStr(fID) + DataSuffix
@@ -960,9 +1847,13 @@ func (db *DB) getPendingMergeEntries(entry *Entry, pendingMergeEntries []*Entry)
 	}
 
 	if entry.Meta.ds == DataStructureList {
-		items, _ := db.ListIdx[string(entry.Meta.bucket)].LRange(string(entry.Key), 0, -1)
+		key := string(entry.Key)
+		if entry.Meta.Flag == DataLInsertFlag {
+			key = strings.Split(key, SeparatorForListKey)[0]
+		}
+		items, _ := db.ListIdx[string(entry.Meta.bucket)].LRange(key, 0, -1)
 		ok := false
-		if entry.Meta.Flag == DataRPushFlag || entry.Meta.Flag == DataLPushFlag {
+		if entry.Meta.Flag == DataRPushFlag || entry.Meta.Flag == DataLPushFlag || entry.Meta.Flag == DataLInsertFlag {
 			for _, item := range items {
 				if string(entry.Value) == string(item) {
 					ok = true
@@ -978,46 +1869,42 @@ func (db *DB) getPendingMergeEntries(entry *Entry, pendingMergeEntries []*Entry)
 	return pendingMergeEntries
 }
 
-func (db *DB) reWriteData(pendingMergeEntries []*Entry) error {
-	if len(pendingMergeEntries) == 0 {
+// bitmapKey is the bucket and key of a bitmap.
+type bitmapKey struct {
+	bucket, key string
+}
+
+// getBitmapMergeEntry returns the entry of the whole bitmap at given k, to be rewritten after
+// the entries of its older changes. It returns nil if the bitmap is removed, then the older
+// changes are overridden by the newer entry which removed it.
+func (db *DB) getBitmapMergeEntry(k bitmapKey) *Entry {
+	bs, ok := db.BitmapIdx[k.bucket]
+	if !ok {
 		return nil
 	}
-	tx, err := db.Begin(true)
-	if err != nil {
-		db.isMerging = false
-		return err
-	}
 
-	dataFile, err := NewDataFile(db.getDataPath(db.MaxFileID+1), db.opt.SegmentSize, db.opt.RWMode)
-	if err != nil {
-		db.isMerging = false
-		return err
+	b := bs.Get(k.key)
+	if b == nil {
+		return nil
 	}
-	db.ActiveFile = dataFile
-	db.MaxFileID++
 
-	for _, e := range pendingMergeEntries {
-		err := tx.put(string(e.Meta.bucket), e.Key, e.Value, e.Meta.TTL, e.Meta.Flag, e.Meta.timestamp, e.Meta.ds)
-		if err != nil {
-			tx.Rollback()
-			db.isMerging = false
-			return err
-		}
+	value, _ := b.MarshalBinary()
+
+	return &Entry{
+		Key:   []byte(k.key),
+		Value: value,
+		Meta: &MetaData{
+			bucket:    []byte(k.bucket),
+			Flag:      DataBitmapStoreFlag,
+			TTL:       Persistent,
+			timestamp: uint64(time.Now().Unix()),
+			ds:        DataStructureBitmap,
+		},
 	}
-	tx.Commit()
-	return nil
 }
 
 func (db *DB) isFilterEntry(entry *Entry) bool {
-	if entry.Meta.Flag == DataDeleteFlag || entry.Meta.Flag == DataRPopFlag ||
-		entry.Meta.Flag == DataLPopFlag || entry.Meta.Flag == DataLRemFlag ||
-		entry.Meta.Flag == DataLTrimFlag || entry.Meta.Flag == DataZRemFlag ||
-		entry.Meta.Flag == DataZRemRangeByRankFlag || entry.Meta.Flag == DataZPopMaxFlag ||
-		entry.Meta.Flag == DataZPopMinFlag || IsExpired(entry.Meta.TTL, entry.Meta.timestamp) {
-		return true
-	}
-
-	return false
+	return isTombstone(entry) || IsExpired(entry.Meta.TTL, entry.Meta.timestamp)
 }
 
 // getRecordFromKey fetches Record for given key and bucket
@@ -19,7 +19,9 @@ import (
 	"io/ioutil"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/xujiajun/utils/strconv2"
 )
@@ -1021,10 +1023,12 @@ func TestOpen(t *testing.T) {
 
 	opSetDataForTestOpen(t)
 
+	db.Close()
 	db, err = Open(opt)
 	if err != nil {
 		t.Fatal(err)
 	}
+	db.Close()
 }
 
 func TestDB_Backup(t *testing.T) {
@@ -1035,6 +1039,7 @@ func TestDB_Backup(t *testing.T) {
 	if err != nil {
 		t.Error("err TestDB_Backup")
 	}
+	db.Close()
 }
 
 func TestDB_Close(t *testing.T) {
@@ -1087,3 +1092,182 @@ func Test_getRecordFromKey(t *testing.T) {
 		t.Errorf("wanted nil, got %v", err)
 	}
 }
+
+func TestDB_MergeAutomatically(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestformergeauto", true)
+	opt.SegmentSize = 120
+	opt.MergeInterval = 10 * time.Millisecond
+	opt.MergeDirtyRatio = 0.5
+
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	bucket := "bucket_for_merge_auto"
+	for i := 0; i < 20; i++ {
+		if err := db.Update(func(tx *Tx) error {
+			return tx.Put(bucket, []byte("hello"), []byte("world"+strconv2.IntToStr(i)), Persistent)
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		_, fileIDs := db.getMaxFileIDAndFileIDs()
+		if len(fileIDs) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("err auto merge, got %d data files", len(fileIDs))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := db.View(func(tx *Tx) error {
+		e, err := tx.Get(bucket, []byte("hello"))
+		if err != nil {
+			return err
+		}
+		if string(e.Value) != "world19" {
+			t.Errorf("err auto merge, got %s want %s", e.Value, "world19")
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Merge(); err != ErrNotEnoughFilesToMerge {
+		t.Errorf("err merge, got %v want %v", err, ErrNotEnoughFilesToMerge)
+	}
+}
+
+func TestDB_TruncateOnCorruption(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestforcorruption", true)
+
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bucket := "bucket_for_corruption"
+	for i := 0; i < 2; i++ {
+		if err := db.Update(func(tx *Tx) error {
+			return tx.Put(bucket, []byte("key_"+strconv2.IntToStr(i)), []byte("val_"+strconv2.IntToStr(i)), Persistent)
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := db.BPTreeIdx[bucket].Find([]byte("key_1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fID, off := r.H.fileID, int64(r.H.dataPos)+r.E.Size()-1
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// flip the last byte of the value of key_1.
+	f, err := os.OpenFile(db.getDataPath(fID), os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 1)
+	if _, err := f.ReadAt(b, off); err != nil {
+		t.Fatal(err)
+	}
+	b[0] ^= 0xff
+	if _, err := f.WriteAt(b, off); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	if _, err := Open(opt); err == nil {
+		t.Fatal("err TestDB_TruncateOnCorruption: open a corrupted data file")
+	}
+
+	opt.TruncateOnCorruption = true
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Update(func(tx *Tx) error {
+		if _, err := tx.Get(bucket, []byte("key_0")); err != nil {
+			return err
+		}
+		if _, err := tx.Get(bucket, []byte("key_1")); err == nil {
+			t.Error("err TestDB_TruncateOnCorruption: get a truncated entry")
+		}
+		return tx.Put(bucket, []byte("key_2"), []byte("val_2"), Persistent)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.View(func(tx *Tx) error {
+		_, err := tx.Get(bucket, []byte("key_2"))
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDB_ParallelRebuild(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestforrebuild", true)
+	opt.SegmentSize = 256
+
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bucket := "bucket_for_rebuild"
+	for i := 0; i < 200; i++ {
+		key := []byte("key_" + strconv2.IntToStr(i%50))
+		if err := db.Update(func(tx *Tx) error {
+			if i%7 == 0 {
+				return tx.Delete(bucket, key)
+			}
+			return tx.Put(bucket, key, []byte("val_"+strconv2.IntToStr(i)), Persistent)
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	getAll := func() string {
+		var got []string
+		if err := db.View(func(tx *Tx) error {
+			entries, err := tx.GetAll(bucket)
+			if err != nil {
+				return err
+			}
+			for _, e := range entries {
+				got = append(got, string(e.Key)+"="+string(e.Value))
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return strings.Join(got, ",")
+	}
+
+	want := getAll()
+	db.Close()
+
+	for _, workers := range []int{1, 4} {
+		opt.RebuildWorkers = workers
+		db, err = Open(opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := getAll(); got != want {
+			t.Errorf("err rebuild with %d workers, got %s want %s", workers, got, want)
+		}
+		db.Close()
+	}
+}
@@ -0,0 +1,544 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package bitmap implements the compressed bitmaps of the roaring format: the offsets are split
+// by their high 16 bits into containers, which hold the low 16 bits in a sorted array while they
+// are sparse and in a bitset of 65536 bits once they are dense.
+package bitmap
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/bits"
+	"sort"
+)
+
+// ErrInvalidData is returned when the serialized bitmap is malformed.
+var ErrInvalidData = errors.New("invalid bitmap data")
+
+const (
+	// arrayMaxSize is the maximum cardinality of the array containers, the bitsets of more
+	// members are smaller than the arrays.
+	arrayMaxSize = 4096
+
+	// bitsetWords is the number of the words of the bitset containers.
+	bitsetWords = 1 << 16 / 64
+)
+
+// the kinds of the containers of the serialized bitmaps.
+const (
+	arrayKind byte = iota
+	bitsetKind
+)
+
+// container holds the low 16 bits of the offsets with the same high 16 bits, in array or in bitset.
+type container struct {
+	array  []uint16 // sorted, nil if the container is a bitset
+	bitset []uint64 // nil if the container is an array
+	n      int      // the cardinality
+}
+
+func (c *container) contains(x uint16) bool {
+	if c.bitset != nil {
+		return c.bitset[x>>6]&(1<<(x&63)) != 0
+	}
+
+	i := sort.Search(len(c.array), func(i int) bool { return c.array[i] >= x })
+
+	return i < len(c.array) && c.array[i] == x
+}
+
+// add adds x to the container, it returns false if x is already in it.
+func (c *container) add(x uint16) bool {
+	if c.bitset != nil {
+		if c.bitset[x>>6]&(1<<(x&63)) != 0 {
+			return false
+		}
+		c.bitset[x>>6] |= 1 << (x & 63)
+		c.n++
+		return true
+	}
+
+	i := sort.Search(len(c.array), func(i int) bool { return c.array[i] >= x })
+	if i < len(c.array) && c.array[i] == x {
+		return false
+	}
+
+	c.array = append(c.array, 0)
+	copy(c.array[i+1:], c.array[i:])
+	c.array[i] = x
+	c.n++
+
+	if c.n > arrayMaxSize {
+		c.bitset = c.toBitset()
+		c.array = nil
+	}
+
+	return true
+}
+
+// remove removes x from the container, it returns false if x is not in it.
+func (c *container) remove(x uint16) bool {
+	if c.bitset != nil {
+		if c.bitset[x>>6]&(1<<(x&63)) == 0 {
+			return false
+		}
+		c.bitset[x>>6] &^= 1 << (x & 63)
+		c.n--
+
+		if c.n <= arrayMaxSize {
+			c.array = c.toArray()
+			c.bitset = nil
+		}
+		return true
+	}
+
+	i := sort.Search(len(c.array), func(i int) bool { return c.array[i] >= x })
+	if i == len(c.array) || c.array[i] != x {
+		return false
+	}
+
+	c.array = append(c.array[:i], c.array[i+1:]...)
+	c.n--
+
+	return true
+}
+
+// toBitset returns the members of the container in a new bitset.
+func (c *container) toBitset() []uint64 {
+	b := make([]uint64, bitsetWords)
+	if c.bitset != nil {
+		copy(b, c.bitset)
+		return b
+	}
+
+	for _, x := range c.array {
+		b[x>>6] |= 1 << (x & 63)
+	}
+
+	return b
+}
+
+// toArray returns the members of the container in a new sorted array.
+func (c *container) toArray() []uint16 {
+	if c.bitset == nil {
+		return append([]uint16(nil), c.array...)
+	}
+
+	a := make([]uint16, 0, c.n)
+	for i, w := range c.bitset {
+		for w != 0 {
+			a = append(a, uint16(i*64+bits.TrailingZeros64(w)))
+			w &= w - 1
+		}
+	}
+
+	return a
+}
+
+func (c *container) clone() *container {
+	if c.bitset != nil {
+		return &container{bitset: c.toBitset(), n: c.n}
+	}
+
+	return &container{array: c.toArray(), n: c.n}
+}
+
+// newBitsetContainer returns the container of the members of the bitset, as an array if they are sparse.
+func newBitsetContainer(b []uint64) *container {
+	n := 0
+	for _, w := range b {
+		n += bits.OnesCount64(w)
+	}
+
+	c := &container{bitset: b, n: n}
+	if n <= arrayMaxSize {
+		c.array = c.toArray()
+		c.bitset = nil
+	}
+
+	return c
+}
+
+// and returns the intersection of the containers.
+func (c *container) and(o *container) *container {
+	if c.bitset == nil && o.bitset == nil {
+		var a []uint16
+		for i, j := 0, 0; i < len(c.array) && j < len(o.array); {
+			switch {
+			case c.array[i] < o.array[j]:
+				i++
+			case c.array[i] > o.array[j]:
+				j++
+			default:
+				a = append(a, c.array[i])
+				i++
+				j++
+			}
+		}
+		return &container{array: a, n: len(a)}
+	}
+
+	b := c.toBitset()
+	for i, w := range o.toBitset() {
+		b[i] &= w
+	}
+
+	return newBitsetContainer(b)
+}
+
+// or returns the union of the containers.
+func (c *container) or(o *container) *container {
+	b := c.toBitset()
+	for i, w := range o.toBitset() {
+		b[i] |= w
+	}
+
+	return newBitsetContainer(b)
+}
+
+// xor returns the symmetric difference of the containers.
+func (c *container) xor(o *container) *container {
+	b := c.toBitset()
+	for i, w := range o.toBitset() {
+		b[i] ^= w
+	}
+
+	return newBitsetContainer(b)
+}
+
+// Bitmap represents a set of uint32 offsets.
+type Bitmap struct {
+	keys       []uint16 // the sorted high 16 bits of the containers
+	containers []*container
+}
+
+// New returns a newly initialized empty Bitmap.
+func New() *Bitmap {
+	return &Bitmap{}
+}
+
+// find returns the index of the container at given key, or where to insert it.
+func (b *Bitmap) find(key uint16) (int, bool) {
+	i := sort.Search(len(b.keys), func(i int) bool { return b.keys[i] >= key })
+
+	return i, i < len(b.keys) && b.keys[i] == key
+}
+
+// Add adds x to the bitmap, it returns false if x is already set.
+func (b *Bitmap) Add(x uint32) bool {
+	i, ok := b.find(uint16(x >> 16))
+	if !ok {
+		b.keys = append(b.keys, 0)
+		copy(b.keys[i+1:], b.keys[i:])
+		b.keys[i] = uint16(x >> 16)
+
+		b.containers = append(b.containers, nil)
+		copy(b.containers[i+1:], b.containers[i:])
+		b.containers[i] = &container{}
+	}
+
+	return b.containers[i].add(uint16(x))
+}
+
+// Remove removes x from the bitmap, it returns false if x is not set.
+func (b *Bitmap) Remove(x uint32) bool {
+	i, ok := b.find(uint16(x >> 16))
+	if !ok || !b.containers[i].remove(uint16(x)) {
+		return false
+	}
+
+	if b.containers[i].n == 0 {
+		b.keys = append(b.keys[:i], b.keys[i+1:]...)
+		b.containers = append(b.containers[:i], b.containers[i+1:]...)
+	}
+
+	return true
+}
+
+// Contains returns if x is set in the bitmap.
+func (b *Bitmap) Contains(x uint32) bool {
+	i, ok := b.find(uint16(x >> 16))
+
+	return ok && b.containers[i].contains(uint16(x))
+}
+
+// Count returns the number of the offsets set in the bitmap.
+func (b *Bitmap) Count() uint64 {
+	var n uint64
+	for _, c := range b.containers {
+		n += uint64(c.n)
+	}
+
+	return n
+}
+
+// IsEmpty returns if no offset is set in the bitmap.
+func (b *Bitmap) IsEmpty() bool {
+	return len(b.containers) == 0
+}
+
+// ToArray returns the offsets set in the bitmap in ascending order.
+func (b *Bitmap) ToArray() []uint32 {
+	a := make([]uint32, 0, b.Count())
+	for i, c := range b.containers {
+		for _, x := range c.toArray() {
+			a = append(a, uint32(b.keys[i])<<16|uint32(x))
+		}
+	}
+
+	return a
+}
+
+// Clone returns a copy of the bitmap.
+func (b *Bitmap) Clone() *Bitmap {
+	nb := &Bitmap{
+		keys:       append([]uint16(nil), b.keys...),
+		containers: make([]*container, len(b.containers)),
+	}
+	for i, c := range b.containers {
+		nb.containers[i] = c.clone()
+	}
+
+	return nb
+}
+
+// append appends the container at given key to the bitmap unless it is empty, the keys must be
+// appended in ascending order.
+func (b *Bitmap) append(key uint16, c *container) {
+	if c.n > 0 {
+		b.keys = append(b.keys, key)
+		b.containers = append(b.containers, c)
+	}
+}
+
+// And returns the intersection of the bitmap and o in a new bitmap.
+func (b *Bitmap) And(o *Bitmap) *Bitmap {
+	nb := New()
+	for i, j := 0, 0; i < len(b.keys) && j < len(o.keys); {
+		switch {
+		case b.keys[i] < o.keys[j]:
+			i++
+		case b.keys[i] > o.keys[j]:
+			j++
+		default:
+			nb.append(b.keys[i], b.containers[i].and(o.containers[j]))
+			i++
+			j++
+		}
+	}
+
+	return nb
+}
+
+// Or returns the union of the bitmap and o in a new bitmap.
+func (b *Bitmap) Or(o *Bitmap) *Bitmap {
+	return b.merge(o, (*container).or)
+}
+
+// Xor returns the symmetric difference of the bitmap and o in a new bitmap.
+func (b *Bitmap) Xor(o *Bitmap) *Bitmap {
+	return b.merge(o, (*container).xor)
+}
+
+// merge returns a new bitmap of the containers of the bitmap and o, the containers at the same
+// key are combined with op.
+func (b *Bitmap) merge(o *Bitmap, op func(c, o *container) *container) *Bitmap {
+	nb := New()
+
+	i, j := 0, 0
+	for i < len(b.keys) || j < len(o.keys) {
+		switch {
+		case j == len(o.keys) || i < len(b.keys) && b.keys[i] < o.keys[j]:
+			nb.append(b.keys[i], b.containers[i].clone())
+			i++
+		case i == len(b.keys) || b.keys[i] > o.keys[j]:
+			nb.append(o.keys[j], o.containers[j].clone())
+			j++
+		default:
+			nb.append(b.keys[i], op(b.containers[i], o.containers[j]))
+			i++
+			j++
+		}
+	}
+
+	return nb
+}
+
+// MarshalBinary returns the bitmap serialized as:
+//
+//	| containers | key | kind | cardinality | members |
+//	|  uvarint   |uint16| byte |  uvarint    | []uint16 or [1024]uint64 |
+//
+// the key, kind, cardinality and members are repeated for each container, in little endian.
+func (b *Bitmap) MarshalBinary() ([]byte, error) {
+	buf := appendUvarint(nil, uint64(len(b.containers)))
+
+	for i, c := range b.containers {
+		buf = appendUint16(buf, b.keys[i])
+
+		if c.bitset != nil {
+			buf = append(buf, bitsetKind)
+			buf = appendUvarint(buf, uint64(c.n))
+			for _, w := range c.bitset {
+				buf = appendUint64(buf, w)
+			}
+			continue
+		}
+
+		buf = append(buf, arrayKind)
+		buf = appendUvarint(buf, uint64(c.n))
+		for _, x := range c.array {
+			buf = appendUint16(buf, x)
+		}
+	}
+
+	return buf, nil
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], v)
+	return append(buf, b[:n]...)
+}
+
+func appendUint16(buf []byte, v uint16) []byte {
+	var b [2]byte
+	binary.LittleEndian.PutUint16(b[:], v)
+	return append(buf, b[:]...)
+}
+
+func appendUint64(buf []byte, v uint64) []byte {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	return append(buf, b[:]...)
+}
+
+// UnmarshalBinary replaces the bitmap with the one serialized by MarshalBinary.
+func (b *Bitmap) UnmarshalBinary(data []byte) error {
+	num, n := binary.Uvarint(data)
+	if n <= 0 || num > 1<<16 {
+		return ErrInvalidData
+	}
+	data = data[n:]
+
+	nb := Bitmap{}
+	for k := uint64(0); k < num; k++ {
+		if len(data) < 3 {
+			return ErrInvalidData
+		}
+
+		key, kind := binary.LittleEndian.Uint16(data), data[2]
+		if len(nb.keys) > 0 && key <= nb.keys[len(nb.keys)-1] {
+			return ErrInvalidData
+		}
+
+		card, n := binary.Uvarint(data[3:])
+		if n <= 0 || card == 0 || card > 1<<16 {
+			return ErrInvalidData
+		}
+		data = data[3+n:]
+
+		var c *container
+		switch kind {
+		case arrayKind:
+			if card > arrayMaxSize || uint64(len(data)) < 2*card {
+				return ErrInvalidData
+			}
+			c = &container{array: make([]uint16, card), n: int(card)}
+			for i := range c.array {
+				c.array[i] = binary.LittleEndian.Uint16(data[2*i:])
+				if i > 0 && c.array[i] <= c.array[i-1] {
+					return ErrInvalidData
+				}
+			}
+			data = data[2*card:]
+		case bitsetKind:
+			if len(data) < 8*bitsetWords {
+				return ErrInvalidData
+			}
+			bitset := make([]uint64, bitsetWords)
+			for i := range bitset {
+				bitset[i] = binary.LittleEndian.Uint64(data[8*i:])
+			}
+			data = data[8*bitsetWords:]
+
+			c = newBitsetContainer(bitset)
+			if uint64(c.n) != card {
+				return ErrInvalidData
+			}
+		default:
+			return ErrInvalidData
+		}
+
+		nb.append(key, c)
+	}
+
+	if len(data) != 0 {
+		return ErrInvalidData
+	}
+
+	*b = nb
+
+	return nil
+}
+
+// Bitmaps represents the bitmaps stored at keys.
+type Bitmaps struct {
+	M map[string]*Bitmap
+}
+
+// NewBitmaps returns a newly initialized Bitmaps Object.
+func NewBitmaps() *Bitmaps {
+	return &Bitmaps{
+		M: make(map[string]*Bitmap),
+	}
+}
+
+// SetBit sets or clears the bit at offset of the bitmap stored at key, it returns the old bit.
+func (bs *Bitmaps) SetBit(key string, offset uint32, value bool) bool {
+	b, ok := bs.M[key]
+	if !ok {
+		b = New()
+		bs.M[key] = b
+	}
+
+	if value {
+		return !b.Add(offset)
+	}
+
+	return b.Remove(offset)
+}
+
+// GetBit returns the bit at offset of the bitmap stored at key.
+func (bs *Bitmaps) GetBit(key string, offset uint32) bool {
+	b, ok := bs.M[key]
+
+	return ok && b.Contains(offset)
+}
+
+// Get returns the bitmap stored at key, or nil if there is none.
+func (bs *Bitmaps) Get(key string) *Bitmap {
+	return bs.M[key]
+}
+
+// Store replaces the bitmap stored at key with b, an empty bitmap removes the key.
+func (bs *Bitmaps) Store(key string, b *Bitmap) {
+	if b == nil || b.IsEmpty() {
+		delete(bs.M, key)
+		return
+	}
+
+	bs.M[key] = b
+}
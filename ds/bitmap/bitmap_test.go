@@ -0,0 +1,137 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bitmap
+
+import (
+	"reflect"
+	"testing"
+)
+
+// newBitmap returns the bitmap of the offsets in [from, to) every step.
+func newBitmap(from, to, step uint32) *Bitmap {
+	b := New()
+	for x := from; x < to; x += step {
+		b.Add(x)
+	}
+	return b
+}
+
+func TestBitmap_AddAndRemove(t *testing.T) {
+	b := New()
+
+	for _, x := range []uint32{3, 1, 1 << 16, 1<<32 - 1} {
+		if !b.Add(x) {
+			t.Errorf("err Add %d, got false want true", x)
+		}
+	}
+	if b.Add(3) {
+		t.Error("err Add 3 again, got true want false")
+	}
+
+	if got, want := b.ToArray(), []uint32{1, 3, 1 << 16, 1<<32 - 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("err ToArray, got %v want %v", got, want)
+	}
+
+	if !b.Remove(1<<16) || b.Remove(1<<16) || b.Contains(1<<16) {
+		t.Error("err Remove 65536")
+	}
+	if b.Count() != 3 {
+		t.Errorf("err Count, got %d want 3", b.Count())
+	}
+
+	// the container turns into a bitset past arrayMaxSize members and back.
+	b = newBitmap(0, arrayMaxSize+1, 1)
+	if b.containers[0].bitset == nil {
+		t.Error("err Add, the dense container is not a bitset")
+	}
+	b.Remove(0)
+	if b.containers[0].bitset != nil || b.Count() != arrayMaxSize || !b.Contains(arrayMaxSize) {
+		t.Error("err Remove, the sparse container is not an array")
+	}
+}
+
+func TestBitmap_Operations(t *testing.T) {
+	even := newBitmap(0, 20000, 2)
+	low := newBitmap(0, 10000, 1)
+
+	tests := []struct {
+		name string
+		got  *Bitmap
+		want *Bitmap
+	}{
+		{"And", even.And(low), newBitmap(0, 10000, 2)},
+		{"Or", even.Or(low), newBitmap(0, 10000, 1).Or(newBitmap(10000, 20000, 2))},
+		{"Xor", even.Xor(low), newBitmap(1, 10000, 2).Or(newBitmap(10000, 20000, 2))},
+		{"And sparse", newBitmap(0, 100, 3).And(newBitmap(0, 100, 5)), newBitmap(0, 100, 15)},
+		{"Or disjoint", newBitmap(0, 10, 1).Or(newBitmap(1<<20, 1<<20+10, 1)), newBitmap(0, 10, 1).Or(newBitmap(1<<20, 1<<20+10, 1))},
+	}
+
+	for _, tt := range tests {
+		if got, want := tt.got.ToArray(), tt.want.ToArray(); !reflect.DeepEqual(got, want) {
+			t.Errorf("err %s, got %d offsets want %d", tt.name, len(got), len(want))
+		}
+	}
+
+	if even.Count() != 10000 || low.Count() != 10000 {
+		t.Error("err operations, the operands are changed")
+	}
+}
+
+func TestBitmap_MarshalBinary(t *testing.T) {
+	b := newBitmap(0, 10000, 1).Or(newBitmap(1<<20, 1<<20+100, 7))
+
+	data, err := b.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nb := New()
+	if err := nb.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(nb.ToArray(), b.ToArray()) {
+		t.Error("err UnmarshalBinary, got a different bitmap")
+	}
+
+	for _, bad := range [][]byte{nil, data[:len(data)-1], append(data, 0)} {
+		if err := New().UnmarshalBinary(bad); err != ErrInvalidData {
+			t.Errorf("err UnmarshalBinary, got %v want %v", err, ErrInvalidData)
+		}
+	}
+}
+
+func TestBitmaps(t *testing.T) {
+	bs := NewBitmaps()
+
+	if old := bs.SetBit("key", 5, true); old {
+		t.Error("err SetBit, got old bit true want false")
+	}
+	if old := bs.SetBit("key", 5, false); !old {
+		t.Error("err SetBit, got old bit false want true")
+	}
+	if bs.GetBit("key", 5) || bs.GetBit("key_fake", 5) {
+		t.Error("err GetBit, got true want false")
+	}
+
+	bs.Store("key", newBitmap(0, 3, 1))
+	if bs.Get("key").Count() != 3 {
+		t.Errorf("err Store, got %d want 3", bs.Get("key").Count())
+	}
+
+	bs.Store("key", New())
+	if bs.Get("key") != nil {
+		t.Error("err Store, the empty bitmap is not removed")
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hll
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+// newHLL returns the sketch of the items in [from, to).
+func newHLL(from, to int) *HLL {
+	h := New()
+	for i := from; i < to; i++ {
+		h.Add([]byte(fmt.Sprintf("item_%d", i)))
+	}
+	return h
+}
+
+func checkCount(t *testing.T, h *HLL, want int) {
+	t.Helper()
+
+	got := h.Count()
+	if e := math.Abs(float64(got)-float64(want)) / float64(want); e > 0.03 {
+		t.Errorf("err Count, got %d want %d, error %.4f", got, want, e)
+	}
+}
+
+func TestHLL_Count(t *testing.T) {
+	if n := New().Count(); n != 0 {
+		t.Errorf("err Count, got %d want 0", n)
+	}
+
+	for _, n := range []int{10, 1000, 100000, 1000000} {
+		checkCount(t, newHLL(0, n), n)
+	}
+
+	h := newHLL(0, 1000)
+	if h.Add([]byte("item_1")) {
+		t.Error("err Add, the register is changed by an item added again")
+	}
+}
+
+func TestHLL_Merge(t *testing.T) {
+	h := newHLL(0, 60000)
+	h.Merge(newHLL(40000, 100000))
+
+	checkCount(t, h, 100000)
+}
+
+func TestHLL_MarshalBinary(t *testing.T) {
+	for _, n := range []int{0, 100, 100000} {
+		h := newHLL(0, n)
+
+		data, err := h.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n == 100 && len(data) > len(magic)+1+3*100 {
+			t.Errorf("err MarshalBinary, got %d bytes for the sparse sketch", len(data))
+		}
+		if len(data) > len(magic)+1+denseSize {
+			t.Errorf("err MarshalBinary, got %d bytes, more than the dense sketch", len(data))
+		}
+
+		nh := New()
+		if err := nh.UnmarshalBinary(data); err != nil {
+			t.Fatal(err)
+		}
+		if nh.regs != h.regs {
+			t.Errorf("err UnmarshalBinary %d items, got different registers", n)
+		}
+	}
+
+	for _, bad := range [][]byte{nil, []byte("val"), append(append([]byte(nil), magic...), denseEncoding, 0)} {
+		if err := New().UnmarshalBinary(bad); err != ErrInvalidData {
+			t.Errorf("err UnmarshalBinary %q, got %v want %v", bad, err, ErrInvalidData)
+		}
+	}
+}
@@ -28,6 +28,9 @@ var (
 
 	//ErrCount is returned when count is error.
 	ErrCount = errors.New("err count")
+
+	// ErrPivotNotFound is returned when the pivot of LInsert is not in the list.
+	ErrPivotNotFound = errors.New("pivot not found")
 )
 
 // List represents the list.
@@ -295,6 +298,40 @@ func (l *List) LSet(key string, index int, value []byte) error {
 	return nil
 }
 
+// LIndex returns the index of the first element equal to value in the list stored at key, or -1.
+func (l *List) LIndex(key string, value []byte) int {
+	for i, item := range l.Items[key] {
+		if bytes.Equal(item, value) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// LInsert inserts value before the element at index in the list stored at key,
+// an index out of range inserts it at the head or at the tail.
+func (l *List) LInsert(key string, index int, value []byte) error {
+	items, ok := l.Items[key]
+	if !ok {
+		return ErrListNotFound
+	}
+
+	if index < 0 {
+		index = 0
+	}
+	if index > len(items) {
+		index = len(items)
+	}
+
+	newItems := make([][]byte, 0, len(items)+1)
+	newItems = append(newItems, items[:index]...)
+	newItems = append(newItems, value)
+	l.Items[key] = append(newItems, items[index:]...)
+
+	return nil
+}
+
 // Ltrim trim an existing list so that it will contain only the specified range of elements specified.
 func (l *List) Ltrim(key string, start, end int) error {
 	if _, ok := l.Items[key]; !ok {
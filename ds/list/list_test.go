@@ -416,3 +416,27 @@ func getExpectResult(items ...string) map[string]struct{} {
 
 	return expectResult
 }
+
+func TestList_LInsert(t *testing.T) {
+	list, key := InitListData()
+
+	if i := list.LIndex(key, []byte("b")); i != 1 {
+		t.Errorf("TestList_LInsert err, got index %d want 1", i)
+	}
+	if i := list.LIndex(key, []byte("z")); i != -1 {
+		t.Errorf("TestList_LInsert err, got index %d want -1", i)
+	}
+
+	list.LInsert(key, 1, []byte("a1"))
+	list.LInsert(key, -1, []byte("head"))
+	list.LInsert(key, 100, []byte("tail"))
+
+	items, _ := list.LRange(key, 0, -1)
+	if len(items) != 7 || string(items[0]) != "head" || string(items[2]) != "a1" || string(items[6]) != "tail" {
+		t.Errorf("TestList_LInsert err, got %s", items)
+	}
+
+	if err := list.LInsert("key_fake", 0, []byte("a")); err != ErrListNotFound {
+		t.Errorf("TestList_LInsert err, got %v want %v", err, ErrListNotFound)
+	}
+}
@@ -15,7 +15,20 @@
 package set
 
 import (
+	"container/heap"
 	"errors"
+	"fmt"
+)
+
+var (
+	// ErrKeyNotFound is returned when the set stored at key does not exist.
+	ErrKeyNotFound = errors.New("key not found")
+
+	// ErrItemEmpty is returned when the item to remove is empty.
+	ErrItemEmpty = errors.New("item empty")
+
+	// ErrItemNotFound is returned when the item is not a member of the set.
+	ErrItemNotFound = errors.New("item not found")
 )
 
 // Set represents the Set.
@@ -46,11 +59,11 @@ func (s *Set) SAdd(key string, items ...[]byte) error {
 //SRem removes the specified members from the set stored at key.
 func (s *Set) SRem(key string, items ...[]byte) error {
 	if _, ok := s.M[key]; !ok {
-		return errors.New("key not found")
+		return ErrKeyNotFound
 	}
 
 	if len(items[0]) == 0 {
-		return errors.New("item empty")
+		return ErrItemEmpty
 	}
 
 	for _, item := range items {
@@ -125,11 +138,11 @@ func (s *Set) SInter(key1, key2 string) (list [][]byte, err error) {
 // checkKey1AndKey2 returns if key1 and key2 exists.
 func (s *Set) checkKey1AndKey2(key1, key2 string) (list [][]byte, err error) {
 	if _, ok := s.M[key1]; !ok {
-		return nil, errors.New("set1 is not exists")
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, key1)
 	}
 
 	if _, ok := s.M[key2]; !ok {
-		return nil, errors.New("set2 is not exists")
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, key2)
 	}
 
 	return nil, nil
@@ -152,12 +165,12 @@ func (s *Set) SIsMember(key string, item []byte) bool {
 // For multiple items it returns true only if all of  the items exist.
 func (s *Set) SAreMembers(key string, items ...[]byte) (bool, error) {
 	if _, ok := s.M[key]; !ok {
-		return false, errors.New("key not exits")
+		return false, ErrKeyNotFound
 	}
 
 	for _, item := range items {
 		if _, ok := s.M[key][string(item)]; !ok {
-			return false, errors.New("item not exits")
+			return false, ErrItemNotFound
 		}
 	}
 
@@ -167,7 +180,7 @@ func (s *Set) SAreMembers(key string, items ...[]byte) (bool, error) {
 // SMembers returns all the members of the set value stored at key.
 func (s *Set) SMembers(key string) (list [][]byte, err error) {
 	if _, ok := s.M[key]; !ok {
-		return nil, errors.New("set not exists")
+		return nil, ErrKeyNotFound
 	}
 
 	for item := range s.M[key] {
@@ -177,14 +190,62 @@ func (s *Set) SMembers(key string) (list [][]byte, err error) {
 	return
 }
 
+// SScan returns at most count members of the set stored at key following the member after,
+// in ascending order, or from the first member if after is nil.
+// The set is not sorted, so each call walks all its members but only keeps count of them.
+func (s *Set) SScan(key string, after []byte, count int) (list [][]byte, err error) {
+	if _, ok := s.M[key]; !ok {
+		return nil, ErrKeyNotFound
+	}
+
+	h := &maxHeap{}
+	for item := range s.M[key] {
+		if after != nil && item <= string(after) {
+			continue
+		}
+
+		if h.Len() < count {
+			heap.Push(h, item)
+		} else if h.Len() > 0 && item < (*h)[0] {
+			(*h)[0] = item
+			heap.Fix(h, 0)
+		}
+	}
+
+	list = make([][]byte, h.Len())
+	for i := len(list) - 1; i >= 0; i-- {
+		list[i] = []byte(heap.Pop(h).(string))
+	}
+
+	return
+}
+
+// maxHeap is a heap of the greatest members kept by SScan on top.
+type maxHeap []string
+
+func (h maxHeap) Len() int           { return len(h) }
+func (h maxHeap) Less(i, j int) bool { return h[i] > h[j] }
+func (h maxHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *maxHeap) Push(x interface{}) {
+	*h = append(*h, x.(string))
+}
+
+func (h *maxHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
 // SMove moves member from the set at source to the set at destination.
 func (s *Set) SMove(key1, key2 string, item []byte) (bool, error) {
 	if !s.SHasKey(key1) {
-		return false, errors.New("key1 is not exists")
+		return false, fmt.Errorf("%w: %s", ErrKeyNotFound, key1)
 	}
 
 	if !s.SHasKey(key2) {
-		return false, errors.New("key2 is not exists")
+		return false, fmt.Errorf("%w: %s", ErrKeyNotFound, key2)
 	}
 
 	if _, ok := s.M[key2][string(item)]; !ok {
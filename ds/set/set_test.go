@@ -165,6 +165,30 @@ func TestSet_SMembers(t *testing.T) {
 	}
 }
 
+func TestSet_SScan(t *testing.T) {
+	key := "mySetForScan"
+	mySet.SAdd(key, []byte("d"), []byte("a"), []byte("c"), []byte("e"), []byte("b"))
+
+	list, err := mySet.SScan(key, nil, 2)
+	if err != nil || len(list) != 2 || string(list[0]) != "a" || string(list[1]) != "b" {
+		t.Error("TestSet_SScan err")
+	}
+
+	list, err = mySet.SScan(key, []byte("b"), 2)
+	if err != nil || len(list) != 2 || string(list[0]) != "c" || string(list[1]) != "d" {
+		t.Error("TestSet_SScan err")
+	}
+
+	list, err = mySet.SScan(key, []byte("d"), 2)
+	if err != nil || len(list) != 1 || string(list[0]) != "e" {
+		t.Error("TestSet_SScan err")
+	}
+
+	if _, err := mySet.SScan("key_not_exists", nil, 2); err == nil {
+		t.Error("TestSet_SScan err")
+	}
+}
+
 func TestSet_SMove(t *testing.T) {
 	key1 := "mySet9"
 
@@ -279,20 +279,28 @@ func (ss *SortedSet) Remove(key string) *SortedSetNode {
 // GetByScoreRangeOptions represents the options of the GetByScoreRange function.
 type GetByScoreRangeOptions struct {
 	Limit        int  // limit the max nodes to return
+	Offset       int  // skip the first nodes of the range, in the order they are returned
 	ExcludeStart bool // exclude start value, so it search in interval (start, end] or (start, end)
 	ExcludeEnd   bool // exclude end value, so it search in interval [start, end) or (start, end)
+	Reverse      bool // return the nodes from the highest score to the lowest, as if start is greater than end
 }
 
 // GetByScoreRange returns the nodes whose score within the specific range.
 // If options is nil, it searches in interval [start, end] without any limit by default.
 //
-// Time complexity of this method is : O(log(N)).
+// Time complexity of this method is : O(log(N)), the offset is skipped by rank without
+// walking the skipped nodes.
 func (ss *SortedSet) GetByScoreRange(start SCORE, end SCORE, options *GetByScoreRangeOptions) []*SortedSetNode {
 	limit := 1<<31 - 1
 	if options != nil && options.Limit > 0 {
 		limit = options.Limit
 	}
 
+	offset := 0
+	if options != nil && options.Offset > 0 {
+		offset = options.Offset
+	}
+
 	excludeStart := options != nil && options.ExcludeStart
 	excludeEnd := options != nil && options.ExcludeEnd
 	reverse := start > end
@@ -300,6 +308,9 @@ func (ss *SortedSet) GetByScoreRange(start SCORE, end SCORE, options *GetByScore
 		start, end = end, start
 		excludeStart, excludeEnd = excludeEnd, excludeStart
 	}
+	if options != nil && options.Reverse {
+		reverse = true
+	}
 
 	var nodes []*SortedSetNode
 
@@ -310,19 +321,21 @@ func (ss *SortedSet) GetByScoreRange(start SCORE, end SCORE, options *GetByScore
 
 	if reverse {
 		// search from end to start
-		return ss.searchReverse(nodes, excludeStart, excludeEnd, start, end, limit)
+		return ss.searchReverse(nodes, excludeStart, excludeEnd, start, end, offset, limit)
 	}
 	// search from start to end
-	return ss.searchForward(nodes, excludeStart, excludeEnd, start, end, limit)
+	return ss.searchForward(nodes, excludeStart, excludeEnd, start, end, offset, limit)
 }
 
-func (ss *SortedSet) searchForward(nodes []*SortedSetNode, excludeStart, excludeEnd bool, start, end SCORE, limit int) []*SortedSetNode {
+func (ss *SortedSet) searchForward(nodes []*SortedSetNode, excludeStart, excludeEnd bool, start, end SCORE, offset, limit int) []*SortedSetNode {
 	// search from start to end
+	traversed := 0
 	x := ss.header
 	if excludeStart {
 		for i := ss.level - 1; i >= 0; i-- {
 			for x.level[i].forward != nil &&
 				x.level[i].forward.score <= start {
+				traversed += int(x.level[i].span)
 				x = x.level[i].forward
 			}
 		}
@@ -330,13 +343,18 @@ func (ss *SortedSet) searchForward(nodes []*SortedSetNode, excludeStart, exclude
 		for i := ss.level - 1; i >= 0; i-- {
 			for x.level[i].forward != nil &&
 				x.level[i].forward.score < start {
+				traversed += int(x.level[i].span)
 				x = x.level[i].forward
 			}
 		}
 	}
 
 	/* Current node is the last with score < or <= start. */
-	x = x.level[0].forward
+	if offset > 0 {
+		x = ss.nodeAtRank(traversed + 1 + offset)
+	} else {
+		x = x.level[0].forward
+	}
 
 	for x != nil && limit > 0 {
 		if excludeEnd {
@@ -360,13 +378,15 @@ func (ss *SortedSet) searchForward(nodes []*SortedSetNode, excludeStart, exclude
 	return nodes
 }
 
-func (ss *SortedSet) searchReverse(nodes []*SortedSetNode, excludeStart, excludeEnd bool, start, end SCORE, limit int) []*SortedSetNode {
+func (ss *SortedSet) searchReverse(nodes []*SortedSetNode, excludeStart, excludeEnd bool, start, end SCORE, offset, limit int) []*SortedSetNode {
+	traversed := 0
 	x := ss.header
 
 	if excludeEnd {
 		for i := ss.level - 1; i >= 0; i-- {
 			for x.level[i].forward != nil &&
 				x.level[i].forward.score < end {
+				traversed += int(x.level[i].span)
 				x = x.level[i].forward
 			}
 		}
@@ -374,11 +394,19 @@ func (ss *SortedSet) searchReverse(nodes []*SortedSetNode, excludeStart, exclude
 		for i := ss.level - 1; i >= 0; i-- {
 			for x.level[i].forward != nil &&
 				x.level[i].forward.score <= end {
+				traversed += int(x.level[i].span)
 				x = x.level[i].forward
 			}
 		}
 	}
 
+	/* Current node is the last with score < or <= end. */
+	if offset > 0 {
+		x = ss.nodeAtRank(traversed - offset)
+	} else if x == ss.header {
+		x = nil
+	}
+
 	for x != nil && limit > 0 {
 		if excludeStart {
 			if x.score <= start {
@@ -401,6 +429,56 @@ func (ss *SortedSet) searchReverse(nodes []*SortedSetNode, excludeStart, exclude
 	return nodes
 }
 
+// nodeAtRank returns the node at given 1-based rank, or nil if rank is out of range.
+func (ss *SortedSet) nodeAtRank(rank int) *SortedSetNode {
+	if rank <= 0 || rank > int(ss.length) {
+		return nil
+	}
+
+	traversed := 0
+	x := ss.header
+	for i := ss.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil &&
+			traversed+int(x.level[i].span) <= rank {
+			traversed += int(x.level[i].span)
+			x = x.level[i].forward
+		}
+		if traversed == rank {
+			return x
+		}
+	}
+
+	return nil
+}
+
+// GetAfter returns at most limit nodes following the position of the score and key,
+// in the order of the scores then of the keys. The node at the position needs not exist.
+//
+// Time complexity of this method is : O(log(N)+limit).
+func (ss *SortedSet) GetAfter(score SCORE, key string, limit int) []*SortedSetNode {
+	var nodes []*SortedSetNode
+
+	x := ss.header
+	for i := ss.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil &&
+			(x.level[i].forward.score < score ||
+				(x.level[i].forward.score == score &&
+					x.level[i].forward.key <= key)) {
+			x = x.level[i].forward
+		}
+	}
+
+	/* Current node is the last at or before the position. */
+	x = x.level[0].forward
+
+	for x != nil && len(nodes) < limit {
+		nodes = append(nodes, x)
+		x = x.level[0].forward
+	}
+
+	return nodes
+}
+
 // GetByRankRange returns nodes within specific rank range [start, end].
 // Note that the rank is 1-based integer. Rank 1 means the first node; Rank -1 means the last node
 // If start is greater than end, the returned array is in reserved order
@@ -14,6 +14,7 @@
 package zset
 
 import (
+	"fmt"
 	"testing"
 )
 
@@ -281,6 +282,92 @@ func TestSortedSet_GetByScoreRange2(t *testing.T) {
 	}
 }
 
+func nodeKeys(nodes []*SortedSetNode) (keys []string) {
+	for _, n := range nodes {
+		keys = append(keys, n.key)
+	}
+	return
+}
+
+func TestSortedSet_GetByScoreRange_OffsetAndReverse(t *testing.T) {
+	InitData()
+
+	tests := []struct {
+		start, end SCORE
+		options    *GetByScoreRangeOptions
+		want       string
+	}{
+		{10, 100, &GetByScoreRangeOptions{Offset: 1, Limit: 2}, "[key3 key4]"},
+		{10, 100, &GetByScoreRangeOptions{Offset: 3}, "[key5]"},
+		{10, 100, &GetByScoreRangeOptions{Offset: 4}, "[]"},
+		{10, 100, &GetByScoreRangeOptions{Reverse: true}, "[key5 key4 key3 key2]"},
+		{10, 100, &GetByScoreRangeOptions{Reverse: true, Offset: 1, Limit: 2}, "[key4 key3]"},
+		{100, 10, &GetByScoreRangeOptions{Offset: 3}, "[key2]"},
+		{10, 100, &GetByScoreRangeOptions{Reverse: true, ExcludeEnd: true}, "[key3 key2]"},
+		{-10, 0, &GetByScoreRangeOptions{Reverse: true}, "[]"},
+		{200, 300, &GetByScoreRangeOptions{Offset: 1}, "[]"},
+	}
+
+	for _, tt := range tests {
+		if got := fmt.Sprint(nodeKeys(ss.GetByScoreRange(tt.start, tt.end, tt.options))); got != tt.want {
+			t.Errorf("TestSortedSet_GetByScoreRange_OffsetAndReverse err, %v %v %+v got %s want %s", tt.start, tt.end, tt.options, got, tt.want)
+		}
+	}
+
+	// the offset skipped by rank gives the same nodes as walking them.
+	ss = New()
+	for i := 0; i < 1000; i++ {
+		ss.Put(fmt.Sprintf("key%04d", i), SCORE(i/3), nil)
+	}
+
+	for _, offset := range []int{1, 7, 100, 500, 750} {
+		all := ss.GetByScoreRange(50, 300, nil)
+		got := ss.GetByScoreRange(50, 300, &GetByScoreRangeOptions{Offset: offset, Limit: 5})
+		want := all[offset:]
+		if len(want) > 5 {
+			want = want[:5]
+		}
+		if fmt.Sprint(nodeKeys(got)) != fmt.Sprint(nodeKeys(want)) {
+			t.Errorf("TestSortedSet_GetByScoreRange_OffsetAndReverse err, offset %d got %v want %v", offset, nodeKeys(got), nodeKeys(want))
+		}
+
+		all = ss.GetByScoreRange(300, 50, nil)
+		got = ss.GetByScoreRange(50, 300, &GetByScoreRangeOptions{Offset: offset, Limit: 5, Reverse: true})
+		want = all[offset:]
+		if len(want) > 5 {
+			want = want[:5]
+		}
+		if fmt.Sprint(nodeKeys(got)) != fmt.Sprint(nodeKeys(want)) {
+			t.Errorf("TestSortedSet_GetByScoreRange_OffsetAndReverse err, reverse offset %d got %v want %v", offset, nodeKeys(got), nodeKeys(want))
+		}
+	}
+}
+
+func TestSortedSet_GetAfter(t *testing.T) {
+	InitData()
+
+	nodes := ss.GetAfter(10, "key2", 2)
+	if len(nodes) != 2 || nodes[0].key != "key3" || nodes[1].key != "key4" {
+		t.Error("TestSortedSet_GetAfter err")
+	}
+
+	// the members with the same score are ordered by their keys.
+	nodes = ss.GetAfter(100, "key4", 2)
+	if len(nodes) != 1 || nodes[0].key != "key5" {
+		t.Error("TestSortedSet_GetAfter err")
+	}
+
+	// the position needs not be a member.
+	nodes = ss.GetAfter(50, "", 10)
+	if len(nodes) != 3 || nodes[0].key != "key3" {
+		t.Error("TestSortedSet_GetAfter err")
+	}
+
+	if nodes = ss.GetAfter(100, "key5", 10); len(nodes) != 0 {
+		t.Error("TestSortedSet_GetAfter err")
+	}
+}
+
 func TestSortedSet_PeekMax(t *testing.T) {
 	InitData()
 
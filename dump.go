@@ -0,0 +1,448 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/xujiajun/nutsdb/ds/bitmap"
+	"github.com/xujiajun/nutsdb/ds/zset"
+)
+
+// ExportFormat represents the format of the dumps written by Export.
+type ExportFormat int
+
+const (
+	// ExportJSON represents the JSON lines format, one JSON object per line,
+	// the keys and values are base64 encoded strings.
+	ExportJSON ExportFormat = iota
+
+	// ExportBinary represents the compact binary format.
+	ExportBinary
+)
+
+// ErrDumpFormat is returned when the dump format is unknown or the dump is malformed.
+var ErrDumpFormat = errors.New("invalid dump format")
+
+// importBatchSize is the number of records imported in one transaction.
+const importBatchSize = 1000
+
+// dumpMagic starts the dumps in the binary format, the last byte is the version.
+var dumpMagic = []byte("NUTSDUMP\x01")
+
+// the data structures of the dump records.
+const (
+	dumpKV     = "kv"
+	dumpSet    = "set"
+	dumpZSet   = "zset"
+	dumpList   = "list"
+	dumpBitmap = "bitmap"
+)
+
+var dumpDSCodes = map[string]byte{dumpKV: 1, dumpSet: 2, dumpZSet: 3, dumpList: 4, dumpBitmap: 5}
+
+// dumpRecord is a key/value pair, a set member, a sorted set member, a list item or a whole bitmap.
+type dumpRecord struct {
+	DS        string  `json:"ds"`
+	Bucket    string  `json:"bucket"`
+	Key       []byte  `json:"key"`
+	Value     []byte  `json:"value"`
+	Score     float64 `json:"score,omitempty"`
+	TTL       uint32  `json:"ttl,omitempty"`
+	Timestamp uint64  `json:"timestamp,omitempty"`
+}
+
+// Export writes all the live data of the db to w in the format, within a read-only
+// transaction: the key/value pairs and the members of the sorted sets with their TTL, the sets,
+// the lists and the bitmaps.
+// The dumps are read by Import, whatever the version of the db which wrote them.
+func (db *DB) Export(w io.Writer, format ExportFormat) error {
+	bw := bufio.NewWriter(w)
+
+	var write func(r *dumpRecord) error
+
+	switch format {
+	case ExportJSON:
+		enc := json.NewEncoder(bw)
+		write = func(r *dumpRecord) error {
+			return enc.Encode(r)
+		}
+	case ExportBinary:
+		if _, err := bw.Write(dumpMagic); err != nil {
+			return err
+		}
+		write = func(r *dumpRecord) error {
+			_, err := bw.Write(r.encode())
+			return err
+		}
+	default:
+		return ErrDumpFormat
+	}
+
+	if err := db.View(func(tx *Tx) error {
+		return tx.export(write)
+	}); err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// export calls write with the records of all the buckets, in the order of the buckets and the keys.
+func (tx *Tx) export(write func(r *dumpRecord) error) error {
+	names := tx.bucketNames()
+	buckets := make([]string, 0, len(names))
+	for bucket := range names {
+		buckets = append(buckets, bucket)
+	}
+	sort.Strings(buckets)
+
+	now := uint64(time.Now().Unix())
+
+	for _, bucket := range buckets {
+		if entries, err := tx.GetAll(bucket); err == nil {
+			for _, e := range entries {
+				if err := write(&dumpRecord{DS: dumpKV, Bucket: bucket, Key: e.Key, Value: e.Value,
+					TTL: e.Meta.TTL, Timestamp: e.Meta.timestamp}); err != nil {
+					return err
+				}
+			}
+		}
+
+		if s, ok := tx.db.SetIdx[bucket]; ok {
+			for _, key := range sortedKeys(s.M) {
+				members := make([]string, 0, len(s.M[key]))
+				for member := range s.M[key] {
+					members = append(members, member)
+				}
+				sort.Strings(members)
+
+				for _, member := range members {
+					if err := write(&dumpRecord{DS: dumpSet, Bucket: bucket, Key: []byte(key), Value: []byte(member)}); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		if ss, ok := tx.db.SortedSetIdx[bucket]; ok {
+			for _, key := range sortedKeys(ss.Dict) {
+				node := ss.Dict[key]
+				rec := &dumpRecord{DS: dumpZSet, Bucket: bucket, Key: []byte(key), Value: node.Value,
+					Score: float64(node.Score())}
+
+				// the TTL of a member is the one left at the export, the expired members are skipped.
+				if deadline, ok := tx.db.zsetDeadlines[bucket][key]; ok {
+					if deadline <= now {
+						continue
+					}
+					rec.TTL, rec.Timestamp = uint32(deadline-now), now
+				}
+
+				if err := write(rec); err != nil {
+					return err
+				}
+			}
+		}
+
+		if l, ok := tx.db.ListIdx[bucket]; ok {
+			for _, key := range sortedKeys(l.Items) {
+				for _, item := range l.Items[key] {
+					if err := write(&dumpRecord{DS: dumpList, Bucket: bucket, Key: []byte(key), Value: item}); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		if bs, ok := tx.db.BitmapIdx[bucket]; ok {
+			for _, key := range sortedKeys(bs.M) {
+				value, err := bs.M[key].MarshalBinary()
+				if err != nil {
+					return err
+				}
+				if err := write(&dumpRecord{DS: dumpBitmap, Bucket: bucket, Key: []byte(key), Value: value}); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// sortedKeys returns the sorted keys of the map of a set, sorted set or list index.
+func sortedKeys(m interface{}) []string {
+	var keys []string
+
+	switch m := m.(type) {
+	case map[string]map[string]struct{}:
+		for key := range m {
+			keys = append(keys, key)
+		}
+	case map[string]*zset.SortedSetNode:
+		for key := range m {
+			keys = append(keys, key)
+		}
+	case map[string][][]byte:
+		for key := range m {
+			keys = append(keys, key)
+		}
+	case map[string]*bitmap.Bitmap:
+		for key := range m {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Import reads a dump written by Export in any format and writes its records to the db,
+// in transactions of importBatchSize records. The key/value pairs keep their TTL from the
+// time they were written, the list items are pushed at the tail of the lists.
+func (db *DB) Import(r io.Reader) error {
+	br := bufio.NewReader(r)
+
+	var read func() (*dumpRecord, error)
+
+	if head, _ := br.Peek(len(dumpMagic)); bytes.Equal(head, dumpMagic) {
+		if _, err := br.Discard(len(dumpMagic)); err != nil {
+			return err
+		}
+		read = func() (*dumpRecord, error) {
+			return readDumpRecord(br)
+		}
+	} else {
+		dec := json.NewDecoder(br)
+		read = func() (*dumpRecord, error) {
+			rec := &dumpRecord{}
+			if err := dec.Decode(rec); err != nil {
+				if err == io.EOF {
+					return nil, err
+				}
+				return nil, ErrDumpFormat
+			}
+			return rec, nil
+		}
+	}
+
+	for {
+		batch := make([]*dumpRecord, 0, importBatchSize)
+		for len(batch) < importBatchSize {
+			rec, err := read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			batch = append(batch, rec)
+		}
+
+		if len(batch) == 0 {
+			return nil
+		}
+
+		if err := db.Update(func(tx *Tx) error {
+			for _, rec := range batch {
+				if err := tx.importRecord(rec); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		if len(batch) < importBatchSize {
+			return nil
+		}
+	}
+}
+
+// importRecord writes the record of a dump.
+func (tx *Tx) importRecord(rec *dumpRecord) error {
+	// the records written by hand may have no timestamp.
+	if rec.Timestamp == 0 {
+		rec.Timestamp = uint64(time.Now().Unix())
+	}
+
+	switch rec.DS {
+	case dumpKV:
+		return tx.PutWithTimestamp(rec.Bucket, rec.Key, rec.Value, rec.TTL, rec.Timestamp)
+	case dumpSet:
+		return tx.SAdd(rec.Bucket, rec.Key, rec.Value)
+	case dumpZSet:
+		return tx.zadd(rec.Bucket, rec.Key, rec.Score, rec.Value, rec.TTL, rec.Timestamp)
+	case dumpList:
+		return tx.RPush(rec.Bucket, rec.Key, rec.Value)
+	case dumpBitmap:
+		b := bitmap.New()
+		if err := b.UnmarshalBinary(rec.Value); err != nil {
+			return ErrDumpFormat
+		}
+		return tx.storeBitmap(rec.Bucket, rec.Key, b)
+	}
+
+	return ErrDumpFormat
+}
+
+// encode returns the record in the binary format:
+//
+//	| ds | bucket size | bucket | key size | key | value size | value | TTL | timestamp | score | crc |
+//	|byte|   uvarint   | []byte | uvarint  |[]byte|  uvarint  |[]byte |uvarint| uvarint | uint64|uint32|
+//
+// the crc is the crc32 of the record before it.
+func (r *dumpRecord) encode() []byte {
+	buf := make([]byte, 0, 1+3*binary.MaxVarintLen32+len(r.Bucket)+len(r.Key)+len(r.Value)+
+		binary.MaxVarintLen32+binary.MaxVarintLen64+8+4)
+
+	buf = append(buf, dumpDSCodes[r.DS])
+	buf = appendDumpBytes(buf, []byte(r.Bucket))
+	buf = appendDumpBytes(buf, r.Key)
+	buf = appendDumpBytes(buf, r.Value)
+	buf = appendUvarint(buf, uint64(r.TTL))
+	buf = appendUvarint(buf, r.Timestamp)
+
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], math.Float64bits(r.Score))
+	buf = append(buf, b[:]...)
+
+	binary.LittleEndian.PutUint32(b[:4], crc32.ChecksumIEEE(buf))
+
+	return append(buf, b[:4]...)
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], v)
+	return append(buf, b[:n]...)
+}
+
+func appendDumpBytes(buf, b []byte) []byte {
+	buf = appendUvarint(buf, uint64(len(b)))
+	return append(buf, b...)
+}
+
+// dumpReader reads a record in the binary format and keeps its bytes for the crc.
+type dumpReader struct {
+	r   *bufio.Reader
+	buf []byte
+}
+
+func (dr *dumpReader) ReadByte() (byte, error) {
+	c, err := dr.r.ReadByte()
+	if err == nil {
+		dr.buf = append(dr.buf, c)
+	}
+	return c, err
+}
+
+func (dr *dumpReader) readFull(n uint64) ([]byte, error) {
+	if n > math.MaxUint32 {
+		return nil, ErrDumpFormat
+	}
+
+	b := make([]byte, n)
+	if _, err := io.ReadFull(dr.r, b); err != nil {
+		return nil, ErrDumpFormat
+	}
+	dr.buf = append(dr.buf, b...)
+
+	return b, nil
+}
+
+func (dr *dumpReader) readBytes() ([]byte, error) {
+	n, err := binary.ReadUvarint(dr)
+	if err != nil {
+		return nil, ErrDumpFormat
+	}
+
+	return dr.readFull(n)
+}
+
+// readDumpRecord reads a record in the binary format, it returns io.EOF at the end of the dump.
+func readDumpRecord(r *bufio.Reader) (*dumpRecord, error) {
+	dr := &dumpReader{r: r}
+
+	code, err := dr.ReadByte()
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rec := &dumpRecord{}
+	for ds, c := range dumpDSCodes {
+		if c == code {
+			rec.DS = ds
+		}
+	}
+	if rec.DS == "" {
+		return nil, ErrDumpFormat
+	}
+
+	bucket, err := dr.readBytes()
+	if err != nil {
+		return nil, err
+	}
+	rec.Bucket = string(bucket)
+
+	if rec.Key, err = dr.readBytes(); err != nil {
+		return nil, err
+	}
+	if rec.Value, err = dr.readBytes(); err != nil {
+		return nil, err
+	}
+
+	ttl, err := binary.ReadUvarint(dr)
+	if err != nil || ttl > math.MaxUint32 {
+		return nil, ErrDumpFormat
+	}
+	rec.TTL = uint32(ttl)
+
+	if rec.Timestamp, err = binary.ReadUvarint(dr); err != nil {
+		return nil, ErrDumpFormat
+	}
+
+	score, err := dr.readFull(8)
+	if err != nil {
+		return nil, err
+	}
+	rec.Score = math.Float64frombits(binary.LittleEndian.Uint64(score))
+
+	checksum := crc32.ChecksumIEEE(dr.buf)
+	crc, err := dr.readFull(4)
+	if err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(crc) != checksum {
+		return nil, ErrDumpFormat
+	}
+
+	return rec, nil
+}
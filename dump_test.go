@@ -0,0 +1,180 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDB_ExportImport(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestforexport", true)
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Update(func(tx *Tx) error {
+		if err := tx.Put("kv", []byte("key_1"), []byte("val_1"), Persistent); err != nil {
+			return err
+		}
+		if err := tx.Put("kv", []byte("key_2"), []byte("val_2"), 100); err != nil {
+			return err
+		}
+		if err := tx.SAdd("set", []byte("key"), []byte("b"), []byte("a")); err != nil {
+			return err
+		}
+		if err := tx.ZAdd("zset", []byte("member_1"), 1.5, []byte("val_1")); err != nil {
+			return err
+		}
+		if err := tx.SetBit("bitmap", []byte("key"), 1000, true); err != nil {
+			return err
+		}
+		return tx.RPush("list", []byte("key"), []byte("c"), []byte("a"), []byte("b"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	dumps := make(map[ExportFormat][]byte)
+	for _, format := range []ExportFormat{ExportJSON, ExportBinary} {
+		var buf bytes.Buffer
+		if err := db.Export(&buf, format); err != nil {
+			t.Fatal(err)
+		}
+		dumps[format] = buf.Bytes()
+	}
+	db.Close()
+
+	if lines := strings.Count(string(dumps[ExportJSON]), "\n"); lines != 9 {
+		t.Errorf("err Export, got %d records want 9", lines)
+	}
+
+	for format, dump := range dumps {
+		InitOpt("/tmp/nutsdbtestforimport", true)
+		db, err = Open(opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := db.Import(bytes.NewReader(dump)); err != nil {
+			t.Fatal(err)
+		}
+
+		// the imported data is exported as it was.
+		var buf bytes.Buffer
+		if err := db.Export(&buf, format); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), dump) {
+			t.Errorf("format %d: err Import, got %q want %q", format, buf.Bytes(), dump)
+		}
+
+		if err := db.View(func(tx *Tx) error {
+			e, err := tx.Get("kv", []byte("key_2"))
+			if err != nil {
+				return err
+			}
+			if e.Meta.TTL != 100 {
+				t.Errorf("format %d: err TTL, got %d want 100", format, e.Meta.TTL)
+			}
+			items, err := tx.LRange("list", []byte("key"), 0, -1)
+			if err != nil {
+				return err
+			}
+			if len(items) != 3 || string(items[0]) != "c" {
+				t.Errorf("format %d: err LRange, got %q", format, items)
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		db.Close()
+	}
+
+	InitOpt("/tmp/nutsdbtestforimport", true)
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	corrupted := append([]byte{}, dumps[ExportBinary]...)
+	corrupted[len(dumpMagic)+5]++
+	if err := db.Import(bytes.NewReader(corrupted)); err != ErrDumpFormat {
+		t.Errorf("err Import, got %v want %v", err, ErrDumpFormat)
+	}
+	if err := db.Import(strings.NewReader("{not json")); err != ErrDumpFormat {
+		t.Errorf("err Import, got %v want %v", err, ErrDumpFormat)
+	}
+	if err := db.Export(&bytes.Buffer{}, ExportFormat(-1)); err != ErrDumpFormat {
+		t.Errorf("err Export, got %v want %v", err, ErrDumpFormat)
+	}
+}
+
+func TestDB_ExportImport_ZSetTTL(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestforexport", true)
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := uint64(time.Now().Unix())
+	if err := db.Update(func(tx *Tx) error {
+		if err := tx.ZAdd("zset", []byte("persistent"), 1, nil); err != nil {
+			return err
+		}
+		if err := tx.ZAddWithTTL("zset", []byte("ttl"), 2, nil, 100); err != nil {
+			return err
+		}
+		// expired before the export.
+		return tx.zadd("zset", []byte("expired"), 3, nil, 10, now-20)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := db.Export(&buf, ExportJSON); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	if lines := strings.Count(buf.String(), "\n"); lines != 2 {
+		t.Errorf("err Export, got %d records want 2", lines)
+	}
+
+	InitOpt("/tmp/nutsdbtestforimport", true)
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Import(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := db.zsetDeadlines["zset"]["persistent"]; ok {
+		t.Error("err Import, got a deadline for the persistent member")
+	}
+	if deadline := db.zsetDeadlines["zset"]["ttl"]; deadline < now+100 || deadline > now+101 {
+		t.Errorf("err Import, got the deadline %d want %d", deadline, now+100)
+	}
+	if _, ok := db.SortedSetIdx["zset"].Dict["expired"]; ok {
+		t.Error("err Import, got the expired member")
+	}
+}
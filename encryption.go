@@ -0,0 +1,209 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+)
+
+var (
+	// ErrEncryptionKeyNotFound is returned when the key encrypting an entry is not provided,
+	// or the entry is encrypted and Options.Encryption is not set.
+	ErrEncryptionKeyNotFound = errors.New("encryption key not found")
+
+	// ErrDecrypt is returned when an encrypted entry can not be decrypted.
+	ErrDecrypt = errors.New("decrypt entry err")
+)
+
+const (
+	// encryptedValue represents the value of the stored entry is encrypted.
+	encryptedValue uint16 = 1 << iota
+
+	// encryptedKey represents the key of the stored entry is encrypted.
+	encryptedKey
+)
+
+// encryptionKeyIDSize is the size of the key id prefixing an encrypted field.
+const encryptionKeyIDSize = 4
+
+// KeyProvider provides the encryption keys, it can be backed by a KMS.
+// The key of an id must not change once it is used to encrypt entries.
+type KeyProvider interface {
+	// CurrentKey returns the key encrypting the new entries and its id.
+	CurrentKey() (id uint32, key []byte, err error)
+
+	// Key returns the key of the id, to decrypt the entries written with it.
+	Key(id uint32) ([]byte, error)
+}
+
+// StaticKeyProvider is a KeyProvider holding the keys in memory.
+// To rotate the key, add a new key and set CurrentID to it, the older keys
+// must be kept until Merge re-encrypts the entries with the current key.
+type StaticKeyProvider struct {
+	CurrentID uint32
+	Keys      map[uint32][]byte
+}
+
+// CurrentKey implements KeyProvider.
+func (p *StaticKeyProvider) CurrentKey() (uint32, []byte, error) {
+	key, err := p.Key(p.CurrentID)
+	return p.CurrentID, key, err
+}
+
+// Key implements KeyProvider.
+func (p *StaticKeyProvider) Key(id uint32) ([]byte, error) {
+	key, ok := p.Keys[id]
+	if !ok {
+		return nil, ErrEncryptionKeyNotFound
+	}
+
+	return key, nil
+}
+
+// EncryptionOptions records params for encrypting the entries at rest.
+type EncryptionOptions struct {
+	// KeyProvider provides the encryption keys.
+	KeyProvider KeyProvider
+
+	// EncryptKeys represents whether the keys are encrypted as well as the values.
+	// The buckets and the B+ tree index files of HintBPTSparseIdxMode are not encrypted.
+	EncryptKeys bool
+
+	// NewAEAD returns the cipher of a key, default is AES-GCM.
+	NewAEAD func(key []byte) (cipher.AEAD, error)
+}
+
+// newAESGCM returns the AES-GCM cipher of the key, the key size selects AES-128, AES-192 or AES-256.
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// entryCipher encrypts and decrypts the stored entries, it caches the cipher of each key id.
+type entryCipher struct {
+	opt   *EncryptionOptions
+	mu    sync.Mutex
+	aeads map[uint32]cipher.AEAD
+}
+
+// newEntryCipher returns the entryCipher of the options, nil if encryption is disabled.
+func newEntryCipher(opt *EncryptionOptions) *entryCipher {
+	if opt == nil {
+		return nil
+	}
+
+	return &entryCipher{opt: opt, aeads: make(map[uint32]cipher.AEAD)}
+}
+
+// aead returns the cached cipher of the key id, key is nil unless it is the current key.
+func (ec *entryCipher) aead(id uint32, key []byte) (cipher.AEAD, error) {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+
+	if aead, ok := ec.aeads[id]; ok {
+		return aead, nil
+	}
+
+	if key == nil {
+		var err error
+		if key, err = ec.opt.KeyProvider.Key(id); err != nil {
+			return nil, err
+		}
+	}
+
+	newAEAD := ec.opt.NewAEAD
+	if newAEAD == nil {
+		newAEAD = newAESGCM
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	ec.aeads[id] = aead
+
+	return aead, nil
+}
+
+// encrypt encrypts the data with the current key.
+//
+//	the encrypted format:
+//	|---------------------------------|
+//	| key id | nonce  | sealed data   |
+//	|---------------------------------|
+//	| uint32 | []byte | []byte        |
+//	|---------------------------------|
+func (ec *entryCipher) encrypt(data []byte) ([]byte, error) {
+	id, key, err := ec.opt.KeyProvider.CurrentKey()
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := ec.aead(id, key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonceSize := aead.NonceSize()
+	buf := make([]byte, encryptionKeyIDSize+nonceSize, encryptionKeyIDSize+nonceSize+len(data)+aead.Overhead())
+	binary.LittleEndian.PutUint32(buf[:encryptionKeyIDSize], id)
+
+	nonce := buf[encryptionKeyIDSize:]
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(buf, nonce, data, nil), nil
+}
+
+// decrypt decrypts the data encrypted by encrypt.
+func (ec *entryCipher) decrypt(data []byte) ([]byte, error) {
+	if ec == nil {
+		return nil, ErrEncryptionKeyNotFound
+	}
+
+	if len(data) < encryptionKeyIDSize {
+		return nil, ErrDecrypt
+	}
+
+	aead, err := ec.aead(binary.LittleEndian.Uint32(data[:encryptionKeyIDSize]), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	data = data[encryptionKeyIDSize:]
+	nonceSize := aead.NonceSize()
+	if len(data) < nonceSize {
+		return nil, ErrDecrypt
+	}
+
+	plain, err := aead.Open(nil, data[:nonceSize], data[nonceSize:], nil)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+
+	return plain, nil
+}
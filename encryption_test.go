@@ -0,0 +1,100 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"testing"
+)
+
+func TestDB_Encryption(t *testing.T) {
+	keys := &StaticKeyProvider{
+		CurrentID: 1,
+		Keys:      map[uint32][]byte{1: bytes.Repeat([]byte("k"), 32)},
+	}
+
+	InitOpt("/tmp/nutsdbtestforencryption", true)
+	opt.SegmentSize = 1024
+	opt.Compression = DeflateCompression
+	opt.Encryption = &EncryptionOptions{KeyProvider: keys, EncryptKeys: true}
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bucket := "bucket_for_encryption"
+	for i := 0; i < 20; i++ {
+		if err := db.Update(func(tx *Tx) error {
+			return tx.Put(bucket, []byte(fmt.Sprintf("secret_key_%02d", i)), []byte(fmt.Sprintf("secret_val_%02d", i)), Persistent)
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := ioutil.ReadFile(db.getDataPath(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("secret_")) {
+		t.Error("err encryption, the keys or values are stored in plaintext")
+	}
+
+	// rotate the key, Merge re-encrypts the entries with the current key.
+	keys.Keys[2] = bytes.Repeat([]byte("n"), 32)
+	keys.CurrentID = 2
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Update(func(tx *Tx) error {
+		return tx.Put(bucket, []byte("secret_key_20"), []byte("secret_val_20"), Persistent)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	delete(keys.Keys, 1)
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.View(func(tx *Tx) error {
+		for i := 0; i <= 20; i++ {
+			e, err := tx.Get(bucket, []byte(fmt.Sprintf("secret_key_%02d", i)))
+			if err != nil {
+				return err
+			}
+			if string(e.Value) != fmt.Sprintf("secret_val_%02d", i) {
+				t.Errorf("err encryption, got %s", e.Value)
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	opt.Encryption = nil
+	if _, err := Open(opt); err == nil {
+		t.Error("err encryption, opened the encrypted data files without the keys")
+	}
+}
@@ -17,6 +17,7 @@ package nutsdb
 import (
 	"encoding/binary"
 	"hash/crc32"
+	"sort"
 )
 
 type (
@@ -49,6 +50,10 @@ type (
 		txID       uint64
 		status     uint16 // committed / uncommitted
 		ds         uint16 // data structure
+		codec      uint16 // compression of the stored value, see Compression
+		encryption uint16 // encrypted fields of the stored entry, see encryptedValue and encryptedKey
+		merged     uint16 // 1 if the entry is a live entry rewritten by the merge
+		overflow   uint16 // 1 if the stored value is in an overflow file, the value of the entry references it
 	}
 )
 
@@ -93,8 +98,11 @@ func (e *Entry) setEntryHeaderBuf(buf []byte) []byte {
 	binary.LittleEndian.PutUint16(buf[20:22], e.Meta.Flag)
 	binary.LittleEndian.PutUint32(buf[22:26], e.Meta.TTL)
 	binary.LittleEndian.PutUint32(buf[26:30], e.Meta.bucketSize)
-	binary.LittleEndian.PutUint16(buf[30:32], e.Meta.status)
-	binary.LittleEndian.PutUint16(buf[32:34], e.Meta.ds)
+	// the high byte of the status records the codec, the merged flag and the encrypted fields,
+	// it is zero in the entries written before.
+	binary.LittleEndian.PutUint16(buf[30:32], e.Meta.status|e.Meta.codec<<8|e.Meta.merged<<13|e.Meta.encryption<<14)
+	// the high bit of the data structure records the overflow of the value.
+	binary.LittleEndian.PutUint16(buf[32:34], e.Meta.ds|e.Meta.overflow<<15)
 	binary.LittleEndian.PutUint64(buf[34:42], e.Meta.txID)
 
 	return buf
@@ -108,6 +116,12 @@ func (e *Entry) IsZero() bool {
 	return false
 }
 
+// Version returns the version of the entry, the id of the tx which wrote it, to be passed to
+// Tx.PutIfVersion. The entries rewritten by a merge get a new version.
+func (e *Entry) Version() uint64 {
+	return e.Meta.txID
+}
+
 // GetCrc returns the crc at given buf slice.
 func (e *Entry) GetCrc(buf []byte) uint32 {
 	crc := crc32.ChecksumIEEE(buf[4:])
@@ -117,3 +131,38 @@ func (e *Entry) GetCrc(buf []byte) uint32 {
 
 	return crc
 }
+
+// Keys returns the keys of the entries, in their order.
+func (es Entries) Keys() [][]byte {
+	keys := make([][]byte, 0, len(es))
+	for _, e := range es {
+		keys = append(keys, e.Key)
+	}
+
+	return keys
+}
+
+// Values returns the values of the entries, in their order.
+func (es Entries) Values() [][]byte {
+	values := make([][]byte, 0, len(es))
+	for _, e := range es {
+		values = append(values, e.Value)
+	}
+
+	return values
+}
+
+// Find returns the entry of the key in the entries sorted by the keys in ascending bytewise order,
+// as returned by the scans other than the reverse ones of the buckets without a comparator,
+// or nil if the key is not found.
+func (es Entries) Find(key []byte) *Entry {
+	i := sort.Search(len(es), func(i int) bool {
+		return compare(es[i].Key, key) >= 0
+	})
+
+	if i < len(es) && compare(es[i].Key, key) == 0 {
+		return es[i]
+	}
+
+	return nil
+}
@@ -0,0 +1,142 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"container/list"
+	"sync"
+)
+
+// entryPos identifies an entry by its position in the data files.
+type entryPos struct {
+	fID int64
+	off uint64
+}
+
+// cachedEntry records a decoded entry read from a data file.
+type cachedEntry struct {
+	pos  entryPos
+	e    *Entry
+	size int64
+}
+
+// entryCache caches the decoded entries read from the data files in HintKeyAndRAMIdxMode and
+// HintBPTSparseIdxMode, so that the reads of the hot keys do not hit the disk each time.
+// The least recently used entries are dropped when their size exceeds maxBytes.
+// An entry never changes at its position, the cached entry of a key is dropped when the key
+// is written again since it is not read anymore. The cache keeps its own copies of the entries,
+// the callers may change the entries they get.
+type entryCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	bytes    int64
+	items    map[entryPos]*list.Element
+	lru      *list.List // front is the most recently used entry
+}
+
+// newEntryCache returns a newly initialized entryCache object.
+func newEntryCache(maxBytes int64) *entryCache {
+	return &entryCache{
+		maxBytes: maxBytes,
+		items:    make(map[entryPos]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+// get returns a copy of the entry at given pos, or nil if it is not cached.
+func (c *entryCache) get(pos entryPos) *Entry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[pos]
+	if !ok {
+		return nil
+	}
+
+	c.lru.MoveToFront(elem)
+
+	return copyEntry(elem.Value.(*cachedEntry).e)
+}
+
+// add caches a copy of the entry at given pos, unless it is larger than the cache.
+func (c *entryCache) add(pos entryPos, e *Entry) {
+	size := e.Size()
+	if size > c.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.items[pos]; ok {
+		return
+	}
+
+	c.items[pos] = c.lru.PushFront(&cachedEntry{pos: pos, e: copyEntry(e), size: size})
+	c.bytes += size
+
+	for c.bytes > c.maxBytes {
+		c.removeElement(c.lru.Back())
+	}
+}
+
+// size returns the size in bytes of the cached entries.
+func (c *entryCache) size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.bytes
+}
+
+// remove drops the entry at given pos if it is cached.
+func (c *entryCache) remove(pos entryPos) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[pos]; ok {
+		c.removeElement(elem)
+	}
+}
+
+func (c *entryCache) removeElement(elem *list.Element) {
+	item := c.lru.Remove(elem).(*cachedEntry)
+	delete(c.items, item.pos)
+	c.bytes -= item.size
+}
+
+// copyEntry returns a copy of the entry with its own key, value and meta.
+func copyEntry(e *Entry) *Entry {
+	c := *e
+	c.Key = copyBytes(e.Key)
+	c.Value = copyBytes(e.Value)
+	if e.Meta != nil {
+		meta := *e.Meta
+		meta.bucket = copyBytes(e.Meta.bucket)
+		c.Meta = &meta
+	}
+
+	return &c
+}
+
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+
+	c := make([]byte, len(b))
+	copy(c, b)
+
+	return c
+}
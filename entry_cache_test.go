@@ -0,0 +1,171 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestEntryCache(t *testing.T) {
+	newEntry := func(value string) *Entry {
+		return &Entry{Key: []byte("key"), Value: []byte(value), Meta: &MetaData{keySize: 3, valueSize: uint32(len(value))}}
+	}
+
+	size := newEntry("val").Size()
+	cache := newEntryCache(2 * size)
+
+	for off := uint64(0); off < 3; off++ {
+		cache.add(entryPos{off: off}, newEntry("val"))
+	}
+
+	// the least recently used entry is dropped.
+	if cache.get(entryPos{off: 0}) != nil {
+		t.Error("err entryCache, the oldest entry should be dropped")
+	}
+	if cache.get(entryPos{off: 1}) == nil || cache.get(entryPos{off: 2}) == nil {
+		t.Error("err entryCache, the newest entries should be cached")
+	}
+
+	cache.add(entryPos{fID: 1}, newEntry("val"))
+	if cache.get(entryPos{off: 1}) != nil || cache.get(entryPos{off: 2}) == nil {
+		t.Error("err entryCache, the least recently used entry should be dropped")
+	}
+
+	cache.remove(entryPos{off: 2})
+	if cache.get(entryPos{off: 2}) != nil || cache.bytes != size {
+		t.Errorf("err entryCache, got %d bytes want %d", cache.bytes, size)
+	}
+
+	// the entries larger than the cache are not cached.
+	cache.add(entryPos{off: 3}, newEntry(string(make([]byte, 2*size))))
+	if cache.get(entryPos{off: 3}) != nil {
+		t.Error("err entryCache, the entry larger than the cache should not be cached")
+	}
+}
+
+func TestDB_EntryCacheSize(t *testing.T) {
+	bucket := "bucket_for_entry_cache"
+
+	for _, idxMode := range []EntryIdxMode{HintKeyAndRAMIdxMode, HintBPTSparseIdxMode} {
+		InitOpt("/tmp/nutsdbtestforentrycache", true)
+		opt.EntryIdxMode = idxMode
+		opt.EntryCacheSize = 4 * 1024
+		db, err = Open(opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < 100; i++ {
+			if err := db.Update(func(tx *Tx) error {
+				return tx.Put(bucket, []byte(fmt.Sprintf("key_%03d", i)), []byte(fmt.Sprintf("val_%03d", i)), Persistent)
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		check := func(key, want string) {
+			t.Helper()
+
+			// the second read is served by the cache.
+			for pass := 0; pass < 2; pass++ {
+				if err := db.View(func(tx *Tx) error {
+					e, err := tx.Get(bucket, []byte(key))
+					if err != nil {
+						return err
+					}
+					if string(e.Value) != want {
+						t.Errorf("err EntryCacheSize %d, got %s want %s", idxMode, e.Value, want)
+					}
+					return nil
+				}); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+
+		for i := 0; i < 100; i += 3 {
+			check(fmt.Sprintf("key_%03d", i), fmt.Sprintf("val_%03d", i))
+		}
+
+		// the new value is read once the key is written again.
+		if err := db.Update(func(tx *Tx) error {
+			return tx.Put(bucket, []byte("key_000"), []byte("new"), Persistent)
+		}); err != nil {
+			t.Fatal(err)
+		}
+		check("key_000", "new")
+
+		if db.entryCache == nil || db.entryCache.lru.Len() == 0 || db.entryCache.bytes > opt.EntryCacheSize {
+			t.Errorf("err EntryCacheSize %d, the cached entries should be at most %d bytes", idxMode, opt.EntryCacheSize)
+		}
+
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDB_EntryCacheCopy(t *testing.T) {
+	bucket := "bucket_for_entry_cache_copy"
+
+	for _, idxMode := range []EntryIdxMode{HintKeyAndRAMIdxMode, HintBPTSparseIdxMode} {
+		InitOpt("/tmp/nutsdbtestforentrycachecopy", true)
+		opt.EntryIdxMode = idxMode
+		opt.EntryCacheSize = 4 * 1024
+		db, err = Open(opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := db.Update(func(tx *Tx) error {
+			return tx.Put(bucket, []byte("key"), []byte("val"), Persistent)
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		// the first read caches the entry, the next ones are served by the cache:
+		// changing the entries returned must not change the cached one.
+		for pass := 0; pass < 3; pass++ {
+			if err := db.View(func(tx *Tx) error {
+				e, err := tx.Get(bucket, []byte("key"))
+				if err != nil {
+					return err
+				}
+				if string(e.Key) != "key" || string(e.Value) != "val" {
+					t.Errorf("err EntryCacheSize %d pass %d, got %s=%s", idxMode, pass, e.Key, e.Value)
+				}
+				e.Key[0], e.Value[0] = 'x', 'x'
+
+				es, err := tx.GetMulti(bucket, [][]byte{[]byte("key")})
+				if err != nil {
+					return err
+				}
+				if len(es) != 1 || string(es[0].Value) != "val" {
+					t.Errorf("err EntryCacheSize %d pass %d, got %v from GetMulti", idxMode, pass, es)
+				}
+				es[0].Value[0] = 'y'
+
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
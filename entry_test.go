@@ -15,6 +15,7 @@
 package nutsdb
 
 import (
+	"fmt"
 	"testing"
 )
 
@@ -48,3 +49,33 @@ func TestEntry_All(t *testing.T) {
 		t.Errorf("err entry.GetCrc got %d want %d", entry.GetCrc(entry.Encode()), 2777557425)
 	}
 }
+
+func TestEntries_Accessors(t *testing.T) {
+	es := Entries{
+		{Key: []byte("key_1"), Value: []byte("val_1")},
+		{Key: []byte("key_2"), Value: []byte("val_2")},
+		{Key: []byte("key_4"), Value: []byte("val_4")},
+	}
+
+	if got := fmt.Sprintf("%s", es.Keys()); got != "[key_1 key_2 key_4]" {
+		t.Errorf("err Entries.Keys got %s", got)
+	}
+
+	if got := fmt.Sprintf("%s", es.Values()); got != "[val_1 val_2 val_4]" {
+		t.Errorf("err Entries.Values got %s", got)
+	}
+
+	if e := es.Find([]byte("key_2")); e == nil || string(e.Value) != "val_2" {
+		t.Errorf("err Entries.Find got %v", e)
+	}
+
+	for _, key := range []string{"key_0", "key_3", "key_5"} {
+		if e := es.Find([]byte(key)); e != nil {
+			t.Errorf("err Entries.Find %s got %v want nil", key, e)
+		}
+	}
+
+	if len(Entries(nil).Keys()) != 0 || Entries(nil).Find([]byte("key_1")) != nil {
+		t.Error("err empty Entries")
+	}
+}
@@ -0,0 +1,326 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"container/heap"
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrEvictionSparseIdxMode is returned by Open when Options.BucketEviction is set in
+// HintBPTSparseIdxMode, its index does not keep the keys of the buckets in memory.
+var ErrEvictionSparseIdxMode = errors.New("the eviction is not supported in HintBPTSparseIdxMode")
+
+// EvictionMode represents the order in which the keys of a bucket are evicted.
+type EvictionMode int
+
+const (
+	// EvictLRU evicts the least recently used keys first.
+	EvictLRU EvictionMode = iota
+
+	// EvictLFU evicts the least frequently used keys first,
+	// and the least recently used first among the keys used as often.
+	EvictLFU
+)
+
+// EvictionPolicy represents the limits of the keys of a bucket. When a commit would exceed them,
+// the tx deletes the keys picked by the Mode until the bucket is within the limits again.
+// The keys written by the tx itself are never evicted by it, and the expired keys count until
+// they are deleted.
+type EvictionPolicy struct {
+	// MaxKeys represents the maximum number of keys of the bucket, 0 means no limit.
+	MaxKeys int
+
+	// MaxBytes represents the maximum size of the entries of the keys of the bucket
+	// in the data files, 0 means no limit.
+	MaxBytes int64
+
+	// Mode represents the order in which the keys are evicted. Default is EvictLRU.
+	Mode EvictionMode
+}
+
+// evictionTracker records the uses of the keys of the buckets with an eviction policy.
+// The keys are used by the reads concurrently, so it has its own lock.
+type evictionTracker struct {
+	mu      sync.Mutex
+	clock   uint64
+	buckets map[string]*bucketEviction
+}
+
+// bucketEviction records the keys of a bucket in the order of their eviction.
+type bucketEviction struct {
+	policy EvictionPolicy
+	items  map[string]*evictionItem
+	queue  evictionQueue
+	bytes  int64
+}
+
+type evictionItem struct {
+	key   string
+	size  int64
+	last  uint64 // the clock of the last use
+	hits  uint64
+	index int
+}
+
+// evictionQueue is a heap of the items, the next one to evict first.
+type evictionQueue struct {
+	mode  EvictionMode
+	items []*evictionItem
+}
+
+func (q *evictionQueue) Len() int { return len(q.items) }
+
+func (q *evictionQueue) Less(i, j int) bool {
+	a, b := q.items[i], q.items[j]
+	if q.mode == EvictLFU && a.hits != b.hits {
+		return a.hits < b.hits
+	}
+
+	return a.last < b.last
+}
+
+func (q *evictionQueue) Swap(i, j int) {
+	q.items[i], q.items[j] = q.items[j], q.items[i]
+	q.items[i].index = i
+	q.items[j].index = j
+}
+
+func (q *evictionQueue) Push(x interface{}) {
+	item := x.(*evictionItem)
+	item.index = len(q.items)
+	q.items = append(q.items, item)
+}
+
+func (q *evictionQueue) Pop() interface{} {
+	n := len(q.items)
+	item := q.items[n-1]
+	q.items[n-1] = nil
+	q.items = q.items[:n-1]
+
+	return item
+}
+
+// newEvictionTracker returns the tracker of the buckets of BucketEviction, with the live keys
+// of the index used in the order they are written, or nil if there is no eviction policy.
+func (db *DB) newEvictionTracker() *evictionTracker {
+	if len(db.opt.BucketEviction) == 0 {
+		return nil
+	}
+
+	t := &evictionTracker{buckets: make(map[string]*bucketEviction, len(db.opt.BucketEviction))}
+
+	for bucket, policy := range db.opt.BucketEviction {
+		b := &bucketEviction{
+			policy: policy,
+			items:  make(map[string]*evictionItem),
+			queue:  evictionQueue{mode: policy.Mode},
+		}
+		t.buckets[bucket] = b
+
+		idx, ok := db.BPTreeIdx[bucket]
+		if !ok {
+			continue
+		}
+
+		records, err := idx.All()
+		if err != nil {
+			continue
+		}
+
+		sort.Slice(records, func(i, j int) bool {
+			a, b := records[i].H, records[j].H
+			return a.fileID < b.fileID || a.fileID == b.fileID && a.dataPos < b.dataPos
+		})
+
+		for _, r := range records {
+			if r.H.meta.Flag == DataDeleteFlag {
+				continue
+			}
+			t.clock++
+			b.add(string(r.H.key), recordSize(r), t.clock)
+		}
+	}
+
+	return t
+}
+
+// recordSize returns the size of the entry of the record in the data files.
+func recordSize(r *Record) int64 {
+	return int64(DataEntryHeaderSize + r.H.meta.bucketSize + r.H.meta.keySize + r.H.meta.valueSize)
+}
+
+func (b *bucketEviction) add(key string, size int64, clock uint64) {
+	item := &evictionItem{key: key, size: size, last: clock, hits: 1}
+	b.items[key] = item
+	b.bytes += size
+	heap.Push(&b.queue, item)
+}
+
+func (b *bucketEviction) exceeds(keys int, bytes int64) bool {
+	return b.policy.MaxKeys > 0 && keys > b.policy.MaxKeys || b.policy.MaxBytes > 0 && bytes > b.policy.MaxBytes
+}
+
+// touch records a use of the key of the bucket.
+func (t *evictionTracker) touch(bucket string, key []byte) {
+	if t == nil {
+		return
+	}
+
+	b, ok := t.buckets[bucket]
+	if !ok {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if item, ok := b.items[string(key)]; ok {
+		t.clock++
+		item.last = t.clock
+		item.hits++
+		heap.Fix(&b.queue, item.index)
+	}
+}
+
+// apply records the committed entry of the bucket, a write counts as a use of the key.
+func (t *evictionTracker) apply(bucket string, entry *Entry) {
+	if t == nil {
+		return
+	}
+
+	b, ok := t.buckets[bucket]
+	if !ok {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := string(entry.Key)
+	item, ok := b.items[key]
+
+	if entry.Meta.Flag == DataDeleteFlag {
+		if ok {
+			heap.Remove(&b.queue, item.index)
+			delete(b.items, key)
+			b.bytes -= item.size
+		}
+		return
+	}
+
+	t.clock++
+	if !ok {
+		b.add(key, entry.Size(), t.clock)
+		return
+	}
+
+	b.bytes += entry.Size() - item.size
+	item.size = entry.Size()
+	item.last = t.clock
+	item.hits++
+	heap.Fix(&b.queue, item.index)
+}
+
+// victims returns the keys of the bucket to evict so that it is within the limits after
+// the writes, the last write of each key. The written keys are not evicted.
+func (t *evictionTracker) victims(bucket string, writes map[string]*Entry) []string {
+	b := t.buckets[bucket]
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	keys, bytes := len(b.items), b.bytes
+	for key, e := range writes {
+		if item, ok := b.items[key]; ok {
+			keys--
+			bytes -= item.size
+		}
+		if e.Meta.Flag != DataDeleteFlag {
+			keys++
+			bytes += e.Size()
+		}
+	}
+
+	var (
+		victims []string
+		popped  []*evictionItem
+	)
+
+	for b.exceeds(keys, bytes) && b.queue.Len() > 0 {
+		item := heap.Pop(&b.queue).(*evictionItem)
+		popped = append(popped, item)
+
+		if _, ok := writes[item.key]; ok {
+			continue
+		}
+
+		victims = append(victims, item.key)
+		keys--
+		bytes -= item.size
+	}
+
+	// the victims are removed when the deletes are committed.
+	for _, item := range popped {
+		heap.Push(&b.queue, item)
+	}
+
+	return victims
+}
+
+// evict deletes the keys evicted by the policies of the buckets written by the tx.
+func (tx *Tx) evict() error {
+	t := tx.db.eviction
+
+	writes := make(map[string]map[string]*Entry)
+	for _, e := range tx.pendingWrites {
+		if e.Meta.ds != DataStructureBPTree {
+			continue
+		}
+
+		bucket := string(e.Meta.bucket)
+		if _, ok := t.buckets[bucket]; !ok {
+			continue
+		}
+
+		if writes[bucket] == nil {
+			writes[bucket] = make(map[string]*Entry)
+		}
+		writes[bucket][string(e.Key)] = e
+	}
+
+	tx.evicting = true
+	defer func() { tx.evicting = false }()
+
+	for bucket, w := range writes {
+		for _, key := range t.victims(bucket, w) {
+			if err := tx.Delete(bucket, []byte(key)); err != nil {
+				return err
+			}
+			tx.evicted++
+		}
+	}
+
+	return nil
+}
+
+func (db *DB) observeEvictions(n int) {
+	if n > 0 {
+		atomic.AddUint64(&db.metrics.evictedKeys, uint64(n))
+	}
+}
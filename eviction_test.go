@@ -0,0 +1,175 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+)
+
+func putEvictionKeys(t *testing.T, bucket string, keys ...string) {
+	t.Helper()
+
+	for _, key := range keys {
+		if err := db.Update(func(tx *Tx) error {
+			return tx.Put(bucket, []byte(key), []byte("val"), Persistent)
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func getEvictionKeys(t *testing.T, bucket string, keys ...string) {
+	t.Helper()
+
+	if err := db.View(func(tx *Tx) error {
+		for _, key := range keys {
+			if _, err := tx.Get(bucket, []byte(key)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func checkEvictionKeys(t *testing.T, bucket string, want ...string) {
+	t.Helper()
+
+	var got []string
+	if err := db.View(func(tx *Tx) error {
+		entries, err := tx.GetAll(bucket)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			got = append(got, string(e.Key))
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(want)
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("err eviction %s, got %v want %v", bucket, got, want)
+	}
+}
+
+func TestDB_EvictionLRU(t *testing.T) {
+	InitOpt("/tmp/nutsdbtesteviction", true)
+	opt.BucketEviction = map[string]EvictionPolicy{"bucket": {MaxKeys: 3, Mode: EvictLRU}}
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	putEvictionKeys(t, "bucket", "a", "b", "c")
+	getEvictionKeys(t, "bucket", "a")
+	putEvictionKeys(t, "bucket", "d")
+	checkEvictionKeys(t, "bucket", "a", "c", "d")
+
+	// the keys written by the tx are not evicted by it.
+	if err := db.Update(func(tx *Tx) error {
+		for _, key := range []string{"e", "f"} {
+			if err := tx.Put("bucket", []byte(key), []byte("val"), Persistent); err != nil {
+				return err
+			}
+		}
+		return tx.Put("bucket", []byte("a"), []byte("new"), Persistent)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	checkEvictionKeys(t, "bucket", "a", "e", "f")
+
+	// the other buckets have no limit.
+	putEvictionKeys(t, "bucket_other", "a", "b", "c", "d")
+	checkEvictionKeys(t, "bucket_other", "a", "b", "c", "d")
+
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.EvictedKeys != 3 {
+		t.Errorf("err EvictedKeys, got %d want %d", stats.EvictedKeys, 3)
+	}
+
+	// the keys are used in the order they are written after reopening.
+	db.Close()
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	putEvictionKeys(t, "bucket", "g")
+	checkEvictionKeys(t, "bucket", "a", "f", "g")
+}
+
+func TestDB_EvictionLFU(t *testing.T) {
+	InitOpt("/tmp/nutsdbtesteviction", true)
+	opt.BucketEviction = map[string]EvictionPolicy{"bucket": {MaxKeys: 3, Mode: EvictLFU}}
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	putEvictionKeys(t, "bucket", "a", "b", "c")
+	getEvictionKeys(t, "bucket", "a", "a", "b", "b", "c")
+	putEvictionKeys(t, "bucket", "d")
+	checkEvictionKeys(t, "bucket", "a", "b", "d")
+
+	// d is used the least though it is the most recent.
+	putEvictionKeys(t, "bucket", "e")
+	checkEvictionKeys(t, "bucket", "a", "b", "e")
+}
+
+func TestDB_EvictionMaxBytes(t *testing.T) {
+	InitOpt("/tmp/nutsdbtesteviction", true)
+
+	// the entries of "bucket" with a 1-byte key and a 3-byte value.
+	size := int64(DataEntryHeaderSize + len("bucket") + 1 + 3)
+	opt.BucketEviction = map[string]EvictionPolicy{"bucket": {MaxBytes: 2 * size}}
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	putEvictionKeys(t, "bucket", "a", "b", "c")
+	checkEvictionKeys(t, "bucket", "b", "c")
+
+	// a delete frees the room of the key.
+	if err := db.Update(func(tx *Tx) error {
+		return tx.Delete("bucket", []byte("b"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+	putEvictionKeys(t, "bucket", "d")
+	checkEvictionKeys(t, "bucket", "c", "d")
+}
+
+func TestDB_Eviction_HintBPTSparseIdxMode(t *testing.T) {
+	InitOpt("/tmp/nutsdbtesteviction", true)
+	opt.EntryIdxMode = HintBPTSparseIdxMode
+	opt.BucketEviction = map[string]EvictionPolicy{"bucket": {MaxKeys: 2}}
+
+	if _, err := Open(opt); err != ErrEvictionSparseIdxMode {
+		t.Errorf("err Open, got %v want %v", err, ErrEvictionSparseIdxMode)
+	}
+}
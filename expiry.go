@@ -0,0 +1,118 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import "time"
+
+// ExpireFunc is the callback called after an expired key is deleted by the expiration worker,
+// e is the expired entry.
+type ExpireFunc func(bucket string, key []byte, e *Entry)
+
+// expiredKey records a key deleted by the expiration worker.
+type expiredKey struct {
+	bucket string
+	key    []byte
+	e      *Entry
+}
+
+// OnExpire registers the callback called after an expired key is deleted
+// by the expiration worker, a nil fn removes the callback.
+// The callback is called outside of any transaction, so it can use the db.
+func (db *DB) OnExpire(fn ExpireFunc) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.onExpire = fn
+}
+
+// runExpireWorker deletes the expired keys every ExpireInterval until the db is closed.
+func (db *DB) runExpireWorker() {
+	defer db.wg.Done()
+
+	ticker := time.NewTicker(db.opt.ExpireInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-db.closeCh:
+			return
+		case <-ticker.C:
+			if err := db.deleteExpired(); err != nil {
+				db.logger().Error("expiration worker", "err", err)
+			}
+		}
+	}
+}
+
+// deleteExpired deletes the expired keys in one read/write transaction,
+// then calls the OnExpire callback for each of them.
+func (db *DB) deleteExpired() error {
+	var (
+		expiredKeys []expiredKey
+		onExpire    ExpireFunc
+	)
+
+	err := db.Update(func(tx *Tx) error {
+		tx.isExpiring = true
+		onExpire = db.onExpire
+
+		for bucket, idx := range db.BPTreeIdx {
+			records, err := idx.All()
+			if err != nil {
+				continue
+			}
+
+			for _, r := range records {
+				if r.H.meta.Flag == DataDeleteFlag || !r.IsExpired() {
+					continue
+				}
+
+				e := r.E
+				if e == nil && onExpire != nil {
+					if e, err = db.readEntryAt(r.H.fileID, r.H.dataPos); err != nil {
+						return err
+					}
+				}
+
+				if err := tx.Delete(bucket, r.H.key); err != nil {
+					return err
+				}
+
+				expiredKeys = append(expiredKeys, expiredKey{bucket: bucket, key: r.H.key, e: e})
+			}
+		}
+
+		if err := tx.deleteExpiredZMembers(); err != nil {
+			return err
+		}
+
+		return tx.dropExpiredBuckets()
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(expiredKeys) > 0 {
+		db.logger().Debug("deleted the expired keys", "keys", len(expiredKeys))
+	}
+
+	if onExpire != nil {
+		for _, k := range expiredKeys {
+			onExpire(k.bucket, k.key, k.e)
+		}
+	}
+
+	return nil
+}
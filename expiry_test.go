@@ -0,0 +1,78 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDB_ExpireWorker(t *testing.T) {
+	for _, mode := range []EntryIdxMode{HintKeyValAndRAMIdxMode, HintKeyAndRAMIdxMode} {
+		InitOpt("/tmp/nutsdbtestforexpire", true)
+		opt.EntryIdxMode = mode
+		opt.ExpireInterval = 50 * time.Millisecond
+
+		db, err = Open(opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expiredCh := make(chan *Entry, 2)
+		db.OnExpire(func(bucket string, key []byte, e *Entry) {
+			if bucket != "bucket_for_expire" || string(key) != "key_ttl" {
+				t.Errorf("err OnExpire, got bucket %s key %s", bucket, key)
+			}
+			expiredCh <- e
+		})
+
+		bucket := "bucket_for_expire"
+		if err := db.Update(func(tx *Tx) error {
+			if err := tx.Put(bucket, []byte("key_ttl"), []byte("val_ttl"), 1); err != nil {
+				return err
+			}
+			return tx.Put(bucket, []byte("key_persistent"), []byte("val_persistent"), Persistent)
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case e := <-expiredCh:
+			if e == nil || string(e.Value) != "val_ttl" {
+				t.Errorf("err OnExpire, got entry %v", e)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("err TestDB_ExpireWorker: the expired key is not deleted")
+		}
+
+		if err := db.View(func(tx *Tx) error {
+			r, err := db.BPTreeIdx[bucket].Find([]byte("key_ttl"))
+			if err != nil {
+				return err
+			}
+			if r.H.meta.Flag != DataDeleteFlag {
+				t.Error("err TestDB_ExpireWorker: the expired key is not deleted")
+			}
+			_, err = tx.Get(bucket, []byte("key_persistent"))
+			return err
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,293 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"errors"
+	"os"
+	"sync"
+)
+
+// ErrFailpointCrash is returned by the writes and the syncs of the data files after a crash
+// simulated by the Failpoints, until they are reset.
+var ErrFailpointCrash = errors.New("failpoint: simulated crash")
+
+// FailpointOp represents an operation on a data file, see Failpoints.FailWhen.
+type FailpointOp int
+
+const (
+	// FailpointWrite represents a write to a data file.
+	FailpointWrite FailpointOp = iota
+
+	// FailpointSync represents a sync of a data file.
+	FailpointSync
+)
+
+// Failpoints injects failures in the writes and the syncs of the data files of the dbs opened with
+// it in Options.Failpoints, for the tests of the recovery. It records the data written to the data
+// files since their last syncs, which a simulated crash loses. Its methods may be called while the
+// db is used, the failures are deterministic for the same writes.
+type Failpoints struct {
+	mu sync.Mutex
+
+	writeLimit      int64 // the bytes left to write before the writes fail, -1 means no limit
+	writeErr        error
+	syncErr         error
+	crashBeforeSync bool
+	hook            func(op FailpointOp, path string) error
+	crashed         bool
+
+	open map[*failpointRWManager]struct{}
+	lost []unsyncedRange // the unsynced data of the closed data files
+}
+
+// unsyncedRange represents the data written to a data file since its last sync.
+type unsyncedRange struct {
+	path   string
+	lo, hi int64
+}
+
+// NewFailpoints returns a newly initialized Failpoints object, without any failure.
+func NewFailpoints() *Failpoints {
+	return &Failpoints{
+		writeLimit: -1,
+		open:       make(map[*failpointRWManager]struct{}),
+	}
+}
+
+// FailWriteAfter makes the writes to the data files fail with err once n more bytes are written.
+// The write crossing the limit only writes its bytes up to it, like a torn write.
+func (f *Failpoints) FailWriteAfter(n int64, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.writeLimit, f.writeErr = n, err
+}
+
+// FailSync makes the next sync of a data file fail with err, the data file is not synced.
+func (f *Failpoints) FailSync(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.syncErr = err
+}
+
+// CrashBeforeSync makes the next sync of a data file simulate a crash instead, see Crash.
+func (f *Failpoints) CrashBeforeSync() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.crashBeforeSync = true
+}
+
+// FailWhen makes the writes and the syncs of the data files fail with the error returned by fn,
+// if any, and simulate a crash if it is ErrFailpointCrash. fn is called with the operation and the
+// path of the data file before it is done, with the Failpoints locked.
+func (f *Failpoints) FailWhen(fn func(op FailpointOp, path string) error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.hook = fn
+}
+
+// Crash simulates a crash of the process: the data written to the data files since their last
+// syncs is zeroed, and their writes and syncs return ErrFailpointCrash until Reset. The db must
+// then be closed and opened again, as after a restart.
+func (f *Failpoints) Crash() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.crash()
+}
+
+// Crashed returns whether a crash is simulated.
+func (f *Failpoints) Crashed() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.crashed
+}
+
+// Reset removes the failures and ends the simulated crash.
+func (f *Failpoints) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.writeLimit, f.writeErr = -1, nil
+	f.syncErr = nil
+	f.crashBeforeSync = false
+	f.hook = nil
+	f.crashed = false
+}
+
+func (f *Failpoints) crash() {
+	f.crashed = true
+
+	for m := range f.open {
+		if m.hi > m.lo {
+			_, _ = m.RWManager.WriteAt(make([]byte, m.hi-m.lo), m.lo)
+			m.lo, m.hi = 0, 0
+		}
+	}
+
+	for _, r := range f.lost {
+		_ = zeroFileRange(r)
+	}
+	f.lost = nil
+}
+
+// zeroFileRange zeroes the range of the data file, unless it is removed.
+func zeroFileRange(r unsyncedRange) error {
+	fd, err := os.OpenFile(r.path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	if _, err := fd.WriteAt(make([]byte, r.hi-r.lo), r.lo); err != nil {
+		return err
+	}
+
+	return fd.Sync()
+}
+
+// wrap returns the RWManager of the data file at given path with the failures.
+func (f *Failpoints) wrap(path string, rwManager RWManager) RWManager {
+	m := &failpointRWManager{RWManager: rwManager, fp: f, path: path}
+
+	f.mu.Lock()
+	f.open[m] = struct{}{}
+	f.mu.Unlock()
+
+	return m
+}
+
+// failpointRWManager injects the failures of the Failpoints in the writes and the syncs of a
+// data file, and records the range of the data written since its last sync.
+type failpointRWManager struct {
+	RWManager
+	fp     *Failpoints
+	path   string
+	lo, hi int64
+}
+
+// WriteAt writes b at off, or its bytes up to the limit of the writes of the Failpoints.
+func (m *failpointRWManager) WriteAt(b []byte, off int64) (int, error) {
+	f := m.fp
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.crashed {
+		return 0, ErrFailpointCrash
+	}
+
+	if f.hook != nil {
+		if err := f.hook(FailpointWrite, m.path); err != nil {
+			if err == ErrFailpointCrash {
+				f.crash()
+			}
+			return 0, err
+		}
+	}
+
+	n, err := len(b), error(nil)
+	if f.writeLimit >= 0 {
+		if int64(n) > f.writeLimit {
+			n, err = int(f.writeLimit), f.writeErr
+		}
+		f.writeLimit -= int64(n)
+	}
+
+	if n > 0 {
+		written, werr := m.RWManager.WriteAt(b[:n], off)
+		m.unsynced(off, off+int64(written))
+		if werr != nil {
+			return written, werr
+		}
+	}
+
+	return n, err
+}
+
+func (m *failpointRWManager) unsynced(lo, hi int64) {
+	if hi <= lo {
+		return
+	}
+
+	if m.hi <= m.lo {
+		m.lo, m.hi = lo, hi
+		return
+	}
+
+	if lo < m.lo {
+		m.lo = lo
+	}
+	if hi > m.hi {
+		m.hi = hi
+	}
+}
+
+// Sync syncs the data file, unless the Failpoints make it fail or crash.
+func (m *failpointRWManager) Sync() error {
+	f := m.fp
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.crashed {
+		return ErrFailpointCrash
+	}
+
+	if f.crashBeforeSync {
+		f.crashBeforeSync = false
+		f.crash()
+		return ErrFailpointCrash
+	}
+
+	if f.hook != nil {
+		if err := f.hook(FailpointSync, m.path); err != nil {
+			if err == ErrFailpointCrash {
+				f.crash()
+			}
+			return err
+		}
+	}
+
+	if err := f.syncErr; err != nil {
+		f.syncErr = nil
+		return err
+	}
+
+	if err := m.RWManager.Sync(); err != nil {
+		return err
+	}
+
+	m.lo, m.hi = 0, 0
+
+	return nil
+}
+
+// Close closes the data file, its unsynced data is lost by a later crash.
+func (m *failpointRWManager) Close() error {
+	f := m.fp
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.open, m)
+	if m.hi > m.lo && !f.crashed {
+		f.lost = append(f.lost, unsyncedRange{path: m.path, lo: m.lo, hi: m.hi})
+	}
+
+	return m.RWManager.Close()
+}
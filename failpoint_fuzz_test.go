@@ -0,0 +1,32 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.18
+// +build go1.18
+
+package nutsdb
+
+import "testing"
+
+// FuzzDB_CrashRecovery runs the crash recovery of TestDB_CrashRecovery with the fuzzed seeds,
+// e.g. go test -run '^$' -fuzz FuzzDB_CrashRecovery.
+func FuzzDB_CrashRecovery(f *testing.F) {
+	for seed := int64(0); seed < 5; seed++ {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, seed int64) {
+		crashRecovery(t, seed)
+	})
+}
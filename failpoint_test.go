@@ -0,0 +1,318 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+)
+
+var errInjected = errors.New("injected failure")
+
+func openFailpointDB(t *testing.T, fp *Failpoints, policy SyncPolicy) {
+	t.Helper()
+
+	InitOpt("/tmp/nutsdbtestfailpoint", true)
+	opt.SyncPolicy = policy
+	opt.TruncateOnCorruption = true
+	opt.Failpoints = fp
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func putFailpointKey(key string) error {
+	return db.Update(func(tx *Tx) error {
+		return tx.Put("bucket", []byte(key), []byte("val"), Persistent)
+	})
+}
+
+func checkFailpointKeys(t *testing.T, want ...string) {
+	t.Helper()
+
+	var got []string
+	if err := db.View(func(tx *Tx) error {
+		entries, err := tx.GetAll("bucket")
+		if err != nil && !isScanNotFound(err) {
+			return err
+		}
+		for _, e := range entries {
+			got = append(got, string(e.Key))
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("err keys, got %v want %v", got, want)
+	}
+}
+
+func reopenFailpointDB(t *testing.T, fp *Failpoints) {
+	t.Helper()
+
+	_ = db.Close()
+	fp.Reset()
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFailpoints_FailWriteAfter(t *testing.T) {
+	fp := NewFailpoints()
+	openFailpointDB(t, fp, SyncAlways)
+
+	if err := putFailpointKey("a"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the entry of b is torn, the recovery truncates it.
+	fp.FailWriteAfter(10, errInjected)
+	if err := putFailpointKey("b"); err != errInjected {
+		t.Errorf("err FailWriteAfter, got %v want %v", err, errInjected)
+	}
+
+	reopenFailpointDB(t, fp)
+	defer db.Close()
+	checkFailpointKeys(t, "a")
+
+	if err := putFailpointKey("c"); err != nil {
+		t.Fatal(err)
+	}
+	checkFailpointKeys(t, "a", "c")
+}
+
+func TestFailpoints_CrashBeforeSync(t *testing.T) {
+	fp := NewFailpoints()
+	openFailpointDB(t, fp, SyncNever)
+
+	if err := putFailpointKey("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if err := putFailpointKey("b"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the commit of b is not synced, the crash loses it.
+	fp.CrashBeforeSync()
+	if err := db.Sync(); err != ErrFailpointCrash {
+		t.Errorf("err CrashBeforeSync, got %v want %v", err, ErrFailpointCrash)
+	}
+	if !fp.Crashed() {
+		t.Error("err Crashed, got false want true")
+	}
+	if err := putFailpointKey("c"); err != ErrFailpointCrash {
+		t.Errorf("err write after the crash, got %v want %v", err, ErrFailpointCrash)
+	}
+
+	reopenFailpointDB(t, fp)
+	defer db.Close()
+	checkFailpointKeys(t, "a")
+}
+
+func TestFailpoints_FailWhen(t *testing.T) {
+	fp := NewFailpoints()
+	openFailpointDB(t, fp, SyncAlways)
+	defer db.Close()
+
+	var paths []string
+	fp.FailWhen(func(op FailpointOp, path string) error {
+		if op == FailpointSync {
+			paths = append(paths, path)
+			return errInjected
+		}
+		return nil
+	})
+
+	if err := putFailpointKey("a"); err != errInjected {
+		t.Errorf("err FailWhen, got %v want %v", err, errInjected)
+	}
+	if len(paths) != 1 || paths[0] != db.ActiveFile.path {
+		t.Errorf("err FailWhen paths, got %v want [%s]", paths, db.ActiveFile.path)
+	}
+
+	fp.Reset()
+	if err := putFailpointKey("b"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// crashRecovery runs random txs on a db with a failure picked by the seed, then checks that the db
+// opened again after the failure and a crash has the data of a prefix of the commits which is at
+// least as long as the synced ones, or of all of the commits and the failed one.
+func crashRecovery(t *testing.T, seed int64) {
+	r := rand.New(rand.NewSource(seed))
+
+	dir, err := ioutil.TempDir("", "nutsdbtestcrash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fp := NewFailpoints()
+	opt := DefaultOptions
+	opt.Dir = dir
+	opt.SegmentSize = 4 * 1024
+	opt.RWMode = []RWMode{FileIO, MMap}[r.Intn(2)]
+	opt.EntryIdxMode = []EntryIdxMode{HintKeyValAndRAMIdxMode, HintKeyAndRAMIdxMode, HintBPTSparseIdxMode}[r.Intn(3)]
+	opt.SyncPolicy = []SyncPolicy{SyncAlways, SyncEveryN(3)}[r.Intn(2)]
+	opt.Failpoints = fp
+
+	// the syncs fail after failAt of them, unless it is negative.
+	failAt, failure, crash := r.Intn(60), []error{errInjected, ErrFailpointCrash}[r.Intn(2)], true
+	writeAfter := int64(-1)
+	if r.Intn(3) == 0 {
+		// the write fails after writeAfter bytes, and the db is closed without a crash or crashes.
+		writeAfter = r.Int63n(32 * 1024)
+		failAt, crash = -1, r.Intn(2) == 0
+	}
+
+	// the writes not synced before a crash are torn, the recovery truncates them. Without a crash
+	// the failed commit discards its torn entries itself, the db opens with the default options.
+	opt.TruncateOnCorruption = crash
+
+	db, err := Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if writeAfter >= 0 {
+		fp.FailWriteAfter(writeAfter, errInjected)
+	}
+
+	// states[i] is the data after the first i commits, and synced the number of the synced ones.
+	states := []map[string]string{{}}
+	current, synced := 0, 0
+
+	fp.FailWhen(func(op FailpointOp, path string) error {
+		if op != FailpointSync {
+			return nil
+		}
+		if failAt == 0 {
+			return failure
+		}
+		failAt--
+		synced = current
+		return nil
+	})
+
+	var failed map[string]string
+	for current = 0; current < 100; current++ {
+		writes := make(map[string]string)
+		err := db.Update(func(tx *Tx) error {
+			for j, n := 0, 1+r.Intn(4); j < n; j++ {
+				key := fmt.Sprintf("key_%02d", r.Intn(20))
+				if r.Intn(4) == 0 {
+					writes[key] = ""
+					if err := tx.Delete("bucket", []byte(key)); err != nil {
+						return err
+					}
+					continue
+				}
+				val := fmt.Sprintf("val_%d_%d_%s", current, j, strings.Repeat("x", r.Intn(300)))
+				writes[key] = val
+				if err := tx.Put("bucket", []byte(key), []byte(val), Persistent); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			failed = writes
+			break
+		}
+
+		states = append(states, applyWrites(states[len(states)-1], writes))
+		if opt.SyncPolicy == SyncAlways {
+			synced = len(states) - 1
+		}
+	}
+
+	if crash {
+		fp.Crash()
+	}
+	_ = db.Close()
+	fp.Reset()
+
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatalf("seed %d: err reopen: %v", seed, err)
+	}
+	defer db.Close()
+
+	got := make(map[string]string)
+	if err := db.View(func(tx *Tx) error {
+		entries, err := tx.GetAll("bucket")
+		if err != nil && !isScanNotFound(err) {
+			return err
+		}
+		for _, e := range entries {
+			got[string(e.Key)] = string(e.Value)
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("seed %d: %v", seed, err)
+	}
+
+	candidates := states[synced:]
+	if failed != nil {
+		candidates = append(candidates, applyWrites(states[len(states)-1], failed))
+	}
+	for _, want := range candidates {
+		if fmt.Sprint(got) == fmt.Sprint(want) {
+			return
+		}
+	}
+
+	t.Errorf("seed %d: err recovered data after %d commits (%d synced), got %v", seed, len(states)-1, synced, got)
+}
+
+// applyWrites returns the data with the writes applied, an empty value is a delete.
+func applyWrites(data, writes map[string]string) map[string]string {
+	result := make(map[string]string, len(data)+len(writes))
+	for key, val := range data {
+		result[key] = val
+	}
+	for key, val := range writes {
+		if val == "" {
+			delete(result, key)
+		} else {
+			result[key] = val
+		}
+	}
+
+	return result
+}
+
+func TestDB_CrashRecovery(t *testing.T) {
+	seeds := int64(50)
+	if testing.Short() {
+		seeds = 10
+	}
+
+	for seed := int64(0); seed < seeds; seed++ {
+		crashRecovery(t, seed)
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/xujiajun/nutsdb"
+	"github.com/xujiajun/nutsdb/grpcapi/nutsdbpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Client is a thin client of the KV service.
+type Client struct {
+	kv nutsdbpb.KVClient
+}
+
+// NewClient returns a client over the connection cc, e.g. made by grpc.NewClient.
+func NewClient(cc grpc.ClientConnInterface) *Client {
+	return &Client{kv: nutsdbpb.NewKVClient(cc)}
+}
+
+// notFound returns nutsdb.ErrNotFoundKey for the NOT_FOUND statuses, and err otherwise.
+func notFound(err error) error {
+	if status.Code(err) == codes.NotFound {
+		return nutsdb.ErrNotFoundKey
+	}
+
+	return err
+}
+
+// Get returns the value of the key in the bucket, or nutsdb.ErrNotFoundKey.
+func (c *Client) Get(ctx context.Context, bucket string, key []byte) ([]byte, error) {
+	resp, err := c.kv.Get(ctx, &nutsdbpb.GetRequest{Bucket: bucket, Key: key})
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	return resp.Value, nil
+}
+
+// Put puts the value of the key in the bucket, with the ttl in seconds.
+func (c *Client) Put(ctx context.Context, bucket string, key, value []byte, ttl uint32) error {
+	_, err := c.kv.Put(ctx, &nutsdbpb.PutRequest{Bucket: bucket, Key: key, Value: value, Ttl: ttl})
+	return err
+}
+
+// Delete deletes the key in the bucket, or returns nutsdb.ErrNotFoundKey.
+func (c *Client) Delete(ctx context.Context, bucket string, key []byte) error {
+	_, err := c.kv.Delete(ctx, &nutsdbpb.DeleteRequest{Bucket: bucket, Key: key})
+	return notFound(err)
+}
+
+// Scan calls fn with the keys and values of the entries of the scan, in key order,
+// until fn returns false.
+func (c *Client) Scan(ctx context.Context, req *nutsdbpb.ScanRequest, fn func(key, value []byte) bool) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := c.kv.Scan(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	for {
+		e, err := stream.Recv()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		if !fn(e.Key, e.Value) {
+			return nil
+		}
+	}
+}
+
+// Watch watches the changes of the keys with the prefix in the bucket, an empty prefix
+// watches the whole bucket. The watch runs on its own stream until it is closed.
+func (c *Client) Watch(ctx context.Context, bucket string, prefix []byte) (*Watch, error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	stream, err := c.kv.Watch(ctx)
+	if err == nil {
+		err = stream.Send(&nutsdbpb.WatchRequest{Bucket: bucket, Prefix: prefix})
+	}
+
+	var ev *nutsdbpb.WatchEvent
+	if err == nil {
+		ev, err = stream.Recv()
+	}
+
+	if err == nil && !ev.Created {
+		err = errors.New("grpcapi: the watch is not created")
+	}
+
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	w := &Watch{ch: make(chan nutsdb.Event, nutsdb.DefaultWatchBufferSize), cancel: cancel}
+	go w.recv(ctx, stream)
+
+	return w, nil
+}
+
+// Watch delivers the events of a watch.
+type Watch struct {
+	ch     chan nutsdb.Event
+	cancel context.CancelFunc
+
+	mu     sync.Mutex
+	err    error
+	closed bool
+}
+
+// recv delivers the events of the stream until the watch is canceled.
+func (w *Watch) recv(ctx context.Context, stream nutsdbpb.KV_WatchClient) {
+	defer close(w.ch)
+
+	for {
+		ev, err := stream.Recv()
+		if err != nil {
+			w.setErr(err)
+			return
+		}
+
+		if ev.Canceled {
+			switch ev.Error {
+			case "":
+				w.setErr(nutsdb.ErrWatcherClosed)
+			case nutsdb.ErrWatchOverflow.Error():
+				w.setErr(nutsdb.ErrWatchOverflow)
+			default:
+				w.setErr(errors.New(ev.Error))
+			}
+			return
+		}
+
+		e := nutsdb.Event{Bucket: ev.Bucket, Key: ev.Key, Value: ev.Value, TTL: ev.Ttl}
+		switch ev.Type {
+		case nutsdbpb.WatchEvent_DELETE:
+			e.Type = nutsdb.EventDelete
+		case nutsdbpb.WatchEvent_EXPIRE:
+			e.Type = nutsdb.EventExpire
+		}
+
+		select {
+		case w.ch <- e:
+		case <-ctx.Done():
+			w.setErr(ctx.Err())
+			return
+		}
+	}
+}
+
+func (w *Watch) setErr(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		err = nutsdb.ErrWatcherClosed
+	}
+	w.err = err
+}
+
+// Events returns the channel delivering the events, it is closed when the watch ends.
+func (w *Watch) Events() <-chan nutsdb.Event {
+	return w.ch
+}
+
+// Err returns the reason why the watch ends: nutsdb.ErrWatcherClosed if it is closed,
+// nutsdb.ErrWatchOverflow if the server could not deliver the events fast enough, or the
+// error of the stream. It returns nil while the events channel is open.
+func (w *Watch) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.err
+}
+
+// Close ends the watch and its stream.
+func (w *Watch) Close() {
+	w.mu.Lock()
+	w.closed = true
+	w.mu.Unlock()
+
+	w.cancel()
+}
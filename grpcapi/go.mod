@@ -0,0 +1,21 @@
+module github.com/xujiajun/nutsdb/grpcapi
+
+go 1.23
+
+require (
+	github.com/xujiajun/nutsdb v0.0.0-00010101000000-000000000000
+	google.golang.org/grpc v1.69.4
+	google.golang.org/protobuf v1.36.11
+)
+
+require (
+	github.com/bwmarrin/snowflake v0.3.0 // indirect
+	github.com/xujiajun/mmap-go v1.0.1 // indirect
+	github.com/xujiajun/utils v0.0.0-20190123093513-8bf096c4f53b // indirect
+	golang.org/x/net v0.30.0 // indirect
+	golang.org/x/sys v0.26.0 // indirect
+	golang.org/x/text v0.19.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20241015192408-796eee8c2d53 // indirect
+)
+
+replace github.com/xujiajun/nutsdb => ../
@@ -0,0 +1,332 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package grpcapi implements a gRPC service exposing the key/value pairs of the buckets of a nutsdb
+database, and a thin Go client of it, so that a nutsdb database can be served as a networked
+key/value store.
+
+The service is defined in nutsdbpb/nutsdb.proto:
+
+	Get     the value of a key
+	Put     put the value of a key, with a TTL in seconds
+	Delete  delete a key
+	Scan    stream the entries of a bucket filtered by a prefix or a range
+	Watch   stream the changes of the keys with a prefix, the watches are created
+	        and canceled by the requests of the client on the same stream
+
+The errors are gRPC statuses, NOT_FOUND if the bucket or the key is not found.
+
+The package is a separate module, so that the users of nutsdb do not depend on gRPC.
+*/
+package grpcapi
+
+//go:generate buf generate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/xujiajun/nutsdb"
+	"github.com/xujiajun/nutsdb/grpcapi/nutsdbpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// scanBatchSize is the number of entries a scan reads in a transaction before sending them,
+// so that a slow client does not keep a transaction open.
+const scanBatchSize = 256
+
+// Server serves the KV service of a nutsdb database.
+type Server struct {
+	nutsdbpb.UnimplementedKVServer
+
+	db *nutsdb.DB
+}
+
+// NewServer returns a server over the db.
+func NewServer(db *nutsdb.DB) *Server {
+	return &Server{db: db}
+}
+
+// Register registers the server to gs.
+func (s *Server) Register(gs *grpc.Server) {
+	nutsdbpb.RegisterKVServer(gs, s)
+}
+
+// statusError returns the gRPC status of a nutsdb error.
+func statusError(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	code := codes.Internal
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return status.FromContextError(err).Err()
+	case errors.Is(err, nutsdb.ErrBucketNotFound), errors.Is(err, nutsdb.ErrKeyNotFound), err == nutsdb.ErrBucketEmpty:
+		code = codes.NotFound
+	case err == nutsdb.ErrKeyEmpty, err == nutsdb.ErrRangeScan:
+		code = codes.InvalidArgument
+	case err == nutsdb.ErrDBClosed:
+		code = codes.Unavailable
+	case errors.Is(err, nutsdb.ErrWriteStalled):
+		code = codes.ResourceExhausted
+	}
+
+	return status.Error(code, err.Error())
+}
+
+// Get returns the value of the key.
+func (s *Server) Get(ctx context.Context, req *nutsdbpb.GetRequest) (*nutsdbpb.GetResponse, error) {
+	resp := &nutsdbpb.GetResponse{}
+	if err := s.db.ViewCtx(ctx, func(tx *nutsdb.Tx) error {
+		e, err := tx.Get(req.Bucket, req.Key)
+		if err != nil {
+			return nutsdb.ErrNotFoundKey
+		}
+		resp.Value = append([]byte{}, e.Value...)
+		resp.Ttl = e.Meta.TTL
+		return nil
+	}); err != nil {
+		return nil, statusError(err)
+	}
+
+	return resp, nil
+}
+
+// Put puts the value of the key.
+func (s *Server) Put(ctx context.Context, req *nutsdbpb.PutRequest) (*nutsdbpb.PutResponse, error) {
+	if err := s.db.UpdateCtx(ctx, func(tx *nutsdb.Tx) error {
+		return tx.Put(req.Bucket, req.Key, req.Value, req.Ttl)
+	}); err != nil {
+		return nil, statusError(err)
+	}
+
+	return &nutsdbpb.PutResponse{}, nil
+}
+
+// Delete deletes the key.
+func (s *Server) Delete(ctx context.Context, req *nutsdbpb.DeleteRequest) (*nutsdbpb.DeleteResponse, error) {
+	if err := s.db.UpdateCtx(ctx, func(tx *nutsdb.Tx) error {
+		if _, err := tx.Get(req.Bucket, req.Key); err != nil {
+			return nutsdb.ErrNotFoundKey
+		}
+		return tx.Delete(req.Bucket, req.Key)
+	}); err != nil {
+		return nil, statusError(err)
+	}
+
+	return &nutsdbpb.DeleteResponse{}, nil
+}
+
+// Scan streams the entries of the bucket, read by batches of scanBatchSize entries
+// in separate transactions.
+func (s *Server) Scan(req *nutsdbpb.ScanRequest, stream nutsdbpb.KV_ScanServer) error {
+	var (
+		start  = req.Start
+		cursor string
+		sent   uint32
+	)
+
+	for {
+		n := scanBatchSize
+		if req.Limit > 0 && req.Limit-sent < uint32(n) {
+			n = int(req.Limit - sent)
+		}
+
+		var (
+			batch []*nutsdbpb.Entry
+			done  bool
+		)
+
+		err := s.db.ViewCtx(stream.Context(), func(tx *nutsdb.Tx) error {
+			if len(req.End) > 0 {
+				err := tx.RangeScanFn(req.Bucket, start, req.End, func(key, value []byte) bool {
+					batch = append(batch, &nutsdbpb.Entry{Key: append([]byte{}, key...), Value: append([]byte{}, value...)})
+					return len(batch) < n
+				})
+				if done = len(batch) < n; !done {
+					// the next batch starts right after the last key.
+					start = append(append([]byte{}, batch[len(batch)-1].Key...), 0)
+					done = bytes.Compare(start, req.End) > 0
+				}
+				return err
+			}
+
+			es, next, err := tx.PrefixScanCursor(req.Bucket, req.Prefix, cursor, n)
+			for _, e := range es {
+				batch = append(batch, &nutsdbpb.Entry{Key: append([]byte{}, e.Key...), Value: append([]byte{}, e.Value...)})
+			}
+			cursor, done = next, next == ""
+			return err
+		})
+		if err != nil {
+			if errors.Is(err, nutsdb.ErrBucketNotFound) || err == nutsdb.ErrPrefixScan {
+				// no entry in the bucket or the scan.
+				return nil
+			}
+			return statusError(err)
+		}
+
+		for _, e := range batch {
+			if err := stream.Send(e); err != nil {
+				return err
+			}
+		}
+
+		sent += uint32(len(batch))
+		if done || req.Limit > 0 && sent >= req.Limit {
+			return nil
+		}
+	}
+}
+
+// Watch serves the watches created by the requests of the stream, until the stream ends.
+func (s *Server) Watch(stream nutsdbpb.KV_WatchServer) error {
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+
+	ws := &watchStream{
+		ctx:      ctx,
+		out:      make(chan *nutsdbpb.WatchEvent),
+		watchers: make(map[uint64]*nutsdb.Watcher),
+	}
+	defer ws.closeAll()
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- ws.recv(s.db, stream)
+	}()
+
+	for {
+		select {
+		case ev := <-ws.out:
+			if err := stream.Send(ev); err != nil {
+				return err
+			}
+		case err := <-errc:
+			if err != nil {
+				return err
+			}
+			// the client sends no more request, the watches go on.
+			errc = nil
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+}
+
+// watchStream represents the watches of a Watch stream. The events of the watches are sent
+// to out, which is sent to the stream by a single goroutine.
+type watchStream struct {
+	ctx context.Context
+	out chan *nutsdbpb.WatchEvent
+
+	mu       sync.Mutex
+	nextID   uint64
+	watchers map[uint64]*nutsdb.Watcher
+}
+
+// recv creates and cancels the watches of the requests of the stream, until the client stops
+// sending, then it returns nil.
+func (ws *watchStream) recv(db *nutsdb.DB, stream nutsdbpb.KV_WatchServer) error {
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if req.Cancel {
+			ws.mu.Lock()
+			w, ok := ws.watchers[req.WatchId]
+			ws.mu.Unlock()
+			if ok {
+				w.Close()
+			}
+			continue
+		}
+
+		w, err := db.Watch(req.Bucket, req.Prefix)
+		if err != nil {
+			return statusError(err)
+		}
+
+		ws.mu.Lock()
+		ws.nextID++
+		id := ws.nextID
+		ws.watchers[id] = w
+		ws.mu.Unlock()
+
+		// the created event comes before the changes of the watch.
+		if !ws.send(&nutsdbpb.WatchEvent{WatchId: id, Created: true}) {
+			return nil
+		}
+		go ws.forward(id, w)
+	}
+}
+
+// forward sends the events of the watcher, and the canceled event when it is closed.
+func (ws *watchStream) forward(id uint64, w *nutsdb.Watcher) {
+	for e := range w.Events() {
+		ev := &nutsdbpb.WatchEvent{WatchId: id, Bucket: e.Bucket, Key: e.Key, Value: e.Value, Ttl: e.TTL}
+		switch e.Type {
+		case nutsdb.EventDelete:
+			ev.Type = nutsdbpb.WatchEvent_DELETE
+		case nutsdb.EventExpire:
+			ev.Type = nutsdbpb.WatchEvent_EXPIRE
+		}
+
+		if !ws.send(ev) {
+			return
+		}
+	}
+
+	ws.mu.Lock()
+	delete(ws.watchers, id)
+	ws.mu.Unlock()
+
+	ev := &nutsdbpb.WatchEvent{WatchId: id, Canceled: true}
+	if err := w.Err(); err != nutsdb.ErrWatcherClosed {
+		ev.Error = err.Error()
+	}
+	ws.send(ev)
+}
+
+// send sends the event to out, it returns false if the stream ends first.
+func (ws *watchStream) send(ev *nutsdbpb.WatchEvent) bool {
+	select {
+	case ws.out <- ev:
+		return true
+	case <-ws.ctx.Done():
+		return false
+	}
+}
+
+// closeAll closes the watchers of the stream.
+func (ws *watchStream) closeAll() {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	for _, w := range ws.watchers {
+		w.Close()
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcapi
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/xujiajun/nutsdb"
+	"github.com/xujiajun/nutsdb/grpcapi/nutsdbpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newTestClient returns a client of a server over the db, on an in-memory connection.
+func newTestClient(t *testing.T, db *nutsdb.DB) *Client {
+	lis := bufconn.Listen(1 << 20)
+	gs := grpc.NewServer()
+	NewServer(db).Register(gs)
+	go gs.Serve(lis)
+	t.Cleanup(gs.Stop)
+
+	cc, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cc.Close() })
+
+	return NewClient(cc)
+}
+
+func scanKeys(t *testing.T, c *Client, req *nutsdbpb.ScanRequest) (keys []string) {
+	t.Helper()
+
+	if err := c.Scan(context.Background(), req, func(key, value []byte) bool {
+		keys = append(keys, string(key))
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	return keys
+}
+
+func TestServer(t *testing.T) {
+	opt := nutsdb.DefaultOptions
+	opt.Dir = "/tmp/nutsdbtestforgrpcapi"
+	os.RemoveAll(opt.Dir)
+	db, err := nutsdb.Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	c := newTestClient(t, db)
+	ctx := context.Background()
+
+	for i := 0; i < 2*scanBatchSize+10; i++ {
+		if err := c.Put(ctx, "b1", []byte(fmt.Sprintf("user_%04d", i)), []byte(fmt.Sprintf("val_%d", i)), nutsdb.Persistent); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Put(ctx, "b1", []byte("other"), []byte("val"), nutsdb.Persistent); err != nil {
+		t.Fatal(err)
+	}
+
+	if value, err := c.Get(ctx, "b1", []byte("user_0001")); err != nil || string(value) != "val_1" {
+		t.Errorf("err get, got %q %v", value, err)
+	}
+	if _, err := c.Get(ctx, "b1", []byte("missing")); err != nutsdb.ErrNotFoundKey {
+		t.Errorf("err get, got %v want %v", err, nutsdb.ErrNotFoundKey)
+	}
+
+	if err := c.Delete(ctx, "b1", []byte("user_0000")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Delete(ctx, "b1", []byte("user_0000")); err != nutsdb.ErrNotFoundKey {
+		t.Errorf("err delete, got %v want %v", err, nutsdb.ErrNotFoundKey)
+	}
+
+	// the scans span several batches.
+	keys := scanKeys(t, c, &nutsdbpb.ScanRequest{Bucket: "b1", Prefix: []byte("user_")})
+	if len(keys) != 2*scanBatchSize+9 || keys[0] != "user_0001" || keys[len(keys)-1] != "user_0521" {
+		t.Errorf("err prefix scan, got %d keys", len(keys))
+	}
+
+	keys = scanKeys(t, c, &nutsdbpb.ScanRequest{Bucket: "b1", Start: []byte("user_0000"), End: []byte("user_0512")})
+	if len(keys) != 2*scanBatchSize || keys[0] != "user_0001" || keys[len(keys)-1] != "user_0512" {
+		t.Errorf("err range scan, got %d keys", len(keys))
+	}
+
+	keys = scanKeys(t, c, &nutsdbpb.ScanRequest{Bucket: "b1", Limit: 3})
+	if fmt.Sprint(keys) != "[other user_0001 user_0002]" {
+		t.Errorf("err scan, got %v", keys)
+	}
+
+	if keys = scanKeys(t, c, &nutsdbpb.ScanRequest{Bucket: "missing"}); len(keys) != 0 {
+		t.Errorf("err scan, got %v", keys)
+	}
+
+	// the callback stops the scan.
+	n := 0
+	if err := c.Scan(ctx, &nutsdbpb.ScanRequest{Bucket: "b1"}, func(key, value []byte) bool {
+		n++
+		return n < 5
+	}); err != nil || n != 5 {
+		t.Errorf("err scan, got %d entries %v", n, err)
+	}
+}
+
+func TestServer_Watch(t *testing.T) {
+	opt := nutsdb.DefaultOptions
+	opt.Dir = "/tmp/nutsdbtestforgrpcapiwatch"
+	os.RemoveAll(opt.Dir)
+	db, err := nutsdb.Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	c := newTestClient(t, db)
+	ctx := context.Background()
+
+	w, err := c.Watch(ctx, "b1", []byte("user_"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Put(ctx, "b1", []byte("other"), []byte("val"), nutsdb.Persistent); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Put(ctx, "b1", []byte("user_1"), []byte("val_1"), 60); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Delete(ctx, "b1", []byte("user_1")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []nutsdb.Event{
+		{Type: nutsdb.EventPut, Bucket: "b1", Key: []byte("user_1"), Value: []byte("val_1"), TTL: 60},
+		{Type: nutsdb.EventDelete, Bucket: "b1", Key: []byte("user_1")},
+	} {
+		select {
+		case e := <-w.Events():
+			if e.Type != want.Type || string(e.Key) != string(want.Key) || string(e.Value) != string(want.Value) || e.TTL != want.TTL {
+				t.Errorf("err watch event, got %+v want %+v", e, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("err watch event, timed out")
+		}
+	}
+
+	w.Close()
+	for range w.Events() {
+	}
+	if err := w.Err(); err != nutsdb.ErrWatcherClosed {
+		t.Errorf("err watch, got %v want %v", err, nutsdb.ErrWatcherClosed)
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import "sync"
+
+// Mutation represents a write of a read/write tx.
+type Mutation struct {
+	Bucket string
+	Key    []byte
+	Value  []byte
+	Flag   uint16 // the operation, DataSetFlag, DataDeleteFlag, DataLPushFlag...
+	DS     uint16 // the data structure, DataStructureBPTree, DataStructureSet...
+	TTL    uint32
+}
+
+// CommitHook is the callback called after a read/write tx with writes is committed,
+// with the id of the tx and its writes in the order they are done.
+type CommitHook func(txID uint64, mutations []Mutation)
+
+// RollbackHook is the callback called after a read/write tx is rolled back,
+// with the id of the tx and the writes it discards.
+type RollbackHook func(txID uint64, mutations []Mutation)
+
+// Validator is the callback called before a read/write tx with writes is committed, with the
+// tx still open and the writes it is about to commit. A non-nil error vetoes the commit:
+// nothing is written and Commit returns the error.
+type Validator func(tx *Tx, mutations []Mutation) error
+
+// txHooks records the hooks of the txs, they are registered and removed concurrently
+// with the txs, so it has its own lock.
+type txHooks struct {
+	mu         sync.Mutex
+	commits    []*CommitHook
+	rollbacks  []*RollbackHook
+	validators []*Validator
+}
+
+// OnCommit registers the hook called after each commit of a read/write tx with writes and returns
+// the func removing it. The hooks are called after the db is unlocked, so they can use the db,
+// in the goroutine of Commit: the hooks of the txs committed concurrently may run in any order.
+// The writes of the merges are not passed to the hooks, the deletes of the expiration worker are.
+func (db *DB) OnCommit(fn CommitHook) (remove func()) {
+	db.hooks.mu.Lock()
+	defer db.hooks.mu.Unlock()
+
+	h := &fn
+	db.hooks.commits = append(db.hooks.commits, h)
+
+	return func() {
+		db.hooks.mu.Lock()
+		defer db.hooks.mu.Unlock()
+
+		for i, c := range db.hooks.commits {
+			if c == h {
+				db.hooks.commits = append(db.hooks.commits[:i:i], db.hooks.commits[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// OnRollback registers the hook called after each rollback of a read/write tx and returns the func
+// removing it. The hooks are called after the db is unlocked, so they can use the db.
+func (db *DB) OnRollback(fn RollbackHook) (remove func()) {
+	db.hooks.mu.Lock()
+	defer db.hooks.mu.Unlock()
+
+	h := &fn
+	db.hooks.rollbacks = append(db.hooks.rollbacks, h)
+
+	return func() {
+		db.hooks.mu.Lock()
+		defer db.hooks.mu.Unlock()
+
+		for i, r := range db.hooks.rollbacks {
+			if r == h {
+				db.hooks.rollbacks = append(db.hooks.rollbacks[:i:i], db.hooks.rollbacks[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// AddValidator registers the validator called before each commit of a read/write tx with writes,
+// and returns the func removing it. The validators are called in the order they are registered
+// with the db locked, they can read and write through the tx but must not use the db. The txs of
+// the merges and of the expiration worker are not validated.
+func (db *DB) AddValidator(fn Validator) (remove func()) {
+	db.hooks.mu.Lock()
+	defer db.hooks.mu.Unlock()
+
+	h := &fn
+	db.hooks.validators = append(db.hooks.validators, h)
+
+	return func() {
+		db.hooks.mu.Lock()
+		defer db.hooks.mu.Unlock()
+
+		for i, v := range db.hooks.validators {
+			if v == h {
+				db.hooks.validators = append(db.hooks.validators[:i:i], db.hooks.validators[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// mutations returns the writes of the tx.
+func (tx *Tx) mutations() []Mutation {
+	mutations := make([]Mutation, len(tx.pendingWrites))
+	for i, e := range tx.pendingWrites {
+		mutations[i] = Mutation{
+			Bucket: string(e.Meta.bucket),
+			Key:    e.Key,
+			Value:  e.Value,
+			Flag:   e.Meta.Flag,
+			DS:     e.Meta.ds,
+			TTL:    e.Meta.TTL,
+		}
+	}
+
+	return mutations
+}
+
+// validate calls the validators of the commit of the tx, the first error vetoes it.
+func (tx *Tx) validate() error {
+	if tx.isMerging || tx.isExpiring || len(tx.pendingWrites) == 0 {
+		return nil
+	}
+
+	tx.db.hooks.mu.Lock()
+	validators := append([]*Validator(nil), tx.db.hooks.validators...)
+	tx.db.hooks.mu.Unlock()
+
+	if len(validators) == 0 {
+		return nil
+	}
+
+	mutations := tx.mutations()
+	for _, v := range validators {
+		if err := (*v)(tx, mutations); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// commitHooks returns the func calling the commit hooks with the writes of the tx,
+// or nil if there is none to call. It is called before the tx is cleared.
+func (tx *Tx) commitHooks() func() {
+	if tx.isMerging || len(tx.pendingWrites) == 0 {
+		return nil
+	}
+
+	tx.db.hooks.mu.Lock()
+	hooks := append([]*CommitHook(nil), tx.db.hooks.commits...)
+	tx.db.hooks.mu.Unlock()
+
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	txID, mutations := tx.id, tx.mutations()
+
+	return func() {
+		for _, h := range hooks {
+			(*h)(txID, mutations)
+		}
+	}
+}
+
+// rollbackHooks returns the func calling the rollback hooks with the writes of the tx,
+// or nil if there is none to call. It is called before the tx is cleared.
+func (tx *Tx) rollbackHooks() func() {
+	if !tx.writable || tx.isMerging {
+		return nil
+	}
+
+	tx.db.hooks.mu.Lock()
+	hooks := append([]*RollbackHook(nil), tx.db.hooks.rollbacks...)
+	tx.db.hooks.mu.Unlock()
+
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	txID, mutations := tx.id, tx.mutations()
+
+	return func() {
+		for _, h := range hooks {
+			(*h)(txID, mutations)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDB_TxHooks(t *testing.T) {
+	InitOpt("/tmp/nutsdbtesthooks", true)
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var (
+		committed  []Mutation
+		rolledBack []Mutation
+	)
+	removeCommit := db.OnCommit(func(txID uint64, mutations []Mutation) {
+		committed = append(committed, mutations...)
+	})
+	db.OnRollback(func(txID uint64, mutations []Mutation) {
+		rolledBack = append(rolledBack, mutations...)
+	})
+
+	errReadOnlyKey := errors.New("the key is read-only")
+	removeValidator := db.AddValidator(func(tx *Tx, mutations []Mutation) error {
+		for _, m := range mutations {
+			if string(m.Key) == "readonly" {
+				return errReadOnlyKey
+			}
+		}
+		return nil
+	})
+
+	if err := db.Update(func(tx *Tx) error {
+		if err := tx.Put("bucket", []byte("key_1"), []byte("val_1"), Persistent); err != nil {
+			return err
+		}
+		return tx.Delete("bucket", []byte("key_0"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(committed) != 2 || string(committed[0].Key) != "key_1" || string(committed[0].Value) != "val_1" ||
+		committed[1].Flag != DataDeleteFlag || committed[1].DS != DataStructureBPTree {
+		t.Errorf("err OnCommit, got %v", committed)
+	}
+
+	// the validator vetoes the commit, which is rolled back.
+	if err := db.Update(func(tx *Tx) error {
+		if err := tx.Put("bucket", []byte("key_2"), []byte("val_2"), Persistent); err != nil {
+			return err
+		}
+		return tx.Put("bucket", []byte("readonly"), []byte("val"), Persistent)
+	}); err != errReadOnlyKey {
+		t.Errorf("err AddValidator, got %v want %v", err, errReadOnlyKey)
+	}
+
+	if len(committed) != 2 || len(rolledBack) != 2 {
+		t.Errorf("err vetoed commit, got %d committed %d rolled back", len(committed), len(rolledBack))
+	}
+
+	if err := db.View(func(tx *Tx) error {
+		if _, err := tx.Get("bucket", []byte("key_2")); err == nil {
+			t.Error("err vetoed commit, key_2 is written")
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	removeValidator()
+	removeCommit()
+
+	if err := db.Update(func(tx *Tx) error {
+		return tx.Put("bucket", []byte("readonly"), []byte("val"), Persistent)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(committed) != 2 {
+		t.Errorf("err removed OnCommit, got %d mutations want %d", len(committed), 2)
+	}
+}
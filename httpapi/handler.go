@@ -0,0 +1,435 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package httpapi implements an embeddable http.Handler exposing the data and the admin
+operations of a nutsdb database over HTTP.
+
+The data API serves the key/value pairs of the buckets:
+
+	GET    /buckets                          the buckets with live keys
+	GET    /buckets/{bucket}/stats           the BucketStats of the bucket
+	DELETE /buckets/{bucket}                 delete all the keys of the bucket
+	GET    /buckets/{bucket}/keys/{key}      the raw value of the key
+	PUT    /buckets/{bucket}/keys/{key}      put the request body as the value, with ?ttl=seconds
+	DELETE /buckets/{bucket}/keys/{key}      delete the key
+	PUT    /buckets/{bucket}/keys/{key}/ttl  set the TTL of the key to ?ttl=seconds, 0 means persistent
+	GET    /buckets/{bucket}/keys            scan the keys, see below
+
+The scan lists the entries of the bucket in key order, filtered by ?prefix= or by the range
+?start=&end=, and paginated by ?offset=&limit=. The keys and values are base64 encoded in the
+JSON reply, and next is the offset of the next page, -1 on the last page.
+
+The admin API:
+
+	GET  /admin/stats   the stats of the database
+	POST /admin/merge   merge the data files
+	GET  /admin/backup  a tar.gz backup of the database, see DB.BackupTarGZ
+
+The errors are replied as {"error": "..."} with the status code.
+*/
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/xujiajun/nutsdb"
+)
+
+// DefaultScanLimit is the number of entries of a scan page without ?limit=.
+const DefaultScanLimit = 100
+
+// Handler serves the HTTP API of a nutsdb database.
+type Handler struct {
+	db *nutsdb.DB
+}
+
+// NewHandler returns a handler over the db, it can be mounted under a prefix with http.StripPrefix.
+func NewHandler(db *nutsdb.DB) *Handler {
+	return &Handler{db: db}
+}
+
+// ScanEntry is an entry in the reply of a scan.
+type ScanEntry struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+	TTL   uint32 `json:"ttl"`
+}
+
+// ScanResult is the reply of a scan.
+type ScanResult struct {
+	Entries []ScanEntry `json:"entries"`
+	Next    int         `json:"next"`
+}
+
+// Stats is the reply of /admin/stats.
+type Stats struct {
+	KeyCount int                            `json:"key_count"`
+	Buckets  map[string]*nutsdb.BucketStats `json:"buckets"`
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := splitPath(r.URL.EscapedPath())
+	if parts == nil {
+		writeError(w, http.StatusBadRequest, "invalid path")
+		return
+	}
+
+	switch {
+	case len(parts) == 2 && parts[0] == "admin":
+		h.serveAdmin(w, r, parts[1])
+	case len(parts) == 1 && parts[0] == "buckets":
+		allowMethods(w, r, h.listBuckets, http.MethodGet)
+	case len(parts) == 2 && parts[0] == "buckets":
+		allowMethods(w, r, func(w http.ResponseWriter, r *http.Request) {
+			h.deleteBucket(w, parts[1])
+		}, http.MethodDelete)
+	case len(parts) == 3 && parts[0] == "buckets" && parts[2] == "stats":
+		allowMethods(w, r, func(w http.ResponseWriter, r *http.Request) {
+			h.bucketStats(w, parts[1])
+		}, http.MethodGet)
+	case len(parts) == 3 && parts[0] == "buckets" && parts[2] == "keys":
+		allowMethods(w, r, func(w http.ResponseWriter, r *http.Request) {
+			h.scan(w, r, parts[1])
+		}, http.MethodGet)
+	case len(parts) == 4 && parts[0] == "buckets" && parts[2] == "keys":
+		h.serveKey(w, r, parts[1], []byte(parts[3]))
+	case len(parts) == 5 && parts[0] == "buckets" && parts[2] == "keys" && parts[4] == "ttl":
+		allowMethods(w, r, func(w http.ResponseWriter, r *http.Request) {
+			h.setTTL(w, r, parts[1], []byte(parts[3]))
+		}, http.MethodPut)
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// splitPath returns the unescaped segments of the path, nil if a segment is invalid.
+func splitPath(p string) []string {
+	var parts []string
+
+	for _, s := range strings.Split(strings.Trim(p, "/"), "/") {
+		part, err := url.PathUnescape(s)
+		if err != nil {
+			return nil
+		}
+		parts = append(parts, part)
+	}
+
+	return parts
+}
+
+// allowMethods calls fn if the method of the request is one of methods.
+func allowMethods(w http.ResponseWriter, r *http.Request, fn http.HandlerFunc, methods ...string) {
+	for _, m := range methods {
+		if r.Method == m {
+			fn(w, r)
+			return
+		}
+	}
+
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+// writeErr writes a nutsdb error, with 404 if the bucket or the key is not found.
+func writeErr(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, nutsdb.ErrBucketNotFound), errors.Is(err, nutsdb.ErrKeyNotFound), err == nutsdb.ErrBucketEmpty:
+		writeError(w, http.StatusNotFound, err.Error())
+	case err == nutsdb.ErrKeyEmpty:
+		writeError(w, http.StatusBadRequest, err.Error())
+	case err == nutsdb.ErrIsMerging, err == nutsdb.ErrNotEnoughFilesToMerge:
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// isScanNotFound reports whether err is returned by a scan because there is no entry.
+func isScanNotFound(err error) bool {
+	return errors.Is(err, nutsdb.ErrBucketNotFound) || errors.Is(err, nutsdb.ErrBucketEmpty) ||
+		errors.Is(err, nutsdb.ErrPrefixScan) || errors.Is(err, nutsdb.ErrRangeScan)
+}
+
+// maxBodySize is the max size of a value put by a request.
+const maxBodySize = 64 << 20
+
+// errBodyTooLarge is returned by readBody when the body is larger than maxBodySize.
+var errBodyTooLarge = errors.New("request body too large")
+
+// readBody reads the request body, errBodyTooLarge if it is larger than maxBodySize.
+func readBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil && len(body) == maxBodySize {
+		return nil, errBodyTooLarge
+	}
+
+	return body, err
+}
+
+// queryInt returns the int query parameter of the name, def if it is not set.
+func queryInt(r *http.Request, name string, def int) (int, error) {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return def, nil
+	}
+
+	return strconv.Atoi(s)
+}
+
+func (h *Handler) listBuckets(w http.ResponseWriter, r *http.Request) {
+	buckets, err := h.db.Buckets()
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+
+	if buckets == nil {
+		buckets = []string{}
+	}
+
+	writeJSON(w, http.StatusOK, buckets)
+}
+
+func (h *Handler) deleteBucket(w http.ResponseWriter, bucket string) {
+	if err := h.db.Update(func(tx *nutsdb.Tx) error {
+		return tx.DeleteBucket(bucket)
+	}); err != nil {
+		writeErr(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) bucketStats(w http.ResponseWriter, bucket string) {
+	stats, err := h.db.BucketStats(bucket)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, stats)
+}
+
+func (h *Handler) serveKey(w http.ResponseWriter, r *http.Request, bucket string, key []byte) {
+	switch r.Method {
+	case http.MethodGet:
+		var value []byte
+		if err := h.db.View(func(tx *nutsdb.Tx) error {
+			e, err := tx.Get(bucket, key)
+			if err != nil {
+				return err
+			}
+			value = append([]byte{}, e.Value...)
+			return nil
+		}); err != nil {
+			writeErr(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(value)
+	case http.MethodPut:
+		ttl, err := queryInt(r, "ttl", int(nutsdb.Persistent))
+		if err != nil || ttl < 0 {
+			writeError(w, http.StatusBadRequest, "invalid ttl")
+			return
+		}
+
+		value, err := readBody(w, r)
+		if err == errBodyTooLarge {
+			writeError(w, http.StatusRequestEntityTooLarge, err.Error())
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if err := h.db.Update(func(tx *nutsdb.Tx) error {
+			return tx.Put(bucket, key, value, uint32(ttl))
+		}); err != nil {
+			writeErr(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		if err := h.db.Update(func(tx *nutsdb.Tx) error {
+			if _, err := tx.Get(bucket, key); err != nil {
+				return err
+			}
+			return tx.Delete(bucket, key)
+		}); err != nil {
+			writeErr(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// setTTL puts the value of the key again with the TTL of ?ttl=.
+func (h *Handler) setTTL(w http.ResponseWriter, r *http.Request, bucket string, key []byte) {
+	ttl, err := queryInt(r, "ttl", -1)
+	if err != nil || ttl < 0 {
+		writeError(w, http.StatusBadRequest, "invalid ttl")
+		return
+	}
+
+	if err := h.db.Update(func(tx *nutsdb.Tx) error {
+		e, err := tx.Get(bucket, key)
+		if err != nil {
+			return err
+		}
+		return tx.Put(bucket, key, append([]byte{}, e.Value...), uint32(ttl))
+	}); err != nil {
+		writeErr(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// scan serves a page of the entries of the bucket filtered by ?prefix= or ?start=&end=.
+func (h *Handler) scan(w http.ResponseWriter, r *http.Request, bucket string) {
+	q := r.URL.Query()
+
+	offset, err := queryInt(r, "offset", 0)
+	if err != nil || offset < 0 {
+		writeError(w, http.StatusBadRequest, "invalid offset")
+		return
+	}
+
+	limit, err := queryInt(r, "limit", DefaultScanLimit)
+	if err != nil || limit < 1 {
+		writeError(w, http.StatusBadRequest, "invalid limit")
+		return
+	}
+
+	result := ScanResult{Entries: []ScanEntry{}, Next: -1}
+
+	err = h.db.View(func(tx *nutsdb.Tx) error {
+		var (
+			entries nutsdb.Entries
+			skip    = offset // the entries to skip in entries
+			err     error
+		)
+
+		switch {
+		case q.Get("prefix") != "":
+			// one more entry to know if there is a next page.
+			entries, _, err = tx.PrefixScan(bucket, []byte(q.Get("prefix")), offset, limit+1)
+			skip = 0
+		case q.Get("start") != "" || q.Get("end") != "":
+			entries, err = tx.RangeScan(bucket, []byte(q.Get("start")), []byte(q.Get("end")))
+		default:
+			entries, err = tx.GetAll(bucket)
+		}
+		if isScanNotFound(err) {
+			// no entry in the bucket or the scan.
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if skip >= len(entries) {
+			return nil
+		}
+		entries = entries[skip:]
+
+		if len(entries) > limit {
+			entries = entries[:limit]
+			result.Next = offset + limit
+		}
+
+		for _, e := range entries {
+			result.Entries = append(result.Entries, ScanEntry{
+				Key:   append([]byte{}, e.Key...),
+				Value: append([]byte{}, e.Value...),
+				TTL:   e.Meta.TTL,
+			})
+		}
+
+		return nil
+	})
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (h *Handler) serveAdmin(w http.ResponseWriter, r *http.Request, op string) {
+	switch op {
+	case "stats":
+		allowMethods(w, r, h.stats, http.MethodGet)
+	case "merge":
+		allowMethods(w, r, h.merge, http.MethodPost)
+	case "backup":
+		allowMethods(w, r, h.backup, http.MethodGet)
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (h *Handler) stats(w http.ResponseWriter, r *http.Request) {
+	s, err := h.db.Stats()
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, Stats{KeyCount: s.KeyCount, Buckets: s.Buckets})
+}
+
+func (h *Handler) merge(w http.ResponseWriter, r *http.Request) {
+	if err := h.db.Merge(); err != nil {
+		writeErr(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) backup(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", `attachment; filename="nutsdb-backup.tar.gz"`)
+
+	// the status is already sent, a failed backup breaks the gzip stream.
+	h.db.BackupTarGZ(w)
+}
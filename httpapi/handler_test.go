@@ -0,0 +1,156 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpapi
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/xujiajun/nutsdb"
+)
+
+func do(t *testing.T, h http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func TestHandler(t *testing.T) {
+	opt := nutsdb.DefaultOptions
+	opt.Dir = "/tmp/nutsdbtestforhttpapi"
+	os.RemoveAll(opt.Dir)
+	db, err := nutsdb.Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	h := NewHandler(db)
+
+	for _, key := range []string{"user_1", "user_2", "user_3", "other"} {
+		if rec := do(t, h, http.MethodPut, "/buckets/b1/keys/"+key, "val_"+key); rec.Code != http.StatusNoContent {
+			t.Fatalf("err put, got %d %s", rec.Code, rec.Body)
+		}
+	}
+
+	if rec := do(t, h, http.MethodGet, "/buckets/b1/keys/user_1", ""); rec.Code != http.StatusOK || rec.Body.String() != "val_user_1" {
+		t.Errorf("err get, got %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(t, h, http.MethodGet, "/buckets/b1/keys/missing", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("err get, got %d want %d", rec.Code, http.StatusNotFound)
+	}
+	if rec := do(t, h, http.MethodPost, "/buckets/b1/keys/user_1", ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("err post, got %d want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+
+	// a body over the limit is rejected instead of being put truncated.
+	if rec := do(t, h, http.MethodPut, "/buckets/b1/keys/big", strings.Repeat("v", maxBodySize+1)); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("err put a large body, got %d want %d", rec.Code, http.StatusRequestEntityTooLarge)
+	}
+	if rec := do(t, h, http.MethodGet, "/buckets/b1/keys/big", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("err get a large body, got %d want %d", rec.Code, http.StatusNotFound)
+	}
+	if rec := do(t, h, http.MethodGet, "/buckets/missing/keys?prefix=user_", ""); rec.Code != http.StatusOK {
+		t.Errorf("err scan a missing bucket, got %d want %d", rec.Code, http.StatusOK)
+	}
+
+	var result ScanResult
+	rec := do(t, h, http.MethodGet, "/buckets/b1/keys?prefix=user_&limit=2", "")
+	if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Entries) != 2 || string(result.Entries[0].Key) != "user_1" || result.Next != 2 {
+		t.Errorf("err scan, got %+v", result)
+	}
+
+	rec = do(t, h, http.MethodGet, "/buckets/b1/keys?prefix=user_&offset=2&limit=2", "")
+	if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Entries) != 1 || string(result.Entries[0].Key) != "user_3" || result.Next != -1 {
+		t.Errorf("err scan, got %+v", result)
+	}
+
+	rec = do(t, h, http.MethodGet, "/buckets/b1/keys?start=other&end=user_1&offset=1", "")
+	if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Entries) != 1 || string(result.Entries[0].Value) != "val_user_1" {
+		t.Errorf("err scan, got %+v", result)
+	}
+
+	if rec := do(t, h, http.MethodPut, "/buckets/b1/keys/user_1/ttl?ttl=100", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("err ttl, got %d %s", rec.Code, rec.Body)
+	}
+	rec = do(t, h, http.MethodGet, "/buckets/b1/keys?prefix=user_1", "")
+	if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Entries) != 1 || result.Entries[0].TTL != 100 {
+		t.Errorf("err ttl, got %+v", result)
+	}
+
+	if rec := do(t, h, http.MethodDelete, "/buckets/b1/keys/other", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("err delete, got %d", rec.Code)
+	}
+
+	var stats Stats
+	rec = do(t, h, http.MethodGet, "/admin/stats", "")
+	if err := json.NewDecoder(rec.Body).Decode(&stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.KeyCount != 3 || stats.Buckets["b1"] == nil || stats.Buckets["b1"].KeyCount != 3 {
+		t.Errorf("err stats, got %+v", stats)
+	}
+
+	rec = do(t, h, http.MethodGet, "/admin/backup", "")
+	gr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tar.NewReader(gr).Next(); err != nil {
+		t.Errorf("err backup, got %v", err)
+	}
+
+	if rec := do(t, h, http.MethodPost, "/admin/merge", ""); rec.Code != http.StatusConflict {
+		t.Errorf("err merge, got %d want %d", rec.Code, http.StatusConflict)
+	}
+
+	if rec := do(t, h, http.MethodDelete, "/buckets/b1", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("err delete bucket, got %d", rec.Code)
+	}
+	var buckets []string
+	rec = do(t, h, http.MethodGet, "/buckets", "")
+	if err := json.NewDecoder(rec.Body).Decode(&buckets); err != nil || len(buckets) != 0 {
+		t.Errorf("err buckets, got %v %v", buckets, err)
+	}
+
+	// the errors other than not found are not replied as a missing key or an empty scan.
+	db.Close()
+	if rec := do(t, h, http.MethodGet, "/buckets/b1/keys/user_1", ""); rec.Code != http.StatusInternalServerError {
+		t.Errorf("err get on a closed db, got %d want %d", rec.Code, http.StatusInternalServerError)
+	}
+	if rec := do(t, h, http.MethodGet, "/buckets/b1/keys", ""); rec.Code != http.StatusInternalServerError {
+		t.Errorf("err scan on a closed db, got %d want %d", rec.Code, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"errors"
+	"os"
+	"path"
+	"time"
+)
+
+var (
+	// ErrInMemorySparseIdxMode is returned by Open when the db is InMemory in HintBPTSparseIdxMode,
+	// its indexes are files.
+	ErrInMemorySparseIdxMode = errors.New("HintBPTSparseIdxMode is not supported in memory")
+
+	// ErrNotPersistent is returned by Persist when the db is not InMemory with a PersistPath.
+	ErrNotPersistent = errors.New("db is not in memory with a persist path")
+)
+
+// inMemoryDir is the Dir of the db InMemory without a Dir, the paths of its data files are in it.
+const inMemoryDir = "memory"
+
+// isPersistent returns if the data of the db InMemory is persisted to the PersistPath.
+func (db *DB) isPersistent() bool {
+	return db.opt.InMemory && db.opt.PersistPath != ""
+}
+
+// Persist writes all the live data of the db InMemory to the PersistPath, in the format of
+// ExportBinary, so that the db opened again reads it. The file is replaced once it is written
+// and synced, a crash leaves the previous one.
+func (db *DB) Persist() error {
+	if !db.isPersistent() {
+		return ErrNotPersistent
+	}
+
+	p := db.opt.PersistPath
+	tmpPath := path.Dir(p) + "/." + path.Base(p) + ".tmp"
+
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	err = db.Export(f, ExportBinary)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+
+	return os.Rename(tmpPath, p)
+}
+
+// loadPersisted imports the data of the PersistPath into the db InMemory, if the file exists.
+func (db *DB) loadPersisted() error {
+	f, err := os.Open(db.opt.PersistPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return db.Import(f)
+}
+
+func (db *DB) runPersistWorker(interval time.Duration) {
+	defer db.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-db.closeCh:
+			return
+		case <-ticker.C:
+			if err := db.Persist(); err != nil {
+				db.logger().Error("persist worker", "err", err)
+			}
+		}
+	}
+}
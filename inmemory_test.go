@@ -0,0 +1,113 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"os"
+	"testing"
+)
+
+func TestDB_InMemory(t *testing.T) {
+	memOpt := DefaultOptions
+	memOpt.Dir = ""
+	memOpt.SegmentSize = 1024
+	memOpt.InMemory = true
+
+	db, err := Open(memOpt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	putBackendKeys(t, db, 50)
+	putBackendKeys(t, db, 50)
+	if err := db.Update(func(tx *Tx) error {
+		return tx.SAdd("set", []byte("key"), []byte("a"), []byte("b"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	checkBackendKeys(t, db, 50)
+
+	// no file is written.
+	if _, err := os.Stat(inMemoryDir); !os.IsNotExist(err) {
+		t.Errorf("err InMemory, the dir %s is created", inMemoryDir)
+	}
+
+	if err := db.Persist(); err != ErrNotPersistent {
+		t.Errorf("err Persist, got %v want %v", err, ErrNotPersistent)
+	}
+
+	// the data is lost when the db is closed.
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db, err = Open(memOpt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.View(func(tx *Tx) error {
+		_, err := tx.Get("bucket", []byte("key_000"))
+		return err
+	}); err == nil {
+		t.Error("err Get, got nil want the key not found")
+	}
+
+	memOpt.EntryIdxMode = HintBPTSparseIdxMode
+	if _, err := Open(memOpt); err != ErrInMemorySparseIdxMode {
+		t.Errorf("err Open, got %v want %v", err, ErrInMemorySparseIdxMode)
+	}
+}
+
+func TestDB_InMemoryPersist(t *testing.T) {
+	persistPath := "/tmp/nutsdbtestinmemory.persist"
+	os.Remove(persistPath)
+	defer os.Remove(persistPath)
+
+	memOpt := DefaultOptions
+	memOpt.InMemory = true
+	memOpt.PersistPath = persistPath
+
+	db, err := Open(memOpt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	putBackendKeys(t, db, 20)
+
+	if err := db.Persist(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(persistPath); err != nil {
+		t.Fatal(err)
+	}
+
+	// the keys written after the last persist are persisted when the db is closed.
+	putBackendKeys(t, db, 50)
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = Open(memOpt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	checkBackendKeys(t, db, 50)
+}
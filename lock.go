@@ -0,0 +1,76 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// ErrDatabaseLocked is returned by Open when another process has the database opened for writing
+// and it is not closed within the LockTimeout.
+var ErrDatabaseLocked = errors.New("database is locked by another process")
+
+// dirLockFile is the name of the lock file of the writer: the process which opens the db for
+// writing holds an exclusive lock on it until the db is closed.
+const dirLockFile = "LOCK"
+
+// lockRetryInterval is the interval of the attempts to lock the dir until the LockTimeout.
+const lockRetryInterval = 10 * time.Millisecond
+
+// getDirLockPath returns the path of the lock file of the writer.
+func (db *DB) getDirLockPath() string {
+	return db.opt.Dir + "/" + dirLockFile
+}
+
+// lockDir holds the exclusive lock of the writer until the db is closed, so that two processes
+// never write the same dir. It waits for the lock until the LockTimeout, then returns ErrDatabaseLocked.
+func (db *DB) lockDir() error {
+	f, err := os.OpenFile(db.getDirLockPath(), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(db.opt.LockTimeout)
+	for {
+		err = lockFile(f, true)
+		if err != errFileLocked || !time.Now().Before(deadline) {
+			break
+		}
+		time.Sleep(lockRetryInterval)
+	}
+
+	if err != nil {
+		f.Close()
+		if err == errFileLocked {
+			return ErrDatabaseLocked
+		}
+		return err
+	}
+
+	db.dirLock = f
+
+	return nil
+}
+
+// unlockDir releases the lock of the writer if it is held.
+func (db *DB) unlockDir() {
+	if db.dirLock != nil {
+		_ = unlockFile(db.dirLock)
+		db.dirLock.Close()
+		db.dirLock = nil
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDB_LockDir(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestlock", true)
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the dir has one writer at a time.
+	if _, err := Open(opt); err != ErrDatabaseLocked {
+		t.Errorf("err Open, got %v want %v", err, ErrDatabaseLocked)
+	}
+
+	// a writer waits for the lock until the LockTimeout.
+	waitOpt := opt
+	waitOpt.LockTimeout = 200 * time.Millisecond
+	start := time.Now()
+	if _, err := Open(waitOpt); err != ErrDatabaseLocked {
+		t.Errorf("err Open, got %v want %v", err, ErrDatabaseLocked)
+	}
+	if elapsed := time.Since(start); elapsed < waitOpt.LockTimeout {
+		t.Errorf("err Open, returned after %s before the LockTimeout", elapsed)
+	}
+
+	waitOpt.LockTimeout = 5 * time.Second
+	closed := make(chan struct{})
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		db.Close()
+		close(closed)
+	}()
+
+	other, err := Open(waitOpt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-closed
+
+	if err := other.Update(func(tx *Tx) error {
+		return tx.Put("bucket", []byte("key"), []byte("val"), Persistent)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := other.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
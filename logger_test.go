@@ -0,0 +1,64 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestNewStdLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewStdLogger(log.New(&buf, "", 0))
+
+	l.Warn("truncating", "file", "0.dat", "offset", 42, "odd")
+	if got, want := buf.String(), "WARN truncating file=0.dat offset=42 odd\n"; got != want {
+		t.Errorf("err StdLogger, got %q want %q", got, want)
+	}
+}
+
+func TestDB_Logger(t *testing.T) {
+	var buf bytes.Buffer
+
+	InitOpt("/tmp/nutsdbtestlogger", true)
+	opt.SegmentSize = 1024
+	opt.Logger = NewStdLogger(log.New(&buf, "", 0))
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 50; i++ {
+		if err := db.Update(func(tx *Tx) error {
+			return tx.Put("bucket", []byte(fmt.Sprintf("key_%03d", i)), []byte("val"), Persistent)
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"INFO database opened dir=/tmp/nutsdbtestlogger", "INFO merge started", "INFO merge finished"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("err Logger, %q not logged in %q", want, buf.String())
+		}
+	}
+}
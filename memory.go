@@ -0,0 +1,234 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import "errors"
+
+// ErrIndexMemoryLimit is returned when a commit would exceed MaxIndexMemory, with IndexMemoryReject
+// or when the keys alone would exceed it.
+var ErrIndexMemoryLimit = errors.New("the commit is rejected, the index would exceed the max memory")
+
+// IndexMemoryMode represents what a commit does when the index would exceed MaxIndexMemory.
+type IndexMemoryMode int
+
+const (
+	// IndexMemorySpill does not keep the values of the commit in the index in HintKeyValAndRAMIdxMode,
+	// and drops the values kept for the other keys as needed, the values not kept are read from the
+	// data files as in HintKeyAndRAMIdxMode. The commit fails with ErrIndexMemoryLimit only when the
+	// keys alone would exceed MaxIndexMemory.
+	IndexMemorySpill IndexMemoryMode = iota
+
+	// IndexMemoryReject fails the commit with ErrIndexMemoryLimit, nothing is written.
+	IndexMemoryReject
+)
+
+const (
+	// indexRecordOverhead is the estimated size in bytes of a record of a B+ tree index besides
+	// its key and its bucket: the record, its hint, its metadata and its slot in its leaf.
+	indexRecordOverhead = 200
+
+	// indexValueOverhead is the estimated size in bytes of the entry of a value kept in the index.
+	indexValueOverhead = 80
+)
+
+// MemoryStats records the estimated memory used by the index and the caches of the db. The index
+// is only counted in HintKeyValAndRAMIdxMode and HintKeyAndRAMIdxMode, without the old versions
+// of the keys kept for the snapshot txs.
+type MemoryStats struct {
+	// IndexBytes represents the estimated size in bytes of the records of the B+ tree indexes,
+	// the values kept with them included.
+	IndexBytes int64
+
+	// IndexValueBytes represents the part of IndexBytes of the values kept in the index.
+	IndexValueBytes int64
+
+	// SpilledValues represents the number of records of the index whose values are not kept in
+	// memory in HintKeyValAndRAMIdxMode because of MaxIndexMemory.
+	SpilledValues int
+
+	// EntryCacheBytes represents the size in bytes of the entries cached, see EntryCacheSize.
+	EntryCacheBytes int64
+}
+
+// indexMemory records the estimated memory of the B+ tree indexes, it is updated with the db locked.
+type indexMemory struct {
+	bytes   int64
+	values  int64
+	spilled int
+}
+
+// recordMemory returns the estimated size in bytes of the record without its value,
+// and of its value if it is kept with it.
+func recordMemory(r *Record) (key, value int64) {
+	key = int64(indexRecordOverhead + len(r.H.key) + len(r.H.meta.bucket))
+	if r.E != nil {
+		value = int64(indexValueOverhead + len(r.E.Value))
+	}
+
+	return key, value
+}
+
+func (m *indexMemory) add(r *Record, sign int64, keepsValues bool) {
+	key, value := recordMemory(r)
+	m.bytes += sign * (key + value)
+	m.values += sign * value
+	if keepsValues && r.E == nil {
+		m.spilled += int(sign)
+	}
+}
+
+// accountRecord records the memory of the record inserted in the index in place of old, if any.
+func (db *DB) accountRecord(r, old *Record) {
+	keepsValues := db.opt.EntryIdxMode == HintKeyValAndRAMIdxMode
+	if old != nil {
+		db.indexMemory.add(old, -1, keepsValues)
+	}
+	db.indexMemory.add(r, 1, keepsValues)
+}
+
+// spillRecord drops the value of the record to be inserted in the index when the index is built,
+// if keeping it would exceed MaxIndexMemory, whatever IndexMemoryLimit is.
+func (db *DB) spillRecord(r *Record) {
+	if max := db.opt.MaxIndexMemory; max > 0 && r.E != nil {
+		key, value := recordMemory(r)
+		if db.indexMemory.bytes+key+value > max {
+			r.E = nil
+		}
+	}
+}
+
+// spillTarget returns the size of the index the values are spilled down to when max is exceeded,
+// 7/8 of it so that the next commits do not spill again at once.
+func spillTarget(max int64) int64 {
+	return max - max/8
+}
+
+// fitIndexMemory drops the values kept in the index built on open beyond MaxIndexMemory.
+func (db *DB) fitIndexMemory() {
+	if max := db.opt.MaxIndexMemory; max > 0 && db.indexMemory.bytes > max {
+		db.spillIndexValues(db.indexMemory.bytes-spillTarget(max), nil)
+	}
+}
+
+// spillIndexValues drops the values kept in the index for the keys not in written, until n bytes
+// are freed or none is kept.
+func (db *DB) spillIndexValues(n int64, written map[string]map[string]*Entry) {
+	m := &db.indexMemory
+
+	for bucket, idx := range db.BPTreeIdx {
+		if n <= 0 {
+			return
+		}
+
+		idx.ascend(nil, func(key []byte, r *Record) bool {
+			if _, ok := written[bucket][string(key)]; r.E != nil && !ok {
+				_, value := recordMemory(r)
+				r.E = nil
+
+				m.bytes -= value
+				m.values -= value
+				m.spilled++
+				n -= value
+			}
+			return n > 0
+		})
+	}
+}
+
+// checkIndexMemory checks that the index is within MaxIndexMemory after the commit of the tx, with
+// the db locked. With IndexMemorySpill it makes room by not keeping the values of the commit and by
+// dropping the values kept for the other keys. The txs of the merge and of the expiration are not failed.
+func (tx *Tx) checkIndexMemory() error {
+	db := tx.db
+	max := db.opt.MaxIndexMemory
+
+	if max <= 0 || db.opt.EntryIdxMode == HintBPTSparseIdxMode {
+		return nil
+	}
+
+	keepsValues := db.opt.EntryIdxMode == HintKeyValAndRAMIdxMode
+
+	// the memory of the records of the written keys, and of the records they replace.
+	var newKeys, newValues, oldKeys, oldValues int64
+	for bucket, writes := range tx.pendingKeys {
+		idx := db.BPTreeIdx[bucket]
+		for _, e := range writes {
+			r := &Record{H: &Hint{key: e.Key, meta: e.Meta}}
+			if keepsValues {
+				r.E = e
+			}
+			key, value := recordMemory(r)
+			newKeys += key
+			newValues += value
+
+			if idx == nil {
+				continue
+			}
+			if old, err := idx.Find(e.Key); err == nil && old != nil {
+				key, value := recordMemory(old)
+				oldKeys += key
+				oldValues += value
+			}
+		}
+	}
+
+	after := db.indexMemory.bytes + newKeys - oldKeys + newValues - oldValues
+	if after <= max {
+		return nil
+	}
+
+	exempt := tx.isMerging || tx.isExpiring
+	if db.opt.IndexMemoryLimit == IndexMemoryReject && !exempt {
+		return ErrIndexMemoryLimit
+	}
+
+	if !keepsValues {
+		if exempt {
+			return nil
+		}
+		return ErrIndexMemoryLimit
+	}
+
+	// the values of the commit are not kept, nor are the values of the records they replace.
+	tx.spillValues = true
+	after -= newValues
+
+	if after <= max {
+		return nil
+	}
+
+	if kept := db.indexMemory.values - oldValues; kept < after-max && !exempt {
+		return ErrIndexMemoryLimit
+	}
+
+	db.spillIndexValues(after-spillTarget(max), tx.pendingKeys)
+
+	return nil
+}
+
+// memoryStats returns the estimated memory used by the index and the caches.
+func (db *DB) memoryStats() MemoryStats {
+	stats := MemoryStats{
+		IndexBytes:      db.indexMemory.bytes,
+		IndexValueBytes: db.indexMemory.values,
+		SpilledValues:   db.indexMemory.spilled,
+	}
+
+	if db.entryCache != nil {
+		stats.EntryCacheBytes = db.entryCache.size()
+	}
+
+	return stats
+}
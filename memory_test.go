@@ -0,0 +1,228 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// the estimated memory of a record of "bucket" with a 7-byte key, with and without its 100-byte value.
+const (
+	memoryTestKeyBytes   = indexRecordOverhead + len("bucket") + len("key_000")
+	memoryTestValueBytes = indexValueOverhead + 100
+)
+
+func memoryTestValue(i int) []byte {
+	return bytes.Repeat([]byte{byte('a' + i%26)}, 100)
+}
+
+func putMemoryKeys(from, to int) error {
+	for i := from; i < to; i++ {
+		if err := db.Update(func(tx *Tx) error {
+			return tx.Put("bucket", []byte(fmt.Sprintf("key_%03d", i)), memoryTestValue(i), Persistent)
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func checkMemoryKeys(t *testing.T, n int) {
+	t.Helper()
+
+	if err := db.View(func(tx *Tx) error {
+		keys := make([][]byte, n)
+		for i := 0; i < n; i++ {
+			keys[i] = []byte(fmt.Sprintf("key_%03d", i))
+
+			e, err := tx.Get("bucket", keys[i])
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(e.Value, memoryTestValue(i)) {
+				return fmt.Errorf("err Get %s, got %q", keys[i], e.Value)
+			}
+		}
+
+		es, err := tx.GetMulti("bucket", keys)
+		if err != nil {
+			return err
+		}
+		all, err := tx.GetAll("bucket")
+		if err != nil {
+			return err
+		}
+		if len(all) != n {
+			return fmt.Errorf("err GetAll, got %d entries want %d", len(all), n)
+		}
+		for i := 0; i < n; i++ {
+			if !bytes.Equal(es[i].Value, memoryTestValue(i)) || !bytes.Equal(all[i].Value, memoryTestValue(i)) {
+				return fmt.Errorf("err values of %s", keys[i])
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func memoryStats(t *testing.T) MemoryStats {
+	t.Helper()
+
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return stats.MemoryStats
+}
+
+func TestDB_MemoryStats(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestmemory", true)
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := putMemoryKeys(0, 10); err != nil {
+		t.Fatal(err)
+	}
+
+	want := MemoryStats{
+		IndexBytes:      10 * int64(memoryTestKeyBytes+memoryTestValueBytes),
+		IndexValueBytes: 10 * int64(memoryTestValueBytes),
+	}
+	if got := memoryStats(t); got != want {
+		t.Errorf("err MemoryStats, got %+v want %+v", got, want)
+	}
+
+	// a delete replaces the value of the key with none.
+	if err := db.Update(func(tx *Tx) error {
+		return tx.Delete("bucket", []byte("key_009"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+	want.IndexBytes -= 100
+	want.IndexValueBytes -= 100
+	if got := memoryStats(t); got != want {
+		t.Errorf("err MemoryStats after delete, got %+v want %+v", got, want)
+	}
+
+	// the index is counted the same when it is built on open.
+	db.Close()
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := memoryStats(t); got != want {
+		t.Errorf("err MemoryStats after reopen, got %+v want %+v", got, want)
+	}
+	db.Close()
+
+	// the values are not in the index in HintKeyAndRAMIdxMode, the entries read are cached.
+	opt.EntryIdxMode = HintKeyAndRAMIdxMode
+	opt.EntryCacheSize = 1 << 20
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	checkMemoryKeys(t, 9)
+	got := memoryStats(t)
+	if got.IndexBytes != 10*int64(memoryTestKeyBytes) || got.IndexValueBytes != 0 || got.EntryCacheBytes <= 0 {
+		t.Errorf("err MemoryStats in HintKeyAndRAMIdxMode, got %+v", got)
+	}
+}
+
+func TestDB_MaxIndexMemorySpill(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestmemory", true)
+	opt.MaxIndexMemory = 10000
+	opt.CheckpointInterval = 0
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the keys fit, the values are spilled to the data files as needed.
+	if err := putMemoryKeys(0, 40); err != nil {
+		t.Fatal(err)
+	}
+	checkMemoryKeys(t, 40)
+
+	got := memoryStats(t)
+	if got.IndexBytes > opt.MaxIndexMemory || got.SpilledValues == 0 {
+		t.Errorf("err MemoryStats, got %+v", got)
+	}
+
+	// the values beyond the limit are not kept when the index is built on open,
+	// from the data files or from the checkpoint.
+	for _, checkpoint := range []bool{false, true} {
+		if checkpoint {
+			if err := db.Checkpoint(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		db.Close()
+		db, err = Open(opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkMemoryKeys(t, 40)
+
+		if got := memoryStats(t); got.IndexBytes > opt.MaxIndexMemory || got.SpilledValues == 0 {
+			t.Errorf("err MemoryStats after reopen, got %+v", got)
+		}
+	}
+
+	// the commits fail once the keys alone exceed the limit.
+	err := putMemoryKeys(40, 60)
+	if err != ErrIndexMemoryLimit {
+		t.Errorf("err put, got %v want %v", err, ErrIndexMemoryLimit)
+	}
+	db.Close()
+}
+
+func TestDB_MaxIndexMemoryReject(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestmemory", true)
+	opt.MaxIndexMemory = 10000
+	opt.IndexMemoryLimit = IndexMemoryReject
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	n := int(opt.MaxIndexMemory) / (memoryTestKeyBytes + memoryTestValueBytes)
+	if err := putMemoryKeys(0, n); err != nil {
+		t.Fatal(err)
+	}
+	if err := putMemoryKeys(n, n+1); err != ErrIndexMemoryLimit {
+		t.Errorf("err put, got %v want %v", err, ErrIndexMemoryLimit)
+	}
+	checkMemoryKeys(t, n)
+
+	// the overwrites which do not grow the index are still committed.
+	if err := putMemoryKeys(0, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := memoryStats(t); got.IndexBytes > opt.MaxIndexMemory || got.SpilledValues != 0 {
+		t.Errorf("err MemoryStats, got %+v", got)
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"time"
+
+	"github.com/xujiajun/utils/strconv2"
+)
+
+// putMergedFile adds the record of the merged data file at given fID to the tx.
+//
+// The merge tx of a data file writes the record with the live entries it rewrites, unless they
+// are all B+ tree entries, the data file is removed after the commit. If the data file is still there when the db is opened,
+// its entries are not indexed again, only the rewritten ones are, and it is removed. The
+// record is rewritten by the merge of its own data file while the merged data file is kept
+// for the snapshot txs.
+func (tx *Tx) putMergedFile(fID int64) error {
+	return tx.put("", []byte(strconv2.Int64ToStr(fID)), nil, Persistent, DataSetFlag,
+		uint64(time.Now().Unix()), DataStructureMergedFile)
+}
+
+// isMergedFileEntry checks if the entry is a merged file record.
+func isMergedFileEntry(e *Entry) bool {
+	return e.Meta.ds == DataStructureMergedFile
+}
+
+// mergedFileID returns the fID of the data file of the merged file record of given key.
+func mergedFileID(key []byte) (int64, bool) {
+	fID, err := strconv2.StrToInt64(string(key))
+	return fID, err == nil
+}
+
+// mergedFileIDs returns the data files recorded as merged by the committed records.
+func (db *DB) mergedFileIDs(records []*Record) map[int64]struct{} {
+	var fIDs map[int64]struct{}
+
+	for _, r := range records {
+		if r.H.meta.ds != DataStructureMergedFile {
+			continue
+		}
+		if _, ok := db.committedTxIds[r.H.meta.txID]; !ok {
+			continue
+		}
+
+		if fID, ok := mergedFileID(r.H.key); ok {
+			if fIDs == nil {
+				fIDs = make(map[int64]struct{})
+			}
+			fIDs[fID] = struct{}{}
+		}
+	}
+
+	return fIDs
+}
@@ -0,0 +1,157 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// copyDataFiles copies the files of the dir src to the empty dir dst.
+func copyDataFiles(t *testing.T, src, dst string) {
+	t.Helper()
+
+	if err := os.RemoveAll(dst); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(dst, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := ioutil.ReadDir(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		data, err := ioutil.ReadFile(src + "/" + f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(dst+"/"+f.Name(), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func checkMergedList(t *testing.T, bucket string, key []byte, want int) {
+	t.Helper()
+
+	if err := db.View(func(tx *Tx) error {
+		size, err := tx.LSize(bucket, key)
+		if err != nil {
+			return err
+		}
+		if size != want {
+			t.Errorf("err LSize, got %d want %d", size, want)
+		}
+
+		items, err := tx.SMembers(bucket, key)
+		if err != nil {
+			return err
+		}
+		if len(items) != want {
+			t.Errorf("err SMembers, got %d want %d", len(items), want)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDB_MergeCrashBeforeRemoval(t *testing.T) {
+	const n = 300
+	bucket, key := "bucket", []byte("key")
+	crashDir := "/tmp/nutsdbtestmergecrash_copy"
+	defer os.RemoveAll(crashDir)
+
+	InitOpt("/tmp/nutsdbtestmergecrash", true)
+	opt.SegmentSize = 8 * 1024
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < n; i++ {
+		if err := db.Update(func(tx *Tx) error {
+			value := []byte(fmt.Sprintf("val%04d", i))
+			if err := tx.RPush(bucket, key, value); err != nil {
+				return err
+			}
+			return tx.SAdd(bucket, key, value)
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the merged data files are kept for the snapshot tx, the copy of the dir is the db
+	// after a crash between the merge txs and the removals.
+	stx, err := db.BeginSnapshotTx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	if !db.dataFileExists(db.getDataPath(0)) {
+		t.Fatal("err the merged data file is removed before the snapshot tx is closed")
+	}
+	if err := db.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	copyDataFiles(t, opt.Dir, crashDir)
+	keyCount := db.KeyCount
+
+	if err := stx.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	opt.Dir = crashDir
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkMergedList(t, bucket, key, n)
+	if db.KeyCount != keyCount {
+		t.Errorf("err KeyCount, got %d want %d", db.KeyCount, keyCount)
+	}
+	if db.dataFileExists(db.getDataPath(0)) {
+		t.Error("err the merged data file is not removed on open")
+	}
+
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	checkMergedList(t, bucket, key, n)
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	checkMergedList(t, bucket, key, n)
+}
@@ -14,6 +14,11 @@
 
 package nutsdb
 
+import (
+	"runtime"
+	"time"
+)
+
 // EntryIdxMode represents entry index mode.
 type EntryIdxMode int
 
@@ -33,6 +38,36 @@ type Options struct {
 	// Dir represents Open the database located in which dir.
 	Dir string
 
+	// ReadOnly represents whether the database is opened read-only, e.g. by a backup tool or an
+	// analytics job while another process writes it. It reads the data committed when it is opened,
+	// the read/write transactions, the merges and the checkpoints return ErrDBReadOnly and the
+	// background workers are disabled. The read-only processes hold a shared lock on the READERS
+	// file of the dir, the merge of the writer returns ErrDBOpenedReadOnly while they have it open.
+	ReadOnly bool
+
+	// Backend represents the storage of the data files, e.g. a MemoryBackend for the tests or an
+	// ObjectBackend for the archived data files. Default is nil, the data files are in the Dir and
+	// read and written with the RWMode. The backups, the snapshots and the repairs need the default.
+	Backend Backend
+
+	// InMemory represents whether the database is kept in memory without any file, e.g. for the tests
+	// and the ephemeral caches. The data is lost when it is closed unless it has a PersistPath.
+	// HintBPTSparseIdxMode is not supported, and the values which do not fit a segment are rejected.
+	InMemory bool
+
+	// PersistPath represents the file the data of the InMemory database is persisted to by Persist,
+	// every PersistInterval and when it is closed, and read from when it is opened. Default is "",
+	// the data is not persisted.
+	PersistPath string
+
+	// PersistInterval represents the interval of the persists of the InMemory database to the
+	// PersistPath. Default is 0, it is only persisted by Persist and when it is closed.
+	PersistInterval time.Duration
+
+	// LockTimeout represents how long Open waits for another process which has the database opened
+	// for writing to close it, before it returns ErrDatabaseLocked. Default is 0, Open returns at once.
+	LockTimeout time.Duration
+
 	// EntryIdxMode represents using which mode to index the entries.
 	EntryIdxMode EntryIdxMode
 
@@ -43,8 +78,30 @@ type Options struct {
 	RWMode      RWMode
 	SegmentSize int64
 
+	// MaxTxEntries represents the max number of entries written by a read/write tx, the writes
+	// beyond it return ErrTxTooBig. Default is 0, it means no limit.
+	MaxTxEntries int
+
+	// MaxTxBytes represents the max size in bytes of the entries written by a read/write tx,
+	// the writes beyond it return ErrTxTooBig. Default is 0, it means no limit.
+	MaxTxBytes int64
+
+	// MaxKeySize represents the max size in bytes of a key, the writes of larger keys return
+	// ErrKeyTooLarge. Default is 0, it means the keys are only limited by SegmentSize.
+	MaxKeySize int
+
+	// MaxValueSize represents the max size in bytes of a value, the writes of larger values
+	// return ErrValueTooLarge. Default is 0, it means no limit.
+	MaxValueSize int64
+
+	// OverflowValueSize represents the size in bytes of the stored values beyond which they are
+	// written to the overflow file of their data file, the entry only references the value there.
+	// Default is 0, it means a value is only written to an overflow file when its entry does not
+	// fit in a data file, so that the values larger than SegmentSize can be written.
+	OverflowValueSize int64
+
 	// NodeNum represents the node number.
-	// Default NodeNum is 1. NodeNum range [1,1023].
+	// Default NodeNum is 1. NodeNum range [1,1023], Open returns an error out of it.
 	NodeNum int64
 
 	// SyncEnable represents if call Sync() function.
@@ -52,8 +109,160 @@ type Options struct {
 	// if SyncEnable is true, slower but persistent.
 	SyncEnable bool
 
+	// SyncPolicy represents when the commits are synced to the disk: SyncAlways, SyncNever,
+	// SyncEveryN(n) commits, SyncInterval(interval) or SyncGroup(window). If it is not set,
+	// SyncEnable chooses between SyncAlways and SyncNever.
+	SyncPolicy SyncPolicy
+
+	// MaxPendingCommitBytes represents the max size in bytes of the commits written to the data files
+	// but not synced to the disk yet, with SyncNever, SyncEveryN or SyncInterval. A commit which
+	// would exceed it stalls as chosen by Backpressure. Default is 0, it means no limit.
+	MaxPendingCommitBytes int64
+
+	// Backpressure represents what a stalled commit does, see MaxPendingCommitBytes.
+	// Default is BackpressureBlock.
+	Backpressure BackpressureMode
+
+	// OnStall represents the callback called when a commit stalls, default is nil. It is called
+	// with the db locked, so it must be fast and must not use the db.
+	OnStall func(info StallInfo)
+
+	// MaxIndexMemory represents the max estimated size in bytes of the B+ tree indexes in memory in
+	// HintKeyValAndRAMIdxMode and HintKeyAndRAMIdxMode, see MemoryStats. A commit which would exceed it
+	// is handled as chosen by IndexMemoryLimit. When the index is built on open the values beyond it
+	// are not kept, they are read from the data files. Default is 0, it means no limit.
+	MaxIndexMemory int64
+
+	// IndexMemoryLimit represents what a commit which would exceed MaxIndexMemory does.
+	// Default is IndexMemorySpill.
+	IndexMemoryLimit IndexMemoryMode
+
 	// StartFileLoadingMode represents when open a database which RWMode to load files.
 	StartFileLoadingMode RWMode
+
+	// MaxOpenFiles represents the max number of data files kept open for reading,
+	// the least recently used data files are closed when it is exceeded. The overflow
+	// files are kept open up to the same number.
+	MaxOpenFiles int
+
+	// IndexCacheSize represents the max number of the leaf nodes of the b+ trees on disk cached
+	// in HintBPTSparseIdxMode, the interior nodes are kept in memory once read. Default is 0,
+	// it means the nodes are read from the disk on each lookup.
+	IndexCacheSize int
+
+	// EntryCacheSize represents the max size in bytes of the entries read from the data files
+	// cached in memory in HintKeyAndRAMIdxMode and HintBPTSparseIdxMode, the least recently
+	// used entries are dropped when it is exceeded. Default is 0, it means the entries are
+	// read from the data files on each read.
+	EntryCacheSize int64
+
+	// PreallocateSegments represents whether the new data files are allocated up to SegmentSize
+	// when they are created, with fallocate on linux, so that the writes do not stall on the
+	// allocation of the blocks by the file system.
+	PreallocateSegments bool
+
+	// RecycleSegments represents the max number of the data files removed by a merge which are
+	// kept for reuse as the next active files instead of being removed and created again.
+	// Default is 0, it means they are removed.
+	RecycleSegments int
+
+	// RebuildWorkers represents the number of the data files parsed concurrently when the index
+	// is built on open. Default is 0, it means runtime.GOMAXPROCS(0).
+	RebuildWorkers int
+
+	// MergeInterval represents the interval of the background merge worker checking the dirty ratio.
+	// Default MergeInterval is 0, it means the automatic merge is disabled.
+	MergeInterval time.Duration
+
+	// MergeDirtyRatio represents the ratio of dirty entries (deleted, expired or overwritten)
+	// to all the entries, the background merge worker merges the data files when it is reached.
+	MergeDirtyRatio float64
+
+	// TombstoneRetention represents how long the merge keeps rewriting the deletes of the keys of the
+	// B+ trees after they are committed, instead of dropping them from the data files. Default is 0,
+	// it means the merge drops them.
+	TombstoneRetention time.Duration
+
+	// ExpiredRetention represents how long the merge keeps rewriting the expired keys of the B+ trees
+	// after they expire, instead of dropping them from the data files. Default is 0, it means the merge
+	// drops them.
+	ExpiredRetention time.Duration
+
+	// ExpireInterval represents the interval of the background expiration worker deleting the expired keys.
+	// Default ExpireInterval is 0, it means the expired keys are only filtered when reading.
+	// The expiration worker is not supported in HintBPTSparseIdxMode.
+	ExpireInterval time.Duration
+
+	// CheckpointInterval represents the interval of the background worker writing the index to
+	// the checkpoint file, it is also written when the db is closed. Open loads the checkpoint and
+	// only parses the data written after it. Default is 0, it means the checkpoint is only written
+	// by db.Checkpoint. It is not supported in HintBPTSparseIdxMode nor with the encryption.
+	CheckpointInterval time.Duration
+
+	// TruncateOnCorruption represents whether Open truncates a data file at its first
+	// corrupted entry (crc mismatch or broken header) instead of failing to open.
+	// The entries after the corrupted one in that data file are discarded.
+	TruncateOnCorruption bool
+
+	// OpenCorrupted represents whether Open stops parsing a data file at its first corrupted
+	// entry and opens with the entries before it instead of failing to open. Unlike
+	// TruncateOnCorruption the data files are left unchanged for db.Verify and db.Repair,
+	// a corrupted active file is sealed so that the writes go to a new data file.
+	OpenCorrupted bool
+
+	// RecoveryMode represents how much of the data Open checks: RecoveryFast trusts the checkpoint
+	// and the b+ tree index files, RecoveryChecksum also checks the crc of all the entries of the
+	// active data file, RecoveryFull checks the crc of the entries of all the data files and that
+	// the records of the index point at their entries, and returns ErrRecoveryCheck if they fail.
+	// Default is RecoveryChecksum.
+	RecoveryMode RecoveryMode
+
+	// WatchBufferSize represents the number of events buffered for each watcher,
+	// a watcher is closed when its buffer is full. Default is DefaultWatchBufferSize.
+	WatchBufferSize int
+
+	// Compression represents the codec compressing the entry values on write,
+	// the values are decompressed transparently on read. Default is NoCompression.
+	// The codec is recorded per entry, so it can be changed between opens.
+	Compression Compression
+
+	// BucketCompression overrides Compression for the buckets in it.
+	BucketCompression map[string]Compression
+
+	// BucketEviction represents the eviction policies of the buckets in it, the keys of the
+	// B+ tree of such a bucket are evicted by the commits which would exceed its limits.
+	// It is not supported in HintBPTSparseIdxMode, Open returns ErrEvictionSparseIdxMode.
+	BucketEviction map[string]EvictionPolicy
+
+	// Comparators represents the orders of the keys of the B+ trees of the buckets in it, the
+	// other buckets are in bytewise order. The name of the comparator of a bucket is recorded in
+	// ComparatorBucket, Open returns ErrComparatorMismatch if it is opened with another comparator.
+	// The prefix scans assume that the keys with a common prefix are adjacent in the order.
+	// It is not supported in HintBPTSparseIdxMode.
+	Comparators map[string]Comparator
+
+	// TenantQuotas represents the quotas of the tenants in it, the puts which would exceed the quota
+	// of the tenant of their bucket return ErrTenantQuota. The buckets of a tenant are the bucket named
+	// after it and its nested buckets, see BucketSeparator. It is ignored in HintBPTSparseIdxMode.
+	TenantQuotas map[string]TenantQuota
+
+	// Failpoints represents the failures injected in the writes and the syncs of the data files, for
+	// the tests of the recovery. Default is nil, it means no failure. It is ignored with a Backend.
+	Failpoints *Failpoints
+
+	// Encryption represents the params for encrypting the entries before they are written
+	// to the data files, default is nil, it means the encryption is disabled.
+	// Merge re-encrypts the live entries with the current key of the KeyProvider.
+	Encryption *EncryptionOptions
+
+	// Metrics represents the collector receiving the metrics of the transactions,
+	// default is nil. The counters are also available in Stats.
+	Metrics MetricsCollector
+
+	// Logger represents the logger of the opening, the recovery, the merges and the expirations,
+	// and of the errors of the background workers, e.g. a *slog.Logger. Default is nil,
+	// it means nothing is logged.
+	Logger Logger
 }
 
 var defaultSegmentSize int64 = 8 * 1024 * 1024
@@ -66,4 +275,15 @@ var DefaultOptions = Options{
 	RWMode:               FileIO,
 	SyncEnable:           true,
 	StartFileLoadingMode: MMap,
+	MaxOpenFiles:         256,
+	MergeDirtyRatio:      0.5,
+}
+
+// rebuildWorkers returns the number of the workers parsing the data files on open.
+func (opt *Options) rebuildWorkers() int {
+	if opt.RebuildWorkers > 0 {
+		return opt.RebuildWorkers
+	}
+
+	return runtime.GOMAXPROCS(0)
 }
@@ -0,0 +1,231 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"os"
+
+	"github.com/xujiajun/utils/strconv2"
+)
+
+var (
+	// ErrKeyTooLarge is returned when the key is larger than MaxKeySize.
+	ErrKeyTooLarge = errors.New("key size exceeds MaxKeySize")
+
+	// ErrValueTooLarge is returned when the value is larger than MaxValueSize.
+	ErrValueTooLarge = errors.New("value size exceeds MaxValueSize")
+
+	// ErrInvalidOverflowRef is returned when the entry of a value in an overflow file does not reference it.
+	ErrInvalidOverflowRef = errors.New("invalid reference to an overflow value")
+)
+
+// OverflowSuffix returns the suffix of the overflow files.
+const OverflowSuffix = ".overflow"
+
+// overflowRefSize is the value size of an entry whose value is in an overflow file: the data
+// file of the overflow file, the offset, the size and the crc of the value in it.
+const overflowRefSize = 24
+
+// overflowFile represents the overflow file of the active data file, the values written to it
+// are appended.
+type overflowFile struct {
+	fID int64
+	fd  *os.File
+	off int64
+}
+
+// overflowValue represents the stored key and value of an entry, compressed and encrypted,
+// the value is written to the overflow file of the data file of the entry when it is committed.
+type overflowValue struct {
+	key   []byte
+	value []byte
+}
+
+// checkSizes returns an error if the key or the value is larger than MaxKeySize or MaxValueSize.
+func (opt *Options) checkSizes(key, value []byte) error {
+	if opt.MaxKeySize > 0 && len(key) > opt.MaxKeySize {
+		return ErrKeyTooLarge
+	}
+
+	if opt.MaxValueSize > 0 && int64(len(value)) > opt.MaxValueSize {
+		return ErrValueTooLarge
+	}
+
+	return nil
+}
+
+// overflow checks if the stored value of the entry, encoded as data, is written to an overflow file.
+// If it is, it returns the stored key and value and the entry records the reference to the value instead.
+// The values larger than OverflowValueSize overflow, or the ones whose entry does not fit in a data file
+// with a commit record if it is 0.
+func (db *DB) overflow(entry *Entry, data []byte) *overflowValue {
+	size := int64(entry.Meta.valueSize)
+	if size <= overflowRefSize || db.opt.InMemory {
+		return nil
+	}
+
+	if threshold := db.opt.OverflowValueSize; threshold > 0 && size <= threshold ||
+		threshold <= 0 && entry.Size()+txCommitEntrySize <= db.opt.SegmentSize {
+		return nil
+	}
+
+	off := int64(DataEntryHeaderSize + entry.Meta.bucketSize)
+	ov := &overflowValue{
+		key:   data[off : off+int64(entry.Meta.keySize)],
+		value: data[off+int64(entry.Meta.keySize) : entry.Size()],
+	}
+
+	entry.Meta.overflow = 1
+	entry.Meta.valueSize = overflowRefSize
+
+	return ov
+}
+
+// writeOverflow appends the value of ov to the overflow file of the active data file and returns
+// the entry encoded with the reference to it. The value is synced unless the SyncPolicy is SyncNever.
+func (db *DB) writeOverflow(entry *Entry, ov *overflowValue) ([]byte, error) {
+	fID := db.ActiveFile.fileID
+	if db.overflowFile != nil && db.overflowFile.fID != fID {
+		if err := db.closeOverflowFile(); err != nil {
+			return nil, err
+		}
+	}
+
+	if db.overflowFile == nil {
+		fd, err := os.OpenFile(db.getOverflowPath(fID), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+
+		fi, err := fd.Stat()
+		if err != nil {
+			fd.Close()
+			return nil, err
+		}
+
+		db.overflowFile = &overflowFile{fID: fID, fd: fd, off: fi.Size()}
+	}
+
+	of := db.overflowFile
+	if _, err := of.fd.Write(ov.value); err != nil {
+		// the offset of the next value is unknown, the file is opened again.
+		_ = db.closeOverflowFile()
+		return nil, err
+	}
+
+	if db.opt.syncPolicy().mode != syncNever {
+		if err := of.fd.Sync(); err != nil {
+			return nil, err
+		}
+	}
+
+	ref := make([]byte, overflowRefSize)
+	binary.LittleEndian.PutUint64(ref[0:8], uint64(fID))
+	binary.LittleEndian.PutUint64(ref[8:16], uint64(of.off))
+	binary.LittleEndian.PutUint32(ref[16:20], uint32(len(ov.value)))
+	binary.LittleEndian.PutUint32(ref[20:24], crc32.ChecksumIEEE(ov.value))
+
+	of.off += int64(len(ov.value))
+
+	return (&Entry{Key: ov.key, Value: ref, Meta: entry.Meta}).Encode(), nil
+}
+
+// readOverflow returns the stored value referenced by ref, ErrCrc if it is corrupted.
+func (db *DB) readOverflow(ref []byte) ([]byte, error) {
+	if len(ref) != overflowRefSize {
+		return nil, ErrInvalidOverflowRef
+	}
+
+	fID := int64(binary.LittleEndian.Uint64(ref[0:8]))
+	off := int64(binary.LittleEndian.Uint64(ref[8:16]))
+	value := make([]byte, binary.LittleEndian.Uint32(ref[16:20]))
+
+	f, err := db.overflowCache.acquire(fID)
+	if err != nil {
+		return nil, err
+	}
+	defer db.overflowCache.release(fID, f)
+
+	if _, err := f.rwManager.ReadAt(value, off); err != nil {
+		return nil, err
+	}
+
+	if crc32.ChecksumIEEE(value) != binary.LittleEndian.Uint32(ref[20:24]) {
+		return nil, ErrCrc
+	}
+
+	return value, nil
+}
+
+// inlineOverflow replaces the reference of the entry read from a data file by its stored value.
+func (db *DB) inlineOverflow(e *Entry) error {
+	if e.Meta.overflow == 0 {
+		return nil
+	}
+
+	value, err := db.readOverflow(e.Value)
+	if err != nil {
+		return err
+	}
+
+	e.Value = value
+	e.Meta.overflow = 0
+	e.Meta.valueSize = uint32(len(value))
+
+	return nil
+}
+
+// closeOverflowFile closes the overflow file of the active data file if it is open.
+func (db *DB) closeOverflowFile() error {
+	if db.overflowFile == nil {
+		return nil
+	}
+
+	err := db.overflowFile.fd.Close()
+	db.overflowFile = nil
+
+	return err
+}
+
+// openOverflowFile opens the overflow file of the data file at given fID for reading, see overflowCache.
+func (db *DB) openOverflowFile(fID int64) (*DataFile, error) {
+	path := db.getOverflowPath(fID)
+
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DataFile{path: path, rwManager: &FileIORWManager{fd: fd}}, nil
+}
+
+// removeOverflowFile removes the overflow file of the data file at given fID if there is one.
+func (db *DB) removeOverflowFile(fID int64) error {
+	db.overflowCache.remove(fID)
+
+	if err := os.Remove(db.getOverflowPath(fID)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// getOverflowPath returns the path of the overflow file of the data file at given fID.
+func (db *DB) getOverflowPath(fID int64) string {
+	return db.opt.Dir + "/" + strconv2.Int64ToStr(fID) + OverflowSuffix
+}
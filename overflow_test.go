@@ -0,0 +1,256 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+// overflowFiles returns the names of the overflow files of the db.
+func overflowFiles(t *testing.T) (names []string) {
+	t.Helper()
+
+	files, err := ioutil.ReadDir(opt.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		if path.Ext(f.Name()) == OverflowSuffix {
+			names = append(names, f.Name())
+		}
+	}
+
+	return
+}
+
+func checkOverflowValue(t *testing.T, bucket string, key, want []byte) {
+	t.Helper()
+
+	if err := db.View(func(tx *Tx) error {
+		e, err := tx.Get(bucket, key)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(e.Value, want) {
+			t.Errorf("err value of %s, got %d bytes want %d", key, len(e.Value), len(want))
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDB_OverflowValues(t *testing.T) {
+	bucket := "bucket_overflow"
+
+	// a value of several data files.
+	big := make([]byte, 100*1024)
+	rand.Read(big)
+
+	for _, mode := range []EntryIdxMode{HintKeyValAndRAMIdxMode, HintKeyAndRAMIdxMode, HintBPTSparseIdxMode} {
+		InitOpt("/tmp/nutsdbtestoverflow", true)
+		opt.EntryIdxMode = mode
+		opt.SegmentSize = 8 * 1024
+		db, err = Open(opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := db.Update(func(tx *Tx) error {
+			if err := tx.Put(bucket, []byte("big"), big, Persistent); err != nil {
+				return err
+			}
+			return tx.Put(bucket, []byte("small"), []byte("val"), Persistent)
+		}); err != nil {
+			t.Fatalf("mode %d: %s", mode, err)
+		}
+
+		checkOverflowValue(t, bucket, []byte("big"), big)
+		checkOverflowValue(t, bucket, []byte("small"), []byte("val"))
+		if names := overflowFiles(t); len(names) != 1 {
+			t.Errorf("mode %d: err overflow files, got %v", mode, names)
+		}
+
+		// the overflow file is opened once for the reads of the values not kept in the index.
+		checkOverflowValue(t, bucket, []byte("big"), big)
+		if n := db.overflowCache.lru.Len(); mode != HintKeyValAndRAMIdxMode && n != 1 {
+			t.Errorf("mode %d: err open overflow files, got %d want 1", mode, n)
+		}
+
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+		db, err = Open(opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		checkOverflowValue(t, bucket, []byte("big"), big)
+		checkOverflowValue(t, bucket, []byte("small"), []byte("val"))
+
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDB_OverflowValueSize(t *testing.T) {
+	bucket := "bucket_overflow"
+	val := bytes.Repeat([]byte("v"), 100)
+
+	InitOpt("/tmp/nutsdbtestoverflow", true)
+	opt.OverflowValueSize = 64
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Update(func(tx *Tx) error {
+		if err := tx.Put(bucket, []byte("key"), val, Persistent); err != nil {
+			return err
+		}
+		return tx.RPush("bucket_list", []byte("list"), val)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the merge rewrites the value to the overflow file of the new data file.
+	if err := db.Update(func(tx *Tx) error {
+		return tx.Put(bucket, []byte("other"), []byte("val"), Persistent)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	before := overflowFiles(t)
+	if len(before) != 1 {
+		t.Fatalf("err overflow files, got %v", before)
+	}
+	if err := db.sealActiveFile(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	if after := overflowFiles(t); len(after) != 1 || after[0] == before[0] {
+		t.Errorf("err overflow files after merge, got %v before %v", after, before)
+	}
+	if _, ok := db.overflowCache.items[0]; ok {
+		t.Error("err the overflow file removed by the merge is still open")
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkOverflowValue(t, bucket, []byte("key"), val)
+	if err := db.View(func(tx *Tx) error {
+		items, err := tx.LRange("bucket_list", []byte("list"), 0, -1)
+		if err != nil {
+			return err
+		}
+		if len(items) != 1 || !bytes.Equal(items[0], val) {
+			t.Errorf("err list item, got %q", items)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a corrupted overflow value is detected by its crc.
+	InitOpt("/tmp/nutsdbtestoverflow", true)
+	opt.EntryIdxMode = HintKeyAndRAMIdxMode
+	opt.OverflowValueSize = 64
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Update(func(tx *Tx) error {
+		return tx.Put(bucket, []byte("key"), val, Persistent)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	overflowPath := opt.Dir + "/" + overflowFiles(t)[0]
+	data, err := ioutil.ReadFile(overflowPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[0] ^= 0xff
+	if err := ioutil.WriteFile(overflowPath, data, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.View(func(tx *Tx) error {
+		_, err := tx.Get(bucket, []byte("key"))
+		return err
+	}); err == nil || !strings.Contains(err.Error(), ErrCrc.Error()) {
+		t.Errorf("err read of a corrupted overflow value, got %v want %v", err, ErrCrc)
+	}
+}
+
+func TestTx_SizeLimits(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestsizelimits", true)
+	opt.MaxKeySize = 4
+	opt.MaxValueSize = 8
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, c := range []struct {
+		key, value string
+		want       error
+	}{
+		{"key", "value", nil},
+		{"key_5", "value", ErrKeyTooLarge},
+		{"key", "value_009", ErrValueTooLarge},
+	} {
+		err := db.Update(func(tx *Tx) error {
+			return tx.Put("bucket", []byte(c.key), []byte(c.value), Persistent)
+		})
+		if err != c.want {
+			t.Errorf("err put %s=%s, got %v want %v", c.key, c.value, err, c.want)
+		}
+	}
+
+	if err := db.Update(func(tx *Tx) error {
+		return tx.SAdd("bucket_set", []byte("set"), []byte("member_09"))
+	}); err != ErrValueTooLarge {
+		t.Errorf("err SAdd, got %v want %v", err, ErrValueTooLarge)
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"errors"
+	"os"
+)
+
+var (
+	// ErrDBOpenedReadOnly is returned by Merge while other processes have the db opened read-only,
+	// they read the data files it would remove.
+	ErrDBOpenedReadOnly = errors.New("db is opened read-only by other processes")
+
+	// errFileLocked is returned when a lock file is locked by another open file.
+	errFileLocked = errors.New("file is locked")
+)
+
+// readersLockFile is the name of the lock file of the db opened read-only: the processes which
+// open it read-only hold a shared lock on it, the merge of the writer locks it exclusively.
+const readersLockFile = "READERS"
+
+// getReadersLockPath returns the path of the lock file of the readers.
+func (db *DB) getReadersLockPath() string {
+	return db.opt.Dir + "/" + readersLockFile
+}
+
+// lockReaders holds the shared lock of the readers until the db is closed,
+// it returns ErrIsMerging if a merge holds the lock exclusively.
+func (db *DB) lockReaders() error {
+	f, err := os.OpenFile(db.getReadersLockPath(), os.O_RDONLY, 0)
+	if os.IsNotExist(err) {
+		f, err = os.OpenFile(db.getReadersLockPath(), os.O_CREATE|os.O_RDONLY, 0644)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := lockFile(f, false); err != nil {
+		f.Close()
+		if err == errFileLocked {
+			return ErrIsMerging
+		}
+		return err
+	}
+
+	db.readersLock = f
+
+	return nil
+}
+
+// unlockReaders releases the shared lock of the readers if it is held.
+func (db *DB) unlockReaders() {
+	if db.readersLock != nil {
+		_ = unlockFile(db.readersLock)
+		db.readersLock.Close()
+		db.readersLock = nil
+	}
+}
+
+// lockMerge locks the lock file of the readers exclusively for the merge, so that no process
+// opens the db read-only while the data files are merged. It returns ErrDBOpenedReadOnly if
+// a process has it opened read-only, and no lock in memory.
+func (db *DB) lockMerge() (*os.File, error) {
+	if db.opt.InMemory {
+		return nil, nil
+	}
+
+	f, err := os.OpenFile(db.getReadersLockPath(), os.O_CREATE|os.O_RDONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := lockFile(f, true); err != nil {
+		f.Close()
+		if err == errFileLocked {
+			return nil, ErrDBOpenedReadOnly
+		}
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// unlockMerge releases the lock of the merge, if any.
+func unlockMerge(f *os.File) {
+	if f == nil {
+		return
+	}
+
+	_ = unlockFile(f)
+	f.Close()
+}
+
+// openDataFile opens the data file at given path with the Backend, else with the rwMode and the
+// Failpoints, or for reading only if the db is opened read-only, so that the data files of the
+// writer are not changed.
+func (db *DB) openDataFile(path string, rwMode RWMode) (*DataFile, error) {
+	if db.opt.Backend != nil {
+		rwManager, err := db.opt.Backend.Open(path, db.opt.SegmentSize)
+		if err != nil {
+			return nil, err
+		}
+		return &DataFile{path: path, capacity: db.opt.SegmentSize, rwManager: rwManager}, nil
+	}
+
+	if !db.readOnly {
+		df, err := NewDataFile(path, db.opt.SegmentSize, rwMode)
+		if err != nil || db.opt.Failpoints == nil {
+			return df, err
+		}
+		df.rwManager = db.opt.Failpoints.wrap(path, df.rwManager)
+		return df, nil
+	}
+
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DataFile{path: path, capacity: db.opt.SegmentSize, rwManager: &FileIORWManager{fd: fd}}, nil
+}
@@ -0,0 +1,102 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestDB_ReadOnly(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestreadonly", true)
+	opt.SegmentSize = 1024
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 50; i++ {
+		if err := db.Update(func(tx *Tx) error {
+			return tx.Put("bucket", []byte(fmt.Sprintf("key_%d", i)), []byte(fmt.Sprintf("key_%d", i)), Persistent)
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	readOpt := opt
+	readOpt.ReadOnly = true
+	reader, err := Open(readOpt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := reader.View(func(tx *Tx) error {
+		for i := 0; i < 50; i++ {
+			e, err := tx.Get("bucket", []byte(fmt.Sprintf("key_%d", i)))
+			if err != nil {
+				return err
+			}
+			if string(e.Value) != string([]byte(fmt.Sprintf("key_%d", i))) {
+				t.Errorf("err Get, got %s want %s", e.Value, []byte(fmt.Sprintf("key_%d", i)))
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := reader.Update(func(tx *Tx) error {
+		return tx.Put("bucket", []byte("key"), []byte("val"), Persistent)
+	}); err != ErrDBReadOnly {
+		t.Errorf("err Update, got %v want %v", err, ErrDBReadOnly)
+	}
+
+	// another reader opens the db while the first one is open.
+	other, err := Open(readOpt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the writer does not remove the data files the reader reads.
+	if err := db.Merge(); err != ErrDBOpenedReadOnly {
+		t.Errorf("err Merge, got %v want %v", err, ErrDBOpenedReadOnly)
+	}
+
+	if err := reader.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDB_ReadOnly_DirNotExist(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestreadonly", true)
+	opt.Dir = "/tmp/nutsdbtestreadonly/missing"
+	opt.ReadOnly = true
+
+	if _, err := Open(opt); err == nil {
+		t.Error("err Open, got nil want the error of the missing dir")
+	}
+	if _, err := os.Stat(opt.Dir); !os.IsNotExist(err) {
+		t.Errorf("err Open, the dir %s is created", opt.Dir)
+	}
+}
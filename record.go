@@ -18,8 +18,10 @@ import "time"
 
 // Record records entry and hint.
 type Record struct {
-	H *Hint
-	E *Entry
+	H       *Hint
+	E       *Entry
+	version uint64  // the commit sequence of the tx writing this version
+	prev    *Record // the older version kept for the snapshot txs
 }
 
 // IsExpired returns the record if expired or not.
@@ -37,6 +39,16 @@ func IsExpired(ttl uint32, timestamp uint64) bool {
 	return true
 }
 
+// visible returns the newest version of the record committed at or before the commit sequence seq,
+// or nil if the key did not exist then.
+func (r *Record) visible(seq uint64) *Record {
+	for r != nil && r.version > seq {
+		r = r.prev
+	}
+
+	return r
+}
+
 // UpdateRecord updates the record.
 func (r *Record) UpdateRecord(h *Hint, e *Entry) error {
 	r.E = e
@@ -0,0 +1,71 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// RecoveryMode represents how much of the data Open checks, it trades the startup time for the safety.
+type RecoveryMode int
+
+const (
+	// RecoveryChecksum checks the crc of all the entries of the active data file, where the last
+	// writes before a crash are, and of the entries parsed after the checkpoint.
+	RecoveryChecksum RecoveryMode = iota
+
+	// RecoveryFast trusts the checkpoint and the b+ tree index files: the entries of the active
+	// data file covered by the checkpoint are only walked through by their headers, the entries
+	// parsed after the checkpoint are still checked.
+	RecoveryFast
+
+	// RecoveryFull also checks the crc of the entries of all the data files, and in HintKeyValAndRAMIdxMode
+	// and HintKeyAndRAMIdxMode that the records of the index point at their entries, as Verify.
+	RecoveryFull
+)
+
+// ErrRecoveryCheck is returned by Open when the checks of RecoveryFull find a corrupted entry
+// or a dangling record, Verify and Repair report the details.
+var ErrRecoveryCheck = errors.New("the recovery check found a corruption")
+
+// checkRecovery checks the data files and the index built on open with RecoveryFull.
+func (db *DB) checkRecovery() error {
+	if db.opt.RecoveryMode != RecoveryFull || db.opt.InMemory {
+		return nil
+	}
+
+	start := time.Now()
+
+	report, err := db.verify()
+	if err != nil {
+		return err
+	}
+
+	if len(report.Corruptions) > 0 {
+		c := report.Corruptions[0]
+		return fmt.Errorf("%w: data file %d at offset %d: %v", ErrRecoveryCheck, c.FileID, c.Offset, c.Err)
+	}
+
+	if len(report.DanglingRecords) > 0 {
+		r := report.DanglingRecords[0]
+		return fmt.Errorf("%w: record of key %s in bucket %s: %v", ErrRecoveryCheck, r.Key, r.Bucket, r.Err)
+	}
+
+	db.logger().Info("checked the data files", "files", report.DataFiles, "entries", report.Entries, "took", time.Since(start))
+
+	return nil
+}
@@ -0,0 +1,120 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+// flipLastByte flips the last byte of the entry of the record in the data file at given path,
+// as a corruption of its value.
+func flipLastByte(t *testing.T, path string, r *Record) {
+	t.Helper()
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	off := int64(r.H.dataPos) + r.E.Size() - 1
+	b := make([]byte, 1)
+	if _, err := f.ReadAt(b, off); err != nil {
+		t.Fatal(err)
+	}
+	b[0] ^= 0xff
+	if _, err := f.WriteAt(b, off); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDB_RecoveryMode(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestrecovery", true)
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bucket := "bucket"
+	for i := 0; i < 300; i++ {
+		if err := db.Update(func(tx *Tx) error {
+			return tx.Put(bucket, []byte(fmt.Sprintf("key_%03d", i)), []byte(fmt.Sprintf("val_%03d", i)), Persistent)
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the checkpoint covers all the entries, RecoveryFast parses none of them.
+	if err := db.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := db.BPTreeIdx[bucket].Find([]byte("key_000"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	last, err := db.BPTreeIdx[bucket].Find([]byte("key_299"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.H.fileID == db.MaxFileID || last.H.fileID != db.MaxFileID {
+		t.Fatalf("err data files, got key_000 in %d and key_299 in %d", first.H.fileID, last.H.fileID)
+	}
+
+	firstPath, lastPath := db.getDataPath(first.H.fileID), db.getDataPath(last.H.fileID)
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(mode RecoveryMode, wantErr bool) {
+		t.Helper()
+
+		opt.RecoveryMode = mode
+		db, err = Open(opt)
+		if wantErr {
+			if err == nil {
+				db.Close()
+				t.Errorf("mode %d: err Open, got nil want an error", mode)
+			} else if mode == RecoveryFull && !errors.Is(err, ErrRecoveryCheck) {
+				t.Errorf("mode %d: err Open, got %v want %v", mode, err, ErrRecoveryCheck)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("mode %d: err Open, got %v", mode, err)
+		}
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, mode := range []RecoveryMode{RecoveryFast, RecoveryChecksum, RecoveryFull} {
+		check(mode, false)
+	}
+
+	// an old data file is only checked by RecoveryFull.
+	flipLastByte(t, firstPath, first)
+	check(RecoveryFast, false)
+	check(RecoveryChecksum, false)
+	check(RecoveryFull, true)
+
+	// the active data file is checked by RecoveryChecksum, RecoveryFast trusts the checkpoint.
+	flipLastByte(t, lastPath, last)
+	check(RecoveryFast, false)
+	check(RecoveryChecksum, true)
+}
@@ -0,0 +1,478 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
+	"os"
+	"time"
+)
+
+var (
+	// ErrReplicationGap is returned when the position of a follower is not found in the data
+	// files of the primary, e.g. when they are merged before the follower replicates them.
+	// The follower must be seeded again from a backup of the primary.
+	ErrReplicationGap = errors.New("replication position not found in the data files of the primary")
+
+	// ErrReplicationProtocol is returned when the primary or the follower does not speak the
+	// replication protocol.
+	ErrReplicationProtocol = errors.New("invalid replication protocol")
+)
+
+// ReplicationBucket is the bucket of a follower recording the position of the primary it has
+// replicated up to, it is written with each replicated tx.
+const ReplicationBucket = "_nutsdb_replication"
+
+var replicationPosKey = []byte("pos")
+
+// replicationMagic starts the connections of the followers, the last byte is the version.
+var replicationMagic = []byte("NUTSREPL\x01")
+
+// the kinds of the frames sent by the primary.
+const (
+	replicationTx byte = iota + 1
+	replicationGap
+)
+
+// ReplicationPos represents a position in the committed txs of a primary,
+// the data file and the offset in it after the last replicated tx.
+type ReplicationPos struct {
+	FileID int64
+	Offset int64
+}
+
+// notifyCommit wakes up the replication streams and the blocking pops, with the db locked after a commit.
+func (db *DB) notifyCommit() {
+	close(db.commitCh)
+	db.commitCh = make(chan struct{})
+}
+
+// ServeReplication accepts the followers on l and streams them the committed txs of the db
+// from their position, as they are committed. It returns when l is closed, the streams are
+// stopped when the db is closed.
+func (db *DB) ServeReplication(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+
+		go db.serveFollower(conn)
+	}
+}
+
+// serveFollower streams the committed txs to the follower of conn.
+func (db *DB) serveFollower(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	pos, err := readReplicationHandshake(r)
+	if err != nil {
+		return
+	}
+
+	// the follower never writes after the handshake, a read returns when it is gone.
+	stop := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(ioutil.Discard, r)
+		close(stop)
+	}()
+
+	w := bufio.NewWriter(conn)
+	err = db.streamTxs(pos, stop, func(entries []streamedEntry, pos ReplicationPos) error {
+		encoded := make([][]byte, len(entries))
+		for i, e := range entries {
+			if err := db.inlineOverflow(e.entry); err != nil {
+				return err
+			}
+			encoded[i] = e.entry.Encode()
+		}
+		if err := writeReplicationFrame(w, replicationTx, encoded, pos); err != nil {
+			return err
+		}
+		return w.Flush()
+	})
+
+	if err == ErrReplicationGap {
+		if writeReplicationFrame(w, replicationGap, nil, pos) == nil {
+			_ = w.Flush()
+		}
+	}
+}
+
+// streamedEntry represents an entry of a committed tx read by streamTxs, as it is written
+// at its position in the data files, a tx may go on in the next data file.
+type streamedEntry struct {
+	pos   ReplicationPos
+	entry *Entry
+}
+
+// openReplicatedFile opens the data file at given fID for reading, it returns ErrReplicationGap if
+// it is removed by a merge.
+func (db *DB) openReplicatedFile(fID int64) (*DataFile, error) {
+	path := db.getDataPath(fID)
+
+	if db.opt.Backend != nil {
+		if !db.dataFileExists(path) {
+			return nil, ErrReplicationGap
+		}
+		return db.openDataFile(path, FileIO)
+	}
+
+	fd, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, ErrReplicationGap
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &DataFile{path: path, capacity: db.opt.SegmentSize, rwManager: &FileIORWManager{fd: fd}}, nil
+}
+
+// streamTxs calls send with the entries of each committed tx from pos, and the position
+// after it, in the order they are committed. It waits for the next commits at the end of the
+// active file, until stop is closed or the db is closed. The entries rewritten by the merge are
+// skipped, send is called with no entries for the txs of the merge to move the position.
+func (db *DB) streamTxs(pos ReplicationPos, stop <-chan struct{}, send func(entries []streamedEntry, pos ReplicationPos) error) error {
+	var (
+		f       *DataFile
+		pending []streamedEntry // the entries of the tx read so far
+		read    int             // the entries of the tx read so far, the merged ones included
+		txID    uint64
+		commit  txCommit // the entries of the tx in the data file
+	)
+
+	defer func() {
+		if f != nil {
+			f.rwManager.Close()
+		}
+	}()
+
+	off, startFID := pos.Offset, pos.FileID
+
+	for {
+		db.mu.RLock()
+		if db.closed {
+			db.mu.RUnlock()
+			return ErrDBClosed
+		}
+		maxFileID, end, committed := db.MaxFileID, int64(math.MaxInt64), db.commitCh
+		if pos.FileID == maxFileID {
+			end = db.ActiveFile.writeOff
+		}
+		db.mu.RUnlock()
+
+		if pos.FileID > maxFileID || off > end {
+			return ErrReplicationGap
+		}
+
+		if f == nil {
+			var err error
+			if f, err = db.openReplicatedFile(pos.FileID); err != nil {
+				return err
+			}
+		}
+
+		for off < end && off < db.opt.SegmentSize {
+			entry, err := f.ReadAt(int(off))
+			if err == io.EOF || err == nil && entry == nil {
+				break
+			}
+			if err != nil {
+				return err
+			}
+
+			entryOff := off
+			off += entry.Size()
+
+			if isTxCommitEntry(entry) {
+				if entry.Meta.txID == txID && commit.matches(entry) && txCommitComplete(entry, read, startFID) {
+					if err := send(pending, ReplicationPos{FileID: pos.FileID, Offset: off}); err != nil {
+						return err
+					}
+				}
+				pending, read, txID, commit = nil, 0, 0, txCommit{}
+				continue
+			}
+
+			// the entries of a tx which is not committed are followed by the ones of the next tx.
+			if entry.Meta.txID != txID {
+				pending, read, txID, commit = nil, 0, entry.Meta.txID, txCommit{}
+			}
+
+			// the entries rewritten by the merge are in the followers already.
+			if entry.Meta.merged == 0 {
+				pending = append(pending, streamedEntry{pos: ReplicationPos{FileID: pos.FileID, Offset: entryOff}, entry: entry})
+			}
+			commit.addEntry(entry)
+			read++
+
+			if entry.Meta.status == Committed {
+				if err := send(pending, ReplicationPos{FileID: pos.FileID, Offset: off}); err != nil {
+					return err
+				}
+				pending, read, txID, commit = nil, 0, 0, txCommit{}
+			}
+		}
+
+		if pos.FileID < maxFileID {
+			// the data file is full, a tx may go on in the next one.
+			f.rwManager.Close()
+			f, commit = nil, txCommit{}
+			pos, off = ReplicationPos{FileID: pos.FileID + 1}, 0
+
+			if len(pending) == 0 {
+				if err := send(nil, pos); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		pos.Offset = off
+
+		select {
+		case <-committed:
+		case <-stop:
+			return nil
+		case <-db.closeCh:
+			return ErrDBClosed
+		}
+	}
+}
+
+// Follow connects to the primary at addr serving the replication and applies its committed txs
+// to the db, from the position recorded in ReplicationBucket, or the end of the data files of
+// the db if there is none, e.g. when the db is empty or a backup of the primary. It returns
+// when the connection fails or the db is closed, and can be called again to go on.
+// The db must not be written by the other txs.
+func (db *DB) Follow(addr string) error {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-db.closeCh:
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	pos, err := db.ReplicationPosition()
+	if err != nil {
+		return err
+	}
+
+	handshake := append(append([]byte{}, replicationMagic...), appendUvarint(appendUvarint(nil, uint64(pos.FileID)), uint64(pos.Offset))...)
+	if _, err := conn.Write(handshake); err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(conn)
+	for {
+		kind, entries, pos, err := db.readReplicationFrame(r)
+		if err != nil {
+			select {
+			case <-db.closeCh:
+				return ErrDBClosed
+			default:
+				return err
+			}
+		}
+
+		if kind == replicationGap {
+			return ErrReplicationGap
+		}
+
+		if err := db.applyReplicatedTx(entries, pos); err != nil {
+			return err
+		}
+	}
+}
+
+// ReplicationPosition returns the position of the primary the db has replicated up to.
+func (db *DB) ReplicationPosition() (pos ReplicationPos, err error) {
+	err = db.View(func(tx *Tx) error {
+		e, err := tx.Get(ReplicationBucket, replicationPosKey)
+		if err != nil {
+			// the db has not replicated yet, its data files are the ones of the primary.
+			pos = ReplicationPos{FileID: tx.db.MaxFileID, Offset: tx.db.ActiveFile.writeOff}
+			return nil
+		}
+
+		fID, n := binary.Uvarint(e.Value)
+		if n <= 0 {
+			return ErrReplicationProtocol
+		}
+
+		off, m := binary.Uvarint(e.Value[n:])
+		if m <= 0 {
+			return ErrReplicationProtocol
+		}
+
+		pos = ReplicationPos{FileID: int64(fID), Offset: int64(off)}
+
+		return nil
+	})
+
+	return
+}
+
+// applyReplicatedTx writes the entries of a tx of the primary and the position after it, in a tx.
+func (db *DB) applyReplicatedTx(entries []*Entry, pos ReplicationPos) error {
+	return db.Update(func(tx *Tx) error {
+		for _, e := range entries {
+			// the primary may be the follower of another primary.
+			if string(e.Meta.bucket) == ReplicationBucket {
+				continue
+			}
+
+			if err := tx.put(string(e.Meta.bucket), e.Key, e.Value, e.Meta.TTL, e.Meta.Flag, e.Meta.timestamp, e.Meta.ds); err != nil {
+				return err
+			}
+		}
+
+		value := appendUvarint(appendUvarint(nil, uint64(pos.FileID)), uint64(pos.Offset))
+
+		return tx.put(ReplicationBucket, replicationPosKey, value, Persistent, DataSetFlag,
+			uint64(time.Now().Unix()), DataStructureBPTree)
+	})
+}
+
+// readReplicationHandshake reads the position the follower starts from.
+func readReplicationHandshake(r *bufio.Reader) (pos ReplicationPos, err error) {
+	magic := make([]byte, len(replicationMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return pos, err
+	}
+	if !bytes.Equal(magic, replicationMagic) {
+		return pos, ErrReplicationProtocol
+	}
+
+	fID, err := binary.ReadUvarint(r)
+	if err != nil {
+		return pos, err
+	}
+
+	off, err := binary.ReadUvarint(r)
+	if err != nil {
+		return pos, err
+	}
+
+	return ReplicationPos{FileID: int64(fID), Offset: int64(off)}, nil
+}
+
+// writeReplicationFrame writes a frame of the primary:
+//
+//	| kind | file id | offset | entry count | entry size | entry | ... |
+//	| byte | uvarint | uvarint|   uvarint   |  uvarint   |[]byte |     |
+//
+// the entries are encoded as in the data files.
+func writeReplicationFrame(w io.Writer, kind byte, entries [][]byte, pos ReplicationPos) error {
+	buf := []byte{kind}
+	buf = appendUvarint(buf, uint64(pos.FileID))
+	buf = appendUvarint(buf, uint64(pos.Offset))
+	buf = appendUvarint(buf, uint64(len(entries)))
+	for _, e := range entries {
+		buf = appendDumpBytes(buf, e)
+	}
+
+	_, err := w.Write(buf)
+
+	return err
+}
+
+// readReplicationFrame reads a frame of the primary, its entries are decoded as when they are
+// read from the data files.
+func (db *DB) readReplicationFrame(r *bufio.Reader) (kind byte, entries []*Entry, pos ReplicationPos, err error) {
+	dr := &dumpReader{r: r}
+
+	if kind, err = dr.ReadByte(); err != nil {
+		return
+	}
+
+	var header [3]uint64
+	for i := range header {
+		if header[i], err = binary.ReadUvarint(dr); err != nil {
+			return
+		}
+	}
+	pos = ReplicationPos{FileID: int64(header[0]), Offset: int64(header[1])}
+
+	for i := uint64(0); i < header[2]; i++ {
+		dr.buf = dr.buf[:0]
+
+		data, err := dr.readBytes()
+		if err != nil {
+			return 0, nil, pos, ErrReplicationProtocol
+		}
+
+		e, err := decodeEncodedEntry(data)
+		if err != nil {
+			return 0, nil, pos, err
+		}
+
+		if err := db.decodeEntry(e); err != nil {
+			return 0, nil, pos, err
+		}
+
+		entries = append(entries, e)
+	}
+
+	return
+}
+
+// decodeEncodedEntry returns the entry encoded as in the data files, its crc is checked.
+func decodeEncodedEntry(data []byte) (*Entry, error) {
+	if len(data) < DataEntryHeaderSize {
+		return nil, ErrReplicationProtocol
+	}
+
+	e := &Entry{
+		crc:  binary.LittleEndian.Uint32(data[0:4]),
+		Meta: readMetaData(data),
+	}
+
+	if int64(len(data)) != e.Size() {
+		return nil, ErrReplicationProtocol
+	}
+
+	off := DataEntryHeaderSize
+	e.Meta.bucket = data[off : off+int(e.Meta.bucketSize)]
+	off += int(e.Meta.bucketSize)
+	e.Key = data[off : off+int(e.Meta.keySize)]
+	off += int(e.Meta.keySize)
+	e.Value = data[off:]
+
+	if e.GetCrc(data[:DataEntryHeaderSize]) != e.crc {
+		return nil, ErrCrc
+	}
+
+	return e, nil
+}
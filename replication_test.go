@@ -0,0 +1,165 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func writeForReplication(t *testing.T, db *DB, from, to int) {
+	if err := db.Update(func(tx *Tx) error {
+		for i := from; i < to; i++ {
+			key := []byte(fmt.Sprintf("key_%03d", i))
+			if err := tx.Put("bucket", key, []byte(fmt.Sprintf("val_%03d", i)), Persistent); err != nil {
+				return err
+			}
+		}
+		return tx.RPush("list", []byte("key"), []byte(fmt.Sprintf("item_%03d", from)))
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitForReplication waits for the follower to replicate all the committed txs of the primary.
+func waitForReplication(t *testing.T, primary, follower *DB) {
+	primary.mu.RLock()
+	want := ReplicationPos{FileID: primary.MaxFileID, Offset: primary.ActiveFile.writeOff}
+	primary.mu.RUnlock()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		pos, err := follower.ReplicationPosition()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pos == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("err Follow, got position %v want %v", pos, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// checkReplicated checks that the follower has the same data as the primary.
+func checkReplicated(t *testing.T, primary, follower *DB) {
+	read := func(db *DB) (kv Entries, items [][]byte) {
+		if err := db.View(func(tx *Tx) error {
+			var err error
+			if kv, err = tx.GetAll("bucket"); err != nil {
+				return err
+			}
+			items, err = tx.LRange("list", []byte("key"), 0, -1)
+			return err
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	wantKV, wantItems := read(primary)
+	gotKV, gotItems := read(follower)
+
+	if len(gotKV) != len(wantKV) {
+		t.Fatalf("err Follow, got %d keys want %d", len(gotKV), len(wantKV))
+	}
+	for i := range wantKV {
+		if !bytes.Equal(gotKV[i].Key, wantKV[i].Key) || !bytes.Equal(gotKV[i].Value, wantKV[i].Value) {
+			t.Fatalf("err Follow, got %s=%s want %s=%s", gotKV[i].Key, gotKV[i].Value, wantKV[i].Key, wantKV[i].Value)
+		}
+	}
+
+	if len(gotItems) != len(wantItems) {
+		t.Fatalf("err Follow, got %d list items want %d", len(gotItems), len(wantItems))
+	}
+}
+
+func TestDB_Replication(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestprimary", true)
+	primary, err := Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer primary.Close()
+
+	InitOpt("/tmp/nutsdbtestfollower", true)
+	follower, err := Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the txs before the follower connects are caught up, one of them goes on in the next data file.
+	writeForReplication(t, primary, 0, 50)
+	writeForReplication(t, primary, 50, 200)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go primary.ServeReplication(l)
+
+	followErr := make(chan error, 1)
+	go func() {
+		followErr <- follower.Follow(l.Addr().String())
+	}()
+
+	waitForReplication(t, primary, follower)
+	checkReplicated(t, primary, follower)
+
+	// the txs are streamed as they are committed.
+	for i := 200; i < 300; i += 10 {
+		writeForReplication(t, primary, i, i+10)
+	}
+	if err := primary.Update(func(tx *Tx) error {
+		return tx.Delete("bucket", []byte("key_000"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	waitForReplication(t, primary, follower)
+	checkReplicated(t, primary, follower)
+
+	// the txs of the merge are not applied again.
+	if err := primary.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	writeForReplication(t, primary, 300, 310)
+
+	waitForReplication(t, primary, follower)
+	checkReplicated(t, primary, follower)
+
+	follower.Close()
+	if err := <-followErr; err != ErrDBClosed {
+		t.Errorf("err Follow, got %v want %v", err, ErrDBClosed)
+	}
+
+	// a new follower can not catch up from the merged data files.
+	InitOpt("/tmp/nutsdbtestfollower", true)
+	follower, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer follower.Close()
+
+	if err := follower.Follow(l.Addr().String()); err != ErrReplicationGap {
+		t.Errorf("err Follow, got %v want %v", err, ErrReplicationGap)
+	}
+}
@@ -17,13 +17,23 @@ package nutsdb
 import (
 	"errors"
 	"os"
+	"sync"
 
 	mmap "github.com/xujiajun/mmap-go"
 )
 
-// MMapRWManager represents the RWManager which using mmap.
+// MMapRWManager represents the RWManager which using mmap. The file is mapped in chunks of
+// mmapChunkSize bytes when they are first read or written, so that the large segments do not
+// need a contiguous region of the address space, which a 32-bit platform may not have. At most
+// mmapMaxChunks chunks are mapped at a time if it is above 0, the least recently mapped one is
+// flushed and unmapped first.
 type MMapRWManager struct {
-	m mmap.MMap
+	mu     sync.RWMutex
+	fd     *os.File
+	size   int64
+	chunks map[int64]mmap.MMap // the mapped chunks by their index
+	order  []int64             // the indexes of the mapped chunks, the least recently mapped first
+	closed bool
 }
 
 var (
@@ -34,58 +44,232 @@ var (
 	ErrIndexOutOfBound = errors.New("offset out of mapped region")
 )
 
+// is32Bit is true on the platforms with a 32-bit address space.
+const is32Bit = ^uint(0)>>32 == 0
+
+// mmapChunkSize is the size of the chunks of the files mapped at a time, a multiple of the
+// allocation granularity of windows so that the offsets of the chunks can be mapped everywhere.
+var mmapChunkSize int64 = 1 << 30
+
+// mmapMaxChunks is the max number of the chunks of a file mapped at a time, 0 means no limit.
+var mmapMaxChunks = 0
+
+func init() {
+	if is32Bit {
+		mmapChunkSize = 16 << 20
+		mmapMaxChunks = 2
+	}
+}
+
 // NewMMapRWManager returns a newly initialized MMapRWManager.
 func NewMMapRWManager(path string, capacity int64) (*MMapRWManager, error) {
 	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
-	defer f.Close()
-
 	if err != nil {
 		return nil, err
 	}
 
 	err = Truncate(path, capacity, f)
 	if err != nil {
+		f.Close()
 		return nil, err
 	}
 
-	m, err := mmap.Map(f, mmap.RDWR, 0)
+	fileInfo, err := f.Stat()
 	if err != nil {
+		f.Close()
 		return nil, err
 	}
 
-	return &MMapRWManager{m: m}, nil
+	return &MMapRWManager{fd: f, size: fileInfo.Size(), chunks: make(map[int64]mmap.MMap)}, nil
 }
 
 // WriteAt copies data to mapped region from the b slice starting at
 // given off and returns number of bytes copied to the mapped region.
 func (mm *MMapRWManager) WriteAt(b []byte, off int64) (n int, err error) {
-	if mm.m == nil {
-		return 0, ErrUnmappedMemory
-	} else if off >= int64(len(mm.m)) || off < 0 {
-		return 0, ErrIndexOutOfBound
-	}
-
-	return copy(mm.m[off:], b), nil
+	return mm.copyAt(b, off, true)
 }
 
 // ReadAt copies data to b slice from mapped region starting at
 // given off and returns number of bytes copied to the b slice.
 func (mm *MMapRWManager) ReadAt(b []byte, off int64) (n int, err error) {
-	if mm.m == nil {
-		return 0, ErrUnmappedMemory
-	} else if off >= int64(len(mm.m)) || off < 0 {
+	return mm.copyAt(b, off, false)
+}
+
+// copyAt copies b to the region at given off when write, else the region to b, across the chunks.
+func (mm *MMapRWManager) copyAt(b []byte, off int64, write bool) (n int, err error) {
+	// the empty value of an entry ending the region is read at its end.
+	if len(b) == 0 && off == mm.size {
+		return 0, nil
+	}
+
+	if off >= mm.size || off < 0 {
 		return 0, ErrIndexOutOfBound
 	}
 
-	return copy(b, mm.m[off:]), nil
+	end := off + int64(len(b))
+	if end > mm.size {
+		end = mm.size
+	}
+
+	// the chunks already mapped are copied under the read lock, so that the reads run concurrently.
+	mm.mu.RLock()
+	if mm.closed {
+		mm.mu.RUnlock()
+		return 0, ErrUnmappedMemory
+	}
+	if mm.mapped(off, end) {
+		n = mm.copyChunks(b, off, end, write)
+		mm.mu.RUnlock()
+		return n, nil
+	}
+	mm.mu.RUnlock()
+
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	if mm.closed {
+		return 0, ErrUnmappedMemory
+	}
+
+	for pos := off; pos < end; {
+		chunkEnd := (pos/mmapChunkSize + 1) * mmapChunkSize
+		if chunkEnd > end {
+			chunkEnd = end
+		}
+
+		if _, err := mm.chunk(pos / mmapChunkSize); err != nil {
+			return n, err
+		}
+		n += mm.copyChunks(b[pos-off:], pos, chunkEnd, write)
+		pos = chunkEnd
+	}
+
+	return n, nil
+}
+
+// mapped returns if the chunks of the region from off to end are mapped.
+func (mm *MMapRWManager) mapped(off, end int64) bool {
+	for i := off / mmapChunkSize; i <= (end-1)/mmapChunkSize; i++ {
+		if _, ok := mm.chunks[i]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// copyChunks copies between b and the region from off to end of the mapped chunks.
+func (mm *MMapRWManager) copyChunks(b []byte, off, end int64, write bool) (n int) {
+	for pos := off; pos < end; {
+		m := mm.chunks[pos/mmapChunkSize]
+		start := pos % mmapChunkSize
+		stop := int64(len(m))
+		if rest := end - pos + start; rest < stop {
+			stop = rest
+		}
+
+		var c int
+		if write {
+			c = copy(m[start:stop], b[n:])
+		} else {
+			c = copy(b[n:], m[start:stop])
+		}
+
+		n += c
+		pos += int64(c)
+	}
+
+	return n
+}
+
+// chunk returns the chunk at given index, mapping it if needed, the lock is held.
+func (mm *MMapRWManager) chunk(i int64) (mmap.MMap, error) {
+	if m, ok := mm.chunks[i]; ok {
+		return m, nil
+	}
+
+	if mmapMaxChunks > 0 && len(mm.order) >= mmapMaxChunks {
+		if err := mm.unmapChunk(mm.order[0]); err != nil {
+			return nil, err
+		}
+	}
+
+	length := mm.size - i*mmapChunkSize
+	if length > mmapChunkSize {
+		length = mmapChunkSize
+	}
+
+	m, err := mmap.MapRegion(mm.fd, int(length), mmap.RDWR, 0, i*mmapChunkSize)
+	if err != nil {
+		return nil, err
+	}
+
+	mm.chunks[i] = m
+	mm.order = append(mm.order, i)
+
+	return m, nil
+}
+
+// unmapChunk flushes and unmaps the chunk at given index, the lock is held.
+func (mm *MMapRWManager) unmapChunk(i int64) error {
+	m := mm.chunks[i]
+	if err := m.Flush(); err != nil {
+		return err
+	}
+	if err := m.Unmap(); err != nil {
+		return err
+	}
+
+	delete(mm.chunks, i)
+	for j, idx := range mm.order {
+		if idx == i {
+			mm.order = append(mm.order[:j], mm.order[j+1:]...)
+			break
+		}
+	}
+
+	return nil
 }
 
 // Sync synchronizes the mapping's contents to the file's contents on disk.
 func (mm *MMapRWManager) Sync() (err error) {
-	return mm.m.Flush()
+	mm.mu.RLock()
+	defer mm.mu.RUnlock()
+
+	if mm.closed {
+		return ErrUnmappedMemory
+	}
+
+	for _, m := range mm.chunks {
+		if err := m.Flush(); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
-//Close deletes the memory mapped region, flushes any remaining changes
+// Close deletes the memory mapped region, flushes any remaining changes
 func (mm *MMapRWManager) Close() (err error) {
-	return mm.m.Unmap()
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	if mm.closed {
+		return ErrUnmappedMemory
+	}
+	mm.closed = true
+
+	for _, m := range mm.chunks {
+		if e := m.Unmap(); e != nil && err == nil {
+			err = e
+		}
+	}
+	mm.chunks = nil
+	mm.order = nil
+
+	if e := mm.fd.Close(); e != nil && err == nil {
+		err = e
+	}
+
+	return err
 }
@@ -0,0 +1,80 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestMMapRWManager_Chunks(t *testing.T) {
+	chunkSize, maxChunks := mmapChunkSize, mmapMaxChunks
+	defer func() {
+		mmapChunkSize, mmapMaxChunks = chunkSize, maxChunks
+	}()
+	mmapChunkSize, mmapMaxChunks = 64*1024, 2
+
+	path := "/tmp/nutsdbtestmmapchunks.data"
+	os.Remove(path)
+	defer os.Remove(path)
+
+	mm, err := NewMMapRWManager(path, 4*mmapChunkSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the data spans three chunks, more than can be mapped at a time.
+	data := bytes.Repeat([]byte("0123456789"), int(mmapChunkSize)/5)
+	off := mmapChunkSize - 100
+	if n, err := mm.WriteAt(data, off); err != nil || n != len(data) {
+		t.Fatalf("err WriteAt, got %d %v want %d", n, err, len(data))
+	}
+	if len(mm.chunks) > mmapMaxChunks {
+		t.Errorf("err chunks, got %d mapped want at most %d", len(mm.chunks), mmapMaxChunks)
+	}
+
+	b := make([]byte, len(data))
+	if n, err := mm.ReadAt(b, off); err != nil || n != len(data) || !bytes.Equal(b, data) {
+		t.Fatalf("err ReadAt, got %d %v", n, err)
+	}
+
+	// the reads stop at the end of the file.
+	if n, _ := mm.ReadAt(b, 4*mmapChunkSize-10); n != 10 {
+		t.Errorf("err ReadAt, got %d want %d", n, 10)
+	}
+	if _, err := mm.ReadAt(b, 4*mmapChunkSize); err != ErrIndexOutOfBound {
+		t.Errorf("err ReadAt, got %v want %v", err, ErrIndexOutOfBound)
+	}
+	if n, err := mm.ReadAt(nil, 4*mmapChunkSize); err != nil || n != 0 {
+		t.Errorf("err empty ReadAt at the end, got %d %v", n, err)
+	}
+
+	if err := mm.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the unmapped chunks are flushed to the file.
+	fm, err := NewFileIORWManager(path, 4*mmapChunkSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fm.Close()
+
+	b = make([]byte, len(data))
+	if _, err := fm.ReadAt(b, off); err != nil || !bytes.Equal(b, data) {
+		t.Errorf("err ReadAt, the data is not written to the file: %v", err)
+	}
+}
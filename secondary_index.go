@@ -0,0 +1,213 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"errors"
+	"sort"
+)
+
+var (
+	// ErrIndexExists is returned when creating a secondary index with an existing name in the bucket.
+	ErrIndexExists = errors.New("secondary index already exists")
+
+	// ErrIndexNotFound is returned when the secondary index is not found in the bucket.
+	ErrIndexNotFound = errors.New("secondary index not found")
+)
+
+// IndexExtractor returns the index keys of a value, a value can have no or many index keys.
+type IndexExtractor func(value []byte) [][]byte
+
+// secondaryIndex maps the index keys extracted from the values of a bucket to their primary keys.
+type secondaryIndex struct {
+	extract IndexExtractor
+	keys    map[string]map[string]struct{} // index key -> primary keys
+	refs    map[string][][]byte            // primary key -> index keys
+}
+
+func newSecondaryIndex(extract IndexExtractor) *secondaryIndex {
+	return &secondaryIndex{
+		extract: extract,
+		keys:    make(map[string]map[string]struct{}),
+		refs:    make(map[string][][]byte),
+	}
+}
+
+// pendingIndex is a secondary index created or dropped (idx is nil) by a tx,
+// it is built or removed when the tx commits.
+type pendingIndex struct {
+	bucket string
+	name   string
+	idx    *secondaryIndex
+}
+
+// hasIndex checks if the secondary index exists, with the indexes created and dropped by the tx.
+func (tx *Tx) hasIndex(bucket, name string) bool {
+	for i := len(tx.pendingIndexes) - 1; i >= 0; i-- {
+		if p := tx.pendingIndexes[i]; p.bucket == bucket && p.name == name {
+			return p.idx != nil
+		}
+	}
+
+	_, ok := tx.db.secondaryIdxes[bucket][name]
+
+	return ok
+}
+
+// CreateIndex creates the secondary index named name on the key/value pairs of the bucket,
+// the extractor returns the index keys of a value. The index is built from the bucket when
+// the tx commits, then it is maintained by the commits along with the B+ tree index.
+// The secondary indexes are kept in memory, they must be created again after reopening the db.
+func (tx *Tx) CreateIndex(bucket, name string, extractor IndexExtractor) error {
+	if err := tx.checkTxIsClosed(); err != nil {
+		return err
+	}
+
+	if !tx.writable {
+		return ErrTxNotWritable
+	}
+
+	if extractor == nil {
+		return ErrFn
+	}
+
+	if tx.hasIndex(bucket, name) {
+		return ErrIndexExists
+	}
+
+	tx.pendingIndexes = append(tx.pendingIndexes, pendingIndex{bucket: bucket, name: name, idx: newSecondaryIndex(extractor)})
+
+	return nil
+}
+
+// DropIndex removes the secondary index named name of the bucket when the tx commits.
+func (tx *Tx) DropIndex(bucket, name string) error {
+	if err := tx.checkTxIsClosed(); err != nil {
+		return err
+	}
+
+	if !tx.writable {
+		return ErrTxNotWritable
+	}
+
+	if !tx.hasIndex(bucket, name) {
+		return ErrIndexNotFound
+	}
+
+	tx.pendingIndexes = append(tx.pendingIndexes, pendingIndex{bucket: bucket, name: name})
+
+	return nil
+}
+
+// QueryIndex returns the entries of the bucket whose value has the indexKey in the
+// secondary index named name, in the order of the primary keys.
+func (tx *Tx) QueryIndex(bucket, name string, indexKey []byte) (entries Entries, err error) {
+	if err := tx.checkTxIsClosed(); err != nil {
+		return nil, err
+	}
+
+	idx, ok := tx.db.secondaryIdxes[bucket][name]
+	if !ok {
+		return nil, ErrIndexNotFound
+	}
+
+	keys := make([]string, 0, len(idx.keys[string(indexKey)]))
+	for key := range idx.keys[string(indexKey)] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		e, err := tx.Get(bucket, []byte(key))
+		if err != nil {
+			// the key is expired.
+			continue
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
+
+// buildPendingIndexes builds the secondary indexes created by the tx from the committed bucket,
+// and removes the ones dropped by the tx.
+func (tx *Tx) buildPendingIndexes() {
+	for _, p := range tx.pendingIndexes {
+		if p.idx == nil {
+			delete(tx.db.secondaryIdxes[p.bucket], p.name)
+			if len(tx.db.secondaryIdxes[p.bucket]) == 0 {
+				delete(tx.db.secondaryIdxes, p.bucket)
+			}
+			continue
+		}
+
+		if entries, err := tx.GetAll(p.bucket); err == nil {
+			for _, e := range entries {
+				p.idx.update(e.Key, e.Value, false)
+			}
+		}
+
+		if _, ok := tx.db.secondaryIdxes[p.bucket]; !ok {
+			tx.db.secondaryIdxes[p.bucket] = make(map[string]*secondaryIndex)
+		}
+		tx.db.secondaryIdxes[p.bucket][p.name] = p.idx
+	}
+
+	tx.pendingIndexes = nil
+}
+
+// updateSecondaryIdxes updates the secondary indexes of the bucket with the committed entry.
+func (tx *Tx) updateSecondaryIdxes(bucket string, entry *Entry) {
+	for _, idx := range tx.db.secondaryIdxes[bucket] {
+		idx.update(entry.Key, entry.Value, entry.Meta.Flag == DataDeleteFlag)
+	}
+}
+
+// update replaces the index keys of the primary key by the ones of the value,
+// or removes them if the key is deleted.
+func (idx *secondaryIndex) update(key, value []byte, deleted bool) {
+	pk := string(key)
+
+	for _, indexKey := range idx.refs[pk] {
+		if pks, ok := idx.keys[string(indexKey)]; ok {
+			delete(pks, pk)
+			if len(pks) == 0 {
+				delete(idx.keys, string(indexKey))
+			}
+		}
+	}
+	delete(idx.refs, pk)
+
+	if deleted {
+		return
+	}
+
+	indexKeys := idx.extract(value)
+	if len(indexKeys) == 0 {
+		return
+	}
+
+	refs := make([][]byte, 0, len(indexKeys))
+	for _, indexKey := range indexKeys {
+		pks, ok := idx.keys[string(indexKey)]
+		if !ok {
+			pks = make(map[string]struct{})
+			idx.keys[string(indexKey)] = pks
+		}
+		pks[pk] = struct{}{}
+		refs = append(refs, append([]byte{}, indexKey...))
+	}
+	idx.refs[pk] = refs
+}
@@ -0,0 +1,127 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"bytes"
+	"testing"
+)
+
+// cityOf extracts the city of a "name,city" value.
+func cityOf(value []byte) [][]byte {
+	if i := bytes.IndexByte(value, ','); i >= 0 {
+		return [][]byte{value[i+1:]}
+	}
+	return nil
+}
+
+func queryKeys(t *testing.T, bucket, name, indexKey string) (keys []string) {
+	if err := db.View(func(tx *Tx) error {
+		entries, err := tx.QueryIndex(bucket, name, []byte(indexKey))
+		for _, e := range entries {
+			keys = append(keys, string(e.Key))
+		}
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	return
+}
+
+func TestTx_SecondaryIndex(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestforsecondaryindex", true)
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	bucket := "bucket_for_secondary_index"
+	if err := db.Update(func(tx *Tx) error {
+		if err := tx.Put(bucket, []byte("user_1"), []byte("alice,paris"), Persistent); err != nil {
+			return err
+		}
+		return tx.Put(bucket, []byte("user_2"), []byte("bob,london"), Persistent)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the index is built from the bucket and the writes of the creating tx.
+	if err := db.Update(func(tx *Tx) error {
+		if err := tx.CreateIndex(bucket, "city", cityOf); err != nil {
+			return err
+		}
+		if err := tx.CreateIndex(bucket, "city", cityOf); err != ErrIndexExists {
+			t.Errorf("err CreateIndex, got %v want %v", err, ErrIndexExists)
+		}
+		return tx.Put(bucket, []byte("user_3"), []byte("carol,paris"), Persistent)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if keys := queryKeys(t, bucket, "city", "paris"); len(keys) != 2 || keys[0] != "user_1" || keys[1] != "user_3" {
+		t.Errorf("err QueryIndex, got %v", keys)
+	}
+
+	if err := db.Update(func(tx *Tx) error {
+		if err := tx.Put(bucket, []byte("user_1"), []byte("alice,london"), Persistent); err != nil {
+			return err
+		}
+		return tx.Delete(bucket, []byte("user_3"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if keys := queryKeys(t, bucket, "city", "paris"); len(keys) != 0 {
+		t.Errorf("err QueryIndex, got %v", keys)
+	}
+	if keys := queryKeys(t, bucket, "city", "london"); len(keys) != 2 || keys[0] != "user_1" || keys[1] != "user_2" {
+		t.Errorf("err QueryIndex, got %v", keys)
+	}
+
+	// the writes of a rolled back tx are not indexed.
+	tx, err := db.Begin(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Put(bucket, []byte("user_4"), []byte("dave,paris"), Persistent); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.CreateIndex(bucket, "name", cityOf); err != nil {
+		t.Fatal(err)
+	}
+	tx.Rollback()
+
+	if keys := queryKeys(t, bucket, "city", "paris"); len(keys) != 0 {
+		t.Errorf("err QueryIndex, got %v", keys)
+	}
+
+	if err := db.Update(func(tx *Tx) error {
+		if _, err := tx.QueryIndex(bucket, "name", []byte("paris")); err != ErrIndexNotFound {
+			t.Errorf("err QueryIndex, got %v want %v", err, ErrIndexNotFound)
+		}
+		return tx.DropIndex(bucket, "city")
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.View(func(tx *Tx) error {
+		_, err := tx.QueryIndex(bucket, "city", []byte("paris"))
+		return err
+	}); err != ErrIndexNotFound {
+		t.Errorf("err QueryIndex, got %v want %v", err, ErrIndexNotFound)
+	}
+}
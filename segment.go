@@ -0,0 +1,149 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// RecycleSuffix represents the suffix of the dead data files kept for reuse with RecycleSegments.
+const RecycleSuffix = ".recycle"
+
+// zeroChunkSize is the size of the writes zeroing a data file.
+const zeroChunkSize = 1 << 20
+
+// preallocateDataFile allocates the blocks of the new data file at given path up to SegmentSize
+// with PreallocateSegments, so that the writes to it do not wait for the file system to allocate them.
+func (db *DB) preallocateDataFile(path string) error {
+	if !db.opt.PreallocateSegments || db.opt.Backend != nil {
+		return nil
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return preallocate(f, db.opt.SegmentSize)
+}
+
+// writeZeros writes zeros to the file from the start up to size.
+func writeZeros(f *os.File, size int64) error {
+	buf := make([]byte, zeroChunkSize)
+	for off := int64(0); off < size; off += zeroChunkSize {
+		n := size - off
+		if n > zeroChunkSize {
+			n = zeroChunkSize
+		}
+		if _, err := f.WriteAt(buf[:n], off); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// recycleDataFile removes the dead data file at given path, or keeps it for reuse if there are
+// less than RecycleSegments recycled files and no snapshot. A recycled file is zeroed and synced
+// before it is renamed, so that its entries are never parsed again.
+func (db *DB) recycleDataFile(path string) error {
+	db.recycleMu.Lock()
+	defer db.recycleMu.Unlock()
+
+	// the snapshots may link the data file, it must not be zeroed.
+	if len(db.recycledFiles) >= db.opt.RecycleSegments || db.hasSnapshots() || db.opt.Backend != nil {
+		return db.removeDataFile(path)
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+
+	fi, err := f.Stat()
+	if err == nil {
+		err = writeZeros(f, fi.Size())
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	recycledPath := strings.TrimSuffix(path, DataSuffix) + RecycleSuffix
+	if err := os.Rename(path, recycledPath); err != nil {
+		return err
+	}
+
+	db.recycledFiles = append(db.recycledFiles, recycledPath)
+
+	return nil
+}
+
+// reuseRecycledFile renames a recycled file to the data file at given path,
+// and returns if there is one.
+func (db *DB) reuseRecycledFile(path string) (bool, error) {
+	db.recycleMu.Lock()
+	defer db.recycleMu.Unlock()
+
+	n := len(db.recycledFiles)
+	if n == 0 {
+		return false, nil
+	}
+
+	if err := os.Rename(db.recycledFiles[n-1], path); err != nil {
+		return false, err
+	}
+
+	db.recycledFiles = db.recycledFiles[:n-1]
+
+	return true, nil
+}
+
+// loadRecycledFiles records the recycled files of the dir, the ones beyond RecycleSegments are removed.
+func (db *DB) loadRecycledFiles() error {
+	files, err := ioutil.ReadDir(db.opt.Dir)
+	if err != nil {
+		return err
+	}
+
+	var paths []string
+	for _, f := range files {
+		if !f.IsDir() && path.Ext(f.Name()) == RecycleSuffix {
+			paths = append(paths, db.opt.Dir+"/"+f.Name())
+		}
+	}
+	sort.Strings(paths)
+
+	for len(paths) > db.opt.RecycleSegments {
+		if err := os.Remove(paths[len(paths)-1]); err != nil {
+			return err
+		}
+		paths = paths[:len(paths)-1]
+	}
+
+	db.recycledFiles = paths
+
+	return nil
+}
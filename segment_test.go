@@ -0,0 +1,164 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/xujiajun/utils/strconv2"
+)
+
+func putSegmentKeys(t *testing.T, bucket string, from, to int) {
+	t.Helper()
+
+	for i := from; i < to; i++ {
+		if err := db.Update(func(tx *Tx) error {
+			return tx.Put(bucket, []byte("hello"), []byte("world"+strconv2.IntToStr(i)), Persistent)
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func checkSegmentKey(t *testing.T, bucket string, want string) {
+	t.Helper()
+
+	if err := db.View(func(tx *Tx) error {
+		e, err := tx.Get(bucket, []byte("hello"))
+		if err != nil {
+			return err
+		}
+		if string(e.Value) != want {
+			t.Errorf("err get, got %s want %s", e.Value, want)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func recycledFiles(t *testing.T) []string {
+	t.Helper()
+
+	files, err := ioutil.ReadDir(opt.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var paths []string
+	for _, f := range files {
+		if path.Ext(f.Name()) == RecycleSuffix {
+			paths = append(paths, opt.Dir+"/"+f.Name())
+		}
+	}
+
+	return paths
+}
+
+func TestDB_PreallocateSegments(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestsegments", true)
+	opt.SegmentSize = 4096
+	opt.PreallocateSegments = true
+
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bucket := "bucket_segments"
+	putSegmentKeys(t, bucket, 0, 100)
+
+	_, fileIDs := db.getMaxFileIDAndFileIDs()
+	if len(fileIDs) < 2 {
+		t.Fatalf("err rotate, got %d data files", len(fileIDs))
+	}
+	for _, fID := range fileIDs {
+		fi, err := os.Stat(db.getDataPath(int64(fID)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Size() != opt.SegmentSize {
+			t.Errorf("err data file size, got %d want %d", fi.Size(), opt.SegmentSize)
+		}
+	}
+
+	// the preallocation does not overwrite the entries of the active file on reopen.
+	db.Close()
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	checkSegmentKey(t, bucket, "world99")
+}
+
+func TestDB_RecycleSegments(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestsegments", true)
+	opt.SegmentSize = 120
+	opt.RecycleSegments = 2
+
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bucket := "bucket_segments"
+	putSegmentKeys(t, bucket, 0, 20)
+
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(recycledFiles(t)); got != 2 {
+		t.Fatalf("err recycled files, got %d want %d", got, 2)
+	}
+
+	// the recycled files are zeroed.
+	for _, p := range recycledFiles(t) {
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, b := range data {
+			if b != 0 {
+				t.Fatalf("err recycled file %s is not zeroed", p)
+			}
+		}
+	}
+
+	// the next active files reuse the recycled files.
+	putSegmentKeys(t, bucket, 20, 21)
+	if got := len(recycledFiles(t)); got != 1 {
+		t.Errorf("err recycled files, got %d want %d", got, 1)
+	}
+	checkSegmentKey(t, bucket, "world20")
+
+	// the recycled files are kept on reopen up to RecycleSegments.
+	db.Close()
+	opt.RecycleSegments = 0
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if got := len(recycledFiles(t)); got != 0 {
+		t.Errorf("err recycled files, got %d want %d", got, 0)
+	}
+	checkSegmentKey(t, bucket, "world20")
+}
@@ -0,0 +1,758 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/xujiajun/nutsdb"
+)
+
+const (
+	errSyntax   = "ERR syntax error"
+	errNotInt   = "ERR value is not an integer or out of range"
+	errNotFloat = "ERR value is not a valid float"
+)
+
+// defaultScanCount is the number of keys a SCAN iteration visits without COUNT.
+const defaultScanCount = 10
+
+// client is the state of a connection.
+type client struct {
+	db     *nutsdb.DB
+	r      *respReader
+	w      *respWriter
+	bucket string // the bucket selected by SELECT
+}
+
+// command is a handler of a command, arity is the min number of arguments after the name.
+type command struct {
+	arity   int
+	handler func(c *client, args [][]byte)
+}
+
+var commands = map[string]command{
+	"PING":      {0, (*client).ping},
+	"ECHO":      {1, (*client).echo},
+	"SELECT":    {1, (*client).selectBucket},
+	"GET":       {1, (*client).get},
+	"SET":       {2, (*client).set},
+	"DEL":       {1, (*client).del},
+	"EXISTS":    {1, (*client).exists},
+	"EXPIRE":    {2, (*client).expire},
+	"SCAN":      {1, (*client).scan},
+	"LPUSH":     {2, (*client).lpush},
+	"RPUSH":     {2, (*client).rpush},
+	"LPOP":      {1, (*client).lpop},
+	"RPOP":      {1, (*client).rpop},
+	"LLEN":      {1, (*client).llen},
+	"LRANGE":    {3, (*client).lrange},
+	"SADD":      {2, (*client).sadd},
+	"SREM":      {2, (*client).srem},
+	"SMEMBERS":  {1, (*client).smembers},
+	"SISMEMBER": {2, (*client).sismember},
+	"SCARD":     {1, (*client).scard},
+	"ZADD":      {3, (*client).zadd},
+	"ZREM":      {2, (*client).zrem},
+	"ZSCORE":    {2, (*client).zscore},
+	"ZCARD":     {1, (*client).zcard},
+	"ZRANGE":    {3, (*client).zrange},
+}
+
+// exec runs the command of args and writes its reply, it returns true if the connection should be closed.
+func (c *client) exec(args [][]byte) (quit bool) {
+	name := strings.ToUpper(string(args[0]))
+
+	if name == "QUIT" {
+		c.w.writeString("OK")
+		return true
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		c.w.writeError("ERR unknown command '" + string(args[0]) + "'")
+		return false
+	}
+
+	if len(args)-1 < cmd.arity {
+		c.w.writeError("ERR wrong number of arguments for '" + strings.ToLower(name) + "' command")
+		return false
+	}
+
+	cmd.handler(c, args[1:])
+
+	return false
+}
+
+// isNotFound reports whether err is returned because the key or the bucket is not found,
+// which the commands reply as a missing key.
+func isNotFound(err error) bool {
+	return errors.Is(err, nutsdb.ErrKeyNotFound) || errors.Is(err, nutsdb.ErrBucketNotFound) || errors.Is(err, nutsdb.ErrBucketEmpty)
+}
+
+// writeErr writes the error reply of a nutsdb error.
+func (c *client) writeErr(err error) {
+	c.w.writeError("ERR " + err.Error())
+}
+
+// zsetBucket returns the name of the sorted set bucket of the key.
+func (c *client) zsetBucket(key []byte) string {
+	return c.bucket + ZSetBucketSeparator + string(key)
+}
+
+func (c *client) ping(args [][]byte) {
+	if len(args) == 0 {
+		c.w.writeString("PONG")
+		return
+	}
+
+	c.w.writeBulk(args[0])
+}
+
+func (c *client) echo(args [][]byte) {
+	c.w.writeBulk(args[0])
+}
+
+func (c *client) selectBucket(args [][]byte) {
+	c.bucket = string(args[0])
+	c.w.writeString("OK")
+}
+
+func (c *client) get(args [][]byte) {
+	var value []byte
+
+	err := c.db.View(func(tx *nutsdb.Tx) error {
+		e, err := tx.Get(c.bucket, args[0])
+		if isNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		value = append([]byte{}, e.Value...)
+		return nil
+	})
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+
+	if value == nil {
+		c.w.writeNull()
+		return
+	}
+
+	c.w.writeBulk(value)
+}
+
+// set handles SET key value [EX seconds|PX milliseconds] [NX|XX].
+func (c *client) set(args [][]byte) {
+	var (
+		ttl    = nutsdb.Persistent
+		nx, xx bool
+	)
+
+	for i := 2; i < len(args); i++ {
+		switch opt := strings.ToUpper(string(args[i])); opt {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "EX", "PX":
+			if i+1 >= len(args) {
+				c.w.writeError(errSyntax)
+				return
+			}
+			i++
+			n, err := strconv.ParseUint(string(args[i]), 10, 32)
+			if err != nil || n == 0 {
+				c.w.writeError("ERR invalid expire time in 'set' command")
+				return
+			}
+			if opt == "PX" {
+				n = (n + 999) / 1000
+			}
+			ttl = uint32(n)
+		default:
+			c.w.writeError(errSyntax)
+			return
+		}
+	}
+
+	if nx && xx {
+		c.w.writeError(errSyntax)
+		return
+	}
+
+	written := false
+	err := c.db.Update(func(tx *nutsdb.Tx) error {
+		if nx || xx {
+			_, err := tx.Get(c.bucket, args[0])
+			if exists := err == nil; (nx && exists) || (xx && !exists) {
+				return nil
+			}
+		}
+
+		written = true
+		return tx.Put(c.bucket, args[0], args[1], ttl)
+	})
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+
+	if !written {
+		c.w.writeNull()
+		return
+	}
+
+	c.w.writeString("OK")
+}
+
+func (c *client) del(args [][]byte) {
+	deleted := map[string]struct{}{}
+
+	err := c.db.Update(func(tx *nutsdb.Tx) error {
+		for _, key := range args {
+			if _, ok := deleted[string(key)]; ok {
+				continue
+			}
+			if _, err := tx.Get(c.bucket, key); isNotFound(err) {
+				continue
+			} else if err != nil {
+				return err
+			}
+			if err := tx.Delete(c.bucket, key); err != nil {
+				return err
+			}
+			deleted[string(key)] = struct{}{}
+		}
+		return nil
+	})
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+
+	c.w.writeInt(int64(len(deleted)))
+}
+
+func (c *client) exists(args [][]byte) {
+	n := 0
+
+	err := c.db.View(func(tx *nutsdb.Tx) error {
+		for _, key := range args {
+			if _, err := tx.Get(c.bucket, key); err == nil {
+				n++
+			} else if !isNotFound(err) {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+
+	c.w.writeInt(int64(n))
+}
+
+// expire handles EXPIRE key seconds, it puts the value again with the new TTL.
+func (c *client) expire(args [][]byte) {
+	seconds, err := strconv.ParseInt(string(args[1]), 10, 32)
+	if err != nil {
+		c.w.writeError(errNotInt)
+		return
+	}
+
+	found := false
+	err = c.db.Update(func(tx *nutsdb.Tx) error {
+		e, err := tx.Get(c.bucket, args[0])
+		if isNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		found = true
+		if seconds <= 0 {
+			return tx.Delete(c.bucket, args[0])
+		}
+		return tx.Put(c.bucket, args[0], append([]byte{}, e.Value...), uint32(seconds))
+	})
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+
+	if found {
+		c.w.writeInt(1)
+	} else {
+		c.w.writeInt(0)
+	}
+}
+
+// scan handles SCAN cursor [MATCH pattern] [COUNT count], the cursor is the offset
+// of the next key in the sorted keys of the bucket.
+func (c *client) scan(args [][]byte) {
+	cursor, err := strconv.Atoi(string(args[0]))
+	if err != nil || cursor < 0 {
+		c.w.writeError("ERR invalid cursor")
+		return
+	}
+
+	var (
+		pattern string
+		count   = defaultScanCount
+	)
+
+	for i := 1; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			c.w.writeError(errSyntax)
+			return
+		}
+
+		switch strings.ToUpper(string(args[i])) {
+		case "MATCH":
+			pattern = string(args[i+1])
+			if _, err := path.Match(pattern, ""); err != nil {
+				c.w.writeError(errSyntax)
+				return
+			}
+		case "COUNT":
+			if count, err = strconv.Atoi(string(args[i+1])); err != nil || count < 1 {
+				c.w.writeError(errNotInt)
+				return
+			}
+		default:
+			c.w.writeError(errSyntax)
+			return
+		}
+	}
+
+	var (
+		keys [][]byte
+		next int
+	)
+
+	err = c.db.View(func(tx *nutsdb.Tx) error {
+		entries, err := tx.GetAll(c.bucket)
+		if isNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		end := cursor + count
+		if end < len(entries) {
+			next = end
+		} else {
+			end = len(entries)
+		}
+
+		for i := cursor; i < end; i++ {
+			if ok, _ := path.Match(pattern, string(entries[i].Key)); pattern == "" || ok {
+				keys = append(keys, append([]byte{}, entries[i].Key...))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+
+	c.w.writeArrayHeader(2)
+	c.w.writeBulk([]byte(strconv.Itoa(next)))
+	c.w.writeBulks(keys)
+}
+
+func (c *client) lpush(args [][]byte) {
+	c.push(args, (*nutsdb.Tx).LPush)
+}
+
+func (c *client) rpush(args [][]byte) {
+	c.push(args, (*nutsdb.Tx).RPush)
+}
+
+// push pushes the values and writes the length of the list.
+func (c *client) push(args [][]byte, push func(tx *nutsdb.Tx, bucket string, key []byte, values ...[]byte) error) {
+	if err := c.db.Update(func(tx *nutsdb.Tx) error {
+		return push(tx, c.bucket, args[0], args[1:]...)
+	}); err != nil {
+		c.writeErr(err)
+		return
+	}
+
+	c.llen(args[:1])
+}
+
+func (c *client) lpop(args [][]byte) {
+	c.pop(args, (*nutsdb.Tx).LPop)
+}
+
+func (c *client) rpop(args [][]byte) {
+	c.pop(args, (*nutsdb.Tx).RPop)
+}
+
+// pop pops an item and writes it, or a null reply if the list is empty.
+func (c *client) pop(args [][]byte, pop func(tx *nutsdb.Tx, bucket string, key []byte) ([]byte, error)) {
+	var item []byte
+
+	err := c.db.Update(func(tx *nutsdb.Tx) error {
+		b, err := pop(tx, c.bucket, args[0])
+		if isNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		item = append([]byte{}, b...)
+		return nil
+	})
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+
+	if item == nil {
+		c.w.writeNull()
+		return
+	}
+
+	c.w.writeBulk(item)
+}
+
+func (c *client) llen(args [][]byte) {
+	size := 0
+
+	err := c.db.View(func(tx *nutsdb.Tx) error {
+		size, _ = tx.LSize(c.bucket, args[0])
+		return nil
+	})
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+
+	c.w.writeInt(int64(size))
+}
+
+func (c *client) lrange(args [][]byte) {
+	start, err1 := strconv.Atoi(string(args[1]))
+	end, err2 := strconv.Atoi(string(args[2]))
+	if err1 != nil || err2 != nil {
+		c.w.writeError(errNotInt)
+		return
+	}
+
+	var items [][]byte
+
+	err := c.db.View(func(tx *nutsdb.Tx) error {
+		list, err := tx.LRange(c.bucket, args[0], start, end)
+		if err != nil {
+			return nil
+		}
+		for _, item := range list {
+			items = append(items, append([]byte{}, item...))
+		}
+		return nil
+	})
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+
+	c.w.writeBulks(items)
+}
+
+func (c *client) sadd(args [][]byte) {
+	added := map[string]struct{}{}
+
+	err := c.db.Update(func(tx *nutsdb.Tx) error {
+		for _, member := range args[1:] {
+			if ok, _ := tx.SIsMember(c.bucket, args[0], member); !ok {
+				added[string(member)] = struct{}{}
+			}
+		}
+		return tx.SAdd(c.bucket, args[0], args[1:]...)
+	})
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+
+	c.w.writeInt(int64(len(added)))
+}
+
+func (c *client) srem(args [][]byte) {
+	removed := map[string]struct{}{}
+
+	err := c.db.Update(func(tx *nutsdb.Tx) error {
+		for _, member := range args[1:] {
+			if _, ok := removed[string(member)]; ok {
+				continue
+			}
+			if ok, _ := tx.SIsMember(c.bucket, args[0], member); !ok {
+				continue
+			}
+			if err := tx.SRem(c.bucket, args[0], member); err != nil {
+				return err
+			}
+			removed[string(member)] = struct{}{}
+		}
+		return nil
+	})
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+
+	c.w.writeInt(int64(len(removed)))
+}
+
+func (c *client) smembers(args [][]byte) {
+	var members [][]byte
+
+	err := c.db.View(func(tx *nutsdb.Tx) error {
+		list, err := tx.SMembers(c.bucket, args[0])
+		if err != nil {
+			return nil
+		}
+		for _, member := range list {
+			members = append(members, append([]byte{}, member...))
+		}
+		return nil
+	})
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+
+	c.w.writeBulks(members)
+}
+
+func (c *client) sismember(args [][]byte) {
+	ok := false
+
+	err := c.db.View(func(tx *nutsdb.Tx) error {
+		ok, _ = tx.SIsMember(c.bucket, args[0], args[1])
+		return nil
+	})
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+
+	if ok {
+		c.w.writeInt(1)
+	} else {
+		c.w.writeInt(0)
+	}
+}
+
+func (c *client) scard(args [][]byte) {
+	n := 0
+
+	err := c.db.View(func(tx *nutsdb.Tx) error {
+		n, _ = tx.SCard(c.bucket, args[0])
+		return nil
+	})
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+
+	c.w.writeInt(int64(n))
+}
+
+// zadd handles ZADD key score member [score member ...].
+func (c *client) zadd(args [][]byte) {
+	if len(args)%2 != 1 {
+		c.w.writeError(errSyntax)
+		return
+	}
+
+	scores := make([]float64, 0, len(args)/2)
+	for i := 1; i < len(args); i += 2 {
+		score, err := strconv.ParseFloat(string(args[i]), 64)
+		if err != nil {
+			c.w.writeError(errNotFloat)
+			return
+		}
+		scores = append(scores, score)
+	}
+
+	bucket := c.zsetBucket(args[0])
+	added := map[string]struct{}{}
+
+	err := c.db.Update(func(tx *nutsdb.Tx) error {
+		for i, score := range scores {
+			member := args[2+2*i]
+			if node, err := tx.ZGetByKey(bucket, member); err != nil || node == nil {
+				added[string(member)] = struct{}{}
+			}
+			if err := tx.ZAdd(bucket, member, score, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+
+	c.w.writeInt(int64(len(added)))
+}
+
+func (c *client) zrem(args [][]byte) {
+	bucket := c.zsetBucket(args[0])
+	removed := map[string]struct{}{}
+
+	err := c.db.Update(func(tx *nutsdb.Tx) error {
+		for _, member := range args[1:] {
+			if _, ok := removed[string(member)]; ok {
+				continue
+			}
+			if node, err := tx.ZGetByKey(bucket, member); err != nil || node == nil {
+				continue
+			}
+			if err := tx.ZRem(bucket, string(member)); err != nil {
+				return err
+			}
+			removed[string(member)] = struct{}{}
+		}
+		return nil
+	})
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+
+	c.w.writeInt(int64(len(removed)))
+}
+
+func (c *client) zscore(args [][]byte) {
+	var (
+		score float64
+		found bool
+	)
+
+	err := c.db.View(func(tx *nutsdb.Tx) error {
+		var err error
+		score, err = tx.ZScore(c.zsetBucket(args[0]), args[1])
+		found = err == nil
+		return nil
+	})
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+
+	if !found {
+		c.w.writeNull()
+		return
+	}
+
+	c.w.writeBulk([]byte(strconv.FormatFloat(score, 'f', -1, 64)))
+}
+
+func (c *client) zcard(args [][]byte) {
+	n := 0
+
+	err := c.db.View(func(tx *nutsdb.Tx) error {
+		n, _ = tx.ZCard(c.zsetBucket(args[0]))
+		return nil
+	})
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+
+	c.w.writeInt(int64(n))
+}
+
+// zrange handles ZRANGE key start stop [WITHSCORES], start and stop are zero-based ranks.
+func (c *client) zrange(args [][]byte) {
+	start, err1 := strconv.Atoi(string(args[1]))
+	stop, err2 := strconv.Atoi(string(args[2]))
+	if err1 != nil || err2 != nil {
+		c.w.writeError(errNotInt)
+		return
+	}
+
+	withScores := false
+	if len(args) > 3 {
+		if len(args) > 4 || strings.ToUpper(string(args[3])) != "WITHSCORES" {
+			c.w.writeError(errSyntax)
+			return
+		}
+		withScores = true
+	}
+
+	var reply [][]byte
+
+	err := c.db.View(func(tx *nutsdb.Tx) error {
+		bucket := c.zsetBucket(args[0])
+
+		n, err := tx.ZCard(bucket)
+		if err != nil {
+			return nil
+		}
+
+		if start < 0 {
+			start += n
+		}
+		if stop < 0 {
+			stop += n
+		}
+		if start < 0 {
+			start = 0
+		}
+		if stop >= n {
+			stop = n - 1
+		}
+		if start > stop {
+			return nil
+		}
+
+		// the ranks of nutsdb are 1-based.
+		nodes, err := tx.ZRangeByRank(bucket, start+1, stop+1)
+		if err != nil {
+			return err
+		}
+
+		for _, node := range nodes {
+			reply = append(reply, []byte(node.Key()))
+			if withScores {
+				reply = append(reply, []byte(strconv.FormatFloat(float64(node.Score()), 'f', -1, 64)))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+
+	c.w.writeBulks(reply)
+}
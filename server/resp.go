@@ -0,0 +1,175 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// ErrProtocol is returned when a request does not follow the RESP protocol.
+var ErrProtocol = errors.New("protocol error")
+
+const (
+	// maxArgs is the max number of arguments of a request.
+	maxArgs = 1024 * 1024
+
+	// maxBulkSize is the max size of a bulk string in a request.
+	maxBulkSize = 512 * 1024 * 1024
+
+	// bulkChunkSize is the size of a bulk string over which its buffer grows as it is read,
+	// so that the size sent by a client does not allocate the memory before the data.
+	bulkChunkSize = 64 * 1024
+)
+
+// respReader reads the requests of the RESP protocol, both the arrays of
+// bulk strings sent by the clients and the inline commands typed by humans.
+type respReader struct {
+	r *bufio.Reader
+}
+
+func newRespReader(r io.Reader) *respReader {
+	return &respReader{r: bufio.NewReader(r)}
+}
+
+// readLine reads a line without the trailing \r\n.
+func (rr *respReader) readLine() ([]byte, error) {
+	line, err := rr.r.ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimRight(line, "\r\n"), nil
+}
+
+// readCommand reads a request and returns its arguments, the first one is the command name.
+func (rr *respReader) readCommand() ([][]byte, error) {
+	line, err := rr.readLine()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) == 0 {
+		return nil, nil
+	}
+
+	if line[0] != '*' {
+		return bytes.Fields(line), nil
+	}
+
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil || n < 0 || n > maxArgs {
+		return nil, ErrProtocol
+	}
+
+	var args [][]byte
+	for i := 0; i < n; i++ {
+		arg, err := rr.readBulk()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+
+	return args, nil
+}
+
+// readBulk reads a bulk string.
+func (rr *respReader) readBulk() ([]byte, error) {
+	line, err := rr.readLine()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) == 0 || line[0] != '$' {
+		return nil, ErrProtocol
+	}
+
+	size, err := strconv.Atoi(string(line[1:]))
+	if err != nil || size < 0 || size > maxBulkSize {
+		return nil, ErrProtocol
+	}
+
+	var buf []byte
+	if size <= bulkChunkSize {
+		buf = make([]byte, size+2)
+		if _, err := io.ReadFull(rr.r, buf); err != nil {
+			return nil, err
+		}
+	} else {
+		var b bytes.Buffer
+		if _, err := io.CopyN(&b, rr.r, int64(size)+2); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		buf = b.Bytes()
+	}
+	if buf[size] != '\r' || buf[size+1] != '\n' {
+		return nil, ErrProtocol
+	}
+
+	return buf[:size], nil
+}
+
+// respWriter writes the replies of the RESP protocol.
+type respWriter struct {
+	w *bufio.Writer
+}
+
+func newRespWriter(w io.Writer) *respWriter {
+	return &respWriter{w: bufio.NewWriter(w)}
+}
+
+func (rw *respWriter) writeString(s string) {
+	rw.w.WriteString("+" + s + "\r\n")
+}
+
+func (rw *respWriter) writeError(s string) {
+	rw.w.WriteString("-" + s + "\r\n")
+}
+
+func (rw *respWriter) writeInt(n int64) {
+	rw.w.WriteString(":" + strconv.FormatInt(n, 10) + "\r\n")
+}
+
+func (rw *respWriter) writeBulk(b []byte) {
+	rw.w.WriteString("$" + strconv.Itoa(len(b)) + "\r\n")
+	rw.w.Write(b)
+	rw.w.WriteString("\r\n")
+}
+
+func (rw *respWriter) writeNull() {
+	rw.w.WriteString("$-1\r\n")
+}
+
+func (rw *respWriter) writeArrayHeader(n int) {
+	rw.w.WriteString("*" + strconv.Itoa(n) + "\r\n")
+}
+
+func (rw *respWriter) writeBulks(bs [][]byte) {
+	rw.writeArrayHeader(len(bs))
+	for _, b := range bs {
+		rw.writeBulk(b)
+	}
+}
+
+func (rw *respWriter) flush() error {
+	return rw.w.Flush()
+}
@@ -0,0 +1,189 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package server implements a server speaking the Redis protocol (RESP) over a nutsdb database,
+so the existing Redis clients and tools can talk to a nutsdb instance directly.
+
+The commands run in the bucket selected by SELECT, DefaultBucket ("0", like the Redis database 0)
+at first. The strings are the key/value pairs of the bucket, and the lists and the sets are the
+lists and the sets of the bucket. A sorted set is a nutsdb sorted set bucket, named the selected
+bucket and the key joined by ZSetBucketSeparator.
+
+The supported commands are PING, ECHO, SELECT, QUIT, GET, SET, DEL, EXISTS, EXPIRE, SCAN,
+LPUSH, RPUSH, LPOP, RPOP, LLEN, LRANGE, SADD, SREM, SMEMBERS, SISMEMBER, SCARD,
+ZADD, ZREM, ZSCORE, ZCARD and ZRANGE.
+*/
+package server
+
+import (
+	"errors"
+	"log"
+	"net"
+	"runtime/debug"
+	"sync"
+
+	"github.com/xujiajun/nutsdb"
+)
+
+// ErrServerClosed is returned by Serve and ListenAndServe after Close is called.
+var ErrServerClosed = errors.New("server closed")
+
+const (
+	// DefaultBucket is the bucket selected when a connection is accepted.
+	DefaultBucket = "0"
+
+	// ZSetBucketSeparator separates the selected bucket and the key in the name of
+	// the nutsdb bucket holding a sorted set.
+	ZSetBucketSeparator = ":"
+)
+
+// Server serves the Redis protocol over a nutsdb database.
+type Server struct {
+	db *nutsdb.DB
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// New returns a server over the db, the db is not closed by the server.
+func New(db *nutsdb.DB) *Server {
+	return &Server{
+		db:        db,
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+}
+
+// ListenAndServe listens on the TCP network address addr and serves the connections.
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(l)
+}
+
+// Serve accepts the connections on the listener l and serves each of them in a goroutine.
+// It always returns a non-nil error, ErrServerClosed after Close is called.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, l)
+		s.mu.Unlock()
+		l.Close()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return ErrServerClosed
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go s.serveConn(conn)
+	}
+}
+
+// Close closes the listeners and the connections, and waits for the running commands.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+
+	return nil
+}
+
+// serveConn reads the commands of the connection and writes their replies until it is closed.
+func (s *Server) serveConn(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+		s.wg.Done()
+	}()
+
+	// a panic serving a connection closes it instead of the process.
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("nutsdb server: panic serving %v: %v\n%s", conn.RemoteAddr(), r, debug.Stack())
+		}
+	}()
+
+	c := &client{
+		db:     s.db,
+		r:      newRespReader(conn),
+		w:      newRespWriter(conn),
+		bucket: DefaultBucket,
+	}
+
+	for {
+		args, err := c.r.readCommand()
+		if err != nil {
+			if err == ErrProtocol {
+				c.w.writeError("ERR " + err.Error())
+				c.w.flush()
+			}
+			return
+		}
+
+		if len(args) == 0 {
+			continue
+		}
+
+		quit := c.exec(args)
+
+		if err := c.w.flush(); err != nil || quit {
+			return
+		}
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/xujiajun/nutsdb"
+)
+
+// testClient sends the commands as RESP arrays and reads the raw replies.
+type testClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func (tc *testClient) do(args ...string) string {
+	cmd := "*" + strconv.Itoa(len(args)) + "\r\n"
+	for _, arg := range args {
+		cmd += "$" + strconv.Itoa(len(arg)) + "\r\n" + arg + "\r\n"
+	}
+	if _, err := tc.conn.Write([]byte(cmd)); err != nil {
+		tc.t.Fatal(err)
+	}
+
+	return tc.readReply()
+}
+
+// readReply reads a reply and returns it in one line, the lines joined by spaces.
+func (tc *testClient) readReply() string {
+	line, err := tc.r.ReadString('\n')
+	if err != nil {
+		tc.t.Fatal(err)
+	}
+	line = strings.TrimRight(line, "\r\n")
+
+	switch line[0] {
+	case '$':
+		n, _ := strconv.Atoi(line[1:])
+		if n < 0 {
+			return "(nil)"
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(tc.r, buf); err != nil {
+			tc.t.Fatal(err)
+		}
+		return string(buf[:n])
+	case '*':
+		n, _ := strconv.Atoi(line[1:])
+		items := make([]string, 0, n)
+		for i := 0; i < n; i++ {
+			items = append(items, tc.readReply())
+		}
+		return "[" + strings.Join(items, " ") + "]"
+	}
+
+	return line
+}
+
+func TestServer(t *testing.T) {
+	opt := nutsdb.DefaultOptions
+	opt.Dir = "/tmp/nutsdbtestforserver"
+	os.RemoveAll(opt.Dir)
+	db, err := nutsdb.Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := New(db)
+	done := make(chan error)
+	go func() {
+		done <- srv.Serve(l)
+	}()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc := &testClient{t: t, conn: conn, r: bufio.NewReader(conn)}
+
+	cases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"PING"}, "+PONG"},
+		{[]string{"GET", "k1"}, "(nil)"},
+		{[]string{"SET", "k1", "v1"}, "+OK"},
+		{[]string{"SET", "k1", "v2", "NX"}, "(nil)"},
+		{[]string{"SET", "k2", "v2", "EX", "100"}, "+OK"},
+		{[]string{"get", "k1"}, "v1"},
+		{[]string{"EXISTS", "k1", "k2", "k3"}, ":2"},
+		{[]string{"EXPIRE", "k1", "100"}, ":1"},
+		{[]string{"EXPIRE", "k3", "100"}, ":0"},
+		{[]string{"SCAN", "0", "COUNT", "1"}, "[1 [k1]]"},
+		{[]string{"SCAN", "1", "COUNT", "1"}, "[0 [k2]]"},
+		{[]string{"SCAN", "0", "MATCH", "*2"}, "[0 [k2]]"},
+		{[]string{"DEL", "k1", "k1", "k3"}, ":1"},
+		{[]string{"GET", "k1"}, "(nil)"},
+		{[]string{"RPUSH", "list", "a", "b"}, ":2"},
+		{[]string{"LPUSH", "list", "c"}, ":3"},
+		{[]string{"LRANGE", "list", "0", "-1"}, "[c a b]"},
+		{[]string{"LPOP", "list"}, "c"},
+		{[]string{"RPOP", "list"}, "b"},
+		{[]string{"LLEN", "list"}, ":1"},
+		{[]string{"SADD", "set", "a", "b", "a"}, ":2"},
+		{[]string{"SADD", "set", "b", "c"}, ":1"},
+		{[]string{"SISMEMBER", "set", "c"}, ":1"},
+		{[]string{"SREM", "set", "a", "d"}, ":1"},
+		{[]string{"SCARD", "set"}, ":2"},
+		{[]string{"ZADD", "zset", "2", "b", "1", "a", "3", "c"}, ":3"},
+		{[]string{"ZSCORE", "zset", "b"}, "2"},
+		{[]string{"ZRANGE", "zset", "0", "1", "WITHSCORES"}, "[a 1 b 2]"},
+		{[]string{"ZREM", "zset", "a"}, ":1"},
+		{[]string{"ZCARD", "zset"}, ":2"},
+		{[]string{"ZRANGE", "zset", "-1", "-1"}, "[c]"},
+		{[]string{"SELECT", "1"}, "+OK"},
+		{[]string{"GET", "k2"}, "(nil)"},
+		{[]string{"GET"}, "-ERR wrong number of arguments for 'get' command"},
+		{[]string{"NOPE"}, "-ERR unknown command 'NOPE'"},
+		{[]string{"QUIT"}, "+OK"},
+	}
+
+	for _, c := range cases {
+		if got := tc.do(c.args...); got != c.want {
+			t.Errorf("%v: got %q want %q", c.args, got, c.want)
+		}
+	}
+
+	if err := srv.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != ErrServerClosed {
+		t.Errorf("err Serve, got %v want %v", err, ErrServerClosed)
+	}
+}
+
+func TestRespReader_Limits(t *testing.T) {
+	big := strings.Repeat("x", 2*bulkChunkSize)
+
+	cases := []struct {
+		req     string
+		want    string
+		wantErr error
+	}{
+		{"*4611686018427387904\r\n", "", ErrProtocol},
+		{"*" + strconv.Itoa(maxArgs+1) + "\r\n", "", ErrProtocol},
+		{"*1\r\n$" + strconv.Itoa(maxBulkSize+1) + "\r\n", "", ErrProtocol},
+		// the size of the bulk string is not allocated before its data is read.
+		{"*1\r\n$" + strconv.Itoa(maxBulkSize) + "\r\nabc", "", io.ErrUnexpectedEOF},
+		{"*1\r\n$" + strconv.Itoa(len(big)) + "\r\n" + big + "\r\n", big, nil},
+	}
+
+	for i, c := range cases {
+		args, err := newRespReader(strings.NewReader(c.req)).readCommand()
+		if err != c.wantErr {
+			t.Errorf("case %d: err readCommand, got %v want %v", i, err, c.wantErr)
+			continue
+		}
+		if err == nil && (len(args) != 1 || string(args[0]) != c.want) {
+			t.Errorf("case %d: err args, got %d args", i, len(args))
+		}
+	}
+}
@@ -0,0 +1,340 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"errors"
+)
+
+// ErrSnapshotTxNotSupported is returned when beginning a snapshot tx in HintBPTSparseIdxMode.
+var ErrSnapshotTxNotSupported = errors.New("snapshot tx not support mode `HintBPTSparseIdxMode`")
+
+// SnapshotTx represents a read-only transaction reading the key/value pairs
+// as they were committed when it began.
+// Unlike a read-only Tx, it does not hold the read lock of the database between
+// the reads, so the read/write transactions can make progress during a long scan.
+// The older versions of the keys it reads are kept until it is closed.
+type SnapshotTx struct {
+	tx *Tx
+}
+
+// mergedFile records a merged data file which is removed when the snapshot txs reading it are closed.
+type mergedFile struct {
+	fID int64
+	seq uint64 // the commit sequence when the data file is merged
+}
+
+// BeginSnapshotTx opens a new snapshot transaction, it must be closed by calling Close when done.
+func (db *DB) BeginSnapshotTx() (*SnapshotTx, error) {
+	if db.opt.EntryIdxMode == HintBPTSparseIdxMode {
+		return nil, ErrSnapshotTxNotSupported
+	}
+
+	tx, err := newTx(db, false)
+	if err != nil {
+		return nil, err
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, ErrDBClosed
+	}
+
+	tx.isSnapshot = true
+	tx.snapshotSeq = db.commitSeq
+
+	db.snapMu.Lock()
+	db.snapshotSeqs[tx.snapshotSeq]++
+	db.snapMu.Unlock()
+
+	return &SnapshotTx{tx: tx}, nil
+}
+
+// ViewSnapshot executes a function within a managed snapshot transaction.
+func (db *DB) ViewSnapshot(fn func(stx *SnapshotTx) error) error {
+	if fn == nil {
+		return ErrFn
+	}
+
+	stx, err := db.BeginSnapshotTx()
+	if err != nil {
+		return err
+	}
+	defer stx.Close()
+
+	return fn(stx)
+}
+
+// Close closes the snapshot transaction and releases the older versions kept for it.
+func (stx *SnapshotTx) Close() error {
+	db := stx.tx.db
+	if db == nil {
+		return ErrTxClosed
+	}
+
+	stx.tx.db = nil
+
+	db.snapMu.Lock()
+	if db.snapshotSeqs[stx.tx.snapshotSeq]--; db.snapshotSeqs[stx.tx.snapshotSeq] <= 0 {
+		delete(db.snapshotSeqs, stx.tx.snapshotSeq)
+	}
+	files := db.releasedMergedFiles()
+	db.snapMu.Unlock()
+
+	return db.removeDataFiles(files)
+}
+
+// view runs fn on the inner tx holding the read lock of the database.
+func (stx *SnapshotTx) view(fn func(tx *Tx) error) error {
+	db := stx.tx.db
+	if db == nil {
+		return ErrTxClosed
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return ErrDBClosed
+	}
+
+	return fn(stx.tx)
+}
+
+// Get retrieves the value for a key in the bucket, see Tx.Get.
+func (stx *SnapshotTx) Get(bucket string, key []byte) (e *Entry, err error) {
+	err = stx.view(func(tx *Tx) error {
+		e, err = tx.Get(bucket, key)
+		return err
+	})
+
+	return
+}
+
+// GetMulti retrieves the values for the keys in the bucket, see Tx.GetMulti.
+func (stx *SnapshotTx) GetMulti(bucket string, keys [][]byte) (es Entries, err error) {
+	err = stx.view(func(tx *Tx) error {
+		es, err = tx.GetMulti(bucket, keys)
+		return err
+	})
+
+	return
+}
+
+// GetAll returns all keys and values of the bucket, see Tx.GetAll.
+func (stx *SnapshotTx) GetAll(bucket string) (entries Entries, err error) {
+	err = stx.view(func(tx *Tx) error {
+		entries, err = tx.GetAll(bucket)
+		return err
+	})
+
+	return
+}
+
+// RangeScan queries a range at given bucket, start and end slice, see Tx.RangeScan.
+func (stx *SnapshotTx) RangeScan(bucket string, start, end []byte) (es Entries, err error) {
+	err = stx.view(func(tx *Tx) error {
+		es, err = tx.RangeScan(bucket, start, end)
+		return err
+	})
+
+	return
+}
+
+// RangeScanReverse queries a range in descending order of the keys, see Tx.RangeScanReverse.
+func (stx *SnapshotTx) RangeScanReverse(bucket string, start, end []byte) (es Entries, err error) {
+	err = stx.view(func(tx *Tx) error {
+		es, err = tx.RangeScanReverse(bucket, start, end)
+		return err
+	})
+
+	return
+}
+
+// RangeScanKeys queries the keys in a range without reading the values, see Tx.RangeScanKeys.
+func (stx *SnapshotTx) RangeScanKeys(bucket string, start, end []byte) (keys [][]byte, err error) {
+	err = stx.view(func(tx *Tx) error {
+		keys, err = tx.RangeScanKeys(bucket, start, end)
+		return err
+	})
+
+	return
+}
+
+// PrefixScan iterates over a key prefix at given bucket, prefix and limitNum, see Tx.PrefixScan.
+func (stx *SnapshotTx) PrefixScan(bucket string, prefix []byte, offsetNum int, limitNum int) (es Entries, off int, err error) {
+	err = stx.view(func(tx *Tx) error {
+		es, off, err = tx.PrefixScan(bucket, prefix, offsetNum, limitNum)
+		return err
+	})
+
+	return
+}
+
+// PrefixScanKeys iterates over the keys with a prefix without reading the values, see Tx.PrefixScanKeys.
+func (stx *SnapshotTx) PrefixScanKeys(bucket string, prefix []byte, offsetNum int, limitNum int) (keys [][]byte, off int, err error) {
+	err = stx.view(func(tx *Tx) error {
+		keys, off, err = tx.PrefixScanKeys(bucket, prefix, offsetNum, limitNum)
+		return err
+	})
+
+	return
+}
+
+// PrefixScanCursor iterates over a key prefix after the cursor of the previous page, see Tx.PrefixScanCursor.
+func (stx *SnapshotTx) PrefixScanCursor(bucket string, prefix []byte, cursor string, limitNum int) (es Entries, next string, err error) {
+	err = stx.view(func(tx *Tx) error {
+		es, next, err = tx.PrefixScanCursor(bucket, prefix, cursor, limitNum)
+		return err
+	})
+
+	return
+}
+
+// PrefixScanReverse iterates over a key prefix in descending order of the keys, see Tx.PrefixScanReverse.
+func (stx *SnapshotTx) PrefixScanReverse(bucket string, prefix []byte, offsetNum int, limitNum int) (es Entries, off int, err error) {
+	err = stx.view(func(tx *Tx) error {
+		es, off, err = tx.PrefixScanReverse(bucket, prefix, offsetNum, limitNum)
+		return err
+	})
+
+	return
+}
+
+// PrefixSearchScan iterates over a key prefix and matches the regular expression, see Tx.PrefixSearchScan.
+func (stx *SnapshotTx) PrefixSearchScan(bucket string, prefix []byte, reg string, offsetNum int, limitNum int) (es Entries, off int, err error) {
+	err = stx.view(func(tx *Tx) error {
+		es, off, err = tx.PrefixSearchScan(bucket, prefix, reg, offsetNum, limitNum)
+		return err
+	})
+
+	return
+}
+
+// keptVersions returns the versions in the chain from old that are visible to
+// the open snapshot txs, the others are dropped. newer is the version replacing old.
+func (db *DB) keptVersions(old *Record, newer uint64) *Record {
+	db.snapMu.Lock()
+	defer db.snapMu.Unlock()
+
+	if len(db.snapshotSeqs) == 0 {
+		return nil
+	}
+
+	var head, tail *Record
+
+	for r := old; r != nil; {
+		prev := r.prev
+
+		// r is visible to the snapshot txs in [r.version, newer).
+		if db.hasSnapshotIn(r.version, newer) {
+			if head == nil {
+				head = r
+			} else {
+				tail.prev = r
+			}
+			tail = r
+		}
+
+		newer = r.version
+		r = prev
+	}
+
+	if tail != nil {
+		tail.prev = nil
+	}
+
+	return head
+}
+
+// hasSnapshotIn checks if there is an open snapshot tx with the commit sequence in [from, to),
+// the caller must hold db.snapMu.
+func (db *DB) hasSnapshotIn(from, to uint64) bool {
+	for seq := range db.snapshotSeqs {
+		if seq >= from && seq < to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// removeMergedFile removes the merged data file at given fID, or defers it
+// until the snapshot txs which may read it are closed.
+func (db *DB) removeMergedFile(fID int64) error {
+	db.mu.RLock()
+	seq := db.commitSeq
+	db.mu.RUnlock()
+
+	db.snapMu.Lock()
+	if db.hasSnapshotIn(0, seq) {
+		db.mergedFiles = append(db.mergedFiles, mergedFile{fID: fID, seq: seq})
+		db.snapMu.Unlock()
+		return nil
+	}
+	db.snapMu.Unlock()
+
+	return db.removeDataFiles([]int64{fID})
+}
+
+// releasedMergedFiles returns and forgets the merged data files which no open
+// snapshot tx may read, the caller must hold db.snapMu.
+func (db *DB) releasedMergedFiles() (fIDs []int64) {
+	kept := db.mergedFiles[:0]
+
+	for _, f := range db.mergedFiles {
+		if db.hasSnapshotIn(0, f.seq) {
+			kept = append(kept, f)
+		} else {
+			fIDs = append(fIDs, f.fID)
+		}
+	}
+
+	db.mergedFiles = kept
+
+	return
+}
+
+// isMergedFile checks if the data file at given fID is merged and waiting to be removed.
+func (db *DB) isMergedFile(fID int64) bool {
+	db.snapMu.Lock()
+	defer db.snapMu.Unlock()
+
+	for _, f := range db.mergedFiles {
+		if f.fID == fID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// removeDataFiles closes and removes the data files at given fIDs, or keeps them for reuse
+// with RecycleSegments.
+func (db *DB) removeDataFiles(fIDs []int64) error {
+	for _, fID := range fIDs {
+		db.fileCache.remove(fID)
+		if err := db.recycleDataFile(db.getDataPath(fID)); err != nil {
+			return err
+		}
+		if err := db.removeOverflowFile(fID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
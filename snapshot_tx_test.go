@@ -0,0 +1,136 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"testing"
+
+	"github.com/xujiajun/utils/filesystem"
+)
+
+func TestSnapshotTx(t *testing.T) {
+	for _, mode := range []EntryIdxMode{HintKeyValAndRAMIdxMode, HintKeyAndRAMIdxMode} {
+		InitOpt("/tmp/nutsdbtestforsnapshottx", true)
+		opt.EntryIdxMode = mode
+		opt.SegmentSize = 1024
+		db, err = Open(opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bucket := "bucket_for_snapshot_tx"
+		if err := db.Batch([]BatchEntry{
+			{Bucket: bucket, Key: []byte("key_1"), Value: []byte("val_1")},
+			{Bucket: bucket, Key: []byte("key_2"), Value: []byte("val_2")},
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		stx, err := db.BeginSnapshotTx()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the writes are not blocked by the open snapshot tx.
+		for i := 0; i < 20; i++ {
+			if err := db.Update(func(tx *Tx) error {
+				if err := tx.Put(bucket, []byte("key_1"), []byte("val_1_new"), Persistent); err != nil {
+					return err
+				}
+				if err := tx.Delete(bucket, []byte("key_2")); err != nil {
+					return err
+				}
+				return tx.Put(bucket, []byte("key_3"), []byte("val_3"), Persistent)
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := db.Merge(); err != nil {
+			t.Fatal(err)
+		}
+		if !filesystem.PathIsExist(db.getDataPath(0)) {
+			t.Error("err snapshot tx, the merged data file read by the snapshot tx is removed")
+		}
+
+		if e, err := stx.Get(bucket, []byte("key_1")); err != nil || string(e.Value) != "val_1" {
+			t.Errorf("err snapshot tx Get, got %v %v", e, err)
+		}
+		if e, err := stx.Get(bucket, []byte("key_2")); err != nil || string(e.Value) != "val_2" {
+			t.Errorf("err snapshot tx Get, got %v %v", e, err)
+		}
+		if _, err := stx.Get(bucket, []byte("key_3")); err == nil {
+			t.Error("err snapshot tx Get, read a key put after the snapshot")
+		}
+
+		es, err := stx.RangeScan(bucket, []byte("key_0"), []byte("key_9"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(es) != 2 || string(es[0].Value) != "val_1" || string(es[1].Value) != "val_2" {
+			t.Errorf("err snapshot tx RangeScan, got %d entries", len(es))
+		}
+
+		if err := db.View(func(tx *Tx) error {
+			es, err := tx.RangeScan(bucket, []byte("key_0"), []byte("key_9"))
+			if err != nil {
+				return err
+			}
+			if len(es) != 2 || string(es[0].Value) != "val_1_new" || string(es[1].Value) != "val_3" {
+				t.Errorf("err RangeScan, got %d entries", len(es))
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := stx.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if filesystem.PathIsExist(db.getDataPath(0)) {
+			t.Error("err snapshot tx, the merged data file is not removed after closing the snapshot tx")
+		}
+		if _, err := stx.Get(bucket, []byte("key_1")); err != ErrTxClosed {
+			t.Errorf("err snapshot tx Get, got %v want %v", err, ErrTxClosed)
+		}
+
+		// the older versions are dropped without open snapshot txs.
+		if err := db.Update(func(tx *Tx) error {
+			return tx.Put(bucket, []byte("key_1"), []byte("val_1_newer"), Persistent)
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if r, err := db.BPTreeIdx[bucket].Find([]byte("key_1")); err != nil || r.prev != nil {
+			t.Error("err snapshot tx, the older versions are not dropped")
+		}
+
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSnapshotTx_NotSupported(t *testing.T) {
+	InitForBPTSparseIdxMode()
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err := db.BeginSnapshotTx(); err != ErrSnapshotTxNotSupported {
+		t.Errorf("err BeginSnapshotTx, got %v want %v", err, ErrSnapshotTxNotSupported)
+	}
+}
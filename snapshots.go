@@ -0,0 +1,244 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrSnapshotExists is returned when taking a snapshot with the name of an existing one.
+	ErrSnapshotExists = errors.New("snapshot already exists")
+
+	// ErrSnapshotNotFound is returned when the snapshot at given name does not exist.
+	ErrSnapshotNotFound = errors.New("snapshot not found")
+
+	// ErrInvalidSnapshotName is returned when the name of a snapshot is empty,
+	// starts with a dot or contains a slash.
+	ErrInvalidSnapshotName = errors.New("invalid snapshot name")
+)
+
+const (
+	// snapshotsDir is the directory of the snapshots in the dir of the database.
+	snapshotsDir = "snapshots"
+
+	// snapshotInfoFile is the file recording the time a snapshot is taken.
+	snapshotInfoFile = "SNAPSHOT"
+)
+
+// SnapshotInfo represents a snapshot of the database taken by Snapshot.
+type SnapshotInfo struct {
+	Name    string
+	Created time.Time
+	Dir     string
+}
+
+// Snapshot takes a point-in-time snapshot of the database with the given name, which can be
+// opened later by OpenSnapshot. The sealed data files are hard linked into the snapshot when
+// the file system supports it, so that a snapshot is cheap, the other files are copied.
+// Like Backup, the writes are only blocked while taking the files.
+func (db *DB) Snapshot(name string) error {
+	if err := checkSnapshotName(name); err != nil {
+		return err
+	}
+
+	if db.readOnly {
+		return ErrDBReadOnly
+	}
+
+	dir := db.getSnapshotPath(name)
+	if _, err := os.Stat(dir); err == nil {
+		return ErrSnapshotExists
+	}
+
+	files, err := db.snapshotFiles()
+	if err != nil {
+		return err
+	}
+	defer closeBackupFiles(files)
+
+	// the snapshot is written to a temporary dir first, so that it is complete once it is listed.
+	tmpDir := db.getSnapshotsPath() + "/." + name + ".tmp"
+	if err := os.RemoveAll(tmpDir); err != nil {
+		return err
+	}
+
+	for _, bf := range files {
+		if bf.link && linkBackupFile(db.opt.Dir+"/"+bf.name, tmpDir+"/"+bf.name) == nil {
+			continue
+		}
+		if err := writeBackupFile(tmpDir, bf.name, bf.mode, bf.reader()); err != nil {
+			os.RemoveAll(tmpDir)
+			return err
+		}
+	}
+
+	created := []byte(time.Now().UTC().Format(time.RFC3339Nano))
+	if err := ioutil.WriteFile(tmpDir+"/"+snapshotInfoFile, created, 0644); err != nil {
+		os.RemoveAll(tmpDir)
+		return err
+	}
+
+	if err := os.Rename(tmpDir, dir); err != nil {
+		os.RemoveAll(tmpDir)
+		return err
+	}
+
+	return nil
+}
+
+// linkBackupFile hard links the file at given src to dst.
+func linkBackupFile(src, dst string) error {
+	if err := os.MkdirAll(path.Dir(dst), os.ModePerm); err != nil {
+		return err
+	}
+
+	return os.Link(src, dst)
+}
+
+// Snapshots returns the snapshots of the database, the oldest first.
+func (db *DB) Snapshots() ([]SnapshotInfo, error) {
+	infos, err := ioutil.ReadDir(db.getSnapshotsPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []SnapshotInfo
+	for _, info := range infos {
+		if !info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+			continue
+		}
+
+		s, err := db.snapshotInfo(info.Name())
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, s)
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Created.Before(snapshots[j].Created)
+	})
+
+	return snapshots, nil
+}
+
+// snapshotInfo returns the snapshot at given name.
+func (db *DB) snapshotInfo(name string) (SnapshotInfo, error) {
+	dir := db.getSnapshotPath(name)
+
+	data, err := ioutil.ReadFile(dir + "/" + snapshotInfoFile)
+	if os.IsNotExist(err) {
+		return SnapshotInfo{}, ErrSnapshotNotFound
+	}
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+
+	created, err := time.Parse(time.RFC3339Nano, string(data))
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+
+	return SnapshotInfo{Name: name, Created: created, Dir: dir}, nil
+}
+
+// DeleteSnapshot removes the snapshot at given name.
+func (db *DB) DeleteSnapshot(name string) error {
+	if err := checkSnapshotName(name); err != nil {
+		return err
+	}
+
+	if _, err := db.snapshotInfo(name); err != nil {
+		return err
+	}
+
+	return os.RemoveAll(db.getSnapshotPath(name))
+}
+
+// PruneSnapshots removes the snapshots older than maxAge and the oldest ones beyond the keep
+// newest, and returns the names of the removed snapshots. A keep or maxAge of 0 means no limit.
+func (db *DB) PruneSnapshots(keep int, maxAge time.Duration) ([]string, error) {
+	snapshots, err := db.Snapshots()
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	for i, s := range snapshots {
+		tooMany := keep > 0 && len(snapshots)-i > keep
+		tooOld := maxAge > 0 && time.Since(s.Created) > maxAge
+		if !tooMany && !tooOld {
+			continue
+		}
+
+		if err := os.RemoveAll(s.Dir); err != nil {
+			return removed, err
+		}
+		removed = append(removed, s.Name)
+	}
+
+	return removed, nil
+}
+
+// OpenSnapshot opens the snapshot at given name of the database in opt.Dir read-only:
+// the read/write transactions, the merges and the checkpoints return ErrDBReadOnly.
+// The background workers are disabled.
+func OpenSnapshot(opt Options, name string) (*DB, error) {
+	if err := checkSnapshotName(name); err != nil {
+		return nil, err
+	}
+
+	dir := opt.Dir + "/" + snapshotsDir + "/" + name
+	if _, err := os.Stat(dir + "/" + snapshotInfoFile); err != nil {
+		return nil, ErrSnapshotNotFound
+	}
+
+	opt.Dir = dir
+	opt.ReadOnly = true
+
+	return Open(opt)
+}
+
+// hasSnapshots returns if the database has a snapshot, which may link its data files.
+func (db *DB) hasSnapshots() bool {
+	infos, err := ioutil.ReadDir(db.getSnapshotsPath())
+	return err == nil && len(infos) > 0
+}
+
+func checkSnapshotName(name string) error {
+	if name == "" || strings.HasPrefix(name, ".") || strings.Contains(name, "/") {
+		return ErrInvalidSnapshotName
+	}
+
+	return nil
+}
+
+func (db *DB) getSnapshotsPath() string {
+	return db.opt.Dir + "/" + snapshotsDir
+}
+
+func (db *DB) getSnapshotPath(name string) string {
+	return db.getSnapshotsPath() + "/" + name
+}
@@ -0,0 +1,124 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDB_Snapshot(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestsnapshots", true)
+	opt.SegmentSize = 256
+
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	bucket := "bucket_snapshots"
+	putSegmentKeys(t, bucket, 0, 10)
+
+	if err := db.Snapshot("s1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Snapshot("s1"); err != ErrSnapshotExists {
+		t.Errorf("err snapshot, got %v want %v", err, ErrSnapshotExists)
+	}
+	for _, name := range []string{"", ".s", "a/b"} {
+		if err := db.Snapshot(name); err != ErrInvalidSnapshotName {
+			t.Errorf("err snapshot %q, got %v want %v", name, err, ErrInvalidSnapshotName)
+		}
+	}
+
+	// the sealed data files are linked.
+	orig, err := os.Stat(db.getDataPath(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	linked, err := os.Stat(db.getSnapshotPath("s1") + "/0" + DataSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(orig, linked) {
+		t.Error("err snapshot, the sealed data file is not linked")
+	}
+
+	putSegmentKeys(t, bucket, 10, 20)
+	if err := db.Snapshot("s2"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the snapshot sees the database as it was taken, read-only.
+	sdb, err := OpenSnapshot(opt, "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sdb.View(func(tx *Tx) error {
+		e, err := tx.Get(bucket, []byte("hello"))
+		if err != nil {
+			return err
+		}
+		if string(e.Value) != "world9" {
+			t.Errorf("err snapshot get, got %s want %s", e.Value, "world9")
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sdb.Update(func(tx *Tx) error { return nil }); err != ErrDBReadOnly {
+		t.Errorf("err snapshot update, got %v want %v", err, ErrDBReadOnly)
+	}
+	if err := sdb.Merge(); err != ErrDBReadOnly {
+		t.Errorf("err snapshot merge, got %v want %v", err, ErrDBReadOnly)
+	}
+	sdb.Close()
+
+	if _, err := OpenSnapshot(opt, "s3"); err != ErrSnapshotNotFound {
+		t.Errorf("err open snapshot, got %v want %v", err, ErrSnapshotNotFound)
+	}
+
+	snapshots, err := db.Snapshots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 2 || snapshots[0].Name != "s1" || snapshots[1].Name != "s2" {
+		t.Fatalf("err snapshots, got %+v", snapshots)
+	}
+
+	removed, err := db.PruneSnapshots(1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 || removed[0] != "s1" {
+		t.Errorf("err prune snapshots, got %v", removed)
+	}
+
+	if removed, err = db.PruneSnapshots(0, time.Hour); err != nil || len(removed) != 0 {
+		t.Errorf("err prune snapshots, got %v, %v", removed, err)
+	}
+
+	if err := db.DeleteSnapshot("s2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DeleteSnapshot("s2"); err != ErrSnapshotNotFound {
+		t.Errorf("err delete snapshot, got %v want %v", err, ErrSnapshotNotFound)
+	}
+	if snapshots, err = db.Snapshots(); err != nil || len(snapshots) != 0 {
+		t.Errorf("err snapshots, got %+v, %v", snapshots, err)
+	}
+}
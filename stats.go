@@ -0,0 +1,222 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"expvar"
+	"sync/atomic"
+	"time"
+)
+
+// Stats records the statistics of the db.
+type Stats struct {
+	// KeyCount represents the number of live keys in all the buckets, see BucketStats.
+	KeyCount int
+
+	// EntryCount represents the number of entries in the data files counted by the index,
+	// including the deleted, expired and overwritten ones.
+	EntryCount int
+
+	// DirtyRatio represents the approximate ratio of the dead entries (deleted, expired
+	// or overwritten) to all the entries, as checked by the merge worker.
+	// It is not counted in HintBPTSparseIdxMode.
+	DirtyRatio float64
+
+	// DataFileCount represents the number of data files.
+	DataFileCount int
+
+	// DiskBytes represents the size of the data files.
+	DiskBytes int64
+
+	// Buckets represents the statistics of the buckets with live or expired keys.
+	Buckets map[string]*BucketStats
+
+	TxStats
+
+	MergeStats
+
+	MemoryStats
+}
+
+// TxStats records the counters of the transactions since the db is opened.
+type TxStats struct {
+	// ReadTxs represents the number of closed read-only txs.
+	ReadTxs uint64
+
+	// Commits represents the number of committed read/write txs.
+	Commits uint64
+
+	// Rollbacks represents the number of rolled back read/write txs.
+	Rollbacks uint64
+
+	// WrittenEntries represents the number of entries written by the commits.
+	WrittenEntries uint64
+
+	// WrittenBytes represents the number of bytes written to the data files by the commits.
+	WrittenBytes uint64
+
+	// ReadTxTime represents the total time of the read-only txs, from Begin to their end.
+	ReadTxTime time.Duration
+
+	// CommitTime represents the total time spent in committing the read/write txs.
+	CommitTime time.Duration
+
+	// EvictedKeys represents the number of keys deleted by the eviction policies, see BucketEviction.
+	EvictedKeys uint64
+
+	// StalledCommits represents the number of commits stalled by MaxPendingCommitBytes.
+	StalledCommits uint64
+}
+
+// MetricsCollector receives the metrics of the transactions as they happen, e.g. to feed
+// the histograms of a metrics system such as prometheus. It is called with the db locked,
+// so it must be fast and must not use the db.
+type MetricsCollector interface {
+	// ObserveReadTx is called when a read-only tx ends.
+	ObserveReadTx(d time.Duration)
+
+	// ObserveCommit is called when a read/write tx is committed,
+	// with the number of entries and bytes written.
+	ObserveCommit(entries int, bytes int64, d time.Duration)
+
+	// ObserveRollback is called when a read/write tx is rolled back.
+	ObserveRollback()
+}
+
+// txMetrics records the counters of TxStats, they are updated atomically
+// since the read-only txs end concurrently.
+type txMetrics struct {
+	readTxs        uint64
+	commits        uint64
+	rollbacks      uint64
+	writtenEntries uint64
+	writtenBytes   uint64
+	readTxNanos    uint64
+	commitNanos    uint64
+	evictedKeys    uint64
+	stalledCommits uint64
+
+	// the counters of MergeStats.
+	mergedFiles        uint64
+	reclaimedBytes     uint64
+	droppedTombstones  uint64
+	droppedExpired     uint64
+	retainedTombstones uint64
+	retainedExpired    uint64
+}
+
+func (db *DB) observeReadTx(d time.Duration) {
+	atomic.AddUint64(&db.metrics.readTxs, 1)
+	atomic.AddUint64(&db.metrics.readTxNanos, uint64(d))
+
+	if db.opt.Metrics != nil {
+		db.opt.Metrics.ObserveReadTx(d)
+	}
+}
+
+func (db *DB) observeCommit(entries int, bytes int64, d time.Duration) {
+	atomic.AddUint64(&db.metrics.commits, 1)
+	atomic.AddUint64(&db.metrics.writtenEntries, uint64(entries))
+	atomic.AddUint64(&db.metrics.writtenBytes, uint64(bytes))
+	atomic.AddUint64(&db.metrics.commitNanos, uint64(d))
+
+	if db.opt.Metrics != nil {
+		db.opt.Metrics.ObserveCommit(entries, bytes, d)
+	}
+}
+
+func (db *DB) observeRollback() {
+	atomic.AddUint64(&db.metrics.rollbacks, 1)
+
+	if db.opt.Metrics != nil {
+		db.opt.Metrics.ObserveRollback()
+	}
+}
+
+// txStats returns a snapshot of the tx counters.
+func (db *DB) txStats() TxStats {
+	return TxStats{
+		ReadTxs:        atomic.LoadUint64(&db.metrics.readTxs),
+		Commits:        atomic.LoadUint64(&db.metrics.commits),
+		Rollbacks:      atomic.LoadUint64(&db.metrics.rollbacks),
+		WrittenEntries: atomic.LoadUint64(&db.metrics.writtenEntries),
+		WrittenBytes:   atomic.LoadUint64(&db.metrics.writtenBytes),
+		ReadTxTime:     time.Duration(atomic.LoadUint64(&db.metrics.readTxNanos)),
+		CommitTime:     time.Duration(atomic.LoadUint64(&db.metrics.commitNanos)),
+		EvictedKeys:    atomic.LoadUint64(&db.metrics.evictedKeys),
+		StalledCommits: atomic.LoadUint64(&db.metrics.stalledCommits),
+	}
+}
+
+// Stats returns a snapshot of the statistics of the db.
+func (db *DB) Stats() (stats *Stats, err error) {
+	stats = &Stats{Buckets: make(map[string]*BucketStats)}
+
+	err = db.View(func(tx *Tx) error {
+		for bucket := range tx.bucketNames() {
+			bs, err := tx.bucketStats(bucket)
+			if err != nil {
+				return err
+			}
+
+			if bs.KeyCount == 0 && bs.ExpiredCount == 0 {
+				continue
+			}
+
+			stats.KeyCount += bs.KeyCount
+			stats.Buckets[bucket] = bs
+		}
+
+		stats.EntryCount = db.KeyCount
+		stats.MemoryStats = db.memoryStats()
+		if db.opt.EntryIdxMode != HintBPTSparseIdxMode {
+			stats.DirtyRatio = db.getDirtyRatio()
+		}
+
+		_, dataFileIds := db.getMaxFileIDAndFileIDs()
+		stats.DataFileCount = len(dataFileIds)
+		for _, fID := range dataFileIds {
+			if size, err := db.backend().Size(db.getDataPath(int64(fID))); err == nil {
+				stats.DiskBytes += size
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	// the counters are read after the View so that it is counted.
+	stats.TxStats = db.txStats()
+	stats.MergeStats = db.mergeStats()
+
+	return stats, nil
+}
+
+// PublishExpvar publishes the Stats of the db as the expvar variable at given name,
+// it is computed each time the variable is read, e.g. from /debug/vars.
+// Like expvar.Publish, it panics if the name is already published.
+func (db *DB) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		stats, err := db.Stats()
+		if err != nil {
+			return err.Error()
+		}
+
+		return stats
+	}))
+}
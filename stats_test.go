@@ -0,0 +1,99 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"errors"
+	"expvar"
+	"strings"
+	"testing"
+	"time"
+)
+
+type countingCollector struct {
+	readTxs, commits, rollbacks, entries int
+}
+
+func (c *countingCollector) ObserveReadTx(d time.Duration) { c.readTxs++ }
+
+func (c *countingCollector) ObserveCommit(entries int, bytes int64, d time.Duration) {
+	c.commits++
+	c.entries += entries
+}
+
+func (c *countingCollector) ObserveRollback() { c.rollbacks++ }
+
+func TestDB_Stats(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestforstats", true)
+	collector := &countingCollector{}
+	opt.Metrics = collector
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Update(func(tx *Tx) error {
+		if err := tx.Put("bucket1", []byte("key_1"), []byte("val"), Persistent); err != nil {
+			return err
+		}
+		if err := tx.Put("bucket1", []byte("key_2"), []byte("val"), Persistent); err != nil {
+			return err
+		}
+		return tx.SAdd("bucket2", []byte("set"), []byte("a"), []byte("b"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Update(func(tx *Tx) error {
+		if err := tx.Delete("bucket1", []byte("key_2")); err != nil {
+			return err
+		}
+		return errors.New("rollback")
+	}); err == nil {
+		t.Fatal("err Update, want the rollback error")
+	}
+
+	if err := db.View(func(tx *Tx) error {
+		_, err := tx.Get("bucket1", []byte("key_1"))
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.KeyCount != 3 || len(stats.Buckets) != 2 || stats.Buckets["bucket1"].KeyCount != 2 {
+		t.Errorf("err Stats, got %+v", stats)
+	}
+	if stats.EntryCount != 4 || stats.DataFileCount != 1 || stats.DiskBytes != opt.SegmentSize {
+		t.Errorf("err Stats, got %+v", stats)
+	}
+	if stats.Commits != 1 || stats.Rollbacks != 1 || stats.ReadTxs != 2 || stats.WrittenEntries != 4 || stats.WrittenBytes == 0 {
+		t.Errorf("err Stats, got %+v", stats.TxStats)
+	}
+
+	if collector.commits != 1 || collector.rollbacks != 1 || collector.readTxs != 2 || collector.entries != 4 {
+		t.Errorf("err MetricsCollector, got %+v", collector)
+	}
+
+	db.PublishExpvar("nutsdbtestforstats")
+	if v := expvar.Get("nutsdbtestforstats"); v == nil || !strings.Contains(v.String(), `"KeyCount":3`) {
+		t.Errorf("err PublishExpvar, got %v", v)
+	}
+}
@@ -0,0 +1,228 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"sync"
+	"time"
+)
+
+type syncMode int
+
+const (
+	// syncDefault follows the SyncEnable option.
+	syncDefault syncMode = iota
+	syncAlways
+	syncNever
+	syncEveryN
+	syncInterval
+	syncGroup
+)
+
+// SyncPolicy represents when the commits are synced to the disk.
+type SyncPolicy struct {
+	mode     syncMode
+	n        int
+	interval time.Duration
+}
+
+var (
+	// SyncAlways syncs the data file on each commit, a committed tx is never lost.
+	SyncAlways = SyncPolicy{mode: syncAlways}
+
+	// SyncNever leaves the syncs to the operating system, except db.Sync, the commits
+	// of the last seconds may be lost on a machine crash.
+	SyncNever = SyncPolicy{mode: syncNever}
+)
+
+// SyncEveryN syncs the data file every n commits, up to n-1 commits may be lost on a machine crash.
+// SyncEveryN(1) is SyncAlways.
+func SyncEveryN(n int) SyncPolicy {
+	if n <= 1 {
+		return SyncAlways
+	}
+
+	return SyncPolicy{mode: syncEveryN, n: n}
+}
+
+// SyncInterval syncs the data file in the background every interval if there are new commits,
+// the commits of the last interval may be lost on a machine crash.
+func SyncInterval(interval time.Duration) SyncPolicy {
+	if interval <= 0 {
+		return SyncAlways
+	}
+
+	return SyncPolicy{mode: syncInterval, interval: interval}
+}
+
+// SyncGroup syncs the commits in groups: a commit returns once it is synced to the disk as with SyncAlways,
+// but the commits done within the window after the first unsynced one share a single sync, which raises
+// the commit throughput of the concurrent writers. A commit returns after a sync covering it and all the
+// commits before it, so a commit which returns is never lost. Each commit waits up to the window.
+func SyncGroup(window time.Duration) SyncPolicy {
+	if window <= 0 {
+		return SyncAlways
+	}
+
+	return SyncPolicy{mode: syncGroup, interval: window}
+}
+
+// syncPolicy returns the SyncPolicy option, or the one of the SyncEnable option if it is not set.
+func (opt *Options) syncPolicy() SyncPolicy {
+	if opt.SyncPolicy.mode != syncDefault {
+		return opt.SyncPolicy
+	}
+
+	if opt.SyncEnable {
+		return SyncAlways
+	}
+
+	return SyncNever
+}
+
+// syncEachWrite checks if the writes are synced as they are done.
+func (db *DB) syncEachWrite() bool {
+	return db.opt.syncPolicy().mode == syncAlways
+}
+
+// commitSynced is called with the db locked after each commit of written bytes, it syncs
+// the active file every n commits with SyncEveryN. With SyncGroup the commit waits for the
+// sync of its group by waitGroupSync, once the db is unlocked.
+func (db *DB) commitSynced(written int64) error {
+	policy := db.opt.syncPolicy()
+
+	if policy.mode != syncAlways {
+		db.unsyncedBytes += written
+	}
+
+	switch policy.mode {
+	case syncEveryN:
+		db.unsyncedCommits++
+		if db.unsyncedCommits >= policy.n {
+			return db.syncActiveFile()
+		}
+	case syncInterval, syncGroup:
+		db.unsyncedCommits++
+	}
+
+	return nil
+}
+
+// syncActiveFile syncs the active file, with the db locked.
+func (db *DB) syncActiveFile() error {
+	if err := db.ActiveFile.rwManager.Sync(); err != nil {
+		return err
+	}
+
+	db.unsyncedCommits = 0
+	db.unsyncedBytes = 0
+	db.syncedSeq = db.commitSeq
+
+	return nil
+}
+
+// Sync flushes the commits to the disk, whatever the SyncPolicy is.
+func (db *DB) Sync() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return ErrDBClosed
+	}
+
+	return db.syncActiveFile()
+}
+
+// runSyncWorker syncs the active file every interval of SyncInterval
+// if there are new commits, until the db is closed.
+func (db *DB) runSyncWorker(interval time.Duration) {
+	defer db.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-db.closeCh:
+			return
+		case <-ticker.C:
+			db.mu.Lock()
+			if db.unsyncedCommits > 0 {
+				_ = db.syncActiveFile()
+			}
+			db.mu.Unlock()
+		}
+	}
+}
+
+// groupSync elects the leader of each group of the commits waiting for a sync with SyncGroup.
+type groupSync struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	leading bool   // a leader is waiting for the window or syncing
+	synced  uint64 // the commit sequence synced by the last leader
+}
+
+func newGroupSync() *groupSync {
+	g := &groupSync{}
+	g.cond = sync.NewCond(&g.mu)
+	return g
+}
+
+// waitGroupSync waits until the commit of sequence seq is synced, without the db locked. The first
+// waiting commit leads the group: it waits for the window, then syncs the active file for the commits
+// written meanwhile, unless a sync since covers them, and wakes them up.
+func (db *DB) waitGroupSync(seq uint64, window time.Duration) error {
+	g := db.groupSync
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for g.synced < seq {
+		if g.leading {
+			g.cond.Wait()
+			continue
+		}
+
+		g.leading = true
+		g.mu.Unlock()
+
+		time.Sleep(window)
+
+		db.mu.Lock()
+		var err error
+		if db.closed {
+			// the active file is synced on close.
+			db.syncedSeq = db.commitSeq
+		} else if db.syncedSeq < db.commitSeq {
+			err = db.syncActiveFile()
+		}
+		synced := db.syncedSeq
+		db.mu.Unlock()
+
+		g.mu.Lock()
+		g.leading = false
+		if synced > g.synced {
+			g.synced = synced
+		}
+		g.cond.Broadcast()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,182 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDB_SyncPolicy(t *testing.T) {
+	tests := []struct {
+		name       string
+		syncEnable bool
+		policy     SyncPolicy
+		commits    int
+		want       int
+	}{
+		{"default", true, SyncPolicy{}, 3, 3},
+		{"default disabled", false, SyncPolicy{}, 3, 0},
+		{"always", false, SyncAlways, 3, 3},
+		{"never", true, SyncNever, 3, 0},
+		{"every n", true, SyncEveryN(2), 5, 2},
+	}
+
+	for _, tt := range tests {
+		InitOpt("/tmp/nutsdbtestforsyncpolicy", true)
+		opt.SyncEnable = tt.syncEnable
+		opt.SyncPolicy = tt.policy
+		db, err = Open(opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		m := &syncCountingRWManager{RWManager: db.ActiveFile.rwManager}
+		db.ActiveFile.rwManager = m
+
+		for i := 0; i < tt.commits; i++ {
+			if err := db.Update(func(tx *Tx) error {
+				return tx.Put("bucket", []byte(fmt.Sprintf("key_%d", i)), []byte("val"), Persistent)
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if syncs := m.syncs; syncs != tt.want {
+			t.Errorf("%s: err syncs, got %d want %d", tt.name, syncs, tt.want)
+		}
+
+		if err := db.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		if syncs := m.syncs; syncs != tt.want+1 {
+			t.Errorf("%s: err Sync, got %d want %d", tt.name, syncs, tt.want+1)
+		}
+
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := db.Sync(); err != ErrDBClosed {
+		t.Errorf("err Sync, got %v want %v", err, ErrDBClosed)
+	}
+}
+
+func TestDB_SyncInterval(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestforsyncinterval", true)
+	opt.SyncPolicy = SyncInterval(10 * time.Millisecond)
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	db.mu.Lock()
+	m := &syncCountingRWManager{RWManager: db.ActiveFile.rwManager}
+	db.ActiveFile.rwManager = m
+	db.mu.Unlock()
+
+	if err := db.Update(func(tx *Tx) error {
+		return tx.Put("bucket", []byte("key"), []byte("val"), Persistent)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the sync worker syncs with the db locked.
+	syncs := func() int {
+		db.mu.Lock()
+		defer db.mu.Unlock()
+		return m.syncs
+	}
+
+	if n := syncs(); n != 0 {
+		t.Errorf("err syncs on commit, got %d want 0", n)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for syncs() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if n := syncs(); n != 1 {
+		t.Errorf("err syncs by the sync worker, got %d want 1", n)
+	}
+}
+
+func TestDB_SyncGroup(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestforsyncgroup", true)
+	opt.SyncPolicy = SyncGroup(20 * time.Millisecond)
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db.mu.Lock()
+	m := &syncCountingRWManager{RWManager: db.ActiveFile.rwManager}
+	db.ActiveFile.rwManager = m
+	db.mu.Unlock()
+
+	const writers = 8
+
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		go func(i int) {
+			errs <- db.Update(func(tx *Tx) error {
+				return tx.Put("bucket", []byte(fmt.Sprintf("key_%d", i)), []byte("val"), Persistent)
+			})
+		}(i)
+	}
+
+	for i := 0; i < writers; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// each commit returns once it is synced, the concurrent ones share the syncs.
+	db.mu.Lock()
+	syncs, synced, seq := m.syncs, db.syncedSeq, db.commitSeq
+	db.mu.Unlock()
+
+	if syncs == 0 || syncs >= writers {
+		t.Errorf("err syncs of the group, got %d want 1 to %d", syncs, writers-1)
+	}
+	if synced != seq {
+		t.Errorf("err synced commits, got %d want %d", synced, seq)
+	}
+
+	// a single commit waits for the window and syncs alone.
+	if err := db.Update(func(tx *Tx) error {
+		return tx.Put("bucket", []byte("key"), []byte("val"), Persistent)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	db.mu.Lock()
+	if m.syncs != syncs+1 {
+		t.Errorf("err syncs of a single commit, got %d want %d", m.syncs, syncs+1)
+	}
+	db.mu.Unlock()
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if SyncGroup(0) != SyncAlways {
+		t.Error("err SyncGroup(0), want SyncAlways")
+	}
+}
@@ -0,0 +1,286 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ErrTenantQuota is returned by the writes which would exceed the quota of their tenant.
+var ErrTenantQuota = errors.New("the write exceeds the quota of the tenant")
+
+// TenantQuota represents the limits of the key/value pairs of the buckets of a tenant, the lists,
+// the sets and the sorted sets of the buckets are not counted. The expired keys count until they
+// are deleted.
+type TenantQuota struct {
+	// MaxKeys represents the maximum number of keys of the tenant, 0 means no limit.
+	MaxKeys int
+
+	// MaxBytes represents the maximum size of the entries of the keys of the tenant
+	// in the data files, 0 means no limit.
+	MaxBytes int64
+}
+
+// TenantStats records the statistics of a tenant.
+type TenantStats struct {
+	// BucketStats represents the statistics of the buckets of the tenant added up.
+	BucketStats
+
+	// Buckets represents the sorted names of the buckets of the tenant.
+	Buckets []string
+
+	// Quota represents the quota of the tenant, the zero quota if it has none.
+	Quota TenantQuota
+
+	// QuotaKeys and QuotaBytes represent the keys and the bytes counted against the quota,
+	// 0 if the tenant has no quota.
+	QuotaKeys  int
+	QuotaBytes int64
+}
+
+// tenantOf returns the tenant of the bucket, the name of the root of its bucket tree:
+// the buckets of the tenant "acme" are "acme" and its nested buckets "acme:...".
+func tenantOf(bucket string) string {
+	return strings.SplitN(bucket, BucketSeparator, 2)[0]
+}
+
+// tenantTracker records the keys of the tenants with a quota and the sizes of their entries.
+// The usage is read by the writes concurrently, so it has its own lock.
+type tenantTracker struct {
+	mu      sync.Mutex
+	tenants map[string]*tenantUsage
+}
+
+type tenantUsage struct {
+	quota TenantQuota
+	sizes map[string]int64 // the sizes of the entries of the keys, by bucket and key
+	bytes int64
+}
+
+// tenantKey returns the key of the sizes of the key of the bucket.
+func tenantKey(bucket string, key []byte) string {
+	return bucket + "\x00" + string(key)
+}
+
+// newTenantTracker returns the tracker of the tenants of TenantQuotas, with the live keys
+// of the index, or nil if there is no quota.
+func (db *DB) newTenantTracker() *tenantTracker {
+	if len(db.opt.TenantQuotas) == 0 || db.opt.EntryIdxMode == HintBPTSparseIdxMode {
+		return nil
+	}
+
+	t := &tenantTracker{tenants: make(map[string]*tenantUsage, len(db.opt.TenantQuotas))}
+	for tenant, quota := range db.opt.TenantQuotas {
+		t.tenants[tenant] = &tenantUsage{quota: quota, sizes: make(map[string]int64)}
+	}
+
+	for bucket, idx := range db.BPTreeIdx {
+		u, ok := t.tenants[tenantOf(bucket)]
+		if !ok {
+			continue
+		}
+
+		records, err := idx.All()
+		if err != nil {
+			continue
+		}
+
+		for _, r := range records {
+			if r.H.meta.Flag == DataDeleteFlag {
+				continue
+			}
+			size := recordSize(r)
+			u.sizes[tenantKey(bucket, r.H.key)] = size
+			u.bytes += size
+		}
+	}
+
+	return t
+}
+
+// apply records the committed entry of the bucket.
+func (t *tenantTracker) apply(bucket string, entry *Entry) {
+	if t == nil {
+		return
+	}
+
+	u, ok := t.tenants[tenantOf(bucket)]
+	if !ok {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := tenantKey(bucket, entry.Key)
+	u.bytes -= u.sizes[key]
+
+	if entry.Meta.Flag == DataDeleteFlag {
+		delete(u.sizes, key)
+		return
+	}
+
+	u.sizes[key] = entry.Size()
+	u.bytes += entry.Size()
+}
+
+// usage returns the keys and the bytes of the tenant counted against its quota.
+func (t *tenantTracker) usage(tenant string) (int, int64) {
+	if t == nil {
+		return 0, 0
+	}
+
+	u, ok := t.tenants[tenant]
+	if !ok {
+		return 0, 0
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return len(u.sizes), u.bytes
+}
+
+// tenantPending is the change of the usage of a tenant by the pending writes of a tx.
+type tenantPending struct {
+	keys  int
+	bytes int64
+}
+
+// change returns the change of the usage by the write e of the key of the bucket, after its pending
+// write prev, or after its committed entry if prev is nil.
+func (u *tenantUsage) change(bucket string, prev, e *Entry) (keys int, bytes int64) {
+	if prev != nil {
+		if prev.Meta.Flag != DataDeleteFlag {
+			keys--
+			bytes -= prev.Size()
+		}
+	} else if size, ok := u.sizes[tenantKey(bucket, e.Key)]; ok {
+		keys--
+		bytes -= size
+	}
+
+	if e.Meta.Flag != DataDeleteFlag {
+		keys++
+		bytes += e.Size()
+	}
+
+	return keys, bytes
+}
+
+// checkTenantQuota returns ErrTenantQuota if the commit of the pending writes of the tx and of the
+// entry e would exceed the quota of the tenant of the bucket, and records the usage of e otherwise.
+// The deletes are never limited.
+func (tx *Tx) checkTenantQuota(bucket string, e *Entry) error {
+	t := tx.db.tenants
+	if t == nil || e.Meta.ds != DataStructureBPTree || tx.isMerging || tx.isExpiring || tx.evicting {
+		return nil
+	}
+
+	tenant := tenantOf(bucket)
+	u, ok := t.tenants[tenant]
+	if !ok {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// the usage of the pending writes is counted again after a rollback to a savepoint.
+	if tx.tenantPending == nil {
+		tx.tenantPending = make(map[string]*tenantPending)
+		for b, writes := range tx.pendingKeys {
+			bu, ok := t.tenants[tenantOf(b)]
+			if !ok {
+				continue
+			}
+			p := tx.pendingUsage(tenantOf(b))
+			for _, w := range writes {
+				keys, bytes := bu.change(b, nil, w)
+				p.keys += keys
+				p.bytes += bytes
+			}
+		}
+	}
+
+	p := tx.pendingUsage(tenant)
+	keys, bytes := u.change(bucket, tx.pendingKeys[bucket][string(e.Key)], e)
+
+	q := u.quota
+	if e.Meta.Flag != DataDeleteFlag {
+		if q.MaxKeys > 0 && len(u.sizes)+p.keys+keys > q.MaxKeys || q.MaxBytes > 0 && u.bytes+p.bytes+bytes > q.MaxBytes {
+			return fmt.Errorf("%w: tenant %s", ErrTenantQuota, tenant)
+		}
+	}
+
+	p.keys += keys
+	p.bytes += bytes
+
+	return nil
+}
+
+// pendingUsage returns the usage of the tenant by the pending writes of the tx.
+func (tx *Tx) pendingUsage(tenant string) *tenantPending {
+	p, ok := tx.tenantPending[tenant]
+	if !ok {
+		p = &tenantPending{}
+		tx.tenantPending[tenant] = p
+	}
+
+	return p
+}
+
+// DropTenant removes all the keys of the buckets of the tenant, the bucket at given tenant and its
+// nested buckets, like DeleteBucketTree. They are removed atomically when the tx commits.
+func (tx *Tx) DropTenant(tenant string) error {
+	return tx.DeleteBucketTree(tenant)
+}
+
+// TenantStats returns the statistics of the tenant, with the usage of its quota.
+// It returns ErrBucketNotFound if the tenant has no key and no quota.
+func (db *DB) TenantStats(tenant string) (stats *TenantStats, err error) {
+	stats = &TenantStats{Quota: db.opt.TenantQuotas[tenant]}
+
+	err = db.View(func(tx *Tx) error {
+		stats.Buckets = tx.bucketTree(tenant)
+
+		for _, name := range stats.Buckets {
+			s, err := tx.bucketStats(name)
+			if err != nil {
+				return err
+			}
+
+			stats.KeyCount += s.KeyCount
+			stats.ExpiredCount += s.ExpiredCount
+			stats.DiskBytes += s.DiskBytes
+		}
+
+		stats.QuotaKeys, stats.QuotaBytes = db.tenants.usage(tenant)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := db.opt.TenantQuotas[tenant]; !ok && stats.KeyCount == 0 && stats.ExpiredCount == 0 {
+		return nil, ErrBucketNotFound
+	}
+
+	return stats, nil
+}
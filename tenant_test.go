@@ -0,0 +1,169 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestDB_TenantQuotas(t *testing.T) {
+	InitOpt("/tmp/nutsdbtesttenant", true)
+
+	// the entries of the bucket "globex:orders" with a 5-byte key and a 3-byte value.
+	size := int64(DataEntryHeaderSize + len("globex:orders") + 5 + 3)
+	opt.TenantQuotas = map[string]TenantQuota{
+		"acme":   {MaxKeys: 3},
+		"globex": {MaxBytes: 2 * size},
+	}
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	put := func(bucket string, keys ...string) error {
+		return db.Update(func(tx *Tx) error {
+			for _, key := range keys {
+				if err := tx.Put(bucket, []byte(key), []byte("val"), Persistent); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+
+	// the quota is shared by the buckets of the tenant, the pending writes of the tx included.
+	if err := put("acme:orders", "key_1", "key_2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := put("acme:users", "key_1", "key_2"); !errors.Is(err, ErrTenantQuota) {
+		t.Errorf("err put over the quota, got %v want %v", err, ErrTenantQuota)
+	}
+	if err := put("acme", "key_3"); err != nil {
+		t.Fatal(err)
+	}
+
+	// an overwrite and a delete do not add keys.
+	if err := put("acme:orders", "key_1"); err != nil {
+		t.Errorf("err overwrite, got %v", err)
+	}
+	if err := db.Update(func(tx *Tx) error {
+		if err := tx.Delete("acme:orders", []byte("key_1")); err != nil {
+			return err
+		}
+		return tx.Put("acme:users", []byte("key_4"), []byte("val"), Persistent)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := put("globex:orders", "key_1", "key_2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := put("globex:orders", "key_3"); !errors.Is(err, ErrTenantQuota) {
+		t.Errorf("err put over the bytes quota, got %v want %v", err, ErrTenantQuota)
+	}
+
+	// the other tenants have no quota.
+	if err := put("initech", "key_1", "key_2", "key_3", "key_4"); err != nil {
+		t.Fatal(err)
+	}
+
+	checkStats := func(tenant string, keys, quotaKeys int) {
+		t.Helper()
+
+		stats, err := db.TenantStats(tenant)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.KeyCount != keys || stats.QuotaKeys != quotaKeys {
+			t.Errorf("err TenantStats %s, got %+v want %d keys and %d quota keys", tenant, stats, keys, quotaKeys)
+		}
+	}
+	checkStats("acme", 3, 3)
+	checkStats("globex", 2, 2)
+	checkStats("initech", 4, 0)
+
+	// the usage is rebuilt from the index after reopening.
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	checkStats("acme", 3, 3)
+	if err := put("acme:users", "key_5"); !errors.Is(err, ErrTenantQuota) {
+		t.Errorf("err put over the quota after reopening, got %v want %v", err, ErrTenantQuota)
+	}
+
+	if err := db.Update(func(tx *Tx) error {
+		return tx.DropTenant("acme")
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := db.TenantStats("acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.KeyCount != 0 || stats.QuotaKeys != 0 || stats.QuotaBytes != 0 {
+		t.Errorf("err TenantStats after DropTenant, got %+v", stats)
+	}
+	if err := put("acme:users", "key_1", "key_2", "key_3"); err != nil {
+		t.Errorf("err put after DropTenant, got %v", err)
+	}
+
+	// the usage of the pending writes is counted again after a rollback to a savepoint.
+	if err := db.Update(func(tx *Tx) error {
+		if err := tx.Delete("acme:users", []byte("key_1")); err != nil {
+			return err
+		}
+		sp, err := tx.Savepoint()
+		if err != nil {
+			return err
+		}
+		if err := tx.Put("acme:users", []byte("key_4"), []byte("val"), Persistent); err != nil {
+			return err
+		}
+		if err := tx.RollbackTo(sp); err != nil {
+			return err
+		}
+		if err := tx.Put("acme:users", []byte("key_5"), []byte("val"), Persistent); err != nil {
+			return err
+		}
+		if err := tx.Put("acme:users", []byte("key_6"), []byte("val"), Persistent); !errors.Is(err, ErrTenantQuota) {
+			t.Errorf("err put over the quota after RollbackTo, got %v want %v", err, ErrTenantQuota)
+		}
+		// the lists, the sets and the sorted sets are not counted.
+		return tx.RPush("acme:users", []byte("list"), []byte("item"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+	checkStats("acme", 4, 3)
+
+	if _, err := db.TenantStats("unknown"); err != ErrBucketNotFound {
+		t.Errorf("err TenantStats of an unknown tenant, got %v want %v", err, ErrBucketNotFound)
+	}
+	if err := db.Update(func(tx *Tx) error { return tx.DropTenant("unknown") }); err != ErrBucketNotFound {
+		t.Errorf("err DropTenant of an unknown tenant, got %v want %v", err, ErrBucketNotFound)
+	}
+
+	if got := fmt.Sprintln(tenantOf("acme:orders:2024"), tenantOf("acme")); got != "acme acme\n" {
+		t.Errorf("err tenantOf, got %s", got)
+	}
+}
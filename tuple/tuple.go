@@ -0,0 +1,350 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package tuple implements order-preserving encodings of the keys, so that the bytewise order
+of the encoded keys matches the logical order of their values. A Tuple of several values packs
+into one key, like the columns of a composite index:
+
+	key, err := tuple.Tuple{"user", int64(42), time.Now()}.Pack()
+
+The tuples are sorted element by element, and a tuple is sorted before the longer tuples it is
+a prefix of. The elements of the same type are sorted by their values, the integers of all the
+Go integer types together, and the elements of different types in the order: nil, []byte,
+string, the integers, the floats, the bools and the times.
+
+The encodings:
+
+	nil       0x00
+	[]byte    0x01 then the bytes, 0x00 escaped as 0x00 0xff, then 0x00
+	string    0x02 then the bytes, 0x00 escaped as 0x00 0xff, then 0x00
+	integer   0x14 for 0, 0x14+n then the n big-endian bytes of a positive integer,
+	          0x14-n then the ones' complement of the n big-endian bytes of the magnitude
+	          of a negative integer, with the fewest bytes
+	float     0x21 then the 8 big-endian bytes of the IEEE 754 bits, all the bits flipped
+	          for the negative floats and the sign bit flipped for the others
+	bool      0x26 for false, 0x27 for true
+	time      0x33 then the unix seconds as an integer with the sign bit flipped in 8
+	          big-endian bytes, then the nanoseconds in 4 big-endian bytes
+
+The Append functions append the encoding of one element to a key, and Unpack decodes a key
+packed from a tuple.
+*/
+package tuple
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	nilCode    = 0x00
+	bytesCode  = 0x01
+	stringCode = 0x02
+	intZero    = 0x14
+	floatCode  = 0x21
+	falseCode  = 0x26
+	trueCode   = 0x27
+	timeCode   = 0x33
+
+	// endCode is after the codes of all the elements.
+	endCode = 0xff
+)
+
+var (
+	// ErrUnsupportedType is returned by Pack when an element is not of a supported type.
+	ErrUnsupportedType = errors.New("unsupported tuple element type")
+
+	// ErrInvalidEncoding is returned by Unpack when the key is not a packed tuple.
+	ErrInvalidEncoding = errors.New("invalid tuple encoding")
+)
+
+// Tuple represents the elements of a composite key. The elements are nil, []byte, string,
+// the integers of the Go integer types, float32, float64, bool and time.Time.
+type Tuple []interface{}
+
+// Pack returns the key encoding the elements of t.
+func (t Tuple) Pack() ([]byte, error) {
+	var key []byte
+
+	for i, e := range t {
+		switch v := e.(type) {
+		case nil:
+			key = append(key, nilCode)
+		case []byte:
+			key = AppendBytes(key, v)
+		case string:
+			key = AppendString(key, v)
+		case int:
+			key = AppendInt(key, int64(v))
+		case int8:
+			key = AppendInt(key, int64(v))
+		case int16:
+			key = AppendInt(key, int64(v))
+		case int32:
+			key = AppendInt(key, int64(v))
+		case int64:
+			key = AppendInt(key, v)
+		case uint:
+			key = AppendUint(key, uint64(v))
+		case uint8:
+			key = AppendUint(key, uint64(v))
+		case uint16:
+			key = AppendUint(key, uint64(v))
+		case uint32:
+			key = AppendUint(key, uint64(v))
+		case uint64:
+			key = AppendUint(key, v)
+		case float32:
+			key = AppendFloat(key, float64(v))
+		case float64:
+			key = AppendFloat(key, v)
+		case bool:
+			key = AppendBool(key, v)
+		case time.Time:
+			key = AppendTime(key, v)
+		default:
+			return nil, fmt.Errorf("%w: element %d of type %T", ErrUnsupportedType, i, e)
+		}
+	}
+
+	return key, nil
+}
+
+// Range returns the range of the keys of the tuples starting with the elements of t, t itself
+// included, both ends included as in Tx.RangeScan.
+func (t Tuple) Range() (start, end []byte, err error) {
+	if start, err = t.Pack(); err != nil {
+		return nil, nil, err
+	}
+
+	end = append(append(make([]byte, 0, len(start)+1), start...), endCode)
+
+	return start, end, nil
+}
+
+// AppendBytes appends the encoding of b to the key.
+func AppendBytes(key, b []byte) []byte {
+	return appendEscaped(append(key, bytesCode), b)
+}
+
+// AppendString appends the encoding of s to the key.
+func AppendString(key []byte, s string) []byte {
+	return appendEscaped(append(key, stringCode), []byte(s))
+}
+
+func appendEscaped(key, b []byte) []byte {
+	for {
+		i := bytes.IndexByte(b, 0x00)
+		if i < 0 {
+			break
+		}
+		key = append(key, b[:i+1]...)
+		key = append(key, endCode)
+		b = b[i+1:]
+	}
+
+	return append(append(key, b...), 0x00)
+}
+
+// AppendInt appends the encoding of v to the key.
+func AppendInt(key []byte, v int64) []byte {
+	if v >= 0 {
+		return AppendUint(key, uint64(v))
+	}
+
+	// the magnitude of math.MinInt64 is 1<<63 as an uint64.
+	m := uint64(-v)
+	n := byteLen(m)
+
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], ^m)
+
+	return append(append(key, byte(intZero-n)), b[8-n:]...)
+}
+
+// AppendUint appends the encoding of v to the key.
+func AppendUint(key []byte, v uint64) []byte {
+	n := byteLen(v)
+
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+
+	return append(append(key, byte(intZero+n)), b[8-n:]...)
+}
+
+// byteLen returns the number of the bytes of v without the leading zeros.
+func byteLen(v uint64) int {
+	n := 0
+	for ; v > 0; v >>= 8 {
+		n++
+	}
+	return n
+}
+
+// AppendFloat appends the encoding of v to the key. The NaNs are sorted after the positive
+// infinity, or before the negative one if their sign bit is set.
+func AppendFloat(key []byte, v float64) []byte {
+	bits := math.Float64bits(v)
+	if bits&(1<<63) != 0 {
+		bits = ^bits
+	} else {
+		bits ^= 1 << 63
+	}
+
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], bits)
+
+	return append(append(key, floatCode), b[:]...)
+}
+
+// AppendBool appends the encoding of v to the key.
+func AppendBool(key []byte, v bool) []byte {
+	if v {
+		return append(key, trueCode)
+	}
+	return append(key, falseCode)
+}
+
+// AppendTime appends the encoding of v to the key, the location and the monotonic clock
+// reading of v are not encoded.
+func AppendTime(key []byte, v time.Time) []byte {
+	var b [12]byte
+	binary.BigEndian.PutUint64(b[:8], uint64(v.Unix())^(1<<63))
+	binary.BigEndian.PutUint32(b[8:], uint32(v.Nanosecond()))
+
+	return append(append(key, timeCode), b[:]...)
+}
+
+// Unpack returns the tuple packed in the key. The integers are decoded as int64, or as uint64
+// if they are greater than math.MaxInt64, the floats as float64 and the times in UTC.
+func Unpack(key []byte) (Tuple, error) {
+	var t Tuple
+
+	for len(key) > 0 {
+		e, n, err := decodeElement(key)
+		if err != nil {
+			return nil, err
+		}
+		t = append(t, e)
+		key = key[n:]
+	}
+
+	return t, nil
+}
+
+// decodeElement returns the first element of the key and the size of its encoding.
+func decodeElement(key []byte) (interface{}, int, error) {
+	code := key[0]
+
+	switch {
+	case code == nilCode:
+		return nil, 1, nil
+	case code == bytesCode || code == stringCode:
+		b, n, err := decodeEscaped(key[1:])
+		if err != nil {
+			return nil, 0, err
+		}
+		if code == stringCode {
+			return string(b), n + 1, nil
+		}
+		return b, n + 1, nil
+	case code >= intZero-8 && code <= intZero+8:
+		return decodeInt(key)
+	case code == floatCode:
+		if len(key) < 9 {
+			return nil, 0, ErrInvalidEncoding
+		}
+		bits := binary.BigEndian.Uint64(key[1:9])
+		if bits&(1<<63) != 0 {
+			bits ^= 1 << 63
+		} else {
+			bits = ^bits
+		}
+		return math.Float64frombits(bits), 9, nil
+	case code == falseCode:
+		return false, 1, nil
+	case code == trueCode:
+		return true, 1, nil
+	case code == timeCode:
+		if len(key) < 13 {
+			return nil, 0, ErrInvalidEncoding
+		}
+		sec := int64(binary.BigEndian.Uint64(key[1:9]) ^ (1 << 63))
+		nsec := int64(binary.BigEndian.Uint32(key[9:13]))
+		return time.Unix(sec, nsec).UTC(), 13, nil
+	}
+
+	return nil, 0, ErrInvalidEncoding
+}
+
+// decodeEscaped returns the bytes escaped by appendEscaped and the size of their encoding.
+func decodeEscaped(key []byte) ([]byte, int, error) {
+	var b []byte
+
+	for i := 0; i < len(key); i++ {
+		if key[i] != 0x00 {
+			b = append(b, key[i])
+			continue
+		}
+		if i+1 < len(key) && key[i+1] == endCode {
+			b = append(b, 0x00)
+			i++
+			continue
+		}
+		if b == nil {
+			b = []byte{}
+		}
+		return b, i + 1, nil
+	}
+
+	return nil, 0, ErrInvalidEncoding
+}
+
+func decodeInt(key []byte) (interface{}, int, error) {
+	n := int(key[0]) - intZero
+	neg := n < 0
+	if neg {
+		n = -n
+	}
+	if len(key) < n+1 {
+		return nil, 0, ErrInvalidEncoding
+	}
+
+	var b [8]byte
+	copy(b[8-n:], key[1:n+1])
+	v := binary.BigEndian.Uint64(b[:])
+
+	if !neg {
+		if v > math.MaxInt64 {
+			return v, n + 1, nil
+		}
+		return int64(v), n + 1, nil
+	}
+
+	// the bytes are the ones' complement of the magnitude on n bytes.
+	m := ^v
+	if n < 8 {
+		m &= 1<<(8*uint(n)) - 1
+	}
+	if m > 1<<63 {
+		return nil, 0, ErrInvalidEncoding
+	}
+
+	return -int64(m), n + 1, nil
+}
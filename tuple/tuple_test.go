@@ -0,0 +1,138 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tuple
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func mustPack(t *testing.T, tu Tuple) []byte {
+	t.Helper()
+
+	key, err := tu.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestPack_Order(t *testing.T) {
+	now := time.Unix(1700000000, 500)
+
+	// the tuples in ascending order.
+	tuples := []Tuple{
+		{},
+		{nil},
+		{[]byte{}},
+		{[]byte{0x00}},
+		{[]byte{0x00, 0x01}},
+		{[]byte{0x01}},
+		{""},
+		{"a"},
+		{"a", nil},
+		{"a", "b"},
+		{"a\x00"},
+		{"ab"},
+		{int64(math.MinInt64)},
+		{-65536},
+		{-256},
+		{-255},
+		{-1},
+		{0},
+		{uint8(1)},
+		{255},
+		{256},
+		{int64(math.MaxInt64)},
+		{uint64(math.MaxUint64)},
+		{math.Inf(-1)},
+		{-1.5},
+		{float32(-0.5)},
+		{0.0},
+		{1e-300},
+		{2.5},
+		{math.Inf(1)},
+		{false},
+		{true},
+		{time.Unix(-1, 0)},
+		{now},
+		{now.Add(time.Nanosecond)},
+		{now.Add(time.Second)},
+	}
+
+	for i := 1; i < len(tuples); i++ {
+		a, b := mustPack(t, tuples[i-1]), mustPack(t, tuples[i])
+		if bytes.Compare(a, b) >= 0 {
+			t.Errorf("err order, %v packed as %x is not before %v packed as %x", tuples[i-1], a, tuples[i], b)
+		}
+	}
+}
+
+func TestUnpack(t *testing.T) {
+	now := time.Unix(1700000000, 123456789).UTC()
+
+	tests := []struct {
+		in, want Tuple
+	}{
+		{Tuple{"user", 42, now}, Tuple{"user", int64(42), now}},
+		{Tuple{[]byte("a\x00b"), "\x00", nil}, Tuple{[]byte("a\x00b"), "\x00", nil}},
+		{Tuple{int64(math.MinInt64), -1, 0, uint64(math.MaxUint64)}, Tuple{int64(math.MinInt64), int64(-1), int64(0), uint64(math.MaxUint64)}},
+		{Tuple{-2.5, float32(0.5), true, false}, Tuple{-2.5, 0.5, true, false}},
+		{Tuple{[]byte{}}, Tuple{[]byte{}}},
+	}
+
+	for _, tt := range tests {
+		got, err := Unpack(mustPack(t, tt.in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("err Unpack(Pack(%v)), got %#v want %#v", tt.in, got, tt.want)
+		}
+	}
+
+	for _, key := range [][]byte{{0x02, 'a'}, {0x16, 0x01}, {0x21, 0x00}, {0x33}, {0xfe}} {
+		if _, err := Unpack(key); err != ErrInvalidEncoding {
+			t.Errorf("err Unpack(%x), got %v want %v", key, err, ErrInvalidEncoding)
+		}
+	}
+}
+
+func TestRange(t *testing.T) {
+	start, end, err := Tuple{"user", 1}.Range()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tu := range []Tuple{{"user", 1}, {"user", 1, "a"}, {"user", 1, uint64(math.MaxUint64), true}} {
+		if key := mustPack(t, tu); bytes.Compare(key, start) < 0 || bytes.Compare(key, end) > 0 {
+			t.Errorf("err Range, %v is not in the range", tu)
+		}
+	}
+
+	for _, tu := range []Tuple{{"user"}, {"user", 0, "a"}, {"user", 2}} {
+		if key := mustPack(t, tu); bytes.Compare(key, start) >= 0 && bytes.Compare(key, end) <= 0 {
+			t.Errorf("err Range, %v is in the range", tu)
+		}
+	}
+
+	if _, err := (Tuple{struct{}{}}).Pack(); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("err Pack, got %v want %v", err, ErrUnsupportedType)
+	}
+}
@@ -15,12 +15,15 @@
 package nutsdb
 
 import (
+	"context"
+	"encoding/binary"
 	"errors"
+	"fmt"
 	"os"
 	"strings"
 	"time"
 
-	"github.com/bwmarrin/snowflake"
+	"github.com/xujiajun/nutsdb/ds/bitmap"
 	"github.com/xujiajun/nutsdb/ds/list"
 	"github.com/xujiajun/nutsdb/ds/set"
 	"github.com/xujiajun/nutsdb/ds/zset"
@@ -45,7 +48,8 @@ var (
 	// ErrBucketEmpty is returned if bucket is empty.
 	ErrBucketEmpty = errors.New("bucket is empty")
 
-	// ErrRangeScan is returned when range scanning not found the result
+	// ErrRangeScan is returned when range scanning with a start key after the end key or in a bucket not found,
+	// an empty range has an empty result
 	ErrRangeScan = errors.New("range scans not found")
 
 	// ErrPrefixScan is returned when prefix scanning not found the result
@@ -54,10 +58,67 @@ var (
 	// ErrPrefixSearchScan is returned when prefix and search scanning not found the result
 	ErrPrefixSearchScan = errors.New("prefix and search scans not found")
 
-	// ErrNotFoundKey is returned when key not found int the bucket on an view function.
-	ErrNotFoundKey = errors.New("key not found in the bucket")
+	// ErrNotFoundKey is returned when key not found int the bucket on an view function, it wraps ErrKeyNotFound.
+	ErrNotFoundKey = fmt.Errorf("%w in the bucket", ErrKeyNotFound)
+
+	// ErrInvalidCursor is returned when the cursor of a scan is malformed or belongs to another prefix.
+	ErrInvalidCursor = errors.New("invalid scan cursor")
+
+	// ErrBadPattern is returned when the pattern of a glob scan is malformed.
+	ErrBadPattern = errors.New("bad glob pattern")
+
+	// ErrValueNotInteger is returned when Incr or Decr is called on a value which is not an 8 bytes integer.
+	ErrValueNotInteger = errors.New("value is not an integer")
+
+	// ErrIntegerOverflow is returned when Incr or Decr overflows the int64 value.
+	ErrIntegerOverflow = errors.New("increment or decrement would overflow")
+
+	// ErrKeyExists is returned when PutIfNotExists is called on a key which exists.
+	ErrKeyExists = errors.New("key already exists")
+
+	// ErrConflict is returned when PutIfEqual or PutIfVersion is called on a key whose value or version has changed.
+	ErrConflict = errors.New("the key has been changed")
+
+	// ErrTxTooBig is returned when a write would exceed the MaxTxEntries or MaxTxBytes of the tx.
+	ErrTxTooBig = errors.New("tx exceeds the max entries or bytes")
+
+	// ErrInvalidSavepoint is returned when RollbackTo is called with a savepoint of another tx,
+	// or one released by rolling back to an earlier savepoint.
+	ErrInvalidSavepoint = errors.New("invalid savepoint")
 )
 
+// notFoundError keeps the error returned so far and makes errors.Is also
+// match ErrBucketNotFound or ErrKeyNotFound.
+type notFoundError struct {
+	err    error
+	target error
+}
+
+func (e *notFoundError) Error() string { return e.err.Error() }
+
+func (e *notFoundError) Unwrap() error { return e.err }
+
+func (e *notFoundError) Is(target error) bool { return target == e.target }
+
+// bucketNotFound wraps err to match ErrBucketNotFound.
+func bucketNotFound(err error) error {
+	return &notFoundError{err: err, target: ErrBucketNotFound}
+}
+
+// keyNotFound wraps err to match ErrKeyNotFound.
+func keyNotFound(err error) error {
+	return &notFoundError{err: err, target: ErrKeyNotFound}
+}
+
+// dsNotFound wraps the errors returned by the data structures when the key is not found to match ErrKeyNotFound.
+func dsNotFound(err error) error {
+	if errors.Is(err, list.ErrListNotFound) || errors.Is(err, set.ErrKeyNotFound) {
+		return keyNotFound(err)
+	}
+
+	return err
+}
+
 // Tx represents a transaction.
 type Tx struct {
 	id                     uint64
@@ -65,6 +126,21 @@ type Tx struct {
 	writable               bool
 	pendingWrites          []*Entry
 	ReservedStoreTxIDIdxes map[int64]*BPTree
+	isMerging              bool // the tx rewrites live entries for merge
+	isExpiring             bool // the tx deletes expired keys for the expiration worker
+	isSnapshot             bool // the tx reads the versions committed at or before snapshotSeq
+	snapshotSeq            uint64
+	pendingIndexes         []pendingIndex // the secondary indexes created by the tx
+	start                  time.Time
+	ctx                    context.Context              // the scans and the commit stop once it is done
+	evicted                int                          // the keys deleted by the eviction policies
+	pendingBytes           int64                        // the size of the pendingWrites
+	pendingKeys            map[string]map[string]*Entry // bucket -> key -> the last pending write of the key
+	tenantPending          map[string]*tenantPending    // tenant -> the usage of the pending writes, nil to count again
+	evicting               bool                         // the tx deletes the keys evicted at commit
+	spillValues            bool                         // the values of the commit are not kept in the index
+	savepoints             []savepoint                  // the savepoints of the tx, oldest first
+	savepointSeq           int
 }
 
 // Begin opens a new transaction.
@@ -74,170 +150,303 @@ type Tx struct {
 // the current read/write transaction is completed.
 // All transactions must be closed by calling Commit() or Rollback() when done.
 func (db *DB) Begin(writable bool) (tx *Tx, err error) {
-	tx, err = newTx(db, writable)
-	if err != nil {
-		return nil, err
-	}
-
-	tx.lock()
-
-	if db.closed {
-		tx.unlock()
-		return nil, ErrDBClosed
-	}
-
-	return
+	return db.BeginCtx(context.Background(), writable)
 }
 
 // newTx returns a newly initialized Tx object at given writable.
 func newTx(db *DB, writable bool) (tx *Tx, err error) {
-	var txID uint64
-
 	tx = &Tx{
 		db:                     db,
 		writable:               writable,
 		pendingWrites:          []*Entry{},
 		ReservedStoreTxIDIdxes: make(map[int64]*BPTree),
+		start:                  time.Now(),
+		ctx:                    context.Background(),
 	}
 
-	txID, err = tx.getTxID()
-	if err != nil {
-		return nil, err
-	}
-
-	tx.id = txID
+	tx.id = tx.getTxID()
 
 	return
 }
 
 // getTxID returns the tx id.
-func (tx *Tx) getTxID() (id uint64, err error) {
-	node, err := snowflake.NewNode(tx.db.opt.NodeNum)
-	if err != nil {
-		return 0, err
-	}
-
-	id = uint64(node.Generate().Int64())
-
-	return
+func (tx *Tx) getTxID() uint64 {
+	return uint64(tx.db.txIDNode.Generate().Int64())
 }
 
 // Commit commits the transaction, following these steps:
 //
 // 1. check the length of pendingWrites.If there are no writes, return immediately.
 //
-// 2. check if the ActiveFile has not enough space to store entry. if not, call rotateActiveFile function.
+// 2. encode pendingWrites and check their sizes, nothing is written if one is too large. The values
+// which overflow are written to the overflow file of the data file of their entry, see OverflowValueSize.
+//
+// 3. check if the ActiveFile has not enough space to store entry. if not, call rotateActiveFile function.
+//
+// 4. write pendingWrites followed by the commit record of the tx to disk with one write and one sync per data file,
+// if a non-nil error,return the error.
 //
-// 3. write pendingWrites to disk, if a non-nil error,return the error.
+// 5. build Hint index of all the data structures once every entry is written, so that a failed commit
+// changes none of them.
 //
-// 4. build Hint index.
+// 6. Unlock the database and clear the db field.
 //
-// 5. Unlock the database and clear the db field.
+// The writes of a tx to any buckets and data structures are committed all together, the recovery
+// keeps all of them or none, see txCommit.
 func (tx *Tx) Commit() error {
-	var (
-		off            int64
-		e              *Entry
-		bucketMetaTemp BucketMeta
-	)
+	var bucketMetaTemp BucketMeta
 
 	if tx.db == nil {
 		return ErrDBClosed
 	}
 
+	if tx.db.eviction != nil && tx.writable && !tx.isMerging {
+		if err := tx.evict(); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.validate(); err != nil {
+		return err
+	}
+
 	writesLen := len(tx.pendingWrites)
 
 	if writesLen == 0 {
+		tx.buildPendingIndexes()
+		if tx.writable {
+			tx.db.observeCommit(0, 0, time.Since(tx.start))
+		} else {
+			tx.db.observeReadTx(time.Since(tx.start))
+		}
 		tx.unlock()
 		tx.db = nil
 		return nil
 	}
 
-	lastIndex := writesLen - 1
+	// nothing is written if the context is done.
+	if err := tx.ctxErr(); err != nil {
+		return err
+	}
+
+	if err := tx.checkIndexMemory(); err != nil {
+		return err
+	}
+
+	if err := tx.checkBackpressure(); err != nil {
+		return err
+	}
+
+	commitStart := time.Now()
+
 	countFlag := CountFlagEnabled
-	if tx.db.isMerging {
+	if tx.isMerging {
 		countFlag = CountFlagDisabled
 	}
 
-	for i := 0; i < writesLen; i++ {
-		entry := tx.pendingWrites[i]
-		entrySize := entry.Size()
-		if entrySize > tx.db.opt.SegmentSize {
-			return ErrKeyAndValSize
-		}
-
-		bucket := string(entry.Meta.bucket)
+	tx.db.commitSeq++
 
-		if tx.db.ActiveFile.ActualSize+entrySize > tx.db.opt.SegmentSize {
-			if err := tx.rotateActiveFile(); err != nil {
-				return err
-			}
-		}
+	var (
+		buf        []byte
+		chunkStart int
+		written    int64
+		txSize     int64
+	)
 
-		if entry.Meta.ds == DataStructureBPTree {
-			tx.db.BPTreeKeyEntryPosMap[string(entry.Meta.bucket)+string(entry.Key)] = tx.db.ActiveFile.writeOff
+	// the entries are encoded and checked before any is written, so that a tx which cannot be
+	// committed writes nothing.
+	datas := make([][]byte, writesLen)
+	overflows := make([]*overflowValue, writesLen)
+	for i, entry := range tx.pendingWrites {
+		if tx.isMerging {
+			entry.Meta.merged = 1
 		}
 
-		if i == lastIndex {
+		// a single entry is checked by its crc, it marks the tx committed itself.
+		if writesLen == 1 {
 			entry.Meta.status = Committed
 		}
 
-		off = tx.db.ActiveFile.writeOff
-
-		if _, err := tx.db.ActiveFile.WriteAt(entry.Encode(), tx.db.ActiveFile.writeOff); err != nil {
+		data, err := tx.encodeEntry(entry)
+		if err != nil {
 			return err
 		}
+		datas[i] = data
+		overflows[i] = tx.db.overflow(entry, data)
 
-		if tx.db.opt.SyncEnable {
-			if err := tx.db.ActiveFile.rwManager.Sync(); err != nil {
-				return err
-			}
+		size := entry.Size()
+		if i == writesLen-1 && writesLen > 1 {
+			size += txCommitEntrySize
+		}
+		if size > tx.db.opt.SegmentSize {
+			return ErrKeyAndValSize
 		}
+		txSize += size
+	}
 
-		tx.db.ActiveFile.ActualSize += entrySize
+	offs := make([]int64, writesLen)
+	fids := make([]int64, writesLen)
+	firstFID := tx.db.ActiveFile.fileID
 
-		tx.db.ActiveFile.writeOff += entrySize
+	// commit sums up the entries written to the active file, the commit record
+	// is written with the last entry so that they are in the same data file.
+	var commit txCommit
 
-		if tx.db.opt.EntryIdxMode == HintBPTSparseIdxMode {
-			bucketMetaTemp = tx.buildTempBucketMetaIdx(bucket, entry.Key, bucketMetaTemp)
+	for i := 0; i < writesLen; i++ {
+		entry, data := tx.pendingWrites[i], datas[i]
+
+		entrySize := entry.Size()
+		size := entrySize
+		if i == writesLen-1 && writesLen > 1 {
+			size += txCommitEntrySize
 		}
 
-		if i == lastIndex {
-			txID := entry.Meta.txID
-			if tx.db.opt.EntryIdxMode == HintBPTSparseIdxMode {
-				if err := tx.buildTxIDRootIdx(txID, countFlag); err != nil {
-					return err
-				}
+		// in HintBPTSparseIdxMode the recovery only reads the last data file, the active file is
+		// rotated before the tx if it does not fit in it but fits in a data file.
+		if i == 0 && tx.db.opt.EntryIdxMode == HintBPTSparseIdxMode && txSize <= tx.db.opt.SegmentSize {
+			size = txSize
+		}
 
-				if err := tx.buildBucketMetaIdx(bucket, entry.Key, bucketMetaTemp); err != nil {
-					return err
-				}
-			} else {
-				tx.db.committedTxIds[txID] = struct{}{}
+		if tx.db.ActiveFile.ActualSize+size > tx.db.opt.SegmentSize {
+			if err := tx.writeEntries(buf, chunkStart, i, offs, fids, countFlag, &bucketMetaTemp); err != nil {
+				return err
+			}
+
+			buf, chunkStart = buf[:0], i
+			commit = txCommit{}
+
+			if err := tx.rotateActiveFile(); err != nil {
+				return err
+			}
+
+			if i == 0 {
+				firstFID = tx.db.ActiveFile.fileID
 			}
 		}
 
-		e = nil
-		if tx.db.opt.EntryIdxMode == HintKeyValAndRAMIdxMode {
-			e = entry
+		// the value is written to the overflow file of the data file of the entry.
+		if overflows[i] != nil {
+			var err error
+			if data, err = tx.db.writeOverflow(entry, overflows[i]); err != nil {
+				return err
+			}
 		}
 
-		if entry.Meta.ds == DataStructureBPTree {
-			tx.buildBPTreeIdx(bucket, entry, e, off, countFlag)
+		offs[i], fids[i] = tx.db.ActiveFile.writeOff, tx.db.ActiveFile.fileID
+		buf = append(buf, data...)
+		commit.add(data)
+		written += entrySize
+
+		tx.db.ActiveFile.ActualSize += entrySize
+		tx.db.ActiveFile.writeOff += entrySize
+	}
+
+	if writesLen > 1 {
+		buf = append(buf, commit.entry(tx.id, uint32(writesLen), firstFID).Encode()...)
+		tx.db.ActiveFile.ActualSize += txCommitEntrySize
+		tx.db.ActiveFile.writeOff += txCommitEntrySize
+		written += txCommitEntrySize
+	}
+
+	if err := tx.writeEntries(buf, chunkStart, writesLen, offs, fids, countFlag, &bucketMetaTemp); err != nil {
+		return err
+	}
+
+	if err := tx.db.commitSynced(written); err != nil {
+		return err
+	}
+
+	// in HintBPTSparseIdxMode the index of each data file is written when it is rotated,
+	// the other modes index the entries once they are all written.
+	if tx.db.opt.EntryIdxMode != HintBPTSparseIdxMode {
+		if err := tx.indexEntries(0, writesLen, offs, fids, countFlag, &bucketMetaTemp); err != nil {
+			return err
 		}
 	}
 
+	tx.db.notifyCommit()
+
 	tx.buildIdxes(writesLen)
 
+	tx.buildPendingIndexes()
+
+	if !tx.isMerging {
+		tx.db.publish(tx.pendingWrites, tx.isExpiring)
+	}
+
+	tx.db.observeCommit(writesLen, written, time.Since(commitStart))
+	tx.db.observeEvictions(tx.evicted)
+
+	hooks := tx.commitHooks()
+
+	db, seq := tx.db, tx.db.commitSeq
+
 	tx.unlock()
 
 	tx.db = nil
 
 	tx.pendingWrites = nil
+	tx.pendingBytes = 0
+	tx.pendingKeys = nil
+	tx.tenantPending = nil
+	tx.savepoints = nil
 	tx.ReservedStoreTxIDIdxes = nil
 
+	// the commits of a group share the sync, once the db is unlocked for the others.
+	if policy := db.opt.syncPolicy(); policy.mode == syncGroup {
+		if err := db.waitGroupSync(seq, policy.interval); err != nil {
+			return err
+		}
+	}
+
+	if hooks != nil {
+		hooks()
+	}
+
 	return nil
 }
 
+// encodeEntry encodes the entry as stored in the data file, the value is compressed
+// with the codec of its bucket, then the value and optionally the key are encrypted.
+// The key and value of the entry stay as is for the indexes, only its metadata records
+// how they are stored and their stored sizes.
+func (tx *Tx) encodeEntry(entry *Entry) ([]byte, error) {
+	value, codec, err := tx.db.opt.compressValue(string(entry.Meta.bucket), entry.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	key := entry.Key
+	encryption := uint16(0)
+
+	if tx.db.cipher != nil {
+		if value, err = tx.db.cipher.encrypt(value); err != nil {
+			return nil, err
+		}
+		encryption |= encryptedValue
+
+		if tx.db.opt.Encryption.EncryptKeys {
+			if key, err = tx.db.cipher.encrypt(key); err != nil {
+				return nil, err
+			}
+			encryption |= encryptedKey
+		}
+	}
+
+	if codec == NoCompression && encryption == 0 {
+		return entry.Encode(), nil
+	}
+
+	entry.Meta.codec = uint16(codec)
+	entry.Meta.encryption = encryption
+	entry.Meta.keySize = uint32(len(key))
+	entry.Meta.valueSize = uint32(len(value))
+
+	stored := &Entry{Key: key, Value: value, Meta: entry.Meta}
+
+	return stored.Encode(), nil
+}
+
 func (tx *Tx) buildTempBucketMetaIdx(bucket string, key []byte, bucketMetaTemp BucketMeta) BucketMeta {
 	keySize := uint32(len(key))
 	if bucketMetaTemp.start == nil {
@@ -294,7 +503,7 @@ func (tx *Tx) buildBucketMetaIdx(bucket string, key []byte, bucketMetaTemp Bucke
 			return err
 		}
 
-		if tx.db.opt.SyncEnable {
+		if tx.db.syncEachWrite() {
 			if err = fd.Sync(); err != nil {
 				return err
 			}
@@ -309,33 +518,28 @@ func (tx *Tx) buildTxIDRootIdx(txID uint64, countFlag bool) error {
 	txIDStr := strconv2.IntToStr(int(txID))
 
 	tx.db.ActiveCommittedTxIdsIdx.Insert([]byte(txIDStr), nil, &Hint{meta: &MetaData{Flag: DataSetFlag}}, countFlag)
-	if len(tx.ReservedStoreTxIDIdxes) > 0 {
-		for fID, txIDIdx := range tx.ReservedStoreTxIDIdxes {
-			filePath := tx.db.getBPTTxIDPath(fID)
 
-			txIDIdx.Insert([]byte(txIDStr), nil, &Hint{meta: &MetaData{Flag: DataSetFlag}}, countFlag)
-			txIDIdx.Filepath = filePath
+	return nil
+}
 
-			err := txIDIdx.WriteNodes(tx.db.opt.RWMode, tx.db.opt.SyncEnable, 2)
-			if err != nil {
-				return err
-			}
+// writeTxIDIdx writes the index of the committed txs of the data file at given fID when it is rotated.
+func (tx *Tx) writeTxIDIdx(fID int64, txIDIdx *BPTree) error {
+	if txIDIdx.root == nil {
+		return nil
+	}
 
-			filePath = tx.db.getBPTRootTxIDPath(fID)
-			txIDRootIdx := NewTree()
-			rootAddress := strconv2.Int64ToStr(txIDIdx.root.Address)
+	txIDIdx.Filepath = tx.db.getBPTTxIDPath(fID)
+	if err := txIDIdx.WriteNodes(tx.db.opt.RWMode, tx.db.syncEachWrite(), 2); err != nil {
+		return err
+	}
 
-			txIDRootIdx.Insert([]byte(rootAddress), nil, &Hint{meta: &MetaData{Flag: DataSetFlag}}, countFlag)
-			txIDRootIdx.Filepath = filePath
+	txIDRootIdx := NewTree()
+	rootAddress := strconv2.Int64ToStr(txIDIdx.root.Address)
 
-			err = txIDRootIdx.WriteNodes(tx.db.opt.RWMode, tx.db.opt.SyncEnable, 2)
-			if err != nil {
-				return err
-			}
-		}
-	}
+	txIDRootIdx.Insert([]byte(rootAddress), nil, &Hint{meta: &MetaData{Flag: DataSetFlag}}, CountFlagEnabled)
+	txIDRootIdx.Filepath = tx.db.getBPTRootTxIDPath(fID)
 
-	return nil
+	return txIDRootIdx.WriteNodes(tx.db.opt.RWMode, tx.db.syncEachWrite(), 2)
 }
 
 func (tx *Tx) buildIdxes(writesLen int) {
@@ -344,6 +548,24 @@ func (tx *Tx) buildIdxes(writesLen int) {
 
 		bucket := string(entry.Meta.bucket)
 
+		// the merged file records are not counted.
+		if isMergedFileEntry(entry) {
+			continue
+		}
+
+		tx.db.KeyCount++
+
+		// the set, sorted set and list indexes already hold the merged entries.
+		if tx.isMerging {
+			continue
+		}
+
+		if entry.Meta.ds == DataStructureBPTree {
+			tx.updateSecondaryIdxes(bucket, entry)
+			tx.db.eviction.apply(bucket, entry)
+			tx.db.tenants.apply(bucket, entry)
+		}
+
 		if entry.Meta.ds == DataStructureSet {
 			tx.buildSetIdx(bucket, entry)
 		}
@@ -356,34 +578,47 @@ func (tx *Tx) buildIdxes(writesLen int) {
 			tx.buildListIdx(bucket, entry)
 		}
 
-		tx.db.KeyCount++
+		if entry.Meta.ds == DataStructureBitmap {
+			tx.buildBitmapIdx(bucket, entry)
+		}
 	}
 }
 
-func (tx *Tx) buildBPTreeIdx(bucket string, entry, e *Entry, off int64, countFlag bool) {
+func (tx *Tx) buildBPTreeIdx(bucket string, entry, e *Entry, fID, off int64, countFlag bool) {
 	if tx.db.opt.EntryIdxMode == HintBPTSparseIdxMode {
 		newKey := []byte(bucket)
 		newKey = append(newKey, entry.Key...)
 		tx.db.ActiveBPTreeIdx.Insert(newKey, e, &Hint{
-			fileID:  tx.db.ActiveFile.fileID,
+			fileID:  fID,
 			key:     newKey,
 			meta:    entry.Meta,
 			dataPos: uint64(off),
 		}, countFlag)
 	} else {
 		if _, ok := tx.db.BPTreeIdx[bucket]; !ok {
-			tx.db.BPTreeIdx[bucket] = NewTree()
+			tx.db.BPTreeIdx[bucket] = tx.db.newBucketTree(bucket)
 		}
 
 		if tx.db.BPTreeIdx[bucket] == nil {
-			tx.db.BPTreeIdx[bucket] = NewTree()
+			tx.db.BPTreeIdx[bucket] = tx.db.newBucketTree(bucket)
 		}
-		_ = tx.db.BPTreeIdx[bucket].Insert(entry.Key, e, &Hint{
-			fileID:  tx.db.ActiveFile.fileID,
+		r, old, err := tx.db.BPTreeIdx[bucket].insert(entry.Key, e, &Hint{
+			fileID:  fID,
 			key:     entry.Key,
 			meta:    entry.Meta,
 			dataPos: uint64(off),
 		}, countFlag)
+		if err == nil {
+			tx.db.accountRecord(r, old)
+
+			r.version = tx.db.commitSeq
+			r.prev = tx.db.keptVersions(old, r.version)
+
+			// the old entry of the key is only read by the snapshot txs from now on.
+			if old != nil && tx.db.entryCache != nil {
+				tx.db.entryCache.remove(entryPos{fID: old.H.fileID, off: old.H.dataPos})
+			}
+		}
 	}
 }
 
@@ -412,8 +647,10 @@ func (tx *Tx) buildSortedSetIdx(bucket string, entry *Entry) {
 		key := keyAndScore[0]
 		score, _ := strconv2.StrToFloat64(keyAndScore[1])
 		_ = tx.db.SortedSetIdx[bucket].Put(key, zset.SCORE(score), entry.Value)
+		tx.db.setZSetDeadline(bucket, key, entry.Meta.TTL, entry.Meta.timestamp)
 	case DataZRemFlag:
 		_ = tx.db.SortedSetIdx[bucket].Remove(string(entry.Key))
+		tx.db.setZSetDeadline(bucket, string(entry.Key), Persistent, 0)
 	case DataZRemRangeByRankFlag:
 		start, _ := strconv2.StrToInt(string(entry.Key))
 		end, _ := strconv2.StrToInt(string(entry.Value))
@@ -458,7 +695,132 @@ func (tx *Tx) buildListIdx(bucket string, entry *Entry) {
 		start, _ := strconv2.StrToInt(keyAndStartIndex[1])
 		end, _ := strconv2.StrToInt(string(value))
 		_ = tx.db.ListIdx[bucket].Ltrim(newKey, start, end)
+	case DataLInsertFlag:
+		keyAndIndex := strings.Split(string(key), SeparatorForListKey)
+		newKey := keyAndIndex[0]
+		index, _ := strconv2.StrToInt(keyAndIndex[1])
+		_ = tx.db.ListIdx[bucket].LInsert(newKey, index, value)
+	}
+}
+
+func (tx *Tx) buildBitmapIdx(bucket string, entry *Entry) {
+	if _, ok := tx.db.BitmapIdx[bucket]; !ok {
+		tx.db.BitmapIdx[bucket] = bitmap.NewBitmaps()
+	}
+
+	switch entry.Meta.Flag {
+	case DataSetBitFlag, DataClearBitFlag:
+		offset := binary.BigEndian.Uint32(entry.Value)
+		tx.db.BitmapIdx[bucket].SetBit(string(entry.Key), offset, entry.Meta.Flag == DataSetBitFlag)
+	case DataBitmapStoreFlag:
+		b := bitmap.New()
+		if err := b.UnmarshalBinary(entry.Value); err == nil {
+			tx.db.BitmapIdx[bucket].Store(string(entry.Key), b)
+		}
+	}
+}
+
+// writeEntries appends the encoded pending writes in [from, to) to the active file
+// with one write and one sync, then builds the hint index of them in HintBPTSparseIdxMode.
+func (tx *Tx) writeEntries(buf []byte, from, to int, offs, fids []int64, countFlag bool, bucketMetaTemp *BucketMeta) error {
+	if from == to {
+		return nil
+	}
+
+	if _, err := tx.db.ActiveFile.WriteAt(buf, offs[from]); err != nil {
+		tx.db.ActiveFile.writeOff = offs[from]
+		tx.db.ActiveFile.ActualSize = offs[from]
+
+		// the torn entries would fail the next Open.
+		if derr := tx.db.discardActiveFile(offs[from]); derr != nil {
+			tx.db.logger().Warn("discarding the torn entries of the failed commit", "file", tx.db.ActiveFile.path, "offset", offs[from], "err", derr)
+		}
+		return err
+	}
+
+	if tx.db.syncEachWrite() {
+		if err := tx.db.ActiveFile.rwManager.Sync(); err != nil {
+			return err
+		}
+	}
+
+	if tx.db.opt.EntryIdxMode == HintBPTSparseIdxMode {
+		return tx.indexEntries(from, to, offs, fids, countFlag, bucketMetaTemp)
 	}
+
+	return nil
+}
+
+// discardActiveFile discards the data of the active file from given off after a failed write.
+// The file is truncated at off and extended back to its size, which zeroes the torn bytes
+// without writing them, since the writes may keep failing, e.g. when the disk is full.
+func (db *DB) discardActiveFile(off int64) error {
+	if db.opt.Backend != nil {
+		return db.ActiveFile.truncateAt(off)
+	}
+
+	path := db.ActiveFile.path
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if fi.Size() <= off {
+		return nil
+	}
+
+	if err := os.Truncate(path, off); err != nil {
+		return err
+	}
+
+	return os.Truncate(path, fi.Size())
+}
+
+// indexEntries builds the B+ tree indexes of the pending writes from from to to, written at
+// the offsets offs of the data files fids.
+func (tx *Tx) indexEntries(from, to int, offs, fids []int64, countFlag bool, bucketMetaTemp *BucketMeta) error {
+	lastIndex := len(tx.pendingWrites) - 1
+	now := uint64(time.Now().Unix())
+
+	for i := from; i < to; i++ {
+		entry, off := tx.pendingWrites[i], offs[i]
+		bucket := string(entry.Meta.bucket)
+
+		tx.indexBucketTTL(bucket, entry, now)
+
+		if entry.Meta.ds == DataStructureBPTree {
+			tx.db.BPTreeKeyEntryPosMap[bucket+string(entry.Key)] = off
+		}
+
+		if tx.db.opt.EntryIdxMode == HintBPTSparseIdxMode {
+			*bucketMetaTemp = tx.buildTempBucketMetaIdx(bucket, entry.Key, *bucketMetaTemp)
+		}
+
+		if i == lastIndex {
+			txID := entry.Meta.txID
+			if tx.db.opt.EntryIdxMode == HintBPTSparseIdxMode {
+				if err := tx.buildTxIDRootIdx(txID, countFlag); err != nil {
+					return err
+				}
+
+				if err := tx.buildBucketMetaIdx(bucket, entry.Key, *bucketMetaTemp); err != nil {
+					return err
+				}
+			} else {
+				tx.db.committedTxIds[txID] = struct{}{}
+			}
+		}
+
+		var e *Entry
+		if tx.db.opt.EntryIdxMode == HintKeyValAndRAMIdxMode && !tx.spillValues {
+			e = entry
+		}
+
+		if entry.Meta.ds == DataStructureBPTree {
+			tx.buildBPTreeIdx(bucket, entry, e, fids[i], off, countFlag)
+		}
+	}
+
+	return nil
 }
 
 // rotateActiveFile rotates log file when active file is not enough space to store the entry.
@@ -467,8 +829,10 @@ func (tx *Tx) rotateActiveFile() error {
 	fID := tx.db.MaxFileID
 	tx.db.MaxFileID++
 
-	if !tx.db.opt.SyncEnable && tx.db.opt.RWMode == MMap {
-		if err := tx.db.ActiveFile.rwManager.Sync(); err != nil {
+	// the active file is not synced on each write, sync it before closing it unless the syncs
+	// are left to the operating system, which does not write back a closed mmap file.
+	if policy := tx.db.opt.syncPolicy(); policy.mode != syncAlways && (policy.mode != syncNever || tx.db.opt.RWMode == MMap) {
+		if err := tx.db.syncActiveFile(); err != nil {
 			return err
 		}
 	}
@@ -482,7 +846,7 @@ func (tx *Tx) rotateActiveFile() error {
 		tx.db.ActiveBPTreeIdx.enabledKeyPosMap = true
 		tx.db.ActiveBPTreeIdx.SetKeyPosMap(tx.db.BPTreeKeyEntryPosMap)
 
-		err = tx.db.ActiveBPTreeIdx.WriteNodes(tx.db.opt.RWMode, tx.db.opt.SyncEnable, 1)
+		err = tx.db.ActiveBPTreeIdx.WriteNodes(tx.db.opt.RWMode, tx.db.syncEachWrite(), 1)
 		if err != nil {
 			return err
 		}
@@ -497,7 +861,7 @@ func (tx *Tx) rotateActiveFile() error {
 		}
 
 		_, err := BPTreeRootIdx.Persistence(tx.db.getBPTRootPath(fID),
-			0, tx.db.opt.SyncEnable)
+			0, tx.db.syncEachWrite())
 		if err != nil {
 			return err
 		}
@@ -512,7 +876,10 @@ func (tx *Tx) rotateActiveFile() error {
 		tx.db.ActiveBPTreeIdx = nil
 		tx.db.ActiveBPTreeIdx = NewTree()
 
-		tx.ReservedStoreTxIDIdxes[fID] = tx.db.ActiveCommittedTxIdsIdx
+		// the tx is written to the next data file, the committed txs of this one are known.
+		if err := tx.writeTxIDIdx(fID, tx.db.ActiveCommittedTxIdsIdx); err != nil {
+			return err
+		}
 
 		// clear and reset ActiveCommittedTxIdsIdx
 		tx.db.ActiveCommittedTxIdsIdx = nil
@@ -521,12 +888,21 @@ func (tx *Tx) rotateActiveFile() error {
 
 	// reset ActiveFile
 	path := tx.db.getDataPath(tx.db.MaxFileID)
-	tx.db.ActiveFile, err = NewDataFile(path, tx.db.opt.SegmentSize, tx.db.opt.RWMode)
+	recycled, err := tx.db.reuseRecycledFile(path)
+	if err != nil {
+		return err
+	}
+
+	tx.db.ActiveFile, err = tx.db.openDataFile(path, tx.db.opt.RWMode)
 	if err != nil {
 		return err
 	}
 
 	tx.db.ActiveFile.fileID = tx.db.MaxFileID
+
+	if !recycled {
+		return tx.db.preallocateDataFile(path)
+	}
 	return nil
 }
 
@@ -536,14 +912,96 @@ func (tx *Tx) Rollback() error {
 		return ErrDBClosed
 	}
 
+	if tx.writable {
+		tx.db.observeRollback()
+	} else {
+		tx.db.observeReadTx(time.Since(tx.start))
+	}
+
+	hooks := tx.rollbackHooks()
+
 	tx.unlock()
 
 	tx.db = nil
 	tx.pendingWrites = nil
+	tx.pendingBytes = 0
+	tx.pendingKeys = nil
+	tx.tenantPending = nil
+	tx.pendingIndexes = nil
+	tx.savepoints = nil
+
+	if hooks != nil {
+		hooks()
+	}
 
 	return nil
 }
 
+// Savepoint represents a point of a read/write tx to roll back its writes to, see Tx.Savepoint.
+type Savepoint struct {
+	tx *Tx
+	id int
+}
+
+// savepoint records the writes of the tx when the savepoint is taken.
+type savepoint struct {
+	id      int
+	writes  int
+	bytes   int64
+	indexes int
+}
+
+// Savepoint marks the writes of the tx so far, so that RollbackTo can undo the writes after it
+// without aborting the tx, e.g. to skip a record which fails in the middle of an import.
+func (tx *Tx) Savepoint() (Savepoint, error) {
+	if err := tx.checkTxIsClosed(); err != nil {
+		return Savepoint{}, err
+	}
+
+	if !tx.writable {
+		return Savepoint{}, ErrTxNotWritable
+	}
+
+	tx.savepointSeq++
+	tx.savepoints = append(tx.savepoints, savepoint{
+		id:      tx.savepointSeq,
+		writes:  len(tx.pendingWrites),
+		bytes:   tx.pendingBytes,
+		indexes: len(tx.pendingIndexes),
+	})
+
+	return Savepoint{tx: tx, id: tx.savepointSeq}, nil
+}
+
+// RollbackTo discards the writes and the created or dropped indexes of the tx after the savepoint,
+// the tx stays open. The savepoint can be rolled back to again, the later ones are released.
+func (tx *Tx) RollbackTo(sp Savepoint) error {
+	if err := tx.checkTxIsClosed(); err != nil {
+		return err
+	}
+
+	if sp.tx != tx {
+		return ErrInvalidSavepoint
+	}
+
+	for i := len(tx.savepoints) - 1; i >= 0; i-- {
+		if p := tx.savepoints[i]; p.id == sp.id {
+			for j := p.writes; j < len(tx.pendingWrites); j++ {
+				tx.pendingWrites[j] = nil
+			}
+			tx.pendingWrites = tx.pendingWrites[:p.writes]
+			tx.pendingBytes = p.bytes
+			tx.rebuildPending()
+			tx.pendingIndexes = tx.pendingIndexes[:p.indexes]
+			tx.savepoints = tx.savepoints[:i+1]
+
+			return nil
+		}
+	}
+
+	return ErrInvalidSavepoint
+}
+
 // lock locks the database based on the transaction type.
 func (tx *Tx) lock() {
 	if tx.writable {
@@ -563,13 +1021,49 @@ func (tx *Tx) unlock() {
 }
 
 func (tx *Tx) PutWithTimestamp(bucket string, key, value []byte, ttl uint32, timestamp uint64) error {
-	return tx.put(bucket, key, value, ttl, DataSetFlag, timestamp, DataStructureBPTree)
+	return tx.put(bucket, key, value, tx.keyTTL(bucket, ttl), DataSetFlag, timestamp, DataStructureBPTree)
 }
 
 // Put sets the value for a key in the bucket.
 // a wrapper of the function put.
 func (tx *Tx) Put(bucket string, key, value []byte, ttl uint32) error {
-	return tx.put(bucket, key, value, ttl, DataSetFlag, uint64(time.Now().Unix()), DataStructureBPTree)
+	return tx.put(bucket, key, value, tx.keyTTL(bucket, ttl), DataSetFlag, uint64(time.Now().Unix()), DataStructureBPTree)
+}
+
+// BatchEntry represents a key/value pair written by PutBatch.
+type BatchEntry struct {
+	Bucket string
+	Key    []byte
+	Value  []byte
+	TTL    uint32
+}
+
+// PutBatch sets the values for the keys of the entries, they are written to
+// the log with one append and one sync when the transaction commits.
+// If any entry is invalid, none of them is put.
+func (tx *Tx) PutBatch(entries []BatchEntry) error {
+	if err := tx.checkTxIsClosed(); err != nil {
+		return err
+	}
+
+	if !tx.writable {
+		return ErrTxNotWritable
+	}
+
+	for _, e := range entries {
+		if len(e.Key) == 0 {
+			return ErrKeyEmpty
+		}
+	}
+
+	timestamp := uint64(time.Now().Unix())
+	for _, e := range entries {
+		if err := tx.put(e.Bucket, e.Key, e.Value, tx.keyTTL(e.Bucket, e.TTL), DataSetFlag, timestamp, DataStructureBPTree); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 func (tx *Tx) checkTxIsClosed() error {
@@ -594,7 +1088,14 @@ func (tx *Tx) put(bucket string, key, value []byte, ttl uint32, flag uint16, tim
 		return ErrKeyEmpty
 	}
 
-	tx.pendingWrites = append(tx.pendingWrites, &Entry{
+	// the merge rewrites the entries written before the limits are changed.
+	if !tx.isMerging {
+		if err := tx.db.opt.checkSizes(key, value); err != nil {
+			return err
+		}
+	}
+
+	e := &Entry{
 		Key:   key,
 		Value: value,
 		Meta: &MetaData{
@@ -609,7 +1110,46 @@ func (tx *Tx) put(bucket string, key, value []byte, ttl uint32, flag uint16, tim
 			ds:         ds,
 			txID:       tx.id,
 		},
-	})
+	}
+
+	if err := tx.checkTxSize(e.Size()); err != nil {
+		return err
+	}
+
+	if err := tx.checkTenantQuota(bucket, e); err != nil {
+		return err
+	}
+
+	tx.pendingWrites = append(tx.pendingWrites, e)
+	tx.pendingBytes += e.Size()
+	tx.trackPending(e)
 
 	return nil
 }
+
+// checkTxSize returns ErrTxTooBig if writing an entry of given size would exceed the limits of
+// the tx. The txs of the merge, of the expiration and the evictions at commit are not limited.
+func (tx *Tx) checkTxSize(size int64) error {
+	if tx.isMerging || tx.isExpiring || tx.evicting {
+		return nil
+	}
+
+	opt := tx.db.opt
+
+	if opt.MaxTxEntries > 0 && len(tx.pendingWrites)+1 > opt.MaxTxEntries {
+		return ErrTxTooBig
+	}
+
+	if opt.MaxTxBytes > 0 && tx.pendingBytes+size > opt.MaxTxBytes {
+		return ErrTxTooBig
+	}
+
+	return nil
+}
+
+// Size returns the number of entries and the size in bytes of the writes of the tx so far,
+// as checked against MaxTxEntries and MaxTxBytes, so that the callers can split their writes
+// into several txs before they exceed the limits.
+func (tx *Tx) Size() (entries int, bytes int64) {
+	return len(tx.pendingWrites), tx.pendingBytes
+}
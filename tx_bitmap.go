@@ -0,0 +1,142 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/xujiajun/nutsdb/ds/bitmap"
+)
+
+// ErrBitOp is returned when the operation of BitOp is unknown.
+var ErrBitOp = errors.New("unknown bit operation")
+
+// BitOperation represents the operations of BitOp.
+type BitOperation int
+
+const (
+	// BitAnd represents the intersection of the bitmaps.
+	BitAnd BitOperation = iota
+
+	// BitOr represents the union of the bitmaps.
+	BitOr
+
+	// BitXor represents the symmetric difference of the bitmaps.
+	BitXor
+)
+
+// SetBit sets or clears the bit at offset of the bitmap stored in the bucket at given bucket and key.
+func (tx *Tx) SetBit(bucket string, key []byte, offset uint32, value bool) error {
+	flag := DataClearBitFlag
+	if value {
+		flag = DataSetBitFlag
+	}
+
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], offset)
+
+	return tx.put(bucket, key, b[:], Persistent, flag, uint64(time.Now().Unix()), DataStructureBitmap)
+}
+
+// GetBit returns the bit at offset of the bitmap stored in the bucket at given bucket and key.
+func (tx *Tx) GetBit(bucket string, key []byte, offset uint32) (bool, error) {
+	b, err := tx.getBitmap(bucket, key)
+	if err != nil {
+		return false, err
+	}
+
+	return b.Contains(offset), nil
+}
+
+// BitCount returns the number of the bits set in the bitmap stored in the bucket at given bucket and key.
+func (tx *Tx) BitCount(bucket string, key []byte) (uint64, error) {
+	b, err := tx.getBitmap(bucket, key)
+	if err != nil {
+		return 0, err
+	}
+
+	return b.Count(), nil
+}
+
+// BitOp stores the result of the operation on the bitmaps at given keys in the bucket at dstKey,
+// replacing its bitmap, and returns the number of the bits set in it. The keys without a bitmap
+// count as empty bitmaps, an empty result removes the bitmap at dstKey.
+func (tx *Tx) BitOp(op BitOperation, bucket string, dstKey []byte, keys ...[]byte) (uint64, error) {
+	if err := tx.checkTxIsWritable(); err != nil {
+		return 0, err
+	}
+
+	if op != BitAnd && op != BitOr && op != BitXor {
+		return 0, ErrBitOp
+	}
+
+	result := bitmap.New()
+	for i, key := range keys {
+		b := bitmap.New()
+		if bs, ok := tx.db.BitmapIdx[bucket]; ok {
+			if sb := bs.Get(string(key)); sb != nil {
+				b = sb
+			}
+		}
+
+		switch {
+		case i == 0:
+			result = b.Clone()
+		case op == BitAnd:
+			result = result.And(b)
+		case op == BitOr:
+			result = result.Or(b)
+		case op == BitXor:
+			result = result.Xor(b)
+		}
+	}
+
+	if err := tx.storeBitmap(bucket, dstKey, result); err != nil {
+		return 0, err
+	}
+
+	return result.Count(), nil
+}
+
+// storeBitmap writes the whole bitmap b at given bucket and key.
+func (tx *Tx) storeBitmap(bucket string, key []byte, b *bitmap.Bitmap) error {
+	value, err := b.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	return tx.put(bucket, key, value, Persistent, DataBitmapStoreFlag, uint64(time.Now().Unix()), DataStructureBitmap)
+}
+
+// getBitmap returns the bitmap stored in the bucket at given bucket and key.
+func (tx *Tx) getBitmap(bucket string, key []byte) (*bitmap.Bitmap, error) {
+	if err := tx.checkTxIsClosed(); err != nil {
+		return nil, err
+	}
+
+	bs, ok := tx.db.BitmapIdx[bucket]
+	if !ok {
+		return nil, ErrBucketAndKey(bucket, key)
+	}
+
+	b := bs.Get(string(key))
+	if b == nil {
+		return nil, ErrNotFoundKeyInBucket(bucket, key)
+	}
+
+	return b, nil
+}
@@ -0,0 +1,230 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"errors"
+	"testing"
+)
+
+func checkBitCount(t *testing.T, key string, want uint64) {
+	t.Helper()
+
+	if err := db.View(func(tx *Tx) error {
+		n, err := tx.BitCount("bucket", []byte(key))
+		if err != nil {
+			return err
+		}
+		if n != want {
+			t.Errorf("err BitCount %s, got %d want %d", key, n, want)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTx_SetBitAndGetBit(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestbitmap", true)
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Update(func(tx *Tx) error {
+		for _, offset := range []uint32{0, 7, 1 << 20, 1<<32 - 1} {
+			if err := tx.SetBit("bucket", []byte("key"), offset, true); err != nil {
+				return err
+			}
+		}
+		return tx.SetBit("bucket", []byte("key"), 7, false)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func() {
+		if err := db.View(func(tx *Tx) error {
+			for offset, want := range map[uint32]bool{0: true, 7: false, 8: false, 1 << 20: true, 1<<32 - 1: true} {
+				bit, err := tx.GetBit("bucket", []byte("key"), offset)
+				if err != nil {
+					return err
+				}
+				if bit != want {
+					t.Errorf("err GetBit %d, got %v want %v", offset, bit, want)
+				}
+			}
+
+			if _, err := tx.GetBit("bucket", []byte("key_fake"), 0); !errors.Is(err, ErrKeyNotFound) {
+				t.Errorf("err GetBit, got %v want %v", err, ErrKeyNotFound)
+			}
+			if _, err := tx.BitCount("bucket_fake", []byte("key")); !errors.Is(err, ErrBucketNotFound) {
+				t.Errorf("err BitCount, got %v want %v", err, ErrBucketNotFound)
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		checkBitCount(t, "key", 3)
+	}
+
+	check()
+
+	// the bitmaps are rebuilt from the data files.
+	db.Close()
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	check()
+}
+
+func TestTx_BitOp(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestbitmap", true)
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Update(func(tx *Tx) error {
+		for i := uint32(0); i < 100; i++ {
+			if err := tx.SetBit("bucket", []byte("even"), 2*i, true); err != nil {
+				return err
+			}
+			if err := tx.SetBit("bucket", []byte("low"), i, true); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		op   BitOperation
+		keys []string
+		want uint64
+	}{
+		{BitAnd, []string{"even", "low"}, 50},
+		{BitOr, []string{"even", "low"}, 150},
+		{BitXor, []string{"even", "low"}, 100},
+		// the missing bitmaps are empty.
+		{BitOr, []string{"even", "key_fake"}, 100},
+		{BitAnd, []string{"even", "key_fake"}, 0},
+	}
+
+	for _, tt := range tests {
+		var keys [][]byte
+		for _, key := range tt.keys {
+			keys = append(keys, []byte(key))
+		}
+
+		if err := db.Update(func(tx *Tx) error {
+			n, err := tx.BitOp(tt.op, "bucket", []byte("dst"), keys...)
+			if err != nil {
+				return err
+			}
+			if n != tt.want {
+				t.Errorf("err BitOp %d %v, got %d want %d", tt.op, tt.keys, n, tt.want)
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if tt.want > 0 {
+			checkBitCount(t, "dst", tt.want)
+		}
+	}
+
+	// the empty result removes the bitmap.
+	if err := db.View(func(tx *Tx) error {
+		_, err := tx.BitCount("bucket", []byte("dst"))
+		return err
+	}); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("err BitOp, got %v want %v", err, ErrKeyNotFound)
+	}
+
+	if err := db.Update(func(tx *Tx) error {
+		_, err := tx.BitOp(BitOperation(10), "bucket", []byte("dst"), []byte("even"))
+		return err
+	}); err != ErrBitOp {
+		t.Errorf("err BitOp, got %v want %v", err, ErrBitOp)
+	}
+
+	db.Close()
+}
+
+func TestTx_BitmapMerge(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestbitmap", true)
+	opt.SegmentSize = 64 * 1024
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the dense bitmap spans several data files.
+	for i := uint32(0); i < 6000; i += 500 {
+		if err := db.Update(func(tx *Tx) error {
+			for j := i; j < i+500; j++ {
+				if err := tx.SetBit("bucket", []byte("key"), j, true); err != nil {
+					return err
+				}
+				if j%2 == 1 {
+					if err := tx.SetBit("bucket", []byte("sparse"), j, j%4 == 1); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := db.Update(func(tx *Tx) error {
+		return tx.SetBit("bucket", []byte("key"), 10, false)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+
+	checkBitCount(t, "key", 5999)
+	checkBitCount(t, "sparse", 1500)
+
+	db.Close()
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	checkBitCount(t, "key", 5999)
+	checkBitCount(t, "sparse", 1500)
+
+	if err := db.View(func(tx *Tx) error {
+		bit, err := tx.GetBit("bucket", []byte("key"), 10)
+		if bit {
+			t.Error("err GetBit, the cleared bit is set after the merge")
+		}
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -16,9 +16,14 @@ package nutsdb
 
 import (
 	"bytes"
+	"encoding/base64"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"math"
 	"regexp"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/xujiajun/utils/strconv2"
@@ -35,14 +40,7 @@ func (tx *Tx) getByHintBPTSparseIdxInMem(bucket string, key []byte) (e *Entry, e
 	r, err := tx.db.ActiveBPTreeIdx.Find(key)
 	if err == nil && r != nil {
 		if _, err := tx.db.ActiveCommittedTxIdsIdx.Find([]byte(strconv2.Int64ToStr(int64(r.H.meta.txID)))); err == nil {
-			path := tx.db.getDataPath(r.H.fileID)
-			df, err := NewDataFile(path, tx.db.opt.SegmentSize, tx.db.opt.RWMode)
-			defer df.rwManager.Close()
-			if err != nil {
-				return nil, err
-			}
-
-			return df.ReadAt(int(r.H.dataPos))
+			return tx.db.readEntryAt(r.H.fileID, r.H.dataPos)
 		}
 
 		return nil, ErrNotFoundKey
@@ -126,12 +124,20 @@ func (tx *Tx) getAllByHintBPTSparseIdx(bucket string) (entries Entries, err erro
 }
 
 // Get retrieves the value for a key in the bucket.
+// Like the scans, it sees the writes of the tx to the bucket before they are committed.
 // The returned value is only valid for the life of the transaction.
 func (tx *Tx) Get(bucket string, key []byte) (e *Entry, err error) {
 	if err := tx.checkTxIsClosed(); err != nil {
 		return nil, err
 	}
 
+	if e, ok := tx.pendingGet(bucket, key); ok {
+		if e == nil {
+			return nil, ErrNotFoundKey
+		}
+		return e, nil
+	}
+
 	idxMode := tx.db.opt.EntryIdxMode
 
 	if idxMode == HintBPTSparseIdxMode {
@@ -145,6 +151,12 @@ func (tx *Tx) Get(bucket string, key []byte) (e *Entry, err error) {
 				return nil, err
 			}
 
+			if tx.isSnapshot {
+				if r = r.visible(tx.snapshotSeq); r == nil {
+					return nil, ErrNotFoundKey
+				}
+			}
+
 			if _, ok := tx.db.committedTxIds[r.H.meta.txID]; !ok {
 				return nil, ErrNotFoundKey
 			}
@@ -153,34 +165,130 @@ func (tx *Tx) Get(bucket string, key []byte) (e *Entry, err error) {
 				return nil, ErrNotFoundKey
 			}
 
-			if idxMode == HintKeyValAndRAMIdxMode {
+			tx.db.eviction.touch(bucket, key)
+
+			if r.E != nil {
 				return r.E, nil
 			}
 
-			if idxMode == HintKeyAndRAMIdxMode {
-				path := tx.db.getDataPath(r.H.fileID)
-				df, err := NewDataFile(path, tx.db.opt.SegmentSize, tx.db.opt.RWMode)
-				defer df.rwManager.Close()
+			// the value is not kept in the index in HintKeyAndRAMIdxMode, or is spilled by MaxIndexMemory.
+			item, err := tx.db.readEntryAt(r.H.fileID, r.H.dataPos)
+			if err != nil {
+				return nil, fmt.Errorf("read err. pos %d, key %s, err %s", r.H.dataPos, string(key), err)
+			}
 
-				if err != nil {
-					return nil, err
-				}
+			return item, nil
+		}
+	}
 
-				item, err := df.ReadAt(int(r.H.dataPos))
-				if err != nil {
-					return nil, fmt.Errorf("read err. pos %d, key %s, err %s", r.H.dataPos, string(key), err)
-				}
+	return nil, ErrBucketAndKey(bucket, key)
+}
+
+// GetMulti retrieves the values for the keys in the bucket, the returned entries are in the
+// order of the keys and the ones of the keys not found are nil.
+// In HintKeyAndRAMIdxMode, the values are read data file by data file, in the order of
+// their offsets, so that each data file is opened once.
+// The returned values are only valid for the life of the transaction.
+func (tx *Tx) GetMulti(bucket string, keys [][]byte) (es Entries, err error) {
+	if err := tx.checkTxIsClosed(); err != nil {
+		return nil, err
+	}
+
+	es = make(Entries, len(keys))
+
+	idxMode := tx.db.opt.EntryIdxMode
+
+	if idxMode == HintBPTSparseIdxMode {
+		for i, key := range keys {
+			if e, err := tx.Get(bucket, key); err == nil {
+				es[i] = e
+			}
+		}
+
+		return es, nil
+	}
+
+	idx, ok := tx.db.BPTreeIdx[bucket]
+	if !ok {
+		return es, nil
+	}
+
+	// the positions of the keys to read, by data file.
+	type hintPos struct {
+		i   int
+		off uint64
+	}
+	positions := make(map[int64][]hintPos)
 
-				return item, nil
+	for i, key := range keys {
+		if e, ok := tx.pendingGet(bucket, key); ok {
+			es[i] = e
+			continue
+		}
+
+		r, err := idx.Find(key)
+		if err != nil {
+			continue
+		}
+
+		if tx.isSnapshot {
+			if r = r.visible(tx.snapshotSeq); r == nil {
+				continue
 			}
 		}
+
+		if _, ok := tx.db.committedTxIds[r.H.meta.txID]; !ok {
+			continue
+		}
+
+		if r.H.meta.Flag == DataDeleteFlag || r.IsExpired() {
+			continue
+		}
+
+		if r.E != nil {
+			es[i] = r.E
+			continue
+		}
+
+		positions[r.H.fileID] = append(positions[r.H.fileID], hintPos{i: i, off: r.H.dataPos})
+	}
+
+	for fID, pos := range positions {
+		sort.Slice(pos, func(i, j int) bool {
+			return pos[i].off < pos[j].off
+		})
+
+		offs := make([]uint64, len(pos))
+		for i, p := range pos {
+			offs[i] = p.off
+		}
+
+		entries, err := tx.db.readEntriesAt(fID, offs)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, p := range pos {
+			es[p.i] = entries[i]
+		}
 	}
 
-	return nil, errors.New("not found bucket:" + bucket + ",key:" + string(key))
+	return es, nil
 }
 
 //GetAll returns all keys and values of the bucket stored at given bucket.
 func (tx *Tx) GetAll(bucket string) (entries Entries, err error) {
+	entries, err = tx.getAll(bucket)
+
+	if pending := tx.pendingScan(bucket, func([]byte) bool { return true }); pending != nil {
+		return scanWithPending(entries, err, pending, tx.keyCompare(bucket), false, ErrBucketEmpty)
+	}
+
+	return entries, err
+}
+
+// getAll is GetAll without the pending writes of the tx.
+func (tx *Tx) getAll(bucket string) (entries Entries, err error) {
 	if err := tx.checkTxIsClosed(); err != nil {
 		return nil, err
 	}
@@ -190,20 +298,25 @@ func (tx *Tx) GetAll(bucket string) (entries Entries, err error) {
 	idxMode := tx.db.opt.EntryIdxMode
 
 	if idxMode == HintBPTSparseIdxMode {
-		return tx.getAllByHintBPTSparseIdx(bucket)
+		if entries, err = tx.getAllByHintBPTSparseIdx(bucket); err != nil {
+			return nil, err
+		}
 	}
 
 	if idxMode == HintKeyValAndRAMIdxMode || idxMode == HintKeyAndRAMIdxMode {
-		if index, ok := tx.db.BPTreeIdx[bucket]; ok {
-			records, err := index.All()
-			if err != nil {
-				return nil, ErrBucketEmpty
-			}
+		index, ok := tx.db.BPTreeIdx[bucket]
+		if !ok {
+			return nil, bucketNotFound(ErrBucketEmpty)
+		}
 
-			entries, err = tx.getHintIdxDataItemsWrapper(records, ScanNoLimit, entries, RangeScan)
-			if err != nil {
-				return nil, ErrBucketEmpty
-			}
+		records, err := index.All()
+		if err != nil {
+			return nil, ErrBucketEmpty
+		}
+
+		entries, err = tx.getHintIdxDataItemsWrapper(records, ScanNoLimit, entries, RangeScan)
+		if err != nil {
+			return nil, tx.ctxErrOr(ErrBucketEmpty)
 		}
 	}
 
@@ -216,28 +329,39 @@ func (tx *Tx) GetAll(bucket string) (entries Entries, err error) {
 
 // RangeScan query a range at given bucket, start and end slice.
 func (tx *Tx) RangeScan(bucket string, start, end []byte) (es Entries, err error) {
+	es, err = tx.rangeScan(bucket, start, end)
+
+	if pending := tx.pendingScan(bucket, inRange(tx.keyCompare(bucket), start, end)); pending != nil {
+		return scanWithPending(es, err, pending, tx.keyCompare(bucket), false, nil)
+	}
+
+	return es, err
+}
+
+// rangeScan is RangeScan without the pending writes of the tx.
+func (tx *Tx) rangeScan(bucket string, start, end []byte) (es Entries, err error) {
 	if err := tx.checkTxIsClosed(); err != nil {
 		return nil, err
 	}
 
 	if tx.db.opt.EntryIdxMode == HintBPTSparseIdxMode {
+		if compare(start, end) > 0 {
+			return nil, ErrRangeScan
+		}
+
 		newStart, newEnd := getNewKey(bucket, start), getNewKey(bucket, end)
 		records, err := tx.db.ActiveBPTreeIdx.Range(newStart, newEnd)
 		if err == nil && records != nil {
 			for _, r := range records {
-				path := tx.db.getDataPath(r.H.fileID)
-				df, err := NewDataFile(path, tx.db.opt.SegmentSize, tx.db.opt.RWMode)
-				if err != nil {
-					df.rwManager.Close()
+				if err := tx.ctxErr(); err != nil {
 					return nil, err
 				}
-				if item, err := df.ReadAt(int(r.H.dataPos)); err == nil {
-					es = append(es, item)
-				} else {
-					df.rwManager.Close()
+
+				item, err := tx.db.readEntryAt(r.H.fileID, r.H.dataPos)
+				if err != nil {
 					return nil, fmt.Errorf("HintIdx r.Hi.dataPos %d, err %s", r.H.dataPos, err)
 				}
-				df.rwManager.Close()
+				es = append(es, item)
 			}
 		}
 
@@ -248,30 +372,244 @@ func (tx *Tx) RangeScan(bucket string, start, end []byte) (es Entries, err error
 		es = append(es, entries...)
 
 		if len(es) == 0 {
-			return nil, ErrRangeScan
+			if _, ok := tx.db.bucketMetas[bucket]; !ok {
+				return nil, bucketNotFound(ErrRangeScan)
+			}
+			return nil, nil
 		}
 		return processEntriesScanOnDisk(es), nil
 	}
 
-	if index, ok := tx.db.BPTreeIdx[bucket]; ok {
-		records, err := index.Range(start, end)
+	index, ok := tx.db.BPTreeIdx[bucket]
+	if !ok {
+		return nil, bucketNotFound(ErrRangeScan)
+	}
+
+	records, err := index.Range(start, end)
+	if err == ErrScansNoResult {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, ErrRangeScan
+	}
+
+	es, err = tx.getHintIdxDataItemsWrapper(records, ScanNoLimit, es, RangeScan)
+	if err != nil {
+		return nil, tx.ctxErrOr(ErrRangeScan)
+	}
+
+	return
+}
+
+// RangeScanReverse query a range at given bucket, start and end slice,
+// the entries are returned in descending order of the keys.
+func (tx *Tx) RangeScanReverse(bucket string, start, end []byte) (es Entries, err error) {
+	es, err = tx.rangeScanReverse(bucket, start, end)
+
+	if pending := tx.pendingScan(bucket, inRange(tx.keyCompare(bucket), start, end)); pending != nil {
+		return scanWithPending(es, err, pending, tx.keyCompare(bucket), true, nil)
+	}
+
+	return es, err
+}
+
+// rangeScanReverse is RangeScanReverse without the pending writes of the tx.
+func (tx *Tx) rangeScanReverse(bucket string, start, end []byte) (es Entries, err error) {
+	if err := tx.checkTxIsClosed(); err != nil {
+		return nil, err
+	}
+
+	if tx.db.opt.EntryIdxMode == HintBPTSparseIdxMode {
+		if es, err = tx.RangeScan(bucket, start, end); err != nil {
+			return nil, err
+		}
+		return reverseEntries(es), nil
+	}
+
+	index, ok := tx.db.BPTreeIdx[bucket]
+	if !ok {
+		return nil, bucketNotFound(ErrRangeScan)
+	}
+
+	records, err := index.RangeReverse(start, end)
+	if err == ErrScansNoResult {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, ErrRangeScan
+	}
+
+	es, err = tx.getHintIdxDataItemsWrapper(records, ScanNoLimit, es, RangeScan)
+	if err != nil {
+		return nil, tx.ctxErrOr(ErrRangeScan)
+	}
+
+	return
+}
+
+// RangeScanKeys queries the keys in a range at given bucket, start and end slice.
+// Unlike RangeScan, it returns the keys from the hint index without reading the values
+// from the data files, except in HintBPTSparseIdxMode which has no keys in memory.
+func (tx *Tx) RangeScanKeys(bucket string, start, end []byte) (keys [][]byte, err error) {
+	keys, err = tx.rangeScanKeys(bucket, start, end)
+
+	if pending := tx.pendingScan(bucket, inRange(tx.keyCompare(bucket), start, end)); pending != nil {
+		es, err := scanWithPending(keyEntries(keys), err, pending, tx.keyCompare(bucket), false, nil)
 		if err != nil {
-			return nil, ErrRangeScan
+			return nil, err
 		}
+		return es.Keys(), nil
+	}
+
+	return keys, err
+}
+
+// rangeScanKeys is RangeScanKeys without the pending writes of the tx.
+func (tx *Tx) rangeScanKeys(bucket string, start, end []byte) (keys [][]byte, err error) {
+	if err := tx.checkTxIsClosed(); err != nil {
+		return nil, err
+	}
 
-		es, err = tx.getHintIdxDataItemsWrapper(records, ScanNoLimit, es, RangeScan)
+	if tx.db.opt.EntryIdxMode == HintBPTSparseIdxMode {
+		es, err := tx.RangeScan(bucket, start, end)
 		if err != nil {
-			return nil, ErrRangeScan
+			return nil, err
 		}
+		return es.Keys(), nil
 	}
 
-	if len(es) == 0 {
+	index, ok := tx.db.BPTreeIdx[bucket]
+	if !ok {
+		return nil, bucketNotFound(ErrRangeScan)
+	}
+
+	records, err := index.Range(start, end)
+	if err == ErrScansNoResult {
+		return nil, nil
+	}
+	if err != nil {
 		return nil, ErrRangeScan
 	}
 
+	if keys, err = tx.getHintIdxKeysWrapper(records, ScanNoLimit); err != nil {
+		return nil, err
+	}
+
 	return
 }
 
+// RangeScanFn calls fn with the keys and values of the entries in a range at given bucket, start and end
+// slice, in ascending order of the keys, until fn returns false. Unlike RangeScan, it walks the hint index
+// without collecting the entries. The values are only valid for the life of the transaction.
+// In HintBPTSparseIdxMode it calls fn with the entries of RangeScan.
+func (tx *Tx) RangeScanFn(bucket string, start, end []byte, fn func(key, value []byte) bool) error {
+	if err := tx.checkTxIsClosed(); err != nil {
+		return err
+	}
+
+	cmp := tx.keyCompare(bucket)
+	if cmp(start, end) > 0 {
+		return ErrRangeScan
+	}
+
+	if tx.db.opt.EntryIdxMode == HintBPTSparseIdxMode {
+		es, err := tx.RangeScan(bucket, start, end)
+		if err != nil {
+			return err
+		}
+		for _, e := range es {
+			if !fn(e.Key, e.Value) {
+				break
+			}
+		}
+		return nil
+	}
+
+	pending := tx.pendingScan(bucket, inRange(cmp, start, end))
+
+	idx, ok := tx.db.BPTreeIdx[bucket]
+	if !ok && pending == nil {
+		return bucketNotFound(ErrRangeScan)
+	}
+
+	// flush calls fn with the pending writes up to the key, or all of them if key is nil,
+	// and returns false if fn does.
+	flush := func(key []byte) bool {
+		for len(pending) > 0 && (key == nil || cmp(pending[0].Key, key) <= 0) {
+			e := pending[0]
+			pending = pending[1:]
+			if e.Meta.Flag != DataDeleteFlag && !fn(e.Key, e.Value) {
+				return false
+			}
+		}
+		return true
+	}
+
+	var (
+		err     error
+		stopped bool
+		n       int
+	)
+
+	if ok {
+		idx.ascend(start, func(k []byte, r *Record) bool {
+			if cmp(k, end) > 0 {
+				return false
+			}
+
+			if n%ctxCheckInterval == 0 {
+				if err = tx.ctxErr(); err != nil {
+					return false
+				}
+			}
+			n++
+
+			if stopped = !flush(k); stopped {
+				return false
+			}
+			if _, written := tx.pendingKeys[bucket][string(k)]; written {
+				return true
+			}
+			if _, committed := tx.db.committedTxIds[r.H.meta.txID]; !committed {
+				return true
+			}
+			if r = tx.visibleRecord(r); r == nil {
+				return true
+			}
+
+			e := r.E
+			if e == nil {
+				if e, err = tx.db.readEntryAt(r.H.fileID, r.H.dataPos); err != nil {
+					err = fmt.Errorf("HintIdx r.Hi.dataPos %d, err %s", r.H.dataPos, err)
+					return false
+				}
+			}
+
+			stopped = !fn(k, e.Value)
+			return !stopped
+		})
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if !stopped {
+		flush(nil)
+	}
+
+	return nil
+}
+
+// reverseEntries reverses the order of the entries in place.
+func reverseEntries(es Entries) Entries {
+	for i, j := 0, len(es)-1; i < j; i, j = i+1, j-1 {
+		es[i], es[j] = es[j], es[i]
+	}
+
+	return es
+}
+
 func (tx *Tx) rangeScanOnDisk(bucket string, start, end []byte) ([]*Entry, error) {
 	var result []*Entry
 
@@ -284,10 +622,12 @@ func (tx *Tx) rangeScanOnDisk(bucket string, start, end []byte) ([]*Entry, error
 	newStart, newEnd := getNewKey(bucket, start), getNewKey(bucket, end)
 
 	for _, bptSparseIdx := range bptSparseIdxGroup {
-		if compare(newStart, bptSparseIdx.start) <= 0 &&
-			compare(bptSparseIdx.start, newEnd) <= 0 ||
-			compare(newStart, bptSparseIdx.end) <= 0 &&
-				compare(bptSparseIdx.end, newEnd) <= 0 {
+		if err := tx.ctxErr(); err != nil {
+			return nil, err
+		}
+
+		// check if the range overlaps the keys of the data file.
+		if compare(newStart, bptSparseIdx.end) <= 0 && compare(bptSparseIdx.start, newEnd) <= 0 {
 
 			entries, err := tx.findRangeOnDisk(int64(bptSparseIdx.fID), int64(bptSparseIdx.rootOff), start, end, newStart, newEnd)
 
@@ -317,6 +657,10 @@ func (tx *Tx) prefixScanOnDisk(bucket string, prefix []byte, offsetNum int, limi
 	leftNum := limitNum
 
 	for _, bptSparseIdx := range bptSparseIdxGroup {
+		if err := tx.ctxErr(); err != nil {
+			return nil, off, err
+		}
+
 		if compare(newPrefix, bptSparseIdx.start) <= 0 || compare(newPrefix, bptSparseIdx.end) <= 0 {
 			entries, voff, err := tx.findPrefixOnDisk(bucket, int64(bptSparseIdx.fID), int64(bptSparseIdx.rootOff), prefix, newPrefix, offsetNum, leftNum)
 			if err != nil {
@@ -354,6 +698,10 @@ func (tx *Tx) prefixSearchScanOnDisk(bucket string, prefix []byte, reg string, o
 	leftNum := limitNum
 
 	for _, bptSparseIdx := range bptSparseIdxGroup {
+		if err := tx.ctxErr(); err != nil {
+			return nil, off, err
+		}
+
 		if compare(newPrefix, bptSparseIdx.start) <= 0 || compare(newPrefix, bptSparseIdx.end) <= 0 {
 			entries, voff, err := tx.findPrefixSearchOnDisk(bucket, int64(bptSparseIdx.fID), int64(bptSparseIdx.rootOff), prefix, reg, newPrefix, offsetNum, leftNum)
 			if err != nil {
@@ -400,16 +748,9 @@ func processEntriesScanOnDisk(entriesTemp []*Entry) (result []*Entry) {
 
 func (tx *Tx) getStartIndexForFindPrefix(fID int64, curr *BinaryNode, prefix []byte) (uint16, error) {
 	var j uint16
-	var entry *Entry
 
 	for j = 0; j < curr.KeysNum; j++ {
-		df, err := NewDataFile(tx.db.getDataPath(fID), tx.db.opt.SegmentSize, tx.db.opt.RWMode)
-		if err != nil {
-			return 0, err
-		}
-
-		entry, err = df.ReadAt(int(curr.Keys[j]))
-		df.rwManager.Close()
+		entry, err := tx.db.readEntryAt(fID, uint64(curr.Keys[j]))
 		if err != nil {
 			return 0, err
 		}
@@ -440,8 +781,6 @@ func (tx *Tx) findPrefixOnDisk(bucket string, fID, rootOff int64, prefix, newPre
 
 	scanFlag := true
 	numFound := 0
-	filepath := tx.db.getBPTPath(fID)
-
 	coff := 0
 
 	for curr != nil && scanFlag {
@@ -452,13 +791,7 @@ func (tx *Tx) findPrefixOnDisk(bucket string, fID, rootOff int64, prefix, newPre
 				continue
 			}
 
-			df, err := NewDataFile(tx.db.getDataPath(fID), tx.db.opt.SegmentSize, tx.db.opt.RWMode)
-			if err != nil {
-				return nil, off, err
-			}
-
-			entry, err = df.ReadAt(int(curr.Keys[i]))
-			df.rwManager.Close()
+			entry, err = tx.db.readEntryAt(fID, uint64(curr.Keys[i]))
 			if err != nil {
 				return nil, off, err
 			}
@@ -481,7 +814,7 @@ func (tx *Tx) findPrefixOnDisk(bucket string, fID, rootOff int64, prefix, newPre
 		if address == DefaultInvalidAddress {
 			break
 		}
-		curr, err = ReadNode(filepath, address)
+		curr, err = tx.db.readBPTNode(fID, address)
 		if err != nil {
 			return nil, off, err
 		}
@@ -515,8 +848,6 @@ func (tx *Tx) findPrefixSearchOnDisk(bucket string, fID, rootOff int64, prefix [
 
 	scanFlag := true
 	numFound := 0
-	filepath := tx.db.getBPTPath(fID)
-
 	coff := 0
 
 	for curr != nil && scanFlag {
@@ -527,13 +858,7 @@ func (tx *Tx) findPrefixSearchOnDisk(bucket string, fID, rootOff int64, prefix [
 				continue
 			}
 
-			df, err := NewDataFile(tx.db.getDataPath(fID), tx.db.opt.SegmentSize, tx.db.opt.RWMode)
-			if err != nil {
-				return nil, off, err
-			}
-
-			entry, err = df.ReadAt(int(curr.Keys[i]))
-			df.rwManager.Close()
+			entry, err = tx.db.readEntryAt(fID, uint64(curr.Keys[i]))
 			if err != nil {
 				return nil, off, err
 			}
@@ -560,7 +885,7 @@ func (tx *Tx) findPrefixSearchOnDisk(bucket string, fID, rootOff int64, prefix [
 		if address == DefaultInvalidAddress {
 			break
 		}
-		curr, err = ReadNode(filepath, address)
+		curr, err = tx.db.readBPTNode(fID, address)
 		if err != nil {
 			return nil, off, err
 		}
@@ -573,18 +898,10 @@ func (tx *Tx) findPrefixSearchOnDisk(bucket string, fID, rootOff int64, prefix [
 }
 
 func (tx *Tx) getStartIndexForFindRange(fID int64, curr *BinaryNode, start, newStart []byte) (uint16, error) {
-	var entry *Entry
 	var j uint16
 
 	for j = 0; j < curr.KeysNum; j++ {
-		df, err := NewDataFile(tx.db.getDataPath(fID), tx.db.opt.SegmentSize, tx.db.opt.RWMode)
-		if err != nil {
-			return 0, err
-		}
-
-		entry, err = df.ReadAt(int(curr.Keys[j]))
-		df.rwManager.Close()
-
+		entry, err := tx.db.readEntryAt(fID, uint64(curr.Keys[j]))
 		if err != nil {
 			return 0, err
 		}
@@ -614,18 +931,10 @@ func (tx *Tx) findRangeOnDisk(fID, rootOff int64, start, end, newStart, newEnd [
 	}
 
 	scanFlag := true
-	filepath := tx.db.getBPTPath(fID)
 
 	for curr != nil && scanFlag {
 		for i = j; i < curr.KeysNum; i++ {
-			df, err := NewDataFile(tx.db.getDataPath(int64(fID)), tx.db.opt.SegmentSize, tx.db.opt.RWMode)
-			if err != nil {
-				return nil, err
-			}
-
-			entry, err = df.ReadAt(int(curr.Keys[i]))
-			df.rwManager.Close()
-
+			entry, err = tx.db.readEntryAt(fID, uint64(curr.Keys[i]))
 			if err != nil {
 				return nil, err
 			}
@@ -644,7 +953,7 @@ func (tx *Tx) findRangeOnDisk(fID, rootOff int64, start, end, newStart, newEnd [
 		if address == DefaultInvalidAddress {
 			break
 		}
-		curr, err = ReadNode(filepath, address)
+		curr, err = tx.db.readBPTNode(fID, address)
 		if err != nil {
 			return nil, err
 		}
@@ -660,28 +969,24 @@ func (tx *Tx) prefixScanByHintBPTSparseIdx(bucket string, prefix []byte, offsetN
 	records, voff, err := tx.db.ActiveBPTreeIdx.PrefixScan(newPrefix, offsetNum, limitNum)
 	if err == nil && records != nil {
 		for _, r := range records {
-			path := tx.db.getDataPath(r.H.fileID)
-			df, err := NewDataFile(path, tx.db.opt.SegmentSize, tx.db.opt.RWMode)
-			if err != nil {
-				df.rwManager.Close()
+			if err := tx.ctxErr(); err != nil {
 				return nil, off, err
 			}
-			if item, err := df.ReadAt(int(r.H.dataPos)); err == nil {
-				es = append(es, item)
-				if len(es) == limitNum {
-					off = voff
-					return es, off, nil
-				}
-			} else {
-				df.rwManager.Close()
+
+			item, err := tx.db.readEntryAt(r.H.fileID, r.H.dataPos)
+			if err != nil {
 				return nil, off, fmt.Errorf("HintIdx r.Hi.dataPos %d, err %s", r.H.dataPos, err)
 			}
-			df.rwManager.Close()
+			es = append(es, item)
+			if len(es) == limitNum {
+				off = voff
+				return es, off, nil
+			}
 		}
 	}
 
 	leftNum := limitNum - len(es)
-	if leftNum > 0 {
+	if leftNum > 0 || limitNum == ScanNoLimit {
 		entries, voff, err := tx.prefixScanOnDisk(bucket, prefix, offsetNum, leftNum)
 		if err != nil {
 			return nil, off, err
@@ -704,23 +1009,19 @@ func (tx *Tx) prefixSearchScanByHintBPTSparseIdx(bucket string, prefix []byte, r
 	records, voff, err := tx.db.ActiveBPTreeIdx.PrefixSearchScan(newPrefix, reg, offsetNum, limitNum)
 	if err == nil && records != nil {
 		for _, r := range records {
-			path := tx.db.getDataPath(r.H.fileID)
-			df, err := NewDataFile(path, tx.db.opt.SegmentSize, tx.db.opt.RWMode)
-			if err != nil {
-				df.rwManager.Close()
+			if err := tx.ctxErr(); err != nil {
 				return nil, off, err
 			}
-			if item, err := df.ReadAt(int(r.H.dataPos)); err == nil {
-				es = append(es, item)
-				if len(es) == limitNum {
-					off = voff
-					return es, off, nil
-				}
-			} else {
-				df.rwManager.Close()
+
+			item, err := tx.db.readEntryAt(r.H.fileID, r.H.dataPos)
+			if err != nil {
 				return nil, off, fmt.Errorf("HintIdx r.Hi.dataPos %d, err %s", r.H.dataPos, err)
 			}
-			df.rwManager.Close()
+			es = append(es, item)
+			if len(es) == limitNum {
+				off = voff
+				return es, off, nil
+			}
 		}
 	}
 
@@ -746,6 +1047,16 @@ func (tx *Tx) prefixSearchScanByHintBPTSparseIdx(bucket string, prefix []byte, r
 // PrefixScan iterates over a key prefix at given bucket, prefix and limitNum.
 // LimitNum will limit the number of entries return.
 func (tx *Tx) PrefixScan(bucket string, prefix []byte, offsetNum int, limitNum int) (es Entries, off int, err error) {
+	if pending := tx.pendingScan(bucket, hasPrefix(prefix)); pending != nil {
+		es, _, err = tx.prefixScan(bucket, prefix, 0, ScanNoLimit)
+		return pageWithPending(es, err, pending, tx.keyCompare(bucket), false, offsetNum, limitNum, ErrPrefixScan)
+	}
+
+	return tx.prefixScan(bucket, prefix, offsetNum, limitNum)
+}
+
+// prefixScan is PrefixScan without the pending writes of the tx.
+func (tx *Tx) prefixScan(bucket string, prefix []byte, offsetNum int, limitNum int) (es Entries, off int, err error) {
 
 	if err := tx.checkTxIsClosed(); err != nil {
 		return nil, off, err
@@ -755,23 +1066,461 @@ func (tx *Tx) PrefixScan(bucket string, prefix []byte, offsetNum int, limitNum i
 		return tx.prefixScanByHintBPTSparseIdx(bucket, prefix, offsetNum, limitNum)
 	}
 
-	if idx, ok := tx.db.BPTreeIdx[bucket]; ok {
-		records, voff, err := idx.PrefixScan(prefix, offsetNum, limitNum)
+	idx, ok := tx.db.BPTreeIdx[bucket]
+	if !ok {
+		return nil, off, bucketNotFound(ErrPrefixScan)
+	}
+
+	records, voff, err := idx.PrefixScan(prefix, offsetNum, limitNum)
+	if err != nil {
+		off = voff
+		return nil, off, ErrPrefixScan
+	}
+
+	es, err = tx.getHintIdxDataItemsWrapper(records, limitNum, es, PrefixScan)
+	if err != nil {
+		off = voff
+		return nil, off, tx.ctxErrOr(ErrPrefixScan)
+	}
+
+	off = voff
+
+	if len(es) == 0 {
+		return nil, off, ErrPrefixScan
+	}
+
+	return
+}
+
+// PrefixScanKeys iterates over the keys with a prefix at given bucket, prefix and limitNum.
+// Unlike PrefixScan, it returns the keys from the hint index without reading the values
+// from the data files, except in HintBPTSparseIdxMode which has no keys in memory.
+func (tx *Tx) PrefixScanKeys(bucket string, prefix []byte, offsetNum int, limitNum int) (keys [][]byte, off int, err error) {
+	if pending := tx.pendingScan(bucket, hasPrefix(prefix)); pending != nil {
+		keys, _, err = tx.prefixScanKeys(bucket, prefix, 0, ScanNoLimit)
+		es, off, err := pageWithPending(keyEntries(keys), err, pending, tx.keyCompare(bucket), false, offsetNum, limitNum, ErrPrefixScan)
 		if err != nil {
-			off = voff
-			return nil, off, ErrPrefixScan
+			return nil, off, err
 		}
+		return es.Keys(), off, nil
+	}
+
+	return tx.prefixScanKeys(bucket, prefix, offsetNum, limitNum)
+}
+
+// prefixScanKeys is PrefixScanKeys without the pending writes of the tx.
+func (tx *Tx) prefixScanKeys(bucket string, prefix []byte, offsetNum int, limitNum int) (keys [][]byte, off int, err error) {
+	if err := tx.checkTxIsClosed(); err != nil {
+		return nil, off, err
+	}
 
-		es, err = tx.getHintIdxDataItemsWrapper(records, limitNum, es, PrefixScan)
+	if tx.db.opt.EntryIdxMode == HintBPTSparseIdxMode {
+		es, off, err := tx.PrefixScan(bucket, prefix, offsetNum, limitNum)
 		if err != nil {
-			off = voff
-			return nil, off, ErrPrefixScan
+			return nil, off, err
+		}
+		return es.Keys(), off, nil
+	}
+
+	idx, ok := tx.db.BPTreeIdx[bucket]
+	if !ok {
+		return nil, off, bucketNotFound(ErrPrefixScan)
+	}
+
+	records, voff, err := idx.PrefixScan(prefix, offsetNum, limitNum)
+	off = voff
+	if err != nil {
+		return nil, off, ErrPrefixScan
+	}
+
+	if keys, err = tx.getHintIdxKeysWrapper(records, limitNum); err != nil {
+		return nil, off, err
+	}
+
+	if len(keys) == 0 {
+		return nil, off, ErrPrefixScan
+	}
+
+	return
+}
+
+// PrefixScanCursor iterates over a key prefix at given bucket, prefix and limitNum, starting
+// after the cursor returned by the previous page, or from the first key if cursor is empty.
+// It returns the next cursor, which is empty on the last page. The cursor is the opaque
+// position of the last key returned, so the pages stay consistent across transactions:
+// keys written or deleted before the position do not shift the next pages.
+func (tx *Tx) PrefixScanCursor(bucket string, prefix []byte, cursor string, limitNum int) (es Entries, next string, err error) {
+	after, err := decodeCursor(prefix, cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	cmp := tx.keyCompare(bucket)
+	pending := tx.pendingScan(bucket, func(key []byte) bool {
+		return bytes.HasPrefix(key, prefix) && (after == nil || cmp(key, after) > 0)
+	})
+	if pending == nil {
+		return tx.prefixScanCursor(bucket, prefix, cursor, limitNum)
+	}
+
+	es, _, err = tx.prefixScanCursor(bucket, prefix, cursor, ScanNoLimit)
+	if es, err = scanWithPending(es, err, pending, cmp, false, ErrPrefixScan); err != nil {
+		return nil, "", err
+	}
+
+	if limitNum > 0 && len(es) > limitNum {
+		es = es[:limitNum]
+		next = encodeCursor(es[len(es)-1].Key)
+	}
+
+	return es, next, nil
+}
+
+// prefixScanCursor is PrefixScanCursor without the pending writes of the tx.
+func (tx *Tx) prefixScanCursor(bucket string, prefix []byte, cursor string, limitNum int) (es Entries, next string, err error) {
+	if err := tx.checkTxIsClosed(); err != nil {
+		return nil, "", err
+	}
+
+	after, err := decodeCursor(prefix, cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if tx.db.opt.EntryIdxMode == HintBPTSparseIdxMode {
+		return tx.prefixScanCursorByHintBPTSparseIdx(bucket, prefix, after, limitNum)
+	}
+
+	idx, ok := tx.db.BPTreeIdx[bucket]
+	if !ok {
+		return nil, "", ErrPrefixScan
+	}
+
+	start := prefix
+	if after != nil {
+		start = after
+	}
+
+	var (
+		records Records
+		more    bool
+	)
+	idx.ascend(start, func(key []byte, r *Record) bool {
+		if !bytes.HasPrefix(key, prefix) {
+			return false
+		}
+
+		if after != nil && idx.compare(key, after) <= 0 {
+			return true
+		}
+
+		if tx.isSnapshot {
+			if r = r.visible(tx.snapshotSeq); r == nil {
+				return true
+			}
+		}
+
+		if r.H.meta.Flag == DataDeleteFlag || r.IsExpired() {
+			return true
+		}
+
+		if limitNum > 0 && len(records) == limitNum {
+			more = true
+			return false
 		}
 
+		records = append(records, r)
+
+		return true
+	})
+
+	es, err = tx.getHintIdxDataItemsWrapper(records, ScanNoLimit, es, PrefixScan)
+	if err != nil {
+		return nil, "", tx.ctxErrOr(ErrPrefixScan)
+	}
+
+	if len(es) == 0 {
+		return nil, "", ErrPrefixScan
+	}
+
+	if more {
+		next = encodeCursor(es[len(es)-1].Key)
+	}
+
+	return es, next, nil
+}
+
+// prefixScanCursorByHintBPTSparseIdx returns the page of the keys with the prefix after the key.
+// The active index and the b+ trees of the data files are walked from the key, each one stops
+// after limitNum+1 entries, so the keys are all read up to the first key a tree stops at and the
+// page goes on from there if it is not full, instead of scanning all the keys of the prefix.
+func (tx *Tx) prefixScanCursorByHintBPTSparseIdx(bucket string, prefix, after []byte, limitNum int) (es Entries, next string, err error) {
+	newPrefix := getNewKey(bucket, prefix)
+	start := newPrefix
+	if after != nil {
+		start = getNewKey(bucket, after)
+	}
+
+	n := 0
+	if limitNum > 0 {
+		n = limitNum + 1
+	}
+
+	roots := tx.db.BPTreeRootIdxes
+	SortFID(roots, func(p, q *BPTreeRootIdx) bool {
+		return p.fID > q.fID
+	})
+
+	for exclusive := after != nil; ; exclusive = true {
+		entries, bound, err := tx.sparsePrefixRound(bucket, newPrefix, start, exclusive, n, roots)
+		if err != nil {
+			return nil, "", err
+		}
+		es = append(es, entries...)
+
+		if limitNum > 0 && len(es) > limitNum {
+			es = es[:limitNum]
+			next = encodeCursor(es[len(es)-1].Key)
+			break
+		}
+
+		if bound == nil {
+			break
+		}
+		start = bound
+	}
+
+	if len(es) == 0 {
+		return nil, "", ErrPrefixScan
+	}
+
+	return es, next, nil
+}
+
+// sparsePrefixRound returns the live entries of the keys with the new prefix after start, or from
+// start if it is not exclusive, reading at most n entries of the active index and of each b+ tree
+// on disk, or all of them if n is 0. The newest entry of a key is the one of the active index,
+// then the one of the newest data file. The keys are returned up to bound, the first key a tree
+// stops at, which is nil if none stops before the end of the prefix.
+func (tx *Tx) sparsePrefixRound(bucket string, newPrefix, start []byte, exclusive bool, n int, roots []*BPTreeRootIdx) (es Entries, bound []byte, err error) {
+	var (
+		keys    []string
+		seen    = make(map[string]struct{})
+		records = make(map[string]*Record)
+		entries = make(map[string]*Entry)
+	)
+
+	// tree returns the visitor of the keys of a tree, it tells if the key is new and if the walk goes on.
+	tree := func() func(newKey []byte, b string) (add, more bool) {
+		var (
+			read int
+			last []byte
+		)
+		return func(newKey []byte, b string) (bool, bool) {
+			if !bytes.HasPrefix(newKey, newPrefix) {
+				return false, false
+			}
+			if exclusive && compare(newKey, start) == 0 || b != bucket {
+				return false, true
+			}
+			if n > 0 && read == n {
+				if bound == nil || compare(last, bound) < 0 {
+					bound = last
+				}
+				return false, false
+			}
+			read++
+			last = newKey
+
+			if _, ok := seen[string(newKey)]; ok {
+				return false, true
+			}
+			seen[string(newKey)] = struct{}{}
+			keys = append(keys, string(newKey))
+			return true, true
+		}
+	}
+
+	visit := tree()
+	tx.db.ActiveBPTreeIdx.ascend(start, func(key []byte, r *Record) bool {
+		add, more := visit(key, string(r.H.meta.bucket))
+		if add {
+			records[string(key)] = r
+		}
+		return more
+	})
+
+	for _, root := range roots {
+		if err := tx.ctxErr(); err != nil {
+			return nil, nil, err
+		}
+
+		if compare(start, root.end) > 0 {
+			continue
+		}
+
+		visit := tree()
+		if err := tx.ascendOnDisk(int64(root.fID), int64(root.rootOff), start, func(newKey []byte, e *Entry) bool {
+			add, more := visit(newKey, string(e.Meta.bucket))
+			if add {
+				entries[string(newKey)] = e
+			}
+			return more
+		}); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	sort.Strings(keys)
+	for _, key := range keys {
+		if bound != nil && compare([]byte(key), bound) > 0 {
+			break
+		}
+
+		if r, ok := records[key]; ok {
+			if r.H.meta.Flag == DataDeleteFlag || r.IsExpired() {
+				continue
+			}
+
+			item, err := tx.db.readEntryAt(r.H.fileID, r.H.dataPos)
+			if err != nil {
+				return nil, nil, fmt.Errorf("HintIdx r.Hi.dataPos %d, err %s", r.H.dataPos, err)
+			}
+			es = append(es, item)
+			continue
+		}
+
+		if e := entries[key]; e.Meta.Flag != DataDeleteFlag && !IsExpired(e.Meta.TTL, e.Meta.timestamp) {
+			es = append(es, e)
+		}
+	}
+
+	return es, bound, nil
+}
+
+// ascendOnDisk calls fn with the keys with the bucket and the entries of the b+ tree of the data file
+// at fID, from the first key greater than or equal to newStart, until fn returns false.
+func (tx *Tx) ascendOnDisk(fID, rootOff int64, newStart []byte, fn func(newKey []byte, entry *Entry) bool) error {
+	curr, err := tx.FindLeafOnDisk(fID, rootOff, nil, newStart)
+	if err != nil {
+		return err
+	}
+
+	j, err := tx.getStartIndexForFindPrefix(fID, curr, newStart)
+	if err != nil {
+		return err
+	}
+
+	for {
+		for i := j; i < curr.KeysNum; i++ {
+			entry, err := tx.db.readEntryAt(fID, uint64(curr.Keys[i]))
+			if err != nil {
+				return err
+			}
+
+			if !fn(getNewKey(string(entry.Meta.bucket), entry.Key), entry) {
+				return nil
+			}
+		}
+
+		if curr.NextAddress == DefaultInvalidAddress {
+			return nil
+		}
+		if curr, err = tx.db.readBPTNode(fID, curr.NextAddress); err != nil {
+			return err
+		}
+		j = 0
+	}
+}
+
+// encodeCursor returns the cursor of a scan positioned at the key.
+func encodeCursor(key []byte) string {
+	return base64.RawURLEncoding.EncodeToString(key)
+}
+
+// decodeCursor returns the key of the cursor, or nil if the cursor is empty.
+func decodeCursor(prefix []byte, cursor string) ([]byte, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+
+	key, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || !bytes.HasPrefix(key, prefix) {
+		return nil, ErrInvalidCursor
+	}
+
+	return key, nil
+}
+
+// the kinds of the cursors of the list, set and sorted set scans,
+// they start the position so that a cursor is not used for another scan.
+const (
+	listCursor = 'l'
+	setCursor  = 's'
+	zSetCursor = 'z'
+)
+
+// encodeKindCursor returns the cursor of the scan of the kind positioned at pos.
+func encodeKindCursor(kind byte, pos []byte) string {
+	return encodeCursor(append([]byte{kind}, pos...))
+}
+
+// decodeKindCursor returns the position of the cursor of the scan of the kind, or nil if the cursor is empty.
+func decodeKindCursor(kind byte, cursor string) ([]byte, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+
+	pos, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(pos) == 0 || pos[0] != kind {
+		return nil, ErrInvalidCursor
+	}
+
+	return pos[1:], nil
+}
+
+// PrefixScanReverse iterates over a key prefix at given bucket, prefix and limitNum,
+// the entries are returned in descending order of the keys, so the offsetNum skips the last keys.
+// LimitNum will limit the number of entries return.
+func (tx *Tx) PrefixScanReverse(bucket string, prefix []byte, offsetNum int, limitNum int) (es Entries, off int, err error) {
+	if pending := tx.pendingScan(bucket, hasPrefix(prefix)); pending != nil {
+		es, _, err = tx.prefixScanReverse(bucket, prefix, 0, ScanNoLimit)
+		return pageWithPending(es, err, pending, tx.keyCompare(bucket), true, offsetNum, limitNum, ErrPrefixScan)
+	}
+
+	return tx.prefixScanReverse(bucket, prefix, offsetNum, limitNum)
+}
+
+// prefixScanReverse is PrefixScanReverse without the pending writes of the tx.
+func (tx *Tx) prefixScanReverse(bucket string, prefix []byte, offsetNum int, limitNum int) (es Entries, off int, err error) {
+
+	if err := tx.checkTxIsClosed(); err != nil {
+		return nil, off, err
+	}
+
+	if tx.db.opt.EntryIdxMode == HintBPTSparseIdxMode {
+		return tx.prefixScanReverseByHintBPTSparseIdx(bucket, prefix, offsetNum, limitNum)
+	}
+
+	idx, ok := tx.db.BPTreeIdx[bucket]
+	if !ok {
+		return nil, off, bucketNotFound(ErrPrefixScan)
+	}
+
+	records, voff, err := idx.PrefixScanReverse(prefix, offsetNum, limitNum)
+	if err != nil {
 		off = voff
+		return nil, off, ErrPrefixScan
+	}
 
+	es, err = tx.getHintIdxDataItemsWrapper(records, limitNum, es, PrefixScan)
+	if err != nil {
+		off = voff
+		return nil, off, tx.ctxErrOr(ErrPrefixScan)
 	}
 
+	off = voff
+
 	if len(es) == 0 {
 		return nil, off, ErrPrefixScan
 	}
@@ -779,9 +1528,48 @@ func (tx *Tx) PrefixScan(bucket string, prefix []byte, offsetNum int, limitNum i
 	return
 }
 
+// prefixScanReverseByHintBPTSparseIdx scans all the keys with the prefix and reverses them,
+// since the b+ tree on disk can only be walked forward.
+func (tx *Tx) prefixScanReverseByHintBPTSparseIdx(bucket string, prefix []byte, offsetNum int, limitNum int) (es Entries, off int, err error) {
+	all, _, err := tx.prefixScanByHintBPTSparseIdx(bucket, prefix, 0, ScanNoLimit)
+	if err != nil {
+		return nil, off, err
+	}
+
+	all = reverseEntries(all)
+
+	off = offsetNum
+	if off > len(all) {
+		off = len(all)
+	}
+	all = all[off:]
+
+	if limitNum > 0 && limitNum < len(all) {
+		all = all[:limitNum]
+	}
+
+	if len(all) == 0 {
+		return nil, off, ErrPrefixScan
+	}
+
+	return all, off, nil
+}
+
 // PrefixSearchScan iterates over a key prefix at given bucket, prefix, match regular expression and limitNum.
 // LimitNum will limit the number of entries return.
 func (tx *Tx) PrefixSearchScan(bucket string, prefix []byte, reg string, offsetNum int, limitNum int) (es Entries, off int, err error) {
+	if match := pendingPrefixMatch(prefix, reg); match != nil {
+		if pending := tx.pendingScan(bucket, match); pending != nil {
+			es, _, err = tx.prefixSearchScan(bucket, prefix, reg, 0, ScanNoLimit)
+			return pageWithPending(es, err, pending, tx.keyCompare(bucket), false, offsetNum, limitNum, ErrPrefixSearchScan)
+		}
+	}
+
+	return tx.prefixSearchScan(bucket, prefix, reg, offsetNum, limitNum)
+}
+
+// prefixSearchScan is PrefixSearchScan without the pending writes of the tx.
+func (tx *Tx) prefixSearchScan(bucket string, prefix []byte, reg string, offsetNum int, limitNum int) (es Entries, off int, err error) {
 
 	if err := tx.checkTxIsClosed(); err != nil {
 		return nil, off, err
@@ -791,23 +1579,25 @@ func (tx *Tx) PrefixSearchScan(bucket string, prefix []byte, reg string, offsetN
 		return tx.prefixSearchScanByHintBPTSparseIdx(bucket, prefix, reg, offsetNum, limitNum)
 	}
 
-	if idx, ok := tx.db.BPTreeIdx[bucket]; ok {
-		records, voff, err := idx.PrefixSearchScan(prefix, reg, offsetNum, limitNum)
-		if err != nil {
-			off = voff
-			return nil, off, ErrPrefixSearchScan
-		}
-
-		es, err = tx.getHintIdxDataItemsWrapper(records, limitNum, es, PrefixSearchScan)
-		if err != nil {
-			off = voff
-			return nil, off, ErrPrefixSearchScan
-		}
+	idx, ok := tx.db.BPTreeIdx[bucket]
+	if !ok {
+		return nil, off, bucketNotFound(ErrPrefixSearchScan)
+	}
 
+	records, voff, err := idx.PrefixSearchScan(prefix, reg, offsetNum, limitNum)
+	if err != nil {
 		off = voff
+		return nil, off, ErrPrefixSearchScan
+	}
 
+	es, err = tx.getHintIdxDataItemsWrapper(records, limitNum, es, PrefixSearchScan)
+	if err != nil {
+		off = voff
+		return nil, off, tx.ctxErrOr(ErrPrefixSearchScan)
 	}
 
+	off = voff
+
 	if len(es) == 0 {
 		return nil, off, ErrPrefixSearchScan
 	}
@@ -815,6 +1605,96 @@ func (tx *Tx) PrefixSearchScan(bucket string, prefix []byte, reg string, offsetN
 	return
 }
 
+// GlobScan iterates over the keys matching a glob pattern at given bucket, pattern and limitNum.
+// In the pattern, '*' matches any sequence of bytes, '?' matches any single character,
+// '[abc]', '[a-z]' and '[!a-z]' match a character class, and '\' escapes the next character.
+// The literal part of the pattern before the first wildcard is scanned as a prefix,
+// so only the keys with this prefix are matched against the rest of the pattern.
+// OffsetNum and limitNum constrain the entries returned as in PrefixSearchScan.
+func (tx *Tx) GlobScan(bucket string, pattern string, offsetNum int, limitNum int) (es Entries, off int, err error) {
+	prefix, reg, err := globToRegexp(pattern)
+	if err != nil {
+		return nil, off, err
+	}
+
+	return tx.PrefixSearchScan(bucket, prefix, reg, offsetNum, limitNum)
+}
+
+// globToRegexp splits a glob pattern into its literal prefix and the regular expression
+// matching the rest of the key.
+func globToRegexp(pattern string) (prefix []byte, reg string, err error) {
+	i := 0
+	for ; i < len(pattern); i++ {
+		c := pattern[i]
+		if c == '*' || c == '?' || c == '[' {
+			break
+		}
+		if c == '\\' {
+			if i++; i == len(pattern) {
+				return nil, "", ErrBadPattern
+			}
+		}
+		prefix = append(prefix, pattern[i])
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("(?s)^")
+
+	for ; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			buf.WriteString(".*")
+		case '?':
+			buf.WriteString(".")
+		case '\\':
+			if i++; i == len(pattern) {
+				return nil, "", ErrBadPattern
+			}
+			buf.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				return nil, "", ErrBadPattern
+			}
+			class := pattern[i+1 : i+1+end]
+			if len(class) > 0 && (class[0] == '!' || class[0] == '^') {
+				buf.WriteString("[^")
+				class = class[1:]
+			} else {
+				buf.WriteString("[")
+			}
+			if class == "" {
+				return nil, "", ErrBadPattern
+			}
+			for j := 0; j < len(class); j++ {
+				if class[j] == '-' || class[j] >= 0x80 || isAlnum(class[j]) {
+					buf.WriteByte(class[j])
+				} else {
+					buf.WriteByte('\\')
+					buf.WriteByte(class[j])
+				}
+			}
+			buf.WriteString("]")
+			i += end + 1
+		default:
+			buf.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+
+	buf.WriteString("$")
+
+	if _, err := regexp.Compile(buf.String()); err != nil {
+		return nil, "", ErrBadPattern
+	}
+
+	return prefix, buf.String(), nil
+}
+
+// isAlnum returns if c is an ASCII letter or digit.
+func isAlnum(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
 // Delete removes a key from the bucket at given bucket and key.
 func (tx *Tx) Delete(bucket string, key []byte) error {
 	if err := tx.checkTxIsClosed(); err != nil {
@@ -824,39 +1704,262 @@ func (tx *Tx) Delete(bucket string, key []byte) error {
 	return tx.put(bucket, key, nil, Persistent, DataDeleteFlag, uint64(time.Now().Unix()), DataStructureBPTree)
 }
 
+// GetTTL returns the remaining TTL in seconds of a key in the bucket at given bucket and key,
+// or Persistent if the key never expires.
+func (tx *Tx) GetTTL(bucket string, key []byte) (uint32, error) {
+	e, err := tx.Get(bucket, key)
+	if err != nil {
+		return 0, err
+	}
+
+	if e.Meta.TTL == Persistent {
+		return Persistent, nil
+	}
+
+	remaining := int64(e.Meta.timestamp) + int64(e.Meta.TTL) - time.Now().Unix()
+	if remaining <= 0 {
+		return 0, ErrNotFoundKey
+	}
+
+	return uint32(remaining), nil
+}
+
+// UpdateTTL sets the TTL in seconds of a key in the bucket at given bucket and key, counted from now,
+// Persistent makes the key never expire. The value is kept as it is, but since the data files are
+// append-only, the entry is written again with its new TTL.
+func (tx *Tx) UpdateTTL(bucket string, key []byte, ttl uint32) error {
+	e, err := tx.Get(bucket, key)
+	if err != nil {
+		return err
+	}
+
+	return tx.put(bucket, key, e.Value, ttl, DataSetFlag, uint64(time.Now().Unix()), DataStructureBPTree)
+}
+
+// Persist removes the TTL of a key in the bucket at given bucket and key, so that it never expires.
+func (tx *Tx) Persist(bucket string, key []byte) error {
+	return tx.UpdateTTL(bucket, key, Persistent)
+}
+
+// Incr adds delta to the integer value of a key in the bucket at given bucket, key and delta, and
+// returns the new value. A missing key is created at zero, with the default TTL of the bucket like
+// Put, and the TTL of an existing key is kept. The value is stored as an 8 bytes big endian int64, see EncodeInt64.
+func (tx *Tx) Incr(bucket string, key []byte, delta int64) (int64, error) {
+	return tx.incr(bucket, key, delta, false)
+}
+
+// Decr subtracts delta from the integer value of a key in the bucket at given bucket, key and delta,
+// and returns the new value, like Incr.
+func (tx *Tx) Decr(bucket string, key []byte, delta int64) (int64, error) {
+	return tx.incr(bucket, key, delta, true)
+}
+
+func (tx *Tx) incr(bucket string, key []byte, delta int64, decr bool) (int64, error) {
+	if err := tx.checkTxIsWritable(); err != nil {
+		return 0, err
+	}
+
+	var (
+		value     int64
+		ttl       = Persistent
+		timestamp = uint64(time.Now().Unix())
+	)
+
+	e, err := tx.current(bucket, key)
+	if err != nil {
+		return 0, err
+	}
+
+	if e != nil {
+		v, err := DecodeInt64(e.Value)
+		if err != nil {
+			return 0, err
+		}
+		value, ttl, timestamp = v, e.Meta.TTL, e.Meta.timestamp
+	} else {
+		ttl = tx.keyTTL(bucket, Persistent)
+	}
+
+	if decr {
+		if delta > 0 && value < math.MinInt64+delta || delta < 0 && value > math.MaxInt64+delta {
+			return 0, ErrIntegerOverflow
+		}
+		value -= delta
+	} else {
+		if delta > 0 && value > math.MaxInt64-delta || delta < 0 && value < math.MinInt64-delta {
+			return 0, ErrIntegerOverflow
+		}
+		value += delta
+	}
+
+	if err := tx.put(bucket, key, EncodeInt64(value), ttl, DataSetFlag, timestamp, DataStructureBPTree); err != nil {
+		return 0, err
+	}
+
+	return value, nil
+}
+
+// PutIfNotExists sets the value for a key in the bucket like Put, only if the key does not exist,
+// otherwise it returns ErrKeyExists.
+func (tx *Tx) PutIfNotExists(bucket string, key, value []byte, ttl uint32) error {
+	if err := tx.checkTxIsWritable(); err != nil {
+		return err
+	}
+
+	e, err := tx.current(bucket, key)
+	if err != nil {
+		return err
+	}
+	if e != nil {
+		return ErrKeyExists
+	}
+
+	return tx.Put(bucket, key, value, ttl)
+}
+
+// PutIfEqual sets the value for a key in the bucket like Put, only if its current value is oldValue,
+// otherwise it returns ErrConflict.
+func (tx *Tx) PutIfEqual(bucket string, key, oldValue, newValue []byte, ttl uint32) error {
+	if err := tx.checkTxIsWritable(); err != nil {
+		return err
+	}
+
+	e, err := tx.current(bucket, key)
+	if err != nil {
+		return err
+	}
+	if e == nil || !bytes.Equal(e.Value, oldValue) {
+		return ErrConflict
+	}
+
+	return tx.Put(bucket, key, newValue, ttl)
+}
+
+// PutIfVersion sets the value for a key in the bucket like Put, only if the version of the key is
+// still the Entry.Version read before, otherwise it returns ErrConflict. It lets an application read
+// a key in a read-only tx, and write it later without holding a read/write tx open in between.
+func (tx *Tx) PutIfVersion(bucket string, key, value []byte, ttl uint32, version uint64) error {
+	if err := tx.checkTxIsWritable(); err != nil {
+		return err
+	}
+
+	e, err := tx.current(bucket, key)
+	if err != nil {
+		return err
+	}
+	if e == nil || e.Version() != version {
+		return ErrConflict
+	}
+
+	return tx.Put(bucket, key, value, ttl)
+}
+
+// checkTxIsWritable returns an error if the tx is closed or read-only.
+func (tx *Tx) checkTxIsWritable() error {
+	if err := tx.checkTxIsClosed(); err != nil {
+		return err
+	}
+
+	if !tx.writable {
+		return ErrTxNotWritable
+	}
+
+	return nil
+}
+
+// current returns the live entry of a key in the bucket at given bucket and key, with the writes
+// of the tx, or nil if the key does not exist.
+func (tx *Tx) current(bucket string, key []byte) (*Entry, error) {
+	e, err := tx.Get(bucket, key)
+	if err != nil {
+		if errors.Is(err, ErrKeyNotFound) || errors.Is(err, ErrBucketNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// EncodeInt64 returns the 8 bytes big endian encoding of v used by Incr and Decr.
+func EncodeInt64(v int64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(v))
+	return buf
+}
+
+// DecodeInt64 decodes a value written by Incr and Decr, it returns ErrValueNotInteger if the value is not 8 bytes long.
+func DecodeInt64(value []byte) (int64, error) {
+	if len(value) != 8 {
+		return 0, ErrValueNotInteger
+	}
+
+	return int64(binary.BigEndian.Uint64(value)), nil
+}
+
 // getHintIdxDataItemsWrapper returns wrapped entries when prefix scanning or range scanning.
 func (tx *Tx) getHintIdxDataItemsWrapper(records Records, limitNum int, es Entries, scanMode string) (Entries, error) {
-	for _, r := range records {
+	for i, r := range records {
+		if i%ctxCheckInterval == 0 {
+			if err := tx.ctxErr(); err != nil {
+				return nil, err
+			}
+		}
+
+		if tx.isSnapshot {
+			if r = r.visible(tx.snapshotSeq); r == nil {
+				continue
+			}
+		}
+
 		if r.H.meta.Flag == DataDeleteFlag || r.IsExpired() {
 			continue
 		}
 
 		if limitNum > 0 && len(es) < limitNum || limitNum == ScanNoLimit {
-			idxMode := tx.db.opt.EntryIdxMode
-			if idxMode == HintKeyAndRAMIdxMode {
-				path := tx.db.getDataPath(r.H.fileID)
-				df, err := NewDataFile(path, tx.db.opt.SegmentSize, tx.db.opt.RWMode)
-				if err != nil {
-					return nil, err
-				}
-				if item, err := df.ReadAt(int(r.H.dataPos)); err == nil {
-					es = append(es, item)
-				} else {
-					df.rwManager.Close()
-					return nil, fmt.Errorf("HintIdx r.Hi.dataPos %d, err %s", r.H.dataPos, err)
-				}
-				df.rwManager.Close()
+			if r.E != nil {
+				es = append(es, r.E)
+				continue
 			}
 
-			if idxMode == HintKeyValAndRAMIdxMode {
-				es = append(es, r.E)
+			item, err := tx.db.readEntryAt(r.H.fileID, r.H.dataPos)
+			if err != nil {
+				return nil, fmt.Errorf("HintIdx r.Hi.dataPos %d, err %s", r.H.dataPos, err)
 			}
+			es = append(es, item)
 		}
 	}
 
 	return es, nil
 }
 
+// getHintIdxKeysWrapper returns the keys of the live records when prefix scanning or range scanning keys.
+func (tx *Tx) getHintIdxKeysWrapper(records Records, limitNum int) (keys [][]byte, err error) {
+	for i, r := range records {
+		if i%ctxCheckInterval == 0 {
+			if err := tx.ctxErr(); err != nil {
+				return nil, err
+			}
+		}
+
+		if tx.isSnapshot {
+			if r = r.visible(tx.snapshotSeq); r == nil {
+				continue
+			}
+		}
+
+		if r.H.meta.Flag == DataDeleteFlag || r.IsExpired() {
+			continue
+		}
+
+		if limitNum > 0 && len(keys) < limitNum || limitNum == ScanNoLimit {
+			keys = append(keys, r.H.key)
+		}
+	}
+
+	return keys, nil
+}
+
 // FindTxIDOnDisk returns if txId on disk at given fid and txID.
 func (tx *Tx) FindTxIDOnDisk(fID, txID uint64) (ok bool, err error) {
 	var i uint16
@@ -914,7 +2017,6 @@ func (tx *Tx) FindOnDisk(fID uint64, rootOff uint64, key, newKey []byte) (entry
 	var (
 		bnLeaf *BinaryNode
 		i      uint16
-		df     *DataFile
 	)
 
 	bnLeaf, err = tx.FindLeafOnDisk(int64(fID), int64(rootOff), key, newKey)
@@ -924,14 +2026,7 @@ func (tx *Tx) FindOnDisk(fID uint64, rootOff uint64, key, newKey []byte) (entry
 	}
 
 	for i = 0; i < bnLeaf.KeysNum; i++ {
-		df, err = NewDataFile(tx.db.getDataPath(int64(fID)), tx.db.opt.SegmentSize, tx.db.opt.RWMode)
-		if err != nil {
-			return nil, err
-		}
-
-		entry, err = df.ReadAt(int(bnLeaf.Keys[i]))
-		df.rwManager.Close()
-
+		entry, err = tx.db.readEntryAt(int64(fID), uint64(bnLeaf.Keys[i]))
 		if err != nil {
 			return nil, err
 		}
@@ -951,40 +2046,22 @@ func (tx *Tx) FindOnDisk(fID uint64, rootOff uint64, key, newKey []byte) (entry
 
 // FindLeafOnDisk returns binary leaf node on disk at given fId, rootOff and key.
 func (tx *Tx) FindLeafOnDisk(fID int64, rootOff int64, key, newKey []byte) (bn *BinaryNode, err error) {
-	var i uint16
-	var curr *BinaryNode
-
-	filepath := tx.db.getBPTPath(fID)
-	curr, err = ReadNode(filepath, rootOff)
+	address := rootOff
+	curr, err := tx.db.readBPTNode(fID, address)
 	if err != nil {
 		return nil, err
 	}
 
 	for curr.IsLeaf != 1 {
-		i = 0
-		for i < curr.KeysNum {
-			df, err := NewDataFile(tx.db.getDataPath(fID), tx.db.opt.SegmentSize, tx.db.opt.RWMode)
-			if err != nil {
-				return nil, err
-			}
-
-			item, err := df.ReadAt(int(curr.Keys[i]))
-			df.rwManager.Close()
-
-			if err != nil {
-				return nil, err
-			}
-
-			newKeyTemp := getNewKey(string(item.Meta.bucket), item.Key)
-			if compare(newKey, newKeyTemp) >= 0 {
-				i++
-			} else {
-				break
-			}
+		i, err := tx.db.bptChildIndex(fID, address, curr, newKey)
+		if err != nil {
+			return nil, err
 		}
-		address := curr.Pointers[i]
 
-		curr, err = ReadNode(filepath, address)
+		address = curr.Pointers[i]
+		if curr, err = tx.db.readBPTNode(fID, address); err != nil {
+			return nil, err
+		}
 	}
 
 	return curr, nil
@@ -15,8 +15,10 @@
 package nutsdb
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"os"
 	"testing"
 
@@ -227,12 +229,10 @@ func TestTx_RangeScan_Err(t *testing.T) {
 
 	start := []byte("key_0010001")
 	end := []byte("key_0010010")
-	if _, err := tx.RangeScan(bucket, start, end); err != nil {
-		//tx rollback
-		tx.Rollback()
-	} else {
+	if es, err := tx.RangeScan(bucket, start, end); err != nil || len(es) != 0 {
 		t.Error("err range scan")
 	}
+	tx.Commit()
 }
 
 func TestTx_RangeScan(t *testing.T) {
@@ -629,18 +629,18 @@ func TestTx_Put_Err(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	key = []byte("key_bigone")
-	var bigVal string
+	// the values too big for a data file are written to an overflow file, the keys are not.
+	var bigKey string
 	for i := 1; i <= 9*1024; i++ {
-		bigVal += "val" + strconv2.IntToStr(i)
+		bigKey += "key" + strconv2.IntToStr(i)
 	}
 
-	tx.Put(bucket, key, []byte(bigVal), Persistent)
+	tx.Put(bucket, []byte(bigKey), []byte("val"), Persistent)
 
 	if err = tx.Commit(); err != nil {
 		tx.Rollback()
 	} else {
-		t.Error("err put too big val")
+		t.Error("err put too big key")
 	}
 
 }
@@ -829,15 +829,29 @@ func TestTx_RangeScan_NotFound(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	// an empty range has an empty result.
 	start := []byte("key_011")
 	end := []byte("key_012")
-	_, err = tx.RangeScan(bucket, start, end)
-	if err != nil {
-		tx.Rollback()
-	} else {
-		tx.Commit()
-		t.Error("err TestTx_RangeScan_NotFound")
+	es, err := tx.RangeScan(bucket, start, end)
+	if err != nil || len(es) != 0 {
+		t.Errorf("err TestTx_RangeScan_NotFound, got %d entries and err %v", len(es), err)
+	}
+
+	keys, err := tx.RangeScanKeys(bucket, start, end)
+	if err != nil || len(keys) != 0 {
+		t.Errorf("err TestTx_RangeScan_NotFound, got %d keys and err %v", len(keys), err)
+	}
+
+	// the start key after the end key is not a range.
+	if _, err = tx.RangeScan(bucket, end, start); err != ErrRangeScan {
+		t.Errorf("err TestTx_RangeScan_NotFound, got err %v want %v", err, ErrRangeScan)
+	}
+
+	// the bucket is not found.
+	if _, err = tx.RangeScan("bucket_range_scan_fake", start, end); !errors.Is(err, ErrBucketNotFound) {
+		t.Errorf("err TestTx_RangeScan_NotFound, got err %v want %v", err, ErrBucketNotFound)
 	}
+	tx.Commit()
 }
 
 func TestTx_Get_SCan_For_BPTSparseIdxMode(t *testing.T) {
@@ -982,6 +996,89 @@ func TestTx_SCan_For_BPTSparseIdxMode(t *testing.T) {
 
 }
 
+func testReverseScans(t *testing.T) {
+	bucket := "bucket_for_reverse_scan"
+
+	if err := db.Update(func(tx *Tx) error {
+		for i := 0; i <= 20; i++ {
+			key := []byte("key_" + fmt.Sprintf("%07d", i))
+			val := []byte("val_" + fmt.Sprintf("%07d", i))
+			if err := tx.Put(bucket, key, val, Persistent); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.View(func(tx *Tx) error {
+		startKey := []byte("key_" + fmt.Sprintf("%07d", 1))
+		endKey := []byte("key_" + fmt.Sprintf("%07d", 9))
+		es, err := tx.RangeScanReverse(bucket, startKey, endKey)
+		if err != nil {
+			return err
+		}
+
+		if len(es) != 9 {
+			t.Fatalf("err RangeScanReverse. got %d entries want %d", len(es), 9)
+		}
+
+		for i, e := range es {
+			key := "key_" + fmt.Sprintf("%07d", 9-i)
+			if string(e.Key) != key {
+				t.Errorf("err RangeScanReverse. got %s want %s", string(e.Key), key)
+			}
+		}
+
+		es, off, err := tx.PrefixScanReverse(bucket, []byte("key_"), 2, 5)
+		if err != nil {
+			return err
+		}
+
+		if off != 2 || len(es) != 5 {
+			t.Fatalf("err PrefixScanReverse. got off %d and %d entries", off, len(es))
+		}
+
+		for i, e := range es {
+			key := "key_" + fmt.Sprintf("%07d", 18-i)
+			if string(e.Key) != key {
+				t.Errorf("err PrefixScanReverse. got %s want %s", string(e.Key), key)
+			}
+		}
+
+		if _, _, err := tx.PrefixScanReverse(bucket, []byte("foo_"), 0, 5); err == nil {
+			t.Error("err PrefixScanReverse")
+		}
+
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTx_ReverseScans(t *testing.T) {
+	Init()
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	testReverseScans(t)
+}
+
+func TestTx_ReverseScans_For_BPTSparseIdxMode(t *testing.T) {
+	InitForBPTSparseIdxMode()
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	testReverseScans(t)
+}
+
 func TestTx_Notfound_For_BPTSparseIdxMode(t *testing.T) {
 	InitForBPTSparseIdxMode()
 	db, err = Open(opt)
@@ -1048,3 +1145,831 @@ func TestTx_Notfound_For_BPTSparseIdxMode(t *testing.T) {
 	}
 	tx.Commit()
 }
+
+func TestTx_ScanKeys(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestforscankeys", true)
+	opt.EntryIdxMode = HintKeyAndRAMIdxMode
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	bucket := "bucket_for_scan_keys"
+	if err := db.Update(func(tx *Tx) error {
+		for i := 0; i < 5; i++ {
+			if err := tx.Put(bucket, []byte(fmt.Sprintf("key_%d", i)), []byte("val"), Persistent); err != nil {
+				return err
+			}
+		}
+		return tx.Put(bucket, []byte("other"), []byte("val"), Persistent)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Update(func(tx *Tx) error {
+		return tx.Delete(bucket, []byte("key_1"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the keys are scanned without reading the data files.
+	db.fileCache = newDataFileCache(1, func(fID int64) (*DataFile, error) {
+		return nil, errors.New("data file read")
+	})
+
+	if err := db.View(func(tx *Tx) error {
+		keys, err := tx.RangeScanKeys(bucket, []byte("key_0"), []byte("key_3"))
+		if err != nil {
+			return err
+		}
+		if len(keys) != 3 || string(keys[0]) != "key_0" || string(keys[1]) != "key_2" || string(keys[2]) != "key_3" {
+			t.Errorf("err RangeScanKeys, got %q", keys)
+		}
+
+		keys, _, err = tx.PrefixScanKeys(bucket, []byte("key_"), 0, 10)
+		if err != nil {
+			return err
+		}
+		if len(keys) != 4 || string(keys[0]) != "key_0" || string(keys[3]) != "key_4" {
+			t.Errorf("err PrefixScanKeys, got %q", keys)
+		}
+
+		if _, _, err := tx.PrefixScanKeys(bucket, []byte("none_"), 0, 2); err != ErrPrefixScan {
+			t.Errorf("err PrefixScanKeys, got %v want %v", err, ErrPrefixScan)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTx_RangeScanFn(t *testing.T) {
+	for _, mode := range []EntryIdxMode{HintKeyValAndRAMIdxMode, HintKeyAndRAMIdxMode, HintBPTSparseIdxMode} {
+		InitOpt("/tmp/nutsdbtestforrangescanfn", true)
+		opt.EntryIdxMode = mode
+		db, err = Open(opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bucket := "bucket_for_range_scan_fn"
+		if err := db.Update(func(tx *Tx) error {
+			for i := 0; i < 5; i++ {
+				if err := tx.Put(bucket, []byte(fmt.Sprintf("key_%d", i)), []byte(fmt.Sprintf("val_%d", i)), Persistent); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := db.Update(func(tx *Tx) error {
+			scan := func(start, end string, limit int) (got []string) {
+				if err := tx.RangeScanFn(bucket, []byte(start), []byte(end), func(key, value []byte) bool {
+					got = append(got, string(key)+"="+string(value))
+					return len(got) < limit
+				}); err != nil {
+					t.Fatal(err)
+				}
+				return got
+			}
+
+			if got := fmt.Sprint(scan("key_1", "key_3", 10)); got != "[key_1=val_1 key_2=val_2 key_3=val_3]" {
+				t.Errorf("err RangeScanFn mode %d, got %s", mode, got)
+			}
+
+			// fn stops the scan.
+			if got := fmt.Sprint(scan("key_0", "key_4", 2)); got != "[key_0=val_0 key_1=val_1]" {
+				t.Errorf("err RangeScanFn stop mode %d, got %s", mode, got)
+			}
+
+			// an empty range calls fn with no entry.
+			if got := scan("key_5", "key_9", 10); len(got) != 0 {
+				t.Errorf("err RangeScanFn empty mode %d, got %s", mode, got)
+			}
+
+			// the pending writes of the tx are seen.
+			if err := tx.Delete(bucket, []byte("key_1")); err != nil {
+				return err
+			}
+			if err := tx.Put(bucket, []byte("key_2"), []byte("new"), Persistent); err != nil {
+				return err
+			}
+			if err := tx.Put(bucket, []byte("key_25"), []byte("val_25"), Persistent); err != nil {
+				return err
+			}
+			if got := fmt.Sprint(scan("key_0", "key_3", 10)); got != "[key_0=val_0 key_2=new key_25=val_25 key_3=val_3]" {
+				t.Errorf("err RangeScanFn pending mode %d, got %s", mode, got)
+			}
+
+			if err := tx.RangeScanFn(bucket, []byte("key_3"), []byte("key_1"), func(key, value []byte) bool {
+				return true
+			}); err != ErrRangeScan {
+				t.Errorf("err RangeScanFn mode %d, got err %v want %v", mode, err, ErrRangeScan)
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		db.Close()
+	}
+}
+
+func prefixScanPage(t *testing.T, bucket, prefix, cursor string, limitNum int) (keys []string, next string) {
+	if err := db.View(func(tx *Tx) error {
+		es, n, err := tx.PrefixScanCursor(bucket, []byte(prefix), cursor, limitNum)
+		for _, e := range es {
+			keys = append(keys, string(e.Key))
+		}
+		next = n
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	return
+}
+
+func TestTx_PrefixScanCursor(t *testing.T) {
+	for _, mode := range []EntryIdxMode{HintKeyValAndRAMIdxMode, HintKeyAndRAMIdxMode, HintBPTSparseIdxMode} {
+		InitOpt("/tmp/nutsdbtestforprefixscancursor", true)
+		opt.EntryIdxMode = mode
+		db, err = Open(opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bucket := "bucket_for_prefix_scan_cursor"
+		if err := db.Update(func(tx *Tx) error {
+			for i := 0; i < 5; i++ {
+				if err := tx.Put(bucket, []byte(fmt.Sprintf("key_%d", i)), []byte("val"), Persistent); err != nil {
+					return err
+				}
+			}
+			return tx.Put(bucket, []byte("other"), []byte("val"), Persistent)
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		keys, next := prefixScanPage(t, bucket, "key_", "", 2)
+		if len(keys) != 2 || keys[0] != "key_0" || keys[1] != "key_1" || next == "" {
+			t.Errorf("mode %d: err PrefixScanCursor, got %v %q", mode, keys, next)
+		}
+
+		// the writes before the cursor do not shift the next page.
+		if err := db.Update(func(tx *Tx) error {
+			if err := tx.Delete(bucket, []byte("key_0")); err != nil {
+				return err
+			}
+			return tx.Put(bucket, []byte("key_00"), []byte("val"), Persistent)
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		keys, next = prefixScanPage(t, bucket, "key_", next, 2)
+		if len(keys) != 2 || keys[0] != "key_2" || keys[1] != "key_3" || next == "" {
+			t.Errorf("mode %d: err PrefixScanCursor, got %v %q", mode, keys, next)
+		}
+
+		keys, next = prefixScanPage(t, bucket, "key_", next, 2)
+		if len(keys) != 1 || keys[0] != "key_4" || next != "" {
+			t.Errorf("mode %d: err PrefixScanCursor, got %v %q", mode, keys, next)
+		}
+
+		if err := db.View(func(tx *Tx) error {
+			if _, _, err := tx.PrefixScanCursor(bucket, []byte("key_"), encodeCursor([]byte("other")), 2); err != ErrInvalidCursor {
+				t.Errorf("mode %d: err PrefixScanCursor, got %v want %v", mode, err, ErrInvalidCursor)
+			}
+			if _, _, err := tx.PrefixScanCursor(bucket, []byte("key_"), encodeCursor([]byte("key_4")), 2); err != ErrPrefixScan {
+				t.Errorf("mode %d: err PrefixScanCursor, got %v want %v", mode, err, ErrPrefixScan)
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTx_PrefixScanCursor_DataFiles(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestforprefixscancursorfiles", true)
+	opt.EntryIdxMode = HintBPTSparseIdxMode
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bucket := "bucket_for_prefix_scan_cursor"
+	// the keys are written to several data files, then some are overwritten or deleted in the
+	// next ones, so that the pages read several b+ trees.
+	put := func(key string, del bool) {
+		if err := db.Update(func(tx *Tx) error {
+			if del {
+				return tx.Delete(bucket, []byte(key))
+			}
+			return tx.Put(bucket, []byte(key), []byte("val"), Persistent)
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 200; i++ {
+		put(fmt.Sprintf("key_%03d", i), false)
+	}
+	put("other", false)
+
+	live := make(map[string]bool)
+	for i := 0; i < 200; i++ {
+		live[fmt.Sprintf("key_%03d", i)] = true
+	}
+	for i := 0; i < 200; i += 3 {
+		put(fmt.Sprintf("key_%03d", i), i%2 == 0)
+		live[fmt.Sprintf("key_%03d", i)] = i%2 != 0
+	}
+
+	var want []string
+	for i := 0; i < 200; i++ {
+		if key := fmt.Sprintf("key_%03d", i); live[key] {
+			want = append(want, key)
+		}
+	}
+
+	for _, limitNum := range []int{1, 7, 50, ScanNoLimit} {
+		var (
+			got    []string
+			cursor string
+		)
+		for pages := 0; ; pages++ {
+			keys, next := prefixScanPage(t, bucket, "key_", cursor, limitNum)
+			if limitNum > 0 && len(keys) > limitNum || pages > len(want) {
+				t.Fatalf("limit %d: err PrefixScanCursor page, got %d keys", limitNum, len(keys))
+			}
+			got = append(got, keys...)
+			if next == "" {
+				break
+			}
+			cursor = next
+		}
+
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("limit %d: err PrefixScanCursor, got %v want %v", limitNum, got, want)
+		}
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTx_GetMulti(t *testing.T) {
+	for _, mode := range []EntryIdxMode{HintKeyValAndRAMIdxMode, HintKeyAndRAMIdxMode, HintBPTSparseIdxMode} {
+		InitOpt("/tmp/nutsdbtestforgetmulti", true)
+		opt.EntryIdxMode = mode
+		db, err = Open(opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bucket := "bucket_for_get_multi"
+		// the keys are written to several data files.
+		for i := 0; i < 200; i++ {
+			if err := db.Update(func(tx *Tx) error {
+				return tx.Put(bucket, []byte(fmt.Sprintf("key_%03d", i)), []byte(fmt.Sprintf("val_%03d", i)), Persistent)
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := db.Update(func(tx *Tx) error {
+			return tx.Delete(bucket, []byte("key_050"))
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		keys := [][]byte{[]byte("key_199"), []byte("key_000"), []byte("key_050"), []byte("none"), []byte("key_042")}
+		want := []string{"val_199", "val_000", "", "", "val_042"}
+
+		if err := db.View(func(tx *Tx) error {
+			es, err := tx.GetMulti(bucket, keys)
+			if err != nil {
+				return err
+			}
+
+			if len(es) != len(keys) {
+				t.Fatalf("mode %d: err GetMulti, got %d entries want %d", mode, len(es), len(keys))
+			}
+
+			for i, e := range es {
+				if want[i] == "" {
+					if e != nil {
+						t.Errorf("mode %d: err GetMulti %s, got %s want a miss", mode, keys[i], e.Value)
+					}
+					continue
+				}
+
+				if e == nil || string(e.Value) != want[i] {
+					t.Errorf("mode %d: err GetMulti %s, got %v want %s", mode, keys[i], e, want[i])
+				}
+			}
+
+			es, err = tx.GetMulti("none", keys)
+			if err != nil || len(es) != len(keys) || es[0] != nil {
+				t.Errorf("mode %d: err GetMulti in a missing bucket, got %v %v", mode, es, err)
+			}
+
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTx_UpdateTTL(t *testing.T) {
+	for _, mode := range []EntryIdxMode{HintKeyValAndRAMIdxMode, HintKeyAndRAMIdxMode, HintBPTSparseIdxMode} {
+		InitOpt("/tmp/nutsdbtestforupdatettl", true)
+		opt.EntryIdxMode = mode
+		db, err = Open(opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bucket := "bucket_for_update_ttl"
+		key := []byte("key")
+
+		getTTL := func() (ttl uint32, val string) {
+			if err := db.View(func(tx *Tx) error {
+				if ttl, err = tx.GetTTL(bucket, key); err != nil {
+					return err
+				}
+				e, err := tx.Get(bucket, key)
+				if err != nil {
+					return err
+				}
+				val = string(e.Value)
+				return nil
+			}); err != nil {
+				t.Fatalf("mode %d: %v", mode, err)
+			}
+			return
+		}
+
+		if err := db.Update(func(tx *Tx) error {
+			return tx.Put(bucket, key, []byte("val"), Persistent)
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if ttl, _ := getTTL(); ttl != Persistent {
+			t.Errorf("mode %d: err GetTTL, got %d want %d", mode, ttl, Persistent)
+		}
+
+		if err := db.Update(func(tx *Tx) error {
+			return tx.UpdateTTL(bucket, key, 100)
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if ttl, val := getTTL(); ttl < 99 || ttl > 100 || val != "val" {
+			t.Errorf("mode %d: err UpdateTTL, got %d %q", mode, ttl, val)
+		}
+
+		if err := db.Update(func(tx *Tx) error {
+			return tx.Persist(bucket, key)
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if ttl, val := getTTL(); ttl != Persistent || val != "val" {
+			t.Errorf("mode %d: err Persist, got %d %q", mode, ttl, val)
+		}
+
+		if err := db.Update(func(tx *Tx) error {
+			if err := tx.UpdateTTL(bucket, []byte("none"), 100); err == nil {
+				t.Errorf("mode %d: err UpdateTTL of a missing key", mode)
+			}
+			if _, err := tx.GetTTL(bucket, []byte("none")); err == nil {
+				t.Errorf("mode %d: err GetTTL of a missing key", mode)
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTx_NotFoundErrors(t *testing.T) {
+	Init()
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	bucket := "bucket_not_found_test"
+	if err := db.Update(func(tx *Tx) error {
+		if err := tx.Put(bucket, []byte("key"), []byte("val"), Persistent); err != nil {
+			return err
+		}
+		if err := tx.SAdd(bucket, []byte("key"), []byte("member")); err != nil {
+			return err
+		}
+		if err := tx.ZAdd(bucket, []byte("key"), 1, []byte("val")); err != nil {
+			return err
+		}
+		return tx.RPush(bucket, []byte("key"), []byte("item"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.View(func(tx *Tx) error {
+		check := func(name string, err, target error) {
+			if !errors.Is(err, target) {
+				t.Errorf("err %s, got %v want %v", name, err, target)
+			}
+		}
+
+		_, err := tx.Get("bucket_not_exists", []byte("key"))
+		check("Get", err, ErrBucketNotFound)
+		_, err = tx.Get(bucket, []byte("key_not_exists"))
+		check("Get", err, ErrKeyNotFound)
+		_, err = tx.GetAll("bucket_not_exists")
+		check("GetAll", err, ErrBucketNotFound)
+		_, err = tx.RangeScan("bucket_not_exists", []byte("a"), []byte("z"))
+		check("RangeScan", err, ErrBucketNotFound)
+		check("RangeScan", err, ErrRangeScan)
+		_, _, err = tx.PrefixScan("bucket_not_exists", []byte("key"), 0, ScanNoLimit)
+		check("PrefixScan", err, ErrBucketNotFound)
+		check("PrefixScan", err, ErrPrefixScan)
+		_, _, err = tx.PrefixSearchScan("bucket_not_exists", []byte("key"), "", 0, ScanNoLimit)
+		check("PrefixSearchScan", err, ErrBucketNotFound)
+
+		_, err = tx.SMembers("bucket_not_exists", []byte("key"))
+		check("SMembers", err, ErrBucketNotFound)
+		_, err = tx.SMembers(bucket, []byte("key_not_exists"))
+		check("SMembers", err, ErrKeyNotFound)
+		_, err = tx.SIsMember(bucket, []byte("key_not_exists"), []byte("member"))
+		check("SIsMember", err, ErrKeyNotFound)
+		_, err = tx.SUnionByOneBucket(bucket, []byte("key"), []byte("key_not_exists"))
+		check("SUnionByOneBucket", err, ErrKeyNotFound)
+		_, err = tx.SPop(bucket, []byte("key_not_exists"))
+		check("SPop", err, ErrKeyNotFound)
+
+		_, err = tx.LRange("bucket_not_exists", []byte("key"), 0, -1)
+		check("LRange", err, ErrBucketNotFound)
+		_, err = tx.LRange(bucket, []byte("key_not_exists"), 0, -1)
+		check("LRange", err, ErrKeyNotFound)
+		_, err = tx.LSize(bucket, []byte("key_not_exists"))
+		check("LSize", err, ErrKeyNotFound)
+
+		_, err = tx.ZMembers("bucket_not_exists")
+		check("ZMembers", err, ErrBucketNotFound)
+		_, err = tx.ZScore(bucket, []byte("key_not_exists"))
+		check("ZScore", err, ErrKeyNotFound)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTx_GlobScan(t *testing.T) {
+	for _, mode := range []EntryIdxMode{HintKeyValAndRAMIdxMode, HintKeyAndRAMIdxMode, HintBPTSparseIdxMode} {
+		Init()
+		opt.EntryIdxMode = mode
+		db, err = Open(opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bucket := "bucket_glob_scan_test"
+		if err := db.Update(func(tx *Tx) error {
+			for _, key := range []string{"admin:1:session", "user:10:session", "user:1:profile", "user:1:session", "user:2:session"} {
+				if err := tx.Put(bucket, []byte(key), []byte("val"), Persistent); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			pattern string
+			want    []string
+		}{
+			{"user:*:session", []string{"user:10:session", "user:1:session", "user:2:session"}},
+			{"user:?:session", []string{"user:1:session", "user:2:session"}},
+			{"user:[!1]:session", []string{"user:2:session"}},
+			{"user:1*", []string{"user:10:session", "user:1:profile", "user:1:session"}},
+			{"*:1:*", []string{"admin:1:session", "user:1:profile", "user:1:session"}},
+			{"user:1:profile", []string{"user:1:profile"}},
+		}
+
+		if err := db.View(func(tx *Tx) error {
+			for _, tt := range tests {
+				es, _, err := tx.GlobScan(bucket, tt.pattern, 0, ScanNoLimit)
+				if err != nil {
+					t.Errorf("mode %d: err GlobScan %q, %v", mode, tt.pattern, err)
+					continue
+				}
+				var got []string
+				for _, e := range es {
+					got = append(got, string(e.Key))
+				}
+				if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+					t.Errorf("mode %d: err GlobScan %q, got %v want %v", mode, tt.pattern, got, tt.want)
+				}
+			}
+
+			if _, _, err := tx.GlobScan(bucket, `user:\*`, 0, ScanNoLimit); err != ErrPrefixSearchScan {
+				t.Errorf("mode %d: err GlobScan, got %v want %v", mode, err, ErrPrefixSearchScan)
+			}
+			if _, _, err := tx.GlobScan(bucket, "user:[1", 0, ScanNoLimit); err != ErrBadPattern {
+				t.Errorf("mode %d: err GlobScan, got %v want %v", mode, err, ErrBadPattern)
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		db.Close()
+	}
+}
+
+func TestTx_IncrAndDecr(t *testing.T) {
+	for _, mode := range []EntryIdxMode{HintKeyValAndRAMIdxMode, HintKeyAndRAMIdxMode, HintBPTSparseIdxMode} {
+		Init()
+		opt.EntryIdxMode = mode
+		db, err = Open(opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bucket := "bucket_incr_test"
+		key := []byte("counter")
+
+		// the missing key is created at zero, the writes of the tx are seen by the next calls.
+		if err := db.Update(func(tx *Tx) error {
+			if v, err := tx.Incr(bucket, key, 5); err != nil || v != 5 {
+				t.Errorf("mode %d: err Incr, got %d %v want 5", mode, v, err)
+			}
+			if v, err := tx.Incr(bucket, key, 2); err != nil || v != 7 {
+				t.Errorf("mode %d: err Incr, got %d %v want 7", mode, v, err)
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := db.Update(func(tx *Tx) error {
+			if v, err := tx.Decr(bucket, key, 10); err != nil || v != -3 {
+				t.Errorf("mode %d: err Decr, got %d %v want -3", mode, v, err)
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := db.View(func(tx *Tx) error {
+			e, err := tx.Get(bucket, key)
+			if err != nil {
+				return err
+			}
+			if v, err := DecodeInt64(e.Value); err != nil || v != -3 {
+				t.Errorf("mode %d: err DecodeInt64, got %d %v want -3", mode, v, err)
+			}
+			if _, err := tx.Incr(bucket, key, 1); err != ErrTxNotWritable {
+				t.Errorf("mode %d: err Incr, got %v want %v", mode, err, ErrTxNotWritable)
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := db.Update(func(tx *Tx) error {
+			if err := tx.Put(bucket, []byte("max"), EncodeInt64(math.MaxInt64), Persistent); err != nil {
+				return err
+			}
+			if _, err := tx.Incr(bucket, []byte("max"), 1); err != ErrIntegerOverflow {
+				t.Errorf("mode %d: err Incr, got %v want %v", mode, err, ErrIntegerOverflow)
+			}
+			if _, err := tx.Decr(bucket, []byte("zero"), math.MinInt64); err != ErrIntegerOverflow {
+				t.Errorf("mode %d: err Decr, got %v want %v", mode, err, ErrIntegerOverflow)
+			}
+			if err := tx.Put(bucket, []byte("text"), []byte("val"), Persistent); err != nil {
+				return err
+			}
+			if _, err := tx.Incr(bucket, []byte("text"), 1); err != ErrValueNotInteger {
+				t.Errorf("mode %d: err Incr, got %v want %v", mode, err, ErrValueNotInteger)
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		db.Close()
+	}
+}
+
+func TestTx_ConditionalPuts(t *testing.T) {
+	for _, mode := range []EntryIdxMode{HintKeyValAndRAMIdxMode, HintKeyAndRAMIdxMode, HintBPTSparseIdxMode} {
+		Init()
+		opt.EntryIdxMode = mode
+		db, err = Open(opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bucket := "bucket_cas_test"
+		key := []byte("key")
+
+		if err := db.Update(func(tx *Tx) error {
+			if err := tx.PutIfNotExists(bucket, key, []byte("val1"), Persistent); err != nil {
+				return err
+			}
+			if err := tx.PutIfNotExists(bucket, key, []byte("val2"), Persistent); err != ErrKeyExists {
+				t.Errorf("mode %d: err PutIfNotExists, got %v want %v", mode, err, ErrKeyExists)
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := db.Update(func(tx *Tx) error {
+			if err := tx.PutIfEqual(bucket, key, []byte("val2"), []byte("val3"), Persistent); err != ErrConflict {
+				t.Errorf("mode %d: err PutIfEqual, got %v want %v", mode, err, ErrConflict)
+			}
+			return tx.PutIfEqual(bucket, key, []byte("val1"), []byte("val2"), Persistent)
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		// the version read in a read-only tx is checked by the later read/write tx.
+		var version uint64
+		if err := db.View(func(tx *Tx) error {
+			e, err := tx.Get(bucket, key)
+			if err != nil {
+				return err
+			}
+			if string(e.Value) != "val2" {
+				t.Errorf("mode %d: err PutIfEqual, got %s want val2", mode, e.Value)
+			}
+			version = e.Version()
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := db.Update(func(tx *Tx) error {
+			return tx.PutIfVersion(bucket, key, []byte("val3"), Persistent, version)
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := db.Update(func(tx *Tx) error {
+			return tx.PutIfVersion(bucket, key, []byte("val4"), Persistent, version)
+		}); err != ErrConflict {
+			t.Errorf("mode %d: err PutIfVersion, got %v want %v", mode, err, ErrConflict)
+		}
+
+		// a deleted key does not exist anymore.
+		if err := db.Update(func(tx *Tx) error {
+			if err := tx.Delete(bucket, key); err != nil {
+				return err
+			}
+			return tx.PutIfNotExists(bucket, key, []byte("val5"), Persistent)
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		db.Close()
+	}
+}
+
+func testReadYourWrites(t *testing.T) {
+	bucket := "bucket_read_your_writes"
+
+	if err := db.Update(func(tx *Tx) error {
+		for _, key := range []string{"key_1", "key_3", "key_5"} {
+			if err := tx.Put(bucket, []byte(key), []byte("old"), Persistent); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	keysOf := func(es Entries) string {
+		var keys []string
+		for _, e := range es {
+			keys = append(keys, string(e.Key)+"="+string(e.Value))
+		}
+		return fmt.Sprint(keys)
+	}
+
+	tx, err := db.Begin(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"key_2", "key_3"} {
+		if err := tx.Put(bucket, []byte(key), []byte("new"), Persistent); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tx.Delete(bucket, []byte("key_5")); err != nil {
+		t.Fatal(err)
+	}
+
+	if e, err := tx.Get(bucket, []byte("key_2")); err != nil || string(e.Value) != "new" {
+		t.Errorf("err Get, the pending write is not seen: %v", err)
+	}
+	if _, err := tx.Get(bucket, []byte("key_5")); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("err Get, got %v want %v", err, ErrKeyNotFound)
+	}
+
+	want := "[key_1=old key_2=new key_3=new]"
+	if es, err := tx.GetAll(bucket); err != nil || keysOf(es) != want {
+		t.Errorf("err GetAll, got %s %v want %s", keysOf(es), err, want)
+	}
+	if es, err := tx.RangeScan(bucket, []byte("key_0"), []byte("key_9")); err != nil || keysOf(es) != want {
+		t.Errorf("err RangeScan, got %s %v want %s", keysOf(es), err, want)
+	}
+	if es, err := tx.RangeScanReverse(bucket, []byte("key_0"), []byte("key_9")); err != nil || keysOf(es) != "[key_3=new key_2=new key_1=old]" {
+		t.Errorf("err RangeScanReverse, got %s %v", keysOf(es), err)
+	}
+	if keys, err := tx.RangeScanKeys(bucket, []byte("key_2"), []byte("key_9")); err != nil || len(keys) != 2 {
+		t.Errorf("err RangeScanKeys, got %d keys %v want %d", len(keys), err, 2)
+	}
+	if es, off, err := tx.PrefixScan(bucket, []byte("key_"), 1, 1); err != nil || keysOf(es) != "[key_2=new]" || off != 1 {
+		t.Errorf("err PrefixScan, got %s %d %v", keysOf(es), off, err)
+	}
+	if es, next, err := tx.PrefixScanCursor(bucket, []byte("key_"), "", 2); err != nil || keysOf(es) != "[key_1=old key_2=new]" || next == "" {
+		t.Errorf("err PrefixScanCursor, got %s %q %v", keysOf(es), next, err)
+	}
+	if es, _, err := tx.GlobScan(bucket, "key_[25]", 0, ScanNoLimit); err != nil || keysOf(es) != "[key_2=new]" {
+		t.Errorf("err GlobScan, got %s %v", keysOf(es), err)
+	}
+	if es, err := tx.GetMulti(bucket, [][]byte{[]byte("key_2"), []byte("key_5")}); err != nil || es[0] == nil || es[1] != nil {
+		t.Errorf("err GetMulti, the pending writes are not seen: %v", err)
+	}
+
+	// a new bucket is seen before it is committed.
+	if err := tx.Put("bucket_read_your_writes_new", []byte("key"), []byte("val"), Persistent); err != nil {
+		t.Fatal(err)
+	}
+	if es, err := tx.GetAll("bucket_read_your_writes_new"); err != nil || len(es) != 1 {
+		t.Errorf("err GetAll, got %d entries %v want %d", len(es), err, 1)
+	}
+
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the other txs do not see the uncommitted writes.
+	if err := db.View(func(tx *Tx) error {
+		es, err := tx.GetAll(bucket)
+		if err != nil {
+			return err
+		}
+		if keysOf(es) != "[key_1=old key_3=old key_5=old]" {
+			t.Errorf("err GetAll, got %s", keysOf(es))
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTx_ReadYourWrites(t *testing.T) {
+	Init()
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	testReadYourWrites(t)
+}
+
+func TestTx_ReadYourWrites_For_BPTSparseIdxMode(t *testing.T) {
+	InitForBPTSparseIdxMode()
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	testReadYourWrites(t)
+}
@@ -0,0 +1,106 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"time"
+)
+
+// txCommitValueSize is the value size of a commit record: the entry count and the checksum of
+// the entries of the tx in the data file, the entry count of the tx and the data file of its
+// first entry.
+const txCommitValueSize = 20
+
+// txCommitEntrySize is the size of a commit record in the data file.
+const txCommitEntrySize = DataEntryHeaderSize + txCommitValueSize
+
+// txCommit sums up the entries of a tx written to a data file, the checksum
+// is the crc32 of the crc of the entries in the order they are written.
+//
+// A commit record is appended after the last entry of the tx, it is the only
+// entry of the tx with the Committed status. When it is missing, or when its
+// count or checksum does not match the entries found before it in the same
+// data file, the tx was not fully written and recovery discards all its entries.
+// A tx written to several data files, when the active file is rotated, is checked by the
+// entry count of the tx too: the entries of the tx in the previous data files must all
+// be found. A tx of a single entry is checked by the crc of the entry, so it has the
+// Committed status itself and there is no commit record.
+type txCommit struct {
+	count    uint32
+	checksum uint32
+}
+
+// add adds the encoded entry to the commit.
+func (c *txCommit) add(data []byte) {
+	c.count++
+	c.checksum = crc32.Update(c.checksum, crc32.IEEETable, data[0:4])
+}
+
+// addEntry adds the entry read from a data file to the commit.
+func (c *txCommit) addEntry(e *Entry) {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], e.crc)
+	c.add(buf[:])
+}
+
+// entry returns the commit record of the tx of total entries, the first one in the data file at firstFID.
+func (c *txCommit) entry(txID uint64, total uint32, firstFID int64) *Entry {
+	value := make([]byte, txCommitValueSize)
+	binary.LittleEndian.PutUint32(value[0:4], c.count)
+	binary.LittleEndian.PutUint32(value[4:8], c.checksum)
+	binary.LittleEndian.PutUint32(value[8:12], total)
+	binary.LittleEndian.PutUint64(value[12:20], uint64(firstFID))
+
+	return &Entry{
+		Value: value,
+		Meta: &MetaData{
+			timestamp: uint64(time.Now().Unix()),
+			valueSize: txCommitValueSize,
+			status:    Committed,
+			ds:        DataStructureTxCommit,
+			txID:      txID,
+		},
+	}
+}
+
+// matches checks if the commit record e sums up the entries of the commit.
+func (c *txCommit) matches(e *Entry) bool {
+	if len(e.Value) != txCommitValueSize {
+		return false
+	}
+
+	return binary.LittleEndian.Uint32(e.Value[0:4]) == c.count &&
+		binary.LittleEndian.Uint32(e.Value[4:8]) == c.checksum
+}
+
+// txCommitSpan returns the entry count of the tx of the commit record e and the data file of
+// its first entry, e must match its commit.
+func txCommitSpan(e *Entry) (total uint32, firstFID int64) {
+	return binary.LittleEndian.Uint32(e.Value[8:12]), int64(binary.LittleEndian.Uint64(e.Value[12:20]))
+}
+
+// txCommitComplete checks if the commit record e counts the n entries of its tx read from the data
+// files since the one at fromFID. The txs started before it are not checked.
+func txCommitComplete(e *Entry, n int, fromFID int64) bool {
+	total, firstFID := txCommitSpan(e)
+	return firstFID < fromFID || int(total) == n
+}
+
+// isTxCommitEntry checks if the entry is a commit record.
+func isTxCommitEntry(e *Entry) bool {
+	return e.Meta.ds == DataStructureTxCommit
+}
@@ -0,0 +1,400 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strconv"
+	"testing"
+)
+
+// lastTxCommitOff returns the offset of the last commit record in the data file.
+func lastTxCommitOff(t *testing.T, f *DataFile) (last int64, e *Entry) {
+	last = -1
+	for off := int64(0); ; {
+		entry, err := f.ReadAt(int(off))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry == nil {
+			break
+		}
+		if isTxCommitEntry(entry) {
+			last, e = off, entry
+		}
+		off += entry.Size()
+	}
+
+	if last < 0 {
+		t.Fatal("no commit record")
+	}
+
+	return
+}
+
+func TestTx_CommitRecord(t *testing.T) {
+	bucket := "bucket_for_commit_record"
+	path := "/tmp/nutsdbtestforcommitrecord"
+
+	keysFound := func() (found []string) {
+		db, err = Open(opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		for _, key := range []string{"key_1", "key_2", "key_3", "key_4", "key_5"} {
+			if err := db.View(func(tx *Tx) error {
+				_, err := tx.Get(bucket, []byte(key))
+				return err
+			}); err == nil {
+				found = append(found, key)
+			}
+		}
+
+		return
+	}
+
+	InitOpt(path, true)
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, keys := range [][]string{{"key_1", "key_2", "key_3"}, {"key_4", "key_5"}} {
+		if err := db.Update(func(tx *Tx) error {
+			for _, key := range keys {
+				if err := tx.Put(bucket, []byte(key), []byte("val"), Persistent); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dataPath := db.getDataPath(0)
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if found := keysFound(); len(found) != 5 {
+		t.Fatalf("err recovery, got %v", found)
+	}
+
+	f, err := NewDataFile(dataPath, opt.SegmentSize, FileIO)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the commit record does not match the entries of the last tx.
+	off, e := lastTxCommitOff(t, f)
+	binary.LittleEndian.PutUint32(e.Value[0:4], 3)
+	if _, err := f.WriteAt(e.Encode(), off); err != nil {
+		t.Fatal(err)
+	}
+	f.rwManager.Close()
+
+	if found := keysFound(); len(found) != 3 || found[2] != "key_3" {
+		t.Errorf("err recovery with a wrong commit record, got %v", found)
+	}
+
+	// the commit record of the last tx is not written.
+	f, err = NewDataFile(dataPath, opt.SegmentSize, FileIO)
+	if err != nil {
+		t.Fatal(err)
+	}
+	off, _ = lastTxCommitOff(t, f)
+	if err := f.truncateAt(off); err != nil {
+		t.Fatal(err)
+	}
+	f.rwManager.Close()
+
+	if found := keysFound(); len(found) != 3 || found[2] != "key_3" {
+		t.Errorf("err recovery without the commit record, got %v", found)
+	}
+}
+
+// putAtomicBatch writes the batch i to the buckets of all the data structures in one tx.
+func putAtomicBatch(t *testing.T, i int) {
+	t.Helper()
+
+	key := []byte("key_" + strconv.Itoa(i))
+	if err := db.Update(func(tx *Tx) error {
+		if err := tx.Put("bucket_kv_1", key, []byte("val"), Persistent); err != nil {
+			return err
+		}
+		if err := tx.Put("bucket_kv_2", key, []byte("val"), Persistent); err != nil {
+			return err
+		}
+		if err := tx.RPush("bucket_list", key, []byte("val")); err != nil {
+			return err
+		}
+		if err := tx.SAdd("bucket_set", key, []byte("val")); err != nil {
+			return err
+		}
+		return tx.ZAdd("bucket_zset", key, float64(i), []byte("val"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// atomicBatchFound returns the number of the writes of the batch i found.
+func atomicBatchFound(t *testing.T, i int) (found int) {
+	t.Helper()
+
+	key := []byte("key_" + strconv.Itoa(i))
+	if err := db.View(func(tx *Tx) error {
+		if _, err := tx.Get("bucket_kv_1", key); err == nil {
+			found++
+		}
+		if _, err := tx.Get("bucket_kv_2", key); err == nil {
+			found++
+		}
+		if n, err := tx.LSize("bucket_list", key); err == nil && n == 1 {
+			found++
+		}
+		if ok, err := tx.SIsMember("bucket_set", key, []byte("val")); err == nil && ok {
+			found++
+		}
+		if _, err := tx.ZGetByKey("bucket_zset", key); err == nil {
+			found++
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	return
+}
+
+func TestTx_CommitAcrossDataStructures(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestforcommitatomic", true)
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	putAtomicBatch(t, 1)
+	putAtomicBatch(t, 2)
+
+	dataPath := db.getDataPath(0)
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := NewDataFile(dataPath, opt.SegmentSize, FileIO)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the commit record of the second tx does not match its entries.
+	off, e := lastTxCommitOff(t, f)
+	binary.LittleEndian.PutUint32(e.Value[0:4], 4)
+	if _, err := f.WriteAt(e.Encode(), off); err != nil {
+		t.Fatal(err)
+	}
+	f.rwManager.Close()
+
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if found := atomicBatchFound(t, 1); found != 5 {
+		t.Errorf("err recovery of the committed tx, got %d writes want 5", found)
+	}
+	if found := atomicBatchFound(t, 2); found != 0 {
+		t.Errorf("err recovery of the torn tx, got %d writes want 0", found)
+	}
+}
+
+func TestTx_CommitAcrossDataFiles(t *testing.T) {
+	bucket := "bucket_for_commit_span"
+
+	InitOpt("/tmp/nutsdbtestforcommitspan", true)
+	opt.SegmentSize = 1024
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keysFound := func() (found int) {
+		if err := db.View(func(tx *Tx) error {
+			for i := 0; i < 30; i++ {
+				if _, err := tx.Get(bucket, []byte("key_"+strconv.Itoa(i))); err == nil {
+					found++
+				}
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	// the tx is written to several data files.
+	startFID, startOff := db.ActiveFile.fileID, db.ActiveFile.writeOff
+	startPath := db.getDataPath(startFID)
+	if err := db.Update(func(tx *Tx) error {
+		for i := 0; i < 30; i++ {
+			if err := tx.Put(bucket, []byte("key_"+strconv.Itoa(i)), []byte("val"), Persistent); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if db.ActiveFile.fileID == startFID {
+		t.Fatal("the tx is written to a single data file")
+	}
+
+	// a tx failing with its last entry writes nothing.
+	writeOff := db.ActiveFile.writeOff
+	if err := db.Update(func(tx *Tx) error {
+		if err := tx.Put(bucket, []byte("key_0"), []byte("new"), Persistent); err != nil {
+			return err
+		}
+		return tx.Put(bucket, make([]byte, opt.SegmentSize), []byte("val"), Persistent)
+	}); err != ErrKeyAndValSize {
+		t.Fatalf("err commit of a too large entry, got %v want %v", err, ErrKeyAndValSize)
+	}
+	if db.ActiveFile.writeOff != writeOff {
+		t.Errorf("err write of a failed tx, got offset %d want %d", db.ActiveFile.writeOff, writeOff)
+	}
+
+	if found := keysFound(); found != 30 {
+		t.Errorf("err commit across data files, got %d keys want 30", found)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found := keysFound(); found != 30 {
+		t.Errorf("err recovery across data files, got %d keys want 30", found)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the entries of the tx in its first data file are lost.
+	f, err := NewDataFile(startPath, opt.SegmentSize, FileIO)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.truncateAt(startOff); err != nil {
+		t.Fatal(err)
+	}
+	f.rwManager.Close()
+
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if found := keysFound(); found != 0 {
+		t.Errorf("err recovery of a torn tx across data files, got %d keys want 0", found)
+	}
+}
+
+func TestTx_CommitFailedWrite(t *testing.T) {
+	bucket := "bucket_for_commit_failed_write"
+	val := bytes.Repeat([]byte("v"), 500)
+
+	for _, mode := range []EntryIdxMode{HintKeyValAndRAMIdxMode, HintKeyAndRAMIdxMode, HintBPTSparseIdxMode} {
+		// the tx of 6 entries fits in a data file, the one of 10 entries spans two of them.
+		for _, n := range []int{6, 10} {
+			for _, crash := range []bool{false, true} {
+				fp := NewFailpoints()
+				InitOpt("/tmp/nutsdbtestforcommitfailedwrite", true)
+				opt.SegmentSize = 4 * 1024
+				opt.EntryIdxMode = mode
+				opt.Failpoints = fp
+				db, err = Open(opt)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if err := db.Update(func(tx *Tx) error {
+					return tx.Put(bucket, []byte("a"), bytes.Repeat([]byte("a"), 2000), Persistent)
+				}); err != nil {
+					t.Fatal(err)
+				}
+
+				check := func(when string) {
+					t.Helper()
+
+					if err := db.View(func(tx *Tx) error {
+						if _, err := tx.Get(bucket, []byte("a")); err != nil {
+							t.Errorf("mode %d, %d entries %s: err get the committed key, got %v", mode, n, when, err)
+						}
+						if _, err := tx.Get(bucket, []byte("key_0")); err == nil {
+							t.Errorf("mode %d, %d entries %s: err get a key of the failed tx", mode, n, when)
+						}
+						return nil
+					}); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				// the tx does not fit in the active file, the write fails in the middle of its entries
+				// in the next data file.
+				fp.FailWriteAfter(3000, errInjected)
+				if err := db.Update(func(tx *Tx) error {
+					for i := 0; i < n; i++ {
+						if err := tx.Put(bucket, []byte("key_"+strconv.Itoa(i)), val, Persistent); err != nil {
+							return err
+						}
+					}
+					return nil
+				}); err != errInjected {
+					t.Fatalf("mode %d: err commit, got %v want %v", mode, err, errInjected)
+				}
+				check("after the failed commit")
+
+				if crash {
+					fp.Crash()
+				}
+				_ = db.Close()
+				fp.Reset()
+
+				// the torn entries are discarded, the db opens without TruncateOnCorruption.
+				db, err = Open(opt)
+				if err != nil {
+					t.Fatalf("mode %d: err reopen, got %v", mode, err)
+				}
+				check("after reopen")
+
+				if err := db.Update(func(tx *Tx) error {
+					return tx.Put(bucket, []byte("b"), []byte("val"), Persistent)
+				}); err != nil {
+					t.Fatal(err)
+				}
+				if err := db.Close(); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"bytes"
+	"errors"
+)
+
+// Has returns if the key exists in the bucket. In HintKeyAndRAMIdxMode the value is not read
+// from the data file, the hint index is enough, unlike Get.
+func (tx *Tx) Has(bucket string, key []byte) (bool, error) {
+	if err := tx.checkTxIsClosed(); err != nil {
+		return false, err
+	}
+
+	if e, ok := tx.pendingGet(bucket, key); ok {
+		return e != nil, nil
+	}
+
+	if tx.db.opt.EntryIdxMode == HintBPTSparseIdxMode {
+		if _, err := tx.Get(bucket, key); err != nil {
+			if isNotFound(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		return true, nil
+	}
+
+	return tx.liveRecord(bucket, key) != nil, nil
+}
+
+// Count returns the number of the keys in the bucket. It reads the counter of the hint index,
+// unless the bucket has keys with a TTL or the tx is a snapshot tx, then it walks the records
+// of the hint index without reading the values. In HintBPTSparseIdxMode it scans the bucket.
+func (tx *Tx) Count(bucket string) (int, error) {
+	if err := tx.checkTxIsClosed(); err != nil {
+		return 0, err
+	}
+
+	if tx.db.opt.EntryIdxMode == HintBPTSparseIdxMode {
+		es, err := tx.GetAll(bucket)
+		return countEntries(es, err)
+	}
+
+	n := 0
+	if idx, ok := tx.db.BPTreeIdx[bucket]; ok {
+		if idx.ttlKeyCount == 0 && !tx.isSnapshot {
+			n = idx.ValidKeyCount
+		} else {
+			idx.ascend(nil, func(key []byte, r *Record) bool {
+				if tx.visibleRecord(r) != nil {
+					n++
+				}
+				return true
+			})
+		}
+	}
+
+	return n + tx.pendingCountDelta(bucket, func([]byte) bool { return true }), nil
+}
+
+// CountByPrefix returns the number of the keys with the prefix in the bucket, it walks the
+// records of the hint index from the prefix without reading the values. In HintBPTSparseIdxMode
+// it scans the keys.
+func (tx *Tx) CountByPrefix(bucket string, prefix []byte) (int, error) {
+	if err := tx.checkTxIsClosed(); err != nil {
+		return 0, err
+	}
+
+	if tx.db.opt.EntryIdxMode == HintBPTSparseIdxMode {
+		es, _, err := tx.PrefixScan(bucket, prefix, 0, ScanNoLimit)
+		return countEntries(es, err)
+	}
+
+	n := 0
+	if idx, ok := tx.db.BPTreeIdx[bucket]; ok {
+		idx.ascend(prefix, func(key []byte, r *Record) bool {
+			if !bytes.HasPrefix(key, prefix) {
+				return false
+			}
+			if tx.visibleRecord(r) != nil {
+				n++
+			}
+			return true
+		})
+	}
+
+	return n + tx.pendingCountDelta(bucket, hasPrefix(prefix)), nil
+}
+
+// liveRecord returns the record of the key in the bucket visible to the tx, or nil if the key
+// is missing, deleted or expired. The pending writes of the tx are not seen.
+func (tx *Tx) liveRecord(bucket string, key []byte) *Record {
+	idx, ok := tx.db.BPTreeIdx[bucket]
+	if !ok {
+		return nil
+	}
+
+	r, err := idx.Find(key)
+	if err != nil || r == nil {
+		return nil
+	}
+
+	if _, ok := tx.db.committedTxIds[r.H.meta.txID]; !ok {
+		return nil
+	}
+
+	return tx.visibleRecord(r)
+}
+
+// visibleRecord returns the version of the record visible to the tx, or nil if it is deleted or expired.
+func (tx *Tx) visibleRecord(r *Record) *Record {
+	if tx.isSnapshot {
+		if r = r.visible(tx.snapshotSeq); r == nil {
+			return nil
+		}
+	}
+
+	if r.H.meta.Flag == DataDeleteFlag || r.IsExpired() {
+		return nil
+	}
+
+	return r
+}
+
+// pendingCountDelta returns the change of the number of the keys of the bucket matching fn
+// by the pending writes of the tx: the new keys added, the deleted keys removed.
+func (tx *Tx) pendingCountDelta(bucket string, fn func(key []byte) bool) int {
+	if tx.db.opt.EntryIdxMode == HintBPTSparseIdxMode {
+		return 0
+	}
+
+	delta := 0
+	for _, e := range tx.pendingScan(bucket, fn) {
+		exists := tx.liveRecord(bucket, e.Key) != nil
+		switch {
+		case e.Meta.Flag == DataDeleteFlag && exists:
+			delta--
+		case e.Meta.Flag != DataDeleteFlag && !exists:
+			delta++
+		}
+	}
+
+	return delta
+}
+
+// countEntries returns the number of the entries of a scan, 0 if it finds nothing.
+func countEntries(es Entries, err error) (int, error) {
+	if err != nil {
+		if isScanNotFound(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	return len(es), nil
+}
+
+// isNotFound returns if err is returned by a read of a missing key or bucket.
+func isNotFound(err error) bool {
+	return errors.Is(err, ErrKeyNotFound) || isScanNotFound(err)
+}
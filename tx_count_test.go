@@ -0,0 +1,157 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"testing"
+)
+
+func checkCount(t *testing.T, tx *Tx, bucket string, prefix []byte, want int) {
+	t.Helper()
+
+	var (
+		n   int
+		err error
+	)
+	if prefix == nil {
+		n, err = tx.Count(bucket)
+	} else {
+		n, err = tx.CountByPrefix(bucket, prefix)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != want {
+		t.Errorf("err count of %s prefix %q, got %d want %d", bucket, prefix, n, want)
+	}
+}
+
+func checkHas(t *testing.T, tx *Tx, bucket, key string, want bool) {
+	t.Helper()
+
+	ok, err := tx.Has(bucket, []byte(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok != want {
+		t.Errorf("err Has %s, got %v want %v", key, ok, want)
+	}
+}
+
+func TestTx_HasAndCount(t *testing.T) {
+	for _, mode := range []EntryIdxMode{HintKeyValAndRAMIdxMode, HintKeyAndRAMIdxMode, HintBPTSparseIdxMode} {
+		InitOpt("/tmp/nutsdbtestcount", true)
+		opt.EntryIdxMode = mode
+		db, err = Open(opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bucket := "bucket"
+		if err := db.Update(func(tx *Tx) error {
+			for _, key := range []string{"user_1", "user_2", "user_3", "order_1"} {
+				if err := tx.Put(bucket, []byte(key), []byte("val"), Persistent); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := db.Update(func(tx *Tx) error {
+			if err := tx.Delete(bucket, []byte("user_2")); err != nil {
+				return err
+			}
+			// a delete of a missing key is not counted.
+			return tx.Delete(bucket, []byte("user_4"))
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := db.View(func(tx *Tx) error {
+			checkHas(t, tx, bucket, "user_1", true)
+			checkHas(t, tx, bucket, "user_2", false)
+			checkHas(t, tx, "bucket_missing", "user_1", false)
+			checkCount(t, tx, bucket, nil, 3)
+			checkCount(t, tx, bucket, []byte("user_"), 2)
+			checkCount(t, tx, "bucket_missing", nil, 0)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		// the pending writes of the tx are counted.
+		if err := db.Update(func(tx *Tx) error {
+			if err := tx.Put(bucket, []byte("user_5"), []byte("val"), Persistent); err != nil {
+				return err
+			}
+			if err := tx.Put(bucket, []byte("user_1"), []byte("new"), Persistent); err != nil {
+				return err
+			}
+			if err := tx.Delete(bucket, []byte("order_1")); err != nil {
+				return err
+			}
+			if mode != HintBPTSparseIdxMode {
+				checkHas(t, tx, bucket, "user_5", true)
+				checkHas(t, tx, bucket, "order_1", false)
+				checkCount(t, tx, bucket, nil, 3)
+				checkCount(t, tx, bucket, []byte("user_"), 3)
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTx_CountExpired(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestcount", true)
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	bucket := "bucket"
+	if err := db.Update(func(tx *Tx) error {
+		if err := tx.Put(bucket, []byte("key_1"), []byte("val"), Persistent); err != nil {
+			return err
+		}
+		return tx.Put(bucket, []byte("key_ttl"), []byte("val"), 60)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the key with a TTL expires without being deleted.
+	r, err := db.BPTreeIdx[bucket].Find([]byte("key_ttl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.H.meta.timestamp -= 120
+
+	if err := db.View(func(tx *Tx) error {
+		checkHas(t, tx, bucket, "key_ttl", false)
+		checkCount(t, tx, bucket, nil, 1)
+		checkCount(t, tx, bucket, []byte("key_"), 1)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+// DeleteByPrefix deletes the keys with the prefix in the bucket and returns their number.
+// It walks the keys of the hint index once, without reading the values, and writes a delete
+// for each key. The deletes count in the MaxTxEntries and MaxTxBytes of the tx, see
+// DB.DeleteByPrefix to delete more keys than a tx can hold.
+func (tx *Tx) DeleteByPrefix(bucket string, prefix []byte) (int, error) {
+	return tx.deleteByPrefix(bucket, prefix, ScanNoLimit)
+}
+
+// DeleteRange deletes the keys from start to end, both included, in the bucket and returns their
+// number, like DeleteByPrefix.
+func (tx *Tx) DeleteRange(bucket string, start, end []byte) (int, error) {
+	return tx.deleteRange(bucket, start, end, ScanNoLimit)
+}
+
+func (tx *Tx) deleteByPrefix(bucket string, prefix []byte, limitNum int) (int, error) {
+	if err := tx.checkTxIsWritable(); err != nil {
+		return 0, err
+	}
+
+	keys, _, err := tx.PrefixScanKeys(bucket, prefix, 0, ScanNoLimit)
+
+	return tx.deleteKeys(bucket, keys, limitNum, err)
+}
+
+func (tx *Tx) deleteRange(bucket string, start, end []byte, limitNum int) (int, error) {
+	if err := tx.checkTxIsWritable(); err != nil {
+		return 0, err
+	}
+
+	keys, err := tx.RangeScanKeys(bucket, start, end)
+
+	return tx.deleteKeys(bucket, keys, limitNum, err)
+}
+
+// deleteKeys deletes the first limitNum keys of a key-only scan which returned err, all of them
+// if limitNum is ScanNoLimit. The scan is not limited itself, its limit counts the deleted keys.
+func (tx *Tx) deleteKeys(bucket string, keys [][]byte, limitNum int, err error) (int, error) {
+	if err != nil {
+		if isScanNotFound(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	if limitNum > 0 && len(keys) > limitNum {
+		keys = keys[:limitNum]
+	}
+
+	for i, key := range keys {
+		if err := tx.Delete(bucket, key); err != nil {
+			return i, err
+		}
+	}
+
+	return len(keys), nil
+}
+
+// DeleteByPrefix deletes the keys with the prefix in the bucket like Tx.DeleteByPrefix, in
+// read/write txs of at most batchSize deletes each, and returns their number. The txs are
+// committed one after the other, if one fails the keys deleted by the previous ones stay deleted.
+// All the keys are deleted in one tx if batchSize is 0.
+func (db *DB) DeleteByPrefix(bucket string, prefix []byte, batchSize int) (int, error) {
+	return db.deleteInBatches(batchSize, func(tx *Tx, limitNum int) (int, error) {
+		return tx.deleteByPrefix(bucket, prefix, limitNum)
+	})
+}
+
+// DeleteRange deletes the keys from start to end, both included, in the bucket like
+// Tx.DeleteRange, in read/write txs of at most batchSize deletes each like DB.DeleteByPrefix.
+func (db *DB) DeleteRange(bucket string, start, end []byte, batchSize int) (int, error) {
+	return db.deleteInBatches(batchSize, func(tx *Tx, limitNum int) (int, error) {
+		return tx.deleteRange(bucket, start, end, limitNum)
+	})
+}
+
+// deleteInBatches runs del in read/write txs until it deletes less than batchSize keys.
+func (db *DB) deleteInBatches(batchSize int, del func(tx *Tx, limitNum int) (int, error)) (int, error) {
+	limitNum := ScanNoLimit
+	if batchSize > 0 {
+		limitNum = batchSize
+	}
+
+	total := 0
+	for {
+		n := 0
+		if err := db.Update(func(tx *Tx) (err error) {
+			n, err = del(tx, limitNum)
+			return err
+		}); err != nil {
+			return total, err
+		}
+
+		total += n
+		if limitNum == ScanNoLimit || n < limitNum {
+			return total, nil
+		}
+	}
+}
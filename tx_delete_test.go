@@ -0,0 +1,138 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"fmt"
+	"testing"
+)
+
+func putDeleteKeys(t *testing.T, bucket, prefix string, n int) {
+	t.Helper()
+
+	for i := 0; i < n; i++ {
+		if err := db.Update(func(tx *Tx) error {
+			return tx.Put(bucket, []byte(fmt.Sprintf("%s%02d", prefix, i)), []byte("val"), Persistent)
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func checkDeleteCount(t *testing.T, bucket string, want int) {
+	t.Helper()
+
+	if err := db.View(func(tx *Tx) error {
+		checkCount(t, tx, bucket, nil, want)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTx_DeleteByPrefixAndRange(t *testing.T) {
+	for _, mode := range []EntryIdxMode{HintKeyValAndRAMIdxMode, HintKeyAndRAMIdxMode, HintBPTSparseIdxMode} {
+		InitOpt("/tmp/nutsdbtestdeleteprefix", true)
+		opt.EntryIdxMode = mode
+		db, err = Open(opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bucket := "bucket"
+		putDeleteKeys(t, bucket, "user_", 20)
+		putDeleteKeys(t, bucket, "order_", 5)
+
+		if err := db.Update(func(tx *Tx) error {
+			n, err := tx.DeleteByPrefix(bucket, []byte("user_1"))
+			if err != nil {
+				return err
+			}
+			if n != 10 {
+				t.Errorf("err DeleteByPrefix, got %d want %d", n, 10)
+			}
+
+			n, err = tx.DeleteRange(bucket, []byte("user_00"), []byte("user_04"))
+			if err != nil {
+				return err
+			}
+			if n != 5 {
+				t.Errorf("err DeleteRange, got %d want %d", n, 5)
+			}
+
+			n, err = tx.DeleteByPrefix(bucket, []byte("missing_"))
+			if err != nil || n != 0 {
+				t.Errorf("err DeleteByPrefix, got %d %v want 0", n, err)
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		checkDeleteCount(t, bucket, 10)
+
+		if err := db.View(func(tx *Tx) error {
+			if _, err := tx.DeleteByPrefix(bucket, []byte("user_")); err != ErrTxNotWritable {
+				t.Errorf("err DeleteByPrefix, got %v want %v", err, ErrTxNotWritable)
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDB_DeleteInBatches(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestdeleteprefix", true)
+	opt.MaxTxEntries = 3
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	bucket := "bucket"
+	putDeleteKeys(t, bucket, "user_", 10)
+	putDeleteKeys(t, bucket, "order_", 10)
+
+	// a tx can not hold all the deletes.
+	if err := db.Update(func(tx *Tx) error {
+		_, err := tx.DeleteByPrefix(bucket, []byte("user_"))
+		return err
+	}); err != ErrTxTooBig {
+		t.Errorf("err DeleteByPrefix, got %v want %v", err, ErrTxTooBig)
+	}
+
+	n, err := db.DeleteByPrefix(bucket, []byte("user_"), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 10 {
+		t.Errorf("err DeleteByPrefix, got %d want %d", n, 10)
+	}
+	checkDeleteCount(t, bucket, 10)
+
+	n, err = db.DeleteRange(bucket, []byte("order_02"), []byte("order_07"), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 6 {
+		t.Errorf("err DeleteRange, got %d want %d", n, 6)
+	}
+	checkDeleteCount(t, bucket, 4)
+}
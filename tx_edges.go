@@ -0,0 +1,119 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+// FirstKey returns the smallest key of the bucket, read from the first leaf of the hint index,
+// the deleted and expired keys skipped. It returns ErrBucketEmpty if the bucket has no key.
+// In HintBPTSparseIdxMode it scans the bucket.
+func (tx *Tx) FirstKey(bucket string) ([]byte, error) {
+	return tx.edgeKey(bucket, false)
+}
+
+// LastKey returns the largest key of the bucket, read from the last leaf of the hint index,
+// the deleted and expired keys skipped. It returns ErrBucketEmpty if the bucket has no key.
+// In HintBPTSparseIdxMode it scans the bucket.
+func (tx *Tx) LastKey(bucket string) ([]byte, error) {
+	return tx.edgeKey(bucket, true)
+}
+
+// First returns the entry of the smallest key of the bucket, see FirstKey.
+func (tx *Tx) First(bucket string) (*Entry, error) {
+	key, err := tx.FirstKey(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	return tx.Get(bucket, key)
+}
+
+// Last returns the entry of the largest key of the bucket, see LastKey.
+func (tx *Tx) Last(bucket string) (*Entry, error) {
+	key, err := tx.LastKey(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	return tx.Get(bucket, key)
+}
+
+// edgeKey returns the smallest key of the bucket, or the largest one if last, with the pending
+// writes of the tx applied.
+func (tx *Tx) edgeKey(bucket string, last bool) ([]byte, error) {
+	if err := tx.checkTxIsClosed(); err != nil {
+		return nil, err
+	}
+
+	if tx.db.opt.EntryIdxMode == HintBPTSparseIdxMode {
+		es, err := tx.GetAll(bucket)
+		if err != nil {
+			return nil, err
+		}
+		if last {
+			return es[len(es)-1].Key, nil
+		}
+		return es[0].Key, nil
+	}
+
+	// before returns if the key a comes before b in the order of the walk.
+	cmp := tx.keyCompare(bucket)
+	before := func(a, b []byte) bool {
+		if last {
+			return cmp(a, b) > 0
+		}
+		return cmp(a, b) < 0
+	}
+
+	var key []byte
+
+	// the keys written by the tx are found among its pending writes.
+	for _, e := range tx.pendingScan(bucket, func([]byte) bool { return true }) {
+		if e.Meta.Flag != DataDeleteFlag && (key == nil || before(e.Key, key)) {
+			key = e.Key
+		}
+	}
+
+	idx, ok := tx.db.BPTreeIdx[bucket]
+	if !ok && key == nil {
+		return nil, bucketNotFound(ErrBucketEmpty)
+	}
+
+	if ok {
+		walk := func(k []byte, r *Record) bool {
+			if key != nil && !before(k, key) {
+				return false
+			}
+			if _, pending := tx.pendingKeys[bucket][string(k)]; pending {
+				return true
+			}
+			if _, committed := tx.db.committedTxIds[r.H.meta.txID]; !committed || tx.visibleRecord(r) == nil {
+				return true
+			}
+			key = k
+			return false
+		}
+
+		if last {
+			idx.descend(walk)
+		} else {
+			idx.ascend(nil, walk)
+		}
+	}
+
+	if key == nil {
+		return nil, ErrBucketEmpty
+	}
+
+	return key, nil
+}
@@ -0,0 +1,100 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"fmt"
+	"testing"
+)
+
+func checkEdges(t *testing.T, tx *Tx, bucket, first, last string) {
+	t.Helper()
+
+	if key, err := tx.FirstKey(bucket); err != nil || string(key) != first {
+		t.Errorf("err FirstKey, got %s %v want %s", key, err, first)
+	}
+	if key, err := tx.LastKey(bucket); err != nil || string(key) != last {
+		t.Errorf("err LastKey, got %s %v want %s", key, err, last)
+	}
+}
+
+func TestTx_FirstAndLastKey(t *testing.T) {
+	for _, mode := range []EntryIdxMode{HintKeyValAndRAMIdxMode, HintKeyAndRAMIdxMode, HintBPTSparseIdxMode} {
+		InitOpt("/tmp/nutsdbtestedges", true)
+		opt.EntryIdxMode = mode
+		db, err = Open(opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bucket := "series"
+		if err := db.Update(func(tx *Tx) error {
+			for i := 1; i <= 100; i++ {
+				if err := tx.Put(bucket, []byte(fmt.Sprintf("ts_%03d", i)), []byte(fmt.Sprintf("val_%03d", i)), Persistent); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := db.Update(func(tx *Tx) error {
+			for _, key := range []string{"ts_001", "ts_100"} {
+				if err := tx.Delete(bucket, []byte(key)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := db.View(func(tx *Tx) error {
+			checkEdges(t, tx, bucket, "ts_002", "ts_099")
+
+			e, err := tx.Last(bucket)
+			if err != nil {
+				return err
+			}
+			if string(e.Value) != "val_099" {
+				t.Errorf("err Last, got %s want %s", e.Value, "val_099")
+			}
+
+			if _, err := tx.FirstKey("bucket_missing"); err == nil {
+				t.Error("err FirstKey of a missing bucket")
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		// the pending writes of the tx are seen.
+		if err := db.Update(func(tx *Tx) error {
+			if err := tx.Put(bucket, []byte("ts_000"), []byte("val"), Persistent); err != nil {
+				return err
+			}
+			if err := tx.Delete(bucket, []byte("ts_099")); err != nil {
+				return err
+			}
+			checkEdges(t, tx, bucket, "ts_000", "ts_098")
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		db.Close()
+	}
+}
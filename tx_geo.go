@@ -0,0 +1,269 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"sort"
+)
+
+// ErrGeoCoordinate is returned when the longitude, latitude or radius of a geo operation is out of range.
+var ErrGeoCoordinate = errors.New("invalid longitude, latitude or radius")
+
+// SeparatorForGeoKey represents separator for the keys of the geo members.
+const SeparatorForGeoKey = "|"
+
+const (
+	// geoStep is the number of the bits of the geohash for each of the longitude and the latitude,
+	// the cells of the members are about 0.6 meters wide.
+	geoStep = 26
+
+	// earthRadius is the radius of the earth in meters used by the distances.
+	earthRadius = 6372797.560856
+
+	// the tags after the separator of the keys of the geohash index and of the members.
+	geoIndexTag  = "h"
+	geoMemberTag = "m"
+)
+
+// GeoMember represents a member of the geo set with its position and its distance to the center of GeoRadius.
+type GeoMember struct {
+	Member    []byte
+	Longitude float64
+	Latitude  float64
+	Distance  float64 // in meters
+}
+
+// GeoAdd adds the member at the longitude and latitude to the geo set stored in the bucket at given
+// bucket and key, or moves it if it is already in the set.
+// The geo set is stored as the keys of the B+ tree of the bucket: one key of the member with its
+// geohash as the value, and one key of the geohash and the member, sorted by the geohash, for GeoRadius.
+func (tx *Tx) GeoAdd(bucket string, key []byte, lon, lat float64, member []byte) error {
+	if err := tx.checkTxIsWritable(); err != nil {
+		return err
+	}
+
+	if len(member) == 0 {
+		return ErrKeyEmpty
+	}
+
+	if !validGeoCoordinate(lon, lat) {
+		return ErrGeoCoordinate
+	}
+
+	hash := geohashEncode(lon, lat, geoStep)
+
+	memberKey := geoMemberKey(key, member)
+	e, err := tx.current(bucket, memberKey)
+	if err != nil {
+		return err
+	}
+
+	if e != nil && len(e.Value) == 8 {
+		old := binary.BigEndian.Uint64(e.Value)
+		if old == hash {
+			return nil
+		}
+		if err := tx.Delete(bucket, geoIndexKey(key, old, member)); err != nil {
+			return err
+		}
+	}
+
+	var value [8]byte
+	binary.BigEndian.PutUint64(value[:], hash)
+
+	if err := tx.Put(bucket, geoIndexKey(key, hash, member), nil, Persistent); err != nil {
+		return err
+	}
+
+	return tx.Put(bucket, memberKey, value[:], Persistent)
+}
+
+// GeoRadius returns the members of the geo set stored in the bucket at given bucket and key within
+// radius meters of the longitude and latitude, sorted by their distance to it.
+// It scans the cells of the geohash which cover the circle, the cells are at least as large as the radius.
+func (tx *Tx) GeoRadius(bucket string, key []byte, lon, lat, radius float64) ([]*GeoMember, error) {
+	if err := tx.checkTxIsClosed(); err != nil {
+		return nil, err
+	}
+
+	if !validGeoCoordinate(lon, lat) || radius < 0 || math.IsNaN(radius) {
+		return nil, ErrGeoCoordinate
+	}
+
+	step := geoRadiusStep(lat, radius)
+	shift := 2 * uint(geoStep-step)
+
+	var members []*GeoMember
+	for _, cell := range geoNeighborCells(geohashEncode(lon, lat, step), step) {
+		start, end := cell<<shift, (cell+1)<<shift
+
+		keys, err := tx.RangeScanKeys(bucket, geoIndexKey(key, start, nil), geoIndexKey(key, end, nil))
+		if err != nil {
+			if errors.Is(err, ErrRangeScan) || errors.Is(err, ErrBucketNotFound) {
+				continue
+			}
+			return nil, err
+		}
+
+		prefixLen := len(key) + len(SeparatorForGeoKey) + len(geoIndexTag)
+		for _, k := range keys {
+			if len(k) <= prefixLen+8 {
+				continue
+			}
+
+			mLon, mLat := geohashDecode(binary.BigEndian.Uint64(k[prefixLen:]), geoStep)
+			if d := geoDistance(lon, lat, mLon, mLat); d <= radius {
+				members = append(members, &GeoMember{
+					Member:    append([]byte(nil), k[prefixLen+8:]...),
+					Longitude: mLon,
+					Latitude:  mLat,
+					Distance:  d,
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(members, func(i, j int) bool {
+		return members[i].Distance < members[j].Distance
+	})
+
+	return members, nil
+}
+
+// geoMemberKey returns the key of the B+ tree holding the geohash of the member.
+func geoMemberKey(key, member []byte) []byte {
+	k := make([]byte, 0, len(key)+len(SeparatorForGeoKey)+len(geoMemberTag)+len(member))
+	k = append(k, key...)
+	k = append(k, SeparatorForGeoKey+geoMemberTag...)
+
+	return append(k, member...)
+}
+
+// geoIndexKey returns the key of the B+ tree of the member sorted by the geohash.
+func geoIndexKey(key []byte, hash uint64, member []byte) []byte {
+	k := make([]byte, 0, len(key)+len(SeparatorForGeoKey)+len(geoIndexTag)+8+len(member))
+	k = append(k, key...)
+	k = append(k, SeparatorForGeoKey+geoIndexTag...)
+
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], hash)
+	k = append(k, b[:]...)
+
+	return append(k, member...)
+}
+
+func validGeoCoordinate(lon, lat float64) bool {
+	return lon >= -180 && lon <= 180 && lat >= -90 && lat <= 90
+}
+
+// geohashEncode returns the geohash of the position with step bits for each of the longitude and
+// the latitude, the bits of the longitude are the higher ones of each pair.
+func geohashEncode(lon, lat float64, step int) uint64 {
+	x, y := geoCellIndex(lon, -180, 360, step), geoCellIndex(lat, -90, 180, step)
+
+	return interleave(x, y, step)
+}
+
+// geoCellIndex returns the index of the cell of v in the range of size from min, split into 2^step cells.
+func geoCellIndex(v, min, size float64, step int) uint64 {
+	cells := uint64(1) << uint(step)
+
+	i := uint64((v - min) / size * float64(cells))
+	if i >= cells {
+		i = cells - 1
+	}
+
+	return i
+}
+
+// geohashDecode returns the center of the cell of the geohash.
+func geohashDecode(hash uint64, step int) (lon, lat float64) {
+	x, y := deinterleave(hash, step)
+	cells := float64(uint64(1) << uint(step))
+
+	return -180 + (float64(x)+0.5)*360/cells, -90 + (float64(y)+0.5)*180/cells
+}
+
+func interleave(x, y uint64, step int) uint64 {
+	var hash uint64
+	for i := step - 1; i >= 0; i-- {
+		hash = hash<<2 | (x>>uint(i)&1)<<1 | y>>uint(i)&1
+	}
+
+	return hash
+}
+
+func deinterleave(hash uint64, step int) (x, y uint64) {
+	for i := step - 1; i >= 0; i-- {
+		x = x<<1 | hash>>uint(2*i+1)&1
+		y = y<<1 | hash>>uint(2*i)&1
+	}
+
+	return x, y
+}
+
+// geoRadiusStep returns the greatest step of the geohash whose cells are at least radius meters
+// high and wide around the latitude, so that the cell of the center and its neighbors cover the circle.
+func geoRadiusStep(lat, radius float64) int {
+	maxLat := math.Min(90, math.Abs(lat)+radius/earthRadius*180/math.Pi)
+	width := 2 * math.Pi * earthRadius * math.Cos(maxLat*math.Pi/180)
+	height := math.Pi * earthRadius
+
+	step := geoStep
+	for step > 1 && (height/float64(uint64(1)<<uint(step)) < radius || width/float64(uint64(1)<<uint(step)) < radius) {
+		step--
+	}
+
+	return step
+}
+
+// geoNeighborCells returns the cell of the geohash and its neighbors, the longitude wraps around.
+func geoNeighborCells(hash uint64, step int) []uint64 {
+	x, y := deinterleave(hash, step)
+	cells := int64(1) << uint(step)
+
+	seen := make(map[uint64]bool, 9)
+	var neighbors []uint64
+	for dy := int64(-1); dy <= 1; dy++ {
+		ny := int64(y) + dy
+		if ny < 0 || ny >= cells {
+			continue
+		}
+
+		for dx := int64(-1); dx <= 1; dx++ {
+			nx := (int64(x) + dx + cells) % cells
+
+			cell := interleave(uint64(nx), uint64(ny), step)
+			if !seen[cell] {
+				seen[cell] = true
+				neighbors = append(neighbors, cell)
+			}
+		}
+	}
+
+	return neighbors
+}
+
+// geoDistance returns the great-circle distance in meters between the positions, by the haversine formula.
+func geoDistance(lon1, lat1, lon2, lat2 float64) float64 {
+	rad := math.Pi / 180
+	u := math.Sin((lat2 - lat1) * rad / 2)
+	v := math.Sin((lon2 - lon1) * rad / 2)
+
+	return 2 * earthRadius * math.Asin(math.Sqrt(u*u+math.Cos(lat1*rad)*math.Cos(lat2*rad)*v*v))
+}
@@ -0,0 +1,143 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestTx_GeoAddAndGeoRadius(t *testing.T) {
+	for _, mode := range []EntryIdxMode{HintKeyValAndRAMIdxMode, HintKeyAndRAMIdxMode} {
+		InitOpt("/tmp/nutsdbtestgeo", true)
+		opt.EntryIdxMode = mode
+		db, err = Open(opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		places := []struct {
+			member   string
+			lon, lat float64
+		}{
+			{"Palermo", 13.361389, 38.115556},
+			{"Catania", 15.087269, 37.502669},
+			{"Rome", 12.496366, 41.902782},
+			{"Paris", 2.352222, 48.856613},
+			// the circles across the antimeridian find the members on both sides.
+			{"Suva", 178.441895, -18.141600},
+			{"Apia", -171.751861, -13.833333},
+		}
+
+		if err := db.Update(func(tx *Tx) error {
+			for _, p := range places {
+				if err := tx.GeoAdd("bucket", []byte("cities"), p.lon, p.lat, []byte(p.member)); err != nil {
+					return err
+				}
+			}
+			// Rome is moved, its old position is removed.
+			return tx.GeoAdd("bucket", []byte("cities"), 12.496366, 41.902782, []byte("Rome"))
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			lon, lat, radius float64
+			want             string
+		}{
+			{15, 37, 200 * 1000, "[Catania Palermo]"},
+			{15, 37, 600 * 1000, "[Catania Palermo Rome]"},
+			{2.35, 48.85, 10, "[]"},
+			{2.35, 48.85, 1000, "[Paris]"},
+			{180, -16, 1200 * 1000, "[Suva Apia]"},
+		}
+
+		for _, tt := range tests {
+			if err := db.View(func(tx *Tx) error {
+				members, err := tx.GeoRadius("bucket", []byte("cities"), tt.lon, tt.lat, tt.radius)
+				if err != nil {
+					return err
+				}
+
+				var got []string
+				for _, m := range members {
+					got = append(got, string(m.Member))
+				}
+				if g := fmt.Sprintf("%v", got); g != tt.want {
+					t.Errorf("mode %d: err GeoRadius %v %v %v, got %v want %v", mode, tt.lon, tt.lat, tt.radius, g, tt.want)
+				}
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := db.View(func(tx *Tx) error {
+			members, err := tx.GeoRadius("bucket", []byte("cities"), 13.361389, 38.115556, 1)
+			if err != nil {
+				return err
+			}
+			if len(members) != 1 || math.Abs(members[0].Longitude-13.361389) > 1e-5 || math.Abs(members[0].Latitude-38.115556) > 1e-5 {
+				t.Errorf("mode %d: err GeoRadius, got %v want Palermo at its position", mode, members)
+			}
+
+			// the radius of half the circumference of the earth covers all the members.
+			members, err = tx.GeoRadius("bucket", []byte("cities"), 0, 0, math.Pi*earthRadius)
+			if err != nil {
+				return err
+			}
+			if len(members) != len(places) {
+				t.Errorf("mode %d: err GeoRadius, got %d members want %d", mode, len(members), len(places))
+			}
+
+			// Rome is at a single position.
+			members, err = tx.GeoRadius("bucket", []byte("cities"), 12.496366, 41.902782, 1000)
+			if err != nil {
+				return err
+			}
+			if len(members) != 1 {
+				t.Errorf("mode %d: err GeoRadius, got %d members of Rome want 1", mode, len(members))
+			}
+
+			if members, err := tx.GeoRadius("bucket_fake", []byte("cities"), 0, 0, 1000); err != nil || len(members) != 0 {
+				t.Errorf("mode %d: err GeoRadius, got %v, %v want no members", mode, members, err)
+			}
+
+			if _, err := tx.GeoRadius("bucket", []byte("cities"), 0, 91, 1000); err != ErrGeoCoordinate {
+				t.Errorf("mode %d: err GeoRadius, got %v want %v", mode, err, ErrGeoCoordinate)
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		db.Close()
+	}
+}
+
+func TestGeohash(t *testing.T) {
+	for _, p := range [][2]float64{{0, 0}, {-180, -90}, {180, 90}, {13.361389, 38.115556}, {-122.419416, 37.774929}} {
+		lon, lat := geohashDecode(geohashEncode(p[0], p[1], geoStep), geoStep)
+		if geoDistance(p[0], p[1], lon, lat) > 1 {
+			t.Errorf("err geohash %v, got %v %v", p, lon, lat)
+		}
+	}
+
+	// Palermo to Catania.
+	if d := geoDistance(13.361389, 38.115556, 15.087269, 37.502669); math.Abs(d-166274) > 100 {
+		t.Errorf("err geoDistance, got %v want about 166274", d)
+	}
+}
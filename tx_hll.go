@@ -0,0 +1,127 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"errors"
+	"time"
+
+	"github.com/xujiajun/nutsdb/ds/hll"
+)
+
+// ErrValueNotHLL is returned when PFAdd, PFCount or PFMerge is called on a value which is not a HyperLogLog.
+var ErrValueNotHLL = errors.New("value is not a hyperloglog")
+
+// PFAdd adds the items to the HyperLogLog stored as the value of the key in the bucket at given
+// bucket and key, creating it if the key does not exist. It returns if the estimated count is changed.
+// The HyperLogLog keeps the TTL of the key.
+func (tx *Tx) PFAdd(bucket string, key []byte, items ...[]byte) (bool, error) {
+	if err := tx.checkTxIsWritable(); err != nil {
+		return false, err
+	}
+
+	e, h, err := tx.getHLL(bucket, key)
+	if err != nil {
+		return false, err
+	}
+
+	changed := e == nil
+	for _, item := range items {
+		if h.Add(item) {
+			changed = true
+		}
+	}
+
+	if !changed {
+		return false, nil
+	}
+
+	return true, tx.putHLL(bucket, key, h, e)
+}
+
+// PFCount returns the estimated number of the distinct items added to the union of the
+// HyperLogLogs stored in the bucket at given bucket and keys, the missing keys count as empty.
+func (tx *Tx) PFCount(bucket string, keys ...[]byte) (uint64, error) {
+	if err := tx.checkTxIsClosed(); err != nil {
+		return 0, err
+	}
+
+	union := hll.New()
+	for _, key := range keys {
+		_, h, err := tx.getHLL(bucket, key)
+		if err != nil {
+			return 0, err
+		}
+		union.Merge(h)
+	}
+
+	return union.Count(), nil
+}
+
+// PFMerge merges the HyperLogLogs stored in the bucket at given bucket and srcKeys into the one
+// at dstKey, creating it if the key does not exist. The missing source keys count as empty.
+func (tx *Tx) PFMerge(bucket string, dstKey []byte, srcKeys ...[]byte) error {
+	if err := tx.checkTxIsWritable(); err != nil {
+		return err
+	}
+
+	e, union, err := tx.getHLL(bucket, dstKey)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range srcKeys {
+		_, h, err := tx.getHLL(bucket, key)
+		if err != nil {
+			return err
+		}
+		union.Merge(h)
+	}
+
+	return tx.putHLL(bucket, dstKey, union, e)
+}
+
+// getHLL returns the live entry of the key with the writes of the tx and its HyperLogLog,
+// or a nil entry and an empty HyperLogLog if the key does not exist.
+func (tx *Tx) getHLL(bucket string, key []byte) (*Entry, *hll.HLL, error) {
+	e, err := tx.current(bucket, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	h := hll.New()
+	if e != nil {
+		if err := h.UnmarshalBinary(e.Value); err != nil {
+			return nil, nil, ErrValueNotHLL
+		}
+	}
+
+	return e, h, nil
+}
+
+// putHLL writes the HyperLogLog as the value of the key, with the TTL of the old entry e if there is one.
+func (tx *Tx) putHLL(bucket string, key []byte, h *hll.HLL, e *Entry) error {
+	value, err := h.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	ttl, timestamp := Persistent, uint64(time.Now().Unix())
+	if e != nil {
+		ttl, timestamp = e.Meta.TTL, e.Meta.timestamp
+	}
+
+	return tx.put(bucket, key, value, ttl, DataSetFlag, timestamp, DataStructureBPTree)
+}
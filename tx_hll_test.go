@@ -0,0 +1,116 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestTx_PFAddAndPFCount(t *testing.T) {
+	InitOpt("/tmp/nutsdbtesthll", true)
+	opt.SegmentSize = 64 * 1024
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pfAdd := func(key string, from, to int) {
+		var items [][]byte
+		for i := from; i < to; i++ {
+			items = append(items, []byte(fmt.Sprintf("user_%d", i)))
+		}
+
+		if err := db.Update(func(tx *Tx) error {
+			_, err := tx.PFAdd("bucket", []byte(key), items...)
+			return err
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pfCount := func(want uint64, keys ...string) {
+		t.Helper()
+
+		var bkeys [][]byte
+		for _, key := range keys {
+			bkeys = append(bkeys, []byte(key))
+		}
+
+		if err := db.View(func(tx *Tx) error {
+			n, err := tx.PFCount("bucket", bkeys...)
+			if err != nil {
+				return err
+			}
+			if n < want*97/100 || n > want*103/100 {
+				t.Errorf("err PFCount %v, got %d want about %d", keys, n, want)
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pfAdd("day1", 0, 3000)
+	pfAdd("day1", 0, 3000)
+	pfAdd("day2", 2000, 5000)
+
+	pfCount(3000, "day1")
+	pfCount(5000, "day1", "day2")
+	pfCount(3000, "day2", "key_fake")
+
+	if err := db.Update(func(tx *Tx) error {
+		changed, err := tx.PFAdd("bucket", []byte("day1"), []byte("user_1"))
+		if err != nil {
+			return err
+		}
+		if changed {
+			t.Error("err PFAdd, the count is changed by an item added again")
+		}
+
+		// an empty HyperLogLog is created without items.
+		if changed, err := tx.PFAdd("bucket", []byte("empty")); err != nil || !changed {
+			t.Errorf("err PFAdd, got %v, %v want true, nil", changed, err)
+		}
+
+		return tx.PFMerge("bucket", []byte("week"), []byte("day1"), []byte("day2"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	pfCount(5000, "week")
+	pfCount(0, "empty")
+
+	if err := db.Update(func(tx *Tx) error {
+		if err := tx.Put("bucket", []byte("plain"), []byte("val"), Persistent); err != nil {
+			return err
+		}
+		_, err := tx.PFAdd("bucket", []byte("plain"), []byte("user_1"))
+		return err
+	}); err != ErrValueNotHLL {
+		t.Errorf("err PFAdd, got %v want %v", err, ErrValueNotHLL)
+	}
+
+	// the HyperLogLogs are plain values in the data files.
+	db.Close()
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	pfCount(5000, "week")
+	pfCount(3000, "day1")
+}
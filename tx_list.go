@@ -49,7 +49,7 @@ func (tx *Tx) RPeek(bucket string, key []byte) (item []byte, err error) {
 
 	item, _, err = tx.db.ListIdx[bucket].RPeek(string(key))
 
-	return
+	return item, dsNotFound(err)
 }
 
 // push sets values for list stored in the bucket at given bucket, key, flag and values.
@@ -112,7 +112,7 @@ func (tx *Tx) LPeek(bucket string, key []byte) (item []byte, err error) {
 
 	item, err = tx.db.ListIdx[bucket].LPeek(string(key))
 
-	return
+	return item, dsNotFound(err)
 }
 
 // LSize returns the size of key in the bucket in the bucket at given bucket and key.
@@ -125,7 +125,8 @@ func (tx *Tx) LSize(bucket string, key []byte) (int, error) {
 		return 0, ErrBucket
 	}
 
-	return tx.db.ListIdx[bucket].Size(string(key))
+	size, err := tx.db.ListIdx[bucket].Size(string(key))
+	return size, dsNotFound(err)
 }
 
 // LRange returns the specified elements of the list stored in the bucket at given bucket,key, start and end.
@@ -142,7 +143,52 @@ func (tx *Tx) LRange(bucket string, key []byte, start, end int) (list [][]byte,
 		return nil, ErrBucket
 	}
 
-	return tx.db.ListIdx[bucket].LRange(string(key), start, end)
+	list, err = tx.db.ListIdx[bucket].LRange(string(key), start, end)
+	return list, dsNotFound(err)
+}
+
+// LScan iterates over the items of the list stored in the bucket at given bucket and key, from the head
+// to the tail, starting after the cursor returned by the previous page, or from the head if cursor is empty.
+// It returns at most count items, all of them if count is not positive, and the next cursor, which is
+// empty on the last page. The cursor is the index of the next item, so the items pushed at the head
+// or removed before it shift the next pages.
+func (tx *Tx) LScan(bucket string, key []byte, cursor string, count int) (items [][]byte, next string, err error) {
+	if err := tx.checkTxIsClosed(); err != nil {
+		return nil, "", err
+	}
+
+	pos, err := decodeKindCursor(listCursor, cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	start := 0
+	if pos != nil {
+		if start, err = strconv2.StrToInt(string(pos)); err != nil || start < 0 {
+			return nil, "", ErrInvalidCursor
+		}
+	}
+
+	if _, ok := tx.db.ListIdx[bucket]; !ok {
+		return nil, "", ErrBucket
+	}
+
+	size, err := tx.db.ListIdx[bucket].Size(string(key))
+	if err != nil {
+		return nil, "", dsNotFound(err)
+	}
+
+	if start >= size {
+		return nil, "", nil
+	}
+
+	end := size
+	if count > 0 && start+count < size {
+		end = start + count
+		next = encodeKindCursor(listCursor, []byte(strconv2.IntToStr(end)))
+	}
+
+	return tx.db.ListIdx[bucket].Items[string(key)][start:end], next, nil
 }
 
 // LRem removes the first count occurrences of elements equal to value from the list stored in the bucket at given bucket,key,count.
@@ -175,7 +221,7 @@ func (tx *Tx) LRem(bucket string, key []byte, count int, value []byte) (removedN
 	}
 
 	removedNum, err = tx.db.ListIdx[bucket].LRemNum(string(key), count, value)
-	return
+	return removedNum, dsNotFound(err)
 }
 
 // LSet sets the list element at index to value.
@@ -246,6 +292,49 @@ func (tx *Tx) LTrim(bucket string, key []byte, start, end int) error {
 	return tx.push(bucket, newKey, DataLTrimFlag, []byte(strconv2.IntToStr(end)))
 }
 
+// LInsertBefore inserts value before the first element equal to pivot in the list stored in the bucket
+// at given bucket, key, pivot and value. It returns list.ErrPivotNotFound if pivot is not in the list.
+func (tx *Tx) LInsertBefore(bucket string, key, pivot, value []byte) error {
+	return tx.lInsert(bucket, key, pivot, value, false)
+}
+
+// LInsertAfter inserts value after the first element equal to pivot in the list stored in the bucket
+// at given bucket, key, pivot and value. It returns list.ErrPivotNotFound if pivot is not in the list.
+func (tx *Tx) LInsertAfter(bucket string, key, pivot, value []byte) error {
+	return tx.lInsert(bucket, key, pivot, value, true)
+}
+
+func (tx *Tx) lInsert(bucket string, key, pivot, value []byte, after bool) error {
+	var buffer bytes.Buffer
+
+	if err := tx.checkTxIsClosed(); err != nil {
+		return err
+	}
+
+	if _, ok := tx.db.ListIdx[bucket]; !ok {
+		return ErrBucket
+	}
+
+	if _, ok := tx.db.ListIdx[bucket].Items[string(key)]; !ok {
+		return ErrKeyNotFound
+	}
+
+	index := tx.db.ListIdx[bucket].LIndex(string(key), pivot)
+	if index < 0 {
+		return list.ErrPivotNotFound
+	}
+	if after {
+		index++
+	}
+
+	buffer.Write(key)
+	buffer.Write([]byte(SeparatorForListKey))
+	buffer.Write([]byte(strconv2.IntToStr(index)))
+	newKey := buffer.Bytes()
+
+	return tx.push(bucket, newKey, DataLInsertFlag, value)
+}
+
 // ErrSeparatorForListKey returns when list key contains the SeparatorForListKey.
 func ErrSeparatorForListKey() error {
 	return errors.New("contain separator (" + SeparatorForListKey + ") for List key")
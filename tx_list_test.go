@@ -15,9 +15,13 @@
 package nutsdb
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"testing"
+	"time"
+
+	"github.com/xujiajun/nutsdb/ds/list"
 )
 
 func InitForList() {
@@ -664,3 +668,166 @@ func TestTx_LSize(t *testing.T) {
 		}
 	}
 }
+
+func TestTx_LScan(t *testing.T) {
+	InitForList()
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	bucket := "bucket_for_lscan"
+	key := []byte("key1")
+	if err := db.Update(func(tx *Tx) error {
+		return tx.RPush(bucket, key, []byte("a"), []byte("b"), []byte("c"), []byte("d"), []byte("e"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		items  []string
+		cursor string
+		pages  int
+	)
+	for {
+		if err := db.View(func(tx *Tx) error {
+			page, next, err := tx.LScan(bucket, key, cursor, 2)
+			for _, item := range page {
+				items = append(items, string(item))
+			}
+			cursor = next
+			return err
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		pages++
+		if cursor == "" {
+			break
+		}
+	}
+
+	if pages != 3 || len(items) != 5 || items[0] != "a" || items[4] != "e" {
+		t.Errorf("err LScan, got %v in %d pages", items, pages)
+	}
+
+	if err := db.View(func(tx *Tx) error {
+		if all, next, err := tx.LScan(bucket, key, "", 0); err != nil || len(all) != 5 || next != "" {
+			t.Errorf("err LScan without count, got %d items %q %v", len(all), next, err)
+		}
+		if _, _, err := tx.LScan(bucket, key, encodeKindCursor(listCursor, []byte("x")), 2); err != ErrInvalidCursor {
+			t.Errorf("err LScan, got %v want %v", err, ErrInvalidCursor)
+		}
+		if _, _, err := tx.LScan("bucket_not_exists", key, "", 2); err != ErrBucket {
+			t.Errorf("err LScan, got %v want %v", err, ErrBucket)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTx_LInsert(t *testing.T) {
+	InitForList()
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bucket := "bucket_for_linsert"
+	key := []byte("key1")
+	if err := db.Update(func(tx *Tx) error {
+		return tx.RPush(bucket, key, []byte("a"), []byte("c"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Update(func(tx *Tx) error {
+		if err := tx.LInsertBefore(bucket, key, []byte("c"), []byte("b")); err != nil {
+			return err
+		}
+		if err := tx.LInsertAfter(bucket, key, []byte("a"), []byte("a2")); err != nil {
+			return err
+		}
+		if err := tx.LInsertBefore(bucket, key, []byte("z"), []byte("y")); err != list.ErrPivotNotFound {
+			t.Errorf("err LInsertBefore, got %v want %v", err, list.ErrPivotNotFound)
+		}
+		if err := tx.LInsertBefore(bucket, []byte("key2"), []byte("a"), []byte("b")); err != ErrKeyNotFound {
+			t.Errorf("err LInsertBefore, got %v want %v", err, ErrKeyNotFound)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func() {
+		if err := db.View(func(tx *Tx) error {
+			items, err := tx.LRange(bucket, key, 0, -1)
+			if err != nil {
+				return err
+			}
+			if got := fmt.Sprintf("%s", items); got != "[a a2 b c]" {
+				t.Errorf("err LInsert, got %s want [a a2 b c]", got)
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	check()
+
+	// the inserts are replayed when the db is opened again.
+	db.Close()
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	check()
+}
+
+func TestDB_BRPop(t *testing.T) {
+	InitForList()
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	bucket := "bucket_for_brpop"
+	key := []byte("queue")
+
+	start := time.Now()
+	if _, err := db.BRPop(bucket, key, 50*time.Millisecond); err != ErrPopTimeout {
+		t.Errorf("err BRPop, got %v want %v", err, ErrPopTimeout)
+	}
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Errorf("err BRPop, returned after %v", d)
+	}
+
+	// the pop waits for the push of another tx.
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		db.Update(func(tx *Tx) error {
+			return tx.RPush(bucket, key, []byte("job1"), []byte("job2"))
+		})
+	}()
+
+	item, err := db.BRPop(bucket, key, 5*time.Second)
+	if err != nil || string(item) != "job2" {
+		t.Errorf("err BRPop, got %s %v want job2", item, err)
+	}
+
+	item, err = db.BLPop(bucket, key, 0)
+	if err != nil || string(item) != "job1" {
+		t.Errorf("err BLPop, got %s %v want job1", item, err)
+	}
+
+	// the list is empty again.
+	if _, err := db.BLPop(bucket, key, 10*time.Millisecond); err != ErrPopTimeout {
+		t.Errorf("err BLPop, got %v want %v", err, ErrPopTimeout)
+	}
+}
@@ -0,0 +1,214 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+)
+
+// trackPending records the entry as the last pending write of its key, if it is a write
+// to the B+ tree of a bucket, so that the reads of the tx see it.
+func (tx *Tx) trackPending(e *Entry) {
+	if e.Meta.ds != DataStructureBPTree {
+		return
+	}
+
+	bucket := string(e.Meta.bucket)
+	if tx.pendingKeys == nil {
+		tx.pendingKeys = make(map[string]map[string]*Entry)
+	}
+	if tx.pendingKeys[bucket] == nil {
+		tx.pendingKeys[bucket] = make(map[string]*Entry)
+	}
+
+	tx.pendingKeys[bucket][string(e.Key)] = e
+}
+
+// rebuildPending records again the last pending writes of the keys from the pendingWrites.
+func (tx *Tx) rebuildPending() {
+	tx.pendingKeys = nil
+	tx.tenantPending = nil
+	for _, e := range tx.pendingWrites {
+		tx.trackPending(e)
+	}
+}
+
+// pendingGet returns the last pending write of the key in the bucket, nil if the key is
+// deleted by the tx, and if the tx writes the key.
+func (tx *Tx) pendingGet(bucket string, key []byte) (*Entry, bool) {
+	e, ok := tx.pendingKeys[bucket][string(key)]
+	if !ok {
+		return nil, false
+	}
+
+	if e.Meta.Flag == DataDeleteFlag {
+		return nil, true
+	}
+
+	return e, true
+}
+
+// pendingScan returns the last pending writes of the keys of the bucket matching fn,
+// the deletes included, sorted by the keys in the order of the bucket, or nil if there is none.
+func (tx *Tx) pendingScan(bucket string, fn func(key []byte) bool) (pending Entries) {
+	for _, e := range tx.pendingKeys[bucket] {
+		if fn(e.Key) {
+			pending = append(pending, e)
+		}
+	}
+
+	cmp := tx.keyCompare(bucket)
+	sort.Slice(pending, func(i, j int) bool {
+		return cmp(pending[i].Key, pending[j].Key) < 0
+	})
+
+	return pending
+}
+
+// inRange returns the matcher of the keys from start to end in the order cmp, both included.
+func inRange(cmp func(a, b []byte) int, start, end []byte) func(key []byte) bool {
+	return func(key []byte) bool {
+		return cmp(key, start) >= 0 && cmp(key, end) <= 0
+	}
+}
+
+// hasPrefix returns the matcher of the keys with the prefix.
+func hasPrefix(prefix []byte) func(key []byte) bool {
+	return func(key []byte) bool {
+		return bytes.HasPrefix(key, prefix)
+	}
+}
+
+// pendingPrefixMatch returns the matcher of the keys with the prefix whose rest matches reg,
+// or nil if the regular expression is malformed.
+func pendingPrefixMatch(prefix []byte, reg string) func(key []byte) bool {
+	rgx, err := regexp.Compile(reg)
+	if err != nil {
+		return nil
+	}
+
+	return func(key []byte) bool {
+		return bytes.HasPrefix(key, prefix) && rgx.Match(bytes.TrimPrefix(key, prefix))
+	}
+}
+
+// overlayPending returns the committed entries es, sorted by the keys in the order cmp or in the
+// reverse order, with the pending writes applied: the written keys have their pending entries and
+// the deleted keys are removed.
+func overlayPending(es, pending Entries, cmp func(a, b []byte) int, reverse bool) Entries {
+	if reverse {
+		pending = reverseEntries(append(Entries(nil), pending...))
+	}
+
+	before := func(a, b []byte) bool {
+		if reverse {
+			return cmp(a, b) > 0
+		}
+		return cmp(a, b) < 0
+	}
+
+	result := make(Entries, 0, len(es)+len(pending))
+
+	i, j := 0, 0
+	for i < len(es) || j < len(pending) {
+		switch {
+		case j == len(pending) || i < len(es) && before(es[i].Key, pending[j].Key):
+			result = append(result, es[i])
+			i++
+		default:
+			if i < len(es) && bytes.Equal(es[i].Key, pending[j].Key) {
+				i++
+			}
+			if pending[j].Meta.Flag != DataDeleteFlag {
+				result = append(result, pending[j])
+			}
+			j++
+		}
+	}
+
+	return result
+}
+
+// isScanNotFound returns if err is returned by a scan which finds no entry, in HintBPTSparseIdxMode
+// the meta file of a bucket without committed entries is missing or empty.
+func isScanNotFound(err error) bool {
+	return errors.Is(err, ErrRangeScan) || errors.Is(err, ErrPrefixScan) || errors.Is(err, ErrPrefixSearchScan) ||
+		errors.Is(err, ErrBucketEmpty) || errors.Is(err, ErrBucketNotFound) ||
+		errors.Is(err, os.ErrNotExist) || errors.Is(err, io.EOF)
+}
+
+// scanWithPending returns the entries es of the committed scan with the pending writes applied,
+// or the error err of the committed scan, or notFound, if there is no entry.
+func scanWithPending(es Entries, err error, pending Entries, cmp func(a, b []byte) int, reverse bool, notFound error) (Entries, error) {
+	if err != nil && !isScanNotFound(err) {
+		return nil, err
+	}
+
+	if es = overlayPending(es, pending, cmp, reverse); len(es) == 0 {
+		if err == nil {
+			err = notFound
+		}
+		return nil, err
+	}
+
+	return es, nil
+}
+
+// pageWithPending returns the page of the entries es of the committed scan with the pending
+// writes applied, after the first offsetNum entries and at most limitNum of them.
+func pageWithPending(es Entries, err error, pending Entries, cmp func(a, b []byte) int, reverse bool, offsetNum, limitNum int, notFound error) (Entries, int, error) {
+	if es, err = scanWithPending(es, err, pending, cmp, reverse, notFound); err != nil {
+		return nil, 0, err
+	}
+
+	es, off := pageEntries(es, offsetNum, limitNum)
+	if len(es) == 0 {
+		return nil, off, notFound
+	}
+
+	return es, off, nil
+}
+
+// keyEntries returns the entries of the keys without their values, to apply the pending writes
+// to the keys of a key-only scan.
+func keyEntries(keys [][]byte) Entries {
+	es := make(Entries, len(keys))
+	for i, key := range keys {
+		es[i] = &Entry{Key: key}
+	}
+
+	return es
+}
+
+// pageEntries returns the entries after the first offsetNum ones, at most limitNum of them,
+// and the number of the skipped entries.
+func pageEntries(es Entries, offsetNum, limitNum int) (Entries, int) {
+	off := offsetNum
+	if off > len(es) {
+		off = len(es)
+	}
+	es = es[off:]
+
+	if limitNum > 0 && limitNum < len(es) {
+		es = es[:limitNum]
+	}
+
+	return es, off
+}
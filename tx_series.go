@@ -0,0 +1,266 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"time"
+)
+
+// the tags after the separator of the keys of the points and of the retention of a series,
+// the keys are laid out as the keys of the streams.
+const (
+	seriesPointTag     = "p"
+	seriesRetentionTag = "r"
+)
+
+// ErrSeriesStep is returned by TSQueryRange when the step is not positive.
+var ErrSeriesStep = errors.New("the step of the series query must be positive")
+
+// SeriesPoint represents a point of a time series.
+type SeriesPoint struct {
+	Time  time.Time
+	Value float64
+}
+
+// SeriesAggregator represents how TSQueryRange aggregates the points of a step.
+type SeriesAggregator int
+
+const (
+	// SeriesAvg aggregates the points of a step into their average.
+	SeriesAvg SeriesAggregator = iota
+
+	// SeriesSum aggregates the points of a step into their sum.
+	SeriesSum
+
+	// SeriesMin aggregates the points of a step into their minimum.
+	SeriesMin
+
+	// SeriesMax aggregates the points of a step into their maximum.
+	SeriesMax
+
+	// SeriesCount aggregates the points of a step into their number.
+	SeriesCount
+
+	// SeriesFirst aggregates the points of a step into the first of them.
+	SeriesFirst
+
+	// SeriesLast aggregates the points of a step into the last of them.
+	SeriesLast
+)
+
+// TSAppend writes the value of the series stored in the bucket at given bucket and key at the time t,
+// it replaces the value written at the same time. The points are stored as the keys of the B+ tree of
+// the bucket sorted by the time, under the key and the separator SeparatorForStreamKey. If the series
+// has a retention, the points older than t minus the retention are deleted.
+func (tx *Tx) TSAppend(bucket string, key []byte, t time.Time, value float64) error {
+	if err := tx.checkTxIsWritable(); err != nil {
+		return err
+	}
+
+	v := make([]byte, 8)
+	binary.BigEndian.PutUint64(v, math.Float64bits(value))
+
+	if err := tx.Put(bucket, seriesPointKey(key, t), v, Persistent); err != nil {
+		return err
+	}
+
+	retention, err := tx.TSRetention(bucket, key)
+	if err != nil || retention == 0 {
+		return err
+	}
+
+	return tx.TSTrim(bucket, key, t.Add(-retention))
+}
+
+// TSSetRetention sets the retention of the series stored in the bucket at given bucket and key,
+// the writes of TSAppend delete the points older than their time minus the retention.
+// The retention 0 keeps all the points.
+func (tx *Tx) TSSetRetention(bucket string, key []byte, retention time.Duration) error {
+	if err := tx.checkTxIsWritable(); err != nil {
+		return err
+	}
+
+	retentionKey := streamKey(key, seriesRetentionTag, nil)
+	if retention <= 0 {
+		if e, err := tx.current(bucket, retentionKey); err != nil || e == nil {
+			return err
+		}
+		return tx.Delete(bucket, retentionKey)
+	}
+
+	return tx.Put(bucket, retentionKey, EncodeInt64(int64(retention)), Persistent)
+}
+
+// TSRetention returns the retention of the series stored in the bucket at given bucket and key,
+// 0 if the series keeps all the points.
+func (tx *Tx) TSRetention(bucket string, key []byte) (time.Duration, error) {
+	if err := tx.checkTxIsClosed(); err != nil {
+		return 0, err
+	}
+
+	e, err := tx.current(bucket, streamKey(key, seriesRetentionTag, nil))
+	if err != nil || e == nil {
+		return 0, err
+	}
+
+	retention, err := DecodeInt64(e.Value)
+	if err != nil {
+		return 0, nil
+	}
+
+	return time.Duration(retention), nil
+}
+
+// TSTrim deletes the points of the series stored in the bucket at given bucket and key before the time t.
+func (tx *Tx) TSTrim(bucket string, key []byte, t time.Time) error {
+	if err := tx.checkTxIsWritable(); err != nil {
+		return err
+	}
+
+	end := seriesTimeBytes(t)
+	if binary.BigEndian.Uint64(end) == 0 {
+		return nil
+	}
+	binary.BigEndian.PutUint64(end, binary.BigEndian.Uint64(end)-1)
+
+	keys, err := tx.RangeScanKeys(bucket, streamKey(key, seriesPointTag, make([]byte, 8)), streamKey(key, seriesPointTag, end))
+	if err != nil {
+		if errors.Is(err, ErrRangeScan) || errors.Is(err, ErrBucketNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	for _, k := range keys {
+		if err := tx.Delete(bucket, k); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// TSRange returns the points of the series stored in the bucket at given bucket and key from the time
+// from to the time to, both included, in ascending order of the time.
+func (tx *Tx) TSRange(bucket string, key []byte, from, to time.Time) ([]SeriesPoint, error) {
+	if to.Before(from) {
+		return nil, nil
+	}
+
+	es, err := tx.RangeScan(bucket, seriesPointKey(key, from), seriesPointKey(key, to))
+	if err != nil {
+		if errors.Is(err, ErrRangeScan) || errors.Is(err, ErrBucketNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	prefixLen := len(key) + len(SeparatorForStreamKey) + len(seriesPointTag)
+
+	points := make([]SeriesPoint, 0, len(es))
+	for _, e := range es {
+		if len(e.Key) != prefixLen+8 || len(e.Value) != 8 {
+			continue
+		}
+		points = append(points, SeriesPoint{
+			Time:  time.Unix(0, int64(binary.BigEndian.Uint64(e.Key[prefixLen:])^(1<<63))),
+			Value: math.Float64frombits(binary.BigEndian.Uint64(e.Value)),
+		})
+	}
+
+	return points, nil
+}
+
+// TSQueryRange returns the points of the series stored in the bucket at given bucket and key from the time
+// from to the time to, both included, downsampled by the step: the points from from+i*step to before
+// from+(i+1)*step are aggregated into one point at from+i*step. The steps without points are skipped.
+func (tx *Tx) TSQueryRange(bucket string, key []byte, from, to time.Time, step time.Duration, agg SeriesAggregator) ([]SeriesPoint, error) {
+	if step <= 0 {
+		return nil, ErrSeriesStep
+	}
+
+	points, err := tx.TSRange(bucket, key, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		result []SeriesPoint
+		window []SeriesPoint
+		start  time.Time
+	)
+
+	for _, p := range points {
+		s := from.Add(p.Time.Sub(from) / step * step)
+		if len(window) > 0 && !s.Equal(start) {
+			result = append(result, SeriesPoint{Time: start, Value: agg.aggregate(window)})
+			window = window[:0]
+		}
+		start = s
+		window = append(window, p)
+	}
+
+	if len(window) > 0 {
+		result = append(result, SeriesPoint{Time: start, Value: agg.aggregate(window)})
+	}
+
+	return result, nil
+}
+
+// aggregate returns the aggregate of the points, in ascending order of the time.
+func (agg SeriesAggregator) aggregate(points []SeriesPoint) float64 {
+	switch agg {
+	case SeriesCount:
+		return float64(len(points))
+	case SeriesFirst:
+		return points[0].Value
+	case SeriesLast:
+		return points[len(points)-1].Value
+	}
+
+	v := points[0].Value
+	for _, p := range points[1:] {
+		switch agg {
+		case SeriesMin:
+			v = math.Min(v, p.Value)
+		case SeriesMax:
+			v = math.Max(v, p.Value)
+		default:
+			v += p.Value
+		}
+	}
+
+	if agg == SeriesAvg {
+		v /= float64(len(points))
+	}
+
+	return v
+}
+
+// seriesPointKey returns the key of the B+ tree of the point of the series at given key and time.
+func seriesPointKey(key []byte, t time.Time) []byte {
+	return streamKey(key, seriesPointTag, seriesTimeBytes(t))
+}
+
+// seriesTimeBytes returns the 8 bytes of the time in nanoseconds with the sign bit flipped,
+// so that the times before 1970 are sorted before the others.
+func seriesTimeBytes(t time.Time) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(t.UnixNano())^(1<<63))
+	return b
+}
@@ -0,0 +1,161 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// seriesValues returns the times in seconds after base and the values of the points.
+func seriesValues(base time.Time, points []SeriesPoint) string {
+	var values []string
+	for _, p := range points {
+		values = append(values, fmt.Sprintf("%d:%g", p.Time.Sub(base)/time.Second, p.Value))
+	}
+	return fmt.Sprintf("%v", values)
+}
+
+func TestTx_TSAppendAndQueryRange(t *testing.T) {
+	base := time.Unix(1700000000, 0)
+
+	for _, mode := range []EntryIdxMode{HintKeyValAndRAMIdxMode, HintKeyAndRAMIdxMode, HintBPTSparseIdxMode} {
+		InitOpt("/tmp/nutsdbtestseries", true)
+		opt.EntryIdxMode = mode
+		db, err = Open(opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := db.Update(func(tx *Tx) error {
+			for i, v := range []float64{1, 2, 3, 4, 5, 6, 7} {
+				if err := tx.TSAppend("metrics", []byte("cpu"), base.Add(time.Duration(i)*10*time.Second), v); err != nil {
+					return err
+				}
+			}
+			// the value at the same time is replaced.
+			return tx.TSAppend("metrics", []byte("cpu"), base.Add(60*time.Second), 10)
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := db.View(func(tx *Tx) error {
+			points, err := tx.TSRange("metrics", []byte("cpu"), base.Add(15*time.Second), base.Add(60*time.Second))
+			if err != nil {
+				return err
+			}
+			if got, want := seriesValues(base, points), "[20:3 30:4 40:5 50:6 60:10]"; got != want {
+				t.Errorf("mode %d: err TSRange, got %s want %s", mode, got, want)
+			}
+
+			for agg, want := range map[SeriesAggregator]string{
+				SeriesAvg:   "[0:2 30:5 60:10]",
+				SeriesSum:   "[0:6 30:15 60:10]",
+				SeriesMin:   "[0:1 30:4 60:10]",
+				SeriesMax:   "[0:3 30:6 60:10]",
+				SeriesCount: "[0:3 30:3 60:1]",
+				SeriesFirst: "[0:1 30:4 60:10]",
+				SeriesLast:  "[0:3 30:6 60:10]",
+			} {
+				points, err := tx.TSQueryRange("metrics", []byte("cpu"), base, base.Add(time.Minute), 30*time.Second, agg)
+				if err != nil {
+					return err
+				}
+				if got := seriesValues(base, points); got != want {
+					t.Errorf("mode %d: err TSQueryRange %d, got %s want %s", mode, agg, got, want)
+				}
+			}
+
+			if _, err := tx.TSQueryRange("metrics", []byte("cpu"), base, base.Add(time.Minute), 0, SeriesAvg); err != ErrSeriesStep {
+				t.Errorf("mode %d: err TSQueryRange, got %v want %v", mode, err, ErrSeriesStep)
+			}
+
+			points, err = tx.TSRange("metrics", []byte("mem"), base, base.Add(time.Minute))
+			if err != nil || len(points) != 0 {
+				t.Errorf("mode %d: err TSRange of an empty series, got %v %v", mode, points, err)
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		db.Close()
+	}
+}
+
+func TestTx_TSRetention(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestseries", true)
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	base := time.Unix(1700000000, 0)
+
+	if err := db.Update(func(tx *Tx) error {
+		if err := tx.TSSetRetention("metrics", []byte("cpu"), 30*time.Second); err != nil {
+			return err
+		}
+		for i := 0; i < 6; i++ {
+			if err := tx.TSAppend("metrics", []byte("cpu"), base.Add(time.Duration(i)*10*time.Second), float64(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(want string) {
+		t.Helper()
+
+		if err := db.View(func(tx *Tx) error {
+			points, err := tx.TSRange("metrics", []byte("cpu"), base, base.Add(time.Hour))
+			if err != nil {
+				return err
+			}
+			if got := seriesValues(base, points); got != want {
+				t.Errorf("err TSRange, got %s want %s", got, want)
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check("[20:2 30:3 40:4 50:5]")
+
+	// the series keeps all the points without a retention.
+	if err := db.Update(func(tx *Tx) error {
+		if err := tx.TSSetRetention("metrics", []byte("cpu"), 0); err != nil {
+			return err
+		}
+		if retention, err := tx.TSRetention("metrics", []byte("cpu")); err != nil || retention != 0 {
+			t.Errorf("err TSRetention, got %v %v want 0", retention, err)
+		}
+		return tx.TSAppend("metrics", []byte("cpu"), base.Add(10*time.Minute), 6)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	check("[20:2 30:3 40:4 50:5 600:6]")
+
+	if err := db.Update(func(tx *Tx) error {
+		return tx.TSTrim("metrics", []byte("cpu"), base.Add(40*time.Second))
+	}); err != nil {
+		t.Fatal(err)
+	}
+	check("[40:4 50:5 600:6]")
+}
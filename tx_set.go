@@ -16,6 +16,7 @@ package nutsdb
 
 import (
 	"errors"
+	"sort"
 	"time"
 
 	"github.com/xujiajun/nutsdb/ds/set"
@@ -49,7 +50,8 @@ func (tx *Tx) SAreMembers(bucket string, key []byte, items ...[]byte) (bool, err
 	}
 
 	if sets, ok := tx.db.SetIdx[bucket]; ok {
-		return sets.SAreMembers(string(key), items...)
+		ok, err := sets.SAreMembers(string(key), items...)
+		return ok, dsNotFound(err)
 	}
 
 	return false, ErrBucketAndKey(bucket, key)
@@ -61,9 +63,12 @@ func (tx *Tx) SIsMember(bucket string, key, item []byte) (bool, error) {
 		return false, err
 	}
 
-	if set, ok := tx.db.SetIdx[bucket]; ok {
-		if !set.SIsMember(string(key), item) {
-			return false, ErrBucketAndKey(bucket, key)
+	if s, ok := tx.db.SetIdx[bucket]; ok {
+		if !s.SHasKey(string(key)) {
+			return false, ErrNotFoundKeyInBucket(bucket, key)
+		}
+		if !s.SIsMember(string(key), item) {
+			return false, set.ErrItemNotFound
 		}
 		return true, nil
 	}
@@ -78,13 +83,50 @@ func (tx *Tx) SMembers(bucket string, key []byte) (list [][]byte, err error) {
 	}
 
 	if set, ok := tx.db.SetIdx[bucket]; ok {
-		return set.SMembers(string(key))
+		list, err := set.SMembers(string(key))
+		return list, dsNotFound(err)
 	}
 
 	return nil, ErrBucketAndKey(bucket, key)
 
 }
 
+// SScan iterates over the members of the set stored in the bucket at given bucket and key, in ascending
+// order, starting after the cursor returned by the previous page, or from the first member if cursor is empty.
+// It returns at most count members, all of them if count is not positive, and the next cursor, which is
+// empty on the last page. The members added or removed before the position do not shift the next pages.
+func (tx *Tx) SScan(bucket string, key []byte, cursor string, count int) (members [][]byte, next string, err error) {
+	if err := tx.checkTxIsClosed(); err != nil {
+		return nil, "", err
+	}
+
+	after, err := decodeKindCursor(setCursor, cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	set, ok := tx.db.SetIdx[bucket]
+	if !ok {
+		return nil, "", ErrBucketAndKey(bucket, key)
+	}
+
+	if count <= 0 {
+		count = set.SCard(string(key))
+	}
+
+	members, err = set.SScan(string(key), after, count+1)
+	if err != nil {
+		return nil, "", ErrNotFoundKeyInBucket(bucket, key)
+	}
+
+	if len(members) > count {
+		members = members[:count]
+		next = encodeKindCursor(setCursor, members[count-1])
+	}
+
+	return members, next, nil
+}
+
 // SHasKey returns if the set in the bucket at given bucket and key.
 func (tx *Tx) SHasKey(bucket string, key []byte) (bool, error) {
 	if err := tx.checkTxIsClosed(); err != nil {
@@ -108,6 +150,7 @@ func (tx *Tx) SPop(bucket string, key []byte) ([]byte, error) {
 		for item := range tx.db.SetIdx[bucket].M[string(key)] {
 			return []byte(item), tx.sPut(bucket, key, DataDeleteFlag, []byte(item))
 		}
+		return nil, ErrNotFoundKeyInBucket(bucket, key)
 	}
 
 	return nil, ErrBucketAndKey(bucket, key)
@@ -134,7 +177,8 @@ func (tx *Tx) SDiffByOneBucket(bucket string, key1, key2 []byte) (list [][]byte,
 	}
 
 	if set, ok := tx.db.SetIdx[bucket]; ok {
-		return set.SDiff(string(key1), string(key2))
+		list, err := set.SDiff(string(key1), string(key2))
+		return list, dsNotFound(err)
 	}
 
 	return nil, ErrBucketAndKey(bucket, key1)
@@ -176,7 +220,8 @@ func (tx *Tx) SMoveByOneBucket(bucket string, key1, key2, item []byte) (bool, er
 	}
 
 	if set, ok := tx.db.SetIdx[bucket]; ok {
-		return set.SMove(string(key1), string(key2), item)
+		ok, err := set.SMove(string(key1), string(key2), item)
+		return ok, dsNotFound(err)
 	}
 
 	return false, ErrBucket
@@ -225,7 +270,8 @@ func (tx *Tx) SUnionByOneBucket(bucket string, key1, key2 []byte) (list [][]byte
 	}
 
 	if set, ok := tx.db.SetIdx[bucket]; ok {
-		return set.SUnion(string(key1), string(key2))
+		list, err := set.SUnion(string(key1), string(key2))
+		return list, dsNotFound(err)
 	}
 
 	return nil, ErrBucket
@@ -271,12 +317,111 @@ func (tx *Tx) SUnionByTwoBuckets(bucket1 string, key1 []byte, bucket2 string, ke
 	return
 }
 
-// ErrBucketAndKey returns when bucket or key not found.
+// SetKey represents the set stored in the bucket at given Bucket and Key, for the store functions.
+type SetKey struct {
+	Bucket string
+	Key    []byte
+}
+
+// SUnionStore stores the members of the union of the sets srcs into the set stored in the bucket at given
+// dstBucket and dstKey, replacing its members, and returns the number of members stored.
+// The missing sets are empty, like in Redis.
+func (tx *Tx) SUnionStore(dstBucket string, dstKey []byte, srcs ...SetKey) (int, error) {
+	return tx.sStore(dstBucket, dstKey, srcs, func(result, members map[string]struct{}, i int) {
+		for member := range members {
+			result[member] = struct{}{}
+		}
+	})
+}
+
+// SInterStore stores the members of the intersection of the sets srcs into the set stored in the bucket
+// at given dstBucket and dstKey, like SUnionStore.
+func (tx *Tx) SInterStore(dstBucket string, dstKey []byte, srcs ...SetKey) (int, error) {
+	return tx.sStore(dstBucket, dstKey, srcs, func(result, members map[string]struct{}, i int) {
+		if i == 0 {
+			for member := range members {
+				result[member] = struct{}{}
+			}
+			return
+		}
+		for member := range result {
+			if _, ok := members[member]; !ok {
+				delete(result, member)
+			}
+		}
+	})
+}
+
+// SDiffStore stores the members of the first set of srcs which are not in the successive sets into the
+// set stored in the bucket at given dstBucket and dstKey, like SUnionStore.
+func (tx *Tx) SDiffStore(dstBucket string, dstKey []byte, srcs ...SetKey) (int, error) {
+	return tx.sStore(dstBucket, dstKey, srcs, func(result, members map[string]struct{}, i int) {
+		if i == 0 {
+			for member := range members {
+				result[member] = struct{}{}
+			}
+			return
+		}
+		for member := range members {
+			delete(result, member)
+		}
+	})
+}
+
+// sStore computes the result of the sets srcs with op, called with the members of each set in order,
+// then writes to the destination the members to add and to remove to make it the result.
+func (tx *Tx) sStore(dstBucket string, dstKey []byte, srcs []SetKey, op func(result, members map[string]struct{}, i int)) (int, error) {
+	if err := tx.checkTxIsWritable(); err != nil {
+		return 0, err
+	}
+
+	members := func(bucket string, key []byte) map[string]struct{} {
+		if s, ok := tx.db.SetIdx[bucket]; ok {
+			return s.M[string(key)]
+		}
+		return nil
+	}
+
+	result := make(map[string]struct{})
+	for i, src := range srcs {
+		op(result, members(src.Bucket, src.Key), i)
+	}
+
+	var added, removed []string
+	old := members(dstBucket, dstKey)
+	for member := range old {
+		if _, ok := result[member]; !ok {
+			removed = append(removed, member)
+		}
+	}
+	for member := range result {
+		if _, ok := old[member]; !ok {
+			added = append(added, member)
+		}
+	}
+	sort.Strings(removed)
+	sort.Strings(added)
+
+	for _, member := range removed {
+		if err := tx.SRem(dstBucket, dstKey, []byte(member)); err != nil {
+			return 0, err
+		}
+	}
+	for _, member := range added {
+		if err := tx.SAdd(dstBucket, dstKey, []byte(member)); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(result), nil
+}
+
+// ErrBucketAndKey returns when bucket not found, it matches ErrBucketNotFound with errors.Is.
 func ErrBucketAndKey(bucket string, key []byte) error {
-	return errors.New("not found bucket:" + bucket + ",key:" + string(key))
+	return bucketNotFound(errors.New("not found bucket:" + bucket + ",key:" + string(key)))
 }
 
-// ErrNotFoundKeyInBucket returns when key not in the bucket.
+// ErrNotFoundKeyInBucket returns when key not in the bucket, it matches ErrKeyNotFound with errors.Is.
 func ErrNotFoundKeyInBucket(bucket string, key []byte) error {
-	return errors.New(string(key) + " is not in the" + bucket)
+	return keyNotFound(errors.New(string(key) + " is not in the " + bucket))
 }
@@ -15,8 +15,10 @@
 package nutsdb
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
+	"sort"
 	"testing"
 )
 
@@ -966,3 +968,137 @@ func TestTx_SAreMembers(t *testing.T) {
 	tx.Commit()
 	opSAreMembersForTest(bucket, key, t)
 }
+
+func TestTx_SScan(t *testing.T) {
+	InitForSet()
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	bucket := "bucket_for_sscan"
+	key := []byte("key1")
+	if err := db.Update(func(tx *Tx) error {
+		return tx.SAdd(bucket, key, []byte("d"), []byte("a"), []byte("c"), []byte("e"), []byte("b"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	scan := func(cursor string, count int) (members []string, next string) {
+		if err := db.View(func(tx *Tx) error {
+			items, n, err := tx.SScan(bucket, key, cursor, count)
+			for _, item := range items {
+				members = append(members, string(item))
+			}
+			next = n
+			return err
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	members, next := scan("", 2)
+	if len(members) != 2 || members[0] != "a" || members[1] != "b" || next == "" {
+		t.Errorf("err SScan, got %v %q", members, next)
+	}
+
+	// the members removed before the cursor do not shift the next page.
+	if err := db.Update(func(tx *Tx) error {
+		return tx.SRem(bucket, key, []byte("a"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	members, next = scan(next, 2)
+	if len(members) != 2 || members[0] != "c" || members[1] != "d" || next == "" {
+		t.Errorf("err SScan, got %v %q", members, next)
+	}
+
+	members, next = scan(next, 2)
+	if len(members) != 1 || members[0] != "e" || next != "" {
+		t.Errorf("err SScan, got %v %q", members, next)
+	}
+
+	if members, next = scan("", 0); len(members) != 4 || next != "" {
+		t.Errorf("err SScan without count, got %v %q", members, next)
+	}
+
+	if err := db.View(func(tx *Tx) error {
+		if _, _, err := tx.SScan(bucket, key, encodeKindCursor(listCursor, []byte("1")), 2); err != ErrInvalidCursor {
+			t.Errorf("err SScan, got %v want %v", err, ErrInvalidCursor)
+		}
+		if _, _, err := tx.SScan(bucket, []byte("key2"), "", 2); err == nil {
+			t.Error("err SScan of a missing set")
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTx_SStore(t *testing.T) {
+	InitForSet()
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Update(func(tx *Tx) error {
+		if err := tx.SAdd("bucket1", []byte("set1"), []byte("a"), []byte("b"), []byte("c")); err != nil {
+			return err
+		}
+		if err := tx.SAdd("bucket2", []byte("set2"), []byte("b"), []byte("c"), []byte("d")); err != nil {
+			return err
+		}
+		return tx.SAdd("bucket3", []byte("dst"), []byte("old"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	srcs := []SetKey{{"bucket1", []byte("set1")}, {"bucket2", []byte("set2")}}
+	tests := []struct {
+		name  string
+		store func(tx *Tx) (int, error)
+		want  string
+	}{
+		{"SUnionStore", func(tx *Tx) (int, error) { return tx.SUnionStore("bucket3", []byte("dst"), srcs...) }, "[a b c d]"},
+		{"SInterStore", func(tx *Tx) (int, error) { return tx.SInterStore("bucket3", []byte("dst"), srcs...) }, "[b c]"},
+		{"SDiffStore", func(tx *Tx) (int, error) { return tx.SDiffStore("bucket3", []byte("dst"), srcs...) }, "[a]"},
+		// the missing sets are empty.
+		{"SUnionStore", func(tx *Tx) (int, error) {
+			return tx.SUnionStore("bucket3", []byte("dst"), SetKey{"bucket1", []byte("set1")}, SetKey{"bucket_fake", []byte("set")})
+		}, "[a b c]"},
+		{"SInterStore", func(tx *Tx) (int, error) {
+			return tx.SInterStore("bucket3", []byte("dst"), SetKey{"bucket1", []byte("set1")}, SetKey{"bucket1", []byte("set_fake")})
+		}, "[]"},
+	}
+
+	for _, tt := range tests {
+		var n int
+		if err := db.Update(func(tx *Tx) error {
+			var err error
+			n, err = tt.store(tx)
+			return err
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := db.View(func(tx *Tx) error {
+			items, _ := tx.SMembers("bucket3", []byte("dst"))
+			var members []string
+			for _, item := range items {
+				members = append(members, string(item))
+			}
+			sort.Strings(members)
+			if got := fmt.Sprint(members); got != tt.want || n != len(members) {
+				t.Errorf("err %s, got %s %d want %s", tt.name, got, n, tt.want)
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
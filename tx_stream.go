@@ -0,0 +1,203 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SeparatorForStreamKey represents separator for the keys of the stream entries and offsets.
+const SeparatorForStreamKey = "|"
+
+// the tags after the separator of the keys of the stream entries, of the last ID and of the
+// offsets of the consumer groups.
+const (
+	streamEntryTag  = "x"
+	streamLastIDTag = "l"
+	streamGroupTag  = "g"
+)
+
+// StreamID represents the ID of a stream entry: the unix time in milliseconds it is added at and
+// a sequence number among the entries of the same millisecond. The IDs of a stream only increase.
+type StreamID struct {
+	Ms  uint64
+	Seq uint64
+}
+
+// String returns the ID formatted as ms-seq.
+func (id StreamID) String() string {
+	return fmt.Sprintf("%d-%d", id.Ms, id.Seq)
+}
+
+// Less returns if the ID is before o.
+func (id StreamID) Less(o StreamID) bool {
+	return id.Ms < o.Ms || id.Ms == o.Ms && id.Seq < o.Seq
+}
+
+func (id StreamID) bytes() []byte {
+	b := make([]byte, 16)
+	binary.BigEndian.PutUint64(b, id.Ms)
+	binary.BigEndian.PutUint64(b[8:], id.Seq)
+	return b
+}
+
+func decodeStreamID(b []byte) StreamID {
+	return StreamID{Ms: binary.BigEndian.Uint64(b), Seq: binary.BigEndian.Uint64(b[8:])}
+}
+
+// StreamEntry represents an entry of a stream.
+type StreamEntry struct {
+	ID    StreamID
+	Value []byte
+}
+
+// XAdd appends the value to the stream stored in the bucket at given bucket and key, and returns its ID.
+// The stream is stored as the keys of the B+ tree of the bucket, one key for each entry sorted by the ID,
+// under the key and the separator SeparatorForStreamKey.
+func (tx *Tx) XAdd(bucket string, key, value []byte) (StreamID, error) {
+	if err := tx.checkTxIsWritable(); err != nil {
+		return StreamID{}, err
+	}
+
+	lastIDKey := streamKey(key, streamLastIDTag, nil)
+	e, err := tx.current(bucket, lastIDKey)
+	if err != nil {
+		return StreamID{}, err
+	}
+
+	id := StreamID{Ms: uint64(time.Now().UnixNano() / int64(time.Millisecond))}
+	if e != nil && len(e.Value) == 16 {
+		if last := decodeStreamID(e.Value); !last.Less(id) {
+			id = StreamID{Ms: last.Ms, Seq: last.Seq + 1}
+		}
+	}
+
+	if err := tx.Put(bucket, streamKey(key, streamEntryTag, id.bytes()), value, Persistent); err != nil {
+		return StreamID{}, err
+	}
+
+	if err := tx.Put(bucket, lastIDKey, id.bytes(), Persistent); err != nil {
+		return StreamID{}, err
+	}
+
+	return id, nil
+}
+
+// XRange returns at most limitNum entries of the stream stored in the bucket at given bucket and key,
+// with the IDs from start to end, both included. All the entries are returned if limitNum is ScanNoLimit.
+func (tx *Tx) XRange(bucket string, key []byte, start, end StreamID, limitNum int) ([]*StreamEntry, error) {
+	es, err := tx.RangeScan(bucket, streamKey(key, streamEntryTag, start.bytes()), streamKey(key, streamEntryTag, end.bytes()))
+	if err != nil {
+		if errors.Is(err, ErrRangeScan) || errors.Is(err, ErrBucketNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if limitNum >= 0 && len(es) > limitNum {
+		es = es[:limitNum]
+	}
+
+	return streamEntries(key, es), nil
+}
+
+// XReadFrom returns at most count entries of the stream stored in the bucket at given bucket and key,
+// after the entry at given ID, or from the first entry if after is the zero ID.
+// All the entries are returned if count is ScanNoLimit.
+func (tx *Tx) XReadFrom(bucket string, key []byte, after StreamID, count int) ([]*StreamEntry, error) {
+	prefix := streamKey(key, streamEntryTag, nil)
+
+	es, _, err := tx.PrefixScanCursor(bucket, prefix, encodeCursor(streamKey(key, streamEntryTag, after.bytes())), count)
+	if err != nil {
+		if errors.Is(err, ErrPrefixScan) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return streamEntries(key, es), nil
+}
+
+// XReadGroup returns at most count entries of the stream stored in the bucket at given bucket and key,
+// after the offset of the consumer group. The offset is moved by XAck once the entries are processed.
+func (tx *Tx) XReadGroup(bucket string, key []byte, group string, count int) ([]*StreamEntry, error) {
+	offset, err := tx.XGroupOffset(bucket, key, group)
+	if err != nil {
+		return nil, err
+	}
+
+	return tx.XReadFrom(bucket, key, offset, count)
+}
+
+// XAck moves the offset of the consumer group of the stream stored in the bucket at given bucket and key
+// to the ID, so that XReadGroup returns the entries after it. The offset does not move back.
+func (tx *Tx) XAck(bucket string, key []byte, group string, id StreamID) error {
+	offset, err := tx.XGroupOffset(bucket, key, group)
+	if err != nil {
+		return err
+	}
+
+	if !offset.Less(id) {
+		return nil
+	}
+
+	return tx.Put(bucket, streamKey(key, streamGroupTag, []byte(group)), id.bytes(), Persistent)
+}
+
+// XGroupOffset returns the offset of the consumer group of the stream stored in the bucket at given
+// bucket and key, the zero ID if the group has acknowledged no entry.
+func (tx *Tx) XGroupOffset(bucket string, key []byte, group string) (StreamID, error) {
+	if err := tx.checkTxIsClosed(); err != nil {
+		return StreamID{}, err
+	}
+
+	e, err := tx.current(bucket, streamKey(key, streamGroupTag, []byte(group)))
+	if err != nil {
+		return StreamID{}, err
+	}
+
+	if e == nil || len(e.Value) != 16 {
+		return StreamID{}, nil
+	}
+
+	return decodeStreamID(e.Value), nil
+}
+
+// streamKey returns the key of the B+ tree of the stream at given key, tag and suffix.
+func streamKey(key []byte, tag string, suffix []byte) []byte {
+	k := make([]byte, 0, len(key)+len(SeparatorForStreamKey)+len(tag)+len(suffix))
+	k = append(k, key...)
+	k = append(k, SeparatorForStreamKey+tag...)
+
+	return append(k, suffix...)
+}
+
+// streamEntries returns the stream entries of the entries of the B+ tree of the stream at given key.
+func streamEntries(key []byte, es Entries) []*StreamEntry {
+	prefixLen := len(key) + len(SeparatorForStreamKey) + len(streamEntryTag)
+
+	entries := make([]*StreamEntry, 0, len(es))
+	for _, e := range es {
+		if len(e.Key) != prefixLen+16 {
+			continue
+		}
+		entries = append(entries, &StreamEntry{ID: decodeStreamID(e.Key[prefixLen:]), Value: e.Value})
+	}
+
+	return entries
+}
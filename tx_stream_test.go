@@ -0,0 +1,163 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"fmt"
+	"testing"
+)
+
+// streamValues returns the values of the stream entries.
+func streamValues(entries []*StreamEntry) string {
+	var values []string
+	for _, e := range entries {
+		values = append(values, string(e.Value))
+	}
+	return fmt.Sprintf("%v", values)
+}
+
+func TestTx_XAddAndXRange(t *testing.T) {
+	for _, mode := range []EntryIdxMode{HintKeyValAndRAMIdxMode, HintKeyAndRAMIdxMode, HintBPTSparseIdxMode} {
+		InitOpt("/tmp/nutsdbteststream", true)
+		opt.EntryIdxMode = mode
+		db, err = Open(opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var ids []StreamID
+		for i := 0; i < 3; i++ {
+			if err := db.Update(func(tx *Tx) error {
+				for j := 0; j < 2; j++ {
+					id, err := tx.XAdd("bucket", []byte("events"), []byte(fmt.Sprintf("event_%d", 2*i+j)))
+					if err != nil {
+						return err
+					}
+					ids = append(ids, id)
+				}
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for i := 1; i < len(ids); i++ {
+			if !ids[i-1].Less(ids[i]) {
+				t.Errorf("mode %d: err XAdd, got ID %v after %v", mode, ids[i], ids[i-1])
+			}
+		}
+
+		if err := db.View(func(tx *Tx) error {
+			entries, err := tx.XRange("bucket", []byte("events"), ids[1], ids[4], ScanNoLimit)
+			if err != nil {
+				return err
+			}
+			if got := streamValues(entries); got != "[event_1 event_2 event_3 event_4]" {
+				t.Errorf("mode %d: err XRange, got %s", mode, got)
+			}
+			if entries[0].ID != ids[1] {
+				t.Errorf("mode %d: err XRange, got ID %v want %v", mode, entries[0].ID, ids[1])
+			}
+
+			entries, err = tx.XRange("bucket", []byte("events"), StreamID{}, ids[5], 2)
+			if err != nil {
+				return err
+			}
+			if got := streamValues(entries); got != "[event_0 event_1]" {
+				t.Errorf("mode %d: err XRange with limit, got %s", mode, got)
+			}
+
+			entries, err = tx.XReadFrom("bucket", []byte("events"), ids[2], 2)
+			if err != nil {
+				return err
+			}
+			if got := streamValues(entries); got != "[event_3 event_4]" {
+				t.Errorf("mode %d: err XReadFrom, got %s", mode, got)
+			}
+
+			entries, err = tx.XReadFrom("bucket", []byte("events_fake"), StreamID{}, ScanNoLimit)
+			if err != nil || len(entries) != 0 {
+				t.Errorf("mode %d: err XReadFrom, got %v, %v want no entries", mode, entries, err)
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		db.Close()
+	}
+}
+
+func TestTx_XReadGroup(t *testing.T) {
+	InitOpt("/tmp/nutsdbteststream", true)
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Update(func(tx *Tx) error {
+		for i := 0; i < 5; i++ {
+			if _, err := tx.XAdd("bucket", []byte("events"), []byte(fmt.Sprintf("event_%d", i))); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// each group consumes the stream from its own offset.
+	consume := func(group string, count int, want string) {
+		t.Helper()
+
+		if err := db.Update(func(tx *Tx) error {
+			entries, err := tx.XReadGroup("bucket", []byte("events"), group, count)
+			if err != nil {
+				return err
+			}
+			if got := streamValues(entries); got != want {
+				t.Errorf("err XReadGroup %s, got %s want %s", group, got, want)
+			}
+			if len(entries) == 0 {
+				return nil
+			}
+			return tx.XAck("bucket", []byte("events"), group, entries[len(entries)-1].ID)
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	consume("g1", 2, "[event_0 event_1]")
+	consume("g1", 2, "[event_2 event_3]")
+	consume("g2", 3, "[event_0 event_1 event_2]")
+
+	// the offsets are durable and do not move back.
+	db.Close()
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Update(func(tx *Tx) error {
+		return tx.XAck("bucket", []byte("events"), "g1", StreamID{})
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	consume("g1", ScanNoLimit, "[event_4]")
+	consume("g1", ScanNoLimit, "[]")
+	consume("g2", ScanNoLimit, "[event_3 event_4]")
+}
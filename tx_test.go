@@ -18,7 +18,9 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestTx_Rollback(t *testing.T) {
@@ -81,10 +83,8 @@ func TestTx_Begin(t *testing.T) {
 	opt.SegmentSize = 8 * 1024
 	opt.NodeNum = -1
 
-	db, err = Open(opt)
-	tx, err = db.Begin(false)
-	if err == nil {
-		t.Error("err when tx begin")
+	if _, err = Open(opt); err == nil {
+		t.Error("err when open with an invalid node number")
 	}
 
 	opt.NodeNum = 1
@@ -114,13 +114,8 @@ func TestTx_Begin(t *testing.T) {
 	//error
 	Init()
 	opt.NodeNum = -1
-	db, err = Open(opt)
-	if err != nil {
-		fmt.Println("err", err)
-	}
-	tx, err = db.Begin(false)
-	if err == nil {
-		t.Error("err when tx begin")
+	if _, err = Open(opt); err == nil {
+		t.Error("err when open with an invalid node number")
 	}
 }
 
@@ -156,3 +151,357 @@ func TestTx_Close(t *testing.T) {
 	}
 
 }
+
+func TestTx_ConcurrentReadOnly(t *testing.T) {
+	Init()
+	opt.EntryIdxMode = HintKeyAndRAMIdxMode
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	bucket := "bucket_concurrent_read_test"
+	if err := db.Update(func(tx *Tx) error {
+		for i := 0; i < 10; i++ {
+			key := []byte("key_" + fmt.Sprintf("%03d", i))
+			if err := tx.Put(bucket, key, key, Persistent); err != nil {
+				return err
+			}
+		}
+		if err := tx.SAdd(bucket, []byte("set"), []byte("a"), []byte("b")); err != nil {
+			return err
+		}
+		if err := tx.ZAdd(bucket, []byte("zset"), 1, []byte("a")); err != nil {
+			return err
+		}
+		return tx.RPush(bucket, []byte("list"), []byte("a"), []byte("b"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a read-only tx does not block other read-only txs.
+	tx1, err := db.Begin(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() {
+		done <- db.View(func(tx *Tx) error {
+			_, err := tx.Get(bucket, []byte("key_001"))
+			return err
+		})
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("err TestTx_ConcurrentReadOnly: read-only tx blocked")
+	}
+	if err := tx1.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 9)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if err := db.View(func(tx *Tx) error {
+					if _, err := tx.Get(bucket, []byte("key_001")); err != nil {
+						return err
+					}
+					if _, err := tx.RangeScan(bucket, []byte("key_000"), []byte("key_009")); err != nil {
+						return err
+					}
+					if _, err := tx.SMembers(bucket, []byte("set")); err != nil {
+						return err
+					}
+					if _, err := tx.ZMembers(bucket); err != nil {
+						return err
+					}
+					_, err := tx.LRange(bucket, []byte("list"), 0, -1)
+					return err
+				}); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for j := 0; j < 50; j++ {
+			if err := db.Update(func(tx *Tx) error {
+				return tx.Put(bucket, []byte("key_100"), []byte(fmt.Sprintf("%03d", j)), Persistent)
+			}); err != nil {
+				errs <- err
+				return
+			}
+		}
+	}()
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+}
+
+// syncCountingRWManager counts the writes and syncs of the wrapped RWManager.
+type syncCountingRWManager struct {
+	RWManager
+	writes int
+	syncs  int
+}
+
+func (m *syncCountingRWManager) WriteAt(b []byte, off int64) (n int, err error) {
+	m.writes++
+	return m.RWManager.WriteAt(b, off)
+}
+
+func (m *syncCountingRWManager) Sync() (err error) {
+	m.syncs++
+	return m.RWManager.Sync()
+}
+
+func TestTx_PutBatch(t *testing.T) {
+	Init()
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bucket := "bucket_put_batch_test"
+	entries := make([]BatchEntry, 150)
+	for i := range entries {
+		entries[i] = BatchEntry{
+			Bucket: bucket,
+			Key:    []byte(fmt.Sprintf("key_%03d", i)),
+			Value:  []byte(fmt.Sprintf("val_%03d", i)),
+			TTL:    Persistent,
+		}
+	}
+
+	m := &syncCountingRWManager{RWManager: db.ActiveFile.rwManager}
+	db.ActiveFile.rwManager = m
+
+	if err := db.Batch(entries[:10]); err != nil {
+		t.Fatal(err)
+	}
+	if m.writes != 1 || m.syncs != 1 {
+		t.Errorf("err PutBatch, got %d writes and %d syncs, want 1 and 1", m.writes, m.syncs)
+	}
+
+	// the batch is larger than a data file.
+	if err := db.Batch(entries); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Update(func(tx *Tx) error {
+		return tx.PutBatch([]BatchEntry{{Bucket: bucket, Key: []byte("key_new")}, {Bucket: bucket}})
+	}); err != ErrKeyEmpty {
+		t.Errorf("err PutBatch, got %v want %v", err, ErrKeyEmpty)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.View(func(tx *Tx) error {
+		for _, e := range entries {
+			item, err := tx.Get(bucket, e.Key)
+			if err != nil {
+				return err
+			}
+			if string(item.Value) != string(e.Value) {
+				t.Errorf("err PutBatch, got %s want %s", item.Value, e.Value)
+			}
+		}
+		if _, err := tx.Get(bucket, []byte("key_new")); err == nil {
+			t.Error("err PutBatch, put an entry of the invalid batch")
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTx_MaxTxSize(t *testing.T) {
+	bucket := "bucket_max_tx_size_test"
+
+	// the size of the entries of bucket with a 6-byte key and a 6-byte value.
+	size := int64(DataEntryHeaderSize + len(bucket) + 6 + 6)
+
+	InitOpt("/tmp/nutsdbtestmaxtxsize", true)
+	opt.MaxTxEntries = 3
+	opt.MaxTxBytes = 5 * size
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	tx, err := db.Begin(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := tx.Put(bucket, []byte(fmt.Sprintf("key_%02d", i)), []byte(fmt.Sprintf("val_%02d", i)), Persistent); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if entries, bytes := tx.Size(); entries != 3 || bytes != 3*size {
+		t.Errorf("err Size, got %d %d want %d %d", entries, bytes, 3, 3*size)
+	}
+
+	if err := tx.Put(bucket, []byte("key_03"), []byte("val_03"), Persistent); err != ErrTxTooBig {
+		t.Errorf("err MaxTxEntries, got %v want %v", err, ErrTxTooBig)
+	}
+
+	// the tx is still usable within the limits.
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	opt.MaxTxEntries = 0
+	db.opt.MaxTxEntries = 0
+
+	if err := db.Update(func(tx *Tx) error {
+		return tx.Put(bucket, []byte("key_big"), make([]byte, 5*size), Persistent)
+	}); err != ErrTxTooBig {
+		t.Errorf("err MaxTxBytes, got %v want %v", err, ErrTxTooBig)
+	}
+
+	if err := db.View(func(tx *Tx) error {
+		entries, err := tx.GetAll(bucket)
+		if err != nil {
+			return err
+		}
+		if len(entries) != 3 {
+			t.Errorf("err MaxTxSize, got %d entries want %d", len(entries), 3)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTx_Savepoint(t *testing.T) {
+	bucket := "bucket_savepoint_test"
+
+	Init()
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Update(func(tx *Tx) error {
+		if err := tx.Put(bucket, []byte("key_1"), []byte("val_1"), Persistent); err != nil {
+			return err
+		}
+
+		sp, err := tx.Savepoint()
+		if err != nil {
+			return err
+		}
+
+		for _, key := range []string{"key_2", "key_3"} {
+			if err := tx.Put(bucket, []byte(key), []byte("val"), Persistent); err != nil {
+				return err
+			}
+		}
+
+		sp2, err := tx.Savepoint()
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Delete(bucket, []byte("key_1")); err != nil {
+			return err
+		}
+
+		if err := tx.RollbackTo(sp); err != nil {
+			return err
+		}
+
+		if entries, _ := tx.Size(); entries != 1 {
+			t.Errorf("err RollbackTo, got %d entries want %d", entries, 1)
+		}
+
+		// the later savepoints are released, the savepoint can be used again.
+		if err := tx.RollbackTo(sp2); err != ErrInvalidSavepoint {
+			t.Errorf("err RollbackTo, got %v want %v", err, ErrInvalidSavepoint)
+		}
+
+		if err := tx.Put(bucket, []byte("key_4"), []byte("val_4"), Persistent); err != nil {
+			return err
+		}
+
+		return tx.RollbackTo(sp)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Update(func(tx *Tx) error {
+		if err := tx.Put(bucket, []byte("key_5"), []byte("val_5"), Persistent); err != nil {
+			return err
+		}
+
+		// a savepoint of another tx is rejected.
+		other := &Tx{db: db, writable: true}
+		sp, err := other.Savepoint()
+		if err != nil {
+			return err
+		}
+		if err := tx.RollbackTo(sp); err != ErrInvalidSavepoint {
+			t.Errorf("err RollbackTo, got %v want %v", err, ErrInvalidSavepoint)
+		}
+
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.View(func(tx *Tx) error {
+		entries, err := tx.GetAll(bucket)
+		if err != nil {
+			return err
+		}
+
+		var keys []string
+		for _, e := range entries {
+			keys = append(keys, string(e.Key))
+		}
+		if fmt.Sprint(keys) != "[key_1 key_5]" {
+			t.Errorf("err Savepoint, got %v want %v", keys, "[key_1 key_5]")
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := db.Begin(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Savepoint(); err != ErrTxNotWritable {
+		t.Errorf("err Savepoint, got %v want %v", err, ErrTxNotWritable)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+}
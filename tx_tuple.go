@@ -0,0 +1,65 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import "github.com/xujiajun/nutsdb/tuple"
+
+// RangeScanTuple returns the entries of the keys packed from the tuples from start to end at given bucket,
+// the tuples starting with the elements of end included, in ascending order. The keys of the bucket are
+// compared bytewise, so the bucket should not have a comparator.
+func (tx *Tx) RangeScanTuple(bucket string, start, end tuple.Tuple) (Entries, error) {
+	startKey, endKey, err := tupleRange(start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	return tx.RangeScan(bucket, startKey, endKey)
+}
+
+// RangeScanTupleReverse is RangeScanTuple in descending order.
+func (tx *Tx) RangeScanTupleReverse(bucket string, start, end tuple.Tuple) (Entries, error) {
+	startKey, endKey, err := tupleRange(start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	return tx.RangeScanReverse(bucket, startKey, endKey)
+}
+
+// PrefixScanTuple returns the entries of the keys packed from the tuples starting with the elements of
+// prefix at given bucket, after the first offsetNum entries and at most limitNum of them, as PrefixScan.
+func (tx *Tx) PrefixScanTuple(bucket string, prefix tuple.Tuple, offsetNum int, limitNum int) (es Entries, off int, err error) {
+	key, err := prefix.Pack()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return tx.PrefixScan(bucket, key, offsetNum, limitNum)
+}
+
+// tupleRange returns the keys of the range of the tuples from start to the tuples starting with end.
+func tupleRange(start, end tuple.Tuple) ([]byte, []byte, error) {
+	startKey, err := start.Pack()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, endKey, err := end.Range()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return startKey, endKey, nil
+}
@@ -0,0 +1,97 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/xujiajun/nutsdb/tuple"
+)
+
+func tupleKeys(t *testing.T, es Entries) string {
+	t.Helper()
+
+	var ts []tuple.Tuple
+	for _, e := range es {
+		tu, err := tuple.Unpack(e.Key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ts = append(ts, tu)
+	}
+	return fmt.Sprint(ts)
+}
+
+func TestTx_RangeScanTuple(t *testing.T) {
+	InitOpt("/tmp/nutsdbtesttuple", true)
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	bucket := "orders"
+	if err := db.Update(func(tx *Tx) error {
+		for _, user := range []string{"alice", "bob"} {
+			for _, id := range []int{-5, 2, 10, 300} {
+				key, err := tuple.Tuple{user, id}.Pack()
+				if err != nil {
+					return err
+				}
+				if err := tx.Put(bucket, key, []byte("val"), Persistent); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.View(func(tx *Tx) error {
+		es, err := tx.RangeScanTuple(bucket, tuple.Tuple{"alice", 2}, tuple.Tuple{"alice", 300})
+		if err != nil {
+			return err
+		}
+		if got, want := tupleKeys(t, es), "[[alice 2] [alice 10] [alice 300]]"; got != want {
+			t.Errorf("err RangeScanTuple, got %s want %s", got, want)
+		}
+
+		// the tuples starting with end are included.
+		es, err = tx.RangeScanTupleReverse(bucket, tuple.Tuple{"alice", 300}, tuple.Tuple{"bob"})
+		if err != nil {
+			return err
+		}
+		if got, want := tupleKeys(t, es), "[[bob 300] [bob 10] [bob 2] [bob -5] [alice 300]]"; got != want {
+			t.Errorf("err RangeScanTupleReverse, got %s want %s", got, want)
+		}
+
+		es, _, err = tx.PrefixScanTuple(bucket, tuple.Tuple{"bob"}, 1, 2)
+		if err != nil {
+			return err
+		}
+		if got, want := tupleKeys(t, es), "[[bob 2] [bob 10]]"; got != want {
+			t.Errorf("err PrefixScanTuple, got %s want %s", got, want)
+		}
+
+		if _, err := tx.RangeScanTuple(bucket, tuple.Tuple{struct{}{}}, nil); err == nil {
+			t.Error("err RangeScanTuple, got nil want an error")
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
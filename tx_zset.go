@@ -15,10 +15,9 @@
 package nutsdb
 
 import (
-	"bytes"
+	"encoding/binary"
 	"errors"
-	"strconv"
-	"strings"
+	"math"
 	"time"
 
 	"github.com/xujiajun/nutsdb/ds/zset"
@@ -30,19 +29,7 @@ const SeparatorForZSetKey = "|"
 
 // ZAdd adds the specified member key with the specified score and specified val to the sorted set stored at bucket.
 func (tx *Tx) ZAdd(bucket string, key []byte, score float64, val []byte) error {
-	var buffer bytes.Buffer
-
-	if strings.Contains(string(key), SeparatorForZSetKey) {
-		return ErrSeparatorForZSetKey()
-	}
-
-	buffer.Write(key)
-	buffer.Write([]byte(SeparatorForZSetKey))
-	scoreBytes := []byte(strconv.FormatFloat(score, 'f', -1, 64))
-	buffer.Write(scoreBytes)
-	newKey := buffer.Bytes()
-
-	return tx.put(bucket, newKey, val, Persistent, DataZAddFlag, uint64(time.Now().Unix()), DataStructureSortedSet)
+	return tx.zadd(bucket, key, score, val, Persistent, uint64(time.Now().Unix()))
 }
 
 // ZMembers returns all the members of the set value stored at bucket.
@@ -51,11 +38,12 @@ func (tx *Tx) ZMembers(bucket string) (map[string]*zset.SortedSetNode, error) {
 		return nil, err
 	}
 
-	if _, ok := tx.db.SortedSetIdx[bucket]; !ok {
+	ss, ok := tx.sortedSet(bucket)
+	if !ok {
 		return nil, ErrBucket
 	}
 
-	return tx.db.SortedSetIdx[bucket].Dict, nil
+	return ss.Dict, nil
 }
 
 // ZCard returns the sorted set cardinality (number of elements) of the sorted set stored at bucket.
@@ -89,6 +77,11 @@ func (tx *Tx) ZPopMax(bucket string) (*zset.SortedSetNode, error) {
 		return nil, err
 	}
 
+	// the max of the index is expired, the member is removed by its key.
+	if item != nil && tx.db.SortedSetIdx[bucket].PeekMax().Key() != item.Key() {
+		return item, tx.ZRem(bucket, item.Key())
+	}
+
 	return item, tx.put(bucket, []byte(" "), []byte(""), Persistent, DataZPopMaxFlag, uint64(time.Now().Unix()), DataStructureSortedSet)
 }
 
@@ -99,6 +92,11 @@ func (tx *Tx) ZPopMin(bucket string) (*zset.SortedSetNode, error) {
 		return nil, err
 	}
 
+	// the min of the index is expired, the member is removed by its key.
+	if item != nil && tx.db.SortedSetIdx[bucket].PeekMin().Key() != item.Key() {
+		return item, tx.ZRem(bucket, item.Key())
+	}
+
 	return item, tx.put(bucket, []byte(" "), []byte(""), Persistent, DataZPopMinFlag, uint64(time.Now().Unix()), DataStructureSortedSet)
 }
 
@@ -108,11 +106,12 @@ func (tx *Tx) ZPeekMax(bucket string) (*zset.SortedSetNode, error) {
 		return nil, err
 	}
 
-	if _, ok := tx.db.SortedSetIdx[bucket]; !ok {
+	ss, ok := tx.sortedSet(bucket)
+	if !ok {
 		return nil, ErrBucket
 	}
 
-	return tx.db.SortedSetIdx[bucket].PeekMax(), nil
+	return ss.PeekMax(), nil
 }
 
 // ZPeekMin returns the member with the lowest score in the sorted set stored at bucket.
@@ -121,24 +120,27 @@ func (tx *Tx) ZPeekMin(bucket string) (*zset.SortedSetNode, error) {
 		return nil, err
 	}
 
-	if _, ok := tx.db.SortedSetIdx[bucket]; !ok {
+	ss, ok := tx.sortedSet(bucket)
+	if !ok {
 		return nil, ErrBucket
 	}
 
-	return tx.db.SortedSetIdx[bucket].PeekMin(), nil
+	return ss.PeekMin(), nil
 }
 
 // ZRangeByScore returns all the elements in the sorted set at bucket with a score between min and max.
+// The options page the elements with Offset and Limit, and return them from the highest score with Reverse.
 func (tx *Tx) ZRangeByScore(bucket string, start, end float64, opts *zset.GetByScoreRangeOptions) ([]*zset.SortedSetNode, error) {
 	if err := tx.checkTxIsClosed(); err != nil {
 		return nil, err
 	}
 
-	if _, ok := tx.db.SortedSetIdx[bucket]; !ok {
+	ss, ok := tx.sortedSet(bucket)
+	if !ok {
 		return nil, ErrBucket
 	}
 
-	return tx.db.SortedSetIdx[bucket].GetByScoreRange(zset.SCORE(start), zset.SCORE(end), opts), nil
+	return ss.GetByScoreRange(zset.SCORE(start), zset.SCORE(end), opts), nil
 }
 
 // ZRangeByRank returns all the elements in the sorted set in one bucket and key
@@ -148,11 +150,74 @@ func (tx *Tx) ZRangeByRank(bucket string, start, end int) ([]*zset.SortedSetNode
 		return nil, err
 	}
 
-	if _, ok := tx.db.SortedSetIdx[bucket]; !ok {
+	ss, ok := tx.sortedSet(bucket)
+	if !ok {
+		return nil, ErrBucket
+	}
+
+	return ss.GetByRankRange(start, end, false), nil
+}
+
+// ZRevRangeByRank returns all the elements in the sorted set in one bucket and key
+// with a reverse rank between start and end, the rank 1 being the element with the highest score,
+// in descending order of the scores.
+func (tx *Tx) ZRevRangeByRank(bucket string, start, end int) ([]*zset.SortedSetNode, error) {
+	if err := tx.checkTxIsClosed(); err != nil {
+		return nil, err
+	}
+
+	ss, ok := tx.sortedSet(bucket)
+	if !ok {
 		return nil, ErrBucket
 	}
 
-	return tx.db.SortedSetIdx[bucket].GetByRankRange(start, end, false), nil
+	return ss.GetByRankRange(-start, -end, false), nil
+}
+
+// ZScan iterates over the members of the sorted set stored at bucket, in ascending order of the scores
+// then of the keys, starting after the cursor returned by the previous page, or from the first member
+// if cursor is empty. It returns at most count members, all of them if count is not positive, and
+// the next cursor, which is empty on the last page. The members added or removed before the position
+// do not shift the next pages.
+func (tx *Tx) ZScan(bucket string, cursor string, count int) (nodes []*zset.SortedSetNode, next string, err error) {
+	if err := tx.checkTxIsClosed(); err != nil {
+		return nil, "", err
+	}
+
+	pos, err := decodeKindCursor(zSetCursor, cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	if pos != nil && len(pos) < 8 {
+		return nil, "", ErrInvalidCursor
+	}
+
+	ss, ok := tx.sortedSet(bucket)
+	if !ok {
+		return nil, "", ErrBucket
+	}
+
+	if count <= 0 {
+		count = ss.Size()
+	}
+
+	if pos != nil {
+		score := zset.SCORE(math.Float64frombits(binary.BigEndian.Uint64(pos[:8])))
+		nodes = ss.GetAfter(score, string(pos[8:]), count+1)
+	} else if min := ss.PeekMin(); min != nil {
+		nodes = append([]*zset.SortedSetNode{min}, ss.GetAfter(min.Score(), min.Key(), count)...)
+	}
+
+	if len(nodes) > count {
+		nodes = nodes[:count]
+
+		last := nodes[count-1]
+		pos = make([]byte, 8, 8+len(last.Key()))
+		binary.BigEndian.PutUint64(pos, math.Float64bits(float64(last.Score())))
+		next = encodeKindCursor(zSetCursor, append(pos, last.Key()...))
+	}
+
+	return nodes, next, nil
 }
 
 // ZRem removes the specified members from the sorted set stored in one bucket at given bucket and key.
@@ -191,11 +256,12 @@ func (tx *Tx) ZRank(bucket string, key []byte) (int, error) {
 		return 0, err
 	}
 
-	if _, ok := tx.db.SortedSetIdx[bucket]; !ok {
+	ss, ok := tx.sortedSet(bucket)
+	if !ok {
 		return 0, ErrBucket
 	}
 
-	return tx.db.SortedSetIdx[bucket].FindRank(string(key)), nil
+	return ss.FindRank(string(key)), nil
 }
 
 // ZRevRank returns the rank of member in the sorted set stored in the bucket at given bucket and key,
@@ -205,11 +271,12 @@ func (tx *Tx) ZRevRank(bucket string, key []byte) (int, error) {
 		return 0, err
 	}
 
-	if _, ok := tx.db.SortedSetIdx[bucket]; !ok {
+	ss, ok := tx.sortedSet(bucket)
+	if !ok {
 		return 0, ErrBucket
 	}
 
-	return tx.db.SortedSetIdx[bucket].FindRevRank(string(key)), nil
+	return ss.FindRevRank(string(key)), nil
 }
 
 // ZScore returns the score of member in the sorted set in the bucket at given bucket and key.
@@ -222,7 +289,7 @@ func (tx *Tx) ZScore(bucket string, key []byte) (float64, error) {
 		return 0, ErrBucket
 	}
 
-	if node := tx.db.SortedSetIdx[bucket].GetByKey(string(key)); node != nil {
+	if node := tx.db.SortedSetIdx[bucket].GetByKey(string(key)); node != nil && tx.isZMemberLive(bucket, string(key)) {
 		return float64(node.Score()), nil
 	}
 
@@ -239,7 +306,7 @@ func (tx *Tx) ZGetByKey(bucket string, key []byte) (*zset.SortedSetNode, error)
 		return nil, ErrBucket
 	}
 
-	if node := tx.db.SortedSetIdx[bucket].GetByKey(string(key)); node != nil {
+	if node := tx.db.SortedSetIdx[bucket].GetByKey(string(key)); node != nil && tx.isZMemberLive(bucket, string(key)) {
 		return node, nil
 	}
 
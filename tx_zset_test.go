@@ -19,6 +19,8 @@ import (
 	"io/ioutil"
 	"os"
 	"testing"
+
+	"github.com/xujiajun/nutsdb/ds/zset"
 )
 
 var tx *Tx
@@ -360,6 +362,70 @@ func TestTx_ZRangByRank(t *testing.T) {
 	}
 }
 
+func TestTx_ZRevRangeByRank(t *testing.T) {
+	bucket, key1, key2, key3 := InitDataForZSet(t)
+	defer db.Close()
+
+	if err := db.View(func(tx *Tx) error {
+		if _, err := tx.ZRevRangeByRank("bucket_fake", 1, 2); err != ErrBucket {
+			t.Errorf("err ZRevRangeByRank, got %v want %v", err, ErrBucket)
+		}
+
+		nodes, err := tx.ZRevRangeByRank(bucket, 1, 2)
+		if err != nil {
+			return err
+		}
+		if len(nodes) != 2 || nodes[0].Key() != key3 || nodes[1].Key() != key2 {
+			t.Errorf("err ZRevRangeByRank, got %v", nodes)
+		}
+
+		nodes, err = tx.ZRevRangeByRank(bucket, -1, -1)
+		if err != nil {
+			return err
+		}
+		if len(nodes) != 1 || nodes[0].Key() != key1 {
+			t.Errorf("err ZRevRangeByRank, got %v", nodes)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTx_ZRangeByScoreWithOffset(t *testing.T) {
+	bucket, key1, key2, key3 := InitDataForZSet(t)
+	defer db.Close()
+
+	if err := db.View(func(tx *Tx) error {
+		nodes, err := tx.ZRangeByScore(bucket, 0, 100, &zset.GetByScoreRangeOptions{Offset: 1, Limit: 1})
+		if err != nil {
+			return err
+		}
+		if len(nodes) != 1 || nodes[0].Key() != key2 {
+			t.Errorf("err ZRangeByScore, got %v", nodes)
+		}
+
+		nodes, err = tx.ZRangeByScore(bucket, 0, 100, &zset.GetByScoreRangeOptions{Offset: 1, Reverse: true})
+		if err != nil {
+			return err
+		}
+		if len(nodes) != 2 || nodes[0].Key() != key2 || nodes[1].Key() != key1 {
+			t.Errorf("err ZRangeByScore, got %v", nodes)
+		}
+
+		nodes, err = tx.ZRangeByScore(bucket, 0, 100, &zset.GetByScoreRangeOptions{Reverse: true, Limit: 1})
+		if err != nil {
+			return err
+		}
+		if len(nodes) != 1 || nodes[0].Key() != key3 {
+			t.Errorf("err ZRangeByScore, got %v", nodes)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestTx_ZRem(t *testing.T) {
 	bucket, key1, key2, _ := InitDataForZSet(t)
 	tx, err = db.Begin(true)
@@ -600,3 +666,73 @@ func TestTx_ZGetByKey(t *testing.T) {
 		t.Error("TestTx_ZGetByKey err")
 	}
 }
+
+func TestTx_ZScan(t *testing.T) {
+	InitForZSet()
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	bucket := "bucket_for_zscan"
+	if err := db.Update(func(tx *Tx) error {
+		for i, score := range []float64{3, 1, 2, 2, 5} {
+			if err := tx.ZAdd(bucket, []byte(fmt.Sprintf("key%d", i)), score, []byte("val")); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	scan := func(cursor string, count int) (keys []string, next string) {
+		if err := db.View(func(tx *Tx) error {
+			nodes, n, err := tx.ZScan(bucket, cursor, count)
+			for _, node := range nodes {
+				keys = append(keys, node.Key())
+			}
+			next = n
+			return err
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	keys, next := scan("", 2)
+	if len(keys) != 2 || keys[0] != "key1" || keys[1] != "key2" || next == "" {
+		t.Errorf("err ZScan, got %v %q", keys, next)
+	}
+
+	// the members removed at the cursor do not shift the next page.
+	if err := db.Update(func(tx *Tx) error {
+		return tx.ZRem(bucket, "key2")
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, next = scan(next, 2)
+	if len(keys) != 2 || keys[0] != "key3" || keys[1] != "key0" || next == "" {
+		t.Errorf("err ZScan, got %v %q", keys, next)
+	}
+
+	keys, next = scan(next, 2)
+	if len(keys) != 1 || keys[0] != "key4" || next != "" {
+		t.Errorf("err ZScan, got %v %q", keys, next)
+	}
+
+	if keys, next = scan("", 0); len(keys) != 4 || next != "" {
+		t.Errorf("err ZScan without count, got %v %q", keys, next)
+	}
+
+	if err := db.View(func(tx *Tx) error {
+		if _, _, err := tx.ZScan(bucket, encodeKindCursor(zSetCursor, []byte("x")), 2); err != ErrInvalidCursor {
+			t.Errorf("err ZScan, got %v want %v", err, ErrInvalidCursor)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,213 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xujiajun/nutsdb/ds/zset"
+	"github.com/xujiajun/utils/strconv2"
+)
+
+// ZAddWithTTL adds the specified member key with the specified score and val to the sorted set stored
+// at bucket, like ZAdd, and makes it expire after ttl seconds, Persistent makes it never expire.
+// The expired members are not read, and are removed by the expiration worker every ExpireInterval.
+// ZAdd and ZAddWithTTL of a member again replace its TTL.
+func (tx *Tx) ZAddWithTTL(bucket string, key []byte, score float64, val []byte, ttl uint32) error {
+	return tx.zadd(bucket, key, score, val, ttl, uint64(time.Now().Unix()))
+}
+
+// ZIncrBy increments by delta the score of the member key of the sorted set stored at bucket,
+// and returns its new score. A missing member is added with the score delta and an empty val,
+// a member keeps its val and its TTL.
+func (tx *Tx) ZIncrBy(bucket string, key []byte, delta float64) (float64, error) {
+	if err := tx.checkTxIsWritable(); err != nil {
+		return 0, err
+	}
+
+	score, val, ttl, timestamp, ok := tx.zmember(bucket, key)
+	if !ok {
+		score, val, ttl, timestamp = 0, nil, Persistent, uint64(time.Now().Unix())
+	}
+	score += delta
+
+	if err := tx.zadd(bucket, key, score, val, ttl, timestamp); err != nil {
+		return 0, err
+	}
+
+	return score, nil
+}
+
+// zadd writes the ZAdd entry of the member key of the sorted set stored at bucket.
+func (tx *Tx) zadd(bucket string, key []byte, score float64, val []byte, ttl uint32, timestamp uint64) error {
+	if strings.Contains(string(key), SeparatorForZSetKey) {
+		return ErrSeparatorForZSetKey()
+	}
+
+	var buffer bytes.Buffer
+	buffer.Write(key)
+	buffer.Write([]byte(SeparatorForZSetKey))
+	buffer.Write([]byte(strconv.FormatFloat(score, 'f', -1, 64)))
+
+	return tx.put(bucket, buffer.Bytes(), val, ttl, DataZAddFlag, timestamp, DataStructureSortedSet)
+}
+
+// zmember returns the score, the val, the TTL and the timestamp of the TTL of the member key of the
+// sorted set stored at bucket, with the pending ZAdd and ZRem of the tx applied, and whether the
+// member exists and is not expired.
+func (tx *Tx) zmember(bucket string, key []byte) (score float64, val []byte, ttl uint32, timestamp uint64, ok bool) {
+	now := uint64(time.Now().Unix())
+
+	for i := len(tx.pendingWrites) - 1; i >= 0; i-- {
+		e := tx.pendingWrites[i]
+		if e.Meta.ds != DataStructureSortedSet || string(e.Meta.bucket) != bucket {
+			continue
+		}
+
+		switch e.Meta.Flag {
+		case DataZAddFlag:
+			keyAndScore := strings.Split(string(e.Key), SeparatorForZSetKey)
+			if len(keyAndScore) != 2 || keyAndScore[0] != string(key) {
+				continue
+			}
+			score, _ = strconv2.StrToFloat64(keyAndScore[1])
+			if isZMemberExpired(e.Meta.TTL, e.Meta.timestamp, now) {
+				return 0, nil, Persistent, 0, false
+			}
+			return score, e.Value, e.Meta.TTL, e.Meta.timestamp, true
+		case DataZRemFlag:
+			if string(e.Key) == string(key) {
+				return 0, nil, Persistent, 0, false
+			}
+		}
+	}
+
+	ss, found := tx.db.SortedSetIdx[bucket]
+	if !found {
+		return 0, nil, Persistent, 0, false
+	}
+
+	node := ss.GetByKey(string(key))
+	if node == nil {
+		return 0, nil, Persistent, 0, false
+	}
+
+	ttl, timestamp = Persistent, now
+	if deadline, found := tx.db.zsetDeadlines[bucket][string(key)]; found {
+		if deadline <= now {
+			return 0, nil, Persistent, 0, false
+		}
+		ttl = uint32(deadline - now)
+	}
+
+	return float64(node.Score()), node.Value, ttl, timestamp, true
+}
+
+// sortedSet returns the index of the sorted set stored at bucket without its expired members, which
+// stay in the index until the expiration worker removes them, and whether the sorted set exists.
+// The index is copied without them only if it has expired members.
+func (tx *Tx) sortedSet(bucket string) (*zset.SortedSet, bool) {
+	ss, ok := tx.db.SortedSetIdx[bucket]
+	if !ok {
+		return nil, false
+	}
+
+	now := uint64(time.Now().Unix())
+
+	var expired map[string]struct{}
+	for key, deadline := range tx.db.zsetDeadlines[bucket] {
+		if deadline <= now && ss.GetByKey(key) != nil {
+			if expired == nil {
+				expired = make(map[string]struct{})
+			}
+			expired[key] = struct{}{}
+		}
+	}
+
+	if expired == nil {
+		return ss, true
+	}
+
+	live := zset.New()
+	for key, node := range ss.Dict {
+		if _, ok := expired[key]; !ok {
+			_ = live.Put(key, node.Score(), node.Value)
+		}
+	}
+
+	return live, true
+}
+
+// isZMemberLive reports whether the member key of the sorted set stored at bucket is not expired.
+func (tx *Tx) isZMemberLive(bucket, key string) bool {
+	deadline, found := tx.db.zsetDeadlines[bucket][key]
+
+	return !found || deadline > uint64(time.Now().Unix())
+}
+
+func isZMemberExpired(ttl uint32, timestamp, now uint64) bool {
+	return ttl != Persistent && timestamp+uint64(ttl) <= now
+}
+
+// setZSetDeadline records the deadline of the member key of the sorted set stored at bucket
+// added with given TTL and timestamp, none if ttl is Persistent.
+func (db *DB) setZSetDeadline(bucket, key string, ttl uint32, timestamp uint64) {
+	if ttl == Persistent {
+		if members, ok := db.zsetDeadlines[bucket]; ok {
+			delete(members, key)
+		}
+		return
+	}
+
+	if db.zsetDeadlines[bucket] == nil {
+		db.zsetDeadlines[bucket] = make(map[string]uint64)
+	}
+
+	db.zsetDeadlines[bucket][key] = timestamp + uint64(ttl)
+}
+
+// deleteExpiredZMembers removes the expired members of the sorted sets, and the deadlines of the
+// members removed by ZRem, ZRemRangeByRank, ZPopMax and ZPopMin.
+func (tx *Tx) deleteExpiredZMembers() error {
+	now := uint64(time.Now().Unix())
+
+	for bucket, members := range tx.db.zsetDeadlines {
+		ss := tx.db.SortedSetIdx[bucket]
+
+		for key, deadline := range members {
+			if ss == nil || ss.GetByKey(key) == nil {
+				delete(members, key)
+				continue
+			}
+
+			if deadline > now {
+				continue
+			}
+
+			if err := tx.ZRem(bucket, key); err != nil {
+				return err
+			}
+		}
+
+		if len(members) == 0 {
+			delete(tx.db.zsetDeadlines, bucket)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,250 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xujiajun/nutsdb/ds/zset"
+)
+
+func checkZScore(t *testing.T, bucket, key string, want float64) {
+	t.Helper()
+
+	if err := db.View(func(tx *Tx) error {
+		score, err := tx.ZScore(bucket, []byte(key))
+		if err != nil {
+			return err
+		}
+		if score != want {
+			t.Errorf("err ZScore %s, got %v want %v", key, score, want)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTx_ZIncrBy(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestzsetttl", true)
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	bucket := "zset_incr"
+	if err := db.Update(func(tx *Tx) error {
+		if err := tx.ZAdd(bucket, []byte("a"), 1, []byte("val_a")); err != nil {
+			return err
+		}
+		// the increments of the tx add up.
+		if _, err := tx.ZIncrBy(bucket, []byte("b"), 2); err != nil {
+			return err
+		}
+		score, err := tx.ZIncrBy(bucket, []byte("b"), 3)
+		if err != nil {
+			return err
+		}
+		if score != 5 {
+			t.Errorf("err ZIncrBy, got %v want %v", score, 5)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Update(func(tx *Tx) error {
+		_, err := tx.ZIncrBy(bucket, []byte("a"), -0.5)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	checkZScore(t, bucket, "a", 0.5)
+	checkZScore(t, bucket, "b", 5)
+
+	if err := db.View(func(tx *Tx) error {
+		node, err := tx.ZGetByKey(bucket, []byte("a"))
+		if err != nil {
+			return err
+		}
+		if string(node.Value) != "val_a" {
+			t.Errorf("err ZIncrBy, got val %s want %s", node.Value, "val_a")
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTx_ZAddWithTTL(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestzsetttl", true)
+	opt.CheckpointInterval = time.Hour
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bucket := "zset_ttl"
+	if err := db.Update(func(tx *Tx) error {
+		if err := tx.ZAddWithTTL(bucket, []byte("expiring"), 1, nil, 1); err != nil {
+			return err
+		}
+		if err := tx.ZAddWithTTL(bucket, []byte("later"), 2, nil, 100); err != nil {
+			return err
+		}
+		return tx.ZAdd(bucket, []byte("persistent"), 3, nil)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the deadlines are kept by the checkpoint written on close.
+	db.Close()
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// the increment keeps the TTL.
+	if err := db.Update(func(tx *Tx) error {
+		_, err := tx.ZIncrBy(bucket, []byte("expiring"), 10)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(2 * time.Second)
+
+	if err := db.deleteExpired(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.View(func(tx *Tx) error {
+		if _, err := tx.ZScore(bucket, []byte("expiring")); err != ErrNotFoundKey {
+			t.Errorf("err expired member, got %v want %v", err, ErrNotFoundKey)
+		}
+		n, err := tx.ZCard(bucket)
+		if err != nil {
+			return err
+		}
+		if n != 2 {
+			t.Errorf("err ZCard, got %d want %d", n, 2)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTx_ZSetExpiredMembers(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestzsetttl", true)
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// the expired members are kept in the index until the expiration worker runs.
+	bucket := "zset_expired"
+	now := uint64(time.Now().Unix())
+	if err := db.Update(func(tx *Tx) error {
+		if err := tx.ZAdd(bucket, []byte("a"), 1, nil); err != nil {
+			return err
+		}
+		if err := tx.zadd(bucket, []byte("b"), 2, nil, 10, now-20); err != nil {
+			return err
+		}
+		if err := tx.ZAdd(bucket, []byte("c"), 3, nil); err != nil {
+			return err
+		}
+		return tx.zadd(bucket, []byte("d"), 4, nil, 10, now-20)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := func(nodes []*zset.SortedSetNode) string {
+		var keys []string
+		for _, node := range nodes {
+			keys = append(keys, node.Key())
+		}
+		return strings.Join(keys, ",")
+	}
+
+	if err := db.View(func(tx *Tx) error {
+		if _, err := tx.ZScore(bucket, []byte("b")); err != ErrNotFoundKey {
+			t.Errorf("err ZScore, got %v want %v", err, ErrNotFoundKey)
+		}
+		if _, err := tx.ZGetByKey(bucket, []byte("b")); err != ErrNotFoundKey {
+			t.Errorf("err ZGetByKey, got %v want %v", err, ErrNotFoundKey)
+		}
+		if n, _ := tx.ZCard(bucket); n != 2 {
+			t.Errorf("err ZCard, got %d want %d", n, 2)
+		}
+		if n, _ := tx.ZCount(bucket, 0, 10, nil); n != 2 {
+			t.Errorf("err ZCount, got %d want %d", n, 2)
+		}
+		if nodes, _ := tx.ZRangeByScore(bucket, 0, 10, &zset.GetByScoreRangeOptions{Limit: 1, Offset: 1}); keys(nodes) != "c" {
+			t.Errorf("err ZRangeByScore, got %s want %s", keys(nodes), "c")
+		}
+		if nodes, _ := tx.ZRangeByRank(bucket, 1, -1); keys(nodes) != "a,c" {
+			t.Errorf("err ZRangeByRank, got %s want %s", keys(nodes), "a,c")
+		}
+		if nodes, _ := tx.ZRevRangeByRank(bucket, 1, 2); keys(nodes) != "c,a" {
+			t.Errorf("err ZRevRangeByRank, got %s want %s", keys(nodes), "c,a")
+		}
+		if rank, _ := tx.ZRank(bucket, []byte("c")); rank != 2 {
+			t.Errorf("err ZRank, got %d want %d", rank, 2)
+		}
+		if rank, _ := tx.ZRevRank(bucket, []byte("a")); rank != 2 {
+			t.Errorf("err ZRevRank, got %d want %d", rank, 2)
+		}
+		if node, _ := tx.ZPeekMax(bucket); node == nil || node.Key() != "c" {
+			t.Errorf("err ZPeekMax, got %v want %s", node, "c")
+		}
+		if nodes, _, _ := tx.ZScan(bucket, "", 0); keys(nodes) != "a,c" {
+			t.Errorf("err ZScan, got %s want %s", keys(nodes), "a,c")
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the pop removes the live member, not the expired one with a higher score.
+	if err := db.Update(func(tx *Tx) error {
+		node, err := tx.ZPopMax(bucket)
+		if err != nil {
+			return err
+		}
+		if node == nil || node.Key() != "c" {
+			t.Errorf("err ZPopMax, got %v want %s", node, "c")
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.View(func(tx *Tx) error {
+		if nodes, _ := tx.ZRangeByRank(bucket, 1, -1); keys(nodes) != "a" {
+			t.Errorf("err ZPopMax, got %s want %s", keys(nodes), "a")
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.18
+// +build go1.18
+
+package nutsdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+)
+
+// ErrCodec is returned when a key or a value can not be decoded by the codec of a TypedBucket.
+var ErrCodec = errors.New("invalid encoded key or value")
+
+// Codec encodes and decodes the keys or the values of a TypedBucket. The codecs of the keys must
+// keep the order of the keys for the scans, like StringCodec and Uint64Codec.
+// Other encodings such as protocol buffers are plugged in by implementing it.
+type Codec[T any] interface {
+	Encode(v T) ([]byte, error)
+	Decode(data []byte) (T, error)
+}
+
+// JSONCodec encodes the values in JSON.
+type JSONCodec[T any] struct{}
+
+// Encode returns the JSON encoding of v.
+func (JSONCodec[T]) Encode(v T) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Decode returns the value of the JSON encoding.
+func (JSONCodec[T]) Decode(data []byte) (T, error) {
+	var v T
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+// GobCodec encodes the values with encoding/gob.
+type GobCodec[T any] struct{}
+
+// Encode returns the gob encoding of v.
+func (GobCodec[T]) Encode(v T) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode returns the value of the gob encoding.
+func (GobCodec[T]) Decode(data []byte) (T, error) {
+	var v T
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&v)
+	return v, err
+}
+
+// StringCodec encodes the strings as their bytes.
+type StringCodec struct{}
+
+// Encode returns the bytes of v.
+func (StringCodec) Encode(v string) ([]byte, error) {
+	return []byte(v), nil
+}
+
+// Decode returns the string of the bytes.
+func (StringCodec) Decode(data []byte) (string, error) {
+	return string(data), nil
+}
+
+// Uint64Codec encodes the uint64 in 8 bytes big endian, which keeps their order.
+type Uint64Codec struct{}
+
+// Encode returns the 8 bytes big endian encoding of v.
+func (Uint64Codec) Encode(v uint64) ([]byte, error) {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b, nil
+}
+
+// Decode returns the uint64 of the 8 bytes big endian encoding.
+func (Uint64Codec) Decode(data []byte) (uint64, error) {
+	if len(data) != 8 {
+		return 0, ErrCodec
+	}
+	return binary.BigEndian.Uint64(data), nil
+}
+
+// TypedBucket represents a bucket of key/value pairs of the types K and V, encoded by their codecs.
+// It is used within the transactions like the bucket it wraps.
+type TypedBucket[K, V any] struct {
+	name   string
+	keys   Codec[K]
+	values Codec[V]
+}
+
+// TypedEntry represents a decoded key/value pair of a TypedBucket.
+type TypedEntry[K, V any] struct {
+	Key   K
+	Value V
+}
+
+// NewTypedBucket returns a TypedBucket of the bucket at given name with the codecs of the keys and values.
+func NewTypedBucket[K, V any](name string, keys Codec[K], values Codec[V]) *TypedBucket[K, V] {
+	return &TypedBucket[K, V]{name: name, keys: keys, values: values}
+}
+
+// Name returns the name of the bucket.
+func (b *TypedBucket[K, V]) Name() string {
+	return b.name
+}
+
+// Put sets the value for a key in the bucket within the tx.
+func (b *TypedBucket[K, V]) Put(tx *Tx, key K, value V, ttl uint32) error {
+	k, err := b.keys.Encode(key)
+	if err != nil {
+		return err
+	}
+
+	v, err := b.values.Encode(value)
+	if err != nil {
+		return err
+	}
+
+	return tx.Put(b.name, k, v, ttl)
+}
+
+// Get retrieves the value for a key in the bucket within the tx.
+func (b *TypedBucket[K, V]) Get(tx *Tx, key K) (V, error) {
+	var value V
+
+	k, err := b.keys.Encode(key)
+	if err != nil {
+		return value, err
+	}
+
+	e, err := tx.Get(b.name, k)
+	if err != nil {
+		return value, err
+	}
+
+	return b.values.Decode(e.Value)
+}
+
+// Delete removes a key from the bucket within the tx.
+func (b *TypedBucket[K, V]) Delete(tx *Tx, key K) error {
+	k, err := b.keys.Encode(key)
+	if err != nil {
+		return err
+	}
+
+	return tx.Delete(b.name, k)
+}
+
+// Scan returns the key/value pairs of the bucket with the keys from start to end within the tx,
+// like RangeScan.
+func (b *TypedBucket[K, V]) Scan(tx *Tx, start, end K) ([]TypedEntry[K, V], error) {
+	s, err := b.keys.Encode(start)
+	if err != nil {
+		return nil, err
+	}
+
+	e, err := b.keys.Encode(end)
+	if err != nil {
+		return nil, err
+	}
+
+	es, err := tx.RangeScan(b.name, s, e)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.decode(es)
+}
+
+// All returns all the key/value pairs of the bucket within the tx, like GetAll.
+func (b *TypedBucket[K, V]) All(tx *Tx) ([]TypedEntry[K, V], error) {
+	es, err := tx.GetAll(b.name)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.decode(es)
+}
+
+func (b *TypedBucket[K, V]) decode(es Entries) ([]TypedEntry[K, V], error) {
+	entries := make([]TypedEntry[K, V], 0, len(es))
+	for _, e := range es {
+		key, err := b.keys.Decode(e.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := b.values.Decode(e.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, TypedEntry[K, V]{Key: key, Value: value})
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,110 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.18
+// +build go1.18
+
+package nutsdb
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type typedUser struct {
+	Name string
+	Age  int
+}
+
+func TestTypedBucket(t *testing.T) {
+	InitOpt("/tmp/nutsdbtesttyped", true)
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, values := range []Codec[typedUser]{JSONCodec[typedUser]{}, GobCodec[typedUser]{}} {
+		users := NewTypedBucket[uint64, typedUser]("users", Uint64Codec{}, values)
+
+		if err := db.Update(func(tx *Tx) error {
+			for i := uint64(1); i <= 20; i++ {
+				if err := users.Put(tx, i, typedUser{Name: "user", Age: int(i)}, Persistent); err != nil {
+					return err
+				}
+			}
+			return users.Delete(tx, 5)
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := db.View(func(tx *Tx) error {
+			u, err := users.Get(tx, 3)
+			if err != nil {
+				return err
+			}
+			if want := (typedUser{Name: "user", Age: 3}); u != want {
+				t.Errorf("%T: err Get, got %+v want %+v", values, u, want)
+			}
+
+			if _, err := users.Get(tx, 5); !errors.Is(err, ErrKeyNotFound) {
+				t.Errorf("%T: err Get, got %v want %v", values, err, ErrKeyNotFound)
+			}
+
+			// the keys are scanned in the order of the numbers, 10 is after 9.
+			entries, err := users.Scan(tx, 4, 10)
+			if err != nil {
+				return err
+			}
+			var keys []uint64
+			for _, e := range entries {
+				keys = append(keys, e.Key)
+				if e.Value.Age != int(e.Key) {
+					t.Errorf("%T: err Scan, got %+v at key %d", values, e.Value, e.Key)
+				}
+			}
+			if want := []uint64{4, 6, 7, 8, 9, 10}; !reflect.DeepEqual(keys, want) {
+				t.Errorf("%T: err Scan, got keys %v want %v", values, keys, want)
+			}
+
+			all, err := users.All(tx)
+			if err != nil {
+				return err
+			}
+			if len(all) != 19 {
+				t.Errorf("%T: err All, got %d entries want 19", values, len(all))
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	names := NewTypedBucket[string, string]("names", StringCodec{}, StringCodec{})
+	if err := db.Update(func(tx *Tx) error {
+		return tx.Put(names.Name(), []byte("short"), []byte("val"), Persistent)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the keys which can not be decoded are reported.
+	counters := NewTypedBucket[uint64, string]("names", Uint64Codec{}, StringCodec{})
+	if err := db.View(func(tx *Tx) error {
+		_, err := counters.All(tx)
+		return err
+	}); err != ErrCodec {
+		t.Errorf("err All, got %v want %v", err, ErrCodec)
+	}
+}
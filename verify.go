@@ -0,0 +1,461 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/xujiajun/utils/strconv2"
+)
+
+var (
+	// ErrDanglingRecord is returned by the check of a record of the index when the entry at
+	// its position is missing or has another bucket or key.
+	ErrDanglingRecord = errors.New("the entry of the record is missing")
+
+	// ErrRepairNotSupported is returned when repairing a database in HintBPTSparseIdxMode.
+	ErrRepairNotSupported = errors.New("repair not support mode `HintBPTSparseIdxMode`")
+)
+
+// quarantineDir is the directory of the data files quarantined by Repair.
+const quarantineDir = "quarantine"
+
+// VerifyReport represents the health of the data files and of the index checked by Verify.
+type VerifyReport struct {
+	// DataFiles represents the number of the data files checked.
+	DataFiles int
+
+	// Entries represents the number of the valid entries of the data files,
+	// the commit records excluded.
+	Entries int
+
+	// Corruptions represents the corrupted entries, at most one for each data file.
+	Corruptions []Corruption
+
+	// DanglingRecords represents the records of the index whose entries are corrupted or missing.
+	DanglingRecords []DanglingRecord
+
+	// OrphanedEntries represents the number of the entries written by the txs which never
+	// committed, they are ignored by the index and dropped by a merge.
+	OrphanedEntries int
+
+	// Quarantined represents the paths of the data files moved to the quarantine directory by Repair.
+	Quarantined []string
+
+	// Files represents the data files checked, in the order of their ids.
+	Files []DataFileReport
+}
+
+// DataFileReport represents a data file checked by Verify.
+type DataFileReport struct {
+	FileID int64
+
+	// Entries represents the number of the valid entries of the data file, the commit records included.
+	Entries int
+
+	// Size represents the size in bytes of the valid entries, from the start of the data file
+	// to its end or to its corrupted entry.
+	Size int64
+}
+
+// Healthy returns if no corrupted entry nor dangling record is found.
+func (r *VerifyReport) Healthy() bool {
+	return len(r.Corruptions) == 0 && len(r.DanglingRecords) == 0
+}
+
+// Corruption represents the first corrupted entry of a data file, the entries from Offset
+// to the end of the data file can not be parsed.
+type Corruption struct {
+	FileID int64
+	Offset int64
+	Err    error
+}
+
+// DanglingRecord represents a record of the index of a bucket whose entry is corrupted or missing.
+type DanglingRecord struct {
+	Bucket string
+	Key    []byte
+	FileID int64
+	Offset int64
+	Err    error
+}
+
+// Verify checks the crc of the entries of all the data files and that the records of the index
+// point at their entries, and returns the problems found. The index is only checked in
+// HintKeyValAndRAMIdxMode and HintKeyAndRAMIdxMode. The writes wait until it returns.
+// An entry which can not be decoded for a missing encryption key or compressor is not
+// a corruption, Verify returns ErrEncryptionKeyNotFound or ErrCompressorNotRegistered.
+func (db *DB) Verify() (*VerifyReport, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, ErrDBClosed
+	}
+
+	return db.verify()
+}
+
+// verify checks the data files and the index, the caller must hold the lock of the db.
+func (db *DB) verify() (*VerifyReport, error) {
+	report := &VerifyReport{}
+
+	_, fileIDs := db.getMaxFileIDAndFileIDs()
+	for _, fID := range fileIDs {
+		if err := db.verifyDataFile(int64(fID), report); err != nil {
+			return nil, err
+		}
+	}
+
+	if db.opt.EntryIdxMode != HintBPTSparseIdxMode {
+		db.verifyIndex(report)
+	}
+
+	return report, nil
+}
+
+// verifyDataFile parses the data file at given fID up to its first corrupted entry.
+func (db *DB) verifyDataFile(fID int64, report *VerifyReport) error {
+	f, err := db.openDataFile(db.getDataPath(fID), db.opt.RWMode)
+	if err != nil {
+		return err
+	}
+	defer f.rwManager.Close()
+
+	report.DataFiles++
+
+	file := DataFileReport{FileID: fID}
+	defer func() { report.Files = append(report.Files, file) }()
+
+	end := db.opt.SegmentSize
+	if fID == db.MaxFileID {
+		end = db.ActiveFile.writeOff
+	}
+
+	var (
+		off       int64
+		commits   = make(map[uint64]*txCommit)
+		committed = make(map[uint64]struct{})
+		entries   = make(map[uint64]int) // the entries of each tx
+	)
+
+	for off < end {
+		entry, err := f.ReadAt(int(off))
+		if err == io.EOF || err == nil && entry == nil {
+			break
+		}
+		if err == nil {
+			err = db.decodeEntry(entry)
+
+			// the entries are not corrupted, Repair must not quarantine the data file.
+			if errors.Is(err, ErrEncryptionKeyNotFound) || errors.Is(err, ErrCompressorNotRegistered) {
+				return err
+			}
+		}
+		if err != nil {
+			report.Corruptions = append(report.Corruptions, Corruption{FileID: fID, Offset: off, Err: err})
+			break
+		}
+
+		file.Entries++
+		file.Size = off + entry.Size()
+
+		txID := entry.Meta.txID
+		if isTxCommitEntry(entry) {
+			if c, ok := commits[txID]; ok && c.matches(entry) {
+				committed[txID] = struct{}{}
+			}
+			off += entry.Size()
+			continue
+		}
+
+		if _, ok := commits[txID]; !ok {
+			commits[txID] = &txCommit{}
+		}
+		commits[txID].addEntry(entry)
+
+		if entry.Meta.status == Committed {
+			committed[txID] = struct{}{}
+		}
+
+		entries[txID]++
+		report.Entries++
+
+		off += entry.Size()
+	}
+
+	for txID, n := range entries {
+		if _, ok := committed[txID]; !ok {
+			report.OrphanedEntries += n
+		}
+	}
+
+	return nil
+}
+
+// verifyIndex checks that the live records of the B+ trees of the buckets point at their entries.
+func (db *DB) verifyIndex(report *VerifyReport) {
+	buckets := make([]string, 0, len(db.BPTreeIdx))
+	for bucket := range db.BPTreeIdx {
+		buckets = append(buckets, bucket)
+	}
+	sort.Strings(buckets)
+
+	for _, bucket := range buckets {
+		records, err := db.BPTreeIdx[bucket].All()
+		if err != nil {
+			continue
+		}
+
+		for _, r := range records {
+			if r.H.meta.Flag == DataDeleteFlag || r.IsExpired() {
+				continue
+			}
+
+			if _, err := db.readRecordEntry(bucket, r); err != nil {
+				report.DanglingRecords = append(report.DanglingRecords, DanglingRecord{
+					Bucket: bucket,
+					Key:    r.H.key,
+					FileID: r.H.fileID,
+					Offset: int64(r.H.dataPos),
+					Err:    err,
+				})
+			}
+		}
+	}
+}
+
+// readRecordEntry returns the entry of the record of the bucket read from its data file,
+// without the entry cache.
+func (db *DB) readRecordEntry(bucket string, r *Record) (*Entry, error) {
+	if !db.dataFileExists(db.getDataPath(r.H.fileID)) {
+		return nil, ErrDanglingRecord
+	}
+
+	df, err := db.fileCache.acquire(r.H.fileID)
+	if err != nil {
+		return nil, err
+	}
+	defer db.fileCache.release(r.H.fileID, df)
+
+	e, err := df.ReadAt(int(r.H.dataPos))
+	if err != nil {
+		return nil, err
+	}
+	if e == nil {
+		return nil, ErrDanglingRecord
+	}
+
+	if err := db.decodeEntry(e); err != nil {
+		return nil, err
+	}
+
+	if string(e.Meta.bucket) != bucket || !bytes.Equal(e.Key, r.H.key) {
+		return nil, ErrDanglingRecord
+	}
+
+	return e, nil
+}
+
+// Repair verifies the database like Verify and repairs the problems found: the live entries
+// of the corrupted data files which can still be read are rewritten to the active file and
+// the data files are moved to the quarantine directory, the keys of the dangling records are
+// deleted. It returns the report of Verify with the quarantined data files.
+func (db *DB) Repair() (*VerifyReport, error) {
+	if db.opt.EntryIdxMode == HintBPTSparseIdxMode {
+		return nil, ErrRepairNotSupported
+	}
+
+	tx, err := db.Begin(true)
+	if err != nil {
+		return nil, err
+	}
+	tx.isMerging = true
+
+	report, err := db.verify()
+	if err != nil || report.Healthy() {
+		tx.Rollback()
+		return report, err
+	}
+
+	corrupted := make(map[int64]Corruption, len(report.Corruptions))
+	for _, c := range report.Corruptions {
+		corrupted[c.FileID] = c
+	}
+
+	// the tx must not write to a corrupted active file.
+	if _, ok := corrupted[db.MaxFileID]; ok {
+		if err := db.sealActiveFile(); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if err := db.salvage(tx, corrupted, report.DanglingRecords); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	// the checkpoint may point at the quarantined data files.
+	_ = os.Remove(db.getCheckpointPath())
+
+	for _, c := range report.Corruptions {
+		path, err := db.quarantineDataFile(c.FileID)
+		if err != nil {
+			return report, err
+		}
+		report.Quarantined = append(report.Quarantined, path)
+	}
+
+	return report, nil
+}
+
+// salvage rewrites within the tx the live entries of the corrupted data files which can
+// still be read, and deletes the keys of the dangling records.
+func (db *DB) salvage(tx *Tx, corrupted map[int64]Corruption, dangling []DanglingRecord) error {
+	var pendingEntries []*Entry
+
+	for bucket, idx := range db.BPTreeIdx {
+		records, err := idx.All()
+		if err != nil {
+			continue
+		}
+
+		for _, r := range records {
+			if _, ok := corrupted[r.H.fileID]; !ok || r.H.meta.Flag == DataDeleteFlag || r.IsExpired() {
+				continue
+			}
+
+			if e, err := db.readRecordEntry(bucket, r); err == nil {
+				pendingEntries = append(pendingEntries, e)
+			}
+		}
+	}
+
+	// the entries of the other data structures are rewritten from the part of the data files
+	// before the corrupted entries.
+	for fID, c := range corrupted {
+		es, err := db.salvageDataFile(fID, c.Offset)
+		if err != nil {
+			return err
+		}
+		pendingEntries = append(pendingEntries, es...)
+	}
+
+	for _, e := range pendingEntries {
+		err := tx.put(string(e.Meta.bucket), e.Key, e.Value, e.Meta.TTL, e.Meta.Flag, e.Meta.timestamp, e.Meta.ds)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, d := range dangling {
+		if err := tx.Delete(d.Bucket, d.Key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// salvageDataFile returns the live entries of the data file at given fID before the offset end,
+// except the ones of the B+ trees.
+func (db *DB) salvageDataFile(fID int64, end int64) ([]*Entry, error) {
+	var (
+		off            int64
+		pendingEntries []*Entry
+		bitmapKeys     []bitmapKey
+		seenBitmapKeys = make(map[bitmapKey]struct{})
+	)
+
+	f, err := db.openDataFile(db.getDataPath(fID), db.opt.RWMode)
+	if err != nil {
+		return nil, err
+	}
+	defer f.rwManager.Close()
+
+	for off < end {
+		entry, err := f.ReadAt(int(off))
+		if err != nil || entry == nil {
+			break
+		}
+		if err := db.decodeEntry(entry); err != nil {
+			break
+		}
+		off += entry.Size()
+
+		if isTxCommitEntry(entry) || entry.Meta.ds == DataStructureBPTree {
+			continue
+		}
+
+		if entry.Meta.ds == DataStructureBitmap {
+			k := bitmapKey{bucket: string(entry.Meta.bucket), key: string(entry.Key)}
+			if _, ok := seenBitmapKeys[k]; !ok {
+				seenBitmapKeys[k] = struct{}{}
+				bitmapKeys = append(bitmapKeys, k)
+			}
+		} else if !db.isFilterEntry(entry) {
+			pendingEntries = db.getPendingMergeEntries(entry, pendingEntries)
+		}
+	}
+
+	for _, k := range bitmapKeys {
+		if e := db.getBitmapMergeEntry(k); e != nil {
+			pendingEntries = append(pendingEntries, e)
+		}
+	}
+
+	return pendingEntries, nil
+}
+
+// quarantineDataFile moves the data file at given fID to the quarantine directory and returns its new path.
+func (db *DB) quarantineDataFile(fID int64) (string, error) {
+	if err := db.checkFileBackend(); err != nil {
+		return "", err
+	}
+
+	dir := db.opt.Dir + "/" + quarantineDir
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", err
+	}
+
+	db.fileCache.remove(fID)
+	db.overflowCache.remove(fID)
+
+	path := dir + "/" + strconv2.Int64ToStr(fID) + DataSuffix
+	if err := os.Rename(db.getDataPath(fID), path); err != nil {
+		return "", err
+	}
+
+	// the values of the entries in the overflow file are quarantined with them.
+	overflowPath := dir + "/" + strconv2.Int64ToStr(fID) + OverflowSuffix
+	if err := os.Rename(db.getOverflowPath(fID), overflowPath); err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	return path, nil
+}
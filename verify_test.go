@@ -0,0 +1,230 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"os"
+	"testing"
+
+	"github.com/xujiajun/utils/strconv2"
+)
+
+func checkVerifyKeys(t *testing.T, bucket string, missing int) {
+	t.Helper()
+
+	if err := db.View(func(tx *Tx) error {
+		for i := 0; i < 10; i++ {
+			key := []byte("key_" + strconv2.IntToStr(i))
+			e, err := tx.Get(bucket, key)
+			if i == missing {
+				if err == nil {
+					t.Errorf("err repair, got %s for the corrupted key", key)
+				}
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if want := "val_" + strconv2.IntToStr(i); string(e.Value) != want {
+				t.Errorf("err repair, got %s want %s", e.Value, want)
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDB_VerifyAndRepair(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestverify", true)
+	opt.SegmentSize = 512
+
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bucket := "bucket_verify"
+	for i := 0; i < 10; i++ {
+		if err := db.Update(func(tx *Tx) error {
+			return tx.Put(bucket, []byte("key_"+strconv2.IntToStr(i)), []byte("val_"+strconv2.IntToStr(i)), Persistent)
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := db.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Healthy() || report.Entries != 10 || report.DataFiles < 2 {
+		t.Fatalf("err verify, got %+v", report)
+	}
+
+	// flip the last byte of the value of key_3, the keys after it in the data file can not be parsed.
+	r, err := db.BPTreeIdx[bucket].Find([]byte("key_3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fID, off := r.H.fileID, int64(r.H.dataPos)
+	f, err := os.OpenFile(db.getDataPath(fID), os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 1)
+	if _, err := f.ReadAt(b, off+r.E.Size()-1); err != nil {
+		t.Fatal(err)
+	}
+	b[0] ^= 0xff
+	if _, err := f.WriteAt(b, off+r.E.Size()-1); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	report, err = db.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Corruptions) != 1 || report.Corruptions[0].FileID != fID || report.Corruptions[0].Offset != off {
+		t.Fatalf("err verify corruptions, got %+v", report.Corruptions)
+	}
+	if len(report.DanglingRecords) != 1 || string(report.DanglingRecords[0].Key) != "key_3" {
+		t.Fatalf("err verify dangling records, got %+v", report.DanglingRecords)
+	}
+
+	report, err = db.Repair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Quarantined) != 1 {
+		t.Fatalf("err repair quarantined, got %v", report.Quarantined)
+	}
+	if _, err := os.Stat(report.Quarantined[0]); err != nil {
+		t.Fatal(err)
+	}
+	checkVerifyKeys(t, bucket, 3)
+
+	if report, err = db.Verify(); err != nil || !report.Healthy() {
+		t.Fatalf("err verify after repair, got %+v, %v", report, err)
+	}
+
+	// the repaired db opens without the quarantined data file.
+	db.Close()
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	checkVerifyKeys(t, bucket, 3)
+	if report, err = db.Verify(); err != nil || !report.Healthy() {
+		t.Fatalf("err verify after reopen, got %+v, %v", report, err)
+	}
+}
+
+func TestDB_OpenCorrupted(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestopencorrupted", true)
+	opt.SegmentSize = 512
+
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bucket := "bucket_open_corrupted"
+	for i := 0; i < 10; i++ {
+		if err := db.Update(func(tx *Tx) error {
+			return tx.Put(bucket, []byte("key_"+strconv2.IntToStr(i)), []byte("val_"+strconv2.IntToStr(i)), Persistent)
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// flip the last byte of the value of key_9 in the active file.
+	r, err := db.BPTreeIdx[bucket].Find([]byte("key_9"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fID, off, size := r.H.fileID, int64(r.H.dataPos), r.E.Size()
+	if fID != db.MaxFileID {
+		t.Fatalf("err active file, got %d want %d", fID, db.MaxFileID)
+	}
+	db.Close()
+
+	f, err := os.OpenFile(db.getDataPath(fID), os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 1)
+	if _, err := f.ReadAt(b, off+size-1); err != nil {
+		t.Fatal(err)
+	}
+	b[0] ^= 0xff
+	if _, err := f.WriteAt(b, off+size-1); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	if db, err = Open(opt); err == nil {
+		db.Close()
+		t.Fatal("err open the corrupted data file without OpenCorrupted")
+	}
+
+	opt.OpenCorrupted = true
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the corrupted active file is sealed.
+	if db.MaxFileID != fID+1 {
+		t.Fatalf("err max file id, got %d want %d", db.MaxFileID, fID+1)
+	}
+
+	report, err := db.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Corruptions) != 1 || report.Corruptions[0].FileID != fID || report.Corruptions[0].Offset != off {
+		t.Fatalf("err verify corruptions, got %+v", report.Corruptions)
+	}
+	if len(report.Files) != report.DataFiles {
+		t.Fatalf("err verify files, got %d want %d", len(report.Files), report.DataFiles)
+	}
+	for _, file := range report.Files {
+		if file.FileID == fID && file.Size != off {
+			t.Fatalf("err size of the corrupted data file, got %d want %d", file.Size, off)
+		}
+	}
+
+	report, err = db.Repair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Quarantined) != 1 {
+		t.Fatalf("err repair quarantined, got %v", report.Quarantined)
+	}
+	checkVerifyKeys(t, bucket, 9)
+	db.Close()
+
+	opt.OpenCorrupted = false
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	checkVerifyKeys(t, bucket, 9)
+}
@@ -0,0 +1,178 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"bytes"
+	"errors"
+)
+
+var (
+	// ErrWatchOverflow is returned by Watcher.Err when the watcher is closed
+	// because its events were not received fast enough.
+	ErrWatchOverflow = errors.New("watcher overflow, events not received fast enough")
+
+	// ErrWatcherClosed is returned by Watcher.Err when the watcher is closed by Close
+	// or the db is closed.
+	ErrWatcherClosed = errors.New("watcher is closed")
+)
+
+// DefaultWatchBufferSize is the size of the event buffer of a watcher
+// when Options.WatchBufferSize is not set.
+const DefaultWatchBufferSize = 1024
+
+// EventType represents the type of a watch event.
+type EventType int
+
+const (
+	// EventPut represents a key is put.
+	EventPut EventType = iota
+
+	// EventDelete represents a key is deleted.
+	EventDelete
+
+	// EventExpire represents an expired key is deleted by the expiration worker.
+	EventExpire
+)
+
+// Event represents a change of a key committed by a transaction.
+type Event struct {
+	Type   EventType
+	Bucket string
+	Key    []byte
+	Value  []byte // the value put, nil for EventDelete and EventExpire
+	TTL    uint32
+}
+
+// Watcher delivers the events of the keys with a prefix in a bucket.
+type Watcher struct {
+	db     *DB
+	bucket string
+	prefix []byte
+	ch     chan Event
+	err    error // set when the watcher is closed, guarded by db.watchMu
+}
+
+// Watch subscribes the changes of the key/value pairs whose key has the prefix in the bucket,
+// an empty prefix watches the whole bucket.
+// The events are delivered in commit order. If the events buffer is full, the watcher is closed
+// and Err returns ErrWatchOverflow, so the subscriber has to reload and watch again.
+func (db *DB) Watch(bucket string, prefix []byte) (*Watcher, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, ErrDBClosed
+	}
+
+	bufferSize := db.opt.WatchBufferSize
+	if bufferSize <= 0 {
+		bufferSize = DefaultWatchBufferSize
+	}
+
+	w := &Watcher{
+		db:     db,
+		bucket: bucket,
+		prefix: append([]byte(nil), prefix...),
+		ch:     make(chan Event, bufferSize),
+	}
+
+	db.watchMu.Lock()
+	db.watchers[w] = struct{}{}
+	db.watchMu.Unlock()
+
+	return w, nil
+}
+
+// Events returns the channel delivering the events, it is closed when the watcher is closed.
+func (w *Watcher) Events() <-chan Event {
+	return w.ch
+}
+
+// Err returns the reason why the watcher is closed, or nil if it is still open.
+func (w *Watcher) Err() error {
+	w.db.watchMu.Lock()
+	defer w.db.watchMu.Unlock()
+
+	return w.err
+}
+
+// Close unsubscribes the watcher and closes its events channel.
+func (w *Watcher) Close() {
+	w.db.watchMu.Lock()
+	defer w.db.watchMu.Unlock()
+
+	w.db.closeWatcher(w, ErrWatcherClosed)
+}
+
+// closeWatcher closes the watcher with the err, the caller must hold db.watchMu.
+func (db *DB) closeWatcher(w *Watcher, err error) {
+	if w.err != nil {
+		return
+	}
+
+	w.err = err
+	delete(db.watchers, w)
+	close(w.ch)
+}
+
+// closeWatchers closes all the watchers when the db is closed.
+func (db *DB) closeWatchers() {
+	db.watchMu.Lock()
+	defer db.watchMu.Unlock()
+
+	for w := range db.watchers {
+		db.closeWatcher(w, ErrWatcherClosed)
+	}
+}
+
+// publish delivers the events of the committed key/value entries to the watchers.
+// It never blocks, a watcher whose buffer is full is closed.
+func (db *DB) publish(entries []*Entry, expired bool) {
+	db.watchMu.Lock()
+	defer db.watchMu.Unlock()
+
+	if len(db.watchers) == 0 {
+		return
+	}
+
+	for _, entry := range entries {
+		if entry.Meta.ds != DataStructureBPTree {
+			continue
+		}
+
+		event := Event{Bucket: string(entry.Meta.bucket), Key: entry.Key, TTL: entry.Meta.TTL}
+		switch {
+		case entry.Meta.Flag == DataSetFlag:
+			event.Type, event.Value = EventPut, entry.Value
+		case expired:
+			event.Type = EventExpire
+		default:
+			event.Type = EventDelete
+		}
+
+		for w := range db.watchers {
+			if w.bucket != event.Bucket || !bytes.HasPrefix(event.Key, w.prefix) {
+				continue
+			}
+
+			select {
+			case w.ch <- event:
+			default:
+				db.closeWatcher(w, ErrWatchOverflow)
+			}
+		}
+	}
+}
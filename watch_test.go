@@ -0,0 +1,134 @@
+// Copyright 2019 The nutsdb Author. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nutsdb
+
+import (
+	"testing"
+	"time"
+)
+
+func receiveEvent(t *testing.T, w *Watcher) Event {
+	select {
+	case event, ok := <-w.Events():
+		if !ok {
+			t.Fatalf("err watch, the watcher is closed: %v", w.Err())
+		}
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("err watch, no event received")
+	}
+
+	return Event{}
+}
+
+func TestDB_Watch(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestforwatch", true)
+	opt.ExpireInterval = 50 * time.Millisecond
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	bucket := "bucket_for_watch"
+	w, err := db.Watch(bucket, []byte("user_"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Update(func(tx *Tx) error {
+		if err := tx.Put(bucket, []byte("user_1"), []byte("val_1"), Persistent); err != nil {
+			return err
+		}
+		if err := tx.Put(bucket, []byte("other_1"), []byte("val_1"), Persistent); err != nil {
+			return err
+		}
+		if err := tx.Put("other_bucket", []byte("user_1"), []byte("val_1"), Persistent); err != nil {
+			return err
+		}
+		return tx.Delete(bucket, []byte("user_2"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if event := receiveEvent(t, w); event.Type != EventPut || string(event.Key) != "user_1" || string(event.Value) != "val_1" {
+		t.Errorf("err watch, got %+v", event)
+	}
+	if event := receiveEvent(t, w); event.Type != EventDelete || string(event.Key) != "user_2" {
+		t.Errorf("err watch, got %+v", event)
+	}
+
+	if err := db.Update(func(tx *Tx) error {
+		return tx.Put(bucket, []byte("user_3"), []byte("val_3"), 1)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if event := receiveEvent(t, w); event.Type != EventPut || string(event.Key) != "user_3" {
+		t.Errorf("err watch, got %+v", event)
+	}
+	if event := receiveEvent(t, w); event.Type != EventExpire || string(event.Key) != "user_3" {
+		t.Errorf("err watch, got %+v", event)
+	}
+
+	w.Close()
+	if _, ok := <-w.Events(); ok || w.Err() != ErrWatcherClosed {
+		t.Errorf("err watch, got %v want %v", w.Err(), ErrWatcherClosed)
+	}
+}
+
+func TestDB_WatchOverflow(t *testing.T) {
+	InitOpt("/tmp/nutsdbtestforwatch", true)
+	opt.WatchBufferSize = 1
+	db, err = Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bucket := "bucket_for_watch"
+	w, err := db.Watch(bucket, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Batch([]BatchEntry{
+		{Bucket: bucket, Key: []byte("key_1"), Value: []byte("val_1")},
+		{Bucket: bucket, Key: []byte("key_2"), Value: []byte("val_2")},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if event := receiveEvent(t, w); string(event.Key) != "key_1" {
+		t.Errorf("err watch, got %+v", event)
+	}
+	if _, ok := <-w.Events(); ok || w.Err() != ErrWatchOverflow {
+		t.Errorf("err watch, got %v want %v", w.Err(), ErrWatchOverflow)
+	}
+
+	w2, err := db.Watch(bucket, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-w2.Events(); ok || w2.Err() != ErrWatcherClosed {
+		t.Errorf("err watch, got %v want %v", w2.Err(), ErrWatcherClosed)
+	}
+
+	if _, err := db.Watch(bucket, nil); err != ErrDBClosed {
+		t.Errorf("err watch, got %v want %v", err, ErrDBClosed)
+	}
+}